@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapformat"
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+// analyticsFlag writes every processed map's analytics to its
+// mapAnalyticsFile.
+var analyticsFlag bool
+
+// mapAnalyticsFile is the file next to a map's manifest that --analytics
+// writes its analytics to.
+const mapAnalyticsFile = "analytics.json"
+
+// maxElevation is the highest land magnitude, the last bin of the elevation
+// histogram.
+const maxElevation = 30
+
+// mapAnalytics is a map's analytics.json with --analytics, and its entry in
+// the analytics reports of --report, so that the map team can compare
+// submissions with the existing maps quantitatively. It is measured on the
+// packed map.bin.
+type mapAnalytics struct {
+	Name   string `json:"name"`
+	IsTest bool   `json:"test,omitempty"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	// Percentages of all tiles.
+	LandPercent       float64 `json:"land_percent"`
+	WaterPercent      float64 `json:"water_percent"`
+	ImpassablePercent float64 `json:"impassable_percent"`
+	Landmasses        int     `json:"landmasses"`
+	// LargestLandmassShare is the share of the land tiles in the largest
+	// landmass, the main continent.
+	LargestLandmassShare float64          `json:"largest_landmass_share"`
+	LandmassSizes        sizeDistribution `json:"landmass_sizes"`
+	// Lakes are the water bodies outside the ocean.
+	Lakes     int              `json:"lakes"`
+	LakeSizes sizeDistribution `json:"lake_sizes"`
+	// ShorelineLength counts the tile edges between land and water.
+	ShorelineLength int `json:"shoreline_length"`
+	// ElevationHistogram counts the land tiles of each magnitude, 0 to 30:
+	// under 10 is plains, under 20 highland and the rest mountain.
+	ElevationHistogram []int `json:"elevation_histogram"`
+}
+
+// sizeDistribution summarises the sizes, in tiles, of a map's landmasses or
+// lakes.
+type sizeDistribution struct {
+	Largest int `json:"largest"`
+	Median  int `json:"median"`
+	// Buckets counts the bodies under 1k, 1k-10k, 10k-100k and 100k+ tiles,
+	// as the manifest's stats.island_sizes.
+	Buckets []int `json:"buckets"`
+}
+
+// newSizeDistribution summarises sizes, sorted from largest to smallest.
+func newSizeDistribution(sizes []int) sizeDistribution {
+	d := sizeDistribution{Buckets: make([]int, len(islandSizeBuckets)+1)}
+	if len(sizes) > 0 {
+		d.Largest = sizes[0]
+		d.Median = sizes[len(sizes)/2]
+	}
+	for _, size := range sizes {
+		d.Buckets[sort.SearchInts(islandSizeBuckets, size+1)]++
+	}
+	return d
+}
+
+// analyzeMap measures a packed map. Landmasses and lakes are labelled as the
+// generator labels them, and they and the shoreline continue across the
+// west/east seam of maps with "generator.wrap_x".
+func analyzeMap(name string, isTest bool, gm *mapformat.Map, wrapX bool) mapAnalytics {
+	a := mapAnalytics{
+		Name:               name,
+		IsTest:             isTest,
+		Width:              gm.Width,
+		Height:             gm.Height,
+		ElevationHistogram: make([]int, maxElevation+1),
+	}
+	land, water, impassable := 0, 0, 0
+	for i, t := range gm.Tiles {
+		switch {
+		case t.IsImpassable():
+			impassable++
+		case t.IsLand():
+			land++
+			a.ElevationHistogram[min(int(t.Magnitude()), maxElevation)]++
+			x, y := i%gm.Width, i/gm.Width
+			for _, n := range [4][2]int{{x - 1, y}, {x + 1, y}, {x, y - 1}, {x, y + 1}} {
+				if wrapX && gm.Width > 2 {
+					n[0] = (n[0] + gm.Width) % gm.Width
+				}
+				if gm.In(n[0], n[1]) && gm.At(n[0], n[1]).IsWater() {
+					a.ShorelineLength++
+				}
+			}
+		default:
+			water++
+		}
+	}
+	percent := func(n int) float64 { return math.Round(10000*float64(n)/float64(len(gm.Tiles))) / 100 }
+	a.LandPercent, a.WaterPercent, a.ImpassablePercent = percent(land), percent(water), percent(impassable)
+
+	landmasses, lakes := mapgen.BodySizes(gm, wrapX)
+	a.Landmasses = len(landmasses)
+	a.LandmassSizes = newSizeDistribution(landmasses)
+	if land > 0 {
+		a.LargestLandmassShare = math.Round(1000*float64(landmasses[0])/float64(land)) / 1000
+	}
+	a.Lakes = len(lakes)
+	a.LakeSizes = newSizeDistribution(lakes)
+	return a
+}
+
+// analyzeMapDir measures the map.bin of a map's output directory.
+func analyzeMapDir(name string, isTest bool, mapDir string) (mapAnalytics, error) {
+	manifest, err := mapformat.ReadManifest(mapDir)
+	if err != nil {
+		return mapAnalytics{}, err
+	}
+	gm, err := mapformat.ReadMap(mapDir, manifest, mapformat.Scale1x)
+	if err != nil {
+		return mapAnalytics{}, err
+	}
+	var generator struct {
+		WrapX bool `json:"wrap_x"`
+	}
+	if raw, ok := manifest.Fields["generator"]; ok {
+		if err := json.Unmarshal(raw, &generator); err != nil {
+			return mapAnalytics{}, fmt.Errorf("invalid generator config: %w", err)
+		}
+	}
+	return analyzeMap(name, isTest, gm, generator.WrapX), nil
+}
+
+// readMapAnalytics measures the map.bin of every map of a run, as last
+// generated, in the order of the HTML report. Maps without outputs, such as
+// maps that failed on their first build, are left out.
+func readMapAnalytics(outcomes []mapOutcome) ([]mapAnalytics, error) {
+	var maps []mapAnalytics
+	for _, o := range outcomes {
+		dir, err := outputMapDir(o.Entry.IsTest)
+		if err != nil {
+			return nil, err
+		}
+		a, err := analyzeMapDir(o.Entry.Name, o.Entry.IsTest, filepath.Join(dir, o.Entry.Name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("map %s: %w", o.Entry.Name, err)
+		}
+		maps = append(maps, a)
+	}
+	sort.Slice(maps, func(i, j int) bool {
+		if maps[i].IsTest != maps[j].IsTest {
+			return !maps[i].IsTest
+		}
+		return maps[i].Name < maps[j].Name
+	})
+	return maps, nil
+}
+
+// writeMapAnalytics writes the analytics of a processed map to the
+// analytics.json next to its manifest with --analytics, and otherwise
+// removes any left by an earlier run.
+func writeMapAnalytics(m mapEntry) error {
+	outDir, err := outputMapDir(m.IsTest)
+	if err != nil {
+		return err
+	}
+	mapDir := filepath.Join(outDir, m.Name)
+	path := filepath.Join(mapDir, mapAnalyticsFile)
+	if !analyticsFlag {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove stale analytics for %s: %w", m.Name, err)
+		}
+		return nil
+	}
+	a, err := analyzeMapDir(m.Name, m.IsTest, mapDir)
+	if err != nil {
+		return fmt.Errorf("failed to measure %s: %w", m.Name, err)
+	}
+	data, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write analytics for %s: %w", m.Name, err)
+	}
+	return nil
+}
+
+// writeAnalyticsJSON writes the analytics of every map of a run as a JSON
+// array.
+func writeAnalyticsJSON(path string, outcomes []mapOutcome) error {
+	maps, err := readMapAnalytics(outcomes)
+	if err != nil {
+		return err
+	}
+	if maps == nil {
+		maps = []mapAnalytics{}
+	}
+	data, err := json.MarshalIndent(maps, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// writeAnalyticsCSV writes the analytics of every map of a run as a CSV
+// table, one row per map, for spreadsheets.
+func writeAnalyticsCSV(path string, outcomes []mapOutcome) error {
+	maps, err := readMapAnalytics(outcomes)
+	if err != nil {
+		return err
+	}
+	header := []string{"map", "test", "width", "height", "land_percent", "water_percent", "impassable_percent",
+		"landmasses", "largest_landmass_share", "largest_landmass", "median_landmass",
+		"landmasses_under_1k", "landmasses_1k_10k", "landmasses_10k_100k", "landmasses_100k_plus",
+		"lakes", "largest_lake", "median_lake", "lakes_under_1k", "lakes_1k_10k", "lakes_10k_100k", "lakes_100k_plus",
+		"shoreline_length"}
+	for m := 0; m <= maxElevation; m++ {
+		header = append(header, fmt.Sprintf("elevation_%d", m))
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(header); err != nil {
+		return err
+	}
+	itoa := strconv.Itoa
+	ftoa := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	for _, a := range maps {
+		row := []string{a.Name, strconv.FormatBool(a.IsTest), itoa(a.Width), itoa(a.Height),
+			ftoa(a.LandPercent), ftoa(a.WaterPercent), ftoa(a.ImpassablePercent),
+			itoa(a.Landmasses), ftoa(a.LargestLandmassShare), itoa(a.LandmassSizes.Largest), itoa(a.LandmassSizes.Median)}
+		for _, n := range a.LandmassSizes.Buckets {
+			row = append(row, itoa(n))
+		}
+		row = append(row, itoa(a.Lakes), itoa(a.LakeSizes.Largest), itoa(a.LakeSizes.Median))
+		for _, n := range a.LakeSizes.Buckets {
+			row = append(row, itoa(n))
+		}
+		row = append(row, itoa(a.ShorelineLength))
+		for _, n := range a.ElevationHistogram {
+			row = append(row, itoa(n))
+		}
+		if err := w.Write(row); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+// annotateDirFlag is the directory annotated images of maps with problems
+// are written to, or "" for none. Authors rarely find the pixels a text
+// warning is about, so each image is the faded source image with every
+// problem area circled in the colour of its kind, see problemColors, and
+// numbered after its line of the legend. Failed maps are annotated too.
+var annotateDirFlag string
+
+// problemColors are the circle colours of the problem kinds.
+var problemColors = map[string]color.NRGBA{
+	mapgen.ProblemSmallIsland:     {255, 140, 0, 255},
+	mapgen.ProblemSmallLake:       {0, 200, 255, 255},
+	mapgen.ProblemAmbiguousCoast:  {255, 0, 255, 255},
+	mapgen.ProblemUnreachableLand: {255, 0, 0, 255},
+	mapgen.ProblemNationSpawn:     {255, 230, 0, 255},
+}
+
+// warnStrictProblems logs the unreachable land and nation spawn problems as
+// warnings, which fail the map under --strict. Small islands and lakes are
+// removed from most maps by design, and ambiguous coast pixels warn on their
+// own.
+func warnStrictProblems(ctx context.Context, r *mapgen.ProblemRecorder) {
+	logger := mapgen.LoggerFromContext(ctx)
+	unreachable := 0
+	var first mapgen.MapProblem
+	for _, p := range r.Problems {
+		switch p.Kind {
+		case mapgen.ProblemNationSpawn:
+			logger.Warn(strings.ToUpper(p.Message[:1]) + p.Message[1:])
+		case mapgen.ProblemUnreachableLand:
+			if unreachable == 0 {
+				first = p
+			}
+			unreachable++
+		}
+	}
+	if unreachable > 0 {
+		logger.Warn(fmt.Sprintf("%d landmass(es) border no water, so they cannot be reached from the rest of the map, the first around %d,%d", unreachable, (first.Box.Min.X+first.Box.Max.X)/2, (first.Box.Min.Y+first.Box.Max.Y)/2))
+	}
+}
+
+// problemLabel is a human name of a problem kind.
+func problemLabel(kind string) string {
+	return strings.ReplaceAll(kind, "_", " ")
+}
+
+// problemGroup is the problems of one kind close to each other, circled
+// once.
+type problemGroup struct {
+	Kind     string
+	Box      image.Rectangle
+	Problems []mapgen.MapProblem
+}
+
+// problemGroupCells is how many cells the shorter side of a map is split
+// into to group problems: speckled images lose hundreds of one-tile islands,
+// which would be illegible circled one by one.
+const problemGroupCells = 10
+
+// groupProblems groups the problems of a width×height map by kind and by
+// the grid cell their centre falls in, in the order they were recorded.
+func groupProblems(problems []mapgen.MapProblem, width, height int) []problemGroup {
+	cell := max(1, min(width, height)/problemGroupCells)
+	type key struct {
+		Kind string
+		Cell image.Point
+	}
+	index := make(map[key]int)
+	var groups []problemGroup
+	for _, p := range problems {
+		centre := p.Box.Min.Add(p.Box.Max).Div(2)
+		k := key{p.Kind, centre.Div(cell)}
+		i, ok := index[k]
+		if !ok {
+			i = len(groups)
+			index[k] = i
+			groups = append(groups, problemGroup{Kind: p.Kind, Box: p.Box})
+		}
+		groups[i].Box = groups[i].Box.Union(p.Box)
+		groups[i].Problems = append(groups[i].Problems, p)
+	}
+	return groups
+}
+
+// annotateProblems draws the problem groups over a copy of img: a circle in
+// the colour of its kind around each, numbered in the order of groups,
+// which is the order of the legend written by writeProblemAnnotations.
+func annotateProblems(img image.Image, groups []problemGroup) *image.NRGBA {
+	b := img.Bounds()
+	out := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(out, out.Bounds(), img, b.Min, draw.Src)
+	// Fade the image so that the circles stand out.
+	for i := 0; i < len(out.Pix); i += 4 {
+		for c := 0; c < 3; c++ {
+			out.Pix[i+c] = uint8((int(out.Pix[i+c]) + 2*128) / 3)
+		}
+		out.Pix[i+3] = 255
+	}
+	scale := max(1, min(b.Dx(), b.Dy())/400)
+	for i, p := range groups {
+		col := problemColors[p.Kind]
+		cx, cy := float64(p.Box.Min.X+p.Box.Max.X)/2, float64(p.Box.Min.Y+p.Box.Max.Y)/2
+		radius := math.Hypot(float64(p.Box.Dx()), float64(p.Box.Dy()))/2 + float64(4*scale)
+		drawCircle(out, cx, cy, radius, float64(scale), col)
+		drawDigits(out, fmt.Sprint(i+1), int(cx+radius*0.71)+scale, int(cy-radius*0.71)-6*scale, scale, col)
+	}
+	return out
+}
+
+// drawCircle draws a ring of the given thickness.
+func drawCircle(img *image.NRGBA, cx, cy, radius, thickness float64, col color.NRGBA) {
+	r := radius + thickness
+	for y := int(cy - r); y <= int(cy+r); y++ {
+		for x := int(cx - r); x <= int(cx+r); x++ {
+			d := math.Hypot(float64(x)+0.5-cx, float64(y)+0.5-cy)
+			if math.Abs(d-radius) <= thickness && image.Pt(x, y).In(img.Rect) {
+				img.SetNRGBA(x, y, col)
+			}
+		}
+	}
+}
+
+// digitGlyphs are 3×5 bitmaps of the digits, one row of 3 bits per entry.
+var digitGlyphs = [10][5]uint8{
+	{7, 5, 5, 5, 7}, {2, 6, 2, 2, 7}, {7, 1, 7, 4, 7}, {7, 1, 7, 1, 7}, {5, 5, 7, 1, 1},
+	{7, 4, 7, 1, 7}, {7, 4, 7, 5, 7}, {7, 1, 1, 1, 1}, {7, 5, 7, 5, 7}, {7, 5, 7, 1, 7},
+}
+
+// drawDigits draws a number with its top left corner at x, y, each glyph
+// pixel scale pixels wide, on a black backing for legibility.
+func drawDigits(img *image.NRGBA, digits string, x, y, scale int, col color.NRGBA) {
+	backing := image.Rect(x-scale, y-scale, x+(4*len(digits))*scale, y+6*scale)
+	draw.Draw(img, backing.Intersect(img.Rect), image.NewUniform(color.Black), image.Point{}, draw.Src)
+	for i, d := range digits {
+		glyph := digitGlyphs[d-'0']
+		for row := 0; row < 5; row++ {
+			for column := 0; column < 3; column++ {
+				if glyph[row]>>(2-column)&1 == 0 {
+					continue
+				}
+				px := image.Rect(x+(4*i+column)*scale, y+row*scale, x+(4*i+column+1)*scale, y+(row+1)*scale)
+				draw.Draw(img, px.Intersect(img.Rect), image.NewUniform(col), image.Point{}, draw.Src)
+			}
+		}
+	}
+}
+
+// problemLegend lists every problem under the number of its group.
+func problemLegend(name string, groups []problemGroup) string {
+	var sb strings.Builder
+	n := 0
+	for _, g := range groups {
+		n += len(g.Problems)
+	}
+	fmt.Fprintf(&sb, "%s: %d problem(s) in %d area(s)\n", name, n, len(groups))
+	for i, g := range groups {
+		fmt.Fprintf(&sb, "%d. %s, %d at %d,%d (%dx%d)\n", i+1, problemLabel(g.Kind), len(g.Problems), g.Box.Min.X, g.Box.Min.Y, g.Box.Dx(), g.Box.Dy())
+		for _, p := range g.Problems {
+			fmt.Fprintf(&sb, "   %d,%d (%dx%d): %s\n", p.Box.Min.X, p.Box.Min.Y, p.Box.Dx(), p.Box.Dy(), p.Message)
+		}
+	}
+	return sb.String()
+}
+
+// encodeProblemAnnotations returns the annotated image of a map's problems
+// as a PNG, with the legend of its numbers.
+func encodeProblemAnnotations(name string, r *mapgen.ProblemRecorder) (annotated []byte, legend string, err error) {
+	b := r.Image.Bounds()
+	groups := groupProblems(r.Problems, b.Dx(), b.Dy())
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, annotateProblems(r.Image, groups)); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), problemLegend(name, groups), nil
+}
+
+// writeProblemAnnotations writes the annotated image and legend of a map's
+// problems to <name>.png and <name>.txt in --annotate-dir, or removes those
+// of an earlier run if the map has no problems any more. Maps that failed
+// before their image was read have nothing to annotate.
+func writeProblemAnnotations(ctx context.Context, name string, r *mapgen.ProblemRecorder) error {
+	pngPath := filepath.Join(annotateDirFlag, name+".png")
+	txtPath := filepath.Join(annotateDirFlag, name+".txt")
+	if r.Image == nil || len(r.Problems) == 0 {
+		for _, path := range []string{pngPath, txtPath} {
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := os.MkdirAll(annotateDirFlag, 0755); err != nil {
+		return err
+	}
+	data, legend, err := encodeProblemAnnotations(name, r)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(pngPath, data, 0644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(txtPath, []byte(legend), 0644); err != nil {
+		return err
+	}
+	mapgen.LoggerFromContext(ctx).Info(fmt.Sprintf("%d problem(s) annotated in %s, listed in %s", len(r.Problems), pngPath, txtPath))
+	return nil
+}
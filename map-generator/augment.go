@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapformat"
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+// augmentOrientations are the eight rotations and mirrors of a square, each
+// exported by the augment command. The 90° and 270° rotations are skipped
+// for maps that wrap horizontally.
+var augmentOrientations = []mapgen.MapTransform{
+	{Rotate: 0}, {Rotate: 90}, {Rotate: 180}, {Rotate: 270},
+	{Rotate: 0, Flip: "h"}, {Rotate: 90, Flip: "h"}, {Rotate: 180, Flip: "h"}, {Rotate: 270, Flip: "h"},
+}
+
+// maxCropAttempts is how many crop windows are drawn for a crop before
+// giving up on one showing both land and water.
+const maxCropAttempts = 16
+
+// augmentCrop is a window of a transformed map, in its coordinates.
+type augmentCrop struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// augmentProvenance records where an augmented variant comes from, so that
+// a sample can be traced back to its map and regenerated.
+type augmentProvenance struct {
+	Map              string       `json:"map"`
+	MapSHA256        string       `json:"map_sha256"` // of the source map.bin
+	GeneratorVersion int          `json:"generator_version"`
+	Rotate           int          `json:"rotate"`
+	Flip             string       `json:"flip,omitempty"`
+	Crop             *augmentCrop `json:"crop,omitempty"`
+	Seed             string       `json:"seed,omitempty"` // of the crop window
+}
+
+// augmentManifest is the manifest.json of an augmented variant.
+type augmentManifest struct {
+	ID            string            `json:"id"`
+	Source        augmentProvenance `json:"source"`
+	Map           manifestScale     `json:"map"`
+	Tensor        tensorManifest    `json:"tensor"`
+	SchemaVersion int               `json:"schema_version"`
+	Checksums     map[string]string `json:"checksums"`
+}
+
+// transformTiles rotates and mirrors a packed width×height map. Tile bits
+// are kept as they are: shorelines and oceans do not depend on orientation.
+func transformTiles(tiles []byte, width, height int, t mapgen.MapTransform) (out []byte, w, h int) {
+	w, h = t.Size(width, height)
+	out = make([]byte, len(tiles))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			tx, ty := t.Point(x, y, width, height)
+			out[ty*w+tx] = tiles[y*width+x]
+		}
+	}
+	return out, w, h
+}
+
+// cropTiles returns the tiles of a packed map inside the crop window.
+func cropTiles(tiles []byte, width int, c augmentCrop) []byte {
+	out := make([]byte, 0, c.Width*c.Height)
+	for y := c.Y; y < c.Y+c.Height; y++ {
+		out = append(out, tiles[y*width+c.X:y*width+c.X+c.Width]...)
+	}
+	return out
+}
+
+// drawAugmentCrop draws crop i of a transformed width×height map, with
+// sides from size rounded to multiples of 4 and no larger than the map. The
+// window is redrawn until it shows both land and water, since all-water and
+// all-land samples teach nothing; ok is false when no window does.
+func drawAugmentCrop(tiles []byte, width, height int, size valueRange, seed string, i int) (c augmentCrop, ok bool) {
+	s := mapgen.NoiseSeed("augment:" + seed)
+	for attempt := 0; attempt < maxCropAttempts; attempt++ {
+		k := 4 * attempt
+		side := func(k, limit int) int {
+			return min(max(16, int(size.at(randomUnit(s, i, k))/4)*4), limit/4*4)
+		}
+		c.Width, c.Height = side(k, width), side(k+1, height)
+		c.X = int(randomUnit(s, i, k+2) * float64(width-c.Width+1))
+		c.Y = int(randomUnit(s, i, k+3) * float64(height-c.Height+1))
+		var land, water bool
+		for y := c.Y; y < c.Y+c.Height && !(land && water); y++ {
+			for _, b := range tiles[y*width+c.X : y*width+c.X+c.Width] {
+				t := mapformat.Tile(b)
+				land = land || t.IsLand()
+				water = water || t.IsWater()
+			}
+		}
+		if land && water {
+			return c, true
+		}
+	}
+	return c, false
+}
+
+// augmentSuffix names a variant after its orientation and crop.
+func augmentSuffix(t mapgen.MapTransform, crop int) string {
+	suffix := fmt.Sprintf("r%d%s", t.Rotate, t.Flip)
+	if crop >= 0 {
+		suffix += fmt.Sprintf("-c%d", crop)
+	}
+	return suffix
+}
+
+// runAugment implements the augment command: it exports every rotation and
+// mirror of generated maps, and random crops of each, in the tensor format
+// of random-maps, multiplying the training data of learned bots without any
+// manual map work.
+func runAugment(args []string) error {
+	fset, logFlags := newCommandFlagSet("augment")
+	defaultDir, err := outputMapDir(false)
+	if err != nil {
+		return err
+	}
+	dir := fset.String("dir", defaultDir, "directory holding the generated maps")
+	mapsFlag := fset.String("maps", "", "comma-separated maps to augment (default: every map in -dir)")
+	outDir := fset.String("out", "augmented", "directory to write the variants and variants.jsonl to")
+	crops := fset.Int("crops", 2, "random crops exported per orientation of each map, besides the full map")
+	cropSizeFlag := fset.String("crop-size", "64-256", "width and height of crops in tiles, as MIN-MAX or a single value, rounded to multiples of 4 and limited to the map")
+	seed := fset.String("seed", "augment", "seed of the crop windows; the same seed always gives the same crops")
+	fset.Parse(args)
+	setupLogging(*logFlags)
+	logger := slog.Default()
+
+	cropSize, err := parseValueRange("crop-size", *cropSizeFlag)
+	if err != nil {
+		return err
+	}
+	if cropSize.Min < 16 {
+		return fmt.Errorf("-crop-size (%q) must be at least 16", *cropSizeFlag)
+	}
+	if *crops < 0 {
+		return fmt.Errorf("-crops (%d) must not be negative", *crops)
+	}
+	var names []string
+	if *mapsFlag != "" {
+		names = strings.Split(*mapsFlag, ",")
+	} else {
+		entries, err := os.ReadDir(*dir)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", *dir, err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				names = append(names, entry.Name())
+			}
+		}
+	}
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		return err
+	}
+	index, err := os.Create(filepath.Join(*outDir, "variants.jsonl"))
+	if err != nil {
+		return err
+	}
+	defer index.Close()
+	indexWriter := bufio.NewWriter(index)
+
+	variants := 0
+	for _, name := range names {
+		mapDir := filepath.Join(*dir, name)
+		manifest, err := mapformat.ReadManifest(mapDir)
+		if errors.Is(err, os.ErrNotExist) && *mapsFlag == "" {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("map %s: %w", name, err)
+		}
+		gm, err := mapformat.ReadMap(mapDir, manifest, mapformat.Scale1x)
+		if err != nil {
+			return fmt.Errorf("map %s: %w", name, err)
+		}
+		var generator struct {
+			WrapX bool `json:"wrap_x"`
+		}
+		if raw, ok := manifest.Fields["generator"]; ok {
+			if err := json.Unmarshal(raw, &generator); err != nil {
+				return fmt.Errorf("map %s: invalid generator config: %w", name, err)
+			}
+		}
+		tiles := make([]byte, len(gm.Tiles))
+		for i, t := range gm.Tiles {
+			tiles[i] = byte(t)
+		}
+		source := augmentProvenance{
+			Map:              name,
+			MapSHA256:        sha256Hex(tiles),
+			GeneratorVersion: manifest.GeneratorVersion,
+		}
+
+		for _, t := range augmentOrientations {
+			if generator.WrapX && (t.Rotate == 90 || t.Rotate == 270) {
+				continue
+			}
+			oriented, w, h := transformTiles(tiles, gm.Width, gm.Height, t)
+			for crop := -1; crop < *crops; crop++ {
+				p := source
+				p.Rotate, p.Flip = t.Rotate, t.Flip
+				data, cw, ch := oriented, w, h
+				if crop >= 0 {
+					c, ok := drawAugmentCrop(oriented, w, h, cropSize, *seed+":"+name+":"+augmentSuffix(t, -1), crop)
+					if !ok {
+						logger.Debug(fmt.Sprintf("%s: no crop %d of %s shows both land and water", name, crop, augmentSuffix(t, -1)))
+						continue
+					}
+					p.Crop, p.Seed = &c, *seed
+					data, cw, ch = cropTiles(oriented, w, c), c.Width, c.Height
+				}
+				id := name + "-" + augmentSuffix(t, crop)
+				if err := writeAugmentVariant(filepath.Join(*outDir, id), id, p, data, cw, ch); err != nil {
+					return fmt.Errorf("variant %s: %w", id, err)
+				}
+				line, err := json.Marshal(struct {
+					ID     string            `json:"id"`
+					Source augmentProvenance `json:"source"`
+				}{id, p})
+				if err != nil {
+					return err
+				}
+				indexWriter.Write(append(line, '\n'))
+				variants++
+			}
+		}
+	}
+	logger.Info(fmt.Sprintf("Exported %d variants of %d maps to %s", variants, len(names), *outDir))
+	if err := indexWriter.Flush(); err != nil {
+		return err
+	}
+	return index.Close()
+}
+
+// writeAugmentVariant writes the terrain tensor and manifest of a variant
+// to variantDir.
+func writeAugmentVariant(variantDir, id string, p augmentProvenance, tiles []byte, width, height int) error {
+	if err := os.MkdirAll(variantDir, 0755); err != nil {
+		return err
+	}
+	landTiles := 0
+	for _, b := range tiles {
+		if mapformat.Tile(b).IsLand() {
+			landTiles++
+		}
+	}
+	manifest := augmentManifest{
+		ID:            id,
+		Source:        p,
+		Map:           manifestScale{Width: width, Height: height, NumLandTiles: landTiles},
+		Tensor:        newTensorManifest(width, height),
+		SchemaVersion: schemaVersion,
+	}
+	tensor := encodeNpy(terrainTensor(tiles, width, height, mapformat.LatestTileFormat), manifest.Tensor.Shape...)
+	if err := os.WriteFile(filepath.Join(variantDir, terrainTensorFile), tensor, 0644); err != nil {
+		return err
+	}
+	manifest.Checksums = map[string]string{terrainTensorFile: sha256Hex(tensor)}
+	buf, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(variantDir, "manifest.json"), append(buf, '\n'), 0644)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+// readAuxInputs reads the auxiliary input files present in mapInputDir,
+// keyed by file name.
+func readAuxInputs(mapInputDir string) (map[string][]byte, error) {
+	inputs := make(map[string][]byte)
+	for _, name := range mapgen.AuxInputFiles {
+		data, err := os.ReadFile(filepath.Join(mapInputDir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		inputs[name] = data
+	}
+	return inputs, nil
+}
+
+// auxInputHashParts returns the sourceHash parts for the auxiliary inputs:
+// the name and contents of each present file, in mapgen.AuxInputFiles order. Maps
+// without auxiliary inputs contribute nothing, so their hash only covers
+// image.png and info.json.
+func auxInputHashParts(inputs map[string][]byte) [][]byte {
+	var parts [][]byte
+	for _, name := range mapgen.AuxInputFiles {
+		if data, ok := inputs[name]; ok {
+			parts = append(parts, []byte(name), data)
+		}
+	}
+	return parts
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+// defaultBordersURL is the Natural Earth 1:50m admin 0 (countries) dataset
+// in GeoJSON.
+const defaultBordersURL = "https://raw.githubusercontent.com/nvkelso/natural-earth-vector/master/geojson/ne_50m_admin_0_countries.geojson"
+
+// maxBordersDownloadSize bounds the border datasets import-borders downloads.
+const maxBordersDownloadSize = 512 << 20
+
+// runImportBorders downloads a border dataset, keeps the features around a
+// map and writes them to the map's borders.geojson for the territories
+// layer. The map's info.json needs a "geo" section.
+func runImportBorders(args []string) error {
+	fset, logFlags := newCommandFlagSet("import-borders")
+	name := fset.String("map", "", "map folder to import borders for")
+	source := fset.String("source", defaultBordersURL, "GeoJSON FeatureCollection of country or region polygons, as an http(s) URL or a local path")
+	nameProperty := fset.String("name-property", "NAME", "feature property holding the territory name; Natural Earth admin 1 datasets use \"name\"")
+	codeProperty := fset.String("code-property", "ISO_A3", "feature property holding the territory code, or empty for none; Natural Earth admin 1 datasets use \"iso_3166_2\"")
+	force := fset.Bool("force", false, "overwrite an existing borders.geojson")
+	fset.Parse(args)
+	setupLogging(*logFlags)
+	logger := mapgen.LoggerFromContext(context.Background())
+	if *name == "" {
+		return fmt.Errorf("-map is required")
+	}
+
+	mapDir, geo, err := geoMapDir(*name)
+	if err != nil {
+		return err
+	}
+	outPath := filepath.Join(mapDir, "borders.geojson")
+	if _, err := os.Stat(outPath); err == nil && !*force {
+		return fmt.Errorf("%s already exists, use -force to overwrite it", outPath)
+	}
+
+	var sourceBuffer []byte
+	if strings.HasPrefix(*source, "http://") || strings.HasPrefix(*source, "https://") {
+		logger.Info(fmt.Sprintf("Downloading %s", *source))
+		var buf bytes.Buffer
+		if _, err := fetchRemote(context.Background(), *source, &buf, maxBordersDownloadSize, 10*time.Minute); err != nil {
+			if errors.Is(err, errRemoteNotFound) {
+				return fmt.Errorf("%s was not found", *source)
+			}
+			return err
+		}
+		sourceBuffer = buf.Bytes()
+	} else if sourceBuffer, err = os.ReadFile(*source); err != nil {
+		return err
+	}
+
+	var doc struct {
+		Type     string `json:"type"`
+		Features []struct {
+			Properties map[string]any  `json:"properties"`
+			Geometry   json.RawMessage `json:"geometry"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal(sourceBuffer, &doc); err != nil {
+		return fmt.Errorf("invalid %s: %w", *source, err)
+	}
+	if doc.Type != "FeatureCollection" {
+		return fmt.Errorf("%s is not a GeoJSON FeatureCollection", *source)
+	}
+
+	// Keep the polygons whose bounding box overlaps the map's, one feature
+	// per line so that updates diff well.
+	var out bytes.Buffer
+	out.WriteString("{\"type\":\"FeatureCollection\",\"features\":[")
+	kept := 0
+	for _, f := range doc.Features {
+		var feature mapgen.BorderFeature
+		if err := json.Unmarshal(f.Geometry, &feature.Geometry); err != nil || f.Geometry == nil {
+			continue
+		}
+		polygons, err := feature.Polygons()
+		if err != nil {
+			return fmt.Errorf("invalid geometry in %s: %w", *source, err)
+		}
+		var overlapping [][][][2]float64
+		for _, polygon := range polygons {
+			if len(polygon) > 0 && ringOverlaps(polygon[0], geo.BBox) {
+				overlapping = append(overlapping, polygon)
+			}
+		}
+		if len(overlapping) == 0 {
+			continue
+		}
+		property := func(key string) string {
+			if key == "" || f.Properties[key] == nil {
+				return ""
+			}
+			return fmt.Sprint(f.Properties[key])
+		}
+		line, err := json.Marshal(map[string]any{
+			"type":       "Feature",
+			"properties": map[string]string{"name": property(*nameProperty), "code": property(*codeProperty)},
+			"geometry":   map[string]any{"type": "MultiPolygon", "coordinates": overlapping},
+		})
+		if err != nil {
+			return err
+		}
+		if kept > 0 {
+			out.WriteByte(',')
+		}
+		out.WriteString("\n")
+		out.Write(line)
+		kept++
+	}
+	out.WriteString("\n]}\n")
+	if kept == 0 {
+		return fmt.Errorf("no feature of %s overlaps the map's bounding box", *source)
+	}
+	if err := os.WriteFile(outPath, out.Bytes(), 0644); err != nil {
+		return err
+	}
+	logger.Info(fmt.Sprintf("Wrote %d territories to %s; build them with --layers=territories", kept, outPath))
+	return nil
+}
+
+// ringOverlaps reports whether the bounding box of a ring of [lon, lat]
+// points overlaps bbox.
+func ringOverlaps(ring [][2]float64, bbox [4]float64) bool {
+	minLon, minLat := math.Inf(1), math.Inf(1)
+	maxLon, maxLat := math.Inf(-1), math.Inf(-1)
+	for _, p := range ring {
+		minLon, maxLon = math.Min(minLon, p[0]), math.Max(maxLon, p[0])
+		minLat, maxLat = math.Min(minLat, p[1]), math.Max(maxLat, p[1])
+	}
+	return minLon <= bbox[2] && maxLon >= bbox[0] && minLat <= bbox[3] && maxLat >= bbox[1]
+}
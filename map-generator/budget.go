@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+// downloadBudgetFlag is the default download budget of every map, in KiB,
+// or 0 for none. "generator.download_budget_kib" overrides it per map.
+var downloadBudgetFlag int
+
+// enforceDownloadBudgetFlag fails maps over their download budget instead of
+// warning about them.
+var enforceDownloadBudgetFlag bool
+
+// clientDownloadFiles are the files a player downloads to play a map.
+// Layers are left out: they are opt-in and mostly for the server.
+var clientDownloadFiles = []string{"manifest.json", "map.bin", "map4x.bin", "map16x.bin", "thumbnail.webp"}
+
+// maxDownloadSuggestions is how many of the options that bring a map under
+// its download budget are suggested, smallest first.
+const maxDownloadSuggestions = 3
+
+// downloadOption is a way of serving a map's client files, with the total
+// size a player downloads with it.
+type downloadOption struct {
+	Name string
+	Size int
+}
+
+// checkDownloadBudget compares what a player downloads for a processed map
+// with its download budget, so that maps too heavy for mobile players are
+// noticed before release. The download is the clientDownloadFiles as
+// written, or their Brotli copies with --precompress. A map over budget is
+// reported with the encodings and compressions that would bring it under,
+// as a warning, or as an error with --enforce-download-budget.
+func checkDownloadBudget(ctx context.Context, m mapEntry) error {
+	outDir, err := outputMapDir(m.IsTest)
+	if err != nil {
+		return err
+	}
+	mapDir := filepath.Join(outDir, m.Name)
+	files := make(map[string][]byte, len(clientDownloadFiles))
+	for _, name := range clientDownloadFiles {
+		if files[name], err = os.ReadFile(filepath.Join(mapDir, name)); err != nil {
+			return err
+		}
+	}
+	var manifest struct {
+		Generator struct {
+			DownloadBudgetKiB int `json:"download_budget_kib"`
+		} `json:"generator"`
+	}
+	if err := json.Unmarshal(files["manifest.json"], &manifest); err != nil {
+		return fmt.Errorf("invalid manifest for %s: %w", m.Name, err)
+	}
+	budget := downloadBudgetFlag
+	if manifest.Generator.DownloadBudgetKiB > 0 {
+		budget = manifest.Generator.DownloadBudgetKiB
+	}
+	if budget == 0 {
+		return nil
+	}
+
+	served := "as written"
+	size, parts := 0, make([]string, 0, len(clientDownloadFiles))
+	for _, name := range clientDownloadFiles {
+		n := len(files[name])
+		if precompressFlag && filepath.Ext(name) != ".webp" {
+			info, err := os.Stat(filepath.Join(mapDir, name+".br"))
+			if err != nil {
+				return err
+			}
+			n, served = int(info.Size()), "with Brotli"
+		}
+		size += n
+		parts = append(parts, fmt.Sprintf("%s %s", name, formatBytes(uint64(n))))
+	}
+	if size <= budget*1024 {
+		mapgen.LoggerFromContext(ctx).Debug(fmt.Sprintf("Download size %s %s, within the budget of %s", formatBytes(uint64(size)), served, formatBytes(uint64(budget*1024))))
+		return nil
+	}
+
+	options, err := downloadOptions(files)
+	if err != nil {
+		return fmt.Errorf("failed to size download options for %s: %w", m.Name, err)
+	}
+	var suggestion string
+	var fitting []string
+	for _, o := range options {
+		if o.Size <= budget*1024 && o.Size < size && len(fitting) < maxDownloadSuggestions {
+			fitting = append(fitting, fmt.Sprintf("%s (%s)", o.Name, formatBytes(uint64(o.Size))))
+		}
+	}
+	if len(fitting) > 0 {
+		suggestion = "it fits with " + strings.Join(fitting, " or ")
+	} else {
+		best := options[0]
+		suggestion = fmt.Sprintf("no encoding or compression brings it under, the smallest download being %s (%s): reduce the map's size", best.Name, formatBytes(uint64(best.Size)))
+	}
+	msg := fmt.Sprintf("download size %s %s (%s) exceeds the budget of %s; %s", formatBytes(uint64(size)), served, strings.Join(parts, ", "), formatBytes(uint64(budget*1024)), suggestion)
+	if enforceDownloadBudgetFlag {
+		return fmt.Errorf("%s: %s", m.Name, msg)
+	}
+	mapgen.LoggerFromContext(ctx).Warn(strings.ToUpper(msg[:1]) + msg[1:])
+	return nil
+}
+
+// downloadOptions returns the download size of the client files with every
+// terrain encoding of the packed maps and with every Content-Encoding of
+// --precompress, smallest first.
+func downloadOptions(files map[string][]byte) ([]downloadOption, error) {
+	var options []downloadOption
+	for _, e := range mapgen.TerrainEncodings {
+		if e.Name == mapgen.EncodingRaw {
+			continue
+		}
+		size := 0
+		for _, name := range clientDownloadFiles {
+			data := files[name]
+			if filepath.Ext(name) == ".bin" {
+				encoded, err := e.Encode(data)
+				if err != nil {
+					return nil, err
+				}
+				data = encoded
+			}
+			size += len(data)
+		}
+		options = append(options, downloadOption{Name: "generator.encoding=" + e.Name, Size: size})
+	}
+	for _, c := range []struct {
+		Name   string
+		Encode func([]byte) ([]byte, error)
+	}{
+		{"--precompress with gzip", mapgen.EncodeGzip},
+		{"--precompress with Brotli", encodeBrotli},
+	} {
+		size := 0
+		for _, name := range clientDownloadFiles {
+			data := files[name]
+			if filepath.Ext(name) != ".webp" {
+				compressed, err := c.Encode(data)
+				if err != nil {
+					return nil, err
+				}
+				data = compressed
+			}
+			size += len(data)
+		}
+		options = append(options, downloadOption{Name: c.Name, Size: size})
+	}
+	sort.SliceStable(options, func(i, j int) bool { return options[i].Size < options[j].Size })
+	return options, nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapformat"
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+// bundleFlag is the section compression of the map.bundle file written next
+// to every map's outputs, one of bundleCompressions, or "" for none.
+var bundleFlag string
+
+// bundleFile is the combined binary of a map's outputs.
+const bundleFile = "map.bundle"
+
+// bundleCompressions are the section compressions by --bundle name.
+var bundleCompressions = map[string]uint32{
+	"gzip": mapgen.CompressionGzip,
+	"zstd": mapgen.CompressionZstd,
+}
+
+// readMapBundle collects the files of a map directory that go into its
+// bundle, with the navigation layer when the manifest lists it.
+func readMapBundle(mapDir string) (*mapgen.MapBundle, error) {
+	b := &mapgen.MapBundle{}
+	for _, f := range []struct {
+		Name string
+		Data *[]byte
+	}{
+		{"manifest.json", &b.Manifest},
+		{mapformat.Scale1x.File(), &b.Map},
+		{mapformat.Scale4x.File(), &b.Map4x},
+		{mapformat.Scale16x.File(), &b.Map16x},
+		{"thumbnail.webp", &b.Thumbnail},
+	} {
+		data, err := os.ReadFile(filepath.Join(mapDir, f.Name))
+		if err != nil {
+			return nil, err
+		}
+		*f.Data = data
+	}
+	var manifest struct {
+		Layers map[string]struct {
+			File string `json:"file"`
+		} `json:"layers"`
+	}
+	if err := json.Unmarshal(b.Manifest, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if layer, ok := manifest.Layers["navigation"]; ok {
+		data, err := os.ReadFile(filepath.Join(mapDir, layer.File))
+		if err != nil {
+			return nil, err
+		}
+		b.Navigation = data
+	}
+	return b, nil
+}
+
+// writeMapBundle writes the bundle of a processed map with --bundle, and
+// otherwise removes any bundle left by an earlier run.
+func writeMapBundle(ctx context.Context, m mapEntry) error {
+	outDir, err := outputMapDir(m.IsTest)
+	if err != nil {
+		return err
+	}
+	mapDir := filepath.Join(outDir, m.Name)
+	path := filepath.Join(mapDir, bundleFile)
+	if bundleFlag == "" {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove stale %s for %s: %w", bundleFile, m.Name, err)
+		}
+		return nil
+	}
+	b, err := readMapBundle(mapDir)
+	if err != nil {
+		return fmt.Errorf("failed to read outputs of %s for its bundle: %w", m.Name, err)
+	}
+	data, err := mapgen.CreateCombinedBinary(b, bundleCompressions[bundleFlag])
+	if err != nil {
+		return fmt.Errorf("failed to bundle %s: %w", m.Name, err)
+	}
+	// Read the bundle back before declaring success.
+	_, decoded, err := mapgen.DecodeCombinedBinary(data)
+	if err != nil {
+		return fmt.Errorf("%s of %s does not read back: %w", bundleFile, m.Name, err)
+	}
+	if !bundlesEqual(decoded, b) {
+		return fmt.Errorf("%s of %s does not read back", bundleFile, m.Name)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s for %s: %w", bundleFile, m.Name, err)
+	}
+	separate := len(b.Manifest) + len(b.Map) + len(b.Map4x) + len(b.Map16x) + len(b.Thumbnail) + len(b.Navigation)
+	mapgen.LoggerFromContext(ctx).Debug(fmt.Sprintf("Bundled %s: %d bytes, %.1f%% of the separate files", m.Name, len(data), 100*float64(len(data))/float64(separate)))
+	return nil
+}
+
+// bundlesEqual reports whether two bundles have the same contents.
+func bundlesEqual(a, b *mapgen.MapBundle) bool {
+	return bytes.Equal(a.Manifest, b.Manifest) &&
+		bytes.Equal(a.Map, b.Map) &&
+		bytes.Equal(a.Map4x, b.Map4x) &&
+		bytes.Equal(a.Map16x, b.Map16x) &&
+		bytes.Equal(a.Thumbnail, b.Thumbnail) &&
+		bytes.Equal(a.Navigation, b.Navigation)
+}
+
+// checkBundleRoundTrip bundles a generated map with every compression and
+// checks that it reads back unchanged, for the self-test.
+func checkBundleRoundTrip(result mapgen.MapResult, manifest []byte) error {
+	b := &mapgen.MapBundle{
+		Manifest:  manifest,
+		Map:       result.Map.Data,
+		Map4x:     result.Map4x.Data,
+		Map16x:    result.Map16x.Data,
+		Thumbnail: result.Thumbnail,
+	}
+	for name, compression := range bundleCompressions {
+		data, err := mapgen.CreateCombinedBinary(b, compression)
+		if err != nil {
+			return fmt.Errorf("%s bundle: %w", name, err)
+		}
+		_, decoded, err := mapgen.DecodeCombinedBinary(data)
+		if err != nil {
+			return fmt.Errorf("%s bundle does not read back: %w", name, err)
+		}
+		if !bundlesEqual(decoded, b) {
+			return fmt.Errorf("%s bundle does not read back", name)
+		}
+	}
+	return nil
+}
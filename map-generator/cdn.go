@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+// cdnDirFlag is the directory to write content-addressed copies of the
+// outputs to, if set.
+var cdnDirFlag string
+
+// cdnHashLength is the number of hex digits of a file's SHA-256 put in its
+// content-addressed name.
+const cdnHashLength = 12
+
+// cdnMapping is the mapping manifest written to cdn.json: for each map, the
+// content-addressed path of its manifest and of every file it lists, relative
+// to the CDN directory.
+type cdnMapping struct {
+	Maps map[string]cdnMapFiles `json:"maps"`
+}
+
+type cdnMapFiles struct {
+	Manifest string            `json:"manifest"`
+	Files    map[string]string `json:"files"`
+}
+
+// contentAddressedName inserts the first cdnHashLength digits of digest
+// before the extension of name: "map.bin" becomes "map.<hash>.bin" and
+// "map.bin.patch" becomes "map.<hash>.bin.patch".
+func contentAddressedName(name, digest string) string {
+	stem, ext, _ := strings.Cut(name, ".")
+	if ext != "" {
+		ext = "." + ext
+	}
+	return stem + "." + digest[:cdnHashLength] + ext
+}
+
+// writeCDNOutput copies the outputs of every map processed without error into
+// dir under content-addressed names, which never change once published and
+// can be cached forever, then updates dir/cdn.json to point at them. Maps that
+// were not processed in this run keep their entries. cdn.json is replaced
+// atomically, so clients see either the previous or the new version of every
+// map, and files referenced by earlier versions are left in place for clients
+// still holding them. Test maps are not published.
+func writeCDNOutput(ctx context.Context, dir string, outcomes []mapOutcome) error {
+	logger := mapgen.LoggerFromContext(ctx)
+	outDir, err := outputMapDir(false)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	mappingPath := filepath.Join(dir, "cdn.json")
+	mapping := cdnMapping{Maps: make(map[string]cdnMapFiles)}
+	buf, err := os.ReadFile(mappingPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal(buf, &mapping); err != nil {
+			return fmt.Errorf("invalid %s: %w", mappingPath, err)
+		}
+		if mapping.Maps == nil {
+			mapping.Maps = make(map[string]cdnMapFiles)
+		}
+	}
+
+	written := 0
+	for _, o := range outcomes {
+		if o.Err != nil || o.Entry.IsTest {
+			continue
+		}
+		files, n, err := publishMapFiles(filepath.Join(outDir, o.Entry.Name), filepath.Join(dir, o.Entry.Name), o.Entry.Name)
+		if err != nil {
+			return fmt.Errorf("map %s: %w", o.Entry.Name, err)
+		}
+		mapping.Maps[o.Entry.Name] = files
+		written += n
+	}
+
+	out, err := json.MarshalIndent(mapping, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".cdn-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(append(out, '\n'))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), mappingPath); err != nil {
+		return err
+	}
+	logger.Info(fmt.Sprintf("Wrote %d new content-addressed file(s) and %s", written, mappingPath))
+	return nil
+}
+
+// publishMapFiles copies the manifest of mapDir and every file it lists into
+// cdnMapDir under content-addressed names, skipping files already there. It
+// returns the map's cdn.json entry, with paths prefixed by name, and the
+// number of files written.
+func publishMapFiles(mapDir, cdnMapDir, name string) (cdnMapFiles, int, error) {
+	manifestBuffer, err := os.ReadFile(filepath.Join(mapDir, "manifest.json"))
+	if err != nil {
+		return cdnMapFiles{}, 0, err
+	}
+	var manifest struct {
+		Checksums map[string]string `json:"checksums"`
+	}
+	if err := json.Unmarshal(manifestBuffer, &manifest); err != nil {
+		return cdnMapFiles{}, 0, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if err := os.MkdirAll(cdnMapDir, 0755); err != nil {
+		return cdnMapFiles{}, 0, err
+	}
+
+	written := 0
+	publish := func(file string, data []byte, digest string) (string, error) {
+		hashed := contentAddressedName(file, digest)
+		target := filepath.Join(cdnMapDir, hashed)
+		if _, err := os.Stat(target); err != nil {
+			if data == nil {
+				var err error
+				if data, err = os.ReadFile(filepath.Join(mapDir, file)); err != nil {
+					return "", err
+				}
+				if sha256Hex(data) != digest {
+					return "", fmt.Errorf("%s does not match its manifest checksum", file)
+				}
+			}
+			if err := os.WriteFile(target, data, 0644); err != nil {
+				return "", err
+			}
+			written++
+		}
+		// Precompressed copies (see --precompress) are published alongside.
+		for _, ext := range precompressedExtensions {
+			if _, err := os.Stat(target + ext); err == nil {
+				continue
+			}
+			compressed, err := os.ReadFile(filepath.Join(mapDir, file+ext))
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return "", err
+			}
+			if err := os.WriteFile(target+ext, compressed, 0644); err != nil {
+				return "", err
+			}
+			written++
+		}
+		return path.Join(name, hashed), nil
+	}
+
+	entry := cdnMapFiles{Files: make(map[string]string, len(manifest.Checksums))}
+	for file, digest := range manifest.Checksums {
+		if err := checkChecksumFile(file); err != nil {
+			return cdnMapFiles{}, 0, err
+		}
+		if len(digest) < cdnHashLength {
+			return cdnMapFiles{}, 0, fmt.Errorf("invalid checksum for %s", file)
+		}
+		hashed, err := publish(file, nil, digest)
+		if err != nil {
+			return cdnMapFiles{}, 0, err
+		}
+		entry.Files[file] = hashed
+	}
+	entry.Manifest, err = publish("manifest.json", manifestBuffer, sha256Hex(manifestBuffer))
+	if err != nil {
+		return cdnMapFiles{}, 0, err
+	}
+	return entry, written, nil
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapformat"
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+// chunkSizeFlag is the side, in tiles, of the chunks of the map.chunks file
+// written next to every map's outputs, or 0 for none.
+var chunkSizeFlag int
+
+const (
+	// chunkedFile is the chunked copy of map.bin.
+	chunkedFile = "map.chunks"
+	// chunkedMagic and chunkedVersion start a chunked file; bump the version
+	// whenever the layout changes.
+	chunkedMagic   = "OFCH"
+	chunkedVersion = 1
+	// chunkedHeaderSize is the size of the header before the index.
+	chunkedHeaderSize = 16
+	// Bounds of --chunk-size.
+	minChunkSize = 16
+	maxChunkSize = 4096
+)
+
+// chunkGrid returns the number of chunk columns and rows of a map.
+func chunkGrid(width, height, size int) (columns, rows int) {
+	return (width + size - 1) / size, (height + size - 1) / size
+}
+
+// encodeChunked splits a packed map (row-major, width×height) into square
+// chunks of size tiles, so that a client can fetch only the chunks it shows
+// with HTTP range requests. The file is little-endian:
+//
+//	"OFCH", u16 version, u16 chunk size, u32 width, u32 height
+//	index: u32 offset of every chunk from the start of the file, chunks
+//	       row-major over the chunk grid, then the file size, so that
+//	       chunk i spans from index entry i to entry i+1
+//	chunks: the tiles of each chunk, row-major, gzip-compressed
+//
+// Chunks at the right and bottom edges may be narrower. Each chunk is a
+// gzip stream of its own, which browsers decompress natively with
+// DecompressionStream. A client reads the header and index with one range
+// request of 16 + 4 × (chunks + 1) bytes, then each chunk it needs.
+func encodeChunked(packed []byte, width, height, size int) ([]byte, error) {
+	columns, rows := chunkGrid(width, height, size)
+	n := columns * rows
+	le := binary.LittleEndian
+	out := []byte(chunkedMagic)
+	out = le.AppendUint16(out, chunkedVersion)
+	out = le.AppendUint16(out, uint16(size))
+	out = le.AppendUint32(out, uint32(width))
+	out = le.AppendUint32(out, uint32(height))
+	index := len(out)
+	out = append(out, make([]byte, 4*(n+1))...)
+
+	tiles := make([]byte, 0, size*size)
+	for i := 0; i < n; i++ {
+		x0, y0 := (i%columns)*size, (i/columns)*size
+		x1, y1 := min(x0+size, width), min(y0+size, height)
+		tiles = tiles[:0]
+		for y := y0; y < y1; y++ {
+			tiles = append(tiles, packed[y*width+x0:y*width+x1]...)
+		}
+		compressed, err := mapgen.EncodeGzip(tiles)
+		if err != nil {
+			return nil, err
+		}
+		le.PutUint32(out[index+4*i:], uint32(len(out)))
+		out = append(out, compressed...)
+	}
+	if len(out) > 1<<32-1 {
+		return nil, errors.New("chunked map over 4 GiB")
+	}
+	le.PutUint32(out[index+4*n:], uint32(len(out)))
+	return out, nil
+}
+
+// decodeChunked reassembles the packed map of a chunked file.
+func decodeChunked(data []byte) (packed []byte, width, height int, err error) {
+	le := binary.LittleEndian
+	if len(data) < chunkedHeaderSize || string(data[:4]) != chunkedMagic {
+		return nil, 0, 0, errors.New("not a chunked map")
+	}
+	if v := le.Uint16(data[4:]); v != chunkedVersion {
+		return nil, 0, 0, fmt.Errorf("unsupported chunked map version %d", v)
+	}
+	size := int(le.Uint16(data[6:]))
+	width, height = int(le.Uint32(data[8:])), int(le.Uint32(data[12:]))
+	if size == 0 || width == 0 || height == 0 {
+		return nil, 0, 0, errors.New("invalid chunked map header")
+	}
+	columns, rows := chunkGrid(width, height, size)
+	n := columns * rows
+	if len(data) < chunkedHeaderSize+4*(n+1) {
+		return nil, 0, 0, errors.New("truncated chunk index")
+	}
+	offset := func(i int) int { return int(le.Uint32(data[chunkedHeaderSize+4*i:])) }
+	packed = make([]byte, width*height)
+	for i := 0; i < n; i++ {
+		start, end := offset(i), offset(i+1)
+		if start > end || end > len(data) {
+			return nil, 0, 0, fmt.Errorf("chunk %d out of bounds", i)
+		}
+		tiles, err := mapgen.DecodeGzip(data[start:end])
+		if err != nil {
+			return nil, 0, 0, fmt.Errorf("chunk %d: %w", i, err)
+		}
+		x0, y0 := (i%columns)*size, (i/columns)*size
+		w, h := min(size, width-x0), min(size, height-y0)
+		if len(tiles) != w*h {
+			return nil, 0, 0, fmt.Errorf("chunk %d has %d tiles, expected %d", i, len(tiles), w*h)
+		}
+		for y := 0; y < h; y++ {
+			copy(packed[(y0+y)*width+x0:], tiles[y*w:(y+1)*w])
+		}
+	}
+	return packed, width, height, nil
+}
+
+// writeMapChunks writes the chunked copy of a processed map's map.bin with
+// --chunk-size, and otherwise removes any left by an earlier run.
+func writeMapChunks(m mapEntry) error {
+	outDir, err := outputMapDir(m.IsTest)
+	if err != nil {
+		return err
+	}
+	mapDir := filepath.Join(outDir, m.Name)
+	path := filepath.Join(mapDir, chunkedFile)
+	if chunkSizeFlag == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove stale %s for %s: %w", chunkedFile, m.Name, err)
+		}
+		return nil
+	}
+	manifest, err := mapformat.ReadManifest(mapDir)
+	if err != nil {
+		return fmt.Errorf("failed to read manifest of %s: %w", m.Name, err)
+	}
+	packed, err := os.ReadFile(filepath.Join(mapDir, mapformat.Scale1x.File()))
+	if err != nil {
+		return err
+	}
+	if len(packed) != manifest.Map.Width*manifest.Map.Height {
+		return fmt.Errorf("map.bin of %s does not match its manifest dimensions", m.Name)
+	}
+	data, err := encodeChunked(packed, manifest.Map.Width, manifest.Map.Height, chunkSizeFlag)
+	if err != nil {
+		return fmt.Errorf("failed to chunk %s: %w", m.Name, err)
+	}
+	// Read the chunks back before declaring success.
+	decoded, _, _, err := decodeChunked(data)
+	if err != nil {
+		return fmt.Errorf("%s of %s does not read back: %w", chunkedFile, m.Name, err)
+	}
+	if !bytes.Equal(decoded, packed) {
+		return fmt.Errorf("%s of %s does not read back", chunkedFile, m.Name)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s for %s: %w", chunkedFile, m.Name, err)
+	}
+	return nil
+}
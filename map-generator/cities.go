@@ -0,0 +1,179 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+const (
+	// defaultCitiesURL is the GeoNames dump of every city of at least 15000
+	// inhabitants.
+	defaultCitiesURL = "https://download.geonames.org/export/dump/cities15000.zip"
+	// maxCitiesDownloadSize bounds the city datasets import-cities downloads.
+	maxCitiesDownloadSize = 256 << 20
+)
+
+// parseGeoNames reads a GeoNames city dump, tab-separated with the columns
+// documented at https://download.geonames.org/export/dump/readme.txt, and
+// returns the national capitals, which have the feature code PPLC, and the
+// cities of at least minPopulation inhabitants inside bbox.
+func parseGeoNames(r io.Reader, bbox [4]float64, minPopulation int) ([]mapgen.CityRecord, error) {
+	var cities []mapgen.CityRecord
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < 15 {
+			return nil, fmt.Errorf("line %d: expected at least 15 columns, got %d", line, len(fields))
+		}
+		lat, err := strconv.ParseFloat(fields[4], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: latitude: %w", line, err)
+		}
+		lon, err := strconv.ParseFloat(fields[5], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: longitude: %w", line, err)
+		}
+		population, err := strconv.Atoi(fields[14])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: population: %w", line, err)
+		}
+		capital := fields[7] == "PPLC"
+		if population < minPopulation && !capital || lon < bbox[0] || lat < bbox[1] || lon > bbox[2] || lat > bbox[3] {
+			continue
+		}
+		cities = append(cities, mapgen.CityRecord{
+			Name:       fields[1],
+			Country:    fields[8],
+			Lon:        lon,
+			Lat:        lat,
+			Population: population,
+			Capital:    capital,
+		})
+	}
+	return cities, scanner.Err()
+}
+
+// runImportCities downloads a GeoNames city dump, keeps the major cities
+// inside a map's "geo" bounding box and writes them to the map's
+// cities.json, which the generator places on the map's land and records in
+// the manifest "cities" section.
+func runImportCities(args []string) error {
+	fset, logFlags := newCommandFlagSet("import-cities")
+	name := fset.String("map", "", "map folder to import cities for")
+	source := fset.String("source", defaultCitiesURL, "GeoNames city dump, as a .zip or .txt, by http(s) URL or local path")
+	minPopulation := fset.Int("min-population", 100000, "smallest population of an imported city other than a capital")
+	maxCities := fset.Int("max-cities", 100, "largest number of cities to import, most populous first; capitals are always kept")
+	force := fset.Bool("force", false, "overwrite an existing cities.json")
+	fset.Parse(args)
+	setupLogging(*logFlags)
+	logger := mapgen.LoggerFromContext(context.Background())
+	if *name == "" {
+		return fmt.Errorf("-map is required")
+	}
+	if *maxCities < 1 {
+		return fmt.Errorf("-max-cities must be at least 1")
+	}
+
+	mapDir, geo, err := geoMapDir(*name)
+	if err != nil {
+		return err
+	}
+	outPath := filepath.Join(mapDir, "cities.json")
+	if _, err := os.Stat(outPath); err == nil && !*force {
+		return fmt.Errorf("%s already exists, use -force to overwrite it", outPath)
+	}
+
+	var data []byte
+	if strings.HasPrefix(*source, "http://") || strings.HasPrefix(*source, "https://") {
+		logger.Info(fmt.Sprintf("Downloading %s", *source))
+		var buf bytes.Buffer
+		if _, err := fetchRemote(context.Background(), *source, &buf, maxCitiesDownloadSize, 10*time.Minute); err != nil {
+			return err
+		}
+		data = buf.Bytes()
+	} else if data, err = os.ReadFile(*source); err != nil {
+		return err
+	}
+	var text io.Reader = bytes.NewReader(data)
+	if strings.HasSuffix(*source, ".zip") {
+		archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", *source, err)
+		}
+		var entry *zip.File
+		for _, f := range archive.File {
+			if strings.HasSuffix(f.Name, ".txt") && !strings.EqualFold(f.Name, "readme.txt") {
+				entry = f
+				break
+			}
+		}
+		if entry == nil {
+			return fmt.Errorf("%s holds no .txt city dump", *source)
+		}
+		rc, err := entry.Open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		text = rc
+	}
+	records, err := parseGeoNames(text, geo.BBox, *minPopulation)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", *source, err)
+	}
+
+	// Keep every capital and the most populous of the other cities.
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].Capital != records[j].Capital {
+			return records[i].Capital
+		}
+		if records[i].Population != records[j].Population {
+			return records[i].Population > records[j].Population
+		}
+		return records[i].Name < records[j].Name
+	})
+	capitals := 0
+	for _, r := range records {
+		if r.Capital {
+			capitals++
+		}
+	}
+	if len(records) > max(*maxCities, capitals) {
+		records = records[:max(*maxCities, capitals)]
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].Population != records[j].Population {
+			return records[i].Population > records[j].Population
+		}
+		return records[i].Name < records[j].Name
+	})
+	if len(records) == 0 {
+		return fmt.Errorf("no city of %s with at least %d inhabitants lies inside the map's bounding box", *source, *minPopulation)
+	}
+
+	out, err := json.MarshalIndent(map[string]any{"cities": records}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(outPath, append(out, '\n'), 0644); err != nil {
+		return err
+	}
+	logger.Info(fmt.Sprintf("Wrote %d cities (%d capitals) to %s", len(records), capitals, outPath))
+	return nil
+}
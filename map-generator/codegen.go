@@ -48,6 +48,9 @@ type mapInfo struct {
 	// Preferred team count in team/special games (see MapPlaylist).
 	// 0 (or omitted) means no preference.
 	SpecialTeamCount int `json:"special_team_count"`
+	// Archived maps are retired from rotation: they are no longer generated,
+	// but their committed outputs stay loadable for replays of old games.
+	Archived bool `json:"archived"`
 	// Theme name(s) for bot tribe names (references tribeNameThemes.json).
 	// Empty or omitted uses the "default" theme.
 	Themes []string `json:"themes"`
@@ -140,7 +143,7 @@ func loadMapInfos() ([]mapInfo, error) {
 		if m.IsTest {
 			continue
 		}
-		buf, err := os.ReadFile(filepath.Join(inputDir, m.Name, "info.json"))
+		buf, err := readInfoJSON(filepath.Join(inputDir, m.Name, "info.json"))
 		if err != nil {
 			return nil, fmt.Errorf("failed to read info.json for %s: %w", m.Name, err)
 		}
@@ -169,6 +172,9 @@ func loadMapInfos() ([]mapInfo, error) {
 		if info.SpecialTeamCount < 0 || info.SpecialTeamCount == 1 {
 			return nil, fmt.Errorf("map %s: info.json \"special_team_count\" (%d) must be >= 2", m.Name, info.SpecialTeamCount)
 		}
+		if info.Archived && (info.MultiplayerFrequency > 0 || info.hasCategory("featured")) {
+			return nil, fmt.Errorf("map %s: archived maps must have \"multiplayer_frequency\" 0 and must not be featured", m.Name)
+		}
 		if len(info.Categories) == 0 {
 			return nil, fmt.Errorf("map %s: info.json \"categories\" must list at least one category", m.Name)
 		}
@@ -277,6 +283,8 @@ func generateMapsTS(infos []mapInfo) error {
 	b.WriteString("  themes?: string[];\n")
 	b.WriteString("  /** Custom tribe entry: a string (random spawn) or an object with name and coordinates. */\n")
 	b.WriteString("  customTribes?: CustomTribe[];\n")
+	b.WriteString("  /** Retired from rotation; kept so replays of old games still load. */\n")
+	b.WriteString("  archived?: boolean;\n")
 	b.WriteString("}\n\n")
 	b.WriteString("export interface CustomTribe {\n")
 	b.WriteString("  name: string;\n")
@@ -329,6 +337,9 @@ func generateMapsTS(infos []mapInfo) error {
 			}
 			b.WriteString("],\n")
 		}
+		if info.Archived {
+			b.WriteString("    archived: true,\n")
+		}
 		b.WriteString("  },\n")
 	}
 	b.WriteString("];\n")
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// command is a map-generator subcommand, run as `go run . <name> [flags]`.
+// Running without a subcommand generates the maps.
+type command struct {
+	Name    string
+	Summary string
+	Run     func(args []string) error
+}
+
+// commands lists the available subcommands.
+var commands = []command{
+	{Name: "migrate", Summary: "upgrade info.json and manifest.json files to the current schema version", Run: runMigrate},
+	{Name: "fetch-elevation", Summary: "download real-world elevation for a bounding box and write a map's image.png and bathymetry.png", Run: runFetchElevation},
+	{Name: "import-borders", Summary: "write the country or region polygons around a real-world map to its borders.geojson", Run: runImportBorders},
+	{Name: "import-cities", Summary: "write the major GeoNames cities inside a real-world map to its cities.json", Run: runImportCities},
+	{Name: "generate", Summary: "draw a procedural map from a seed, size and land, mountain and island parameters as a new map, with its outputs", Run: runGenerate},
+	{Name: "transform", Summary: "write a rotated or mirrored copy of a map, with its spawn coordinates moved, as a new map", Run: runTransform},
+	{Name: "verify-remote", Summary: "compare deployed manifests and files at a base URL with the local outputs and report drift", Run: runVerifyRemote},
+	{Name: "encodings", Summary: "benchmark terrain encodings on generated maps and recommend one per map", Run: runEncodings},
+	{Name: "inspect", Summary: "print the dimensions, tile counts and an ASCII rendering of a packed map file", Run: runInspect},
+	{Name: "decode", Summary: "turn a packed map file back into a source image.png that generates it again, or into a colour overlay of its bits", Run: runDecode},
+	{Name: "query", Summary: "print the state of a tile of a generated map in every scale and layer, with its neighbourhood", Run: runQuery},
+	{Name: "random-maps", Summary: "generate a batch of seeded small random maps with terrain tensors and manifests for training bots", Run: runRandomMaps},
+	{Name: "augment", Summary: "export rotated, mirrored and cropped variants of generated maps as terrain tensors for training bots", Run: runAugment},
+	{Name: "serve", Summary: "run an HTTP server validating uploaded maps for community submissions and serving generated maps", Run: runServe},
+	{Name: "codegen", Summary: "write the TypeScript types and Zod schemas of the manifest, and the map container reader, for the game client and server", Run: runCodegen},
+	{Name: "keygen", Summary: "write a new Ed25519 key pair for signing manifests with --sign-key", Run: runKeygen},
+	{Name: "verify", Summary: "check generated outputs against their manifests and, with -keys, the manifest signatures", Run: runVerify},
+	{Name: "similar", Summary: "report generated maps that look like near-duplicates of each other", Run: runSimilar},
+	{Name: "thumbdiff", Summary: "write side-by-side and difference images of thumbnails changed between two output directories", Run: runThumbDiff},
+	{Name: "validate", Summary: "generate maps in memory and report authoring mistakes such as stray colours, unreachable land or a land share out of range", Run: runValidate},
+	{Name: "doctor", Summary: "check the directories, WebP encoder, memory and map configs generation depends on, with fixes", Run: runDoctor},
+	{Name: "selftest", Summary: "generate the embedded fixture maps and compare them to their recorded outputs", Run: runSelfTest},
+}
+
+// findCommand returns the subcommand with the given name.
+func findCommand(name string) (command, bool) {
+	for _, c := range commands {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return command{}, false
+}
+
+// printUsage prints the generator flags followed by the available subcommands.
+func printUsage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [flags]\n       %s <command> [flags]\n\nFlags:\n", os.Args[0], os.Args[0])
+	flag.PrintDefaults()
+	fmt.Fprintf(out, "\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-12s %s\n", c.Name, c.Summary)
+	}
+}
+
+// registerLogFlags registers the logging flags shared by the generator and
+// every subcommand on fs.
+func registerLogFlags(fs *flag.FlagSet, logFlags *LogFlags) {
+	fs.StringVar(&logFlags.logLevel, "log-level", "", "Explicitly sets the log level to one of: ALL, DEBUG, INFO (default), WARN, ERROR.")
+	fs.BoolVar(&logFlags.verbose, "verbose", false, "Adds additional logging and prefixes logs with the [mapname].  Alias of log-level=DEBUG.")
+	fs.BoolVar(&logFlags.verbose, "v", false, "-verbose shorthand")
+	fs.BoolVar(&logFlags.performance, "log-performance", false, "Adds additional logging for performance-based recommendations, sets log-level=DEBUG")
+	fs.BoolVar(&logFlags.removal, "log-removal", false, "Adds additional logging of removed island and lake position/size, sets log-level=DEBUG")
+	fs.BoolVar(&logFlags.quiet, "quiet", false, "Logs only warnings, errors, a one-line result per map and the run summary.")
+	fs.BoolVar(&logFlags.quiet, "q", false, "-quiet shorthand")
+}
+
+// setupLogging installs a GeneratorLogger configured from logFlags as the
+// default slog logger.
+func setupLogging(logFlags LogFlags) {
+	logger := slog.New(NewGeneratorLogger(
+		os.Stdout,
+		&slog.HandlerOptions{
+			Level: DetermineLogLevel(logFlags),
+		},
+		logFlags,
+	))
+	slog.SetDefault(logger)
+}
+
+// newCommandFlagSet returns a FlagSet for a subcommand with the logging flags
+// registered. Call setupLogging with the returned flags after parsing.
+func newCommandFlagSet(name string) (*flag.FlagSet, *LogFlags) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	logFlags := &LogFlags{}
+	registerLogFlags(fs, logFlags)
+	return fs, logFlags
+}
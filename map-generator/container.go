@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/containerpb"
+	"google.golang.org/protobuf/proto"
+)
+
+// containerFlag selects the single-file container written next to every
+// map's outputs, one of containerFormats, or "" for none, for clients that
+// would rather fetch one versioned file than the manifest and each binary.
+// proto is the MapContainer message of map_container.proto, encoded with the
+// protoc-gen-go code in pkg/containerpb and read by the client with the
+// MapContainer.gen.ts codegen writes. flatbuffers, under evaluation for
+// loading giant maps in place without a parse step, is the buffer of
+// map_container.fbs, with the flatc output for Go and TypeScript in
+// pkg/containerfb. Runs without the flag, or with the other format, delete
+// the container, so that none goes stale.
+var containerFlag string
+
+// Container formats of --container.
+const (
+	containerProto       = "proto"
+	containerFlatBuffers = "flatbuffers"
+)
+
+// containerFormat is a container format: the file it writes and its codec.
+type containerFormat struct {
+	File   string
+	Encode func(c *mapContainer) ([]byte, error)
+	Decode func(data []byte) (*mapContainer, error)
+}
+
+// containerFormats are the container formats by --container name.
+var containerFormats = map[string]containerFormat{
+	containerProto:       {File: "map.pb", Encode: encodeProtoContainer, Decode: decodeProtoContainer},
+	containerFlatBuffers: {File: "map.fb", Encode: encodeFlatContainer, Decode: decodeFlatContainer},
+}
+
+// mapContainer is a map's outputs in one file, see map_container.proto and
+// map_container.fbs.
+type mapContainer struct {
+	SchemaVersion    uint32
+	GeneratorVersion uint32
+	ManifestJSON     string
+	Scales           []containerScale
+	Thumbnail        []byte
+	Layers           []containerLayer
+}
+
+// containerScale is a packed map scale of a mapContainer.
+type containerScale struct {
+	File, Section string
+	Width, Height uint32
+	NumLandTiles  uint32
+	Data          []byte
+}
+
+// containerLayer is an auxiliary layer of a mapContainer.
+type containerLayer struct {
+	Name, File string
+	MetaJSON   string
+	Data       []byte
+}
+
+// writeMapContainer writes the container of a processed map with
+// --container, and otherwise removes any container left by an earlier run.
+func writeMapContainer(m mapEntry) error {
+	outDir, err := outputMapDir(m.IsTest)
+	if err != nil {
+		return err
+	}
+	mapDir := filepath.Join(outDir, m.Name)
+	for name, format := range containerFormats {
+		if name == containerFlag {
+			continue
+		}
+		if err := os.Remove(filepath.Join(mapDir, format.File)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove stale container for %s: %w", m.Name, err)
+		}
+	}
+	if containerFlag == "" {
+		return nil
+	}
+	c, err := readMapContainer(mapDir)
+	if err != nil {
+		return fmt.Errorf("failed to read outputs of %s for its container: %w", m.Name, err)
+	}
+	format := containerFormats[containerFlag]
+	data, err := format.Encode(c)
+	if err != nil {
+		return fmt.Errorf("failed to encode container for %s: %w", m.Name, err)
+	}
+	// Read the container back before declaring success.
+	decoded, err := format.Decode(data)
+	if err != nil {
+		return fmt.Errorf("container of %s does not read back: %w", m.Name, err)
+	}
+	if decoded.ManifestJSON != c.ManifestJSON || len(decoded.Scales) != len(c.Scales) || len(decoded.Layers) != len(c.Layers) {
+		return fmt.Errorf("container of %s does not read back", m.Name)
+	}
+	if err := os.WriteFile(filepath.Join(mapDir, format.File), data, 0644); err != nil {
+		return fmt.Errorf("failed to write container for %s: %w", m.Name, err)
+	}
+	return nil
+}
+
+// readMapContainer collects the outputs of a map directory, as listed by its
+// manifest. Layers are sorted by name.
+func readMapContainer(mapDir string) (*mapContainer, error) {
+	manifest, err := os.ReadFile(filepath.Join(mapDir, "manifest.json"))
+	if err != nil {
+		return nil, err
+	}
+	var doc struct {
+		SchemaVersion    uint32                     `json:"schema_version"`
+		GeneratorVersion uint32                     `json:"generator_version"`
+		Layers           map[string]json.RawMessage `json:"layers"`
+	}
+	var sections map[string]json.RawMessage
+	if err := json.Unmarshal(manifest, &doc); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if err := json.Unmarshal(manifest, &sections); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	c := &mapContainer{SchemaVersion: doc.SchemaVersion, GeneratorVersion: doc.GeneratorVersion, ManifestJSON: string(manifest)}
+
+	for _, f := range mapScaleFiles {
+		var scale manifestScale
+		if err := json.Unmarshal(sections[f.Section], &scale); err != nil {
+			return nil, fmt.Errorf("invalid manifest section %q: %w", f.Section, err)
+		}
+		data, err := os.ReadFile(filepath.Join(mapDir, f.File))
+		if err != nil {
+			return nil, err
+		}
+		c.Scales = append(c.Scales, containerScale{
+			File:         f.File,
+			Section:      f.Section,
+			Width:        uint32(scale.Width),
+			Height:       uint32(scale.Height),
+			NumLandTiles: uint32(scale.NumLandTiles),
+			Data:         data,
+		})
+	}
+	if c.Thumbnail, err = os.ReadFile(filepath.Join(mapDir, "thumbnail.webp")); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(doc.Layers))
+	for name := range doc.Layers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var entry struct {
+			File string `json:"file"`
+		}
+		if err := json.Unmarshal(doc.Layers[name], &entry); err != nil {
+			return nil, fmt.Errorf("invalid manifest entry for layer %s: %w", name, err)
+		}
+		data, err := os.ReadFile(filepath.Join(mapDir, entry.File))
+		if err != nil {
+			return nil, err
+		}
+		var meta bytes.Buffer
+		if err := json.Compact(&meta, doc.Layers[name]); err != nil {
+			return nil, err
+		}
+		c.Layers = append(c.Layers, containerLayer{Name: name, File: entry.File, MetaJSON: meta.String(), Data: data})
+	}
+	return c, nil
+}
+
+// encodeProtoContainer encodes c as a MapContainer message of
+// map_container.proto. Deterministic marshaling keeps unchanged maps'
+// containers byte-identical across runs.
+func encodeProtoContainer(c *mapContainer) ([]byte, error) {
+	msg := &containerpb.MapContainer{
+		SchemaVersion:    c.SchemaVersion,
+		GeneratorVersion: c.GeneratorVersion,
+		ManifestJson:     c.ManifestJSON,
+		Thumbnail:        c.Thumbnail,
+	}
+	for _, s := range c.Scales {
+		msg.Scales = append(msg.Scales, &containerpb.Scale{
+			File:         s.File,
+			Section:      s.Section,
+			Width:        s.Width,
+			Height:       s.Height,
+			NumLandTiles: s.NumLandTiles,
+			Data:         s.Data,
+		})
+	}
+	for _, l := range c.Layers {
+		msg.Layers = append(msg.Layers, &containerpb.Layer{Name: l.Name, File: l.File, MetaJson: l.MetaJSON, Data: l.Data})
+	}
+	return proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+}
+
+// decodeProtoContainer decodes a MapContainer message. Unknown fields are
+// skipped, so that containers from newer generators still read.
+func decodeProtoContainer(data []byte) (*mapContainer, error) {
+	var msg containerpb.MapContainer
+	if err := proto.Unmarshal(data, &msg); err != nil {
+		return nil, fmt.Errorf("invalid container: %w", err)
+	}
+	c := &mapContainer{
+		SchemaVersion:    msg.SchemaVersion,
+		GeneratorVersion: msg.GeneratorVersion,
+		ManifestJSON:     msg.ManifestJson,
+		Thumbnail:        msg.Thumbnail,
+	}
+	for _, s := range msg.Scales {
+		c.Scales = append(c.Scales, containerScale{
+			File:         s.File,
+			Section:      s.Section,
+			Width:        s.Width,
+			Height:       s.Height,
+			NumLandTiles: s.NumLandTiles,
+			Data:         s.Data,
+		})
+	}
+	for _, l := range msg.Layers {
+		c.Layers = append(c.Layers, containerLayer{Name: l.Name, File: l.File, MetaJSON: l.MetaJson, Data: l.Data})
+	}
+	return c, nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/bufbuild/protocompile"
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/containerpb"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+)
+
+// testContainer is a container with every field set.
+func testContainer() *mapContainer {
+	return &mapContainer{
+		SchemaVersion:    3,
+		GeneratorVersion: 16,
+		ManifestJSON:     `{"name":"Test"}`,
+		Scales: []containerScale{
+			{File: "map.bin", Section: "map", Width: 4, Height: 2, NumLandTiles: 3, Data: []byte{0x80, 0, 0x81, 0x20, 0, 0, 0x82, 0}},
+			{File: "map4x.bin", Section: "map4x", Width: 2, Height: 1, NumLandTiles: 1, Data: []byte{0x80, 0}},
+		},
+		Thumbnail: []byte("RIFF\x04\x00\x00\x00WEBP"),
+		Layers: []containerLayer{
+			{Name: "elevation", File: "elevation.bin", MetaJSON: `{"file":"elevation.bin"}`, Data: []byte{1, 2, 3, 4}},
+			{Name: "salinity", File: "salinity.bin", MetaJSON: `{"file":"salinity.bin"}`, Data: []byte{0, 1}},
+		},
+	}
+}
+
+// TestProtoContainerSchema checks that pkg/containerpb was generated from
+// the current map_container.proto, and round-trips a container through
+// encodeProtoContainer and decodeProtoContainer.
+func TestProtoContainerSchema(t *testing.T) {
+	compiler := protocompile.Compiler{Resolver: &protocompile.SourceResolver{}}
+	files, err := compiler.Compile(context.Background(), "map_container.proto")
+	if err != nil {
+		t.Fatalf("compile map_container.proto: %v", err)
+	}
+	want := protodesc.ToFileDescriptorProto(files[0])
+	got := protodesc.ToFileDescriptorProto(containerpb.File_map_container_proto)
+	want.SourceCodeInfo, got.SourceCodeInfo = nil, nil
+	if !proto.Equal(got, want) {
+		t.Fatal("pkg/containerpb is out of date with map_container.proto, run go generate ./pkg/containerpb")
+	}
+
+	c := testContainer()
+	data, err := encodeProtoContainer(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := decodeProtoContainer(data)
+	if err != nil {
+		t.Fatalf("decodeProtoContainer: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, c) {
+		t.Errorf("decodeProtoContainer reads %+v, want %+v", decoded, c)
+	}
+	if _, err := decodeProtoContainer(data[:len(data)-1]); err == nil {
+		t.Error("decodeProtoContainer accepts a truncated container")
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"sort"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapformat"
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+// decodeLandRedGreen is the red and green of the land of the source images
+// written by the decode command: gray, the temperate biome.
+const decodeLandRedGreen = 150
+
+// Key colours of the source images written by the decode command. Water
+// bodies the generator would not classify as they are packed get a key
+// colour, and impassable kinds other than the void an impassable colour,
+// which the command prints the info.json entries of.
+var (
+	decodeOceanKey      = [3]uint8{0x00, 0x50, 0xff}
+	decodeLakeKey       = [3]uint8{0x30, 0x50, 0xff}
+	decodeImpassableKey = map[mapgen.ImpassableKind][3]uint8{
+		mapgen.ImpassableIce:  {0xeb, 0xf2, 0xf8},
+		mapgen.ImpassableLava: {0xb4, 0x3c, 0x14},
+	}
+)
+
+// runDecode implements the decode command: it turns a packed map file back
+// into an image.png the generator reads, for fixing shipped maps whose
+// source image is lost, or into an overlay colouring what the packed bits
+// hold, for debugging them without a hex editor.
+func runDecode(args []string) error {
+	fs, logFlags := newCommandFlagSet("decode")
+	size := fs.String("size", "", "dimensions of the file as WIDTHxHEIGHT, for files without a manifest.json next to them")
+	out := fs.String("out", "decoded.png", "path of the PNG to write")
+	overlay := fs.Bool("overlay", false, "colour the ocean, lakes, shorelines and magnitudes for viewing instead of writing a source image")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s decode [flags] path/to/map.bin\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	setupLogging(*logFlags)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("decode takes the path of one packed map file")
+	}
+	f, err := readPackedMapFile(fs.Arg(0), *size)
+	if err != nil {
+		return err
+	}
+	logger := mapgen.LoggerFromContext(context.Background())
+
+	var img *image.NRGBA
+	if *overlay {
+		img = decodeOverlay(f.Map)
+	} else {
+		config, err := decodeGeneratorConfig(f.Manifest)
+		if err != nil {
+			return err
+		}
+		var notes []string
+		var generator map[string]any
+		img, generator, notes = decodeSourceImage(f.Map, config)
+		for _, note := range notes {
+			logger.Info(note)
+		}
+		if len(generator) > 0 {
+			snippet, err := json.MarshalIndent(map[string]any{"generator": generator}, "", "  ")
+			if err != nil {
+				return err
+			}
+			logger.Info(fmt.Sprintf("Add to the map's info.json to generate it back:\n%s", snippet))
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return err
+	}
+	if err := os.WriteFile(*out, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	logger.Info(fmt.Sprintf("Wrote %s, %dx%d, decoded from %s", *out, f.Map.Width, f.Map.Height, f.Path))
+	return nil
+}
+
+// decodeGeneratorConfig returns the generator settings recorded in the
+// "generator" section of manifest m, which the map was generated with, or
+// the defaults for files read without a manifest.
+func decodeGeneratorConfig(m *mapformat.Manifest) (mapgen.GeneratorConfig, error) {
+	if m == nil || m.Fields["generator"] == nil {
+		return mapgen.DefaultGeneratorConfig(), nil
+	}
+	info, err := json.Marshal(map[string]json.RawMessage{"generator": m.Fields["generator"]})
+	if err != nil {
+		return mapgen.GeneratorConfig{}, err
+	}
+	config, err := mapgen.ParseGeneratorConfig(info)
+	if err != nil {
+		return mapgen.GeneratorConfig{}, fmt.Errorf("manifest: %w", err)
+	}
+	return config, nil
+}
+
+// decodeBodies labels the 4-connected bodies of the tiles for which in
+// returns true, as processWater finds water bodies and removeSmallIslands
+// landmasses, joined across the west/east seam of maps that wrap: numbered
+// in column-major scan order, then sorted from largest to smallest, ties
+// kept in scan order. It returns the body of every tile, -1 outside any,
+// and the size of every body.
+func decodeBodies(gm *mapformat.Map, wrapX bool, in func(mapformat.Tile) bool) (body []int, sizes []int) {
+	body = make([]int, len(gm.Tiles))
+	for i := range body {
+		body[i] = -1
+	}
+	var queue []int
+	for x := 0; x < gm.Width; x++ {
+		for y := 0; y < gm.Height; y++ {
+			if i := y*gm.Width + x; body[i] < 0 && in(gm.Tiles[i]) {
+				b := len(sizes)
+				body[i] = b
+				queue = append(queue[:0], i)
+				for head := 0; head < len(queue); head++ {
+					cx, cy := queue[head]%gm.Width, queue[head]/gm.Width
+					for _, n := range [4][2]int{{cx - 1, cy}, {cx + 1, cy}, {cx, cy - 1}, {cx, cy + 1}} {
+						if wrapX && gm.Width > 2 {
+							n[0] = (n[0] + gm.Width) % gm.Width
+						}
+						if j := n[1]*gm.Width + n[0]; gm.In(n[0], n[1]) && body[j] < 0 && in(gm.Tiles[j]) {
+							body[j] = b
+							queue = append(queue, j)
+						}
+					}
+				}
+				sizes = append(sizes, len(queue))
+			}
+		}
+	}
+	order := make([]int, len(sizes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return sizes[order[i]] > sizes[order[j]] })
+	rank := make([]int, len(sizes))
+	sorted := make([]int, len(sizes))
+	for r, b := range order {
+		rank[b], sorted[r] = r, sizes[b]
+	}
+	for i, b := range body {
+		if b >= 0 {
+			body[i] = rank[b]
+		}
+	}
+	return body, sorted
+}
+
+// decodeSourceImage returns the source image of a packed map generated with
+// config: pure black for the void, blue 106 for water and gray land whose
+// blue channel encodes its magnitude, 140 + 2 * magnitude. Generating the
+// image again gives back the same packed maps, provided the "generator"
+// entries of info.json it returns are added: the settings of config that
+// shape the terrain, wrap_x and the removal of small islands and lakes,
+// where they differ from the defaults, and the key and impassable colours.
+// Shorelines and water distances are recomputed from the land and water,
+// and water bodies whose packed ocean bit differs from the generator's
+// largest-body rule, or lakes small enough to be filled, get an ocean or
+// lake key colour, which notes reports. Islands smaller than
+// config.MinIslandSize, which only maps decoded without their manifest
+// hold, lower min_island_size to keep them.
+func decodeSourceImage(gm *mapformat.Map, config mapgen.GeneratorConfig) (img *image.NRGBA, generator map[string]any, notes []string) {
+	img = image.NewNRGBA(image.Rect(0, 0, gm.Width, gm.Height))
+	keyColors := make(map[string]string)
+	impassableColors := make(map[string]string)
+	hex := func(c [3]uint8) string { return fmt.Sprintf("#%02x%02x%02x", c[0], c[1], c[2]) }
+
+	water, waterSizes := decodeBodies(gm, config.WrapX, mapformat.Tile.IsWater)
+	keyed := 0
+	for i, t := range gm.Tiles {
+		c := color.NRGBA{A: 255}
+		switch b := water[i]; {
+		case t.IsImpassable():
+			if key, ok := decodeImpassableKey[t.ImpassableKind()]; ok {
+				c.R, c.G, c.B = key[0], key[1], key[2]
+				impassableColors[hex(key)] = mapgen.ImpassableKindNames[t.ImpassableKind()]
+			}
+		case t.IsLand():
+			c.R, c.G, c.B = decodeLandRedGreen, decodeLandRedGreen, 140+2*min(t.Magnitude(), 30)
+		case t.IsOcean() && b > 0:
+			c.R, c.G, c.B = decodeOceanKey[0], decodeOceanKey[1], decodeOceanKey[2]
+			keyColors[hex(decodeOceanKey)] = mapgen.KeyFeatureNames[mapgen.KeyOcean]
+			keyed++
+		case !t.IsOcean() && (b == 0 || config.RemoveSmall && waterSizes[b] < config.MinLakeSize):
+			c.R, c.G, c.B = decodeLakeKey[0], decodeLakeKey[1], decodeLakeKey[2]
+			keyColors[hex(decodeLakeKey)] = mapgen.KeyFeatureNames[mapgen.KeyLake]
+			keyed++
+		default:
+			c.B = mapgen.WaterKeyBlue
+		}
+		img.SetNRGBA(i%gm.Width, i/gm.Width, c)
+	}
+	if keyed > 0 {
+		notes = append(notes, fmt.Sprintf("%d water tile(s) are painted with key colours to keep their ocean or lake classification", keyed))
+	}
+
+	if _, landSizes := decodeBodies(gm, config.WrapX, mapformat.Tile.IsLand); config.RemoveSmall && len(landSizes) > 0 {
+		if smallest := landSizes[len(landSizes)-1]; smallest < config.MinIslandSize {
+			notes = append(notes, fmt.Sprintf("the smallest island has %d tile(s), below the minimum of %d: min_island_size is lowered to keep it", smallest, config.MinIslandSize))
+			config.MinIslandSize = smallest
+		}
+	}
+
+	generator = make(map[string]any)
+	defaults := mapgen.DefaultGeneratorConfig()
+	if config.WrapX {
+		generator["wrap_x"] = true
+	}
+	if config.RemoveSmall != defaults.RemoveSmall {
+		generator["remove_small"] = config.RemoveSmall
+	}
+	if config.MinIslandSize != defaults.MinIslandSize {
+		generator["min_island_size"] = config.MinIslandSize
+	}
+	if config.MinLakeSize != defaults.MinLakeSize {
+		generator["min_lake_size"] = config.MinLakeSize
+	}
+	if len(keyColors) > 0 {
+		generator["key_colors"] = keyColors
+	}
+	if len(impassableColors) > 0 {
+		generator["impassable_colors"] = impassableColors
+	}
+	return img, generator, notes
+}
+
+// decodeOverlay colours what each tile of a packed map holds: ocean in blue
+// and lakes in teal, both darker further from land, shoreline water in cyan
+// and shoreline land in yellow, land from green plains through brown
+// highland to white mountains, and impassable tiles in their thumbnail
+// colours.
+func decodeOverlay(gm *mapformat.Map) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, gm.Width, gm.Height))
+	for i, t := range gm.Tiles {
+		mag := int(t.Magnitude())
+		var c color.NRGBA
+		switch {
+		case t.IsImpassable():
+			tc := mapgen.ThumbnailColor(mapgen.Terrain{Type: mapgen.Impassable, Kind: t.ImpassableKind()})
+			c = color.NRGBA{R: tc.R, G: tc.G, B: tc.B, A: 255}
+		case t.IsShoreline() && t.IsLand():
+			c = color.NRGBA{R: 255, G: 220, A: 255}
+		case t.IsShoreline():
+			c = color.NRGBA{G: 255, B: 255, A: 255}
+		case t.IsLand() && mag < 10:
+			c = color.NRGBA{R: uint8(40 + 8*mag), G: uint8(160 - 4*mag), B: 40, A: 255}
+		case t.IsLand() && mag < 20:
+			c = color.NRGBA{R: uint8(140 + 4*(mag-10)), G: uint8(100 + 4*(mag-10)), B: 50, A: 255}
+		case t.IsLand():
+			v := uint8(200 + 5*min(mag-20, 10))
+			c = color.NRGBA{R: v, G: v, B: v, A: 255}
+		case t.IsOcean():
+			c = color.NRGBA{R: 20, G: uint8(110 - 3*mag), B: uint8(240 - 5*mag), A: 255}
+		default:
+			c = color.NRGBA{R: 20, G: uint8(180 - 4*mag), B: uint8(160 - 4*mag), A: 255}
+		}
+		img.SetNRGBA(i%gm.Width, i/gm.Width, c)
+	}
+	return img
+}
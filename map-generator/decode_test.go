@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image/png"
+	"io"
+	"log/slog"
+	"path"
+	"testing"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapformat"
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+// TestDecodeRoundTrip generates every embedded selftest fixture with the
+// default settings, with small islands and lakes kept and wrapping
+// horizontally (where the fixture is a multiple of 4 pixels wide), decodes its map.bin with the settings its manifest records,
+// and checks that generating the decoded image with the printed info.json
+// entries gives back every scale byte for byte.
+func TestDecodeRoundTrip(t *testing.T) {
+	names, err := selfTestFixtureNames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := mapgen.ContextWithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	variants := map[string]func(*mapgen.GeneratorConfig){
+		"default":     func(*mapgen.GeneratorConfig) {},
+		"keep small":  func(c *mapgen.GeneratorConfig) { c.RemoveSmall = false },
+		"wrap":        func(c *mapgen.GeneratorConfig) { c.WrapX = true },
+		"small lakes": func(c *mapgen.GeneratorConfig) { c.MinIslandSize, c.MinLakeSize = 10, 40 },
+	}
+	generate := func(t *testing.T, image []byte, generator any) mapgen.MapResult {
+		t.Helper()
+		info, err := json.Marshal(map[string]any{"generator": generator})
+		if err != nil {
+			t.Fatal(err)
+		}
+		config, err := mapgen.ParseGeneratorConfig(info)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := mapgen.GenerateMap(ctx, mapgen.GeneratorArgs{Name: "decoded", ImageBuffer: image, RemoveSmall: true, Info: info, Config: config})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+	for _, name := range names {
+		image, err := selfTestFixtures.ReadFile(path.Join(selfTestDir, name, "image.png"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for variant, apply := range variants {
+			t.Run(name+"/"+variant, func(t *testing.T) {
+				config := mapgen.DefaultGeneratorConfig()
+				apply(&config)
+				if config.WrapX {
+					src, err := png.DecodeConfig(bytes.NewReader(image))
+					if err != nil {
+						t.Fatal(err)
+					}
+					if src.Width%4 != 0 {
+						t.Skipf("%s is %d pixels wide, not a multiple of 4", name, src.Width)
+					}
+				}
+				want := generate(t, image, config)
+
+				manifest := map[string]any{"generator": config}
+				addGeneratedSections(manifest, config, want, mapgen.PlayerCounts{}, mapMetrics{})
+				buf, err := json.Marshal(manifest)
+				if err != nil {
+					t.Fatal(err)
+				}
+				m, err := mapformat.ParseManifest(buf)
+				if err != nil {
+					t.Fatal(err)
+				}
+				decodedConfig, err := decodeGeneratorConfig(m)
+				if err != nil {
+					t.Fatal(err)
+				}
+				gm, err := mapformat.DecodeFormat(want.Map.Data, want.Map.Width, want.Map.Height, m.TileFormat)
+				if err != nil {
+					t.Fatal(err)
+				}
+				img, generator, _ := decodeSourceImage(gm, decodedConfig)
+				var decoded bytes.Buffer
+				if err := png.Encode(&decoded, img); err != nil {
+					t.Fatal(err)
+				}
+
+				got := generate(t, decoded.Bytes(), generator)
+				for _, s := range []struct {
+					file      string
+					got, want mapgen.MapInfo
+				}{
+					{"map.bin", got.Map, want.Map},
+					{"map4x.bin", got.Map4x, want.Map4x},
+					{"map16x.bin", got.Map16x, want.Map16x},
+				} {
+					if !bytes.Equal(s.got.Data, s.want.Data) {
+						t.Errorf("%s differs after decoding with %v", s.file, generator)
+					}
+				}
+			})
+		}
+	}
+}
+
+// TestDecodeKeepsSmallIslands checks that an island the default settings
+// would remove, in a map decoded without its manifest, lowers
+// min_island_size to its size.
+func TestDecodeKeepsSmallIslands(t *testing.T) {
+	gm := &mapformat.Map{Width: 8, Height: 4, Tiles: make([]mapformat.Tile, 32)}
+	for _, i := range []int{9, 10, 17} {
+		gm.Tiles[i] = mapformat.LandBit
+	}
+	_, generator, notes := decodeSourceImage(gm, mapgen.DefaultGeneratorConfig())
+	if generator["min_island_size"] != 3 {
+		t.Errorf("generator is %v, want min_island_size 3", generator)
+	}
+	if len(notes) == 0 {
+		t.Error("no note about the lowered min_island_size")
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin
+
+package main
+
+// availableDiskSpace is not implemented on this platform; the preflight disk
+// space check is skipped.
+func availableDiskSpace(path string) (bytes uint64, ok bool) {
+	return 0, false
+}
@@ -0,0 +1,15 @@
+//go:build linux || darwin
+
+package main
+
+import "syscall"
+
+// availableDiskSpace returns the number of bytes available to unprivileged
+// users on the filesystem holding path. ok is false if it can't be determined.
+func availableDiskSpace(path string) (bytes uint64, ok bool) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, false
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), true
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"unsafe"
+
+	"github.com/chai2010/webp"
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+// doctorCheck is the result of one check of the doctor command.
+type doctorCheck struct {
+	Name   string
+	Status string // "ok", "warn" or "fail"
+	Detail string
+	Fix    string // what to do about a warning or failure
+}
+
+// doctorReport collects the checks of the doctor command.
+type doctorReport struct {
+	checks []doctorCheck
+}
+
+func (r *doctorReport) ok(name, format string, args ...any) {
+	r.checks = append(r.checks, doctorCheck{Name: name, Status: "ok", Detail: fmt.Sprintf(format, args...)})
+}
+
+func (r *doctorReport) warn(name, detail, fix string) {
+	r.checks = append(r.checks, doctorCheck{Name: name, Status: "warn", Detail: detail, Fix: fix})
+}
+
+func (r *doctorReport) fail(name, detail, fix string) {
+	r.checks = append(r.checks, doctorCheck{Name: name, Status: "fail", Detail: detail, Fix: fix})
+}
+
+// estimatePeakMemory returns a rough upper bound, in bytes, for the memory
+// generating a map of the given source pixel area takes: its decoded RGBA
+// image, its terrain grid, and the scratch grids of the passes, counted as
+// two more terrain grids.
+func estimatePeakMemory(area int) uint64 {
+	return uint64(area) * (4 + 3*uint64(unsafe.Sizeof(mapgen.Terrain{})))
+}
+
+// runDoctor implements the doctor command: it checks everything generation
+// depends on and prints a fix for every problem found, so that contributors
+// don't have to work back from an opaque failure of their first build.
+func runDoctor(args []string) error {
+	fset, logFlags := newCommandFlagSet("doctor")
+	workers := fset.Int("workers", 4, "number of maps the memory check assumes are processed concurrently, as with --workers")
+	fset.Parse(args)
+	setupLogging(*logFlags)
+
+	r := &doctorReport{}
+	discovered := doctorDirectories(r)
+	doctorWebP(r)
+	doctorBasisEncoder(r)
+	if discovered != nil {
+		doctorMemory(r, discovered, *workers)
+		doctorConfigs(r, discovered)
+	}
+
+	failed := 0
+	for _, c := range r.checks {
+		fmt.Printf("[%s] %s: %s\n", c.Status, c.Name, c.Detail)
+		if c.Fix != "" {
+			fmt.Printf("       fix: %s\n", c.Fix)
+		}
+		if c.Status == "fail" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d check(s) failed", failed)
+	}
+	fmt.Println("Everything generation depends on looks fine")
+	return nil
+}
+
+// doctorDirectories checks that the input directories resolve from the
+// working directory and that the output directories are writable. It
+// returns the discovered maps, or nil if the input directories are missing.
+func doctorDirectories(r *doctorReport) []mapEntry {
+	cwd, _ := os.Getwd()
+	fromRoot := "run the generator from the map-generator directory of the repository: cd map-generator && go run . doctor"
+	for _, isTest := range []bool{false, true} {
+		name := "input maps"
+		if isTest {
+			name = "input test maps"
+		}
+		dir, err := inputMapDir(isTest)
+		if err != nil {
+			r.fail(name, err.Error(), fromRoot)
+			return nil
+		}
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			r.fail(name, fmt.Sprintf("%s not found from the working directory %s", dir, cwd), fromRoot)
+			return nil
+		}
+		r.ok(name, "%s", dir)
+	}
+	discovered, err := discoverMaps()
+	if err != nil {
+		r.fail("input maps", err.Error(), fromRoot)
+		return nil
+	}
+
+	for _, isTest := range []bool{false, true} {
+		name := "output maps"
+		if isTest {
+			name = "output test maps"
+		}
+		dir, err := outputMapDir(isTest)
+		if err == nil {
+			err = checkWritableDir(dir)
+		}
+		if err != nil {
+			r.fail(name, err.Error(), "make the directory writable by your user, e.g. chown -R $USER "+filepath.Dir(dir))
+			continue
+		}
+		if available, ok := availableDiskSpace(dir); ok {
+			r.ok(name, "%s is writable, %s free", dir, formatBytes(available))
+		} else {
+			r.ok(name, "%s is writable", dir)
+		}
+	}
+	return discovered
+}
+
+// doctorWebP checks that the cgo WebP encoder writing the thumbnails works.
+// Builds without cgo don't get this far: they fail to compile the encoder.
+func doctorWebP(r *doctorReport) {
+	cgo := "unknown"
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			if s.Key == "CGO_ENABLED" {
+				cgo = s.Value
+			}
+		}
+	}
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	data, err := webp.EncodeRGBA(img, 45)
+	if err == nil {
+		_, err = webp.Decode(strings.NewReader(string(data)))
+	}
+	if err != nil {
+		r.fail("webp encoder", fmt.Sprintf("encoding a thumbnail failed (CGO_ENABLED=%s): %v", cgo, err),
+			"the WebP encoder is C code built with cgo: install a C compiler (gcc or clang, Xcode command line tools on macOS) and build with CGO_ENABLED=1")
+		return
+	}
+	r.ok("webp encoder", "thumbnails encode (CGO_ENABLED=%s, %s/%s)", cgo, runtime.GOOS, runtime.GOARCH)
+}
+
+// doctorBasisEncoder checks for the tool that encodes the KTX2 render
+// layers, which only those layers need.
+func doctorBasisEncoder(r *doctorReport) {
+	path, err := exec.LookPath(mapgen.BasisEncoder)
+	if err != nil {
+		r.warn("basis encoder", fmt.Sprintf("%s is not on PATH, so the render_light_mips and render_dark_mips layers can't be built", mapgen.BasisEncoder),
+			"install KTX-Software (https://github.com/KhronosGroup/KTX-Software/releases) and put its bin directory on PATH")
+		return
+	}
+	r.ok("basis encoder", "%s", path)
+}
+
+// doctorMemory compares the memory the largest maps take when processed
+// together with the memory available.
+func doctorMemory(r *doctorReport, discovered []mapEntry, workers int) {
+	type sized struct {
+		name string
+		peak uint64
+	}
+	var maps []sized
+	for _, m := range discovered {
+		maps = append(maps, sized{m.Name, estimatePeakMemory(sourceImageArea(m))})
+	}
+	if len(maps) == 0 {
+		r.warn("memory", "no maps found to size", "")
+		return
+	}
+	sort.Slice(maps, func(i, j int) bool { return maps[i].peak > maps[j].peak })
+	largest := maps[0]
+	var needed uint64
+	for _, m := range maps[:min(max(workers, 1), len(maps))] {
+		needed += m.peak
+	}
+	available, ok := availableMemory()
+	if !ok {
+		r.warn("memory", fmt.Sprintf("the largest map, %s, needs ~%s and %d worker(s) ~%s, but the available memory can't be determined on this platform", largest.name, formatBytes(largest.peak), workers, formatBytes(needed)), "")
+		return
+	}
+	detail := fmt.Sprintf("the largest map, %s, needs ~%s and %d worker(s) ~%s, %s available", largest.name, formatBytes(largest.peak), workers, formatBytes(needed), formatBytes(available))
+	switch {
+	case available < largest.peak:
+		r.fail("memory", detail, fmt.Sprintf("free memory or leave %s out with --maps", largest.name))
+	case available < needed:
+		fitting, total := 0, uint64(0)
+		for _, m := range maps {
+			if total+m.peak > available {
+				break
+			}
+			total += m.peak
+			fitting++
+		}
+		r.warn("memory", detail, fmt.Sprintf("run with --workers=%d", max(fitting, 1)))
+	default:
+		r.ok("memory", "%s", detail)
+	}
+}
+
+// doctorConfigs checks that the info.json and inputs of every map parse as
+// the generator reads them.
+func doctorConfigs(r *doctorReport, discovered []mapEntry) {
+	var invalid []string
+	missing := 0
+	for _, m := range discovered {
+		dir, err := inputMapDir(m.IsTest)
+		if err != nil {
+			continue
+		}
+		if err := checkMapInputs(filepath.Join(dir, m.Name)); err != nil {
+			invalid = append(invalid, fmt.Sprintf("%s: %v", m.Name, err))
+			continue
+		}
+		if sourceImageArea(m) == 0 && !hasHeightmap(filepath.Join(dir, m.Name)) {
+			missing++
+		}
+	}
+	if len(invalid) > 0 {
+		r.fail("map configs", fmt.Sprintf("%d of %d map(s) invalid:\n         %s", len(invalid), len(discovered), strings.Join(invalid, "\n         ")),
+			"fix the info.json and inputs named above; `go run . migrate` upgrades files of an older schema")
+		return
+	}
+	if missing > 0 {
+		r.warn("map configs", fmt.Sprintf("%d map(s) valid, %d of them without a readable image.png or cached remote source", len(discovered), missing),
+			"remote sources are downloaded on the first run; otherwise add the map's image.png")
+		return
+	}
+	r.ok("map configs", "%d map(s) valid", len(discovered))
+}
+
+// checkMapInputs reads a map's info.json and inputs the way processMap does,
+// without generating it.
+func checkMapInputs(mapInputDir string) error {
+	info, err := readInfoJSON(filepath.Join(mapInputDir, "info.json"))
+	if err != nil {
+		return err
+	}
+	info, _, err = migrateInfoBuffer(info)
+	if err != nil {
+		return err
+	}
+	if _, err := mapgen.ParseGeneratorConfig(info); err != nil {
+		return err
+	}
+	if _, err := parseRemoteSource(info); err != nil {
+		return fmt.Errorf("invalid remote source: %w", err)
+	}
+	inputs, err := readAuxInputs(mapInputDir)
+	if err != nil {
+		return err
+	}
+	_, err = mapgen.ParsePalette(inputs)
+	return err
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+const (
+	// defaultElevationTileURL serves Terrarium-encoded elevation tiles
+	// combining SRTM on land with ETOPO1 and GEBCO bathymetry at sea, from
+	// the public AWS open data registry.
+	defaultElevationTileURL = "https://s3.amazonaws.com/elevation-tiles-prod/terrarium/{z}/{x}/{y}.png"
+	// elevationTileSize is the side of an elevation tile in pixels.
+	elevationTileSize = 256
+	// maxElevationZoom is the highest zoom fetched; SRTM holds no more
+	// detail.
+	maxElevationZoom = 12
+	// maxElevationTiles bounds the tiles a single run fetches.
+	maxElevationTiles = 2048
+	// elevationFetchWorkers is the number of concurrent tile downloads.
+	elevationFetchWorkers = 8
+	// maxElevationTileSize bounds a single tile download.
+	maxElevationTileSize = 4 << 20
+)
+
+// elevationTile identifies a web mercator tile.
+type elevationTile struct {
+	Z, X, Y int
+}
+
+// elevationMosaic holds the decoded elevation, in metres, of the tiles
+// covering an area at one zoom level.
+type elevationMosaic struct {
+	Zoom  int
+	Tiles map[elevationTile][]float32
+}
+
+// decodeTerrarium decodes a Terrarium PNG tile, whose pixels encode the
+// elevation as R×256 + G + B/256 - 32768 metres.
+func decodeTerrarium(data []byte) ([]float32, error) {
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	b := img.Bounds()
+	if b.Dx() != elevationTileSize || b.Dy() != elevationTileSize {
+		return nil, fmt.Errorf("tile is %dx%d, expected %dx%d", b.Dx(), b.Dy(), elevationTileSize, elevationTileSize)
+	}
+	out := make([]float32, elevationTileSize*elevationTileSize)
+	for y := 0; y < elevationTileSize; y++ {
+		for x := 0; x < elevationTileSize; x++ {
+			c := color.NRGBAModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.NRGBA)
+			out[y*elevationTileSize+x] = float32(float64(c.R)*256 + float64(c.G) + float64(c.B)/256 - 32768)
+		}
+	}
+	return out, nil
+}
+
+// mercatorPixel returns the global web mercator pixel coordinates of a
+// longitude and latitude at a zoom level.
+func mercatorPixel(lon, lat float64, zoom int) (float64, float64) {
+	scale := float64(elevationTileSize) * math.Exp2(float64(zoom))
+	phi := lat * math.Pi / 180
+	x := (lon + 180) / 360 * scale
+	y := (1 - math.Log(math.Tan(phi)+1/math.Cos(phi))/math.Pi) / 2 * scale
+	return x, y
+}
+
+// At returns the elevation at global pixel coordinates, bilinearly
+// interpolated.
+func (m *elevationMosaic) At(px, py float64) float64 {
+	px, py = px-0.5, py-0.5
+	x0, y0 := math.Floor(px), math.Floor(py)
+	fx, fy := px-x0, py-y0
+	sample := func(x, y int) float64 {
+		tile := elevationTile{m.Zoom, x / elevationTileSize, y / elevationTileSize}
+		data, ok := m.Tiles[tile]
+		if !ok {
+			// Just outside the fetched area; use the nearest fetched tile.
+			for dx := -1; dx <= 1 && !ok; dx++ {
+				for dy := -1; dy <= 1 && !ok; dy++ {
+					data, ok = m.Tiles[elevationTile{m.Zoom, tile.X + dx, tile.Y + dy}]
+					if ok {
+						tile = elevationTile{m.Zoom, tile.X + dx, tile.Y + dy}
+					}
+				}
+			}
+			if !ok {
+				return 0
+			}
+		}
+		lx := min(max(x-tile.X*elevationTileSize, 0), elevationTileSize-1)
+		ly := min(max(y-tile.Y*elevationTileSize, 0), elevationTileSize-1)
+		return float64(data[ly*elevationTileSize+lx])
+	}
+	ix, iy := int(x0), int(y0)
+	top := sample(ix, iy)*(1-fx) + sample(ix+1, iy)*fx
+	bottom := sample(ix, iy+1)*(1-fx) + sample(ix+1, iy+1)*fx
+	return top*(1-fy) + bottom*fy
+}
+
+// fetchElevationTiles downloads the tiles covering a bounding box at a zoom
+// level, through a cache directory, and decodes them.
+func fetchElevationTiles(ctx context.Context, tileURL, cacheDir string, zoom int, minLon, minLat, maxLon, maxLat float64) (*elevationMosaic, error) {
+	logger := mapgen.LoggerFromContext(ctx)
+	x0, y0 := mercatorPixel(minLon, maxLat, zoom)
+	x1, y1 := mercatorPixel(maxLon, minLat, zoom)
+	n := 1 << zoom
+	tx0, ty0 := max(int(x0)/elevationTileSize, 0), max(int(y0)/elevationTileSize, 0)
+	tx1, ty1 := min(int(x1)/elevationTileSize, n-1), min(int(y1)/elevationTileSize, n-1)
+	count := (tx1 - tx0 + 1) * (ty1 - ty0 + 1)
+	if count > maxElevationTiles {
+		return nil, fmt.Errorf("the area needs %d tiles at zoom %d, at most %d are fetched; lower -width or -zoom", count, zoom, maxElevationTiles)
+	}
+	logger.Info(fmt.Sprintf("Fetching %d elevation tile(s) at zoom %d", count, zoom))
+
+	queue := make(chan elevationTile, count)
+	for ty := ty0; ty <= ty1; ty++ {
+		for tx := tx0; tx <= tx1; tx++ {
+			queue <- elevationTile{zoom, tx, ty}
+		}
+	}
+	close(queue)
+
+	mosaic := &elevationMosaic{Zoom: zoom, Tiles: make(map[elevationTile][]float32, count)}
+	var mu sync.Mutex
+	var firstErr error
+	var wg sync.WaitGroup
+	for w := 0; w < elevationFetchWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for tile := range queue {
+				data, err := fetchElevationTile(ctx, tileURL, cacheDir, tile)
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				if err == nil {
+					mosaic.Tiles[tile] = data
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return mosaic, nil
+}
+
+// fetchElevationTile returns the decoded elevation of a tile, downloading it
+// into cacheDir unless a copy is already there.
+func fetchElevationTile(ctx context.Context, tileURL, cacheDir string, tile elevationTile) ([]float32, error) {
+	path := filepath.Join(cacheDir, strconv.Itoa(tile.Z), strconv.Itoa(tile.X), strconv.Itoa(tile.Y)+".png")
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		url := strings.NewReplacer("{z}", strconv.Itoa(tile.Z), "{x}", strconv.Itoa(tile.X), "{y}", strconv.Itoa(tile.Y)).Replace(tileURL)
+		var buf bytes.Buffer
+		if _, err := fetchRemote(ctx, url, &buf, maxElevationTileSize, time.Minute); err != nil {
+			return nil, fmt.Errorf("tile %d/%d/%d: %w", tile.Z, tile.X, tile.Y, err)
+		}
+		data = buf.Bytes()
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, err
+		}
+		// Written to a temporary file first so that an interrupted run
+		// never leaves a truncated tile in the cache.
+		if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+			return nil, err
+		}
+		if err := os.Rename(path+".tmp", path); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	elevation, err := decodeTerrarium(data)
+	if err != nil {
+		return nil, fmt.Errorf("tile %d/%d/%d: %w", tile.Z, tile.X, tile.Y, err)
+	}
+	return elevation, nil
+}
+
+// elevationColor returns the source image colour of a land pixel: the blue
+// channel encodes the magnitude as described on GenerateMap, from 140 at sea
+// level to 200 at maxElevation and above. Red and green only make the image
+// readable, and stay close enough for the land to be temperate, see
+// classifyBiome.
+func elevationColor(elevation, maxElevation float64) color.NRGBA {
+	f := math.Max(0, math.Min(1, elevation/maxElevation))
+	blue := uint8(math.Round(140 + 60*f))
+	return color.NRGBA{R: uint8(math.Round(150 + 50*f)), G: uint8(math.Round(160 + 40*f)), B: blue, A: 255}
+}
+
+// bathymetryGray returns the bathymetry.png gray level of a water depth in
+// metres: brighter is shallower, following a square root so that the
+// continental shelf spans the upper part of the range.
+func bathymetryGray(depth, maxDepth float64) uint8 {
+	f := math.Sqrt(math.Max(0, math.Min(1, depth/maxDepth)))
+	return uint8(math.Round(255 * (1 - f)))
+}
+
+// runFetchElevation downloads real-world elevation for a bounding box and
+// writes a ready-to-use image.png, plus a bathymetry.png of the ocean depth,
+// into a map folder. The tiles are mosaicked and reprojected from web
+// mercator to the requested projection.
+func runFetchElevation(args []string) error {
+	fset, logFlags := newCommandFlagSet("fetch-elevation")
+	bbox := fset.String("bbox", "", "bounding box to fetch as min_lon,min_lat,max_lon,max_lat in degrees. ex: -bbox=5.5,43.5,11,48")
+	out := fset.String("out", ".", "map folder to write image.png and bathymetry.png to")
+	width := fset.Int("width", 2000, "width of the image in pixels, rounded down to a multiple of 4")
+	projection := fset.String("projection", "equirectangular", "projection of the image: equirectangular (scaled by the cosine of the central latitude), mercator or mollweide")
+	zoom := fset.Int("zoom", -1, "tile zoom level to fetch, 0-12; by default the lowest with at least the image's resolution")
+	seaLevel := fset.Float64("sea-level", 0, "elevation in metres at and under which terrain is water")
+	maxElevation := fset.Float64("max-elevation", 3000, "elevation in metres above sea level of the highest mountains (magnitude 30); 1000 m is then highland and 2000 m mountain")
+	maxDepth := fset.Float64("max-depth", 6000, "depth in metres below sea level of the darkest bathymetry")
+	tileURL := fset.String("tile-url", defaultElevationTileURL, "URL template of Terrarium-encoded elevation tiles, with {z}, {x} and {y}")
+	cacheDir := fset.String("cache", filepath.Join(filepath.Dir(defaultSourceCacheDir()), "elevation"), "directory where downloaded tiles are cached")
+	force := fset.Bool("force", false, "overwrite existing images in -out")
+	fset.Parse(args)
+	setupLogging(*logFlags)
+	logger := mapgen.LoggerFromContext(context.Background())
+
+	var box [4]float64
+	parts := strings.Split(*bbox, ",")
+	if len(parts) != 4 {
+		return fmt.Errorf("-bbox must be min_lon,min_lat,max_lon,max_lat")
+	}
+	for i, p := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return fmt.Errorf("-bbox: %w", err)
+		}
+		box[i] = v
+	}
+	geo := &mapgen.GeoReference{BBox: box, Projection: *projection}
+	if err := geo.Validate(); err != nil {
+		return fmt.Errorf("-bbox or -projection: %w", err)
+	}
+	minLon, minLat, maxLon, maxLat := box[0], box[1], box[2], box[3]
+	w := *width - *width%4
+	if w < 4 {
+		return fmt.Errorf("-width must be at least 4")
+	}
+	if *maxElevation <= 0 || *maxDepth <= 0 {
+		return fmt.Errorf("-max-elevation and -max-depth must be positive")
+	}
+
+	// Elevation tiles are web mercator, which ends short of the poles.
+	if minLat < -85 || maxLat > 85 {
+		return fmt.Errorf("-bbox latitudes must be within -85 and 85, the extent of the elevation tiles")
+	}
+	h := int(math.Round(float64(w) * geo.Aspect()))
+	h -= h % 4
+	if h < 4 {
+		return fmt.Errorf("the bounding box is too flat for a %d pixel wide image", w)
+	}
+	if area := w * h; area < mapgen.MinRecommendedPixelSize || area > mapgen.MaxRecommendedPixelSize {
+		logger.Warn(fmt.Sprintf("The image is %dx%d (%d pixels), outside the recommended %d - %d", w, h, area, mapgen.MinRecommendedPixelSize, mapgen.MaxRecommendedPixelSize))
+	}
+
+	z := *zoom
+	if z < 0 {
+		degreesPerPixel := (maxLon - minLon) / float64(w)
+		for z = 0; z < maxElevationZoom && 360/(elevationTileSize*math.Exp2(float64(z))) > degreesPerPixel; z++ {
+		}
+	}
+	if z > maxElevationZoom {
+		return fmt.Errorf("-zoom must be at most %d", maxElevationZoom)
+	}
+
+	imagePath := filepath.Join(*out, "image.png")
+	bathymetryPath := filepath.Join(*out, "bathymetry.png")
+	if !*force {
+		for _, path := range []string{imagePath, bathymetryPath} {
+			if _, err := os.Stat(path); err == nil {
+				return fmt.Errorf("%s already exists, use -force to overwrite it", path)
+			}
+		}
+	}
+
+	mosaic, err := fetchElevationTiles(context.Background(), *tileURL, *cacheDir, z, minLon, minLat, maxLon, maxLat)
+	if err != nil {
+		return err
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	bathymetry := image.NewGray(image.Rect(0, 0, w, h))
+	water := color.NRGBA{R: 70, G: 120, B: mapgen.WaterKeyBlue, A: 255}
+	landPixels := 0
+	for py := 0; py < h; py++ {
+		for px := 0; px < w; px++ {
+			lon, lat, ok := geo.Unproject(float64(px)+0.5, float64(py)+0.5, w, h)
+			if !ok {
+				// Outside the globe: impassable, see GenerateMap.
+				img.SetNRGBA(px, py, color.NRGBA{A: 255})
+				continue
+			}
+			mx, my := mercatorPixel(lon, lat, z)
+			elevation := mosaic.At(mx, my) - *seaLevel
+			if elevation > 0 {
+				img.SetNRGBA(px, py, elevationColor(elevation, *maxElevation))
+				bathymetry.SetGray(px, py, color.Gray{Y: 255})
+				landPixels++
+			} else {
+				img.SetNRGBA(px, py, water)
+				bathymetry.SetGray(px, py, color.Gray{Y: bathymetryGray(-elevation, *maxDepth)})
+			}
+		}
+	}
+
+	if err := os.MkdirAll(*out, 0755); err != nil {
+		return err
+	}
+	for _, f := range []struct {
+		Path  string
+		Image image.Image
+	}{{imagePath, img}, {bathymetryPath, bathymetry}} {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, f.Image); err != nil {
+			return err
+		}
+		if err := os.WriteFile(f.Path, buf.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+	logger.Info(fmt.Sprintf("Wrote %dx%d %s (%.0f%% land) and %s", w, h, imagePath, 100*float64(landPixels)/float64(w*h), bathymetryPath))
+	// Record where the image lies on the globe, for the manifest and the
+	// import commands.
+	infoPath := filepath.Join(*out, "info.json")
+	if _, err := os.Stat(infoPath); err == nil {
+		if err := writeInfoGeo(infoPath, geo); err != nil {
+			return fmt.Errorf("failed to update %s: %w", infoPath, err)
+		}
+		logger.Info(fmt.Sprintf("Set the \"geo\" section of %s", infoPath))
+	} else {
+		geoSection, err := json.Marshal(map[string]any{"geo": geo})
+		if err != nil {
+			return err
+		}
+		logger.Info(fmt.Sprintf("Add %s to the map's info.json to place it on the globe", geoSection))
+	}
+	return nil
+}
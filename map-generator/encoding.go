@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+// recommendationSizeTolerance is how much larger than the smallest encoding,
+// as a fraction, an encoding may be and still be recommended for decoding
+// faster.
+const recommendationSizeTolerance = 0.05
+
+// encodingResult is the benchmark of one encoding on one map's terrain.
+type encodingResult struct {
+	Name   string
+	Size   int
+	Encode time.Duration
+	Decode time.Duration
+}
+
+// benchmarkEncodings encodes and decodes files with every encoding, runs
+// times each, and returns the total sizes and the best times.
+func benchmarkEncodings(files [][]byte, runs int) ([]encodingResult, error) {
+	results := make([]encodingResult, 0, len(mapgen.TerrainEncodings))
+	for _, e := range mapgen.TerrainEncodings {
+		result := encodingResult{Name: e.Name}
+		for _, data := range files {
+			bestEncode, bestDecode := time.Duration(-1), time.Duration(-1)
+			var encoded []byte
+			for run := 0; run < runs; run++ {
+				start := time.Now()
+				out, err := e.Encode(data)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", e.Name, err)
+				}
+				if d := time.Since(start); bestEncode < 0 || d < bestEncode {
+					bestEncode = d
+				}
+				encoded = out
+
+				start = time.Now()
+				decoded, err := e.Decode(encoded)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", e.Name, err)
+				}
+				if d := time.Since(start); bestDecode < 0 || d < bestDecode {
+					bestDecode = d
+				}
+				if !bytes.Equal(decoded, data) {
+					return nil, fmt.Errorf("%s: decoded data differs from the input", e.Name)
+				}
+			}
+			result.Size += len(encoded)
+			result.Encode += bestEncode
+			result.Decode += bestDecode
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// recommendEncoding returns the encoding clients should use: of the
+// encodings within recommendationSizeTolerance of the smallest size, the one
+// that decodes fastest, since every player decodes the map while it is only
+// encoded once per build.
+func recommendEncoding(results []encodingResult) string {
+	smallest := results[0].Size
+	for _, r := range results {
+		smallest = min(smallest, r.Size)
+	}
+	best := -1
+	for i, r := range results {
+		if float64(r.Size) > float64(smallest)*(1+recommendationSizeTolerance) {
+			continue
+		}
+		if best < 0 || r.Decode < results[best].Decode {
+			best = i
+		}
+	}
+	return results[best].Name
+}
+
+// runEncodings benchmarks every terrain encoding on the generated map.bin,
+// map4x.bin and map16x.bin of each map (or those selected with -maps),
+// reports sizes and encode/decode times, and recommends one encoding per
+// map. With -write the recommendation is stored as "generator.encoding" in
+// the map's info.json.
+func runEncodings(args []string) error {
+	fset, logFlags := newCommandFlagSet("encodings")
+	fset.StringVar(&mapsFlag, "maps", "", "optional comma-separated list of maps to benchmark")
+	runs := fset.Int("runs", 3, "number of times to run each encoding; the fastest run is reported")
+	write := fset.Bool("write", false, "write each map's recommended encoding into its info.json \"generator\" section")
+	fset.Parse(args)
+	setupLogging(*logFlags)
+	logger := mapgen.LoggerFromContext(context.Background())
+	if *runs < 1 {
+		return fmt.Errorf("-runs must be >= 1, got %d", *runs)
+	}
+
+	discovered, err := discoverMaps()
+	if err != nil {
+		return err
+	}
+	maps = discovered
+	selected, err := parseMapsFlag()
+	if err != nil {
+		return err
+	}
+
+	recommended := make(map[string]int)
+	var manual []string
+	for _, m := range maps {
+		if selected != nil && !selected[m.Name] {
+			continue
+		}
+		outDir, err := outputMapDir(m.IsTest)
+		if err != nil {
+			return err
+		}
+		var files [][]byte
+		for _, f := range mapScaleFiles {
+			data, err := os.ReadFile(filepath.Join(outDir, m.Name, f.File))
+			if err != nil {
+				return fmt.Errorf("map %s: %w (generate the map first)", m.Name, err)
+			}
+			files = append(files, data)
+		}
+		results, err := benchmarkEncodings(files, *runs)
+		if err != nil {
+			return fmt.Errorf("map %s: %w", m.Name, err)
+		}
+		choice := recommendEncoding(results)
+		recommended[choice]++
+
+		var report strings.Builder
+		fmt.Fprintf(&report, "%s:\n", m.Name)
+		raw := results[0].Size
+		for _, r := range results {
+			marker := ""
+			if r.Name == choice {
+				marker = " <- recommended"
+			}
+			fmt.Fprintf(&report, "  %-13s %10d bytes (%5.1f%%)  encode %10s  decode %10s%s\n", r.Name, r.Size, 100*float64(r.Size)/float64(raw), r.Encode.Round(time.Microsecond), r.Decode.Round(time.Microsecond), marker)
+		}
+		logger.Info(strings.TrimSuffix(report.String(), "\n"))
+
+		if *write {
+			inDir, err := inputMapDir(m.IsTest)
+			if err != nil {
+				return err
+			}
+			path := filepath.Join(inDir, m.Name, "info.json")
+			err = writeInfoEncoding(path, choice)
+			if errors.Is(err, errJSON5Rewrite) {
+				logger.Warn(fmt.Sprintf("%s uses JSON5 syntax that rewriting it would drop; set \"generator.encoding\" to %q by hand", path, choice))
+				manual = append(manual, path)
+			} else if err != nil {
+				return fmt.Errorf("map %s: %w", m.Name, err)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(recommended))
+	for name := range recommended {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		logger.Info(fmt.Sprintf("%s recommended for %d map(s)", name, recommended[name]))
+	}
+	if len(manual) > 0 {
+		return fmt.Errorf("%d info.json file(s) use JSON5 syntax and need \"generator.encoding\" set by hand: %s", len(manual), strings.Join(manual, ", "))
+	}
+	return nil
+}
+
+// writeInfoEncoding sets "generator.encoding" in an info.json file, keeping
+// the order of its other fields. Files in JSON5 are left alone with
+// errJSON5Rewrite.
+func writeInfoEncoding(path, encoding string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if !json.Valid(raw) {
+		return errJSON5Rewrite
+	}
+	doc, err := decodeJSONObject(raw)
+	if err != nil {
+		return err
+	}
+	generator := newJSONObject()
+	if existing, ok := doc.Get("generator"); ok {
+		obj, ok := existing.(*jsonObject)
+		if !ok {
+			return fmt.Errorf("\"generator\" must be an object")
+		}
+		generator = obj
+	}
+	generator.Set("encoding", encoding)
+	doc.Set("generator", generator)
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(out, '\n'), 0644)
+}
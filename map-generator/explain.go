@@ -0,0 +1,9 @@
+package main
+
+// explainFlag is the full-scale pixel, as "x,y", whose classification and
+// changes every processed map logs, or "" for none: the source pixel and
+// the rule that classified it, the size of the island or water body it ends
+// up in and whether that was removed, every pass that changes it and the
+// tile written to each packed scale, see mapgen.NewTileExplainer. Unchanged
+// maps are skipped, so it is used with --maps and --force.
+var explainFlag string
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	flatbuffers "github.com/google/flatbuffers/go"
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/containerfb"
+)
+
+// encodeFlatContainer builds c as a MapContainer buffer of
+// map_container.fbs, with its file identifier. The builder writes back to
+// front, so every table's strings and vectors come first.
+func encodeFlatContainer(c *mapContainer) ([]byte, error) {
+	b := flatbuffers.NewBuilder(flatContainerSize(c))
+	tables := func(offsets []flatbuffers.UOffsetT, start func(*flatbuffers.Builder, int) flatbuffers.UOffsetT) flatbuffers.UOffsetT {
+		start(b, len(offsets))
+		for i := len(offsets) - 1; i >= 0; i-- {
+			b.PrependUOffsetT(offsets[i])
+		}
+		return b.EndVector(len(offsets))
+	}
+
+	scales := make([]flatbuffers.UOffsetT, len(c.Scales))
+	for i, s := range c.Scales {
+		file, section, data := b.CreateString(s.File), b.CreateString(s.Section), b.CreateByteVector(s.Data)
+		containerfb.ScaleStart(b)
+		containerfb.ScaleAddFile(b, file)
+		containerfb.ScaleAddSection(b, section)
+		containerfb.ScaleAddWidth(b, s.Width)
+		containerfb.ScaleAddHeight(b, s.Height)
+		containerfb.ScaleAddNumLandTiles(b, s.NumLandTiles)
+		containerfb.ScaleAddData(b, data)
+		scales[i] = containerfb.ScaleEnd(b)
+	}
+	layers := make([]flatbuffers.UOffsetT, len(c.Layers))
+	for i, l := range c.Layers {
+		name, file, meta, data := b.CreateString(l.Name), b.CreateString(l.File), b.CreateString(l.MetaJSON), b.CreateByteVector(l.Data)
+		containerfb.LayerStart(b)
+		containerfb.LayerAddName(b, name)
+		containerfb.LayerAddFile(b, file)
+		containerfb.LayerAddMetaJson(b, meta)
+		containerfb.LayerAddData(b, data)
+		layers[i] = containerfb.LayerEnd(b)
+	}
+	manifest, thumbnail := b.CreateString(c.ManifestJSON), b.CreateByteVector(c.Thumbnail)
+	scalesVector := tables(scales, containerfb.MapContainerStartScalesVector)
+	layersVector := tables(layers, containerfb.MapContainerStartLayersVector)
+
+	containerfb.MapContainerStart(b)
+	containerfb.MapContainerAddSchemaVersion(b, c.SchemaVersion)
+	containerfb.MapContainerAddGeneratorVersion(b, c.GeneratorVersion)
+	containerfb.MapContainerAddManifestJson(b, manifest)
+	containerfb.MapContainerAddScales(b, scalesVector)
+	containerfb.MapContainerAddThumbnail(b, thumbnail)
+	containerfb.MapContainerAddLayers(b, layersVector)
+	containerfb.FinishMapContainerBuffer(b, containerfb.MapContainerEnd(b))
+	return b.FinishedBytes(), nil
+}
+
+// flatContainerSize returns the size of the data of c, to start the
+// builder at about the size of the buffer rather than grow it repeatedly.
+func flatContainerSize(c *mapContainer) int {
+	n := len(c.ManifestJSON) + len(c.Thumbnail) + 1024
+	for _, s := range c.Scales {
+		n += len(s.Data) + 128
+	}
+	for _, l := range c.Layers {
+		n += len(l.Data) + len(l.MetaJSON) + 128
+	}
+	return n
+}
+
+// decodeFlatContainer reads a MapContainer buffer. Data fields share the
+// buffer rather than copying it. The generated accessors panic on out of
+// bounds offsets, which are returned as errors.
+func decodeFlatContainer(data []byte) (c *mapContainer, err error) {
+	if len(data) < 8 || !containerfb.MapContainerBufferHasIdentifier(data) {
+		return nil, errors.New("invalid container: missing file identifier")
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			c, err = nil, fmt.Errorf("invalid container: %v", r)
+		}
+	}()
+	root := containerfb.GetRootAsMapContainer(data, 0)
+	c = &mapContainer{
+		SchemaVersion:    root.SchemaVersion(),
+		GeneratorVersion: root.GeneratorVersion(),
+		ManifestJSON:     string(root.ManifestJson()),
+		Thumbnail:        root.ThumbnailBytes(),
+	}
+	var s containerfb.Scale
+	for i := 0; i < root.ScalesLength(); i++ {
+		root.Scales(&s, i)
+		c.Scales = append(c.Scales, containerScale{
+			File:         string(s.File()),
+			Section:      string(s.Section()),
+			Width:        s.Width(),
+			Height:       s.Height(),
+			NumLandTiles: s.NumLandTiles(),
+			Data:         s.DataBytes(),
+		})
+	}
+	var l containerfb.Layer
+	for i := 0; i < root.LayersLength(); i++ {
+		root.Layers(&l, i)
+		c.Layers = append(c.Layers, containerLayer{
+			Name:     string(l.Name()),
+			File:     string(l.File()),
+			MetaJSON: string(l.MetaJson()),
+			Data:     l.DataBytes(),
+		})
+	}
+	return c, nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	flatbuffers "github.com/google/flatbuffers/go"
+)
+
+// flatSchemaTables returns the field slots of the tables of
+// map_container.fbs, by table and field name.
+func flatSchemaTables(t *testing.T) map[string]map[string]int {
+	t.Helper()
+	schema, err := os.ReadFile("map_container.fbs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fieldRe := regexp.MustCompile(`^\s*(\w+)\s*:`)
+	tables := map[string]map[string]int{}
+	for _, m := range regexp.MustCompile(`(?s)table (\w+) \{(.*?)\}`).FindAllStringSubmatch(string(schema), -1) {
+		fields := map[string]int{}
+		for _, line := range strings.Split(m[2], "\n") {
+			if f := fieldRe.FindStringSubmatch(line); f != nil {
+				fields[f[1]] = len(fields)
+			}
+		}
+		tables[m[1]] = fields
+	}
+	return tables
+}
+
+// TestFlatContainerSchema checks that encodeFlatContainer lays out
+// map_container.fbs, reading its output with the FlatBuffers runtime at
+// the field slots of the schema, and that decodeFlatContainer reads it back.
+func TestFlatContainerSchema(t *testing.T) {
+	tables := flatSchemaTables(t)
+	slot := func(table, field string) int {
+		i, ok := tables[table][field]
+		if !ok {
+			t.Fatalf("map_container.fbs has no field %s.%s", table, field)
+		}
+		return i
+	}
+	c := testContainer()
+	data, err := encodeFlatContainer(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := decodeFlatContainer(data)
+	if err != nil {
+		t.Fatalf("decodeFlatContainer: %v", err)
+	}
+	if !reflect.DeepEqual(got, c) {
+		t.Errorf("decodeFlatContainer reads %+v, want %+v", got, c)
+	}
+	if _, err := decodeFlatContainer(data[:len(data)/2]); err == nil {
+		t.Error("decodeFlatContainer accepts a truncated container")
+	}
+
+	if !flatbuffers.BufferHasIdentifier(data, "OFMC") {
+		t.Fatal("container lacks its file identifier")
+	}
+	field := func(tab *flatbuffers.Table, table, name string) flatbuffers.UOffsetT {
+		o := flatbuffers.UOffsetT(tab.Offset(flatbuffers.VOffsetT(4 + 2*slot(table, name))))
+		if o == 0 {
+			t.Fatalf("container lacks %s.%s", table, name)
+		}
+		return o
+	}
+	str := func(tab *flatbuffers.Table, table, name string) string {
+		return string(tab.ByteVector(field(tab, table, name) + tab.Pos))
+	}
+	bytesField := func(tab *flatbuffers.Table, table, name string) []byte {
+		return tab.ByteVector(field(tab, table, name) + tab.Pos)
+	}
+	u32 := func(tab *flatbuffers.Table, table, name string) uint32 {
+		return tab.GetUint32(field(tab, table, name) + tab.Pos)
+	}
+	elems := func(tab *flatbuffers.Table, table, name string) []*flatbuffers.Table {
+		o := field(tab, table, name)
+		var out []*flatbuffers.Table
+		for i, start := 0, tab.Vector(o); i < tab.VectorLen(o); i++ {
+			pos := start + flatbuffers.UOffsetT(4*i)
+			out = append(out, &flatbuffers.Table{Bytes: tab.Bytes, Pos: tab.Indirect(pos)})
+		}
+		return out
+	}
+	root := &flatbuffers.Table{Bytes: data, Pos: flatbuffers.GetUOffsetT(data)}
+	read := &mapContainer{
+		SchemaVersion:    u32(root, "MapContainer", "schema_version"),
+		GeneratorVersion: u32(root, "MapContainer", "generator_version"),
+		ManifestJSON:     str(root, "MapContainer", "manifest_json"),
+		Thumbnail:        bytesField(root, "MapContainer", "thumbnail"),
+	}
+	for _, s := range elems(root, "MapContainer", "scales") {
+		read.Scales = append(read.Scales, containerScale{
+			File:         str(s, "Scale", "file"),
+			Section:      str(s, "Scale", "section"),
+			Width:        u32(s, "Scale", "width"),
+			Height:       u32(s, "Scale", "height"),
+			NumLandTiles: u32(s, "Scale", "num_land_tiles"),
+			Data:         bytesField(s, "Scale", "data"),
+		})
+	}
+	for _, l := range elems(root, "MapContainer", "layers") {
+		read.Layers = append(read.Layers, containerLayer{
+			Name:     str(l, "Layer", "name"),
+			File:     str(l, "Layer", "file"),
+			MetaJSON: str(l, "Layer", "meta_json"),
+			Data:     bytesField(l, "Layer", "data"),
+		})
+	}
+	if !reflect.DeepEqual(read, c) {
+		t.Errorf("FlatBuffers runtime reads %+v, want %+v", read, c)
+	}
+	// Strings are null-terminated, as the runtime's readers expect.
+	manifestEnd := bytes.Index(data, []byte(c.ManifestJSON)) + len(c.ManifestJSON)
+	if data[manifestEnd] != 0 {
+		t.Error("manifest_json is not null-terminated")
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapformat"
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+// checkQualityGates checks a generated map against its quality gates, before
+// its outputs are written, so that a failed map keeps its previous build,
+// which the next run then compares with. mapDir holds the previous build, if
+// any, or is "" for maps without one, such as uploads. It returns an error
+// listing every gate the map fails.
+func checkQualityGates(ctx context.Context, gates *mapgen.QualityGates, mapDir string, result mapgen.MapResult) error {
+	if gates == nil {
+		return nil
+	}
+	var failed []string
+	stats := result.Stats
+	if g := gates.MaxRemovedIslands; g != nil && stats.RemovedIslands > *g {
+		failed = append(failed, fmt.Sprintf("%d small island(s) removed, over max_removed_islands (%d)", stats.RemovedIslands, *g))
+	}
+	if g := gates.MaxRemovedLakes; g != nil && stats.RemovedLakes > *g {
+		failed = append(failed, fmt.Sprintf("%d small lake(s) removed, over max_removed_lakes (%d)", stats.RemovedLakes, *g))
+	}
+	if g := gates.MaxLandChange; g != nil && mapDir != "" {
+		share := 100 * float64(result.Map.NumLandTiles) / float64(result.Map.Width*result.Map.Height)
+		previous, err := mapformat.ReadManifest(mapDir)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			mapgen.LoggerFromContext(ctx).Debug("No previous build to compare the land share with")
+		case err != nil:
+			return fmt.Errorf("failed to read the previous manifest to compare the land share with: %w", err)
+		default:
+			prev := previous.Map
+			prevShare := 100 * float64(prev.NumLandTiles) / float64(prev.Width*prev.Height)
+			if change := share - prevShare; change > *g || -change > *g {
+				failed = append(failed, fmt.Sprintf("land share changed from %.2f%% to %.2f%% of tiles since the previous build, more than max_land_change (%g points)", prevShare, share, *g))
+			}
+		}
+	}
+	if gates.RequireOcean {
+		ocean := false
+		for _, b := range result.Map.Data {
+			if t := mapformat.Tile(b); t.IsWater() && t.IsOcean() {
+				ocean = true
+				break
+			}
+		}
+		if !ocean {
+			failed = append(failed, "no ocean tiles, and require_ocean is set")
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("quality gates failed: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
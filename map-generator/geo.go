@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+// writeInfoGeo sets the "geo" section of an info.json file, keeping the order
+// of its other fields.
+func writeInfoGeo(path string, geo *mapgen.GeoReference) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	buf, err := normalizeJSON5(raw)
+	if err != nil {
+		return err
+	}
+	doc, err := decodeJSONObject(buf)
+	if err != nil {
+		return err
+	}
+	doc.Set("geo", geo)
+	if strings.Contains(string(raw), "//") || strings.Contains(string(raw), "/*") {
+		mapgen.LoggerFromContext(context.Background()).Warn(fmt.Sprintf("%s may contain JSON5 comments, which are not preserved", path))
+	}
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(out, '\n'), 0644)
+}
+
+// geoMapDir returns the input folder of the named map and its "geo" section,
+// for the commands that import real-world data into it.
+func geoMapDir(name string) (string, *mapgen.GeoReference, error) {
+	mapDir, err := findMapInputDir(name)
+	if err != nil {
+		return "", nil, err
+	}
+	info, err := readInfoJSON(filepath.Join(mapDir, "info.json"))
+	if err != nil {
+		return "", nil, err
+	}
+	geo, err := mapgen.ParseGeoReference(info)
+	if err != nil {
+		return "", nil, err
+	}
+	if geo == nil {
+		return "", nil, fmt.Errorf("%s has no \"geo\" section in its info.json to place it on the globe", name)
+	}
+	return mapDir, geo, nil
+}
@@ -1,4 +1,17 @@
 module github.com/openfrontio/OpenFrontIO/map-generator
+
 go 1.24.4
 
 require github.com/chai2010/webp v1.4.0
+
+require github.com/klauspost/compress v1.18.0
+
+require github.com/andybalholm/brotli v1.1.1
+
+require (
+	github.com/bufbuild/protocompile v0.14.1
+	github.com/google/flatbuffers v25.2.10+incompatible
+	google.golang.org/protobuf v1.36.11
+)
+
+require golang.org/x/sync v0.8.0 // indirect
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+// hasHeightmap reports whether a map folder has one of mapgen.HeightmapFiles.
+func hasHeightmap(mapInputDir string) bool {
+	for _, name := range mapgen.HeightmapFiles {
+		if _, err := os.Stat(filepath.Join(mapInputDir, name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
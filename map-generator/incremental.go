@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapformat"
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+// sourceHash returns a hex SHA-256 digest identifying a map's inputs. Each
+// part is length-prefixed so that moving bytes from one input to another
+// always changes the hash.
+func sourceHash(parts ...[]byte) string {
+	h := sha256.New()
+	var size [8]byte
+	for _, part := range parts {
+		binary.LittleEndian.PutUint64(size[:], uint64(len(part)))
+		h.Write(size[:])
+		h.Write(part)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// outputsUpToDate reports whether mapDir already holds outputs generated from
+// sources with the given hash by the current mapgen.GeneratorVersion, with exactly
+// the requested auxiliary layers and tile format, and those outputs still
+// pass verifyMapDir.
+// Any missing, unreadable or stale manifest means the map has to be
+// regenerated.
+func outputsUpToDate(mapDir, hash string, layers []string, format mapformat.TileFormat) bool {
+	buf, err := os.ReadFile(filepath.Join(mapDir, "manifest.json"))
+	if err != nil {
+		return false
+	}
+	var recorded struct {
+		SourceHash       string                           `json:"source_hash"`
+		GeneratorVersion int                              `json:"generator_version"`
+		Layers           map[string]struct{ File string } `json:"layers"`
+		TileFormat       mapformat.TileFormat             `json:"tile_format"`
+	}
+	if err := json.Unmarshal(buf, &recorded); err != nil {
+		return false
+	}
+	if recorded.SourceHash != hash || recorded.GeneratorVersion != mapgen.GeneratorVersion {
+		return false
+	}
+	if recorded.TileFormat == 0 {
+		recorded.TileFormat = mapformat.TileFormat1
+	}
+	if recorded.TileFormat != format {
+		return false
+	}
+	if !recordedLayersMatch(recorded.Layers, layers) {
+		return false
+	}
+	return verifyMapDir(mapDir) == nil
+}
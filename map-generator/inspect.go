@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapformat"
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+// runInspect implements the inspect command: it prints what a packed map
+// file holds, for investigating reports of maps that look wrong.
+func runInspect(args []string) error {
+	fs, logFlags := newCommandFlagSet("inspect")
+	size := fs.String("size", "", "dimensions of the file as WIDTHxHEIGHT, for files without a manifest.json next to them")
+	columns := fs.Int("columns", 80, "width of the ASCII rendering in characters, 0 to leave it out")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s inspect [flags] path/to/map.bin\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	setupLogging(*logFlags)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("inspect takes the path of one packed map file")
+	}
+	f, err := readPackedMapFile(fs.Arg(0), *size)
+	if err != nil {
+		return err
+	}
+	gm, manifest, dims, section := f.Map, f.Manifest, f.Dims, f.Section
+
+	w := os.Stdout
+	fmt.Fprintf(w, "File:        %s (%d bytes)\n", f.Path, len(gm.Tiles))
+	if manifest != nil {
+		fmt.Fprintf(w, "Manifest:    %s, schema_version %d, tile_format %d, generator_version %d, source_hash %.12s\n", manifest.ID, manifest.SchemaVersion, manifest.TileFormat, manifest.GeneratorVersion, manifest.SourceHash)
+		fmt.Fprintf(w, "Dimensions:  %dx%d (manifest section %q)\n", gm.Width, gm.Height, section)
+	} else {
+		fmt.Fprintf(w, "Dimensions:  %dx%d\n", gm.Width, gm.Height)
+	}
+	writeInspectStats(w, gm, manifest, dims)
+	if *columns > 0 {
+		fmt.Fprintln(w)
+		writeInspectRendering(w, gm, *columns)
+	}
+	return nil
+}
+
+// packedMapFile is a packed map file read by readPackedMapFile.
+type packedMapFile struct {
+	Path     string
+	Map      *mapformat.Map
+	Manifest *mapformat.Manifest // nil when read with an explicit size
+	Dims     mapformat.Dimensions
+	Section  string // the manifest section of the file, with Manifest
+}
+
+// readPackedMapFile reads the packed map file at path, or the map.bin of the
+// map directory at path, with the dimensions recorded in the manifest.json
+// next to it, or of size, as WIDTHxHEIGHT, if set. Files read with a size
+// have no manifest to record their tile format and are read as the
+// generator's default, mapformat.TileFormat1.
+func readPackedMapFile(path, size string) (*packedMapFile, error) {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		path = filepath.Join(path, mapformat.Scale1x.File())
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f := &packedMapFile{Path: path}
+	if size != "" {
+		if _, err := fmt.Sscanf(size, "%dx%d", &f.Dims.Width, &f.Dims.Height); err != nil {
+			return nil, fmt.Errorf("-size must be WIDTHxHEIGHT, got %q", size)
+		}
+	} else {
+		f.Manifest, err = mapformat.ReadManifest(filepath.Dir(path))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the manifest next to %s, pass -size for files without one: %w", path, err)
+		}
+		for _, s := range mapformat.Scales {
+			if s.File() == filepath.Base(path) {
+				f.Dims, f.Section = f.Manifest.Dimensions(s), s.Section()
+			}
+		}
+		if f.Section == "" {
+			return nil, fmt.Errorf("%s is not one of the packed map files of the manifest, pass -size to read it", filepath.Base(path))
+		}
+	}
+	format := mapformat.TileFormat1
+	if f.Manifest != nil {
+		format = f.Manifest.TileFormat
+	}
+	if f.Map, err = mapformat.DecodeFormat(data, f.Dims.Width, f.Dims.Height, format); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// writeInspectStats writes the tile counts of a map, by class and by packed
+// bit, and its magnitude ranges.
+func writeInspectStats(w io.Writer, gm *mapformat.Map, manifest *mapformat.Manifest, dims mapformat.Dimensions) {
+	total := len(gm.Tiles)
+	var classes [8]int
+	var landBits, shorelineBits, oceanBits int
+	var shoreline [2]int // land, water
+	rivers := 0
+	var magnitudes [2]struct{ Min, Max, Sum, Count int }
+	for _, t := range gm.Tiles {
+		classes[mapgen.TileClass(t)]++
+		if t&mapformat.LandBit != 0 {
+			landBits++
+		}
+		if t&mapformat.ShorelineBit != 0 {
+			shorelineBits++
+		}
+		if t&mapformat.OceanBit != 0 {
+			oceanBits++
+		}
+		if t.IsImpassable() {
+			continue
+		}
+		kind := 0
+		if t.IsWater() {
+			kind = 1
+		}
+		if t.IsShoreline() {
+			shoreline[kind]++
+		}
+		if t.IsRiver() {
+			rivers++
+		}
+		m := &magnitudes[kind]
+		mag := int(t.Magnitude())
+		if m.Count == 0 || mag < m.Min {
+			m.Min = mag
+		}
+		m.Max = max(m.Max, mag)
+		m.Sum += mag
+		m.Count++
+	}
+	share := func(n int) string {
+		return fmt.Sprintf("%d (%.1f%%)", n, 100*float64(n)/float64(total))
+	}
+
+	land := classes[2] + classes[3] + classes[4]
+	fmt.Fprintf(w, "Tiles:       %d\n", total)
+	fmt.Fprintf(w, "Land:        %s: plains %d, highland %d, mountain %d\n", share(land), classes[2], classes[3], classes[4])
+	if manifest != nil && land != dims.NumLandTiles {
+		fmt.Fprintf(w, "             manifest records %d land tiles\n", dims.NumLandTiles)
+	}
+	fmt.Fprintf(w, "Water:       %s: ocean %d, lake %d, river %d\n", share(classes[0]+classes[1]), classes[0], classes[1], rivers)
+	fmt.Fprintf(w, "Impassable:  %s: void %d, ice %d, lava %d\n", share(classes[5]+classes[6]+classes[7]), classes[5], classes[6], classes[7])
+	fmt.Fprintf(w, "Shoreline:   land %d, water %d\n", shoreline[0], shoreline[1])
+	for kind, name := range []string{"land", "water"} {
+		if m := magnitudes[kind]; m.Count > 0 {
+			fmt.Fprintf(w, "Magnitude:   %s %d-%d, mean %.1f\n", name, m.Min, m.Max, float64(m.Sum)/float64(m.Count))
+		}
+	}
+	fmt.Fprintf(w, "Bits set:    land %s, shoreline %s, ocean %s\n", share(landBits), share(shorelineBits), share(oceanBits))
+}
+
+// writeInspectRendering draws a map in ASCII, columns characters wide. Each
+// character covers a block of tiles twice as tall as it is wide, as terminal
+// characters are, and shows the most common class in it.
+func writeInspectRendering(w io.Writer, gm *mapformat.Map, columns int) {
+	columns = min(columns, gm.Width)
+	rows := max(1, gm.Height*columns/gm.Width/2)
+	line := make([]byte, columns)
+	for row := 0; row < rows; row++ {
+		y0, y1 := row*gm.Height/rows, (row+1)*gm.Height/rows
+		for col := 0; col < columns; col++ {
+			x0, x1 := col*gm.Width/columns, (col+1)*gm.Width/columns
+			var counts [8]int
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					counts[mapgen.TileClass(gm.At(x, y))]++
+				}
+			}
+			best := 0
+			for c := range counts {
+				if counts[c] > counts[best] {
+					best = c
+				}
+			}
+			line[col] = mapgen.TileClasses[best].Char
+		}
+		fmt.Fprintf(w, "|%s|\n", line)
+	}
+	legend := make([]string, len(mapgen.TileClasses))
+	for i, c := range mapgen.TileClasses {
+		legend[i] = fmt.Sprintf("'%c' %s", c.Char, c.Name)
+	}
+	fmt.Fprintf(w, "Legend: %s\n", strings.Join(legend, ", "))
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// canonicalJSON returns v, a JSON value as decoded by encoding/json with
+// UseNumber, in the JSON Canonicalization Scheme (RFC 8785): no whitespace,
+// object keys sorted by their UTF-16 code units, strings escaping only
+// quotes, backslashes and control characters, and numbers as ECMAScript
+// prints them, see appendCanonicalNumber.
+func canonicalJSON(v any) ([]byte, error) {
+	return appendCanonicalJSON(nil, v)
+}
+
+func appendCanonicalJSON(buf []byte, v any) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(buf, "null"...), nil
+	case bool:
+		return strconv.AppendBool(buf, v), nil
+	case json.Number:
+		return appendCanonicalNumber(buf, v)
+	case string:
+		return appendCanonicalString(buf, v), nil
+	case []any:
+		buf = append(buf, '[')
+		for i, e := range v {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			var err error
+			if buf, err = appendCanonicalJSON(buf, e); err != nil {
+				return nil, err
+			}
+		}
+		return append(buf, ']'), nil
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		slices.SortFunc(keys, compareUTF16)
+		buf = append(buf, '{')
+		for i, k := range keys {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			buf = appendCanonicalString(buf, k)
+			buf = append(buf, ':')
+			var err error
+			if buf, err = appendCanonicalJSON(buf, v[k]); err != nil {
+				return nil, err
+			}
+		}
+		return append(buf, '}'), nil
+	}
+	return nil, fmt.Errorf("unexpected JSON value of type %T", v)
+}
+
+// compareUTF16 orders strings by their UTF-16 code units, as RFC 8785 sorts
+// object keys: characters above U+FFFF, as surrogate pairs, sort before
+// U+E000 to U+FFFF, unlike in UTF-8 byte order.
+func compareUTF16(a, b string) int {
+	return slices.Compare(utf16.Encode([]rune(a)), utf16.Encode([]rune(b)))
+}
+
+// appendCanonicalString appends s as a JSON string of RFC 8785: quotes and
+// backslashes escaped, control characters as their short escape or \u00xx,
+// and everything else, HTML characters and U+2028 included, as is.
+func appendCanonicalString(buf []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+	buf = append(buf, '"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\\':
+			buf = append(buf, '\\', c)
+		case '\b':
+			buf = append(buf, '\\', 'b')
+		case '\t':
+			buf = append(buf, '\\', 't')
+		case '\n':
+			buf = append(buf, '\\', 'n')
+		case '\f':
+			buf = append(buf, '\\', 'f')
+		case '\r':
+			buf = append(buf, '\\', 'r')
+		default:
+			if c < 0x20 {
+				buf = append(buf, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+			} else {
+				buf = append(buf, c)
+			}
+		}
+	}
+	return append(buf, '"')
+}
+
+// appendCanonicalNumber appends n as RFC 8785 serializes numbers: parsed as
+// an IEEE 754 double and printed as ECMAScript's Number.prototype.toString
+// does, with the shortest digits that read back as the same double, in
+// plain notation from 1e-6 to below 1e21 and in exponent notation
+// otherwise.
+func appendCanonicalNumber(buf []byte, n json.Number) ([]byte, error) {
+	f, err := strconv.ParseFloat(n.String(), 64)
+	if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+		return nil, fmt.Errorf("number %s is not a finite double", n)
+	}
+	if f == 0 {
+		return append(buf, '0'), nil
+	}
+	if f < 0 {
+		buf = append(buf, '-')
+		f = -f
+	}
+	// The shortest digits d1d2...dk and the exponent of d1, as "d.ddde±x".
+	mantissa, exp, _ := strings.Cut(strconv.FormatFloat(f, 'e', -1, 64), "e")
+	digits := strings.Replace(mantissa, ".", "", 1)
+	e, err := strconv.Atoi(exp)
+	if err != nil {
+		return nil, err
+	}
+	k, point := len(digits), e+1 // the decimal point sits after digit point
+	switch {
+	case k <= point && point <= 21:
+		buf = append(buf, digits...)
+		buf = append(buf, strings.Repeat("0", point-k)...)
+	case 0 < point && point <= 21:
+		buf = append(buf, digits[:point]...)
+		buf = append(buf, '.')
+		buf = append(buf, digits[point:]...)
+	case -6 < point && point <= 0:
+		buf = append(buf, "0."...)
+		buf = append(buf, strings.Repeat("0", -point)...)
+		buf = append(buf, digits...)
+	default:
+		buf = append(buf, digits[0])
+		if k > 1 {
+			buf = append(buf, '.')
+			buf = append(buf, digits[1:]...)
+		}
+		buf = append(buf, 'e')
+		if e > 0 {
+			buf = append(buf, '+')
+		}
+		buf = strconv.AppendInt(buf, int64(e), 10)
+	}
+	return buf, nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+const (
+	// jitterScale is the size, in pixels, of the largest features of the
+	// coastline jitter's displacement. Islands smaller than it drift as a
+	// whole; the finer octaves roughen coastlines.
+	jitterScale = 64
+	// jitterOctaves is the number of noise octaves of the displacement, down
+	// to features of jitterScale/8 pixels.
+	jitterOctaves = 4
+	// maxJitterAmplitude bounds -jitter-amplitude, keeping variants close
+	// enough to their map to preserve its balance.
+	maxJitterAmplitude = 16
+)
+
+// coastJitter warps a map's image with smooth seeded noise, moving every
+// pixel by at most Amplitude pixels, for remixed variants of a map that feel
+// fresh without new art. The warp is continuous, so landmasses keep their
+// shape, size and neighbours; coastlines wobble and small islands drift.
+type coastJitter struct {
+	Seed      uint64
+	Amplitude float64
+	WrapX     bool // the map wraps horizontally, so the warp must too
+}
+
+// offset returns the displacement of the pixel (x, y) of a map width pixels
+// wide: the jittered image at (x, y) shows the source image at (x+dx, y+dy).
+func (j coastJitter) offset(x, y float64, width int) (float64, float64) {
+	noise := func(seed uint64) float64 {
+		if j.WrapX {
+			return mapgen.PeriodicNoise(x/jitterScale, y/jitterScale, float64(width)/jitterScale, seed, jitterOctaves)
+		}
+		return mapgen.FractalNoise(x/jitterScale, y/jitterScale, seed, jitterOctaves)
+	}
+	return j.Amplitude * noise(j.Seed), j.Amplitude * noise(j.Seed+jitterOctaves)
+}
+
+// Image returns the jittered width×height top left corner of img. Sampling
+// is nearest neighbour so that the water key and impassable black survive
+// unblended.
+func (j coastJitter) Image(img image.Image, width, height int) *image.NRGBA {
+	b := img.Bounds()
+	out := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			dx, dy := j.offset(float64(x)+0.5, float64(y)+0.5, width)
+			sx := int(math.Floor(float64(x) + 0.5 + dx))
+			sy := min(max(int(math.Floor(float64(y)+0.5+dy)), 0), height-1)
+			if j.WrapX {
+				sx = (sx%width + width) % width
+			} else {
+				sx = min(max(sx, 0), width-1)
+			}
+			out.Set(x, y, img.At(b.Min.X+sx, b.Min.Y+sy))
+		}
+	}
+	return out
+}
+
+// Point returns where the pixel (x, y) of src lands in out, its jittered
+// width×height image, by inverting the warp. A point on land in src is kept
+// on land in out, moved to the nearest land pixel if the warp took it off
+// the coast, so that spawns stay valid. Points outside the map are kept.
+func (j coastJitter) Point(x, y int, src, out image.Image, width, height int) (int, int) {
+	if x < 0 || x >= width || y < 0 || y >= height {
+		return x, y
+	}
+	// Solve p + offset(p) = (x, y) by fixed-point iteration, which converges
+	// as the warp is smooth and small.
+	px, py := float64(x)+0.5, float64(y)+0.5
+	for i := 0; i < 8; i++ {
+		dx, dy := j.offset(px, py, width)
+		px, py = float64(x)+0.5-dx, float64(y)+0.5-dy
+	}
+	ix := min(max(int(math.Floor(px)), 0), width-1)
+	iy := min(max(int(math.Floor(py)), 0), height-1)
+	if !isLandPixel(src.At(x, y)) || isLandPixel(out.At(ix, iy)) {
+		return ix, iy
+	}
+	radius := int(math.Ceil(2*j.Amplitude)) + 1
+	best, bestDist := [2]int{ix, iy}, math.MaxInt
+	for dy := -radius; dy <= radius; dy++ {
+		for dx := -radius; dx <= radius; dx++ {
+			nx, ny := ix+dx, iy+dy
+			d := dx*dx + dy*dy
+			if nx < 0 || nx >= width || ny < 0 || ny >= height || d > radius*radius || d >= bestDist {
+				continue
+			}
+			if isLandPixel(out.At(nx, ny)) {
+				best, bestDist = [2]int{nx, ny}, d
+			}
+		}
+	}
+	return best[0], best[1]
+}
+
+// isLandPixel reports whether GenerateMap reads a source image pixel as land.
+func isLandPixel(c color.Color) bool {
+	r, g, b, a := c.RGBA()
+	red, green, blue, alpha := uint8(r>>8), uint8(g>>8), uint8(b>>8), uint8(a>>8)
+	if alpha < 20 || blue == 106 {
+		return false
+	}
+	return red != 0 || green != 0 || blue != 0
+}
+
+// landShare returns the fraction of the width×height top left corner of img
+// that is land.
+func landShare(img image.Image, width, height int) float64 {
+	b := img.Bounds()
+	land := 0
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if isLandPixel(img.At(b.Min.X+x, b.Min.Y+y)) {
+				land++
+			}
+		}
+	}
+	return float64(land) / float64(width*height)
+}
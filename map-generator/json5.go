@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// readInfoJSON reads an info.json file, which may be written in JSON5, and
+// returns it as strict JSON. Generated manifests are always strict JSON.
+func readInfoJSON(path string) ([]byte, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	normalized, err := normalizeJSON5(buf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return normalized, nil
+}
+
+// normalizeJSON5 converts a JSON5 document into strict JSON. Map authors use
+// it to annotate nation lists and generator settings inline. Supported JSON5
+// extensions:
+//   - line (//) and block (/* */) comments;
+//   - trailing commas in objects and arrays;
+//   - single-quoted strings, line continuations, the \x, \v and \0
+//     escapes and escaped characters that need no escape, such as \q;
+//   - unquoted (identifier) object keys;
+//   - numbers with a leading '+', a leading or trailing decimal point, or in
+//     hexadecimal.
+//
+// Infinity, NaN and numbers with leading zeros are rejected because JSON
+// can't represent them. Comments are replaced by whitespace and the newlines
+// of line continuations are moved after their string, keeping every newline,
+// so line numbers in later JSON errors still point at the source file.
+// Strict JSON input is returned unchanged.
+func normalizeJSON5(src []byte) ([]byte, error) {
+	p := json5Normalizer{src: src}
+	if err := p.run(); err != nil {
+		return nil, err
+	}
+	return p.out.Bytes(), nil
+}
+
+type json5Normalizer struct {
+	src []byte
+	pos int
+	out bytes.Buffer
+}
+
+// errorf returns an error annotated with the line and column of pos.
+func (p *json5Normalizer) errorf(pos int, format string, args ...any) error {
+	line := 1 + bytes.Count(p.src[:pos], []byte{'\n'})
+	col := pos - bytes.LastIndexByte(p.src[:pos], '\n')
+	return fmt.Errorf("line %d, column %d: %s", line, col, fmt.Sprintf(format, args...))
+}
+
+func (p *json5Normalizer) run() error {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == '"' || c == '\'':
+			if err := p.string(c); err != nil {
+				return err
+			}
+		case c == '/':
+			if err := p.comment(); err != nil {
+				return err
+			}
+		case c == ',':
+			next := p.skipInsignificant(p.pos + 1)
+			if next < len(p.src) && (p.src[next] == '}' || p.src[next] == ']') {
+				// Trailing comma: drop it.
+				p.out.WriteByte(' ')
+			} else {
+				p.out.WriteByte(',')
+			}
+			p.pos++
+		case c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9'):
+			if err := p.number(); err != nil {
+				return err
+			}
+		case isIdentStart(c):
+			if err := p.identifier(); err != nil {
+				return err
+			}
+		default:
+			p.out.WriteByte(c)
+			p.pos++
+		}
+	}
+	return nil
+}
+
+// skipInsignificant returns the position of the first byte at or after i that
+// is neither whitespace nor part of a comment.
+func (p *json5Normalizer) skipInsignificant(i int) int {
+	for i < len(p.src) {
+		switch {
+		case p.src[i] == ' ' || p.src[i] == '\t' || p.src[i] == '\n' || p.src[i] == '\r':
+			i++
+		case bytes.HasPrefix(p.src[i:], []byte("//")):
+			end := bytes.IndexByte(p.src[i:], '\n')
+			if end < 0 {
+				return len(p.src)
+			}
+			i += end
+		case bytes.HasPrefix(p.src[i:], []byte("/*")):
+			end := bytes.Index(p.src[i+2:], []byte("*/"))
+			if end < 0 {
+				return len(p.src)
+			}
+			i += end + 4
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// comment replaces a comment by whitespace, keeping its newlines. A block
+// comment without newlines becomes a space, so that it still separates the
+// tokens around it.
+func (p *json5Normalizer) comment() error {
+	start := p.pos
+	var end int
+	switch {
+	case bytes.HasPrefix(p.src[p.pos:], []byte("//")):
+		end = bytes.IndexByte(p.src[p.pos:], '\n')
+		if end < 0 {
+			end = len(p.src)
+		} else {
+			end += p.pos
+		}
+	case bytes.HasPrefix(p.src[p.pos:], []byte("/*")):
+		close := bytes.Index(p.src[p.pos+2:], []byte("*/"))
+		if close < 0 {
+			return p.errorf(start, "unterminated block comment")
+		}
+		end = p.pos + 2 + close + 2
+	default:
+		return p.errorf(start, "unexpected '/'")
+	}
+	newlines := bytes.Count(p.src[start:end], []byte{'\n'})
+	if newlines == 0 && p.src[start+1] == '*' {
+		p.out.WriteByte(' ')
+	}
+	p.out.Write(bytes.Repeat([]byte{'\n'}, newlines))
+	p.pos = end
+	return nil
+}
+
+// string copies a single- or double-quoted string as a double-quoted JSON
+// string. JSON5-only escapes are rewritten to their JSON equivalents, and
+// escaped characters JSON has no escape for to the bare character. The
+// newlines of line continuations are moved after the closing quote, so the
+// string stays on one line and later lines keep their numbers.
+func (p *json5Normalizer) string(quote byte) error {
+	start := p.pos
+	newlines := 0
+	p.out.WriteByte('"')
+	p.pos++
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == quote:
+			p.out.WriteByte('"')
+			p.out.Write(bytes.Repeat([]byte{'\n'}, newlines))
+			p.pos++
+			return nil
+		case c == '\\':
+			if p.pos+1 >= len(p.src) {
+				return p.errorf(start, "unterminated string")
+			}
+			next := p.src[p.pos+1]
+			p.pos += 2
+			switch next {
+			case '\'':
+				// \' is not a valid JSON escape.
+				p.out.WriteByte('\'')
+			case '\n':
+				// JSON5 line continuation.
+				newlines++
+			case '\r':
+				// JSON5 line continuation, with a CRLF line ending.
+				if p.pos < len(p.src) && p.src[p.pos] == '\n' {
+					p.pos++
+				}
+				newlines++
+			case 'v':
+				p.out.WriteString(`\u000b`)
+			case '0':
+				if p.pos < len(p.src) && p.src[p.pos] >= '0' && p.src[p.pos] <= '9' {
+					return p.errorf(p.pos-2, "invalid escape \\0 followed by a digit")
+				}
+				p.out.WriteString(`\u0000`)
+			case 'x':
+				if p.pos+2 > len(p.src) || !isHexDigit(p.src[p.pos]) || !isHexDigit(p.src[p.pos+1]) {
+					return p.errorf(p.pos-2, "invalid escape \\x: want two hexadecimal digits")
+				}
+				p.out.WriteString(`\u00`)
+				p.out.Write(p.src[p.pos : p.pos+2])
+				p.pos += 2
+			case '"', '\\', '/', 'b', 'f', 'n', 'r', 't', 'u':
+				p.out.WriteByte('\\')
+				p.out.WriteByte(next)
+			default:
+				// In JSON5, like in JavaScript, any other escaped
+				// character stands for itself.
+				p.out.WriteByte(next)
+			}
+		case c == '"':
+			// Only reachable inside a single-quoted string.
+			p.out.WriteString(`\"`)
+			p.pos++
+		case c == '\n' || c == '\r':
+			return p.errorf(start, "unterminated string")
+		default:
+			p.out.WriteByte(c)
+			p.pos++
+		}
+	}
+	return p.errorf(start, "unterminated string")
+}
+
+// number copies a number, rewriting JSON5-only forms to strict JSON.
+func (p *json5Normalizer) number() error {
+	start := p.pos
+	end := p.pos
+	for end < len(p.src) && strings.IndexByte("+-.0123456789abcdefABCDEFxXIinNtyY", p.src[end]) >= 0 {
+		end++
+	}
+	token := string(p.src[start:end])
+	p.pos = end
+
+	sign := ""
+	body := token
+	if body != "" && (body[0] == '+' || body[0] == '-') {
+		if body[0] == '-' {
+			sign = "-"
+		}
+		body = body[1:]
+	}
+	switch {
+	case body == "Infinity" || body == "NaN":
+		return p.errorf(start, "%s can't be represented in JSON", token)
+	case strings.HasPrefix(body, "0x") || strings.HasPrefix(body, "0X"):
+		v, err := strconv.ParseUint(body[2:], 16, 64)
+		if err != nil {
+			return p.errorf(start, "invalid hexadecimal number %q", token)
+		}
+		p.out.WriteString(sign + strconv.FormatUint(v, 10))
+		return nil
+	}
+	if body != "" && (body[0] == '+' || body[0] == '-') {
+		return p.errorf(start, "invalid number %q", token)
+	}
+	if len(body) > 1 && body[0] == '0' && body[1] >= '0' && body[1] <= '9' {
+		return p.errorf(start, "invalid number %q: leading zeros are not allowed", token)
+	}
+	if strings.HasPrefix(body, ".") {
+		body = "0" + body
+	}
+	if mantissa, exponent, found := strings.Cut(strings.ToLower(body), "e"); strings.HasSuffix(mantissa, ".") {
+		body = strings.TrimSuffix(mantissa, ".")
+		if found {
+			body += "e" + exponent
+		}
+	}
+	if _, err := strconv.ParseFloat(body, 64); err != nil {
+		return p.errorf(start, "invalid number %q", token)
+	}
+	p.out.WriteString(sign + body)
+	return nil
+}
+
+// identifier copies a literal or quotes an unquoted object key.
+func (p *json5Normalizer) identifier() error {
+	start := p.pos
+	end := p.pos
+	for end < len(p.src) && (isIdentStart(p.src[end]) || (p.src[end] >= '0' && p.src[end] <= '9')) {
+		end++
+	}
+	ident := string(p.src[start:end])
+	p.pos = end
+	next := p.skipInsignificant(end)
+	if next < len(p.src) && p.src[next] == ':' {
+		p.out.WriteString(strconv.Quote(ident))
+		return nil
+	}
+	switch ident {
+	case "true", "false", "null":
+		p.out.WriteString(ident)
+		return nil
+	case "Infinity", "NaN":
+		return p.errorf(start, "%s can't be represented in JSON", ident)
+	}
+	return p.errorf(start, "unexpected identifier %q", ident)
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
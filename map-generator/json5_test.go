@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// TestNormalizeJSON5 checks each supported JSON5 extension, and that forms
+// JSON can't represent fail with the position of the offending token.
+func TestNormalizeJSON5(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		src  string
+		want string // strict JSON, or the start of the error when err is set
+		err  bool
+	}{
+		{name: "strict", src: `{"a": [1, -2.5e3, "x\n", true, null]}`, want: `{"a": [1, -2.5e3, "x\n", true, null]}`},
+		{name: "line comment", src: "{\"a\": 1 // note\n}", want: "{\"a\": 1 \n}"},
+		{name: "block comment", src: "{/* a\nb */\"a\": 1}", want: "{\n\"a\": 1}"},
+		{name: "inline block comment", src: `[true/* x */,/**/false]`, want: `[true , false]`},
+		{name: "block comment between literals", src: `{a:/**/null}`, want: `{"a": null}`},
+		{name: "identity escapes", src: `'\a\q\-\é'`, want: `"aq-é"`},
+		{name: "json escapes", src: `'\"\\\/\b\f\n\r\t\u0041'`, want: `"\"\\\/\b\f\n\r\t\u0041"`},
+		{name: "escaped quotes", src: `["\'", '\"']`, want: `["'", "\""]`},
+		{name: "trailing commas", src: `{"a": [1, 2,], }`, want: `{"a": [1, 2 ]  }`},
+		{name: "single quotes", src: `{'a': 'it\'s "x"'}`, want: `{"a": "it's \"x\""}`},
+		{name: "unquoted key", src: `{name: 1, $id_2: 2}`, want: `{"name": 1, "$id_2": 2}`},
+		{name: "plus sign", src: `[+1, +.5]`, want: `[1, 0.5]`},
+		{name: "leading point", src: `[.5, -.5]`, want: `[0.5, -0.5]`},
+		{name: "trailing point", src: `[5., 5.e2]`, want: `[5, 5e2]`},
+		{name: "hexadecimal", src: `[0xFF, -0x10]`, want: `[255, -16]`},
+		{name: "hex escape", src: `'\x41\x7e'`, want: `"\u0041\u007e"`},
+		{name: "vertical tab escape", src: `'\v'`, want: `"\u000b"`},
+		{name: "null escape", src: `'a\0b'`, want: `"a\u0000b"`},
+		{name: "line continuation", src: "['a\\\nb', 1]", want: "[\"ab\"\n, 1]"},
+		{name: "crlf line continuation", src: "['a\\\r\nb', 1]", want: "[\"ab\"\n, 1]"},
+		{name: "leading zeros", src: "{\"a\": 1,\n\"b\": 007}", want: "line 2, column 6: invalid number \"007\"", err: true},
+		{name: "negative leading zeros", src: `[-01]`, want: "line 1, column 2: invalid number \"-01\"", err: true},
+		{name: "short hex escape", src: `'\x4'`, want: "line 1, column 2: invalid escape \\x", err: true},
+		{name: "null escape before digit", src: `'\01'`, want: "line 1, column 2: invalid escape \\0", err: true},
+		{name: "double sign", src: `[-+1]`, want: "line 1, column 2: invalid number \"-+1\"", err: true},
+		{name: "infinity", src: `[Infinity]`, want: "line 1, column 2: Infinity can't be represented", err: true},
+		{name: "nan", src: `[-NaN]`, want: "line 1, column 2: -NaN can't be represented", err: true},
+		{name: "unterminated string", src: "['a\nb']", want: "line 1, column 2: unterminated string", err: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := normalizeJSON5([]byte(tc.src))
+			if tc.err {
+				if err == nil {
+					t.Fatalf("normalizeJSON5(%q) = %q, want an error", tc.src, got)
+				}
+				if !strings.HasPrefix(err.Error(), tc.want) {
+					t.Errorf("normalizeJSON5(%q) error %q, want %q", tc.src, err, tc.want)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("normalizeJSON5(%q): %v", tc.src, err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("normalizeJSON5(%q) = %q, want %q", tc.src, got, tc.want)
+			}
+			if !json.Valid(got) {
+				t.Errorf("normalizeJSON5(%q) = %q, not valid JSON", tc.src, got)
+			}
+			if n, m := bytes.Count(got, []byte{'\n'}), strings.Count(tc.src, "\n"); n != m {
+				t.Errorf("normalizeJSON5(%q) has %d lines, want %d", tc.src, n+1, m+1)
+			}
+		})
+	}
+}
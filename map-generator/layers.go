@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+// layersFlag holds the comma-separated list of auxiliary layers passed via
+// the --layers command-line argument, or "all".
+var layersFlag string
+
+// parseLayersFlag validates the --layers argument and returns the selected
+// layer names in build order.
+func parseLayersFlag() ([]string, error) {
+	if layersFlag == "" {
+		return nil, nil
+	}
+	selected := make(map[string]bool)
+	for _, name := range strings.Split(layersFlag, ",") {
+		if name == "all" {
+			for _, l := range mapgen.AuxLayers {
+				selected[l.Name] = true
+			}
+			continue
+		}
+		if mapgen.FindAuxLayer(name) == nil {
+			return nil, fmt.Errorf("unknown layer %q (available: %s)", name, strings.Join(auxLayerNames(), ", "))
+		}
+		selected[name] = true
+	}
+	var names []string
+	for _, l := range mapgen.AuxLayers {
+		if selected[l.Name] {
+			names = append(names, l.Name)
+		}
+	}
+	return names, nil
+}
+
+func auxLayerNames() []string {
+	names := make([]string, len(mapgen.AuxLayers))
+	for i, l := range mapgen.AuxLayers {
+		names[i] = l.Name
+	}
+	return names
+}
+
+// manifestLayers returns the manifest "layers" section for the built layers:
+// each layer's file plus its extra fields, keyed by layer name.
+func manifestLayers(outputs []mapgen.LayerOutput) map[string]map[string]any {
+	section := make(map[string]map[string]any, len(outputs))
+	for _, o := range outputs {
+		entry := map[string]any{"file": o.File}
+		for k, v := range o.Meta {
+			entry[k] = v
+		}
+		section[o.Name] = entry
+	}
+	return section
+}
+
+// recordedLayersMatch reports whether a manifest "layers" section holds
+// exactly the requested layers.
+func recordedLayersMatch(recorded map[string]struct{ File string }, requested []string) bool {
+	if len(recorded) != len(requested) {
+		return false
+	}
+	names := make([]string, 0, len(recorded))
+	for name := range recorded {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	want := append([]string(nil), requested...)
+	sort.Strings(want)
+	for i := range names {
+		if names[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// removeStaleLayers deletes layer files in mapDir left over from a previous
+// run that built layers this run did not.
+func removeStaleLayers(mapDir string, built []mapgen.LayerOutput) error {
+	keep := make(map[string]bool, len(built))
+	for _, o := range built {
+		keep[o.File] = true
+	}
+	for _, l := range mapgen.AuxLayers {
+		if keep[l.File] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(mapDir, l.File)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
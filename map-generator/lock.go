@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+// lockFileName is the advisory lock taken in the output maps directory for the
+// duration of a run. It guards everything the generator writes: the outputs
+// of both the maps and the test maps, Maps.gen.ts, and the selftest fixtures,
+// so every command writing any of them takes it with lockGeneratorOutputs.
+const lockFileName = ".map-generator.lock"
+
+// lockPollInterval is how often a --wait run retries a held lock.
+const lockPollInterval = time.Second
+
+// lockHolder describes the process holding the output lock. It is written as
+// JSON into the lock file so that a blocked run can report who holds it.
+type lockHolder struct {
+	PID     int       `json:"pid"`
+	Host    string    `json:"host"`
+	Started time.Time `json:"started"`
+	Args    []string  `json:"args"`
+}
+
+func (h lockHolder) String() string {
+	return fmt.Sprintf("pid %d on %s since %s (%s)", h.PID, h.Host, h.Started.Format(time.RFC3339), strings.Join(h.Args, " "))
+}
+
+// acquireOutputLock takes the advisory lock in dir so that two concurrent
+// generator runs (e.g. a watch mode and a manual run) can't interleave writes
+// and corrupt manifests. If another live process holds the lock it returns an
+// error naming the holder, or, when wait is true, polls until the lock is
+// released. Locks left behind by a process that no longer exists on this host
+// are treated as stale and taken over.
+//
+// The returned release function removes the lock; it is safe to call more
+// than once.
+func acquireOutputLock(ctx context.Context, dir string, wait bool) (release func(), err error) {
+	logger := mapgen.LoggerFromContext(ctx)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	path := filepath.Join(dir, lockFileName)
+
+	host, _ := os.Hostname()
+	self := lockHolder{PID: os.Getpid(), Host: host, Started: time.Now().UTC(), Args: os.Args}
+	content, err := json.Marshal(self)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize lock: %w", err)
+	}
+
+	announced := false
+	for {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, writeErr := f.Write(content)
+			closeErr := f.Close()
+			if err := errors.Join(writeErr, closeErr); err != nil {
+				os.Remove(path)
+				return nil, fmt.Errorf("failed to write lock %s: %w", path, err)
+			}
+			released := false
+			return func() {
+				if !released {
+					released = true
+					os.Remove(path)
+				}
+			}, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to create lock %s: %w", path, err)
+		}
+
+		holder, readErr := readLockHolder(path)
+		if readErr == nil && holder.Host == host && !processAlive(holder.PID) {
+			taken, err := removeStaleLock(path, holder)
+			if err != nil {
+				return nil, err
+			}
+			if taken {
+				logger.Warn(fmt.Sprintf("Removed stale lock held by %s", holder))
+				continue
+			}
+			holder, readErr = readLockHolder(path)
+		}
+
+		description := "an unknown process"
+		if readErr == nil {
+			description = holder.String()
+		}
+		if !wait {
+			return nil, fmt.Errorf("%s is locked by %s; pass --wait to wait for it, or remove %s if that run is gone", dir, description, path)
+		}
+		if !announced {
+			logger.Info(fmt.Sprintf("Waiting for lock on %s held by %s", dir, description))
+			announced = true
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
+
+// removeStaleLock removes the lock at path if it is still held by stale, and
+// reports whether it did. Two runs can find the same stale lock at once, and
+// the first to remove it may take the lock before the second gets to it, so
+// the lock is removed only while holding a takeover lock next to it, after
+// reading its holder again. A takeover lock that is already held means
+// another run is taking over, and the lock is left to it; if that run died
+// while taking over, the takeover lock must be removed by hand.
+func removeStaleLock(path string, stale lockHolder) (bool, error) {
+	takeover := path + ".takeover"
+	f, err := os.OpenFile(takeover, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if errors.Is(err, os.ErrExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to create lock %s: %w", takeover, err)
+	}
+	f.Close()
+	defer os.Remove(takeover)
+
+	holder, err := readLockHolder(path)
+	if err != nil || !reflect.DeepEqual(holder, stale) {
+		return false, nil
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return false, fmt.Errorf("failed to remove stale lock %s: %w", path, err)
+	}
+	return true, nil
+}
+
+// lockGeneratorOutputs takes the output lock for a command that writes
+// generator outputs.
+func lockGeneratorOutputs(ctx context.Context, wait bool) (release func(), err error) {
+	dir, err := outputMapDir(false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate output directory: %w", err)
+	}
+	return acquireOutputLock(ctx, dir, wait)
+}
+
+// readLockHolder reads the holder recorded in a lock file.
+func readLockHolder(path string) (lockHolder, error) {
+	var holder lockHolder
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return holder, err
+	}
+	err = json.Unmarshal(buf, &holder)
+	return holder, err
+}
@@ -8,8 +8,13 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
+	"unicode"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
 )
 
 type LogFlags struct {
@@ -17,17 +22,12 @@ type LogFlags struct {
 	verbose     bool   // sets log-level=DEBUG
 	performance bool   // opts-in to performance checks and sets log-level=DEBUG
 	removal     bool   // opts-in to island/lake removal logging and sets log-level=DEBUG
+	quiet       bool   // logs only warnings, errors and ResultLogTag messages
 }
 
 // LevelAll is a custom log Level that outputs all messages, regardless of other passed flags
 const LevelAll = slog.Level(-8)
 
-// PerformanceLogTag is a slog attribute used to tag performance-related log messages.
-var PerformanceLogTag = slog.String("tag", "performance")
-
-// RemovalLogTag is a slog attribute used to tag land/water removal-related log messages.
-var RemovalLogTag = slog.String("tag", "removal")
-
 // DetermineLogLevel determines the log level based on the LogFlags
 // It prioritizes the log level flag over the default, and switches to debug if performance or removal flags are set.
 func DetermineLogLevel(
@@ -65,12 +65,16 @@ func DetermineLogLevel(
 }
 
 // GeneratorLogger is a custom slog.Handler that outputs logs based on log level and additional LogFlags.
+// Attributes follow the message as key=value pairs, keys qualified by their
+// groups as group.key, except the ones steering the handler itself, see
+// isControlAttr.
 type GeneratorLogger struct {
 	opts   slog.HandlerOptions
 	w      io.Writer
 	mu     *sync.Mutex
-	attrs  []slog.Attr
-	prefix string
+	attrs  []slog.Attr // top-level attributes, for the control attributes
+	groups []string    // groups opened by WithGroup, qualifying later keys
+	fields string      // the rendered attributes added by WithAttrs
 	flags  LogFlags
 }
 
@@ -106,17 +110,21 @@ func (h *GeneratorLogger) Enabled(_ context.Context, level slog.Level) bool {
 func (h *GeneratorLogger) Handle(_ context.Context, r slog.Record) error {
 	isPerformanceLog := false
 	isRemovalLog := false
+	isResultLog := false
 	isTestMap := false
 
 	var mapName string
 
 	findAttrs := func(a slog.Attr) {
-		if a.Equal(PerformanceLogTag) {
+		if a.Equal(mapgen.PerformanceLogTag) {
 			isPerformanceLog = true
 		}
-		if a.Equal(RemovalLogTag) {
+		if a.Equal(mapgen.RemovalLogTag) {
 			isRemovalLog = true
 		}
+		if a.Equal(mapgen.ResultLogTag) {
+			isResultLog = true
+		}
 		if a.Key == "map" {
 			mapName = a.Value.String()
 		}
@@ -145,6 +153,11 @@ func (h *GeneratorLogger) Handle(_ context.Context, r slog.Record) error {
 		return nil
 	}
 
+	// Only warnings, errors and results get through --quiet
+	if h.flags.quiet && r.Level < slog.LevelWarn && !isResultLog {
+		return nil
+	}
+
 	// dont log performance messages for test maps
 	if isPerformanceLog && isTestMap {
 		return nil
@@ -152,8 +165,9 @@ func (h *GeneratorLogger) Handle(_ context.Context, r slog.Record) error {
 
 	buf := &bytes.Buffer{}
 
-	// Add map name as a prefix in log Level DEBUG and ALL
-	if (h.opts.Level == slog.LevelDebug || h.opts.Level == LevelAll) && mapName != "" {
+	// Add map name as a prefix in log Level DEBUG and ALL, and to the
+	// warnings that --quiet lets through; results name their map already
+	if (h.opts.Level == slog.LevelDebug || h.opts.Level == LevelAll || h.flags.quiet) && mapName != "" && !isResultLog {
 		mapName = strings.Trim(mapName, `"`)
 		fmt.Fprintf(buf, "[%s] ", mapName)
 	}
@@ -163,11 +177,16 @@ func (h *GeneratorLogger) Handle(_ context.Context, r slog.Record) error {
 		fmt.Fprintf(buf, "[PERF] ")
 	}
 
-	if h.prefix != "" {
-		fmt.Fprintf(buf, "%s ", h.prefix)
-	}
-
-	fmt.Fprintln(buf, r.Message)
+	buf.WriteString(r.Message)
+	buf.WriteString(h.fields)
+	r.Attrs(func(a slog.Attr) bool {
+		// the tags steer the handler even inside groups, see findAttrs
+		if !isControlAttr(a) {
+			appendAttr(buf, h.groups, a)
+		}
+		return true
+	})
+	buf.WriteByte('\n')
 
 	h.mu.Lock()
 	defer h.mu.Unlock()
@@ -178,36 +197,118 @@ func (h *GeneratorLogger) Handle(_ context.Context, r slog.Record) error {
 // WithAttrs returns a new handler with the given attributes added.
 func (h *GeneratorLogger) WithAttrs(attrs []slog.Attr) slog.Handler {
 	newHandler := *h
-	newHandler.attrs = append(newHandler.attrs, attrs...)
+	if len(h.groups) == 0 {
+		newHandler.attrs = append(h.attrs[:len(h.attrs):len(h.attrs)], attrs...)
+	}
+	buf := &bytes.Buffer{}
+	for _, a := range attrs {
+		appendAttr(buf, h.groups, a)
+	}
+	newHandler.fields += buf.String()
 	return &newHandler
 }
 
 // WithGroup returns a new handler with the given group name.
-// The group name is added as a prefix to subsequent log messages.
+// The group name qualifies the keys of the attributes added afterwards.
 func (h *GeneratorLogger) WithGroup(name string) slog.Handler {
 	if name == "" {
 		return h
 	}
 	newHandler := *h
-	if newHandler.prefix != "" {
-		newHandler.prefix += "."
-	}
-	newHandler.prefix += name
+	newHandler.groups = append(h.groups[:len(h.groups):len(h.groups)], name)
 	return &newHandler
 }
 
-type loggerKey struct{}
+// isControlAttr reports whether a top-level attribute steers the handler,
+// like the map name and the log tags, rather than being logged.
+func isControlAttr(a slog.Attr) bool {
+	return a.Key == "map" || a.Key == "isTest" || a.Key == "tag"
+}
+
+// appendAttr renders a to buf as " key=value", its key qualified by the
+// groups it is in. Group values are flattened into one pair per attribute,
+// empty groups and zero attributes are dropped, and values that would be
+// ambiguous unquoted, such as strings with spaces, are quoted.
+func appendAttr(buf *bytes.Buffer, groups []string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			groups = append(groups[:len(groups):len(groups)], a.Key)
+		}
+		for _, ga := range a.Value.Group() {
+			appendAttr(buf, groups, ga)
+		}
+		return
+	}
+	if len(groups) == 0 && isControlAttr(a) {
+		return
+	}
+	buf.WriteByte(' ')
+	for _, g := range groups {
+		buf.WriteString(g)
+		buf.WriteByte('.')
+	}
+	buf.WriteString(a.Key)
+	buf.WriteByte('=')
+	v := a.Value.String()
+	if a.Value.Kind() == slog.KindTime {
+		v = a.Value.Time().Format(time.RFC3339Nano)
+	}
+	if v == "" || strings.ContainsFunc(v, func(r rune) bool { return r <= ' ' || r == '"' || r == '=' || !unicode.IsPrint(r) }) {
+		v = strconv.Quote(v)
+	}
+	buf.WriteString(v)
+}
+
+// warningRecorder is a slog.Handler that passes records on to another
+// handler and also keeps the message of every warning and error, so they can
+// be listed per map in the run report.
+type warningRecorder struct {
+	next     slog.Handler
+	mu       *sync.Mutex
+	messages *[]string
+}
+
+// newWarningRecorder returns a handler recording the warnings logged through
+// it, and all handlers derived from it, before passing them on to next.
+func newWarningRecorder(next slog.Handler) *warningRecorder {
+	return &warningRecorder{next: next, mu: &sync.Mutex{}, messages: &[]string{}}
+}
 
-// LoggerFromContext retrieves the logger from the context.
-// If no logger is found, it returns the default logger.
-func LoggerFromContext(ctx context.Context) *slog.Logger {
-	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
-		return logger
+// Warnings returns the messages recorded so far.
+func (h *warningRecorder) Warnings() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string(nil), *h.messages...)
+}
+
+// Enabled reports whether the level is recorded or enabled on next.
+func (h *warningRecorder) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= slog.LevelWarn || h.next.Enabled(ctx, level)
+}
+
+// Handle records warnings and errors and passes records on to next.
+func (h *warningRecorder) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= slog.LevelWarn {
+		h.mu.Lock()
+		*h.messages = append(*h.messages, r.Message)
+		h.mu.Unlock()
+	}
+	if !h.next.Enabled(ctx, r.Level) {
+		return nil
 	}
-	return slog.Default()
+	return h.next.Handle(ctx, r)
+}
+
+// WithAttrs returns a recorder sharing this one's messages.
+func (h *warningRecorder) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &warningRecorder{next: h.next.WithAttrs(attrs), mu: h.mu, messages: h.messages}
 }
 
-// ContextWithLogger returns a new context with the provided logger.
-func ContextWithLogger(ctx context.Context, logger *slog.Logger) context.Context {
-	return context.WithValue(ctx, loggerKey{}, logger)
+// WithGroup returns a recorder sharing this one's messages.
+func (h *warningRecorder) WithGroup(name string) slog.Handler {
+	return &warningRecorder{next: h.next.WithGroup(name), mu: h.mu, messages: h.messages}
 }
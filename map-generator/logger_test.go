@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+// TestGeneratorLoggerAttrs checks how GeneratorLogger renders attributes.
+func TestGeneratorLoggerAttrs(t *testing.T) {
+	tests := []struct {
+		name string
+		log  func(l *slog.Logger)
+		want string
+	}{
+		{
+			name: "key=value",
+			log:  func(l *slog.Logger) { l.Info("msg", "count", 3, "ok", true, "name", "alpha") },
+			want: "msg count=3 ok=true name=alpha\n",
+		},
+		{
+			name: "quoting",
+			log: func(l *slog.Logger) {
+				l.Info("msg", "path", "a b/c.png", "empty", "", "quote", `say "hi"`, "eq", "a=b", "tab", "a\tb")
+			},
+			want: `msg path="a b/c.png" empty="" quote="say \"hi\"" eq="a=b" tab="a\tb"` + "\n",
+		},
+		{
+			name: "WithGroup",
+			log:  func(l *slog.Logger) { l.WithGroup("scale").WithGroup("4x").Info("msg", "width", 25) },
+			want: "msg scale.4x.width=25\n",
+		},
+		{
+			name: "inline group",
+			log: func(l *slog.Logger) {
+				l.Info("msg", slog.Group("size", "w", 4, slog.Group("tiles", "land", 3)), slog.Group("empty"))
+			},
+			want: "msg size.w=4 size.tiles.land=3\n",
+		},
+		{
+			name: "WithGroup and inline group",
+			log:  func(l *slog.Logger) { l.WithGroup("lakes").Info("msg", slog.Group("removed", "n", 2)) },
+			want: "msg lakes.removed.n=2\n",
+		},
+		{
+			name: "WithAttrs",
+			log: func(l *slog.Logger) {
+				l = l.With("step", "water").WithGroup("g").With("a", 1)
+				l.Info("first", "b", 2)
+				l.Info("second")
+			},
+			want: "first step=water g.a=1 g.b=2\nsecond step=water g.a=1\n",
+		},
+		{
+			name: "control attributes",
+			log: func(l *slog.Logger) {
+				l.With("map", "alpha", "isTest", false).Info("msg", mapgen.ResultLogTag, "n", 1)
+			},
+			want: "msg n=1\n",
+		},
+		{
+			name: "control keys in groups",
+			log:  func(l *slog.Logger) { l.Info("msg", slog.Group("src", "map", "beta", "tag", "x")) },
+			want: "msg src.map=beta src.tag=x\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tt.log(slog.New(NewGeneratorLogger(&buf, nil, LogFlags{})))
+			if got := buf.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestGeneratorLoggerTags checks that the log tags and flags filter records.
+func TestGeneratorLoggerTags(t *testing.T) {
+	tests := []struct {
+		name  string
+		level slog.Level
+		flags LogFlags
+		log   func(l *slog.Logger)
+		want  string
+	}{
+		{
+			name:  "performance without flag",
+			level: slog.LevelDebug,
+			log:   func(l *slog.Logger) { l.Debug("took 1s", mapgen.PerformanceLogTag) },
+		},
+		{
+			name:  "performance with flag",
+			level: slog.LevelDebug,
+			flags: LogFlags{performance: true},
+			log:   func(l *slog.Logger) { l.With("map", "alpha").Debug("took 1s", mapgen.PerformanceLogTag) },
+			want:  "[alpha] [PERF] took 1s\n",
+		},
+		{
+			name:  "performance of test map",
+			level: slog.LevelDebug,
+			flags: LogFlags{performance: true},
+			log:   func(l *slog.Logger) { l.With("isTest", true).Debug("took 1s", mapgen.PerformanceLogTag) },
+		},
+		{
+			name:  "removal without flag",
+			level: slog.LevelDebug,
+			log:   func(l *slog.Logger) { l.Debug("removed lake", mapgen.RemovalLogTag) },
+		},
+		{
+			name:  "removal at level all",
+			level: LevelAll,
+			log:   func(l *slog.Logger) { l.Debug("removed lake", mapgen.RemovalLogTag) },
+			want:  "removed lake\n",
+		},
+		{
+			name:  "quiet",
+			level: slog.LevelInfo,
+			flags: LogFlags{quiet: true},
+			log: func(l *slog.Logger) {
+				l = l.With("map", "alpha")
+				l.Info("dropped")
+				l.Info("done", mapgen.ResultLogTag)
+				l.Warn("careful")
+			},
+			want: "done\n[alpha] careful\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tt.log(slog.New(NewGeneratorLogger(&buf, &slog.HandlerOptions{Level: tt.level}, tt.flags)))
+			if got := buf.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
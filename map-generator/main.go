@@ -2,15 +2,23 @@ package main
 
 import (
 	"context"
+	"crypto/ed25519"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"image/png"
 	"log"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
+	"time"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapformat"
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
 )
 
 // mapEntry identifies one map to process: its folder name and whether it
@@ -50,6 +58,31 @@ func discoverMaps() ([]mapEntry, error) {
 // mapsFlag holds the comma-separated list of map names passed via the --maps command-line argument.
 var mapsFlag string
 
+// forceFlag regenerates every selected map, even if its sources are unchanged.
+// Without it, a map whose sourceHash, generator version and layers match its
+// manifest and whose outputs still verify is skipped, see outputsUpToDate.
+var forceFlag bool
+
+// strictFlag fails every map that logs a warning, so that pipelines can block
+// merges on conditions that otherwise scroll by unnoticed. It also turns
+// the problems warnStrictProblems lists into warnings, and regenerates every
+// map, as forceFlag does, since outputs built without it may hide warnings.
+var strictFlag bool
+
+// tileFormatFlag is the mapformat.TileFormat the maps are packed in. It stays
+// at mapformat.TileFormat1 by default until every client decodes a newer
+// format, so that a new tile layout is opted into rather than shipped to
+// clients that would misread it.
+var tileFormatFlag int
+
+// waitFlag makes a run wait for the output lock instead of failing when
+// another generator run holds it.
+var waitFlag bool
+
+// reportFlag is the comma-separated paths of the reports of the run to
+// write, if set, see writeReports.
+var reportFlag string
+
 // workersFlag controls how many maps are processed concurrently, bounding peak memory usage.
 var workersFlag int
 
@@ -83,91 +116,226 @@ func inputMapDir(isTest bool) (string, error) {
 	}
 }
 
+// findMapInputDir returns the input folder of the named map, for the
+// commands that work on a single map.
+func findMapInputDir(name string) (string, error) {
+	discovered, err := discoverMaps()
+	if err != nil {
+		return "", err
+	}
+	for _, m := range discovered {
+		if m.Name != name {
+			continue
+		}
+		inDir, err := inputMapDir(m.IsTest)
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(inDir, m.Name), nil
+	}
+	return "", fmt.Errorf("unknown map %q", name)
+}
+
 // processMap handles the end-to-end generation for a single map.
 // It reads the source image and JSON, generates the terrain data, and writes the binary outputs and updated manifest.
-func processMap(ctx context.Context, name string, isTest bool) error {
+// Maps whose sources and generator version match the existing manifest are
+// skipped unless --force is set.
+func processMap(ctx context.Context, name string, isTest bool, layers []string) (mapStatus, error) {
+	logger := mapgen.LoggerFromContext(ctx)
 	outputMapBaseDir, err := outputMapDir(isTest)
 	if err != nil {
-		return fmt.Errorf("failed to get map directory: %w", err)
+		return mapFailed, fmt.Errorf("failed to get map directory: %w", err)
 	}
 
 	inputMapDir, err := inputMapDir(isTest)
 	if err != nil {
-		return fmt.Errorf("failed to get input map directory: %w", err)
+		return mapFailed, fmt.Errorf("failed to get input map directory: %w", err)
 	}
 
-	inputPath := filepath.Join(inputMapDir, name, "image.png")
-	imageBuffer, err := os.ReadFile(inputPath)
+	// Read the info.json file
+	manifestPath := filepath.Join(inputMapDir, name, "info.json")
+	manifestBuffer, err := readInfoJSON(manifestPath)
 	if err != nil {
-		return fmt.Errorf("failed to read map file %s: %w", inputPath, err)
+		return mapFailed, fmt.Errorf("failed to read info file %s: %w", manifestPath, err)
 	}
 
-	// Read the info.json file
-	manifestPath := filepath.Join(inputMapDir, name, "info.json")
-	manifestBuffer, err := os.ReadFile(manifestPath)
+	mapDir := filepath.Join(outputMapBaseDir, name)
+	var status struct {
+		Archived bool `json:"archived"`
+	}
+	if err := json.Unmarshal(manifestBuffer, &status); err != nil {
+		return mapFailed, fmt.Errorf("failed to parse info.json for %s: %w", name, err)
+	}
+	if status.Archived {
+		// Archived maps are out of rotation but must stay loadable for
+		// replays, so their committed outputs are checked, never rebuilt.
+		if err := verifyMapDir(mapDir); err != nil {
+			return mapFailed, fmt.Errorf("archived map %s has invalid outputs: %w", name, err)
+		}
+		logger.Info(fmt.Sprintf("Skipping %s: archived, existing outputs verified", name))
+		return mapArchived, nil
+	}
+
+	imageBuffer, err := readSourceImage(ctx, filepath.Join(inputMapDir, name), manifestBuffer)
+	if err != nil {
+		return mapFailed, fmt.Errorf("failed to read source image for %s: %w", name, err)
+	}
+
+	auxInputs, err := readAuxInputs(filepath.Join(inputMapDir, name))
 	if err != nil {
-		return fmt.Errorf("failed to read info file %s: %w", manifestPath, err)
+		return mapFailed, fmt.Errorf("failed to read auxiliary inputs for %s: %w", name, err)
+	}
+
+	hash := sourceHash(append([][]byte{imageBuffer, manifestBuffer}, auxInputHashParts(auxInputs)...)...)
+	// Outputs built without --strict may hide warnings that it fails on, so
+	// --strict regenerates every map as --force does.
+	if !forceFlag && !strictFlag && outputsUpToDate(mapDir, hash, layers, mapformat.TileFormat(tileFormatFlag)) {
+		logger.Info(fmt.Sprintf("Skipping %s: sources and generator version unchanged", name))
+		return mapSkipped, nil
+	}
+
+	// Upgrade info.json files written for an older schema in memory
+	manifestBuffer, infoSchemaVersion, err := migrateInfoBuffer(manifestBuffer)
+	if err != nil {
+		return mapFailed, fmt.Errorf("failed to migrate info.json for %s: %w", name, err)
+	}
+	if infoSchemaVersion != schemaVersion {
+		logger.Debug(fmt.Sprintf("info.json uses schema_version %d, run `go run . migrate` to upgrade it to %d", infoSchemaVersion, schemaVersion))
 	}
 
 	// Parse the info buffer as dynamic JSON
 	var manifest map[string]interface{}
 	if err := json.Unmarshal(manifestBuffer, &manifest); err != nil {
-		return fmt.Errorf("failed to parse info.json for %s: %w", name, err)
+		return mapFailed, fmt.Errorf("failed to parse info.json for %s: %w", name, err)
+	}
+
+	config, err := mapgen.ParseGeneratorConfig(manifestBuffer)
+	if err != nil {
+		return mapFailed, fmt.Errorf("invalid info.json for %s: %w", name, err)
+	}
+	if isTest {
+		// Don't remove small islands for test maps; the manifest says so.
+		config.RemoveSmall = false
+	}
+
+	if explainFlag != "" {
+		x, y, err := parseQueryCoordinates(explainFlag)
+		if err != nil {
+			return mapFailed, fmt.Errorf("invalid --explain: %w", err)
+		}
+		ctx = mapgen.ContextWithExplainer(ctx, mapgen.NewTileExplainer(x, y, logger))
+	}
+	var problems *mapgen.ProblemRecorder
+	if annotateDirFlag != "" || strictFlag {
+		problems = &mapgen.ProblemRecorder{}
+		ctx = mapgen.ContextWithProblems(ctx, problems)
 	}
 
 	// Generate maps
-	result, err := GenerateMap(ctx, GeneratorArgs{
+	result, err := mapgen.GenerateMap(ctx, mapgen.GeneratorArgs{
 		ImageBuffer: imageBuffer,
-		RemoveSmall: !isTest, // Don't remove small islands for test maps
+		RemoveSmall: config.RemoveSmall,
 		Name:        name,
+		Layers:      layers,
+		Info:        manifestBuffer,
+		Inputs:      auxInputs,
+		Config:      config,
+		Strict:      strictFlag,
+		TileFormat:  mapformat.TileFormat(tileFormatFlag),
 	})
+	if annotateDirFlag != "" {
+		// Annotate failed maps too: their problems are the most wanted.
+		err = errors.Join(err, writeProblemAnnotations(ctx, name, problems))
+	}
 	if err != nil {
-		return fmt.Errorf("failed to generate map for %s: %w", name, err)
+		return mapFailed, fmt.Errorf("failed to generate map for %s: %w", name, err)
 	}
-
-	manifest["map"] = map[string]interface{}{
-		"width":          result.Map.Width,
-		"height":         result.Map.Height,
-		"num_land_tiles": result.Map.NumLandTiles,
+	if strictFlag {
+		warnStrictProblems(ctx, problems)
 	}
-	manifest["map4x"] = map[string]interface{}{
-		"width":          result.Map4x.Width,
-		"height":         result.Map4x.Height,
-		"num_land_tiles": result.Map4x.NumLandTiles,
+
+	players, err := mapgen.ApplyPlayerCountOverrides(mapgen.RecommendPlayerCounts(result.Stats), manifestBuffer)
+	if err != nil {
+		return mapFailed, fmt.Errorf("invalid player counts for %s: %w", name, err)
 	}
-	manifest["map16x"] = map[string]interface{}{
-		"width":          result.Map16x.Width,
-		"height":         result.Map16x.Height,
-		"num_land_tiles": result.Map16x.NumLandTiles,
+	logger.Debug(fmt.Sprintf("Players: min %d, recommended %d, max %d", players.Min, players.Recommended, players.Max))
+	metrics := newMapMetrics(result.Stats, result.Salinity)
+	logger.Debug(fmt.Sprintf("Style: %s (largest landmass %.0f%% of land, %.0f%% water, coastline roughness %.2f)", metrics.Style, 100*metrics.LargestLandmassShare, 100*metrics.WaterShare, metrics.CoastlineRoughness))
+	if err := checkQualityGates(ctx, config.QualityGates, mapDir, result); err != nil {
+		return mapFailed, fmt.Errorf("%s: %w", name, err)
 	}
+	addGeneratedSections(manifest, config, result, players, metrics)
+	manifest["source_hash"] = hash
+	manifest["generator_version"] = mapgen.GeneratorVersion
+	manifest["schema_version"] = schemaVersion
 
-	mapDir := filepath.Join(outputMapBaseDir, name)
 	if err := os.MkdirAll(mapDir, 0755); err != nil {
-		return fmt.Errorf("failed to create output directory for %s: %w", name, err)
-	}
-	if err := os.WriteFile(filepath.Join(mapDir, "map.bin"), result.Map.Data, 0644); err != nil {
-		return fmt.Errorf("failed to write combined binary for %s: %w", name, err)
+		return mapFailed, fmt.Errorf("failed to create output directory for %s: %w", name, err)
+	}
+	outputs := []struct {
+		File string
+		Data []byte
+	}{
+		{"map.bin", result.Map.Data},
+		{"map4x.bin", result.Map4x.Data},
+		{"map16x.bin", result.Map16x.Data},
+		{"thumbnail.webp", result.Thumbnail},
+	}
+	for _, layer := range result.Layers {
+		outputs = append(outputs, struct {
+			File string
+			Data []byte
+		}{layer.File, layer.Data})
+	}
+	files := make(map[string][]byte, len(outputs))
+	for _, output := range outputs {
+		files[output.File] = output.Data
+	}
+	patches, patchData, err := buildPatches(ctx, mapDir, files)
+	if err != nil {
+		return mapFailed, fmt.Errorf("failed to build patches for %s: %w", name, err)
+	}
+	if len(patches) > 0 {
+		manifest["patches"] = patches
+		for _, f := range mapScaleFiles {
+			if p, ok := patches[f.File]; ok {
+				outputs = append(outputs, struct {
+					File string
+					Data []byte
+				}{p.File, patchData[p.File]})
+			}
+		}
 	}
-	if err := os.WriteFile(filepath.Join(mapDir, "map4x.bin"), result.Map4x.Data, 0644); err != nil {
-		return fmt.Errorf("failed to write combined binary for %s: %w", name, err)
+	checksums := make(map[string]string, len(outputs))
+	for _, output := range outputs {
+		if err := os.WriteFile(filepath.Join(mapDir, output.File), output.Data, 0644); err != nil {
+			return mapFailed, fmt.Errorf("failed to write %s for %s: %w", output.File, name, err)
+		}
+		checksums[output.File] = sha256Hex(output.Data)
 	}
-	if err := os.WriteFile(filepath.Join(mapDir, "map16x.bin"), result.Map16x.Data, 0644); err != nil {
-		return fmt.Errorf("failed to write combined binary for %s: %w", name, err)
+	manifest["checksums"] = checksums
+	if err := removeStaleLayers(mapDir, result.Layers); err != nil {
+		return mapFailed, fmt.Errorf("failed to remove stale layers for %s: %w", name, err)
 	}
-	if err := os.WriteFile(filepath.Join(mapDir, "thumbnail.webp"), result.Thumbnail, 0644); err != nil {
-		return fmt.Errorf("failed to write thumbnail for %s: %w", name, err)
+	if err := removeStalePatches(mapDir, patches); err != nil {
+		return mapFailed, fmt.Errorf("failed to remove stale patches for %s: %w", name, err)
 	}
 
 	// Serialize the updated manifest to JSON
 	updatedManifest, err := json.MarshalIndent(manifest, "", "  ")
 	if err != nil {
-		return fmt.Errorf("failed to serialize manifest for %s: %w", name, err)
+		return mapFailed, fmt.Errorf("failed to serialize manifest for %s: %w", name, err)
 	}
 
 	if err := os.WriteFile(filepath.Join(mapDir, "manifest.json"), updatedManifest, 0644); err != nil {
-		return fmt.Errorf("failed to write manifest for %s: %w", name, err)
+		return mapFailed, fmt.Errorf("failed to write manifest for %s: %w", name, err)
+	}
+
+	// Read everything back before declaring success
+	if err := verifyMapDir(mapDir); err != nil {
+		return mapFailed, fmt.Errorf("verification of written outputs for %s failed: %w", name, err)
 	}
-	return nil
+	return mapGenerated, nil
 }
 
 // parseMapsFlag validates and parses the --maps command-line argument.
@@ -192,97 +360,313 @@ func parseMapsFlag() (map[string]bool, error) {
 	return selected, nil
 }
 
+// sourceImageArea returns the pixel area of a map's source image, read from
+// the PNG header only. It returns 0 if the image can't be read; processMap
+// reports the actual error when the map is processed.
+func sourceImageArea(m mapEntry) int {
+	dir, err := inputMapDir(m.IsTest)
+	if err != nil {
+		return 0
+	}
+	f, err := os.Open(filepath.Join(dir, m.Name, "image.png"))
+	if errors.Is(err, os.ErrNotExist) {
+		// Maps with a remote source are sized from the cached copy, if any.
+		info, readErr := readInfoJSON(filepath.Join(dir, m.Name, "info.json"))
+		if readErr != nil {
+			return 0
+		}
+		source, parseErr := parseRemoteSource(info)
+		if parseErr != nil || source == nil {
+			return 0
+		}
+		f, err = os.Open(source.cachePath())
+	}
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	cfg, err := png.DecodeConfig(f)
+	if err != nil {
+		return 0
+	}
+	return cfg.Width * cfg.Height
+}
+
+// scheduleMaps returns the maps to process, largest source image first.
+// Generation time grows with map area, so starting the giant maps first keeps
+// them from being picked up last and leaving a single worker grinding while
+// the others sit idle.
+func scheduleMaps(selectedMaps map[string]bool) []mapEntry {
+	var scheduled []mapEntry
+	areas := make(map[mapEntry]int)
+	for _, m := range maps {
+		if selectedMaps != nil && !selectedMaps[m.Name] {
+			continue
+		}
+		scheduled = append(scheduled, m)
+		areas[m] = sourceImageArea(m)
+	}
+	sort.SliceStable(scheduled, func(i, j int) bool {
+		return areas[scheduled[i]] > areas[scheduled[j]]
+	})
+	return scheduled
+}
+
 // loadTerrainMaps manages the concurrent generation of all selected maps.
-// It spins up goroutines for each map and aggregates any errors.
-// Concurrency is bounded by --workers to cap peak memory usage.
-func loadTerrainMaps() error {
+// A pool of --workers goroutines takes maps from a queue ordered by
+// scheduleMaps, which caps peak memory usage. It returns the outcome of every
+// processed map and the first error encountered, if any.
+func loadTerrainMaps() ([]mapOutcome, error) {
 	if workersFlag < 1 {
-		return fmt.Errorf("--workers must be >= 1, got %d", workersFlag)
+		return nil, fmt.Errorf("--workers must be >= 1, got %d", workersFlag)
 	}
 	selectedMaps, err := parseMapsFlag()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	layers, err := parseLayersFlag()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := containerFormats[containerFlag]; containerFlag != "" && !ok {
+		return nil, fmt.Errorf("--container must be one of: %s, %s", containerProto, containerFlatBuffers)
+	}
+	if reportFlag != "" {
+		if err := checkReportPaths(reportFlag); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := bundleCompressions[bundleFlag]; bundleFlag != "" && !ok {
+		return nil, fmt.Errorf("--bundle must be one of: gzip, zstd")
+	}
+	if downloadBudgetFlag < 0 {
+		return nil, fmt.Errorf("--download-budget-kib must not be negative, got %d", downloadBudgetFlag)
+	}
+	if chunkSizeFlag != 0 && (chunkSizeFlag < minChunkSize || chunkSizeFlag > maxChunkSize) {
+		return nil, fmt.Errorf("--chunk-size must be 0 or between %d and %d, got %d", minChunkSize, maxChunkSize, chunkSizeFlag)
 	}
+	if explainFlag != "" {
+		if _, _, err := parseQueryCoordinates(explainFlag); err != nil {
+			return nil, fmt.Errorf("invalid --explain: %w", err)
+		}
+	}
+	var signKey ed25519.PrivateKey
+	if signKeyFlag != "" {
+		signKey, err = readPrivateKey(signKeyFlag)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signing key: %w", err)
+		}
+	}
+	scheduled := scheduleMaps(selectedMaps)
+	if err := preflight(context.Background(), scheduled, currentOutputPlan(layers)); err != nil {
+		return nil, fmt.Errorf("preflight check failed: %w", err)
+	}
+
 	var wg sync.WaitGroup
-	errChan := make(chan error, len(maps))
-	sem := make(chan struct{}, workersFlag)
+	outcomeChan := make(chan mapOutcome, len(scheduled))
+	queue := make(chan mapEntry, len(scheduled))
+	for _, mapItem := range scheduled {
+		queue <- mapItem
+	}
+	close(queue)
 
-	// Process maps concurrently, bounded by the semaphore
-	for _, mapItem := range maps {
-		if selectedMaps != nil && !selectedMaps[mapItem.Name] {
-			continue
-		}
+	// Process maps concurrently; workers pull from the queue in order
+	for w := 0; w < workersFlag; w++ {
 		wg.Add(1)
-		mapItem := mapItem
 		go func() {
 			defer wg.Done()
-			sem <- struct{}{}
-			defer func() { <-sem }()
-			mapLogTag := slog.String("map", mapItem.Name)
-			testLogTag := slog.Bool("isTest", mapItem.IsTest)
-			logger := slog.Default().With(mapLogTag).With(testLogTag)
-			ctx := ContextWithLogger(context.Background(), logger)
-			if err := processMap(ctx, mapItem.Name, mapItem.IsTest); err != nil {
-				errChan <- err
+			for mapItem := range queue {
+				mapLogTag := slog.String("map", mapItem.Name)
+				testLogTag := slog.Bool("isTest", mapItem.IsTest)
+				recorder := newWarningRecorder(slog.Default().Handler())
+				logger := slog.New(recorder).With(mapLogTag).With(testLogTag)
+				ctx := mapgen.ContextWithLogger(context.Background(), logger)
+				previousSize := clientDownloadSize(mapItem)
+				start := time.Now()
+				status, err := processMap(ctx, mapItem.Name, mapItem.IsTest, layers)
+				// Archived maps keep their committed outputs, but are
+				// signed as well, so that verify -keys accepts every map
+				// that can still be loaded.
+				if err == nil && signKey != nil {
+					if err = signMapOutputs(mapItem, signKey); err != nil {
+						status = mapFailed
+					}
+				}
+				var compressed *compressedSizes
+				if err == nil {
+					if compressed, err = precompressMapOutputs(mapItem); err != nil {
+						status = mapFailed
+					}
+				}
+				if err == nil {
+					if err = writeMapContainer(mapItem); err != nil {
+						status = mapFailed
+					}
+				}
+				if err == nil {
+					if err = writeMapAnalytics(mapItem); err != nil {
+						status = mapFailed
+					}
+				}
+				if err == nil {
+					if err = writeMapBundle(ctx, mapItem); err != nil {
+						status = mapFailed
+					}
+				}
+				if err == nil {
+					if err = writeMapChunks(mapItem); err != nil {
+						status = mapFailed
+					}
+				}
+				if err == nil {
+					if err = writeSignedFiles(mapItem, signKey); err != nil {
+						status = mapFailed
+					}
+				}
+				if err == nil {
+					if err = checkDownloadBudget(ctx, mapItem); err != nil {
+						status = mapFailed
+					}
+				}
+				if err == nil {
+					if err = checkSymmetry(ctx, mapItem); err != nil {
+						status = mapFailed
+					}
+				}
+				if warnings := recorder.Warnings(); err == nil && strictFlag && len(warnings) > 0 {
+					err = fmt.Errorf("%s: %d warning(s) under --strict, the first: %s", mapItem.Name, len(warnings), warnings[0])
+					status = mapFailed
+				}
+				outcome := mapOutcome{
+					Entry:      mapItem,
+					Status:     status,
+					Duration:   time.Since(start),
+					Err:        err,
+					Warnings:   recorder.Warnings(),
+					Compressed: compressed,
+				}
+				outcome.Size, outcome.PreviousSize = clientDownloadSize(mapItem), previousSize
+				logMapResult(ctx, outcome)
+				outcomeChan <- outcome
 			}
 		}()
 	}
 
-	// Wait for all goroutines to complete
+	// Wait for all workers to complete
 	wg.Wait()
-	close(errChan)
-
-	// Check for errors
-	for err := range errChan {
-		if err != nil {
-			return err
+	close(outcomeChan)
+
+	var outcomes []mapOutcome
+	var firstErr error
+	for outcome := range outcomeChan {
+		outcomes = append(outcomes, outcome)
+		if outcome.Err != nil && firstErr == nil {
+			firstErr = outcome.Err
 		}
 	}
-
-	return nil
+	return outcomes, firstErr
 }
 
 // main is the entry point for the map generator tool.
-// It parses flags and triggers the map generation process.
+// It dispatches to a subcommand if one is named, otherwise it parses flags
+// and triggers the map generation process.
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == uploadWorkerCommand {
+		if err := runUploadWorker(os.Args[2:]); err != nil {
+			log.Fatalf("Error running %s: %v", uploadWorkerCommand, err)
+		}
+		return
+	}
+	if len(os.Args) > 1 {
+		if cmd, ok := findCommand(os.Args[1]); ok {
+			if err := cmd.Run(os.Args[2:]); err != nil {
+				log.Fatalf("Error running %s: %v", cmd.Name, err)
+			}
+			return
+		}
+	}
+
 	flag.StringVar(&mapsFlag, "maps", "", "optional comma-separated list of maps to process. ex: --maps=world,eastasia,big_plains")
 	flag.IntVar(&workersFlag, "workers", 4, "number of maps to process concurrently. reduce to lower peak memory usage.")
-	flag.StringVar(&logFlags.logLevel, "log-level", "", "Explicitly sets the log level to one of: ALL, DEBUG, INFO (default), WARN, ERROR.")
-	flag.BoolVar(&logFlags.verbose, "verbose", false, "Adds additional logging and prefixes logs with the [mapname].  Alias of log-level=DEBUG.")
-	flag.BoolVar(&logFlags.verbose, "v", false, "-verbose shorthand")
-	flag.BoolVar(&logFlags.performance, "log-performance", false, "Adds additional logging for performance-based recommendations, sets log-level=DEBUG")
-	flag.BoolVar(&logFlags.removal, "log-removal", false, "Adds additional logging of removed island and lake position/size, sets log-level=DEBUG")
+	flag.BoolVar(&forceFlag, "force", false, "regenerate maps even if their sources and the generator version are unchanged since the last build.")
+	flag.StringVar(&sourceCacheFlag, "source-cache", defaultSourceCacheDir(), "directory where source images referenced by a \"source\" url in info.json are cached.")
+	flag.StringVar(&layersFlag, "layers", "", "optional comma-separated list of auxiliary layers to build for each map, or \"all\". ex: --layers=spawn_weights")
+	flag.StringVar(&reportFlag, "report", "", "optional comma-separated paths of reports of the run to write, by extension: a self-contained .html report, or the analytics of every map as .json or .csv. ex: --report=report.html,maps.csv")
+	flag.BoolVar(&analyticsFlag, "analytics", false, "also write every processed map's analytics, such as its land and water percentages, landmass and lake sizes and elevation histogram, to an analytics.json next to its manifest.")
+	flag.StringVar(&annotateDirFlag, "annotate-dir", "", "optional directory to write a copy of the source image of every map with problems to, with removed islands and lakes, ambiguous coast pixels, unreachable land and misplaced nation spawns circled and numbered. ex: --annotate-dir=annotations")
+	flag.StringVar(&explainFlag, "explain", "", "optional full-scale pixel, as x,y, whose classification and every pass that changes it to log for each processed map, e.g. to find out why an island disappeared. ex: --explain=812,344")
+	flag.StringVar(&signKeyFlag, "sign-key", "", "optional path of an Ed25519 private key (see the keygen command) to sign every processed map's manifest and signed_files.json with.")
+	flag.BoolVar(&precompressFlag, "precompress", false, "also write Brotli (.br) and gzip (.gz) compressed copies of every map's binaries and manifest, and log their sizes.")
+	flag.StringVar(&cdnDirFlag, "cdn-dir", "", "optional directory to also write every map's outputs to under content-hashed names, with a cdn.json mapping. ex: --cdn-dir=dist/maps")
+	flag.StringVar(&containerFlag, "container", "", "optional single-file container of every map's outputs to also write: \"proto\" for map.pb (see map_container.proto) or \"flatbuffers\" for map.fb (see map_container.fbs).")
+	flag.StringVar(&bundleFlag, "bundle", "", "optional compression, \"gzip\" or \"zstd\", of a map.bundle of every map's manifest, binaries and thumbnail to also write, for clients loading a map with one request.")
+	flag.IntVar(&chunkSizeFlag, "chunk-size", 0, "optional side, in tiles, of the chunks of a map.chunks copy of every map's map.bin to also write, for clients fetching visible regions with range requests. ex: --chunk-size=256")
+	flag.IntVar(&downloadBudgetFlag, "download-budget-kib", 0, "optional maximum size, in KiB, of what a player downloads for a map, warned about when exceeded. \"generator.download_budget_kib\" overrides it per map.")
+	flag.BoolVar(&enforceDownloadBudgetFlag, "enforce-download-budget", false, "fail maps over their download budget instead of warning about them.")
+	flag.BoolVar(&strictFlag, "strict", false, "fail every map that logs a warning, such as land lost to cropping, antialiased coast pixels, unreachable land or nation spawns off land, or a download budget or symmetry threshold exceeded. Regenerates every map, as --force does.")
+	flag.StringVar(&notifyWebhookFlag, "notify-webhook", "", "optional Discord webhook URL to post a summary of the run to: rebuilt and failed maps with their thumbnails, errors, warnings and download size changes.")
+	flag.IntVar(&tileFormatFlag, "tile-format", int(mapformat.TileFormat1), "tile format of the packed maps, see mapformat.TileFormat: 1, which every client reads, or 2, which keeps ice and lava apart from the void and adds a river bit to water tiles, for clients that decode it.")
+	flag.BoolVar(&waitFlag, "wait", false, "wait for another running generator to release the output directory lock instead of failing.")
+	registerLogFlags(flag.CommandLine, &logFlags)
+	flag.Usage = printUsage
 	flag.Parse()
 
-	logger := slog.New(NewGeneratorLogger(
-		os.Stdout,
-		&slog.HandlerOptions{
-			Level: DetermineLogLevel(logFlags),
-		},
-		logFlags,
-	))
+	setupLogging(logFlags)
+	if !mapformat.TileFormat(tileFormatFlag).Valid() {
+		log.Fatalf("Error: --tile-format must be 1 to %d, got %d", mapformat.LatestTileFormat, tileFormatFlag)
+	}
 
-	slog.SetDefault(logger)
+	release, err := lockGeneratorOutputs(context.Background(), waitFlag)
+	if err != nil {
+		log.Fatalf("Error locking output directory: %v", err)
+	}
+	defer release()
+	// log.Fatalf skips deferred calls, so the lock is released explicitly
+	// before exiting on an error.
+	fatalf := func(format string, v ...any) {
+		release()
+		log.Fatalf(format, v...)
+	}
 
 	discovered, err := discoverMaps()
 	if err != nil {
-		log.Fatalf("Error discovering maps: %v", err)
+		fatalf("Error discovering maps: %v", err)
 	}
 	maps = discovered
 
-	if err := loadTerrainMaps(); err != nil {
-		log.Fatalf("Error generating terrain maps: %v", err)
+	outcomes, err := loadTerrainMaps()
+	logRunSummary(context.Background(), outcomes)
+	if reportFlag != "" {
+		if reportErr := writeReports(reportFlag, outcomes); reportErr != nil {
+			slog.Error(fmt.Sprintf("Failed to write report: %v", reportErr))
+		}
+	}
+	if notifyWebhookFlag != "" {
+		if notifyErr := notifyWebhook(context.Background(), notifyWebhookFlag, outcomes); notifyErr != nil {
+			slog.Error(fmt.Sprintf("Failed to post the run summary to the webhook: %v", notifyErr))
+		} else {
+			slog.Info("Posted the run summary to the webhook")
+		}
+	}
+	if err != nil {
+		fatalf("Error generating terrain maps: %v", err)
+	}
+
+	if cdnDirFlag != "" {
+		if err := writeCDNOutput(context.Background(), cdnDirFlag, outcomes); err != nil {
+			fatalf("Error writing CDN output: %v", err)
+		}
 	}
 
 	infos, err := loadMapInfos()
 	if err != nil {
-		log.Fatalf("Error loading map info: %v", err)
+		fatalf("Error loading map info: %v", err)
 	}
 	if err := generateMapsTS(infos); err != nil {
-		log.Fatalf("Error generating Maps.gen.ts: %v", err)
+		fatalf("Error generating Maps.gen.ts: %v", err)
 	}
 	if err := generateEnJSON(infos); err != nil {
-		log.Fatalf("Error generating en.json map section: %v", err)
+		fatalf("Error generating en.json map section: %v", err)
 	}
 
 	fmt.Println("Terrain maps generated successfully")
@@ -0,0 +1,46 @@
+package main
+
+import "github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+
+// manifestScale is the manifest section describing one packed map scale
+// ("map", "map4x" and "map16x").
+type manifestScale struct {
+	Width        int `json:"width"`
+	Height       int `json:"height"`
+	NumLandTiles int `json:"num_land_tiles"`
+}
+
+// newManifestScale returns the manifest section for a generated scale.
+func newManifestScale(info mapgen.MapInfo) manifestScale {
+	return manifestScale{
+		Width:        info.Width,
+		Height:       info.Height,
+		NumLandTiles: info.NumLandTiles,
+	}
+}
+
+// addGeneratedSections adds the sections the generator derives from a
+// generated map to its manifest, which holds the fields of its info.json.
+// Keep it in step with manifestSections.
+func addGeneratedSections(manifest map[string]any, config mapgen.GeneratorConfig, result mapgen.MapResult, players mapgen.PlayerCounts, metrics mapMetrics) {
+	manifest["map"] = newManifestScale(result.Map)
+	manifest["map4x"] = newManifestScale(result.Map4x)
+	manifest["map16x"] = newManifestScale(result.Map16x)
+	manifest["generator"] = config
+	manifest["tile_format"] = result.TileFormat
+	if result.Geo != nil {
+		manifest["geo"] = result.Geo.Manifest(result.Map.Width, result.Map.Height)
+	}
+	manifest["players"] = players
+	manifest["continents"] = result.Continents
+	if result.Cities != nil {
+		manifest["cities"] = result.Cities
+	}
+	if result.Spawns != nil {
+		manifest["spawns"] = result.Spawns
+	}
+	manifest["stats"] = metrics
+	if len(result.Layers) > 0 {
+		manifest["layers"] = manifestLayers(result.Layers)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+// availableMemory is not implemented on this platform; the doctor memory
+// check only reports what the maps need.
+func availableMemory() (bytes uint64, ok bool) {
+	return 0, false
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"math"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+// Map styles used for lobby filtering.
+const (
+	styleContinental = "continental"
+	styleNavalHeavy  = "naval-heavy"
+	styleMixed       = "mixed"
+)
+
+// islandSizeBuckets are the upper bounds (exclusive) of the landmass size
+// buckets in mapMetrics.IslandSizes; the last bucket is unbounded.
+var islandSizeBuckets = []int{1000, 10000, 100000}
+
+// mapMetrics is the manifest "stats" section: geography metrics that let
+// maps be compared and categorised automatically.
+type mapMetrics struct {
+	LandTiles  int     `json:"land_tiles"`
+	WaterTiles int     `json:"water_tiles"`
+	WaterShare float64 `json:"water_share"` // of passable tiles
+	// CoastlineRatio is the share of land tiles that touch water.
+	CoastlineRatio float64 `json:"coastline_ratio"`
+	// CoastlineRoughness compares the coastline with that of a single round
+	// island of the same land area: 1 for a disc, higher for rugged or
+	// fragmented land.
+	CoastlineRoughness   float64 `json:"coastline_roughness"`
+	Landmasses           int     `json:"landmasses"`
+	LargestLandmassShare float64 `json:"largest_landmass_share"`
+	// IslandSizes counts landmasses by size: under 1k, 1k-10k, 10k-100k
+	// and 100k+ tiles.
+	IslandSizes []int `json:"island_sizes"`
+	// Salt water is connected to the ocean and fresh water is in inland
+	// lakes, see classifySalinity.
+	SaltWaterTiles   int `json:"salt_water_tiles"`
+	FreshWaterTiles  int `json:"fresh_water_tiles"`
+	SaltWaterBodies  int `json:"salt_water_bodies"`
+	FreshWaterBodies int `json:"fresh_water_bodies"`
+	// RemovedIslands and RemovedLakes count the small bodies the generator
+	// removed from the source image.
+	RemovedIslands int `json:"removed_islands"`
+	RemovedLakes   int `json:"removed_lakes"`
+	// AmbiguousCoastPixels counts the antialiased coast pixels of the
+	// source image, resolved by their neighbours with
+	// "generator.coast_resolution": "majority".
+	AmbiguousCoastPixels int    `json:"ambiguous_coast_pixels"`
+	Style                string `json:"style"`
+}
+
+// newMapMetrics derives the manifest metrics from the map's stats and water
+// salinity. The style is "continental" when one landmass holds at least 75%
+// of the land and water is under 60% of the map, "naval-heavy" when no
+// landmass holds 40% of the land or water is at least 70% of the map, and
+// "mixed" otherwise.
+func newMapMetrics(stats mapgen.MapStats, salinity *mapgen.WaterSalinity) mapMetrics {
+	round := func(v float64) float64 { return math.Round(v*1000) / 1000 }
+	m := mapMetrics{
+		LandTiles:            stats.LandTiles,
+		WaterTiles:           stats.WaterTiles,
+		Landmasses:           len(stats.LandmassSizes),
+		LargestLandmassShare: round(stats.LargestLandmassShare()),
+		IslandSizes:          make([]int, len(islandSizeBuckets)+1),
+		SaltWaterTiles:       salinity.SaltTiles,
+		FreshWaterTiles:      salinity.FreshTiles,
+		SaltWaterBodies:      salinity.SaltBodies,
+		FreshWaterBodies:     salinity.FreshBodies,
+		RemovedIslands:       stats.RemovedIslands,
+		RemovedLakes:         stats.RemovedLakes,
+		AmbiguousCoastPixels: stats.AmbiguousCoastPixels,
+	}
+	if passable := stats.LandTiles + stats.WaterTiles; passable > 0 {
+		m.WaterShare = round(float64(stats.WaterTiles) / float64(passable))
+	}
+	if stats.LandTiles > 0 {
+		m.CoastlineRatio = round(float64(stats.ShorelineTiles) / float64(stats.LandTiles))
+		m.CoastlineRoughness = round(float64(stats.ShorelineTiles) / (2 * math.Sqrt(math.Pi*float64(stats.LandTiles))))
+	}
+	for _, size := range stats.LandmassSizes {
+		bucket := len(islandSizeBuckets)
+		for i, limit := range islandSizeBuckets {
+			if size < limit {
+				bucket = i
+				break
+			}
+		}
+		m.IslandSizes[bucket]++
+	}
+	switch {
+	case m.LargestLandmassShare >= 0.75 && m.WaterShare < 0.6:
+		m.Style = styleContinental
+	case m.LargestLandmassShare < 0.4 || m.WaterShare >= 0.7:
+		m.Style = styleNavalHeavy
+	default:
+		m.Style = styleMixed
+	}
+	return m
+}
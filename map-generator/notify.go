@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+// notifyWebhookFlag is the optional Discord webhook URL a summary of every
+// run is posted to, see notifyWebhook.
+var notifyWebhookFlag string
+
+// Discord caps the embeds of a message, the length of their fields and the
+// combined text of the embeds of a message; the summary is split and
+// truncated to stay within them.
+const (
+	maxWebhookEmbeds      = 10
+	maxWebhookDescription = 4096
+	maxWebhookEmbedTotal  = 6000
+	maxWebhookWarnings    = 3   // warnings quoted per map, the rest counted
+	maxWebhookWarningLen  = 300 // characters of each quoted warning
+	webhookTimeout        = 30 * time.Second
+	maxWebhookRetryAfter  = 10 * time.Second
+)
+
+// Embed colours of the map statuses.
+var webhookColors = map[mapStatus]int{
+	mapGenerated: 0x2ecc71,
+	mapArchived:  0x3498db,
+	mapFailed:    0xc0392b,
+}
+
+// webhookWarnedColor is the embed colour of maps generated with warnings.
+const webhookWarnedColor = 0xe67e22
+
+// webhookMessage is the payload of a Discord webhook message.
+type webhookMessage struct {
+	Username    string              `json:"username"`
+	Content     string              `json:"content,omitempty"`
+	Embeds      []webhookEmbed      `json:"embeds,omitempty"`
+	Attachments []webhookAttachment `json:"attachments,omitempty"`
+}
+
+// webhookEmbed is one map's entry in a webhook message.
+type webhookEmbed struct {
+	Title       string            `json:"title"`
+	Description string            `json:"description"`
+	Color       int               `json:"color"`
+	Thumbnail   *webhookThumbnail `json:"thumbnail,omitempty"`
+}
+
+type webhookThumbnail struct {
+	URL string `json:"url"`
+}
+
+// webhookAttachment declares a file uploaded with a message, referenced by
+// embeds as attachment://<filename>.
+type webhookAttachment struct {
+	ID       int    `json:"id"`
+	Filename string `json:"filename"`
+}
+
+// webhookFile is a file uploaded with a message.
+type webhookFile struct {
+	Name string
+	Data []byte
+}
+
+// clientDownloadSize returns the total size of a map's clientDownloadFiles
+// as currently written, or 0 if the map has not been generated.
+func clientDownloadSize(m mapEntry) int64 {
+	outDir, err := outputMapDir(m.IsTest)
+	if err != nil {
+		return 0
+	}
+	var size int64
+	for _, name := range clientDownloadFiles {
+		info, err := os.Stat(filepath.Join(outDir, m.Name, name))
+		if err != nil {
+			return 0
+		}
+		size += info.Size()
+	}
+	return size
+}
+
+// formatSizeDelta formats the change of a download size, e.g. "+12.0 KiB".
+func formatSizeDelta(before, after int64) string {
+	switch {
+	case after > before:
+		return "+" + formatBytes(uint64(after-before))
+	case after < before:
+		return "-" + formatBytes(uint64(before-after))
+	}
+	return "unchanged"
+}
+
+// notifyWebhook posts a summary of a run to a Discord webhook, so that map
+// maintainers coordinating there see it without relaying it by hand: the
+// counts of the run summary, then every rebuilt or failed map with its
+// thumbnail attached, its error, its first warnings and the change of its
+// download size. Maps skipped as unchanged are only counted. Runs that
+// processed nothing are not posted. A new message is started before one
+// would exceed maxWebhookEmbeds or maxWebhookEmbedTotal.
+func notifyWebhook(ctx context.Context, webhookURL string, outcomes []mapOutcome) error {
+	if len(outcomes) == 0 {
+		return nil
+	}
+	counts := make(map[mapStatus]int)
+	var notable []mapOutcome
+	warnings := 0
+	for _, o := range outcomes {
+		counts[o.Status]++
+		warnings += len(o.Warnings)
+		if o.Status != mapSkipped {
+			notable = append(notable, o)
+		}
+	}
+	sort.Slice(notable, func(i, j int) bool {
+		if notable[i].Entry.IsTest != notable[j].Entry.IsTest {
+			return !notable[i].Entry.IsTest
+		}
+		return notable[i].Entry.Name < notable[j].Entry.Name
+	})
+
+	content := fmt.Sprintf("**Map generator run**: %d generated, %d skipped, %d archived, %d failed, %d warning(s)",
+		counts[mapGenerated], counts[mapSkipped], counts[mapArchived], counts[mapFailed], warnings)
+	msg := webhookMessage{Username: "Map generator", Content: content}
+	var files []webhookFile
+	total := 0
+	for _, o := range notable {
+		embed := webhookMapEmbed(o)
+		size := webhookEmbedLen(embed)
+		if len(msg.Embeds) == maxWebhookEmbeds || (len(msg.Embeds) > 0 && total+size > maxWebhookEmbedTotal) {
+			if err := postWebhook(ctx, webhookURL, msg, files); err != nil {
+				return err
+			}
+			msg = webhookMessage{Username: "Map generator"}
+			files = nil
+			total = 0
+		}
+		if thumbnail, ok := readWebhookThumbnail(o.Entry); ok {
+			name := fmt.Sprintf("%s.webp", o.Entry.Name)
+			msg.Attachments = append(msg.Attachments, webhookAttachment{ID: len(files), Filename: name})
+			files = append(files, webhookFile{Name: name, Data: thumbnail})
+			embed.Thumbnail = &webhookThumbnail{URL: "attachment://" + name}
+		}
+		msg.Embeds = append(msg.Embeds, embed)
+		total += size
+	}
+	return postWebhook(ctx, webhookURL, msg, files)
+}
+
+// webhookEmbedLen returns the characters of an embed that count towards
+// maxWebhookEmbedTotal.
+func webhookEmbedLen(e webhookEmbed) int {
+	return utf8.RuneCountInString(e.Title) + utf8.RuneCountInString(e.Description)
+}
+
+// webhookMapEmbed describes one processed map.
+func webhookMapEmbed(o mapOutcome) webhookEmbed {
+	title := o.Entry.Name
+	if o.Entry.IsTest {
+		title += " (test map)"
+	}
+	color := webhookColors[o.Status]
+	if o.Status != mapFailed && len(o.Warnings) > 0 {
+		color = webhookWarnedColor
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "**%s** in %s", o.Status, o.Duration.Round(time.Millisecond))
+	if o.Size > 0 {
+		fmt.Fprintf(&b, "\nDownload %s", formatBytes(uint64(o.Size)))
+		if o.PreviousSize > 0 {
+			fmt.Fprintf(&b, " (%s)", formatSizeDelta(o.PreviousSize, o.Size))
+		} else {
+			b.WriteString(" (new)")
+		}
+	}
+	if o.Err != nil {
+		fmt.Fprintf(&b, "\nError: %s", truncateWebhookText(o.Err.Error(), maxWebhookWarningLen))
+	}
+	for i, w := range o.Warnings {
+		if i == maxWebhookWarnings {
+			fmt.Fprintf(&b, "\n…and %d more warning(s)", len(o.Warnings)-i)
+			break
+		}
+		fmt.Fprintf(&b, "\n⚠ %s", truncateWebhookText(w, maxWebhookWarningLen))
+	}
+	return webhookEmbed{
+		Title:       title,
+		Description: truncateWebhookText(b.String(), maxWebhookDescription),
+		Color:       color,
+	}
+}
+
+// truncateWebhookText cuts s to at most n characters, marking the cut.
+func truncateWebhookText(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
+
+// readWebhookThumbnail reads the thumbnail of a map, if it has one.
+func readWebhookThumbnail(m mapEntry) ([]byte, bool) {
+	outDir, err := outputMapDir(m.IsTest)
+	if err != nil {
+		return nil, false
+	}
+	data, err := os.ReadFile(filepath.Join(outDir, m.Name, "thumbnail.webp"))
+	return data, err == nil
+}
+
+// postWebhook posts one message with its files as a multipart form. A rate
+// limited post is retried once, after the wait the server asks for.
+func postWebhook(ctx context.Context, webhookURL string, msg webhookMessage, files []webhookFile) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	if err := form.WriteField("payload_json", string(payload)); err != nil {
+		return err
+	}
+	for i, f := range files {
+		part, err := form.CreateFormFile(fmt.Sprintf("files[%d]", i), f.Name)
+		if err != nil {
+			return err
+		}
+		if _, err := part.Write(f.Data); err != nil {
+			return err
+		}
+	}
+	if err := form.Close(); err != nil {
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		retryAfter, err := sendWebhook(ctx, webhookURL, form.FormDataContentType(), body.Bytes())
+		if retryAfter == 0 || attempt > 0 {
+			return err
+		}
+		mapgen.LoggerFromContext(ctx).Debug(fmt.Sprintf("Webhook rate limited, retrying in %s", retryAfter))
+		select {
+		case <-time.After(retryAfter):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// sendWebhook makes one post. When rate limited, it returns how long to wait
+// before retrying, capped at maxWebhookRetryAfter.
+func sendWebhook(ctx context.Context, webhookURL, contentType string, body []byte) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// the URL holds the webhook's token, so it is kept out of errors
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return 0, fmt.Errorf("failed to post to the webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode == http.StatusTooManyRequests {
+		wait := time.Second
+		if s, err := strconv.ParseFloat(resp.Header.Get("Retry-After"), 64); err == nil && s > 0 {
+			wait = time.Duration(s * float64(time.Second))
+		}
+		return min(wait, maxWebhookRetryAfter), fmt.Errorf("webhook rate limited: %s", resp.Status)
+	}
+	if resp.StatusCode/100 != 2 {
+		return 0, fmt.Errorf("webhook answered %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return 0, nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// jsonObject is a JSON object that remembers the order of its keys, so that
+// tools rewriting hand-authored files (info.json, committed manifests) only
+// change what they mean to change. Values are *jsonObject, []any, string,
+// json.Number, bool or nil.
+type jsonObject struct {
+	keys   []string
+	values map[string]any
+}
+
+// newJSONObject returns an empty jsonObject.
+func newJSONObject() *jsonObject {
+	return &jsonObject{values: make(map[string]any)}
+}
+
+// decodeJSONObject parses data, which must hold a single JSON object.
+func decodeJSONObject(data []byte) (*jsonObject, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	value, err := decodeOrderedValue(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after the top-level object")
+	}
+	obj, ok := value.(*jsonObject)
+	if !ok {
+		return nil, fmt.Errorf("expected a JSON object")
+	}
+	return obj, nil
+}
+
+func decodeOrderedValue(dec *json.Decoder) (any, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			obj := newJSONObject()
+			for dec.More() {
+				keyTok, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				key := keyTok.(string)
+				value, err := decodeOrderedValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				obj.Set(key, value)
+			}
+			if _, err := dec.Token(); err != nil {
+				return nil, err
+			}
+			return obj, nil
+		case '[':
+			arr := []any{}
+			for dec.More() {
+				value, err := decodeOrderedValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				arr = append(arr, value)
+			}
+			if _, err := dec.Token(); err != nil {
+				return nil, err
+			}
+			return arr, nil
+		}
+		return nil, fmt.Errorf("unexpected delimiter %q", t)
+	default:
+		return t, nil
+	}
+}
+
+// Get returns the value stored under key.
+func (o *jsonObject) Get(key string) (any, bool) {
+	v, ok := o.values[key]
+	return v, ok
+}
+
+// Set stores value under key, appending the key if it is new and keeping its
+// position otherwise.
+func (o *jsonObject) Set(key string, value any) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+// Delete removes key, if present.
+func (o *jsonObject) Delete(key string) {
+	if _, ok := o.values[key]; !ok {
+		return
+	}
+	delete(o.values, key)
+	for i, k := range o.keys {
+		if k == key {
+			o.keys = append(o.keys[:i], o.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// Rename moves the value under oldKey to newKey, keeping its position. It
+// does nothing if oldKey is absent, and fails if newKey is already used.
+func (o *jsonObject) Rename(oldKey, newKey string) error {
+	v, ok := o.values[oldKey]
+	if !ok {
+		return nil
+	}
+	if _, taken := o.values[newKey]; taken {
+		return fmt.Errorf("can't rename %q to %q: %q already exists", oldKey, newKey, newKey)
+	}
+	delete(o.values, oldKey)
+	o.values[newKey] = v
+	for i, k := range o.keys {
+		if k == oldKey {
+			o.keys[i] = newKey
+			break
+		}
+	}
+	return nil
+}
+
+// MarshalJSON encodes the object with its keys in order.
+func (o *jsonObject) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(k)
+		b.WriteByte(':')
+		v, err := json.Marshal(o.values[key])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(v)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+const (
+	// patchFileVersion is written in the header of .patch files and bumped
+	// whenever their layout changes.
+	patchFileVersion = 1
+	// patchMinGap is the shortest run of unchanged bytes that ends a diff
+	// run; shorter runs are folded into the diff, where they cost one zero
+	// byte each instead of two varints.
+	patchMinGap = 8
+)
+
+// patchCompression compresses the body of .patch files, and
+// patchBaseline the new file a patch has to beat.
+var (
+	patchCompression = mapgen.ZstdEncoding("zstd-best", zstd.SpeedBestCompression)
+	patchBaseline    = mapgen.ZstdEncoding("zstd-fastest", zstd.SpeedFastest)
+)
+
+// manifestPatch is an entry of the manifest "patches" section: a delta that
+// turns the previously published version of a file into the current one.
+type manifestPatch struct {
+	File string `json:"file"`
+	From string `json:"from"` // SHA-256 of the file the patch applies to
+	Size int    `json:"size"`
+}
+
+// encodePatch returns a bsdiff-style delta from old to current. Packed maps
+// keep their layout across minor edits, so bytes are compared position by
+// position; changed runs store the bytewise difference, which is mostly
+// zeros and compresses well.
+//
+// The file is little-endian:
+//
+//	"OFDP", u8 version, u32 old size, u32 new size
+//	zstd-compressed body:
+//	    over the first min(old size, new size) bytes, repeated:
+//	        uvarint unchanged bytes, uvarint n, n × u8 (new-old) mod 256
+//	    then the remaining bytes of new, if it is longer
+func encodePatch(old, current []byte) ([]byte, error) {
+	if len(old) > 1<<32-1 || len(current) > 1<<32-1 {
+		return nil, fmt.Errorf("files over 4 GiB are not supported")
+	}
+	common := min(len(old), len(current))
+	var body []byte
+	for pos := 0; pos < common; {
+		start := pos
+		for start < common && old[start] == current[start] {
+			start++
+		}
+		end := start
+		for gap := 0; end < common && gap < patchMinGap; end++ {
+			if old[end] == current[end] {
+				gap++
+			} else {
+				gap = 0
+			}
+		}
+		for end > start && old[end-1] == current[end-1] {
+			end--
+		}
+		body = binary.AppendUvarint(body, uint64(start-pos))
+		body = binary.AppendUvarint(body, uint64(end-start))
+		for i := start; i < end; i++ {
+			body = append(body, current[i]-old[i])
+		}
+		pos = end
+	}
+	body = append(body, current[common:]...)
+	compressed, err := patchCompression.Encode(body)
+	if err != nil {
+		return nil, err
+	}
+
+	out := []byte("OFDP")
+	out = append(out, patchFileVersion)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(old)))
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(current)))
+	return append(out, compressed...), nil
+}
+
+// applyPatch reverses encodePatch.
+func applyPatch(old, patch []byte) ([]byte, error) {
+	if len(patch) < 13 || string(patch[:4]) != "OFDP" {
+		return nil, errors.New("not a patch file")
+	}
+	if patch[4] != patchFileVersion {
+		return nil, fmt.Errorf("unsupported patch version %d", patch[4])
+	}
+	oldSize := int(binary.LittleEndian.Uint32(patch[5:]))
+	newSize := int(binary.LittleEndian.Uint32(patch[9:]))
+	if len(old) != oldSize {
+		return nil, fmt.Errorf("patch applies to %d bytes, got %d", oldSize, len(old))
+	}
+	body, err := patchCompression.Decode(patch[13:])
+	if err != nil {
+		return nil, err
+	}
+	common := min(oldSize, newSize)
+	out := make([]byte, newSize)
+	copy(out, old[:common])
+	for pos := 0; pos < common; {
+		skip, n := binary.Uvarint(body)
+		if n <= 0 {
+			return nil, errors.New("truncated patch")
+		}
+		body = body[n:]
+		count, n := binary.Uvarint(body)
+		if n <= 0 || skip+count > uint64(common-pos) || count > uint64(len(body)-n) {
+			return nil, errors.New("truncated patch")
+		}
+		body = body[n:]
+		pos += int(skip)
+		for i := 0; i < int(count); i++ {
+			out[pos+i] += body[i]
+		}
+		body = body[count:]
+		pos += int(count)
+	}
+	if len(body) != newSize-common {
+		return nil, errors.New("patch does not match the new size")
+	}
+	copy(out[common:], body)
+	return out, nil
+}
+
+// buildPatches returns patches from the published version of each packed
+// map in mapDir to the newly generated data, keyed by file, before the new
+// data is written. The published version is the file on disk if it matches
+// the checksum in the existing manifest. Files that did not change keep
+// their recorded patch, so regenerating identical outputs does not lose it.
+// A patch is only kept if it is smaller than the new file compressed.
+func buildPatches(ctx context.Context, mapDir string, files map[string][]byte) (map[string]manifestPatch, map[string][]byte, error) {
+	logger := mapgen.LoggerFromContext(ctx)
+	buf, err := os.ReadFile(filepath.Join(mapDir, "manifest.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	var previous struct {
+		Checksums map[string]string        `json:"checksums"`
+		Patches   map[string]manifestPatch `json:"patches"`
+	}
+	if err := json.Unmarshal(buf, &previous); err != nil {
+		logger.Debug(fmt.Sprintf("Not building patches: existing manifest is invalid: %v", err))
+		return nil, nil, nil
+	}
+
+	patches := make(map[string]manifestPatch)
+	data := make(map[string][]byte)
+	for _, f := range mapScaleFiles {
+		current := files[f.File]
+		old, err := os.ReadFile(filepath.Join(mapDir, f.File))
+		if err != nil || sha256Hex(old) != previous.Checksums[f.File] {
+			continue
+		}
+		if bytes.Equal(old, current) {
+			if p, ok := previous.Patches[f.File]; ok {
+				patch, err := os.ReadFile(filepath.Join(mapDir, p.File))
+				if err == nil && sha256Hex(patch) == previous.Checksums[p.File] {
+					patches[f.File] = p
+					data[p.File] = patch
+				}
+			}
+			continue
+		}
+		patch, err := encodePatch(old, current)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", f.File, err)
+		}
+		if check, err := applyPatch(old, patch); err != nil || !bytes.Equal(check, current) {
+			return nil, nil, fmt.Errorf("%s: patch does not reproduce the new file", f.File)
+		}
+		compressed, err := patchBaseline.Encode(current)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(patch) >= len(compressed) {
+			logger.Debug(fmt.Sprintf("No patch for %s: %d bytes, the file compresses to %d", f.File, len(patch), len(compressed)))
+			continue
+		}
+		logger.Debug(fmt.Sprintf("Patch for %s: %d bytes", f.File, len(patch)))
+		p := manifestPatch{File: f.File + ".patch", From: previous.Checksums[f.File], Size: len(patch)}
+		patches[f.File] = p
+		data[p.File] = patch
+	}
+	return patches, data, nil
+}
+
+// removeStalePatches deletes patch files in mapDir that are not in patches.
+func removeStalePatches(mapDir string, patches map[string]manifestPatch) error {
+	for _, f := range mapScaleFiles {
+		if _, ok := patches[f.File]; ok {
+			continue
+		}
+		if err := os.Remove(filepath.Join(mapDir, f.File+".patch")); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,7 @@
+// Package containerfb holds the Go code flatc generates from
+// map_container.fbs, the schema of the --container=flatbuffers map
+// container. The TypeScript code flatc generates for the client is in ts.
+package containerfb
+
+//go:generate flatc --go --go-namespace containerfb -o .. ../../map_container.fbs
+//go:generate flatc --ts -o ts ../../map_container.fbs
@@ -0,0 +1,5 @@
+// Package containerpb holds the Go code protoc-gen-go generates from
+// map_container.proto, the schema of the --container=proto map container.
+package containerpb
+
+//go:generate protoc --proto_path=../.. --go_out=. --go_opt=paths=source_relative map_container.proto
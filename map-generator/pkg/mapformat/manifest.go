@@ -0,0 +1,116 @@
+package mapformat
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// SchemaVersion is the newest manifest schema_version this package reads.
+// Version 0, manifests written before schema_version was recorded, has the
+// same layout as version 1. Version 2 adds ice and lava impassable terrain,
+// which only maps of TileFormat2 keep apart from the void. Version 3 records
+// the layout of the packed tiles as "tile_format", see TileFormat.
+const SchemaVersion = 3
+
+// Dimensions is the manifest section of a packed map scale.
+type Dimensions struct {
+	Width        int `json:"width"`
+	Height       int `json:"height"`
+	NumLandTiles int `json:"num_land_tiles"`
+}
+
+// Nation is a nation spawn of the manifest "nations" section.
+type Nation struct {
+	Name        string `json:"name"`
+	Flag        string `json:"flag"`
+	Coordinates [2]int `json:"coordinates"`
+}
+
+// PlayerCounts is the manifest "players" section: the lobby player counts
+// the generator recommends for the map. It is zero in manifests from before
+// it was recorded.
+type PlayerCounts struct {
+	Min         int `json:"min"`
+	Max         int `json:"max"`
+	Recommended int `json:"recommended"`
+}
+
+// SpawnPoint is a start location of the manifest "spawns" section, computed
+// for maps whose info.json has a "generator.spawns" section.
+type SpawnPoint struct {
+	Coordinates [2]int  `json:"coordinates"`
+	Score       float64 `json:"score"`   // 0 to 1, higher is better
+	Nearest     int     `json:"nearest"` // distance in tiles to the nearest other spawn
+}
+
+// Manifest is a map's manifest.json. It models the sections consumers rely
+// on; Fields holds every section, including those, as raw JSON for the rest.
+type Manifest struct {
+	ID               string                     `json:"id"`
+	Name             string                     `json:"name"`
+	TranslationKey   string                     `json:"translation_key"`
+	Nations          []Nation                   `json:"nations"`
+	Map              Dimensions                 `json:"map"`
+	Map4x            Dimensions                 `json:"map4x"`
+	Map16x           Dimensions                 `json:"map16x"`
+	Players          PlayerCounts               `json:"players"`
+	Spawns           []SpawnPoint               `json:"spawns"` // nil for maps without computed spawns
+	Layers           map[string]json.RawMessage `json:"layers"`
+	Checksums        map[string]string          `json:"checksums"`
+	SourceHash       string                     `json:"source_hash"`
+	GeneratorVersion int                        `json:"generator_version"`
+	SchemaVersion    int                        `json:"schema_version"`
+	TileFormat       TileFormat                 `json:"tile_format"` // TileFormat1 in manifests without one
+
+	Fields map[string]json.RawMessage `json:"-"`
+}
+
+// ParseManifest parses a manifest.json. Manifests of a schema_version newer
+// than SchemaVersion are rejected, as they may have changed meaning, and so
+// are maps packed in a tile format this package doesn't read.
+func ParseManifest(data []byte) (*Manifest, error) {
+	m := &Manifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if err := json.Unmarshal(data, &m.Fields); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if m.SchemaVersion < 0 || m.SchemaVersion > SchemaVersion {
+		return nil, fmt.Errorf("manifest has schema_version %d, this package reads up to %d", m.SchemaVersion, SchemaVersion)
+	}
+	if m.TileFormat == 0 {
+		m.TileFormat = TileFormat1
+	}
+	if !m.TileFormat.Valid() {
+		return nil, fmt.Errorf("manifest has tile_format %d, this package reads up to %d", m.TileFormat, LatestTileFormat)
+	}
+	for _, s := range Scales {
+		if d := m.Dimensions(s); d.Width <= 0 || d.Height <= 0 {
+			return nil, fmt.Errorf("manifest has no valid %q dimensions", s.Section())
+		}
+	}
+	return m, nil
+}
+
+// ReadManifest reads the manifest.json of a map directory.
+func ReadManifest(mapDir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(mapDir, "manifest.json"))
+	if err != nil {
+		return nil, err
+	}
+	return ParseManifest(data)
+}
+
+// Dimensions returns the manifest section of a scale.
+func (m *Manifest) Dimensions(s Scale) Dimensions {
+	switch s {
+	case Scale4x:
+		return m.Map4x
+	case Scale16x:
+		return m.Map16x
+	}
+	return m.Map
+}
@@ -0,0 +1,121 @@
+// Package mapformat reads the maps written by the OpenFront map-generator:
+// their manifest.json and packed map.bin, map4x.bin and map16x.bin files.
+// It is the reference decoder of the format, for the game server, analytics
+// jobs and tests, so that they need not re-implement the bit layout.
+//
+// A map directory is read with
+//
+//	m, err := mapformat.ReadManifest(dir)
+//	gm, err := mapformat.ReadMap(dir, m, mapformat.Scale1x)
+//	if gm.At(x, y).IsLand() { ... }
+//
+// The package has no dependencies outside the standard library.
+package mapformat
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Scale is a packed map scale.
+type Scale int
+
+// The packed map scales, from full size down. The 1/4 and 1/16 scale maps
+// halve the dimensions of the previous scale.
+const (
+	Scale1x Scale = iota
+	Scale4x
+	Scale16x
+)
+
+// Scales lists the scales every map has.
+var Scales = []Scale{Scale1x, Scale4x, Scale16x}
+
+// File returns the name of the file of the scale, e.g. "map4x.bin".
+func (s Scale) File() string {
+	return s.Section() + ".bin"
+}
+
+// Section returns the name of the manifest section of the scale, e.g.
+// "map4x".
+func (s Scale) Section() string {
+	switch s {
+	case Scale4x:
+		return "map4x"
+	case Scale16x:
+		return "map16x"
+	}
+	return "map"
+}
+
+// Map is a decoded packed map: Width*Height tiles, row-major.
+type Map struct {
+	Width, Height int
+	Tiles         []Tile
+}
+
+// Decode decodes a packed map file of the given dimensions, as recorded in
+// the manifest, written in the LatestTileFormat.
+func Decode(data []byte, width, height int) (*Map, error) {
+	return DecodeFormat(data, width, height, LatestTileFormat)
+}
+
+// DecodeFormat decodes a packed map file written in the given tile format,
+// the manifest's TileFormat, into tiles of the latest format.
+func DecodeFormat(data []byte, width, height int, format TileFormat) (*Map, error) {
+	if !format.Valid() {
+		return nil, fmt.Errorf("unknown tile format %d", format)
+	}
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid dimensions %dx%d", width, height)
+	}
+	if len(data) != width*height {
+		return nil, fmt.Errorf("packed map has %d bytes, expected %d (%dx%d)", len(data), width*height, width, height)
+	}
+	tiles := make([]Tile, len(data))
+	for i, b := range data {
+		tiles[i] = format.Tile(b)
+	}
+	return &Map{Width: width, Height: height, Tiles: tiles}, nil
+}
+
+// ReadMap reads and decodes a scale of a map directory with manifest m, and
+// checks its land tiles against the manifest.
+func ReadMap(mapDir string, m *Manifest, s Scale) (*Map, error) {
+	data, err := os.ReadFile(filepath.Join(mapDir, s.File()))
+	if err != nil {
+		return nil, err
+	}
+	d := m.Dimensions(s)
+	gm, err := DecodeFormat(data, d.Width, d.Height, m.TileFormat)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", s.File(), err)
+	}
+	if n := gm.NumLandTiles(); n != d.NumLandTiles {
+		return nil, fmt.Errorf("%s has %d land tiles, manifest has %d", s.File(), n, d.NumLandTiles)
+	}
+	return gm, nil
+}
+
+// In reports whether (x, y) is on the map.
+func (m *Map) In(x, y int) bool {
+	return x >= 0 && y >= 0 && x < m.Width && y < m.Height
+}
+
+// At returns the tile at (x, y), which must be on the map.
+func (m *Map) At(x, y int) Tile {
+	return m.Tiles[y*m.Width+x]
+}
+
+// NumLandTiles returns the number of land tiles, impassable tiles excluded,
+// as recorded in the manifest.
+func (m *Map) NumLandTiles() int {
+	n := 0
+	for _, t := range m.Tiles {
+		if t.IsLand() {
+			n++
+		}
+	}
+	return n
+}
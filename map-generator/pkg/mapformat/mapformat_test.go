@@ -0,0 +1,158 @@
+package mapformat_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapformat"
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+// roundTripImage draws a 32x16 map: ocean around a highland island with a
+// lake in it, an ice sheet, a lava field and a void corner.
+func roundTripImage() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 32, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 32; x++ {
+			c := color.NRGBA{0, 0, 106, 255}
+			switch {
+			case x >= 10 && x <= 12 && y >= 6 && y <= 8:
+			case x >= 4 && x <= 19 && y >= 3 && y <= 12:
+				c = color.NRGBA{0, 0, 160, 255}
+			case x >= 24 && x <= 27 && y >= 4 && y <= 7:
+				c = color.NRGBA{255, 255, 255, 255}
+			case x >= 22 && x <= 23 && y >= 12 && y <= 13:
+				c = color.NRGBA{255, 0, 0, 255}
+			case x >= 28 && y >= 12:
+				c = color.NRGBA{0, 0, 0, 255}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// TestReadGeneratedMap generates a small map with mapgen, reads it back with
+// ReadManifest and ReadMap, and checks every tile of the full-scale map.
+func TestReadGeneratedMap(t *testing.T) {
+	src := roundTripImage()
+	var imageBuffer bytes.Buffer
+	if err := png.Encode(&imageBuffer, src); err != nil {
+		t.Fatal(err)
+	}
+	info := []byte(`{"generator": {"impassable_colors": {"#ffffff": "ice", "#ff0000": "lava"}}}`)
+	config, err := mapgen.ParseGeneratorConfig(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := mapgen.ContextWithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	result, err := mapgen.GenerateMap(ctx, mapgen.GeneratorArgs{
+		Name:        "roundtrip",
+		ImageBuffer: imageBuffer.Bytes(),
+		Info:        info,
+		Config:      config,
+		TileFormat:  mapformat.LatestTileFormat,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	manifest := map[string]any{"schema_version": mapformat.SchemaVersion, "tile_format": result.TileFormat}
+	for _, s := range []struct {
+		scale mapformat.Scale
+		info  mapgen.MapInfo
+	}{
+		{mapformat.Scale1x, result.Map},
+		{mapformat.Scale4x, result.Map4x},
+		{mapformat.Scale16x, result.Map16x},
+	} {
+		manifest[s.scale.Section()] = mapformat.Dimensions{Width: s.info.Width, Height: s.info.Height, NumLandTiles: s.info.NumLandTiles}
+		if err := os.WriteFile(filepath.Join(dir, s.scale.File()), s.info.Data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	buf, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "manifest.json"), buf, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := mapformat.ReadManifest(dir)
+	if err != nil {
+		t.Fatalf("ReadManifest: %v", err)
+	}
+	for _, s := range mapformat.Scales {
+		if _, err := mapformat.ReadMap(dir, m, s); err != nil {
+			t.Errorf("ReadMap(%s): %v", s.File(), err)
+		}
+	}
+	gm, err := mapformat.ReadMap(dir, m, mapformat.Scale1x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gm.Width != 32 || gm.Height != 16 {
+		t.Fatalf("map is %dx%d, want 32x16", gm.Width, gm.Height)
+	}
+	if _, err := mapformat.Decode(result.Map.Data, 32, 15); err == nil {
+		t.Error("Decode accepts the wrong dimensions")
+	}
+
+	// kindAt classifies a pixel of the source image the way the generator
+	// does: "land", "water" or an impassable kind.
+	kindAt := func(x, y int) string {
+		if x < 0 || y < 0 || x >= 32 || y >= 16 {
+			return ""
+		}
+		switch c := src.NRGBAAt(x, y); c {
+		case color.NRGBA{0, 0, 106, 255}:
+			return "water"
+		case color.NRGBA{0, 0, 160, 255}:
+			return "land"
+		case color.NRGBA{255, 255, 255, 255}:
+			return "ice"
+		case color.NRGBA{255, 0, 0, 255}:
+			return "lava"
+		}
+		return "void"
+	}
+	kinds := map[string]mapformat.ImpassableKind{"void": mapformat.ImpassableVoid, "ice": mapformat.ImpassableIce, "lava": mapformat.ImpassableLava}
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 32; x++ {
+			tile := gm.At(x, y)
+			kind := kindAt(x, y)
+			// Land next to water and water next to land are shoreline;
+			// impassable tiles never are.
+			shore := false
+			for _, d := range [][2]int{{-1, 0}, {1, 0}, {0, -1}, {0, 1}} {
+				nk := kindAt(x+d[0], y+d[1])
+				shore = shore || kind == "land" && nk == "water" || kind == "water" && nk == "land"
+			}
+			lake := x >= 10 && x <= 12 && y >= 6 && y <= 8
+			want := []bool{kind == "land", kind == "water", shore, kind == "water" && !lake, kinds[kind] == tile.ImpassableKind() && kind != "land" && kind != "water"}
+			got := []bool{tile.IsLand(), tile.IsWater(), tile.IsShoreline(), tile.IsOcean(), tile.IsImpassable()}
+			for i, name := range []string{"IsLand", "IsWater", "IsShoreline", "IsOcean", "IsImpassable"} {
+				if got[i] != want[i] {
+					t.Errorf("(%d, %d) %s %08b: %s() = %v, want %v", x, y, kind, tile, name, got[i], want[i])
+				}
+			}
+			if kind == "land" && tile.Magnitude() != 10 {
+				t.Errorf("(%d, %d): land Magnitude() = %d, want 10", x, y, tile.Magnitude())
+			}
+			if shore && kind == "water" && tile.Magnitude() != 0 {
+				t.Errorf("(%d, %d): shoreline water Magnitude() = %d, want 0", x, y, tile.Magnitude())
+			}
+		}
+	}
+}
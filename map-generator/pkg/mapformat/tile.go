@@ -0,0 +1,143 @@
+package mapformat
+
+// Tile is a packed tile of a map file, in the LatestTileFormat:
+//
+//	bit 7     land
+//	bit 6     shoreline
+//	bit 5     ocean
+//	bits 0-4  land: elevation
+//	bit 4     water: river
+//	bits 0-3  water: distance to land
+//
+// Impassable tiles have the land bit and magnitude 31, which land never
+// reaches, and their ImpassableKind in bits 5-6:
+//
+//	0b10011111  ImpassableVoid
+//	0b10111111  ImpassableIce
+//	0b11011111  ImpassableLava
+//
+// Maps of TileFormat1 have no river bit and pack every impassable tile as
+// the void, see TileFormat.Tile.
+type Tile uint8
+
+// Bits of a Tile. Prefer the methods, which account for impassable tiles.
+const (
+	LandBit       Tile = 0b10000000
+	ShorelineBit  Tile = 0b01000000
+	OceanBit      Tile = 0b00100000
+	MagnitudeMask Tile = 0b00011111
+	RiverBit      Tile = 0b00010000
+
+	// MaxWaterMagnitude is the largest magnitude of a water tile.
+	MaxWaterMagnitude = 15
+
+	waterMagnitudeMask Tile = 0b00001111
+
+	impassable = LandBit | MagnitudeMask
+)
+
+// TileFormat is a layout of the bits of a packed tile, recorded in the
+// manifest as "tile_format". The generator packs the format its consumers
+// read, so that a new layout never reaches a client without a decoder for it.
+type TileFormat int
+
+// The tile formats, oldest first.
+const (
+	// TileFormat1 is the original layout, of manifests without a
+	// "tile_format": every impassable tile is the void, water has no river
+	// bit and its distance to land takes bits 0-4, up to 31.
+	TileFormat1 TileFormat = 1
+	// TileFormat2 gives impassable tiles their ImpassableKind in bits 5-6,
+	// and water a river bit, bit 4, and its distance to land bits 0-3.
+	TileFormat2 TileFormat = 2
+
+	// LatestTileFormat is the newest format, the layout of Tile.
+	LatestTileFormat = TileFormat2
+)
+
+// Valid reports whether f is a tile format this package reads.
+func (f TileFormat) Valid() bool {
+	return f >= TileFormat1 && f <= LatestTileFormat
+}
+
+// Tile reads a byte packed in format f as a Tile. Impassable tiles of
+// TileFormat1 are the void, whatever their shoreline and ocean bits, and its
+// water has no river bit and distances to land up to 31, which Tile caps at
+// MaxWaterMagnitude, so that the tile reads like one of the latest format.
+func (f TileFormat) Tile(b byte) Tile {
+	t := Tile(b)
+	if f >= TileFormat2 {
+		return t
+	}
+	switch {
+	case t.IsImpassable():
+		t = ImpassableTile(ImpassableVoid)
+	case t.IsWater() && t&MagnitudeMask > MaxWaterMagnitude:
+		t = t&^MagnitudeMask | MaxWaterMagnitude
+	}
+	return t
+}
+
+// ImpassableKind is what an impassable tile shows: the void around a
+// non-rectangular map, or a surface such as an ice sheet or a lava field.
+type ImpassableKind uint8
+
+// Enumeration of possible ImpassableKind values.
+const (
+	ImpassableVoid ImpassableKind = iota
+	ImpassableIce
+	ImpassableLava
+)
+
+// ImpassableTile returns the packed tile of an impassable kind.
+func ImpassableTile(kind ImpassableKind) Tile {
+	return impassable | Tile(kind&0b11)<<5
+}
+
+// IsImpassable reports whether the tile is impassable, of any kind. Impassable
+// tiles cannot be owned, attacked, nuked or sailed through.
+func (t Tile) IsImpassable() bool {
+	return t&impassable == impassable
+}
+
+// ImpassableKind returns the kind of an impassable tile.
+func (t Tile) ImpassableKind() ImpassableKind {
+	return ImpassableKind(t>>5) & 0b11
+}
+
+// IsLand reports whether the tile is land. Impassable tiles are not.
+func (t Tile) IsLand() bool {
+	return t&LandBit != 0 && !t.IsImpassable()
+}
+
+// IsWater reports whether the tile is water.
+func (t Tile) IsWater() bool {
+	return t&LandBit == 0
+}
+
+// IsShoreline reports whether the tile is land next to water or water next to
+// land.
+func (t Tile) IsShoreline() bool {
+	return t&ShorelineBit != 0 && !t.IsImpassable()
+}
+
+// IsOcean reports whether the tile is water of the ocean, rather than of a
+// lake.
+func (t Tile) IsOcean() bool {
+	return t&OceanBit != 0 && !t.IsImpassable()
+}
+
+// IsRiver reports whether the tile is water of a river: a narrow channel,
+// or water painted as a river.
+func (t Tile) IsRiver() bool {
+	return t.IsWater() && t&RiverBit != 0
+}
+
+// Magnitude returns the elevation of a land tile, 0 to 30, or the distance of
+// a water tile to land in steps of 2 tiles, 0 to MaxWaterMagnitude.
+func (t Tile) Magnitude() uint8 {
+	if t.IsWater() {
+		return uint8(t & waterMagnitudeMask)
+	}
+	return uint8(t & MagnitudeMask)
+}
@@ -0,0 +1,97 @@
+package mapformat
+
+import "testing"
+
+// TestImpassableTile checks the packed bytes of the impassable kinds, which
+// readers of the format compare against.
+func TestImpassableTile(t *testing.T) {
+	tests := []struct {
+		kind ImpassableKind
+		want Tile
+	}{
+		{ImpassableVoid, 0b10011111},
+		{ImpassableIce, 0b10111111},
+		{ImpassableLava, 0b11011111},
+	}
+	for _, tt := range tests {
+		tile := ImpassableTile(tt.kind)
+		if tile != tt.want {
+			t.Errorf("ImpassableTile(%d) = %08b, want %08b", tt.kind, tile, tt.want)
+		}
+		if !tile.IsImpassable() || tile.ImpassableKind() != tt.kind {
+			t.Errorf("%08b: IsImpassable() = %v, ImpassableKind() = %d, want true, %d", tile, tile.IsImpassable(), tile.ImpassableKind(), tt.kind)
+		}
+		if tile.IsLand() || tile.IsWater() || tile.IsShoreline() || tile.IsOcean() || tile.IsRiver() {
+			t.Errorf("%08b reads as land, water, shoreline, ocean or river", tile)
+		}
+	}
+}
+
+// TestTilePredicates checks the predicates of passable tiles, in particular
+// that the highest land magnitude and water far from land aren't impassable,
+// and that the river bit of water is not part of its magnitude.
+func TestTilePredicates(t *testing.T) {
+	tests := []struct {
+		tile                                     Tile
+		land, water, shore, ocean, river, impass bool
+		magnitude                                uint8
+	}{
+		{tile: 0b00000000, water: true},
+		{tile: 0b00100011, water: true, ocean: true, magnitude: 3},
+		{tile: 0b01100000, water: true, shore: true, ocean: true},
+		{tile: 0b00101111, water: true, ocean: true, magnitude: 15},
+		{tile: 0b01010000, water: true, shore: true, river: true},
+		{tile: 0b00110001, water: true, ocean: true, river: true, magnitude: 1},
+		{tile: 0b10000000, land: true},
+		{tile: 0b11000101, land: true, shore: true, magnitude: 5},
+		{tile: 0b10010000, land: true, magnitude: 16},
+		{tile: 0b10011110, land: true, magnitude: 30},
+		{tile: 0b11011110, land: true, shore: true, magnitude: 30},
+	}
+	for _, tt := range tests {
+		got := []bool{tt.tile.IsLand(), tt.tile.IsWater(), tt.tile.IsShoreline(), tt.tile.IsOcean(), tt.tile.IsRiver(), tt.tile.IsImpassable()}
+		want := []bool{tt.land, tt.water, tt.shore, tt.ocean, tt.river, tt.impass}
+		for i, name := range []string{"IsLand", "IsWater", "IsShoreline", "IsOcean", "IsRiver", "IsImpassable"} {
+			if got[i] != want[i] {
+				t.Errorf("%08b: %s() = %v, want %v", tt.tile, name, got[i], want[i])
+			}
+		}
+		if m := tt.tile.Magnitude(); m != tt.magnitude {
+			t.Errorf("%08b: Magnitude() = %d, want %d", tt.tile, m, tt.magnitude)
+		}
+	}
+}
+
+// TestDecodeFormat checks that water far from land in maps of TileFormat1
+// doesn't read as a river, that the river bit of TileFormat2 does, and that
+// impassable tiles of TileFormat1 are the void.
+func TestDecodeFormat(t *testing.T) {
+	data := []byte{0b00111111, 0b00010011, 0b10011110}
+	tests := []struct {
+		format    TileFormat
+		river     []bool
+		magnitude []uint8
+	}{
+		{TileFormat1, []bool{false, false, false}, []uint8{15, 15, 30}},
+		{TileFormat2, []bool{true, true, false}, []uint8{15, 3, 30}},
+	}
+	for _, tt := range tests {
+		gm, err := DecodeFormat(data, 3, 1, tt.format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, tile := range gm.Tiles {
+			if tile.IsRiver() != tt.river[i] || tile.Magnitude() != tt.magnitude[i] {
+				t.Errorf("format %d: %08b read as %08b: IsRiver() = %v, Magnitude() = %d, want %v, %d", tt.format, data[i], tile, tile.IsRiver(), tile.Magnitude(), tt.river[i], tt.magnitude[i])
+			}
+		}
+	}
+	for _, kind := range []ImpassableKind{ImpassableIce, ImpassableLava} {
+		if got := TileFormat1.Tile(byte(ImpassableTile(kind))); got != ImpassableTile(ImpassableVoid) {
+			t.Errorf("format 1: %08b read as %08b, want the void", ImpassableTile(kind), got)
+		}
+	}
+	if _, err := DecodeFormat(data, 3, 1, LatestTileFormat+1); err == nil {
+		t.Error("DecodeFormat accepts an unknown tile format")
+	}
+}
@@ -0,0 +1,152 @@
+package mapgen
+
+import (
+	"context"
+	"fmt"
+	"image"
+)
+
+// Kinds of MapProblem, each drawn in its own colour.
+const (
+	ProblemSmallIsland     = "small_island"
+	ProblemSmallLake       = "small_lake"
+	ProblemAmbiguousCoast  = "ambiguous_coast"
+	ProblemUnreachableLand = "unreachable_land"
+	ProblemNationSpawn     = "nation_spawn"
+)
+
+// ambiguousCoastCell is the side, in tiles, of the cells ambiguous coast
+// pixels are grouped by, so that a smudged coastline gives a few circles
+// rather than one per pixel.
+const ambiguousCoastCell = 24
+
+// MapProblem is an area of a map that generation changed or that players
+// cannot use as its author probably intended, in full-scale tiles.
+type MapProblem struct {
+	Kind    string
+	Box     image.Rectangle
+	Tiles   int // tiles the problem covers
+	Message string
+}
+
+// ProblemRecorder collects the problems of a map while it is generated,
+// along with the image they are found on. Passes record into the recorder of
+// their context, if any; a nil recorder ignores them, so the 4x and 16x
+// passes run with none.
+type ProblemRecorder struct {
+	Image    image.Image // the source image, as reprojected
+	Problems []MapProblem
+}
+
+type problemsKey struct{}
+
+// problemsFromContext returns the problem recorder of ctx, or nil.
+func problemsFromContext(ctx context.Context) *ProblemRecorder {
+	r, _ := ctx.Value(problemsKey{}).(*ProblemRecorder)
+	return r
+}
+
+// ContextWithProblems returns a context whose passes record problems into r;
+// a nil r stops recording.
+func ContextWithProblems(ctx context.Context, r *ProblemRecorder) context.Context {
+	return context.WithValue(ctx, problemsKey{}, r)
+}
+
+// add records a problem covering coords.
+func (r *ProblemRecorder) add(kind string, coords []Coord, format string, args ...any) {
+	if r == nil || len(coords) == 0 {
+		return
+	}
+	box := image.Rect(coords[0].X, coords[0].Y, coords[0].X+1, coords[0].Y+1)
+	for _, c := range coords[1:] {
+		box = box.Union(image.Rect(c.X, c.Y, c.X+1, c.Y+1))
+	}
+	r.Problems = append(r.Problems, MapProblem{Kind: kind, Box: box, Tiles: len(coords), Message: fmt.Sprintf(format, args...)})
+}
+
+// addCells records a problem for every cell × cell square holding any of
+// coords, with the number of tiles it holds.
+func (r *ProblemRecorder) addCells(kind string, coords []Coord, cell int, format string) {
+	if r == nil {
+		return
+	}
+	cells := make(map[image.Point][]Coord)
+	var order []image.Point
+	for _, c := range coords {
+		p := image.Pt(c.X/cell, c.Y/cell)
+		if _, ok := cells[p]; !ok {
+			order = append(order, p)
+		}
+		cells[p] = append(cells[p], c)
+	}
+	for _, p := range order {
+		r.add(kind, cells[p], format, len(cells[p]))
+	}
+}
+
+// recordUnreachableLand records the landmasses bordering no water on maps
+// with more than one landmass: ships cannot land on them and nothing can
+// attack across impassable terrain, so players elsewhere can never reach
+// them.
+func recordUnreachableLand(r *ProblemRecorder, terrain *terrainGrid, wrapX bool, scratch *floodScratch) {
+	if r == nil {
+		return
+	}
+	width, height := terrain.Width, terrain.Height
+	visited := scratch.visitedFor(width * height)
+	scratch.area = scratch.area[:0]
+	var bodies []areaSpan
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			if terrain.at(x, y).Type == Land && !visited.has(y*width+x) {
+				start := len(scratch.area)
+				scratch.area = getArea(x, y, terrain, wrapX, visited, scratch.area)
+				bodies = append(bodies, areaSpan{start: start, size: len(scratch.area) - start})
+			}
+		}
+	}
+	if len(bodies) < 2 {
+		return
+	}
+	var buf [4]Coord
+	for _, body := range bodies {
+		coords := scratch.coords(body)
+		reachable := false
+		for _, c := range coords {
+			n := neighborCoordsWrap(c.X, c.Y, width, height, wrapX, &buf)
+			for _, nc := range buf[:n] {
+				if terrain.at(nc.X, nc.Y).Type == Water {
+					reachable = true
+				}
+			}
+			if reachable {
+				break
+			}
+		}
+		if !reachable {
+			r.add(ProblemUnreachableLand, coords, "landmass of %d tile(s) borders no water, so it cannot be reached from the rest of the map", body.size)
+		}
+	}
+}
+
+// recordNationSpawns records the nations spawning off the map or off land.
+func recordNationSpawns(r *ProblemRecorder, terrain *terrainGrid, info []byte) {
+	if r == nil || len(info) == 0 {
+		return
+	}
+	spawns, err := nationSpawns(info)
+	if err != nil {
+		return
+	}
+	width, height := terrain.Width, terrain.Height
+	for i, s := range spawns {
+		x, y := s[0], s[1]
+		c := []Coord{{X: min(max(x, 0), width-1), Y: min(max(y, 0), height-1)}}
+		switch {
+		case x < 0 || y < 0 || x >= width || y >= height:
+			r.add(ProblemNationSpawn, c, "nation %d spawns at %d,%d, outside the %dx%d map", i+1, x, y, width, height)
+		case terrain.at(x, y).Type != Land:
+			r.add(ProblemNationSpawn, c, "nation %d spawns at %d,%d, which is not land", i+1, x, y)
+		}
+	}
+}
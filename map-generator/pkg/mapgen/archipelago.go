@@ -0,0 +1,137 @@
+package mapgen
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// archipelagoSpawnRadius is the radius, in tiles, of the land kept around
+// every nation spawn when carving channels, so that spawns stay on land.
+const archipelagoSpawnRadius = 8
+
+// archipelagoConfig is the "generator.archipelago" stage, which fragments
+// large landmasses into island chains for naval-focused variants of
+// continental maps, see carveArchipelago.
+type archipelagoConfig struct {
+	// Seed selects the channel layout; it defaults to the map name.
+	Seed string `json:"seed"`
+	// Spacing is the typical width, in tiles, of the islands carved out.
+	Spacing int `json:"spacing"`
+	// ChannelWidth is the width, in tiles, of the channels between them.
+	ChannelWidth int `json:"channel_width"`
+	// MinLandmass is the size, in tiles, of the smallest landmass carved.
+	MinLandmass int `json:"min_landmass"`
+}
+
+// UnmarshalJSON fills in the defaults of the fields the section omits.
+func (c *archipelagoConfig) UnmarshalJSON(data []byte) error {
+	type plain archipelagoConfig
+	cfg := plain{Spacing: 96, ChannelWidth: 4, MinLandmass: 20000}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return err
+	}
+	*c = archipelagoConfig(cfg)
+	return nil
+}
+
+// validate checks the stage's settings.
+func (c *archipelagoConfig) validate() error {
+	if c.ChannelWidth < 1 || c.ChannelWidth > 32 {
+		return fmt.Errorf("channel_width (%d) must be between 1 and 32", c.ChannelWidth)
+	}
+	if c.Spacing < 4*c.ChannelWidth {
+		return fmt.Errorf("spacing (%d) must be at least 4 times channel_width", c.Spacing)
+	}
+	if c.MinLandmass < 0 {
+		return fmt.Errorf("min_landmass (%d) must not be negative", c.MinLandmass)
+	}
+	return nil
+}
+
+// carveArchipelago turns the land tiles of every landmass of at least
+// cfg.MinLandmass tiles that lie within cfg.ChannelWidth/2 tiles of the zero
+// contour of seeded noise into water. The contours form a network of curved
+// channels about cfg.Spacing tiles apart, splitting the landmass into an
+// island chain; small islands and lakes it leaves are then handled by the
+// usual water processing. Land within archipelagoSpawnRadius of a spawn is
+// kept. It returns the number of tiles carved.
+func carveArchipelago(ctx context.Context, terrain *terrainGrid, cfg *archipelagoConfig, name string, spawns [][2]int, wrapX bool, scratch *floodScratch) int {
+	width := terrain.Width
+	height := terrain.Height
+	seedText := cfg.Seed
+	if seedText == "" {
+		seedText = name
+	}
+	seed := NoiseSeed("archipelago:" + seedText)
+	scale := float64(cfg.Spacing)
+	noise := func(x, y float64) float64 {
+		if wrapX {
+			return PeriodicNoise(x/scale, y/scale, float64(width)/scale, seed, 2)
+		}
+		return FractalNoise(x/scale, y/scale, seed, 2)
+	}
+
+	keep := make([]bool, width*height)
+	for _, s := range spawns {
+		for dx := -archipelagoSpawnRadius; dx <= archipelagoSpawnRadius; dx++ {
+			for dy := -archipelagoSpawnRadius; dy <= archipelagoSpawnRadius; dy++ {
+				x, y := s[0]+dx, s[1]+dy
+				if wrapX {
+					x = (x%width + width) % width
+				}
+				if x >= 0 && x < width && y >= 0 && y < height && dx*dx+dy*dy <= archipelagoSpawnRadius*archipelagoSpawnRadius {
+					keep[y*width+x] = true
+				}
+			}
+		}
+	}
+
+	landmasses := labelComponents(terrain, Land, wrapX, scratch)
+	halfWidth := float64(cfg.ChannelWidth) / 2
+	carved := 0
+	carvedLandmasses := make(map[int32]bool)
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			i := y*width + x
+			if terrain.at(x, y).Type != Land || keep[i] || landmasses.SizeAt(i) < cfg.MinLandmass {
+				continue
+			}
+			// The distance to the contour is about the noise value over the
+			// length of its gradient.
+			fx, fy := float64(x)+0.5, float64(y)+0.5
+			n := noise(fx, fy)
+			gx := (noise(fx+1, fy) - noise(fx-1, fy)) / 2
+			gy := (noise(fx, fy+1) - noise(fx, fy-1)) / 2
+			if math.Abs(n) >= halfWidth*math.Hypot(gx, gy) {
+				continue
+			}
+			*terrain.at(x, y) = Terrain{Type: Water}
+			carvedLandmasses[landmasses.Labels[i]] = true
+			carved++
+		}
+	}
+	if carved > 0 {
+		LoggerFromContext(ctx).Debug(fmt.Sprintf("Carved %d tile(s) of channels into %d landmass(es)", carved, len(carvedLandmasses)))
+	}
+	return carved
+}
+
+// nationSpawns returns the spawn coordinates of the nations of an info.json
+// buffer.
+func nationSpawns(info []byte) ([][2]int, error) {
+	var doc struct {
+		Nations []struct {
+			Coordinates [2]int `json:"coordinates"`
+		} `json:"nations"`
+	}
+	if err := json.Unmarshal(info, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse nations: %w", err)
+	}
+	spawns := make([][2]int, len(doc.Nations))
+	for i, n := range doc.Nations {
+		spawns[i] = n.Coordinates
+	}
+	return spawns, nil
+}
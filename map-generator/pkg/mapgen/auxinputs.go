@@ -0,0 +1,68 @@
+package mapgen
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"path/filepath"
+)
+
+// AuxInputFiles are the optional per-map input files read from the map folder
+// alongside image.png. Layers that use them fall back to defaults when a
+// file is absent.
+var AuxInputFiles = []string{
+	"bathymetry.png",  // grayscale water depth, see buildDepthBands
+	"borders.geojson", // territory polygons, see buildTerritories
+	"cities.json",     // real-world cities, see placeCities
+	"fertility.png",   // grayscale fertility, overriding the biomes, see buildFertility
+	"heightmap.png",   // grayscale elevation, see readHeightmap
+	"heightmap.tif",   // GeoTIFF elevation, see readHeightmap
+	"ice.png",         // grayscale ice sheet mask, see applyImpassableMasks
+	"lava.png",        // grayscale lava field mask, see applyImpassableMasks
+	"palette.json",    // colours of image.png to terrain, see ParsePalette
+	"roughness.png",   // grayscale roughness, overriding the biomes, see buildMovementCost
+}
+
+// auxGrayImage decodes the auxiliary PNG input name, if present, and checks
+// that it covers the width×height map. It returns nil when the map has no
+// such input.
+func auxGrayImage(inputs map[string][]byte, name string, width, height int) (image.Image, error) {
+	buf, ok := inputs[name]
+	if !ok {
+		return nil, nil
+	}
+	img, err := png.Decode(bytes.NewReader(buf))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", name, err)
+	}
+	if b := img.Bounds(); b.Dx() < width || b.Dy() < height {
+		return nil, fmt.Errorf("%s is %dx%d, smaller than the %dx%d map", name, b.Dx(), b.Dy(), width, height)
+	}
+	return img, nil
+}
+
+// AuxInputSize returns the dimensions of an image among the auxiliary
+// inputs, a PNG or heightmap.tif, read from its header alone, so that
+// callers can reject oversized inputs before they are decoded.
+func AuxInputSize(name string, data []byte) (width, height int, err error) {
+	if filepath.Ext(name) == ".tif" {
+		tags, err := readTIFFFields(data)
+		if err != nil {
+			return 0, 0, err
+		}
+		return tags.size()
+	}
+	cfg, err := png.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, err
+	}
+	return cfg.Width, cfg.Height, nil
+}
+
+// grayAt returns the gray level of img at map tile (x, y).
+func grayAt(img image.Image, x, y int) uint8 {
+	b := img.Bounds()
+	return color.GrayModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.Gray).Y
+}
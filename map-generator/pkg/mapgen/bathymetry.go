@@ -0,0 +1,51 @@
+package mapgen
+
+import (
+	"context"
+	"fmt"
+	"image"
+)
+
+// Water depth modes: what the magnitude of water tiles represents.
+const (
+	// waterDepthDistance sets water magnitude to the distance to land, see
+	// processDistToLand. It is the historical behaviour and the default.
+	waterDepthDistance = "distance"
+	// waterDepthBathymetry sets water magnitude from the map's
+	// bathymetry.png, see applyBathymetry.
+	waterDepthBathymetry = "bathymetry"
+)
+
+var waterDepths = []string{waterDepthDistance, waterDepthBathymetry}
+
+// bathymetryMaxMagnitude is the water magnitude of the darkest bathymetry,
+// packed as 10 (÷2) like the deepest water next to impassable terrain, the
+// deepest shade the game renders.
+const bathymetryMaxMagnitude = 20
+
+// applyBathymetry replaces the magnitude of every water tile with the depth
+// painted in bathymetry, from 0 for white (shallowest) to
+// bathymetryMaxMagnitude for black. scale is the number of image pixels per
+// tile side, 1 for the full-scale map and 2 and 4 for the mini maps, whose
+// tiles take the mean gray level of the pixels they cover. Land and
+// impassable tiles are unchanged.
+func applyBathymetry(ctx context.Context, terrain *terrainGrid, bathymetry image.Image, scale int) {
+	LoggerFromContext(ctx).Info(fmt.Sprintf("Setting Water tiles magnitude from bathymetry.png (1/%d scale)", scale))
+	width := terrain.Width
+	height := terrain.Height
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			if terrain.at(x, y).Type != Water {
+				continue
+			}
+			sum := 0
+			for dx := 0; dx < scale; dx++ {
+				for dy := 0; dy < scale; dy++ {
+					sum += int(grayAt(bathymetry, x*scale+dx, y*scale+dy))
+				}
+			}
+			gray := float64(sum) / float64(scale*scale)
+			terrain.at(x, y).Magnitude = (255 - gray) / 255 * bathymetryMaxMagnitude
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package mapgen
+
+import (
+	"context"
+	"fmt"
+)
+
+// Biome is the biome of a land tile, painted in the red and green channels
+// of image.png, which don't affect the terrain, see classifyBiome.
+type Biome uint8
+
+// Enumeration of possible Biome values. BiomeTemperate is the zero value, so
+// that land the passes create, such as filled lakes, is temperate.
+const (
+	BiomeTemperate Biome = iota
+	BiomeForest
+	BiomeSwamp
+	BiomeDesert
+	BiomeTundra
+)
+
+// BiomeNames names the biomes, indexed by biome.
+var BiomeNames = []string{"temperate", "forest", "swamp", "desert", "tundra"}
+
+// biomeNeutralBand is how far red and green may differ for a pixel to stay
+// temperate. Maps painted before biomes have gray land, with red and green
+// equal, and keep a single temperate biome.
+const biomeNeutralBand = 24
+
+// classifyBiome returns the biome of a land pixel of image.png. Red reads as
+// heat and green as vegetation: land where neither dominates the other by
+// more than biomeNeutralBand is temperate, green land is forest or, dark,
+// swamp, and red land is desert or, dark, tundra.
+//
+//	| Red/green          | Biome     | e.g.            |
+//	| :----------------- | :-------- | :-------------- |
+//	| within 24          | temperate | gray, #969696   |
+//	| green > red + 24   | forest    | #40a040         |
+//	|   and green < 128  | swamp     | #205020         |
+//	| red > green + 24   | desert    | #e0b040         |
+//	|   and red < 128    | tundra    | #705040         |
+func classifyBiome(red, green uint8) Biome {
+	switch d := int(green) - int(red); {
+	case d > biomeNeutralBand && green < 128:
+		return BiomeSwamp
+	case d > biomeNeutralBand:
+		return BiomeForest
+	case -d > biomeNeutralBand && red < 128:
+		return BiomeTundra
+	case -d > biomeNeutralBand:
+		return BiomeDesert
+	default:
+		return BiomeTemperate
+	}
+}
+
+// biomesLayer exports the biome of every land tile, for gameplay modifiers
+// such as slower attacks through forests or troop growth per biome.
+var biomesLayer = auxLayer{
+	Name:      "biomes",
+	File:      "biome.bin",
+	TileBytes: 1,
+	Summary:   "per-tile biome painted in the red and green channels",
+	Build:     buildBiomes,
+}
+
+// buildBiomes writes one byte per tile, row-major (index y*width+x) like
+// map.bin: 0 for water and impassable tiles, otherwise 1 + the tile's Biome,
+// as named by the "legend" of the layer's manifest entry. The entry also
+// counts the land tiles of each biome.
+func buildBiomes(ctx context.Context, in *layerInput) ([]byte, map[string]any, error) {
+	terrain := in.Terrain
+	width := terrain.Width
+	height := terrain.Height
+
+	data := make([]byte, width*height)
+	counts := make([]int, len(BiomeNames))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			tile := *terrain.at(x, y)
+			if tile.Type != Land {
+				continue
+			}
+			data[y*width+x] = 1 + byte(tile.Biome)
+			counts[tile.Biome]++
+		}
+	}
+
+	tiles := make(map[string]int, len(BiomeNames))
+	for b, name := range BiomeNames {
+		tiles[name] = counts[b]
+	}
+	LoggerFromContext(ctx).Debug(fmt.Sprintf("Biomes: %v", tiles))
+	return data, map[string]any{
+		"width":  width,
+		"height": height,
+		"legend": append([]string{"none"}, BiomeNames...),
+		"tiles":  tiles,
+	}, nil
+}
@@ -0,0 +1,210 @@
+package mapgen
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// maxTerritories is the number of territories territories.bin can label.
+const maxTerritories = math.MaxUint16
+
+// BorderFeature is a territory of borders.geojson: a named Polygon or
+// MultiPolygon feature. Import-borders writes name and code properties.
+type BorderFeature struct {
+	Type       string `json:"type"`
+	Properties struct {
+		Name string `json:"name"`
+		Code string `json:"code"`
+	} `json:"properties"`
+	Geometry struct {
+		Type        string          `json:"type"`
+		Coordinates json.RawMessage `json:"coordinates"`
+	} `json:"geometry"`
+}
+
+// Polygons returns the feature's polygons, each a list of rings of
+// [lon, lat] points: the outer boundary followed by any holes.
+func (f *BorderFeature) Polygons() ([][][][2]float64, error) {
+	switch f.Geometry.Type {
+	case "Polygon":
+		var polygon [][][2]float64
+		if err := json.Unmarshal(f.Geometry.Coordinates, &polygon); err != nil {
+			return nil, err
+		}
+		return [][][][2]float64{polygon}, nil
+	case "MultiPolygon":
+		var polygons [][][][2]float64
+		if err := json.Unmarshal(f.Geometry.Coordinates, &polygons); err != nil {
+			return nil, err
+		}
+		return polygons, nil
+	default:
+		return nil, nil
+	}
+}
+
+// parseBorders reads the features of a GeoJSON FeatureCollection.
+func parseBorders(data []byte) ([]BorderFeature, error) {
+	var doc struct {
+		Type     string          `json:"type"`
+		Features []BorderFeature `json:"features"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Type != "FeatureCollection" {
+		return nil, fmt.Errorf("expected a GeoJSON FeatureCollection, got %q", doc.Type)
+	}
+	return doc.Features, nil
+}
+
+// territory is one entry of the territories layer's manifest metadata.
+type territory struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Code  string `json:"code,omitempty"`
+	Tiles int    `json:"tiles"`
+}
+
+// territoriesLayer labels land with the real-world country or region it
+// belongs to, for nation auto-placement and historical border modes.
+var territoriesLayer = auxLayer{
+	Name:      "territories",
+	File:      "territories.bin",
+	TileBytes: 2,
+	Summary:   "territory ID of every land tile from borders.geojson",
+	Build:     buildTerritories,
+}
+
+// buildTerritories writes the territory ID of every tile as a little-endian
+// uint16, row-major like map.bin, 0 for water, impassable tiles and land
+// outside every territory. Territory IDs are the 1-based positions of the
+// features in the map's borders.geojson, so they are stable as long as the
+// file is.
+//
+// Each feature's polygons are projected with the "geo" section of info.json
+// and rasterized at tile centres, holes included; where features overlap
+// the first one wins. Land the polygons miss because their coastline is
+// coarser than the map's takes the territory of the nearest labelled land
+// tile of the same landmass. Maps without a borders.geojson or a "geo"
+// section get an empty layer.
+func buildTerritories(ctx context.Context, in *layerInput) ([]byte, map[string]any, error) {
+	logger := LoggerFromContext(ctx)
+	terrain := in.Terrain
+	width := terrain.Width
+	height := terrain.Height
+	data := make([]byte, 2*width*height)
+
+	geo := in.Geo
+	bordersBuffer, ok := in.Inputs["borders.geojson"]
+	if !ok || geo == nil {
+		logger.Debug("No borders.geojson or \"geo\" section, the territories layer is empty")
+		return data, map[string]any{"territories": []territory{}}, nil
+	}
+	features, err := parseBorders(bordersBuffer)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid borders.geojson: %w", err)
+	}
+	if len(features) > maxTerritories {
+		return nil, nil, fmt.Errorf("borders.geojson has %d features, at most %d are supported", len(features), maxTerritories)
+	}
+
+	// labels is indexed y*width+x like the terrain.
+	labels := make([]uint16, width*height)
+	territories := make([]territory, len(features))
+	var crossings []float64
+	for i := range features {
+		f := &features[i]
+		id := uint16(i + 1)
+		territories[i] = territory{ID: i + 1, Name: f.Properties.Name, Code: f.Properties.Code}
+		polygons, err := f.Polygons()
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid geometry of %q: %w", f.Properties.Name, err)
+		}
+		for _, polygon := range polygons {
+			// Project every ring and find the rows the polygon spans.
+			rings := make([][][2]float64, len(polygon))
+			minY, maxY := math.Inf(1), math.Inf(-1)
+			for r, ring := range polygon {
+				rings[r] = make([][2]float64, len(ring))
+				for j, p := range ring {
+					x, y := geo.Project(p[0], p[1], width, height)
+					rings[r][j] = [2]float64{x, y}
+					minY, maxY = math.Min(minY, y), math.Max(maxY, y)
+				}
+			}
+			// Even-odd scanline fill at tile centres: holes cancel out.
+			for ty := max(int(math.Floor(minY)), 0); ty <= min(int(math.Ceil(maxY)), height-1); ty++ {
+				cy := float64(ty) + 0.5
+				crossings = crossings[:0]
+				for _, ring := range rings {
+					for j := range ring {
+						a, b := ring[j], ring[(j+1)%len(ring)]
+						if (a[1] <= cy) != (b[1] <= cy) {
+							crossings = append(crossings, a[0]+(cy-a[1])/(b[1]-a[1])*(b[0]-a[0]))
+						}
+					}
+				}
+				sort.Float64s(crossings)
+				for j := 0; j+1 < len(crossings); j += 2 {
+					x0 := max(int(math.Ceil(crossings[j]-0.5)), 0)
+					x1 := min(int(math.Ceil(crossings[j+1]-0.5)), width)
+					for tx := x0; tx < x1; tx++ {
+						if t := ty*width + tx; labels[t] == 0 && terrain.at(tx, ty).Type == Land {
+							labels[t] = id
+						}
+					}
+				}
+			}
+		}
+	}
+
+	// Spread the labels over the land the polygons missed, breadth first so
+	// that each tile takes the territory of its nearest labelled tile.
+	var queue []Coord
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			if labels[y*width+x] != 0 {
+				queue = append(queue, Coord{x, y})
+			}
+		}
+	}
+	spread := 0
+	var buf [4]Coord
+	for len(queue) > 0 {
+		c := queue[0]
+		queue = queue[1:]
+		n := neighborCoordsWrap(c.X, c.Y, width, height, in.WrapX, &buf)
+		for _, nc := range buf[:n] {
+			if i := nc.Y*width + nc.X; labels[i] == 0 && terrain.at(nc.X, nc.Y).Type == Land {
+				labels[i] = labels[c.Y*width+c.X]
+				spread++
+				queue = append(queue, nc)
+			}
+		}
+	}
+
+	unlabelled := 0
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			id := labels[y*width+x]
+			if id == 0 {
+				if terrain.at(x, y).Type == Land {
+					unlabelled++
+				}
+				continue
+			}
+			territories[id-1].Tiles++
+			binary.LittleEndian.PutUint16(data[2*(y*width+x):], id)
+		}
+	}
+	logger.Debug(fmt.Sprintf("Labelled land with %d territories, %d tile(s) by proximity, %d tile(s) outside any territory", len(territories), spread, unlabelled))
+	return data, map[string]any{
+		"territories":      territories,
+		"unlabelled_tiles": unlabelled,
+	}, nil
+}
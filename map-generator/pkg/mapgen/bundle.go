@@ -0,0 +1,230 @@
+package mapgen
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// CombinedBinaryMagic and CombinedBinaryVersion start a combined binary;
+	// bump the version whenever the layout changes. Version 1, a header of
+	// the info, map and mini-map sections without magic or compression,
+	// never shipped.
+	CombinedBinaryMagic   = "OFMB"
+	CombinedBinaryVersion = 2
+	// combinedHeaderSize is the size of the header before the section table.
+	combinedHeaderSize = 8
+	// combinedEntrySize is the size of a section table entry.
+	combinedEntrySize = 24
+)
+
+// Sections of a combined binary.
+const (
+	SectionManifest  uint32 = 1
+	SectionMap       uint32 = 2
+	SectionMap4x     uint32 = 3
+	SectionMap16x    uint32 = 4
+	SectionThumbnail uint32 = 5
+	// SectionNavigation is the navigation layer, see buildNavigation, in
+	// bundles of maps built with it.
+	SectionNavigation uint32 = 6
+)
+
+// Section compressions of a combined binary.
+const (
+	CompressionNone uint32 = 0
+	CompressionGzip uint32 = 1
+	CompressionZstd uint32 = 2
+)
+
+// combinedZstd compresses the sections of CompressionZstd.
+var combinedZstd = ZstdEncoding("zstd-best", zstd.SpeedBestCompression)
+
+// CombinedBinaryHeader is the header and section table of a combined binary.
+type CombinedBinaryHeader struct {
+	Version  uint16
+	Sections []CombinedSection
+}
+
+// CombinedSection is a section table entry of a combined binary.
+type CombinedSection struct {
+	ID          uint32
+	Compression uint32
+	// Offset and Size locate the stored, compressed bytes in the file.
+	Offset, Size uint32
+	// RawSize and Checksum, the CRC-32 (IEEE), are of the uncompressed bytes.
+	RawSize, Checksum uint32
+}
+
+// MapBundle is the contents of a combined binary: everything the client
+// loads for a map, and the navigation data for the server.
+type MapBundle struct {
+	Manifest   []byte
+	Map        []byte
+	Map4x      []byte
+	Map16x     []byte
+	Thumbnail  []byte
+	Navigation []byte // nil without the navigation layer
+}
+
+// bundleSection is a section of a MapBundle and its contents.
+type bundleSection struct {
+	ID       uint32
+	Data     *[]byte
+	Optional bool // written only when present
+}
+
+// sections returns the sections of a bundle in file order.
+func (b *MapBundle) sections() []bundleSection {
+	return []bundleSection{
+		{SectionManifest, &b.Manifest, false},
+		{SectionMap, &b.Map, false},
+		{SectionMap4x, &b.Map4x, false},
+		{SectionMap16x, &b.Map16x, false},
+		{SectionThumbnail, &b.Thumbnail, false},
+		{SectionNavigation, &b.Navigation, true},
+	}
+}
+
+// CreateCombinedBinary packs a map's outputs into a single file, compressing
+// every section but the thumbnail, already a WebP, with compression. The
+// file is little-endian:
+//
+//	"OFMB", u16 version, u16 section count
+//	section table: per section, u32 id, u32 compression, u32 offset and
+//	               u32 size of the stored bytes in the file, u32 size and
+//	               u32 CRC-32 (IEEE) of the uncompressed bytes
+//	sections: the stored bytes of each section, in table order
+//
+// Sections are SectionManifest, SectionMap, SectionMap4x, SectionMap16x,
+// SectionThumbnail and, when present, SectionNavigation; readers skip
+// sections they do not know, so that new ones can be added without a
+// version bump. Each gzip section is a gzip stream of
+// its own, which browsers decompress natively with DecompressionStream, and
+// each zstd section a single zstd frame.
+func CreateCombinedBinary(b *MapBundle, compression uint32) ([]byte, error) {
+	if compression != CompressionGzip && compression != CompressionZstd {
+		return nil, fmt.Errorf("unsupported compression %d", compression)
+	}
+	var sections []bundleSection
+	for _, s := range b.sections() {
+		if !s.Optional || *s.Data != nil {
+			sections = append(sections, s)
+		}
+	}
+	le := binary.LittleEndian
+	out := []byte(CombinedBinaryMagic)
+	out = le.AppendUint16(out, CombinedBinaryVersion)
+	out = le.AppendUint16(out, uint16(len(sections)))
+	table := len(out)
+	out = append(out, make([]byte, combinedEntrySize*len(sections))...)
+
+	for i, s := range sections {
+		raw := *s.Data
+		stored, method := raw, compression
+		if s.ID == SectionThumbnail {
+			method = CompressionNone
+		}
+		var err error
+		switch method {
+		case CompressionGzip:
+			stored, err = EncodeGzip(raw)
+		case CompressionZstd:
+			stored, err = combinedZstd.Encode(raw)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("section %d: %w", s.ID, err)
+		}
+		entry := out[table+combinedEntrySize*i:]
+		le.PutUint32(entry[0:], s.ID)
+		le.PutUint32(entry[4:], method)
+		le.PutUint32(entry[8:], uint32(len(out)))
+		le.PutUint32(entry[12:], uint32(len(stored)))
+		le.PutUint32(entry[16:], uint32(len(raw)))
+		le.PutUint32(entry[20:], crc32.ChecksumIEEE(raw))
+		out = append(out, stored...)
+		if len(out) > 1<<32-1 {
+			return nil, errors.New("combined binary over 4 GiB")
+		}
+	}
+	return out, nil
+}
+
+// DecodeCombinedBinary parses a combined binary, decompressing every section
+// and checking it against its size and checksum. Unknown sections are
+// skipped; every section of MapBundle but the navigation data is required.
+func DecodeCombinedBinary(data []byte) (*CombinedBinaryHeader, *MapBundle, error) {
+	le := binary.LittleEndian
+	if len(data) < combinedHeaderSize || string(data[:4]) != CombinedBinaryMagic {
+		return nil, nil, errors.New("not a combined binary")
+	}
+	header := &CombinedBinaryHeader{Version: le.Uint16(data[4:])}
+	if header.Version != CombinedBinaryVersion {
+		return nil, nil, fmt.Errorf("unsupported combined binary version %d", header.Version)
+	}
+	n := int(le.Uint16(data[6:]))
+	if len(data) < combinedHeaderSize+combinedEntrySize*n {
+		return nil, nil, errors.New("truncated section table")
+	}
+
+	bundle := &MapBundle{}
+	targets := make(map[uint32]*[]byte)
+	for _, s := range bundle.sections() {
+		targets[s.ID] = s.Data
+	}
+	for i := 0; i < n; i++ {
+		entry := data[combinedHeaderSize+combinedEntrySize*i:]
+		s := CombinedSection{
+			ID:          le.Uint32(entry[0:]),
+			Compression: le.Uint32(entry[4:]),
+			Offset:      le.Uint32(entry[8:]),
+			Size:        le.Uint32(entry[12:]),
+			RawSize:     le.Uint32(entry[16:]),
+			Checksum:    le.Uint32(entry[20:]),
+		}
+		header.Sections = append(header.Sections, s)
+		target, ok := targets[s.ID]
+		if !ok {
+			continue
+		}
+		if *target != nil {
+			return nil, nil, fmt.Errorf("duplicate section %d", s.ID)
+		}
+		if uint64(s.Offset)+uint64(s.Size) > uint64(len(data)) {
+			return nil, nil, fmt.Errorf("section %d out of bounds", s.ID)
+		}
+		stored := data[s.Offset : s.Offset+s.Size]
+		var raw []byte
+		var err error
+		switch s.Compression {
+		case CompressionNone:
+			raw = stored
+		case CompressionGzip:
+			raw, err = DecodeGzip(stored)
+		case CompressionZstd:
+			raw, err = combinedZstd.Decode(stored)
+		default:
+			return nil, nil, fmt.Errorf("section %d has unsupported compression %d", s.ID, s.Compression)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("section %d: %w", s.ID, err)
+		}
+		if len(raw) != int(s.RawSize) || crc32.ChecksumIEEE(raw) != s.Checksum {
+			return nil, nil, fmt.Errorf("section %d does not match its checksum", s.ID)
+		}
+		if raw == nil {
+			raw = []byte{}
+		}
+		*target = raw
+	}
+	for _, s := range bundle.sections() {
+		if *s.Data == nil && !s.Optional {
+			return nil, nil, fmt.Errorf("missing section %d", s.ID)
+		}
+	}
+	return header, bundle, nil
+}
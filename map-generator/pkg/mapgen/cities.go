@@ -0,0 +1,112 @@
+package mapgen
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// citySnapRadius is how far, in tiles, a city projected onto water is moved
+// to the nearest land tile. Coastal cities often fall just off a coastline
+// drawn at the map's resolution.
+const citySnapRadius = 4
+
+// CityRecord is one city of a map's cities.json, as written by import-cities.
+type CityRecord struct {
+	Name       string  `json:"name"`
+	Country    string  `json:"country"`
+	Lon        float64 `json:"lon"`
+	Lat        float64 `json:"lat"`
+	Population int     `json:"population"`
+	Capital    bool    `json:"capital"`
+}
+
+// City is one entry of the manifest "cities" section.
+type City struct {
+	Name        string `json:"name"`
+	Country     string `json:"country"`
+	Coordinates [2]int `json:"coordinates"`
+	Population  int    `json:"population"`
+	Capital     bool   `json:"capital"`
+}
+
+// placeCities projects the cities of the map's optional cities.json onto its
+// full-scale terrain with the "geo" section of info.json, for scenario modes
+// and bots that need plausible city positions. Cities that fall on water are
+// moved to the nearest land tile within citySnapRadius tiles, and dropped if
+// there is none, as are cities outside the map. When several cities share a
+// tile, only the most populous is kept. The result is ordered by decreasing
+// population, and is nil for maps without cities.json or "geo".
+func placeCities(ctx context.Context, in *layerInput) ([]City, error) {
+	logger := LoggerFromContext(ctx)
+	buf, ok := in.Inputs["cities.json"]
+	if !ok {
+		return nil, nil
+	}
+	geo := in.Geo
+	if geo == nil {
+		logger.Warn("cities.json is ignored without a \"geo\" section in info.json")
+		return nil, nil
+	}
+	var doc struct {
+		Cities []CityRecord `json:"cities"`
+	}
+	if err := json.Unmarshal(buf, &doc); err != nil {
+		return nil, fmt.Errorf("invalid cities.json: %w", err)
+	}
+	records := doc.Cities
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Population > records[j].Population })
+
+	terrain := in.Terrain
+	width := terrain.Width
+	height := terrain.Height
+	taken := make(map[Coord]bool)
+	cities := []City{}
+	dropped := 0
+	for _, r := range records {
+		px, py := geo.Project(r.Lon, r.Lat, width, height)
+		x, y := int(math.Floor(px)), int(math.Floor(py))
+		if x < 0 || x >= width || y < 0 || y >= height {
+			dropped++
+			continue
+		}
+		c, ok := nearestLand(terrain, x, y, citySnapRadius)
+		if !ok || taken[c] {
+			dropped++
+			continue
+		}
+		taken[c] = true
+		cities = append(cities, City{
+			Name:        r.Name,
+			Country:     r.Country,
+			Coordinates: [2]int{c.X, c.Y},
+			Population:  r.Population,
+			Capital:     r.Capital,
+		})
+	}
+	logger.Debug(fmt.Sprintf("Placed %d of %d cities, dropped %d off the map, on water or sharing a tile", len(cities), len(records), dropped))
+	return cities, nil
+}
+
+// nearestLand returns the land tile closest to (x, y), by Euclidean distance
+// and then scan order, within radius tiles.
+func nearestLand(terrain *terrainGrid, x, y, radius int) (Coord, bool) {
+	width := terrain.Width
+	height := terrain.Height
+	best, bestDist := Coord{}, math.MaxInt
+	for dx := -radius; dx <= radius; dx++ {
+		for dy := -radius; dy <= radius; dy++ {
+			nx, ny := x+dx, y+dy
+			d := dx*dx + dy*dy
+			if nx < 0 || nx >= width || ny < 0 || ny >= height || d > radius*radius || d >= bestDist {
+				continue
+			}
+			if terrain.at(nx, ny).Type == Land {
+				best, bestDist = Coord{nx, ny}, d
+			}
+		}
+	}
+	return best, bestDist != math.MaxInt
+}
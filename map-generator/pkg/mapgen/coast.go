@@ -0,0 +1,258 @@
+package mapgen
+
+import (
+	"context"
+	"fmt"
+	"math"
+)
+
+// Coast resolution modes: how pixels that antialiasing blended between
+// water and land are classified.
+const (
+	// coastCutoff classifies every pixel on its own: alpha under 20 or
+	// the water blue is water, anything else land. It is the historical behaviour
+	// and the default, so existing maps keep their outputs.
+	coastCutoff = "cutoff"
+	// coastMajority classifies ambiguous pixels by the majority of their
+	// neighbours, see resolveAmbiguousCoast.
+	coastMajority = "majority"
+)
+
+var coastResolutions = []string{coastCutoff, coastMajority}
+
+const (
+	// coastAlphaCutoff is the alpha under which a pixel is water.
+	coastAlphaCutoff = 20
+	// coastAlphaOpaque is the alpha from which a pixel is taken at face
+	// value. Pixels between coastAlphaCutoff and coastAlphaOpaque are
+	// partially transparent and ambiguous.
+	coastAlphaOpaque = 236
+	// WaterKeyBlue is the blue value that marks water by default, see
+	// "generator.water_blue".
+	WaterKeyBlue = 106
+	// waterKeyTolerance is how far the blue value of an opaque pixel next
+	// to water may be from the water blue for the pixel to count as a blend
+	// of water and land rather than land.
+	waterKeyTolerance = 6
+)
+
+// Kinds of ambiguous pixels recorded while reading the image.
+const (
+	pixelClear uint8 = iota
+	// pixelTranslucentWater and pixelTranslucentLand are partially
+	// transparent pixels, under and over half opacity.
+	pixelTranslucentWater
+	pixelTranslucentLand
+	// pixelNearWaterKey is an opaque pixel whose blue value is within
+	// waterKeyTolerance of the water blue. It is only ambiguous next to water.
+	pixelNearWaterKey
+	// pixelInherit is a pixel of an "inherit" key colour, an annotation
+	// that always takes the terrain of its neighbours, in either mode.
+	pixelInherit
+)
+
+// classifyCoastPixel returns the ambiguity kind of a pixel the cutoff
+// classification did not make water, waterBlue being the blue of water.
+func classifyCoastPixel(blue, alpha uint8, waterBlue int) uint8 {
+	switch {
+	case alpha < coastAlphaOpaque && alpha >= 128:
+		return pixelTranslucentLand
+	case alpha < coastAlphaOpaque:
+		return pixelTranslucentWater
+	case int(blue) != waterBlue && int(blue) >= waterBlue-waterKeyTolerance && int(blue) <= waterBlue+waterKeyTolerance:
+		return pixelNearWaterKey
+	default:
+		return pixelClear
+	}
+}
+
+// resolveAmbiguousCoast finds the pixels antialiasing left ambiguous and, in
+// coastMajority mode, reclassifies them. kinds holds the classifyCoastPixel
+// result of every pixel, indexed y*width+x. Partially transparent pixels
+// are always ambiguous; near-water-key pixels only when a 4-neighbour is
+// clearly water.
+//
+// Ambiguous pixels are resolved in rings of increasing distance from the
+// clear pixels. A pixel takes the terrain held by most of its 8 neighbours
+// resolved in earlier rings, ignoring impassable ones, so the outcome does
+// not depend on scan order. Ties fall back to the pixel itself: water under
+// half opacity or near the water key, land otherwise. Land takes the lowest
+// magnitude of its land neighbours, since coasts are lowland.
+//
+// Pixels of an "inherit" key colour are resolved the same way in either
+// mode, except that they may also take impassable terrain, when most of
+// their neighbours are impassable, and land takes the mean magnitude of its
+// land neighbours, so that annotations vanish into whatever they cover.
+//
+// It returns the number of ambiguous pixels, which are only changed in
+// coastMajority mode, not counting inherit pixels.
+func resolveAmbiguousCoast(ctx context.Context, terrain *terrainGrid, kinds []uint8, mode string, wrapX bool) int {
+	width := terrain.Width
+	height := terrain.Height
+	var buf [4]Coord
+	ambiguous := make([]bool, width*height)
+	count, inherited := 0, 0
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			kind := kinds[y*width+x]
+			if kind == pixelInherit {
+				ambiguous[y*width+x] = true
+				inherited++
+				continue
+			}
+			if kind == pixelNearWaterKey {
+				n := neighborCoordsWrap(x, y, width, height, wrapX, &buf)
+				nextToWater := false
+				for _, c := range buf[:n] {
+					i := c.Y*width + c.X
+					if kinds[i] == pixelClear && terrain.at(c.X, c.Y).Type == Water {
+						nextToWater = true
+						break
+					}
+				}
+				if !nextToWater {
+					continue
+				}
+			} else if kind == pixelClear {
+				continue
+			}
+			ambiguous[y*width+x] = true
+			count++
+		}
+	}
+	if problems := problemsFromContext(ctx); problems != nil && count > 0 && mode != coastMajority {
+		var coords []Coord
+		for i, a := range ambiguous {
+			if a && kinds[i] != pixelInherit {
+				coords = append(coords, Coord{X: i / height, Y: i % height})
+			}
+		}
+		problems.addCells(ProblemAmbiguousCoast, coords, ambiguousCoastCell, "%d pixel(s) look antialiased between water and land and were classified by their blue value alone")
+	}
+	resolving := count + inherited
+	if mode != coastMajority {
+		// Only inherit pixels are resolved
+		for i, k := range kinds {
+			ambiguous[i] = ambiguous[i] && k == pixelInherit
+		}
+		resolving = inherited
+	}
+	if resolving == 0 {
+		return count
+	}
+
+	// neighbours8 calls fn for the in-bounds 8-neighbours of (x, y).
+	neighbours8 := func(x, y int, fn func(nx, ny int)) {
+		for dx := -1; dx <= 1; dx++ {
+			for dy := -1; dy <= 1; dy++ {
+				nx, ny := x+dx, y+dy
+				if dx == 0 && dy == 0 || ny < 0 || ny >= height {
+					continue
+				}
+				if wrapX {
+					nx = (nx + width) % width
+				} else if nx < 0 || nx >= width {
+					continue
+				}
+				fn(nx, ny)
+			}
+		}
+	}
+
+	resolved := make([]bool, width*height)
+	var ring []Coord
+	queued := make([]bool, width*height)
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			if ambiguous[y*width+x] {
+				continue
+			}
+			resolved[y*width+x] = true
+			neighbours8(x, y, func(nx, ny int) {
+				if i := ny*width + nx; ambiguous[i] && !queued[i] {
+					queued[i] = true
+					ring = append(ring, Coord{nx, ny})
+				}
+			})
+		}
+	}
+	rings := 0
+	type decision struct {
+		c Coord
+		t Terrain
+	}
+	var decisions []decision
+	for len(ring) > 0 {
+		rings++
+		decisions = decisions[:0]
+		for _, c := range ring {
+			water, land := 0, 0
+			minMagnitude, sumMagnitude := math.Inf(1), 0.0
+			var impassable [ImpassableLava + 1]int
+			neighbours8(c.X, c.Y, func(nx, ny int) {
+				if !resolved[ny*width+nx] {
+					return
+				}
+				switch t := *terrain.at(nx, ny); t.Type {
+				case Water:
+					water++
+				case Land:
+					land++
+					minMagnitude = math.Min(minMagnitude, t.Magnitude)
+					sumMagnitude += t.Magnitude
+				default:
+					impassable[t.Kind]++
+				}
+			})
+			kind := kinds[c.Y*width+c.X]
+			toWater := water > land || water == land && kind != pixelTranslucentLand
+			t := Terrain{Type: Water}
+			if !toWater {
+				t = Terrain{Type: Land}
+				if land > 0 {
+					t.Magnitude = minMagnitude
+				}
+			}
+			if kind == pixelInherit {
+				if land > 0 && !toWater {
+					t.Magnitude = sumMagnitude / float64(land)
+				}
+				for k, n := range impassable {
+					if n > max(water, land) && (t.Type != Impassable || n > impassable[t.Kind]) {
+						t = Terrain{Type: Impassable, Kind: ImpassableKind(k)}
+					}
+				}
+			}
+			decisions = append(decisions, decision{c, t})
+		}
+		var next []Coord
+		for _, d := range decisions {
+			*terrain.at(d.c.X, d.c.Y) = d.t
+			resolved[d.c.Y*width+d.c.X] = true
+		}
+		for _, d := range decisions {
+			neighbours8(d.c.X, d.c.Y, func(nx, ny int) {
+				if i := ny*width + nx; ambiguous[i] && !queued[i] {
+					queued[i] = true
+					next = append(next, Coord{nx, ny})
+				}
+			})
+		}
+		ring = next
+	}
+	// Ambiguous pixels out of reach of any clear pixel only happen in
+	// images that are ambiguous throughout; keep the pixel's own reading.
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			if i := y*width + x; ambiguous[i] && !queued[i] {
+				if kinds[i] == pixelTranslucentLand {
+					*terrain.at(x, y) = Terrain{Type: Land}
+				} else {
+					*terrain.at(x, y) = Terrain{Type: Water}
+				}
+			}
+		}
+	}
+	LoggerFromContext(ctx).Debug(fmt.Sprintf("Resolved %d ambiguous coast and %d inherit pixel(s) in %d ring(s)", resolving-inherited, inherited, rings))
+	return count
+}
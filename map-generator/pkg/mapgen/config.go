@@ -0,0 +1,220 @@
+package mapgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Minimap magnitude aggregation modes: how the land magnitude of a mini-map
+// tile is derived from the land tiles of the 2x2 block it covers.
+const (
+	// aggregateSample keeps the magnitude of a single source tile, the last
+	// land tile of the block in scan order. It is the historical behaviour
+	// and the default, so existing maps keep their outputs.
+	aggregateSample  = "sample"
+	aggregateAverage = "average"
+	aggregateMax     = "max"
+	aggregateMedian  = "median"
+)
+
+var minimapAggregations = []string{aggregateSample, aggregateAverage, aggregateMax, aggregateMedian}
+
+// GeneratorConfig holds per-map generator settings from the optional
+// "generator" section of info.json. The resolved settings are recorded in the
+// manifest's "generator" section.
+type GeneratorConfig struct {
+	// MinimapAggregation is how the magnitude of a mini-map land tile is
+	// derived from the block it covers, one of minimapAggregations;
+	// average and median give smoother mini-map elevation.
+	MinimapAggregation string `json:"minimap_aggregation"`
+	// WrapX makes the map wrap horizontally, its east edge joining the
+	// west edge, for world maps without a wall at the antimeridian. Flood
+	// fills, shorelines and distances to land then continue across the
+	// seam at every scale, as do the layers that take it, such as lanes and
+	// island_graph. The image must be a multiple of 4 pixels wide, so that
+	// cropping leaves the seam intact.
+	WrapX bool `json:"wrap_x"`
+	// Encoding is the terrain encoding recommended for the map by the
+	// encodings command, one of TerrainEncodings. It is only recorded, in
+	// the manifest's "generator" section, for clients that compress the
+	// packed terrain: the generator writes it unencoded regardless.
+	Encoding string `json:"encoding"`
+	// CoastResolution is how antialiased coast pixels are classified, one
+	// of coastResolutions.
+	CoastResolution string `json:"coast_resolution"`
+	// PlainsDither is the amplitude, in magnitude steps, of the noise added
+	// to plains by ditherPlains; 0 disables it.
+	PlainsDither int `json:"plains_dither"`
+	// WaterDepth is what water magnitude represents, one of waterDepths.
+	WaterDepth string `json:"water_depth"`
+	// Projection is the projection the map is generated in, one of
+	// mapProjections, or ProjectionSource to keep the projection of its
+	// source image. Other projections need the "geo" section of info.json.
+	Projection string `json:"projection"`
+	// ImpassableRidges turns the mountain ridges found by detectRidges into
+	// impassable terrain, leaving their passes as the only ways across.
+	ImpassableRidges bool `json:"impassable_ridges"`
+	// MinIslandSize is the size, in tiles, under which landmasses are
+	// removed, halved on the 1/4 scale map, see removeSmallIslands.
+	MinIslandSize int `json:"min_island_size"`
+	// MinLakeSize is the size, in tiles, under which lakes without a key
+	// colour are filled with land, see processWater.
+	MinLakeSize int `json:"min_lake_size"`
+	// RemoveSmall turns the removal of small islands and lakes on or off,
+	// e.g. off for archipelagos of tiny islands. The generator command turns
+	// it off for test maps.
+	RemoveSmall bool `json:"remove_small"`
+	// WaterBlue is the blue value of the pixels of image.png that are water.
+	WaterBlue int `json:"water_blue"`
+	// Elevation maps the blue value of land pixels to their magnitude.
+	Elevation elevationConfig `json:"elevation"`
+	// Archipelago, when set, fragments large landmasses into island chains
+	// before water processing, see carveArchipelago.
+	Archipelago *archipelagoConfig `json:"archipelago,omitempty"`
+	// ImpassableColors maps "#rrggbb" colours of image.png to the
+	// ImpassableKind, by name, of the impassable tiles they mark, such as ice
+	// sheets or lava fields, see ParseImpassableColors.
+	ImpassableColors map[string]string `json:"impassable_colors,omitempty"`
+	// KeyColors maps "#rrggbb" colours of image.png to the keyFeature, by
+	// name, they mark, such as forced oceans or spawn markers, see
+	// ParseKeyColors.
+	KeyColors map[string]string `json:"key_colors,omitempty"`
+	// MovementCost overrides the weights of the movement_cost layer, see
+	// buildMovementCost.
+	MovementCost *movementCostConfig `json:"movement_cost,omitempty"`
+	// DownloadBudgetKiB overrides the generator command's
+	// --download-budget-kib for the map.
+	DownloadBudgetKiB int `json:"download_budget_kib,omitempty"`
+	// Symmetry declares the axes the map is symmetric under, checked by the
+	// generator command after generation.
+	Symmetry *SymmetryConfig `json:"symmetry,omitempty"`
+	// QualityGates fails the map when generation crosses its thresholds,
+	// checked by the generator command after generation.
+	QualityGates *QualityGates `json:"quality_gates,omitempty"`
+	// Heightmap maps the elevations of heightmap.png or heightmap.tif to
+	// terrain, see readHeightmap; maps with a heightmap and no such section
+	// use defaultHeightmapConfig.
+	Heightmap *heightmapConfig `json:"heightmap,omitempty"`
+	// Rivers sets the width and length of the narrow water marked as
+	// rivers, and whether to keep river-shaped lakes, see detectRivers and
+	// keepRivers; maps without it use defaultRiversConfig.
+	Rivers *riversConfig `json:"rivers,omitempty"`
+	// Spawns computes start locations for the manifest "spawns" section,
+	// see placeSpawns; maps without it have none.
+	Spawns *spawnConfig `json:"spawns,omitempty"`
+}
+
+// DefaultGeneratorConfig returns the settings used when info.json doesn't
+// override them.
+func DefaultGeneratorConfig() GeneratorConfig {
+	return GeneratorConfig{
+		MinimapAggregation: aggregateSample,
+		Encoding:           EncodingRaw,
+		CoastResolution:    coastCutoff,
+		WaterDepth:         waterDepthDistance,
+		Projection:         ProjectionSource,
+		MinIslandSize:      defaultMinIslandSize,
+		MinLakeSize:        MinLakeSize,
+		RemoveSmall:        true,
+		WaterBlue:          WaterKeyBlue,
+		Elevation:          defaultElevationConfig(),
+	}
+}
+
+// ParseGeneratorConfig reads and validates the "generator" section of an
+// info.json buffer, filling in defaults.
+func ParseGeneratorConfig(info []byte) (GeneratorConfig, error) {
+	doc := struct {
+		Generator GeneratorConfig `json:"generator"`
+	}{Generator: DefaultGeneratorConfig()}
+	if err := json.Unmarshal(info, &doc); err != nil {
+		return GeneratorConfig{}, fmt.Errorf("invalid \"generator\" section: %w", err)
+	}
+	cfg := doc.Generator
+	if !containsString(minimapAggregations, cfg.MinimapAggregation) {
+		return GeneratorConfig{}, fmt.Errorf("\"generator.minimap_aggregation\" (%q) must be one of: %s", cfg.MinimapAggregation, strings.Join(minimapAggregations, ", "))
+	}
+	if names := terrainEncodingNames(); !containsString(names, cfg.Encoding) {
+		return GeneratorConfig{}, fmt.Errorf("\"generator.encoding\" (%q) must be one of: %s", cfg.Encoding, strings.Join(names, ", "))
+	}
+	if !containsString(coastResolutions, cfg.CoastResolution) {
+		return GeneratorConfig{}, fmt.Errorf("\"generator.coast_resolution\" (%q) must be one of: %s", cfg.CoastResolution, strings.Join(coastResolutions, ", "))
+	}
+	if cfg.PlainsDither < 0 || cfg.PlainsDither > maxPlainsDither {
+		return GeneratorConfig{}, fmt.Errorf("\"generator.plains_dither\" (%d) must be between 0 and %d", cfg.PlainsDither, maxPlainsDither)
+	}
+	if !containsString(waterDepths, cfg.WaterDepth) {
+		return GeneratorConfig{}, fmt.Errorf("\"generator.water_depth\" (%q) must be one of: %s", cfg.WaterDepth, strings.Join(waterDepths, ", "))
+	}
+	if cfg.Projection != ProjectionSource && !containsString(mapProjections, cfg.Projection) {
+		return GeneratorConfig{}, fmt.Errorf("\"generator.projection\" (%q) must be one of: %s, %s", cfg.Projection, ProjectionSource, strings.Join(mapProjections, ", "))
+	}
+	if cfg.Archipelago != nil {
+		if err := cfg.Archipelago.validate(); err != nil {
+			return GeneratorConfig{}, fmt.Errorf("\"generator.archipelago\": %w", err)
+		}
+	}
+	if cfg.MovementCost != nil {
+		if err := cfg.MovementCost.validate(); err != nil {
+			return GeneratorConfig{}, fmt.Errorf("\"generator.movement_cost\": %w", err)
+		}
+	}
+	if cfg.Symmetry != nil {
+		if err := cfg.Symmetry.validate(); err != nil {
+			return GeneratorConfig{}, fmt.Errorf("\"generator.symmetry\": %w", err)
+		}
+	}
+	if cfg.QualityGates != nil {
+		if err := cfg.QualityGates.validate(); err != nil {
+			return GeneratorConfig{}, fmt.Errorf("\"generator.quality_gates\": %w", err)
+		}
+	}
+	if cfg.Heightmap != nil {
+		if err := cfg.Heightmap.validate(); err != nil {
+			return GeneratorConfig{}, fmt.Errorf("\"generator.heightmap\": %w", err)
+		}
+	}
+	if cfg.Spawns != nil {
+		if err := cfg.Spawns.validate(); err != nil {
+			return GeneratorConfig{}, fmt.Errorf("\"generator.spawns\": %w", err)
+		}
+	}
+	if cfg.Rivers != nil {
+		if err := cfg.Rivers.validate(); err != nil {
+			return GeneratorConfig{}, fmt.Errorf("\"generator.rivers\": %w", err)
+		}
+	}
+	if cfg.MinIslandSize < 0 {
+		return GeneratorConfig{}, fmt.Errorf("\"generator.min_island_size\" (%d) must not be negative", cfg.MinIslandSize)
+	}
+	if cfg.MinLakeSize < 0 {
+		return GeneratorConfig{}, fmt.Errorf("\"generator.min_lake_size\" (%d) must not be negative", cfg.MinLakeSize)
+	}
+	if cfg.WaterBlue < 0 || cfg.WaterBlue > 255 {
+		return GeneratorConfig{}, fmt.Errorf("\"generator.water_blue\" (%d) must be between 0 and 255", cfg.WaterBlue)
+	}
+	if err := cfg.Elevation.validate(); err != nil {
+		return GeneratorConfig{}, fmt.Errorf("\"generator.elevation\": %w", err)
+	}
+	if cfg.DownloadBudgetKiB < 0 {
+		return GeneratorConfig{}, fmt.Errorf("\"generator.download_budget_kib\" (%d) must not be negative", cfg.DownloadBudgetKiB)
+	}
+	impassable, err := ParseImpassableColors(cfg.ImpassableColors)
+	if err != nil {
+		return GeneratorConfig{}, err
+	}
+	if _, err := ParseKeyColors(cfg.KeyColors, impassable); err != nil {
+		return GeneratorConfig{}, err
+	}
+	return cfg, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
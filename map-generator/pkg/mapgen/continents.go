@@ -0,0 +1,229 @@
+package mapgen
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// defaultMinContinentShare is the share of a map's land a landmass (or group
+// of landmasses merged across straits) needs to count as a continent, unless
+// info.json sets "continents.min_size".
+const defaultMinContinentShare = 0.05
+
+// continentConfig is the optional "continents" section of info.json.
+type continentConfig struct {
+	// MinSize is the minimum continent size in land tiles. Zero means
+	// defaultMinContinentShare of the map's land.
+	MinSize int `json:"min_size"`
+	// MergeGap joins landmasses separated by straits of at most this many
+	// water tiles into one continent. Zero disables merging.
+	MergeGap int `json:"merge_gap"`
+	// Names assigns a name to the continent containing each coordinate.
+	// Named continents take IDs in this order, starting at 1.
+	Names []struct {
+		Name        string `json:"name"`
+		Coordinates [2]int `json:"coordinates"`
+	} `json:"names"`
+}
+
+// Continent is one entry of the manifest "continents" section.
+type Continent struct {
+	ID             int     `json:"id"`
+	Name           string  `json:"name"`
+	Size           int     `json:"size"` // land tiles
+	LandShare      float64 `json:"land_share"`
+	ShorelineTiles int     `json:"shoreline_tiles"`
+	Landmasses     int     `json:"landmasses"`
+	Centroid       [2]int  `json:"centroid"`
+	Bounds         [4]int  `json:"bounds"` // [minX, minY, maxX, maxY], inclusive
+}
+
+// continentLabels holds the continents of a map and the continent ID of each
+// tile, indexed y*width+x, 0 for tiles outside any continent.
+type continentLabels struct {
+	Continents []Continent
+	Labels     []uint8
+}
+
+// parseContinentConfig reads the "continents" section of an info.json
+// buffer.
+func parseContinentConfig(info []byte) (continentConfig, error) {
+	var doc struct {
+		Continents continentConfig `json:"continents"`
+	}
+	if len(info) == 0 {
+		return doc.Continents, nil
+	}
+	if err := json.Unmarshal(info, &doc); err != nil {
+		return doc.Continents, fmt.Errorf("invalid \"continents\" section: %w", err)
+	}
+	if doc.Continents.MinSize < 0 || doc.Continents.MergeGap < 0 {
+		return doc.Continents, fmt.Errorf("\"continents\" min_size and merge_gap must not be negative")
+	}
+	return doc.Continents, nil
+}
+
+// labelContinents segments the land into continents: connected landmasses,
+// optionally merged across straits of at most MergeGap water tiles (see
+// buildIslandGraph), of at least MinSize land tiles.
+//
+// IDs are stable for an unchanged map: named continents come first, in the
+// order of the name hints, followed by the rest in column-major order of
+// their first tile. Unnamed continents are called "Continent <id>".
+func labelContinents(ctx context.Context, in *layerInput) (*continentLabels, error) {
+	logger := LoggerFromContext(ctx)
+	cfg, err := parseContinentConfig(in.Info)
+	if err != nil {
+		return nil, err
+	}
+	terrain := in.Terrain
+	width := terrain.Width
+	height := terrain.Height
+	landmasses := in.Landmasses()
+
+	// Union landmasses joined by narrow straits.
+	parent := make([]int, len(landmasses.Sizes))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	if cfg.MergeGap > 0 {
+		for _, e := range in.IslandGraph().Edges {
+			if e.Gap <= cfg.MergeGap {
+				a, b := find(e.A), find(e.B)
+				if a != b {
+					parent[max(a, b)] = min(a, b)
+				}
+			}
+		}
+	}
+	groupSize := make(map[int]int)
+	groupLandmasses := make(map[int]int)
+	for i, size := range landmasses.Sizes {
+		groupSize[find(i)] += size
+		groupLandmasses[find(i)]++
+	}
+
+	minSize := cfg.MinSize
+	if minSize == 0 {
+		minSize = int(math.Ceil(defaultMinContinentShare * float64(in.Stats.LandTiles)))
+	}
+
+	// Order continents: named first, then by first tile. Landmass labels
+	// follow column-major order of their first tile, and a group's root is
+	// its smallest label.
+	ids := make(map[int]int)
+	names := make(map[int]string)
+	for _, hint := range cfg.Names {
+		x, y := hint.Coordinates[0], hint.Coordinates[1]
+		if x < 0 || y < 0 || x >= width || y >= height || landmasses.Labels[y*width+x] < 0 {
+			logger.Warn(fmt.Sprintf("Continent name %q: %d,%d is not on land", hint.Name, x, y))
+			continue
+		}
+		root := find(int(landmasses.Labels[y*width+x]))
+		if groupSize[root] < minSize {
+			logger.Warn(fmt.Sprintf("Continent name %q: %d,%d is on a landmass of %d tiles, smaller than the minimum continent size %d", hint.Name, x, y, groupSize[root], minSize))
+			continue
+		}
+		if _, ok := ids[root]; ok {
+			logger.Warn(fmt.Sprintf("Continent name %q: %d,%d is on continent %q", hint.Name, x, y, names[root]))
+			continue
+		}
+		ids[root] = len(ids) + 1
+		names[root] = hint.Name
+	}
+	var roots []int
+	for root, size := range groupSize {
+		if _, named := ids[root]; !named && size >= minSize {
+			roots = append(roots, root)
+		}
+	}
+	sort.Ints(roots)
+	for _, root := range roots {
+		ids[root] = len(ids) + 1
+	}
+	if len(ids) > math.MaxUint8 {
+		return nil, fmt.Errorf("map has %d continents, at most %d are supported; raise \"continents.min_size\"", len(ids), math.MaxUint8)
+	}
+
+	result := &continentLabels{
+		Continents: make([]Continent, len(ids)),
+		Labels:     make([]uint8, width*height),
+	}
+	for root, id := range ids {
+		name := names[root]
+		if name == "" {
+			name = fmt.Sprintf("Continent %d", id)
+		}
+		result.Continents[id-1] = Continent{
+			ID:         id,
+			Name:       name,
+			Size:       groupSize[root],
+			LandShare:  math.Round(float64(groupSize[root])/float64(in.Stats.LandTiles)*1000) / 1000,
+			Landmasses: groupLandmasses[root],
+			Bounds:     [4]int{width, height, -1, -1},
+		}
+	}
+	sumX := make([]int, len(ids))
+	sumY := make([]int, len(ids))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			label := landmasses.Labels[y*width+x]
+			if label < 0 {
+				continue
+			}
+			id, ok := ids[find(int(label))]
+			if !ok {
+				continue
+			}
+			result.Labels[y*width+x] = uint8(id)
+			c := &result.Continents[id-1]
+			sumX[id-1] += x
+			sumY[id-1] += y
+			c.Bounds = [4]int{min(c.Bounds[0], x), min(c.Bounds[1], y), max(c.Bounds[2], x), max(c.Bounds[3], y)}
+			if terrain.at(x, y).Shoreline {
+				c.ShorelineTiles++
+			}
+		}
+	}
+	for i := range result.Continents {
+		c := &result.Continents[i]
+		c.Centroid = [2]int{sumX[i] / c.Size, sumY[i] / c.Size}
+	}
+	logger.Debug(fmt.Sprintf("Found %d continent(s) of at least %d tiles", len(result.Continents), minSize))
+	return result, nil
+}
+
+// continentsLayer exports the continent of every tile, for objective modes
+// such as "conquer a continent": one byte per tile, row-major like map.bin,
+// holding the continent ID, or 0 for tiles outside every continent.
+var continentsLayer = auxLayer{
+	Name:      "continents",
+	File:      "continents.bin",
+	TileBytes: 1,
+	Summary:   "continent ID of every tile",
+	Build: func(ctx context.Context, in *layerInput) ([]byte, map[string]any, error) {
+		continents, err := in.Continents(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		width := in.Terrain.Width
+		height := in.Terrain.Height
+		data := make([]byte, width*height)
+		for x := 0; x < width; x++ {
+			for y := 0; y < height; y++ {
+				data[y*width+x] = continents.Labels[y*width+x]
+			}
+		}
+		return data, map[string]any{"width": width, "height": height}, nil
+	},
+}
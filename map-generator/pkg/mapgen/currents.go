@@ -0,0 +1,198 @@
+package mapgen
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+)
+
+const (
+	// currentNoiseScale is the size, in tiles, of the largest current
+	// features.
+	currentNoiseScale = 256.0
+	// currentCoastFalloff is the distance from land, in tiles, over which
+	// currents are turned to run along the coast rather than into it.
+	currentCoastFalloff = 12.0
+	// currentPreviewScale is the downscale factor of currents_preview.png.
+	currentPreviewScale = 4
+)
+
+// currentsLayer is a smooth vector field over ocean tiles for prototyping
+// currents that affect boat speed, and currentsPreviewLayer renders it for
+// review. currents.bin holds two signed bytes per tile, row-major like
+// map.bin: the x and y components scaled to -127..127, the strongest
+// current of the map being 127. Lakes, land and impassable tiles are zero.
+// The field is seeded with the map name, so it is stable across
+// regenerations.
+var currentsLayer = auxLayer{
+	Name:      "currents",
+	File:      "currents.bin",
+	TileBytes: 2,
+	Summary:   "ocean current vector field",
+	Build: func(ctx context.Context, in *layerInput) ([]byte, map[string]any, error) {
+		field := in.Currents()
+		width := in.Terrain.Width
+		height := in.Terrain.Height
+		data := make([]byte, 2*width*height)
+		for x := 0; x < width; x++ {
+			for y := 0; y < height; y++ {
+				v := field[y*width+x]
+				i := 2 * (y*width + x)
+				data[i] = byte(int8(math.Round(127 * v[0])))
+				data[i+1] = byte(int8(math.Round(127 * v[1])))
+			}
+		}
+		return data, map[string]any{"width": width, "height": height}, nil
+	},
+}
+
+var currentsPreviewLayer = auxLayer{
+	Name:      "currents_preview",
+	File:      "currents_preview.png",
+	TileBytes: 0.5,
+	Summary:   "rendering of the ocean currents for review",
+	Build: func(ctx context.Context, in *layerInput) ([]byte, map[string]any, error) {
+		img := renderCurrents(in.Terrain, in.Currents())
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, nil, fmt.Errorf("failed to encode preview: %w", err)
+		}
+		return buf.Bytes(), map[string]any{"width": img.Bounds().Dx(), "height": img.Bounds().Dy()}, nil
+	},
+}
+
+// buildCurrentField computes the current vector of every tile, indexed
+// y*width+x, with speeds in [0, 1]; tiles other than ocean water are zero.
+//
+// The base flow is the curl of a fractal noise potential, which makes it
+// smooth and free of sources and sinks. Near land, the component flowing
+// towards the coast is removed, fading out over currentCoastFalloff tiles,
+// so currents deflect along coastlines. The direction away from land is
+// the gradient of the water magnitude, the distance to land computed by
+// processDistToLand. The noise is seeded with the map name. If wrapX is
+// true, the noise is periodic in x and differences are taken across the
+// west/east seam, so that the field is continuous there.
+func buildCurrentField(terrain *terrainGrid, name string, wrapX bool) [][2]float64 {
+	width := terrain.Width
+	height := terrain.Height
+	seed := NoiseSeed("currents:" + name)
+
+	potential := make([]float32, width*height)
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			nx, ny := float64(x)/currentNoiseScale, float64(y)/currentNoiseScale
+			if wrapX {
+				potential[y*width+x] = float32(PeriodicNoise(nx, ny, float64(width)/currentNoiseScale, seed, 2))
+			} else {
+				potential[y*width+x] = float32(FractalNoise(nx, ny, seed, 2))
+			}
+		}
+	}
+	clampX := func(x int) int {
+		if wrapX {
+			return (x + width) % width
+		}
+		return min(max(x, 0), width-1)
+	}
+	at := func(x, y int) float64 {
+		x = clampX(x)
+		y = min(max(y, 0), height-1)
+		return float64(potential[y*width+x])
+	}
+	distance := func(x, y int) float64 {
+		x = clampX(x)
+		y = min(max(y, 0), height-1)
+		if terrain.at(x, y).Type != Water {
+			return 0
+		}
+		return terrain.at(x, y).Magnitude
+	}
+
+	field := make([][2]float64, width*height)
+	maxSpeed := 0.0
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			if terrain.at(x, y).Type != Water || !terrain.at(x, y).Ocean {
+				continue
+			}
+			// curl of the potential: (dψ/dy, -dψ/dx)
+			vx := (at(x, y+1) - at(x, y-1)) / 2 * currentNoiseScale
+			vy := -(at(x+1, y) - at(x-1, y)) / 2 * currentNoiseScale
+
+			nx := (distance(x+1, y) - distance(x-1, y)) / 2
+			ny := (distance(x, y+1) - distance(x, y-1)) / 2
+			if norm := math.Hypot(nx, ny); norm > 0 {
+				nx, ny = nx/norm, ny/norm
+				if towardsLand := vx*nx + vy*ny; towardsLand < 0 {
+					w := math.Exp(-terrain.at(x, y).Magnitude / currentCoastFalloff)
+					vx -= w * towardsLand * nx
+					vy -= w * towardsLand * ny
+				}
+			}
+			field[y*width+x] = [2]float64{vx, vy}
+			maxSpeed = math.Max(maxSpeed, math.Hypot(vx, vy))
+		}
+	}
+	if maxSpeed > 0 {
+		for i := range field {
+			field[i][0] /= maxSpeed
+			field[i][1] /= maxSpeed
+		}
+	}
+	return field
+}
+
+// renderCurrents draws the field at 1/currentPreviewScale size: current
+// direction as hue and speed as brightness, over gray land and dark blue
+// lakes.
+func renderCurrents(terrain *terrainGrid, field [][2]float64) *image.RGBA {
+	width := terrain.Width
+	height := terrain.Height
+	img := image.NewRGBA(image.Rect(0, 0, width/currentPreviewScale, height/currentPreviewScale))
+	for px := 0; px < img.Bounds().Dx(); px++ {
+		for py := 0; py < img.Bounds().Dy(); py++ {
+			x, y := px*currentPreviewScale, py*currentPreviewScale
+			tile := *terrain.at(x, y)
+			switch {
+			case tile.Type == Land:
+				img.Set(px, py, color.RGBA{120, 120, 110, 255})
+			case tile.Type == Impassable:
+				img.Set(px, py, color.RGBA{0, 0, 0, 255})
+			case !tile.Ocean:
+				img.Set(px, py, color.RGBA{60, 60, 80, 255})
+			default:
+				v := field[y*width+x]
+				hue := math.Atan2(v[1], v[0])/(2*math.Pi) + 0.5
+				img.Set(px, py, hsvColor(hue, 0.8, 0.2+0.8*math.Min(1, math.Hypot(v[0], v[1]))))
+			}
+		}
+	}
+	return img
+}
+
+// hsvColor converts hue, saturation and value in [0, 1] to an opaque color.
+func hsvColor(h, s, v float64) color.RGBA {
+	i := math.Floor(h * 6)
+	f := h*6 - i
+	p, q, t := v*(1-s), v*(1-f*s), v*(1-(1-f)*s)
+	var r, g, b float64
+	switch int(i) % 6 {
+	case 0:
+		r, g, b = v, t, p
+	case 1:
+		r, g, b = q, v, p
+	case 2:
+		r, g, b = p, v, t
+	case 3:
+		r, g, b = p, q, v
+	case 4:
+		r, g, b = t, p, v
+	default:
+		r, g, b = v, p, q
+	}
+	return color.RGBA{uint8(255 * r), uint8(255 * g), uint8(255 * b), 255}
+}
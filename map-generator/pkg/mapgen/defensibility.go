@@ -0,0 +1,210 @@
+package mapgen
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+)
+
+const (
+	// defensibilityRadius is the half-size, in tiles, of the window over
+	// which the narrowness of the land around a tile is measured.
+	defensibilityRadius = 12
+	// defensibilityCoastFalloff is the distance inland, in tiles, over which
+	// exposure to landings from the sea decays to 1/e.
+	defensibilityCoastFalloff = 6.0
+	// defensibilityHigh is the score from which a tile counts as highly
+	// defensible in the layer's summary.
+	defensibilityHigh = 0.6
+	// defensibilityPreviewScale is the downscale factor of
+	// defensibility_preview.png.
+	defensibilityPreviewScale = 2
+)
+
+// defensibilityLayer rates how easy each land tile is to hold, for balance
+// discussions about maps that favour turtling and for placing defense posts.
+var defensibilityLayer = auxLayer{
+	Name:      "defensibility",
+	File:      "defensibility.bin",
+	TileBytes: 1,
+	Summary:   "per-tile defensibility from chokepoints, mountain cover and coast exposure",
+	Build:     buildDefensibility,
+}
+
+// defensibilityPreviewLayer renders defensibility as a heatmap.
+var defensibilityPreviewLayer = auxLayer{
+	Name:      "defensibility_preview",
+	File:      "defensibility_preview.png",
+	TileBytes: 1.5,
+	Summary:   "heatmap of the defensibility layer for review",
+	Build: func(ctx context.Context, in *layerInput) ([]byte, map[string]any, error) {
+		img := renderDefensibility(in.Terrain, in.Defensibility().Scores)
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, nil, fmt.Errorf("failed to encode preview: %w", err)
+		}
+		return buf.Bytes(), map[string]any{"width": img.Bounds().Dx(), "height": img.Bounds().Dy()}, nil
+	},
+}
+
+// defensibilityScores are the per-tile defensibility scores of a map and
+// their components, each in [0, 1] and indexed y*width+x; tiles other than
+// land are 0.
+type defensibilityScores struct {
+	Scores     []float32
+	Narrowness []float32 // 1 minus the share of land around the tile
+	Mountain   []float32 // the tile's magnitude over 30
+	Exposure   []float32 // e^(-d/defensibilityCoastFalloff), d = tiles from the coast
+}
+
+// computeDefensibility scores every land tile as
+//
+//	0.4·narrowness + 0.35·mountain + 0.25·(1 - exposure)
+//
+// Narrowness is high in isthmuses, peninsulas and passes between impassable
+// terrain, where attackers must funnel through few tiles; it is measured as
+// the share of tiles that are not land in the (2·defensibilityRadius+1)²
+// window around the tile, the map edge counting as a barrier. Mountains slow
+// attackers down, and coastal tiles can be reached by boat.
+func computeDefensibility(terrain *terrainGrid, coastDist []int32, wrapX bool) *defensibilityScores {
+	width := terrain.Width
+	height := terrain.Height
+
+	// Summed-area table of land tiles, sums[x*(height+1)+y] covering the
+	// tiles left of x and above y.
+	sums := make([]int32, (width+1)*(height+1))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			land := int32(0)
+			if terrain.at(x, y).Type == Land {
+				land = 1
+			}
+			sums[(x+1)*(height+1)+y+1] = land + sums[x*(height+1)+y+1] + sums[(x+1)*(height+1)+y] - sums[x*(height+1)+y]
+		}
+	}
+	// landIn counts the land tiles in columns [x0, x1) and rows [y0, y1),
+	// both clipped to the map.
+	landIn := func(x0, x1, y0, y1 int) int32 {
+		x0, x1 = max(x0, 0), min(x1, width)
+		y0, y1 = max(y0, 0), min(y1, height)
+		if x0 >= x1 || y0 >= y1 {
+			return 0
+		}
+		return sums[x1*(height+1)+y1] - sums[x0*(height+1)+y1] - sums[x1*(height+1)+y0] + sums[x0*(height+1)+y0]
+	}
+	window := float64((2*defensibilityRadius + 1) * (2*defensibilityRadius + 1))
+
+	d := &defensibilityScores{
+		Scores:     make([]float32, width*height),
+		Narrowness: make([]float32, width*height),
+		Mountain:   make([]float32, width*height),
+		Exposure:   make([]float32, width*height),
+	}
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			tile := *terrain.at(x, y)
+			if tile.Type != Land {
+				continue
+			}
+			i := y*width + x
+			x0, x1 := x-defensibilityRadius, x+defensibilityRadius+1
+			y0, y1 := y-defensibilityRadius, y+defensibilityRadius+1
+			land := landIn(x0, x1, y0, y1)
+			if wrapX {
+				// Count the part of the window across the seam.
+				land += landIn(x0+width, x1+width, y0, y1) + landIn(x0-width, x1-width, y0, y1)
+			}
+			narrowness := 1 - float64(land)/window
+			mountain := math.Min(tile.Magnitude, 30) / 30
+			exposure := 0.0
+			if dist := coastDist[i]; dist >= 0 {
+				exposure = math.Exp(-float64(dist) / defensibilityCoastFalloff)
+			}
+			d.Narrowness[i] = float32(narrowness)
+			d.Mountain[i] = float32(mountain)
+			d.Exposure[i] = float32(exposure)
+			d.Scores[i] = float32(0.4*narrowness + 0.35*mountain + 0.25*(1-exposure))
+		}
+	}
+	return d
+}
+
+// buildDefensibility writes one byte per tile, row-major (index y*width+x)
+// like map.bin, from 0 to 255 for scores from 0 to 1, see
+// computeDefensibility. Water and impassable tiles are 0. The manifest entry
+// summarises the scores over the land tiles.
+func buildDefensibility(ctx context.Context, in *layerInput) ([]byte, map[string]any, error) {
+	terrain := in.Terrain
+	width := terrain.Width
+	height := terrain.Height
+	d := in.Defensibility()
+
+	data := make([]byte, width*height)
+	var total, narrowness, mountain, exposure float64
+	landTiles, high := 0, 0
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			if terrain.at(x, y).Type != Land {
+				continue
+			}
+			i := y*width + x
+			score := float64(d.Scores[i])
+			data[y*width+x] = byte(math.Round(255 * score))
+			total += score
+			narrowness += float64(d.Narrowness[i])
+			mountain += float64(d.Mountain[i])
+			exposure += float64(d.Exposure[i])
+			if score >= defensibilityHigh {
+				high++
+			}
+			landTiles++
+		}
+	}
+
+	round := func(v float64) float64 {
+		if landTiles == 0 {
+			return 0
+		}
+		return math.Round(v/float64(landTiles)*1000) / 1000
+	}
+	LoggerFromContext(ctx).Debug(fmt.Sprintf("Defensibility: mean %.2f over %d land tiles, %d highly defensible", round(total), landTiles, high))
+	return data, map[string]any{
+		"width":      width,
+		"height":     height,
+		"mean":       round(total),
+		"high_share": round(float64(high)),
+		"components": map[string]any{
+			"narrowness":     round(narrowness),
+			"mountain":       round(mountain),
+			"coast_exposure": round(exposure),
+		},
+	}, nil
+}
+
+// renderDefensibility draws the scores at half size, from red for exposed
+// land through yellow to green for the most defensible, with water in dark
+// blue and impassable tiles in black.
+func renderDefensibility(terrain *terrainGrid, scores []float32) *image.RGBA {
+	width := terrain.Width
+	height := terrain.Height
+	img := image.NewRGBA(image.Rect(0, 0, width/defensibilityPreviewScale, height/defensibilityPreviewScale))
+	for px := 0; px < img.Bounds().Dx(); px++ {
+		for py := 0; py < img.Bounds().Dy(); py++ {
+			x, y := px*defensibilityPreviewScale, py*defensibilityPreviewScale
+			switch terrain.at(x, y).Type {
+			case Land:
+				s := math.Min(1, float64(scores[y*width+x]))
+				img.Set(px, py, hsvColor(s/3, 0.85, 0.9))
+			case Impassable:
+				img.Set(px, py, color.RGBA{0, 0, 0, 255})
+			default:
+				img.Set(px, py, color.RGBA{30, 40, 70, 255})
+			}
+		}
+	}
+	return img
+}
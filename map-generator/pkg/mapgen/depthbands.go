@@ -0,0 +1,95 @@
+package mapgen
+
+import (
+	"context"
+	"fmt"
+)
+
+// Depth bands of water tiles in depth_bands.bin. Non-water tiles are
+// depthNone.
+const (
+	depthNone byte = iota
+	depthShallow
+	depthOpen
+	depthDeep
+)
+
+const (
+	// shallowMaxDistance and openMaxDistance are the largest distances from
+	// land, in tiles, of shallow and open water when the band is derived from
+	// the distance field.
+	shallowMaxDistance = 6
+	openMaxDistance    = 40
+	// shallowMinGray and openMinGray are the lowest bathymetry.png gray
+	// levels of shallow and open water; darker is deeper.
+	shallowMinGray = 170
+	openMinGray    = 85
+)
+
+// depthBandsLayer classifies water into depth bands, for banded water
+// shading and for units restricted to shallow water.
+var depthBandsLayer = auxLayer{
+	Name:      "depth_bands",
+	File:      "depth_bands.bin",
+	TileBytes: 1,
+	Summary:   "shallow, open and deep water bands",
+	Build:     buildDepthBands,
+}
+
+// buildDepthBands writes one byte per tile, row-major like map.bin: 1 for
+// the shallow shelf, 2 for open water, 3 for deep water and 0 for land and
+// impassable tiles.
+//
+// Bands come from the distance to land computed by processDistToLand, up to
+// shallowMaxDistance tiles being shallow and beyond openMaxDistance deep.
+// Maps can instead paint a bathymetry.png, a grayscale image aligned with
+// image.png where brighter is shallower; its gray level then sets the band
+// of every water tile.
+func buildDepthBands(ctx context.Context, in *layerInput) ([]byte, map[string]any, error) {
+	terrain := in.Terrain
+	width := terrain.Width
+	height := terrain.Height
+	bathymetry, err := auxGrayImage(in.Inputs, "bathymetry.png", width, height)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data := make([]byte, width*height)
+	var counts [4]int
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			tile := *terrain.at(x, y)
+			if tile.Type != Water {
+				continue
+			}
+			band := depthDeep
+			if bathymetry != nil {
+				switch gray := grayAt(bathymetry, x, y); {
+				case gray >= shallowMinGray:
+					band = depthShallow
+				case gray >= openMinGray:
+					band = depthOpen
+				}
+			} else {
+				switch {
+				case tile.Magnitude <= shallowMaxDistance:
+					band = depthShallow
+				case tile.Magnitude <= openMaxDistance:
+					band = depthOpen
+				}
+			}
+			data[y*width+x] = band
+			counts[band]++
+		}
+	}
+
+	LoggerFromContext(ctx).Debug(fmt.Sprintf("Depth bands: %d shallow, %d open, %d deep tiles (bathymetry image: %t)", counts[depthShallow], counts[depthOpen], counts[depthDeep], bathymetry != nil))
+	return data, map[string]any{
+		"width":             width,
+		"height":            height,
+		"shallow_tiles":     counts[depthShallow],
+		"open_tiles":        counts[depthOpen],
+		"deep_tiles":        counts[depthDeep],
+		"bathymetry_source": bathymetry != nil,
+	}, nil
+}
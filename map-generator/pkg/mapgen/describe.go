@@ -0,0 +1,69 @@
+package mapgen
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapformat"
+)
+
+// TileClasses are the classes packed tiles are counted and drawn by, such
+// as in the inspect command's rendering, with the character drawing each,
+// in the order of the legend.
+var TileClasses = []struct {
+	Name string
+	Char byte
+}{
+	{"ocean", '~'},
+	{"lake", '-'},
+	{"plains", '.'},
+	{"highland", '+'},
+	{"mountain", '^'},
+	{"void", ' '},
+	{"ice", '*'},
+	{"lava", '!'},
+}
+
+// TileClass returns the index in TileClasses of a tile's class. Land
+// is classified by magnitude as the client does.
+func TileClass(t mapformat.Tile) int {
+	switch {
+	case t.IsImpassable():
+		return 5 + int(t.ImpassableKind())
+	case t.IsWater() && t.IsOcean():
+		return 0
+	case t.IsWater():
+		return 1
+	case t.Magnitude() < 10:
+		return 2
+	case t.Magnitude() < 20:
+		return 3
+	}
+	return 4
+}
+
+// DescribeTile describes a packed tile.
+func DescribeTile(t mapformat.Tile) string {
+	var parts []string
+	switch {
+	case t.IsImpassable() && int(t.ImpassableKind()) < len(ImpassableKindNames):
+		parts = append(parts, "impassable "+ImpassableKindNames[t.ImpassableKind()])
+	case t.IsImpassable():
+		parts = append(parts, fmt.Sprintf("impassable, unknown kind %d", t.ImpassableKind()))
+	case t.IsLand():
+		parts = append(parts, fmt.Sprintf("land, magnitude %d (%s)", t.Magnitude(), TileClasses[TileClass(t)].Name))
+	default:
+		water := "lake"
+		if t.IsOcean() {
+			water = "ocean"
+		}
+		parts = append(parts, fmt.Sprintf("%s water, magnitude %d", water, t.Magnitude()))
+		if t.IsRiver() {
+			parts = append(parts, "river")
+		}
+	}
+	if t.IsShoreline() {
+		parts = append(parts, "shoreline")
+	}
+	return fmt.Sprintf("%s [0b%08b]", strings.Join(parts, ", "), uint8(t))
+}
@@ -0,0 +1,42 @@
+package mapgen
+
+import "math"
+
+const (
+	// maxPlainsDither bounds generator.plains_dither, keeping the variation
+	// subtle.
+	maxPlainsDither = 3
+	// plainsDitherScale is the size, in tiles, of the dithering noise's
+	// features.
+	plainsDitherScale = 24
+	// plainsMaxMagnitude is the highest magnitude of plains.
+	plainsMaxMagnitude = 9
+)
+
+// ditherPlains raises the magnitude of plains land tiles by up to amplitude
+// following smooth noise seeded with the map name, so that large plains
+// render with subtle variation instead of a flat colour. Tiles stay within
+// the plains magnitude range, and the offsets are whole steps so that they
+// survive packing. It returns the number of tiles changed.
+func ditherPlains(terrain *terrainGrid, name string, amplitude int) int {
+	if amplitude == 0 {
+		return 0
+	}
+	seed := NoiseSeed("plains:" + name)
+	changed := 0
+	for y := 0; y < terrain.Height; y++ {
+		for x := 0; x < terrain.Width; x++ {
+			t := terrain.at(x, y)
+			if t.Type != Land || t.Magnitude > plainsMaxMagnitude {
+				continue
+			}
+			n := FractalNoise(float64(x)/plainsDitherScale, float64(y)/plainsDitherScale, seed, 3)
+			offset := math.Round(float64(amplitude) * (n + 1) / 2)
+			if m := math.Min(t.Magnitude+offset, plainsMaxMagnitude); m != t.Magnitude {
+				t.Magnitude = m
+				changed++
+			}
+		}
+	}
+	return changed
+}
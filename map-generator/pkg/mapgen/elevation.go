@@ -0,0 +1,60 @@
+package mapgen
+
+import (
+	"fmt"
+	"math"
+)
+
+// maxLandMagnitude is the magnitude of the highest mountains.
+const maxLandMagnitude = 30
+
+// elevationConfig is the "generator.elevation" section of info.json: how the
+// blue value of a land pixel of image.png maps to its magnitude.
+type elevationConfig struct {
+	// MinBlue and MaxBlue are the blue values of magnitude 0 and of
+	// maxLandMagnitude; land outside them is clamped to them.
+	MinBlue int `json:"min_blue"`
+	MaxBlue int `json:"max_blue"`
+	// Gamma bends the curve between them: above 1, more of the blue range
+	// goes to low land, below 1 to mountains.
+	Gamma float64 `json:"gamma"`
+}
+
+// defaultElevationConfig returns the settings used when info.json has no
+// "generator.elevation" section: the historical (blue - 140) / 2.
+func defaultElevationConfig() elevationConfig {
+	return elevationConfig{MinBlue: 140, MaxBlue: 200, Gamma: 1}
+}
+
+func (c *elevationConfig) validate() error {
+	if c.MinBlue < 0 || c.MaxBlue > 255 || c.MinBlue >= c.MaxBlue {
+		return fmt.Errorf("\"min_blue\" (%d) must be less than \"max_blue\" (%d), both between 0 and 255", c.MinBlue, c.MaxBlue)
+	}
+	if !(c.Gamma > 0) || math.IsInf(c.Gamma, 0) {
+		return fmt.Errorf("\"gamma\" (%g) must be positive", c.Gamma)
+	}
+	return nil
+}
+
+// magnitude returns the land magnitude of a blue value.
+func (c elevationConfig) magnitude(blue uint8) float64 {
+	v := math.Min(float64(c.MaxBlue), math.Max(float64(c.MinBlue), float64(blue))) - float64(c.MinBlue)
+	span := float64(c.MaxBlue - c.MinBlue)
+	if c.Gamma == 1 {
+		// Exact for the default curve, whose magnitudes are multiples of 0.5
+		return v * maxLandMagnitude / span
+	}
+	return maxLandMagnitude * math.Pow(v/span, c.Gamma)
+}
+
+// formula describes the curve for the tile explanations.
+func (c elevationConfig) formula() string {
+	if c == defaultElevationConfig() {
+		return "(blue - 140) / 2 with blue clamped to 140-200"
+	}
+	curve := fmt.Sprintf("%d × (blue - %d) / %d", maxLandMagnitude, c.MinBlue, c.MaxBlue-c.MinBlue)
+	if c.Gamma != 1 {
+		curve = fmt.Sprintf("%d × ((blue - %d) / %d)^%g", maxLandMagnitude, c.MinBlue, c.MaxBlue-c.MinBlue, c.Gamma)
+	}
+	return fmt.Sprintf("%s with blue clamped to %d-%d", curve, c.MinBlue, c.MaxBlue)
+}
@@ -0,0 +1,145 @@
+package mapgen
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// EncodingRaw is the default terrain encoding: the packed bytes as written
+// to the .bin files.
+const EncodingRaw = "raw"
+
+// terrainEncoding is a strategy for compressing packed terrain.
+type terrainEncoding struct {
+	Name   string
+	Encode func(data []byte) ([]byte, error)
+	Decode func(data []byte) ([]byte, error)
+}
+
+var rleEncoding = terrainEncoding{Name: "rle", Encode: encodeRLE, Decode: decodeRLE}
+
+// TerrainEncodings lists the available encodings.
+var TerrainEncodings = []terrainEncoding{
+	{Name: EncodingRaw, Encode: identity, Decode: identity},
+	rleEncoding,
+	{Name: "gzip", Encode: EncodeGzip, Decode: DecodeGzip},
+	ZstdEncoding("zstd-fastest", zstd.SpeedFastest),
+	ZstdEncoding("zstd-default", zstd.SpeedDefault),
+	ZstdEncoding("zstd-better", zstd.SpeedBetterCompression),
+	ZstdEncoding("zstd-best", zstd.SpeedBestCompression),
+	combinedEncoding("rle+zstd", rleEncoding, ZstdEncoding("zstd-best", zstd.SpeedBestCompression)),
+}
+
+// terrainEncodingNames returns the names of the available encodings.
+func terrainEncodingNames() []string {
+	names := make([]string, len(TerrainEncodings))
+	for i, e := range TerrainEncodings {
+		names[i] = e.Name
+	}
+	return names
+}
+
+func identity(data []byte) ([]byte, error) { return data, nil }
+
+// encodeRLE run-length encodes data as pairs of a uvarint run length and
+// the repeated byte. Packed terrain has long runs of open water and plains.
+func encodeRLE(data []byte) ([]byte, error) {
+	out := make([]byte, 0, len(data)/8)
+	for i := 0; i < len(data); {
+		run := 1
+		for i+run < len(data) && data[i+run] == data[i] {
+			run++
+		}
+		out = binary.AppendUvarint(out, uint64(run))
+		out = append(out, data[i])
+		i += run
+	}
+	return out, nil
+}
+
+// decodeRLE reverses encodeRLE.
+func decodeRLE(data []byte) ([]byte, error) {
+	var out []byte
+	for len(data) > 0 {
+		run, n := binary.Uvarint(data)
+		if n <= 0 || n >= len(data) {
+			return nil, errors.New("truncated RLE stream")
+		}
+		out = append(out, bytes.Repeat(data[n:n+1], int(run))...)
+		data = data[n+1:]
+	}
+	return out, nil
+}
+
+func EncodeGzip(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func DecodeGzip(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// ZstdEncoding returns a zstd encoding at the given level.
+func ZstdEncoding(name string, level zstd.EncoderLevel) terrainEncoding {
+	return terrainEncoding{
+		Name: name,
+		Encode: func(data []byte) ([]byte, error) {
+			enc, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(level), zstd.WithEncoderConcurrency(1))
+			if err != nil {
+				return nil, err
+			}
+			defer enc.Close()
+			return enc.EncodeAll(data, nil), nil
+		},
+		Decode: func(data []byte) ([]byte, error) {
+			dec, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+			if err != nil {
+				return nil, err
+			}
+			defer dec.Close()
+			return dec.DecodeAll(data, nil)
+		},
+	}
+}
+
+// combinedEncoding applies first, then second.
+func combinedEncoding(name string, first, second terrainEncoding) terrainEncoding {
+	return terrainEncoding{
+		Name: name,
+		Encode: func(data []byte) ([]byte, error) {
+			out, err := first.Encode(data)
+			if err != nil {
+				return nil, err
+			}
+			return second.Encode(out)
+		},
+		Decode: func(data []byte) ([]byte, error) {
+			out, err := second.Decode(data)
+			if err != nil {
+				return nil, err
+			}
+			return first.Decode(out)
+		},
+	}
+}
@@ -0,0 +1,218 @@
+package mapgen
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"log/slog"
+	"math"
+	"strings"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapformat"
+)
+
+// tileExplainer traces one tile through the passes of GenerateMap, to answer
+// authors asking why their island disappeared. Passes log through the
+// explainer of their context, if any; a nil explainer logs nothing, so the
+// 4x and 16x passes run with none.
+type tileExplainer struct {
+	X, Y   int
+	logger *slog.Logger
+	last   Terrain // the tile as of the previous pass
+	off    bool    // the tile is outside the map
+}
+
+type explainKey struct{}
+
+// explainerFromContext returns the tile explainer of ctx, or nil.
+func explainerFromContext(ctx context.Context) *tileExplainer {
+	e, _ := ctx.Value(explainKey{}).(*tileExplainer)
+	return e
+}
+
+// ContextWithExplainer returns a context whose passes explain e's tile; a
+// nil e stops explaining.
+func ContextWithExplainer(ctx context.Context, e *tileExplainer) context.Context {
+	return context.WithValue(ctx, explainKey{}, e)
+}
+
+// NewTileExplainer returns an explainer of the tile at x,y, logging to
+// logger.
+func NewTileExplainer(x, y int, logger *slog.Logger) *tileExplainer {
+	return &tileExplainer{X: x, Y: y, logger: logger}
+}
+
+// logf logs a step of the trace.
+func (e *tileExplainer) logf(format string, args ...any) {
+	if e == nil || e.off {
+		return
+	}
+	e.logger.Info(fmt.Sprintf("[explain %d,%d] ", e.X, e.Y) + fmt.Sprintf(format, args...))
+}
+
+// describeTerrain describes a tile during generation.
+func describeTerrain(t Terrain) string {
+	var s string
+	switch t.Type {
+	case Land:
+		s = fmt.Sprintf("land, magnitude %g", t.Magnitude)
+	case Water:
+		s = "water"
+		if t.Ocean {
+			s = "ocean water"
+		}
+		s += fmt.Sprintf(", magnitude %g", t.Magnitude)
+	default:
+		s = "impassable"
+		if int(t.Kind) < len(ImpassableKindNames) {
+			s += " " + ImpassableKindNames[t.Kind]
+		}
+	}
+	if t.Shoreline {
+		s += ", shoreline"
+	}
+	if t.River {
+		s += ", river"
+	}
+	if t.Key != keyNone {
+		s += ", " + KeyFeatureNames[t.Key] + " key"
+	}
+	return s
+}
+
+// classify logs how the source pixel was classified, following the rules of
+// the pixel loop of GenerateMap, or that the tile is off the map.
+func (e *tileExplainer) classify(img image.Image, width, height int, impassableColors map[[3]uint8]ImpassableKind, keyColors map[[3]uint8]keyFeature, palette *colorPalette, heights *heightmap, heightmapSettings heightmapConfig, waterBlue int, elevation elevationConfig, terrain *terrainGrid) {
+	if e == nil {
+		return
+	}
+	b := img.Bounds()
+	if e.X < 0 || e.Y < 0 || e.X >= width || e.Y >= height {
+		if e.X < b.Dx() && e.Y < b.Dy() && e.X >= 0 && e.Y >= 0 {
+			e.logf("outside the map: the %dx%d image is cropped to %dx%d, a multiple of 4", b.Dx(), b.Dy(), width, height)
+		} else {
+			e.logf("outside the %dx%d map", width, height)
+		}
+		e.off = true
+		return
+	}
+	r, g, bl, a := img.At(b.Min.X+e.X, b.Min.Y+e.Y).RGBA()
+	red, green, blue, alpha := uint8(r>>8), uint8(g>>8), uint8(bl>>8), uint8(a>>8)
+	e.logf("source pixel rgba(%d, %d, %d, %d)", red, green, blue, alpha)
+	var rule string
+	if _, ok := impassableColors[[3]uint8{red, green, blue}]; ok && alpha >= 20 {
+		rule = "its colour is listed in \"generator.impassable_colors\""
+	} else if feature, ok := keyColors[[3]uint8{red, green, blue}]; ok && alpha >= 20 {
+		rule = "its colour is listed in \"generator.key_colors\""
+		if feature == keyInherit {
+			rule += ", as inherit: coast resolution gives it the terrain of its neighbours"
+		}
+	} else if heights != nil && (alpha < 20 || red != 0 || green != 0 || blue != 0) {
+		v := heights.Data[e.Y*heights.Width+e.X]
+		if math.IsNaN(float64(v)) {
+			rule = "the heightmap has no data for it, which is water"
+		} else {
+			rule = fmt.Sprintf("the heightmap gives it an elevation of %g: water at and under the sea level of %g, otherwise land of magnitude 30 × elevation above sea level / %g", v, heightmapSettings.SeaLevel, heightmapSettings.MaxElevation)
+		}
+	} else if palette != nil {
+		c := [4]uint8{red, green, blue, alpha}
+		switch _, match := palette.terrain(c); match {
+		case paletteExact:
+			rule = fmt.Sprintf("its colour is listed in %s", PaletteFile)
+		case paletteTransparent:
+			rule = fmt.Sprintf("alpha below 20 is water unless listed in %s", PaletteFile)
+		case paletteBlack:
+			rule = fmt.Sprintf("pure black is impassable unless listed in %s", PaletteFile)
+		default:
+			rule = fmt.Sprintf("its colour is not listed in %s, the nearest listed colour is %s", PaletteFile, formatPaletteColor(palette.nearestColor(c)))
+		}
+	} else if alpha < 20 {
+		rule = "alpha below 20 is water"
+	} else if int(blue) == waterBlue {
+		rule = fmt.Sprintf("blue %d is the water key", waterBlue)
+	} else if red == 0 && green == 0 && blue == 0 {
+		rule = "pure black is impassable"
+	} else {
+		rule = fmt.Sprintf("any other colour is land, its magnitude %s: blue %d", elevation.formula(), blue)
+	}
+	e.last = *terrain.at(e.X, e.Y)
+	e.logf("classified as %s: %s", describeTerrain(e.last), rule)
+}
+
+// after logs how pass changed the tile, if it did.
+func (e *tileExplainer) after(pass string, terrain *terrainGrid) {
+	if e == nil || e.off {
+		return
+	}
+	t := *terrain.at(e.X, e.Y)
+	if t != e.last {
+		e.logf("%s: %s -> %s", pass, describeTerrain(e.last), describeTerrain(t))
+		e.last = t
+	}
+}
+
+// bodyOf returns the index of the body holding the tile, or -1.
+func (e *tileExplainer) bodyOf(bodies []areaSpan, scratch *floodScratch) int {
+	for i, body := range bodies {
+		for _, c := range scratch.coords(body) {
+			if c.X == e.X && c.Y == e.Y {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// landBody logs the island size decision of removeSmallIslands for the
+// tile, if it is land.
+func (e *tileExplainer) landBody(bodies []areaSpan, scratch *floodScratch, minSize int) {
+	if e == nil || e.off {
+		return
+	}
+	i := e.bodyOf(bodies, scratch)
+	if i < 0 {
+		return
+	}
+	if size := bodies[i].size; size < minSize {
+		e.logf("part of an island of %d tile(s), below the minimum of %d: removed, becomes water", size, minSize)
+	} else {
+		e.logf("part of a landmass of %d tile(s), at least the minimum of %d: kept", size, minSize)
+	}
+}
+
+// waterBody logs the ocean and lake decisions of processWater for the tile,
+// if it is water. bodies are sorted largest first; ocean marks the ocean
+// bodies and keyed those with ocean or lake key tiles.
+func (e *tileExplainer) waterBody(bodies []areaSpan, scratch *floodScratch, removeSmall bool, minLakeSize int, ocean, keyed []bool) {
+	if e == nil || e.off {
+		return
+	}
+	i := e.bodyOf(bodies, scratch)
+	switch {
+	case i < 0:
+	case i == 0 && ocean[i]:
+		e.logf("part of the largest water body, %d tile(s): ocean", bodies[0].size)
+	case ocean[i]:
+		e.logf("part of a water body of %d tile(s) with an ocean key colour: ocean", bodies[i].size)
+	case keyed[i]:
+		e.logf("part of a water body of %d tile(s) with a lake key colour: kept as a lake", bodies[i].size)
+	case removeSmall && bodies[i].size < minLakeSize:
+		e.logf("part of a lake of %d tile(s), below the minimum of %d: filled, becomes land", bodies[i].size, minLakeSize)
+	default:
+		e.logf("part of a lake of %d tile(s), smaller than the ocean's %d: kept as a lake", bodies[i].size, bodies[0].size)
+	}
+}
+
+// packed logs the tile as written to each scale, mini map tiles covering
+// 2×2 and 4×4 full-scale tiles, packed in the given tile format.
+func (e *tileExplainer) packed(format mapformat.TileFormat, scales ...MapInfo) {
+	if e == nil || e.off {
+		return
+	}
+	var parts []string
+	for i, s := range scales {
+		x, y := e.X*s.Width/scales[0].Width, e.Y*s.Height/scales[0].Height
+		parts = append(parts, fmt.Sprintf("%s %d,%d: %s", mapformat.Scales[i].File(), x, y, DescribeTile(format.Tile(s.Data[y*s.Width+x]))))
+	}
+	e.logf("written as %s", strings.Join(parts, "; "))
+}
@@ -0,0 +1,97 @@
+package mapgen
+
+import (
+	"context"
+	"fmt"
+	"math"
+)
+
+// coastFertilityFalloff is the distance inland, in tiles, over which the
+// coastal fertility bonus decays to 1/e of its value.
+const coastFertilityFalloff = 24
+
+// biomeFertility is the fertility factor of each Biome, indexed by biome.
+var biomeFertility = []float64{
+	BiomeTemperate: 1,
+	BiomeForest:    0.8,
+	BiomeSwamp:     0.5,
+	BiomeDesert:    0.3,
+	BiomeTundra:    0.4,
+}
+
+// fertilityLayer rates how productive each land tile is, for income
+// modifiers that make geography matter economically.
+var fertilityLayer = auxLayer{
+	Name:      "fertility",
+	File:      "fertility.bin",
+	TileBytes: 1,
+	Summary:   "per-tile fertility for economic modifiers",
+	Build:     buildFertility,
+}
+
+// buildFertility writes one byte per tile, row-major (index y*width+x) like
+// map.bin, from 0 (barren) to 255 (most fertile). Water and impassable tiles
+// are 0. For land tiles fertility is the product of:
+//
+//	elevation: 1 on plains, falling linearly to 0.3 at magnitude 30
+//	coast:     0.5 + 0.5·e^(-d/coastFertilityFalloff), d = tiles from the coast
+//	biome:     biomeFertility of the tile's Biome, see classifyBiome
+//
+// fertility.png is an optional grayscale image in the map folder, aligned
+// with image.png, in which authors paint barren land dark and farmland
+// bright; when the map has one, its gray level / 255 overrides the biome
+// factor. The manifest entry records the biome factors.
+func buildFertility(ctx context.Context, in *layerInput) ([]byte, map[string]any, error) {
+	terrain := in.Terrain
+	width := terrain.Width
+	height := terrain.Height
+
+	override, err := auxGrayImage(in.Inputs, "fertility.png", width, height)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	coastDist := in.CoastDistance()
+	data := make([]byte, width*height)
+	total := 0.0
+	landTiles := 0
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			tile := *terrain.at(x, y)
+			if tile.Type != Land {
+				continue
+			}
+			fertility := 1 - 0.7*math.Min(tile.Magnitude, 30)/30
+			if d := coastDist[y*width+x]; d >= 0 {
+				fertility *= 0.5 + 0.5*math.Exp(-float64(d)/coastFertilityFalloff)
+			} else {
+				fertility *= 0.5
+			}
+			if override != nil {
+				fertility *= float64(grayAt(override, x, y)) / 255
+			} else {
+				fertility *= biomeFertility[tile.Biome]
+			}
+			data[y*width+x] = byte(math.Round(255 * fertility))
+			total += fertility
+			landTiles++
+		}
+	}
+
+	mean := 0.0
+	if landTiles > 0 {
+		mean = total / float64(landTiles)
+	}
+	biomes := make(map[string]float64, len(BiomeNames))
+	for b, name := range BiomeNames {
+		biomes[name] = biomeFertility[b]
+	}
+	LoggerFromContext(ctx).Debug(fmt.Sprintf("Fertility: mean %.2f over %d land tiles (fertility image: %t)", mean, landTiles, override != nil))
+	return data, map[string]any{
+		"width":            width,
+		"height":           height,
+		"mean":             math.Round(mean*1000) / 1000,
+		"biomes":           biomes,
+		"fertility_source": override != nil,
+	}, nil
+}
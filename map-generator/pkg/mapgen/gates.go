@@ -0,0 +1,32 @@
+package mapgen
+
+import "fmt"
+
+// QualityGates is the "generator.quality_gates" section: thresholds on what
+// generation did to a map that fail the map instead of passing unnoticed in
+// the logs. Unset gates are not checked.
+type QualityGates struct {
+	// MaxRemovedIslands and MaxRemovedLakes are the most islands and lakes
+	// the generator may remove for being small, see MapStats.
+	MaxRemovedIslands *int `json:"max_removed_islands,omitempty"`
+	MaxRemovedLakes   *int `json:"max_removed_lakes,omitempty"`
+	// MaxLandChange is how far the land share of the map, in percentage
+	// points of its tiles, may move from that of the previous build.
+	MaxLandChange *float64 `json:"max_land_change,omitempty"`
+	// RequireOcean fails maps without ocean tiles.
+	RequireOcean bool `json:"require_ocean,omitempty"`
+}
+
+// validate checks the section's settings.
+func (g *QualityGates) validate() error {
+	if g.MaxRemovedIslands != nil && *g.MaxRemovedIslands < 0 {
+		return fmt.Errorf("max_removed_islands (%d) must not be negative", *g.MaxRemovedIslands)
+	}
+	if g.MaxRemovedLakes != nil && *g.MaxRemovedLakes < 0 {
+		return fmt.Errorf("max_removed_lakes (%d) must not be negative", *g.MaxRemovedLakes)
+	}
+	if g.MaxLandChange != nil && (*g.MaxLandChange < 0 || *g.MaxLandChange > 100) {
+		return fmt.Errorf("max_land_change (%g) must be between 0 and 100", *g.MaxLandChange)
+	}
+	return nil
+}
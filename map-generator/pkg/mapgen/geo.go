@@ -0,0 +1,227 @@
+package mapgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Map projections supported by GeoReference.
+const (
+	// projectionEquirectangular maps longitude and latitude linearly to x
+	// and y. fetch-elevation scales its width by the cosine of the central
+	// latitude so that shapes are preserved near the centre.
+	projectionEquirectangular = "equirectangular"
+	// projectionMercator is the web mercator projection of map tiles.
+	projectionMercator = "mercator"
+	// projectionMollweide is an equal-area projection of the globe onto an
+	// ellipse, centred on the bounding box's central meridian, for world maps
+	// that don't inflate polar landmasses.
+	projectionMollweide = "mollweide"
+)
+
+var mapProjections = []string{projectionEquirectangular, projectionMercator, projectionMollweide}
+
+// earthRadius is the mean radius of the Earth in metres.
+const earthRadius = 6371008.8
+
+// GeoReference is the optional "geo" section of info.json, which places a
+// real-world map on the globe so that real-world data such as borders and
+// cities can be projected onto its tiles. fetch-elevation prints the section
+// for the images it writes.
+type GeoReference struct {
+	// BBox is the area the image covers, as [min_lon, min_lat, max_lon,
+	// max_lat] in degrees. The image's edges are the bounding box's edges.
+	BBox       [4]float64 `json:"bbox"`
+	Projection string     `json:"projection"`
+}
+
+// ParseGeoReference reads and validates the "geo" section of an info.json
+// buffer. It returns nil if the map has none.
+func ParseGeoReference(info []byte) (*GeoReference, error) {
+	var doc struct {
+		Geo *GeoReference `json:"geo"`
+	}
+	if len(info) == 0 {
+		return nil, nil
+	}
+	if err := json.Unmarshal(info, &doc); err != nil {
+		return nil, fmt.Errorf("invalid \"geo\" section: %w", err)
+	}
+	geo := doc.Geo
+	if geo == nil {
+		return nil, nil
+	}
+	if geo.Projection == "" {
+		geo.Projection = projectionEquirectangular
+	}
+	if err := geo.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid \"geo\" section: %w", err)
+	}
+	return geo, nil
+}
+
+// Validate checks the bounding box and projection.
+func (g *GeoReference) Validate() error {
+	minLon, minLat, maxLon, maxLat := g.BBox[0], g.BBox[1], g.BBox[2], g.BBox[3]
+	if minLon < -180 || maxLon > 180 || minLon >= maxLon {
+		return fmt.Errorf("bbox longitudes must satisfy -180 <= min_lon < max_lon <= 180; areas across the antimeridian are not supported")
+	}
+	if !containsString(mapProjections, g.Projection) {
+		return fmt.Errorf("projection (%q) must be one of: %s", g.Projection, strings.Join(mapProjections, ", "))
+	}
+	// The mercator projection stretches to infinity at the poles.
+	maxAbsLat := 90.0
+	if g.Projection == projectionMercator {
+		maxAbsLat = 85
+	}
+	if minLat < -maxAbsLat || maxLat > maxAbsLat || minLat >= maxLat {
+		return fmt.Errorf("bbox latitudes must satisfy -%[1]g <= min_lat < max_lat <= %[1]g for the %s projection", maxAbsLat, g.Projection)
+	}
+	return nil
+}
+
+// forward projects a longitude and latitude to projected coordinates, x
+// increasing eastwards and y northwards, in units shared by both axes.
+func (g *GeoReference) forward(lon, lat float64) (float64, float64) {
+	lambda := lon * math.Pi / 180
+	phi := lat * math.Pi / 180
+	switch g.Projection {
+	case projectionMercator:
+		phi = math.Max(-89.9, math.Min(89.9, lat)) * math.Pi / 180
+		return lambda, math.Log(math.Tan(phi) + 1/math.Cos(phi))
+	case projectionMollweide:
+		lambda -= (g.BBox[0] + g.BBox[2]) / 2 * math.Pi / 180
+		theta := mollweideTheta(phi)
+		return 2 * math.Sqrt2 / math.Pi * lambda * math.Cos(theta), math.Sqrt2 * math.Sin(theta)
+	default:
+		return lambda, phi
+	}
+}
+
+// inverse is the inverse of forward. It reports false for projected
+// coordinates outside the globe.
+func (g *GeoReference) inverse(x, y float64) (float64, float64, bool) {
+	switch g.Projection {
+	case projectionMercator:
+		return x * 180 / math.Pi, math.Atan(math.Sinh(y)) * 180 / math.Pi, true
+	case projectionMollweide:
+		if math.Abs(y) > math.Sqrt2 {
+			return 0, 0, false
+		}
+		theta := math.Asin(y / math.Sqrt2)
+		if math.Cos(theta) < 1e-12 {
+			return (g.BBox[0] + g.BBox[2]) / 2, math.Copysign(90, y), true
+		}
+		lambda := math.Pi * x / (2 * math.Sqrt2 * math.Cos(theta))
+		if math.Abs(lambda) > math.Pi {
+			return 0, 0, false
+		}
+		phi := math.Asin((2*theta + math.Sin(2*theta)) / math.Pi)
+		return lambda*180/math.Pi + (g.BBox[0]+g.BBox[2])/2, phi * 180 / math.Pi, true
+	default:
+		return x * 180 / math.Pi, y * 180 / math.Pi, true
+	}
+}
+
+// mollweideTheta solves 2θ + sin 2θ = π sin φ for the auxiliary angle of the
+// Mollweide projection by Newton's method.
+func mollweideTheta(phi float64) float64 {
+	if math.Abs(phi) >= math.Pi/2-1e-9 {
+		return math.Copysign(math.Pi/2, phi)
+	}
+	theta := phi
+	for i := 0; i < 20; i++ {
+		delta := (2*theta + math.Sin(2*theta) - math.Pi*math.Sin(phi)) / (2 + 2*math.Cos(2*theta))
+		theta -= delta
+		if math.Abs(delta) < 1e-12 {
+			break
+		}
+	}
+	return theta
+}
+
+// extent returns the projected rectangle the image covers, as minimum and
+// maximum x and y. For equirectangular and mercator maps its corners are the
+// bounding box's. A Mollweide map's meridians curve, so its extent is the
+// widest parallel of the bounding box, and the corners of the image can lie
+// outside the globe.
+func (g *GeoReference) extent() (minX, minY, maxX, maxY float64) {
+	minX, minY = g.forward(g.BBox[0], g.BBox[1])
+	maxX, maxY = g.forward(g.BBox[2], g.BBox[3])
+	if g.Projection == projectionMollweide {
+		widest := math.Max(g.BBox[1], math.Min(g.BBox[3], 0))
+		minX, _ = g.forward(g.BBox[0], widest)
+		maxX, _ = g.forward(g.BBox[2], widest)
+	}
+	return minX, minY, maxX, maxY
+}
+
+// Aspect returns the height to width ratio of an image of the bounding box.
+// Equirectangular images are scaled by the cosine of the central latitude so
+// that shapes are preserved near the centre.
+func (g *GeoReference) Aspect() float64 {
+	minX, minY, maxX, maxY := g.extent()
+	aspect := (maxY - minY) / (maxX - minX)
+	if g.Projection == projectionEquirectangular {
+		aspect /= math.Cos((g.BBox[1] + g.BBox[3]) / 2 * math.Pi / 180)
+	}
+	return aspect
+}
+
+// Project returns the position, in pixels from the top left corner of a
+// width×height image, of a longitude and latitude. Points outside the
+// bounding box fall outside the image.
+func (g *GeoReference) Project(lon, lat float64, width, height int) (float64, float64) {
+	minX, minY, maxX, maxY := g.extent()
+	x, y := g.forward(lon, lat)
+	return (x - minX) / (maxX - minX) * float64(width), (maxY - y) / (maxY - minY) * float64(height)
+}
+
+// Unproject is the inverse of Project. It reports false for pixels outside
+// the globe, such as the corners of a Mollweide world map.
+func (g *GeoReference) Unproject(x, y float64, width, height int) (float64, float64, bool) {
+	minX, minY, maxX, maxY := g.extent()
+	return g.inverse(minX+x/float64(width)*(maxX-minX), maxY-y/float64(height)*(maxY-minY))
+}
+
+// ManifestGeo is the manifest "geo" section: the resolved "geo" section of
+// info.json and the size of a full-scale tile, for tools that convert
+// between coordinates and tiles or display distances.
+type ManifestGeo struct {
+	BBox       [4]float64 `json:"bbox"`
+	Projection string     `json:"projection"`
+	// MetersPerTile is the width and height of a full-scale tile at the
+	// centre of the map. Away from the centre, tiles of an equirectangular
+	// map narrow towards the poles, tiles of a mercator map shrink towards
+	// the equator in both directions and tiles of a Mollweide map shear.
+	MetersPerTile [2]float64 `json:"meters_per_tile"`
+}
+
+// Manifest returns the manifest "geo" section of a width×height map.
+func (g *GeoReference) Manifest(width, height int) ManifestGeo {
+	// Measure a tile at the centre along great circles.
+	cx, cy := float64(width)/2, float64(height)/2
+	distance := func(x0, y0, x1, y1 float64) float64 {
+		lon0, lat0, _ := g.Unproject(x0, y0, width, height)
+		lon1, lat1, _ := g.Unproject(x1, y1, width, height)
+		return haversine(lon0, lat0, lon1, lat1)
+	}
+	x := distance(cx-0.5, cy, cx+0.5, cy)
+	y := distance(cx, cy-0.5, cx, cy+0.5)
+	return ManifestGeo{
+		BBox:          g.BBox,
+		Projection:    g.Projection,
+		MetersPerTile: [2]float64{math.Round(x*10) / 10, math.Round(y*10) / 10},
+	}
+}
+
+// haversine returns the great-circle distance in metres between two points.
+func haversine(lon0, lat0, lon1, lat1 float64) float64 {
+	phi0, phi1 := lat0*math.Pi/180, lat1*math.Pi/180
+	dPhi := phi1 - phi0
+	dLambda := (lon1 - lon0) * math.Pi / 180
+	a := math.Sin(dPhi/2)*math.Sin(dPhi/2) + math.Cos(phi0)*math.Cos(phi1)*math.Sin(dLambda/2)*math.Sin(dLambda/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(math.Min(1, a)))
+}
@@ -0,0 +1,376 @@
+package mapgen
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// TIFF tags read by decodeGeoTIFF.
+const (
+	tiffImageWidth      = 256
+	tiffImageLength     = 257
+	tiffBitsPerSample   = 258
+	tiffCompression     = 259
+	tiffStripOffsets    = 273
+	tiffSamplesPerPixel = 277
+	tiffRowsPerStrip    = 278
+	tiffStripByteCounts = 279
+	tiffPredictor       = 317
+	tiffTileWidth       = 322
+	tiffTileLength      = 323
+	tiffTileOffsets     = 324
+	tiffTileByteCounts  = 325
+	tiffSampleFormat    = 339
+	tiffGDALNoData      = 42113
+)
+
+// tiffFieldSizes are the sizes in bytes of the TIFF field types, by type.
+var tiffFieldSizes = map[uint16]int{1: 1, 2: 1, 3: 2, 4: 4, 6: 1, 7: 1, 8: 2, 9: 4, 11: 4, 12: 8}
+
+// tiffFields are the tags of the first image of a TIFF file.
+type tiffFields struct {
+	order  binary.ByteOrder
+	values map[uint16][]uint64
+	noData string // the GDAL nodata tag, empty without it
+}
+
+// field returns the first value of tag, or def without it.
+func (f *tiffFields) field(tag uint16, def uint64) uint64 {
+	if v := f.values[tag]; len(v) > 0 {
+		return v[0]
+	}
+	return def
+}
+
+// size returns the dimensions of the image, checked against the largest
+// supported.
+func (f *tiffFields) size() (width, height int, err error) {
+	width, height = int(f.field(tiffImageWidth, 0)), int(f.field(tiffImageLength, 0))
+	if width <= 0 || height <= 0 || width > 1<<15 || height > 1<<15 {
+		return 0, 0, fmt.Errorf("unsupported TIFF size %dx%d", width, height)
+	}
+	return width, height, nil
+}
+
+// readTIFFFields reads the tags of the first image of a TIFF file.
+func readTIFFFields(data []byte) (*tiffFields, error) {
+	if len(data) < 8 {
+		return nil, errors.New("not a TIFF file")
+	}
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, errors.New("not a TIFF file")
+	}
+	switch order.Uint16(data[2:]) {
+	case 42:
+	case 43:
+		return nil, errors.New("BigTIFF files are not supported, convert it to a regular TIFF, e.g. with gdal_translate")
+	default:
+		return nil, errors.New("not a TIFF file")
+	}
+
+	// Read the tags of the first IFD.
+	ifd := int(order.Uint32(data[4:]))
+	if ifd+2 > len(data) {
+		return nil, errors.New("truncated TIFF file")
+	}
+	fields := make(map[uint16][]uint64)
+	var noData string
+	for i, n := 0, int(order.Uint16(data[ifd:])); i < n; i++ {
+		entry := ifd + 2 + 12*i
+		if entry+12 > len(data) {
+			return nil, errors.New("truncated TIFF file")
+		}
+		tag, typ, count := order.Uint16(data[entry:]), order.Uint16(data[entry+2:]), int(order.Uint32(data[entry+4:]))
+		size, ok := tiffFieldSizes[typ]
+		if !ok {
+			continue
+		}
+		value := data[entry+8 : entry+12]
+		if size*count > 4 {
+			offset := int(order.Uint32(value))
+			if count < 0 || offset < 0 || offset+size*count > len(data) {
+				return nil, fmt.Errorf("TIFF tag %d points outside the file", tag)
+			}
+			value = data[offset : offset+size*count]
+		}
+		if tag == tiffGDALNoData && typ == 2 {
+			noData = strings.TrimRight(string(value[:count]), "\x00 ")
+			continue
+		}
+		values := make([]uint64, count)
+		for k := range values {
+			switch size {
+			case 1:
+				values[k] = uint64(value[k])
+			case 2:
+				values[k] = uint64(order.Uint16(value[2*k:]))
+			case 4:
+				values[k] = uint64(order.Uint32(value[4*k:]))
+			case 8:
+				values[k] = order.Uint64(value[8*k:])
+			}
+		}
+		fields[tag] = values
+	}
+	return &tiffFields{order: order, values: fields, noData: noData}, nil
+}
+
+// decodeGeoTIFF decodes the first image of a single-band GeoTIFF, such as an
+// SRTM or ETOPO elevation tile, into a heightmap. It reads the subset of
+// TIFF these use: strips or tiles, uncompressed, LZW or Deflate compressed,
+// with or without a predictor, of 8 to 64-bit integer or floating point
+// samples. Samples equal to the GDAL nodata value become NaN. The
+// georeferencing tags are ignored: the map's "geo" section describes where
+// it lies. No strip or tile may decompress to more than its share of the
+// image, so that a small file cannot claim unbounded memory.
+func decodeGeoTIFF(data []byte) (*heightmap, error) {
+	tags, err := readTIFFFields(data)
+	if err != nil {
+		return nil, err
+	}
+	order, fields, noData, field := tags.order, tags.values, tags.noData, tags.field
+
+	width, height, err := tags.size()
+	if err != nil {
+		return nil, err
+	}
+	if spp := field(tiffSamplesPerPixel, 1); spp != 1 {
+		return nil, fmt.Errorf("the TIFF has %d bands, elevation needs exactly 1", spp)
+	}
+	bits := int(field(tiffBitsPerSample, 1))
+	format := field(tiffSampleFormat, 1)
+	switch {
+	case (format == 1 || format == 2) && (bits == 8 || bits == 16 || bits == 32):
+	case format == 3 && (bits == 32 || bits == 64):
+	default:
+		return nil, fmt.Errorf("unsupported TIFF samples: %d-bit of format %d", bits, format)
+	}
+	compression, predictor := field(tiffCompression, 1), field(tiffPredictor, 1)
+	switch {
+	case predictor == 1, predictor == 2 && format != 3, predictor == 3 && format == 3:
+	default:
+		return nil, fmt.Errorf("unsupported TIFF predictor %d for samples of format %d", predictor, format)
+	}
+
+	// Strips are tiles as wide as the image.
+	blockWidth, blockHeight := width, int(field(tiffRowsPerStrip, uint64(height)))
+	offsets, counts := fields[tiffStripOffsets], fields[tiffStripByteCounts]
+	if _, tiled := fields[tiffTileOffsets]; tiled {
+		blockWidth, blockHeight = int(field(tiffTileWidth, 0)), int(field(tiffTileLength, 0))
+		offsets, counts = fields[tiffTileOffsets], fields[tiffTileByteCounts]
+	}
+	blockHeight = min(max(blockHeight, 1), height)
+	if blockWidth <= 0 || blockWidth > 1<<15 || blockWidth*blockHeight > max(width*height, 1<<18) {
+		return nil, fmt.Errorf("unsupported TIFF tile size %dx%d for a %dx%d image", blockWidth, blockHeight, width, height)
+	}
+	across := (width + blockWidth - 1) / blockWidth
+	blocks := across * ((height + blockHeight - 1) / blockHeight)
+	if len(offsets) < blocks || len(counts) < blocks {
+		return nil, fmt.Errorf("the TIFF lists %d strips or tiles, %d are needed", min(len(offsets), len(counts)), blocks)
+	}
+
+	noDataValue := math.NaN()
+	if noData != "" {
+		v, err := strconv.ParseFloat(noData, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GDAL nodata value %q", noData)
+		}
+		noDataValue = v
+	}
+	bytesPerSample := bits / 8
+	blockSize := blockHeight * blockWidth * bytesPerSample
+	h := &heightmap{Width: width, Height: height, Data: make([]float32, width*height)}
+	for i := 0; i < blocks; i++ {
+		start, end := offsets[i], offsets[i]+counts[i]
+		if end > uint64(len(data)) || start > end {
+			return nil, fmt.Errorf("TIFF strip or tile %d lies outside the file", i)
+		}
+		block, err := decompressTIFFBlock(data[start:end], compression, blockSize)
+		if err != nil {
+			return nil, fmt.Errorf("TIFF strip or tile %d: %w", i, err)
+		}
+		bx, by := i%across*blockWidth, i/across*blockHeight
+		rows := min(blockHeight, height-by)
+		rowSize := blockWidth * bytesPerSample
+		if len(block) < rows*rowSize {
+			return nil, fmt.Errorf("TIFF strip or tile %d holds %d bytes, %d are needed", i, len(block), rows*rowSize)
+		}
+		for row := 0; row < rows; row++ {
+			line := block[row*rowSize : (row+1)*rowSize]
+			sampleOrder := order
+			switch predictor {
+			case 2:
+				undoHorizontalPredictor(line, bytesPerSample, order)
+			case 3:
+				line = undoFloatPredictor(line, bytesPerSample)
+				sampleOrder = binary.BigEndian
+			}
+			for col := 0; col < min(blockWidth, width-bx); col++ {
+				v := tiffSample(line[col*bytesPerSample:], bits, format, sampleOrder)
+				if v == noDataValue {
+					v = math.NaN()
+				}
+				h.Data[(by+row)*width+bx+col] = float32(v)
+			}
+		}
+	}
+	return h, nil
+}
+
+// decompressTIFFBlock decompresses a strip or tile, failing if it holds more
+// than limit bytes.
+func decompressTIFFBlock(data []byte, compression uint64, limit int) ([]byte, error) {
+	switch compression {
+	case 1:
+		return data, nil
+	case 5:
+		return decodeTIFFLZW(data, limit)
+	case 8, 32946:
+		r, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		out, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+		if err == nil && len(out) > limit {
+			err = fmt.Errorf("decompresses to over the %d bytes of the block", limit)
+		}
+		return out, err
+	default:
+		return nil, fmt.Errorf("unsupported TIFF compression %d, convert it with e.g. gdal_translate -co COMPRESS=DEFLATE", compression)
+	}
+}
+
+// decodeTIFFLZW decodes TIFF's LZW variant, whose codes are packed most
+// significant bit first and widen one code earlier than compress/lzw
+// expects. It fails once the output exceeds limit bytes.
+func decodeTIFFLZW(src []byte, limit int) ([]byte, error) {
+	const clearCode, eoiCode = 256, 257
+	var out []byte
+	table := make([][]byte, 4096)
+	for i := 0; i < 256; i++ {
+		table[i] = []byte{byte(i)}
+	}
+	next, width := 258, 9
+	var prev []byte
+	var acc uint32
+	accBits := 0
+	for pos := 0; ; {
+		for accBits < width {
+			if pos >= len(src) {
+				return out, nil
+			}
+			acc = acc<<8 | uint32(src[pos])
+			pos++
+			accBits += 8
+		}
+		code := int(acc>>(accBits-width)) & (1<<width - 1)
+		accBits -= width
+		switch {
+		case code == eoiCode:
+			return out, nil
+		case code == clearCode:
+			next, width, prev = 258, 9, nil
+			continue
+		}
+		var entry []byte
+		switch {
+		case prev == nil:
+			if code > 255 {
+				return nil, fmt.Errorf("invalid LZW code %d", code)
+			}
+			entry = table[code]
+		case code < next:
+			entry = table[code]
+			if next < len(table) {
+				table[next] = append(append(make([]byte, 0, len(prev)+1), prev...), entry[0])
+				next++
+			}
+		case code == next && next < len(table):
+			entry = append(append(make([]byte, 0, len(prev)+1), prev...), prev[0])
+			table[next] = entry
+			next++
+		default:
+			return nil, fmt.Errorf("invalid LZW code %d", code)
+		}
+		if len(out)+len(entry) > limit {
+			return nil, fmt.Errorf("decompresses to over the %d bytes of the block", limit)
+		}
+		out = append(out, entry...)
+		prev = entry
+		if next == 1<<width-1 && width < 12 {
+			width++
+		}
+	}
+}
+
+// undoHorizontalPredictor reverses TIFF predictor 2 on a row of integer
+// samples, each stored as the difference from the sample before it.
+func undoHorizontalPredictor(row []byte, size int, order binary.ByteOrder) {
+	switch size {
+	case 1:
+		for i := 1; i < len(row); i++ {
+			row[i] += row[i-1]
+		}
+	case 2:
+		for i := 2; i+2 <= len(row); i += 2 {
+			order.PutUint16(row[i:], order.Uint16(row[i:])+order.Uint16(row[i-2:]))
+		}
+	case 4:
+		for i := 4; i+4 <= len(row); i += 4 {
+			order.PutUint32(row[i:], order.Uint32(row[i:])+order.Uint32(row[i-4:]))
+		}
+	}
+}
+
+// undoFloatPredictor reverses TIFF predictor 3 on a row of floating point
+// samples, whose bytes are stored byte-differenced and grouped by
+// significance. It returns the samples big-endian.
+func undoFloatPredictor(row []byte, size int) []byte {
+	for i := 1; i < len(row); i++ {
+		row[i] += row[i-1]
+	}
+	n := len(row) / size
+	out := make([]byte, len(row))
+	for i := 0; i < n; i++ {
+		for b := 0; b < size; b++ {
+			out[i*size+b] = row[b*n+i]
+		}
+	}
+	return out
+}
+
+// tiffSample returns the value of the sample at the start of b.
+func tiffSample(b []byte, bits int, format uint64, order binary.ByteOrder) float64 {
+	switch {
+	case format == 3 && bits == 32:
+		return float64(math.Float32frombits(order.Uint32(b)))
+	case format == 3:
+		return math.Float64frombits(order.Uint64(b))
+	case bits == 8 && format == 2:
+		return float64(int8(b[0]))
+	case bits == 8:
+		return float64(b[0])
+	case bits == 16 && format == 2:
+		return float64(int16(order.Uint16(b)))
+	case bits == 16:
+		return float64(order.Uint16(b))
+	case format == 2:
+		return float64(int32(order.Uint32(b)))
+	default:
+		return float64(order.Uint32(b))
+	}
+}
@@ -0,0 +1,138 @@
+package mapgen
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/png"
+	"math"
+	"path/filepath"
+)
+
+// HeightmapFiles are the optional elevation inputs of a map, in the order
+// they are looked for; a map has at most one of them.
+var HeightmapFiles = []string{
+	"heightmap.png", // 8 or 16-bit grayscale PNG
+	"heightmap.tif", // single-band GeoTIFF, such as an SRTM or ETOPO tile
+}
+
+// heightmapConfig is the optional "generator.heightmap" section of
+// info.json: how the elevations of heightmap.png or heightmap.tif, in the
+// units of the file, usually metres, map to terrain.
+type heightmapConfig struct {
+	// SeaLevel is the elevation at and under which terrain is water.
+	SeaLevel float64 `json:"sea_level"`
+	// MaxElevation is the elevation above SeaLevel of magnitude 30, the
+	// highest mountains; a third of it is highland and two thirds mountain.
+	MaxElevation float64 `json:"max_elevation"`
+}
+
+// defaultHeightmapConfig returns the settings used when info.json has no
+// "generator.heightmap" section, matching those of fetch-elevation.
+func defaultHeightmapConfig() heightmapConfig {
+	return heightmapConfig{SeaLevel: 0, MaxElevation: 3000}
+}
+
+func (c *heightmapConfig) validate() error {
+	if c.MaxElevation <= 0 {
+		return fmt.Errorf("\"max_elevation\" (%g) must be positive", c.MaxElevation)
+	}
+	return nil
+}
+
+// heightmap is a decoded elevation grid, row-major, with NaN where the file
+// has no data.
+type heightmap struct {
+	Width, Height int
+	Data          []float32
+}
+
+// readHeightmap decodes the heightmap among the auxiliary inputs, or
+// returns nil if the map has none.
+func readHeightmap(inputs map[string][]byte) (*heightmap, error) {
+	var name string
+	for _, f := range HeightmapFiles {
+		if _, ok := inputs[f]; ok {
+			if name != "" {
+				return nil, fmt.Errorf("the map has both %s and %s, keep one", name, f)
+			}
+			name = f
+		}
+	}
+	if name == "" {
+		return nil, nil
+	}
+	if filepath.Ext(name) == ".tif" {
+		h, err := decodeGeoTIFF(inputs[name])
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", name, err)
+		}
+		return h, nil
+	}
+	img, err := png.Decode(bytes.NewReader(inputs[name]))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", name, err)
+	}
+	b := img.Bounds()
+	h := &heightmap{Width: b.Dx(), Height: b.Dy(), Data: make([]float32, b.Dx()*b.Dy())}
+	switch img := img.(type) {
+	case *image.Gray16:
+		for y := 0; y < h.Height; y++ {
+			for x := 0; x < h.Width; x++ {
+				h.Data[y*h.Width+x] = float32(binary.BigEndian.Uint16(img.Pix[img.PixOffset(b.Min.X+x, b.Min.Y+y):]))
+			}
+		}
+	case *image.Gray:
+		for y := 0; y < h.Height; y++ {
+			for x := 0; x < h.Width; x++ {
+				h.Data[y*h.Width+x] = float32(img.GrayAt(b.Min.X+x, b.Min.Y+y).Y)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("%s must be a grayscale PNG", name)
+	}
+	return h, nil
+}
+
+// resample returns the heightmap bilinearly resampled to width×height, or
+// the heightmap itself if it already has that size. Tiles next to missing
+// data take the nearest sample instead.
+func (h *heightmap) resample(width, height int) *heightmap {
+	if h.Width == width && h.Height == height {
+		return h
+	}
+	out := &heightmap{Width: width, Height: height, Data: make([]float32, width*height)}
+	sx, sy := float64(h.Width)/float64(width), float64(h.Height)/float64(height)
+	at := func(x, y int) float64 {
+		return float64(h.Data[min(max(y, 0), h.Height-1)*h.Width+min(max(x, 0), h.Width-1)])
+	}
+	for y := 0; y < height; y++ {
+		fy := (float64(y)+0.5)*sy - 0.5
+		y0 := int(math.Floor(fy))
+		ty := fy - float64(y0)
+		for x := 0; x < width; x++ {
+			fx := (float64(x)+0.5)*sx - 0.5
+			x0 := int(math.Floor(fx))
+			tx := fx - float64(x0)
+			v00, v10, v01, v11 := at(x0, y0), at(x0+1, y0), at(x0, y0+1), at(x0+1, y0+1)
+			v := (v00*(1-tx)+v10*tx)*(1-ty) + (v01*(1-tx)+v11*tx)*ty
+			if math.IsNaN(v) {
+				v = at(int(math.Round(fx)), int(math.Round(fy)))
+			}
+			out.Data[y*width+x] = float32(v)
+		}
+	}
+	return out
+}
+
+// terrain returns the terrain of tile (x, y): water at and under sea level
+// or without data, otherwise land whose magnitude rises linearly from 0 at
+// sea level to 30 at MaxElevation above it.
+func (h *heightmap) terrain(x, y int, cfg heightmapConfig) Terrain {
+	v := float64(h.Data[y*h.Width+x])
+	if math.IsNaN(v) || v <= cfg.SeaLevel {
+		return Terrain{Type: Water}
+	}
+	return Terrain{Type: Land, Magnitude: 30 * math.Min(1, (v-cfg.SeaLevel)/cfg.MaxElevation)}
+}
@@ -0,0 +1,262 @@
+package mapgen
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+)
+
+const (
+	// hpaClusterSize is the side, in tiles, of a pathfinding cluster.
+	hpaClusterSize = 32
+	// hpaMaxSingleEntrance is the longest entrance that gets a single
+	// transition in its middle; longer ones get one at each end.
+	hpaMaxSingleEntrance = 6
+	// hpaFileVersion is written in the header of the HPA files and bumped
+	// whenever their layout changes.
+	hpaFileVersion = 1
+)
+
+// hpaLandLayer and hpaWaterLayer export HPA*-style abstract graphs over land
+// (attacks) and water (boats), so the server's pathfinding can search a
+// small graph instead of the full-scale map.
+var hpaLandLayer = auxLayer{
+	Name:      "hpa_land",
+	File:      "hpa_land.bin",
+	TileBytes: 1,
+	Summary:   "hierarchical pathfinding graph over land",
+	Build: func(ctx context.Context, in *layerInput) ([]byte, map[string]any, error) {
+		return buildHPA(ctx, in.Terrain, Land, in.WrapX)
+	},
+}
+
+var hpaWaterLayer = auxLayer{
+	Name:      "hpa_water",
+	File:      "hpa_water.bin",
+	TileBytes: 1,
+	Summary:   "hierarchical pathfinding graph over water",
+	Build: func(ctx context.Context, in *layerInput) ([]byte, map[string]any, error) {
+		return buildHPA(ctx, in.Terrain, Water, in.WrapX)
+	},
+}
+
+// hpaEdge is an edge of the abstract graph.
+type hpaEdge struct {
+	A, B uint32
+	Cost uint32
+}
+
+// buildHPA builds the abstract graph over tiles of the given type. The map is
+// divided into hpaClusterSize square clusters. Along the border between two
+// adjacent clusters, every maximal run of tile pairs passable on both sides
+// is an entrance, with transitions at its middle (short entrances) or at both
+// ends; each transition adds a node on each side joined by an edge of cost 1.
+// Nodes of the same cluster are joined by edges whose cost is their shortest
+// 4-neighbour distance inside the cluster. If wrapX is true, the last and
+// first columns of clusters are adjacent too, and the border between them,
+// the west/east seam, has entrances like any other.
+//
+// The file is little-endian:
+//
+//	"OFHP", u8 version, u16 cluster size
+//	u16 clusters across, u16 clusters down
+//	(clusters + 1) × u32: offset of each cluster's first node; nodes are
+//	    sorted by cluster (row-major), then by y, then x
+//	u32 node count, then per node: u16 x, u16 y
+//	u32 edge count, then per edge: u32 node a, u32 node b, u32 cost
+func buildHPA(ctx context.Context, terrain *terrainGrid, passable TerrainType, wrapX bool) ([]byte, map[string]any, error) {
+	width := terrain.Width
+	height := terrain.Height
+	if width > math.MaxUint16+1 || height > math.MaxUint16+1 {
+		return nil, nil, fmt.Errorf("map is %dx%d, HPA graphs support at most 65536 tiles per side", width, height)
+	}
+	clustersX := (width + hpaClusterSize - 1) / hpaClusterSize
+	clustersY := (height + hpaClusterSize - 1) / hpaClusterSize
+	clusterOf := func(c Coord) int {
+		return (c.Y/hpaClusterSize)*clustersX + c.X/hpaClusterSize
+	}
+	open := func(x, y int) bool {
+		return terrain.at(x, y).Type == passable
+	}
+
+	// Find transitions along every cluster border.
+	var transitions [][2]Coord
+	addEntrance := func(start, end int, at func(i int) (Coord, Coord)) {
+		length := end - start + 1
+		if length <= hpaMaxSingleEntrance {
+			a, b := at(start + length/2)
+			transitions = append(transitions, [2]Coord{a, b})
+			return
+		}
+		for _, i := range []int{start, end} {
+			a, b := at(i)
+			transitions = append(transitions, [2]Coord{a, b})
+		}
+	}
+	scanBorder := func(n int, at func(i int) (Coord, Coord)) {
+		start := -1
+		for i := 0; i <= n; i++ {
+			ok := false
+			if i < n {
+				a, b := at(i)
+				ok = open(a.X, a.Y) && open(b.X, b.Y)
+			}
+			switch {
+			case ok && start < 0:
+				start = i
+			case !ok && start >= 0:
+				addEntrance(start, i-1, at)
+				start = -1
+			}
+		}
+	}
+	for cy := 0; cy < clustersY; cy++ {
+		for cx := 0; cx < clustersX; cx++ {
+			x0, y0 := cx*hpaClusterSize, cy*hpaClusterSize
+			rows := min(hpaClusterSize, height-y0)
+			cols := min(hpaClusterSize, width-x0)
+			if x := x0 + hpaClusterSize; x < width {
+				// Border with the cluster to the right.
+				scanBorder(rows, func(i int) (Coord, Coord) {
+					return Coord{x - 1, y0 + i}, Coord{x, y0 + i}
+				})
+			} else if wrapX && width > 2 {
+				// Border with the first cluster of the row, across the seam.
+				scanBorder(rows, func(i int) (Coord, Coord) {
+					return Coord{width - 1, y0 + i}, Coord{0, y0 + i}
+				})
+			}
+			if y := y0 + hpaClusterSize; y < height {
+				// Border with the cluster below.
+				scanBorder(cols, func(i int) (Coord, Coord) {
+					return Coord{x0 + i, y - 1}, Coord{x0 + i, y}
+				})
+			}
+		}
+	}
+
+	// Number the nodes by cluster, then row-major within the cluster.
+	nodeSet := make(map[Coord]bool)
+	for _, t := range transitions {
+		nodeSet[t[0]] = true
+		nodeSet[t[1]] = true
+	}
+	nodes := make([]Coord, 0, len(nodeSet))
+	for c := range nodeSet {
+		nodes = append(nodes, c)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		ci, cj := clusterOf(nodes[i]), clusterOf(nodes[j])
+		if ci != cj {
+			return ci < cj
+		}
+		if nodes[i].Y != nodes[j].Y {
+			return nodes[i].Y < nodes[j].Y
+		}
+		return nodes[i].X < nodes[j].X
+	})
+	ids := make(map[Coord]uint32, len(nodes))
+	offsets := make([]uint32, clustersX*clustersY+1)
+	for i, c := range nodes {
+		ids[c] = uint32(i)
+		offsets[clusterOf(c)+1]++
+	}
+	for i := 1; i < len(offsets); i++ {
+		offsets[i] += offsets[i-1]
+	}
+
+	edges := make([]hpaEdge, 0, len(transitions))
+	for _, t := range transitions {
+		a, b := ids[t[0]], ids[t[1]]
+		edges = append(edges, hpaEdge{A: min(a, b), B: max(a, b), Cost: 1})
+	}
+
+	// Intra-cluster edges: a BFS inside the cluster from each of its nodes.
+	dist := make([]int32, hpaClusterSize*hpaClusterSize)
+	queue := make([]Coord, 0, hpaClusterSize*hpaClusterSize)
+	var buf [4]Coord
+	for cluster := 0; cluster < clustersX*clustersY; cluster++ {
+		clusterNodes := nodes[offsets[cluster]:offsets[cluster+1]]
+		if len(clusterNodes) < 2 {
+			continue
+		}
+		x0, y0 := (cluster%clustersX)*hpaClusterSize, (cluster/clustersX)*hpaClusterSize
+		x1, y1 := min(x0+hpaClusterSize, width), min(y0+hpaClusterSize, height)
+		local := func(c Coord) int { return (c.X-x0)*hpaClusterSize + c.Y - y0 }
+		for i, start := range clusterNodes[:len(clusterNodes)-1] {
+			for j := range dist {
+				dist[j] = -1
+			}
+			dist[local(start)] = 0
+			queue = append(queue[:0], start)
+			for head := 0; head < len(queue); head++ {
+				c := queue[head]
+				n := neighborCoords(c.X, c.Y, width, height, &buf)
+				for _, nc := range buf[:n] {
+					if nc.X < x0 || nc.X >= x1 || nc.Y < y0 || nc.Y >= y1 || !open(nc.X, nc.Y) || dist[local(nc)] >= 0 {
+						continue
+					}
+					dist[local(nc)] = dist[local(c)] + 1
+					queue = append(queue, nc)
+				}
+			}
+			for _, other := range clusterNodes[i+1:] {
+				if d := dist[local(other)]; d > 0 {
+					edges = append(edges, hpaEdge{A: ids[start], B: ids[other], Cost: uint32(d)})
+				}
+			}
+		}
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].A != edges[j].A {
+			return edges[i].A < edges[j].A
+		}
+		return edges[i].B < edges[j].B
+	})
+
+	var out bytes.Buffer
+	le := binary.LittleEndian
+	out.WriteString("OFHP")
+	out.WriteByte(hpaFileVersion)
+	out.Write(le.AppendUint16(nil, hpaClusterSize))
+	out.Write(le.AppendUint16(nil, uint16(clustersX)))
+	out.Write(le.AppendUint16(nil, uint16(clustersY)))
+	for _, o := range offsets {
+		out.Write(le.AppendUint32(nil, o))
+	}
+	out.Write(le.AppendUint32(nil, uint32(len(nodes))))
+	for _, c := range nodes {
+		out.Write(le.AppendUint16(nil, uint16(c.X)))
+		out.Write(le.AppendUint16(nil, uint16(c.Y)))
+	}
+	out.Write(le.AppendUint32(nil, uint32(len(edges))))
+	for _, e := range edges {
+		out.Write(le.AppendUint32(nil, e.A))
+		out.Write(le.AppendUint32(nil, e.B))
+		out.Write(le.AppendUint32(nil, e.Cost))
+	}
+
+	LoggerFromContext(ctx).Debug(fmt.Sprintf("HPA graph over %s: %d nodes, %d edges", terrainTypeName(passable), len(nodes), len(edges)))
+	return out.Bytes(), map[string]any{
+		"version":      hpaFileVersion,
+		"cluster_size": hpaClusterSize,
+		"nodes":        len(nodes),
+		"edges":        len(edges),
+		"wrap_x":       wrapX,
+	}, nil
+}
+
+// terrainTypeName returns a lowercase name for t, for logs.
+func terrainTypeName(t TerrainType) string {
+	switch t {
+	case Land:
+		return "land"
+	case Water:
+		return "water"
+	default:
+		return "impassable"
+	}
+}
@@ -0,0 +1,96 @@
+package mapgen
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapformat"
+)
+
+// ImpassableKind is what an Impassable tile shows: the void around a
+// non-rectangular map, or a surface such as an ice sheet or a lava field that
+// renders like terrain but, like the void, cannot be owned, attacked, nuked
+// or sailed through. The kinds are those of the map format, packed into bits
+// 5-6 of an impassable tile, see packTerrain.
+type ImpassableKind = mapformat.ImpassableKind
+
+// Enumeration of possible ImpassableKind values.
+const (
+	ImpassableVoid = mapformat.ImpassableVoid
+	ImpassableIce  = mapformat.ImpassableIce
+	ImpassableLava = mapformat.ImpassableLava
+)
+
+// ImpassableKindNames names the kinds in info.json, indexed by kind.
+var ImpassableKindNames = []string{"void", "ice", "lava"}
+
+// impassableMaskFiles are the optional grayscale mask images marking the
+// tiles of each kind other than the void, by kind. Mask pixels of gray 128
+// or more make the tile impassable whatever image.png shows.
+var impassableMaskFiles = map[ImpassableKind]string{
+	ImpassableIce:  "ice.png",
+	ImpassableLava: "lava.png",
+}
+
+// ParseImpassableColors resolves "generator.impassable_colors", which maps
+// "#rrggbb" colours of image.png to the kind of impassable tile they mark.
+func ParseImpassableColors(colors map[string]string) (map[[3]uint8]ImpassableKind, error) {
+	keys := make([]string, 0, len(colors))
+	for k := range colors {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	kinds := make(map[[3]uint8]ImpassableKind, len(colors))
+	for _, k := range keys {
+		rgb, err := strconv.ParseUint(strings.TrimPrefix(k, "#"), 16, 32)
+		if !strings.HasPrefix(k, "#") || len(k) != 7 || err != nil {
+			return nil, fmt.Errorf("\"generator.impassable_colors\" key %q must be a #rrggbb colour", k)
+		}
+		kind := -1
+		for i, name := range ImpassableKindNames {
+			if colors[k] == name {
+				kind = i
+			}
+		}
+		if kind < 0 {
+			return nil, fmt.Errorf("\"generator.impassable_colors\" (%q) for %s must be one of: %s", colors[k], k, strings.Join(ImpassableKindNames, ", "))
+		}
+		kinds[[3]uint8{uint8(rgb >> 16), uint8(rgb >> 8), uint8(rgb)}] = ImpassableKind(kind)
+	}
+	return kinds, nil
+}
+
+// applyImpassableMasks makes the tiles marked by the map's impassable masks
+// impassable, see impassableMaskFiles, and returns the number of tiles
+// changed.
+func applyImpassableMasks(terrain *terrainGrid, inputs map[string][]byte) (int, error) {
+	width := terrain.Width
+	height := terrain.Height
+	changed := 0
+	for _, kind := range []ImpassableKind{ImpassableIce, ImpassableLava} {
+		mask, err := auxGrayImage(inputs, impassableMaskFiles[kind], width, height)
+		if err != nil {
+			return 0, err
+		}
+		if mask == nil {
+			continue
+		}
+		for x := 0; x < width; x++ {
+			for y := 0; y < height; y++ {
+				if grayAt(mask, x, y) >= 128 {
+					*terrain.at(x, y) = Terrain{Type: Impassable, Kind: kind}
+					changed++
+				}
+			}
+		}
+	}
+	return changed, nil
+}
+
+// isImpassableTile reports whether a packed tile is impassable, of any kind,
+// see packTerrain.
+func isImpassableTile(tile byte) bool {
+	return mapformat.Tile(tile).IsImpassable()
+}
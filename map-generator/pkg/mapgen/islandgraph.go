@@ -0,0 +1,149 @@
+package mapgen
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// islandGraphLayer and islandGraphDotLayer export the adjacency of the
+// map's landmasses, for AI invasion planning, balance analysis, and checking
+// that map edits didn't change the strategic topology.
+var islandGraphLayer = auxLayer{
+	Name:      "island_graph",
+	File:      "island_graph.json",
+	TileBytes: 0.5,
+	Summary:   "landmass adjacency graph with water gap widths",
+	Build: func(ctx context.Context, in *layerInput) ([]byte, map[string]any, error) {
+		g := in.IslandGraph()
+		data, err := json.MarshalIndent(g, "", "  ")
+		if err != nil {
+			return nil, nil, err
+		}
+		LoggerFromContext(ctx).Debug(fmt.Sprintf("Island graph: %d landmasses, %d edges", len(g.Nodes), len(g.Edges)))
+		return data, map[string]any{"nodes": len(g.Nodes), "edges": len(g.Edges)}, nil
+	},
+}
+
+var islandGraphDotLayer = auxLayer{
+	Name:      "island_graph_dot",
+	File:      "island_graph.dot",
+	TileBytes: 0.5,
+	Summary:   "landmass adjacency graph in Graphviz DOT",
+	Build: func(ctx context.Context, in *layerInput) ([]byte, map[string]any, error) {
+		return in.IslandGraph().dot(), nil, nil
+	},
+}
+
+// islandGraph is the contents of island_graph.json.
+type islandGraph struct {
+	Nodes []islandNode `json:"nodes"`
+	Edges []islandEdge `json:"edges"`
+}
+
+// islandNode is one landmass.
+type islandNode struct {
+	ID       int    `json:"id"`
+	Size     int    `json:"size"`     // land tiles
+	Centroid [2]int `json:"centroid"` // [x, y], may lie outside the landmass
+	// Bounds is [minX, minY, maxX, maxY], inclusive.
+	Bounds [4]int `json:"bounds"`
+}
+
+// islandEdge joins two landmasses separated by water.
+type islandEdge struct {
+	A, B int `json:"-"`
+	// Gap is the number of water tiles crossed by the shortest 4-neighbour
+	// water path between the landmasses.
+	Gap int `json:"gap"`
+	// At is the [x, y] water tile in the middle of that path.
+	At [2]int `json:"at"`
+}
+
+func (e islandEdge) MarshalJSON() ([]byte, error) {
+	type edge islandEdge
+	return json.Marshal(struct {
+		A int `json:"a"`
+		B int `json:"b"`
+		edge
+	}{e.A, e.B, edge(e)})
+}
+
+// buildIslandGraph computes the landmass graph. Node IDs are landmass labels
+// in column-major scan order, so they are stable for an unchanged map. A
+// BFS over water from every land tile gives each water tile its nearest
+// landmass; two landmasses are joined when these regions touch, with the
+// narrowest gap found along their border. Landmasses only reachable through
+// another landmass's waters are not joined directly: the path runs through
+// that landmass's node instead.
+func buildIslandGraph(in *layerInput) *islandGraph {
+	terrain := in.Terrain
+	width := terrain.Width
+	height := terrain.Height
+	landmasses := in.Landmasses()
+
+	g := &islandGraph{Nodes: make([]islandNode, len(landmasses.Sizes))}
+	sumX := make([]int, len(g.Nodes))
+	sumY := make([]int, len(g.Nodes))
+	for i := range g.Nodes {
+		g.Nodes[i] = islandNode{ID: i, Size: landmasses.Sizes[i], Bounds: [4]int{width, height, -1, -1}}
+	}
+	var seeds []Coord
+	var owners []int32
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			label := landmasses.Labels[y*width+x]
+			if label < 0 {
+				continue
+			}
+			n := &g.Nodes[label]
+			sumX[label] += x
+			sumY[label] += y
+			n.Bounds = [4]int{min(n.Bounds[0], x), min(n.Bounds[1], y), max(n.Bounds[2], x), max(n.Bounds[3], y)}
+			if terrain.at(x, y).Shoreline {
+				seeds = append(seeds, Coord{X: x, Y: y})
+				owners = append(owners, label)
+			}
+		}
+	}
+	for i := range g.Nodes {
+		g.Nodes[i].Centroid = [2]int{sumX[i] / g.Nodes[i].Size, sumY[i] / g.Nodes[i].Size}
+	}
+
+	voronoi := computeOceanVoronoi(terrain, seeds, owners, in.WrapX)
+	for _, e := range voronoi.edges() {
+		// The middle of the crossing path lies on the side further from its
+		// landmass, half the difference in distance back towards it.
+		at := e.CrossA
+		distA, distB := voronoi.Dist[e.CrossA.Y*width+e.CrossA.X], voronoi.Dist[e.CrossB.Y*width+e.CrossB.X]
+		if distA >= distB {
+			at = voronoi.walkBack(e.CrossA, int(distA-distB)/2)
+		} else {
+			at = voronoi.walkBack(e.CrossB, int(distB-distA)/2)
+		}
+		g.Edges = append(g.Edges, islandEdge{
+			A:   int(e.A),
+			B:   int(e.B),
+			Gap: int(e.Length) - 1,
+			At:  [2]int{at.X, at.Y},
+		})
+	}
+	return g
+}
+
+// dot renders the graph in Graphviz DOT, labelling landmasses with their size
+// and edges with their gap.
+func (g *islandGraph) dot() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("graph islands {\n")
+	buf.WriteString("  node [shape=ellipse];\n")
+	for _, n := range g.Nodes {
+		fmt.Fprintf(&buf, "  n%d [label=\"%d\\n%d tiles\"];\n", n.ID, n.ID, n.Size)
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&buf, "  n%d -- n%d [label=\"%d\"];\n", e.A, e.B, e.Gap)
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes()
+}
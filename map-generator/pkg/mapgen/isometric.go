@@ -0,0 +1,97 @@
+package mapgen
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+)
+
+const (
+	// isometricHeightScale is the extrusion, in pixels, per unit of land
+	// magnitude in the isometric preview.
+	isometricHeightScale = 0.6
+	// isometricLandBase raises all land above the water, in pixels, so
+	// coastlines read as low cliffs.
+	isometricLandBase = 1
+)
+
+// isometricPreviewLayer renders a pseudo-3D view of the map for
+// announcement posts and for authors reviewing mountain layouts.
+var isometricPreviewLayer = auxLayer{
+	Name:      "isometric_preview",
+	File:      "isometric_preview.png",
+	TileBytes: 6,
+	Summary:   "pseudo-3D isometric rendering of the map",
+	Build: func(ctx context.Context, in *layerInput) ([]byte, map[string]any, error) {
+		img := renderIsometric(in.Terrain4x)
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, nil, fmt.Errorf("failed to encode preview: %w", err)
+		}
+		return buf.Bytes(), map[string]any{"width": img.Bounds().Dx(), "height": img.Bounds().Dy()}, nil
+	},
+}
+
+// renderIsometric draws terrain in a 2:1 isometric projection, one tile two
+// pixels wide and half a pixel deep, with the north-west corner at the top.
+// Land is extruded by its magnitude and drawn back to front, so nearer
+// columns hide the ones behind them. Tops use the thumbnail colours, lit
+// from the north-west by the slope of the magnitude field, and the visible
+// sides of each column are darkened. The void is left transparent; ice and
+// lava are drawn flat.
+func renderIsometric(terrain *terrainGrid) *image.RGBA {
+	width := terrain.Width
+	height := terrain.Height
+	elevation := func(x, y int) float64 {
+		x = min(max(x, 0), width-1)
+		y = min(max(y, 0), height-1)
+		if terrain.at(x, y).Type != Land {
+			return 0
+		}
+		return terrain.at(x, y).Magnitude
+	}
+	extrusion := func(t Terrain) int {
+		if t.Type != Land {
+			return 0
+		}
+		return isometricLandBase + int(math.Round(t.Magnitude*isometricHeightScale))
+	}
+	maxExtrusion := isometricLandBase + int(math.Round(30*isometricHeightScale))
+
+	img := image.NewRGBA(image.Rect(0, 0, width+height, (width+height)/2+maxExtrusion+1))
+	shade := func(c RGBA, f float64) color.RGBA {
+		scale := func(v uint8) uint8 { return uint8(math.Min(255, float64(v)*f)) }
+		return color.RGBA{scale(c.R), scale(c.G), scale(c.B), 255}
+	}
+	for sum := 0; sum <= width+height-2; sum++ {
+		for x := max(0, sum-height+1); x <= min(sum, width-1); x++ {
+			y := sum - x
+			tile := *terrain.at(x, y)
+			if tile.Type == Impassable && tile.Kind == ImpassableVoid {
+				continue
+			}
+			base := ThumbnailColor(tile)
+			slope := (elevation(x-1, y) - elevation(x+1, y)) + (elevation(x, y-1) - elevation(x, y+1))
+			top := shade(base, math.Max(0.5, math.Min(1.3, 1-0.05*slope)))
+			left, right := shade(base, 0.55), shade(base, 0.75)
+
+			sx := x - y + height - 1
+			sy := sum/2 + maxExtrusion
+			topY := sy - extrusion(tile)
+			for py := topY; py <= sy; py++ {
+				if py == topY {
+					img.SetRGBA(sx, py, top)
+					img.SetRGBA(sx+1, py, top)
+				} else {
+					img.SetRGBA(sx, py, left)
+					img.SetRGBA(sx+1, py, right)
+				}
+			}
+		}
+	}
+	return img
+}
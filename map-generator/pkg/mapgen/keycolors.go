@@ -0,0 +1,176 @@
+package mapgen
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// keyFeature is the special feature a key colour of image.png marks, kept
+// in Terrain.Key through every pass so that later passes and layers can
+// honour it.
+type keyFeature uint8
+
+// Enumeration of possible keyFeature values.
+const (
+	keyNone keyFeature = iota
+	// KeyOcean is water whose body is ocean whatever its size.
+	KeyOcean
+	// KeyLake is water whose body is a lake, never the ocean, and is never
+	// filled for being small.
+	KeyLake
+	// keySpawn is plains marking a preferred spawn, see spawnMarkersLayer.
+	keySpawn
+	// keyInherit is an annotation, such as a label or guide, that takes the
+	// terrain of most of its neighbours, see resolveAmbiguousCoast.
+	keyInherit
+	// keyRiver is water that is a river, see detectRivers, and whose body
+	// is never filled for being small.
+	keyRiver
+)
+
+// KeyFeatureNames names the features in info.json, indexed by feature.
+var KeyFeatureNames = []string{"", "ocean", "lake", "spawn", "inherit", "river"}
+
+// ParseKeyColors resolves "generator.key_colors", which maps "#rrggbb"
+// colours of image.png to the feature they mark. Colours must not also be
+// impassable colours, see ParseImpassableColors.
+func ParseKeyColors(colors map[string]string, impassable map[[3]uint8]ImpassableKind) (map[[3]uint8]keyFeature, error) {
+	keys := make([]string, 0, len(colors))
+	for k := range colors {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	features := make(map[[3]uint8]keyFeature, len(colors))
+	for _, k := range keys {
+		rgb, err := strconv.ParseUint(strings.TrimPrefix(k, "#"), 16, 32)
+		if !strings.HasPrefix(k, "#") || len(k) != 7 || err != nil {
+			return nil, fmt.Errorf("\"generator.key_colors\" key %q must be a #rrggbb colour", k)
+		}
+		feature := keyNone
+		for i, name := range KeyFeatureNames[1:] {
+			if colors[k] == name {
+				feature = keyFeature(i + 1)
+			}
+		}
+		if feature == keyNone {
+			return nil, fmt.Errorf("\"generator.key_colors\" (%q) for %s must be one of: %s", colors[k], k, strings.Join(KeyFeatureNames[1:], ", "))
+		}
+		c := [3]uint8{uint8(rgb >> 16), uint8(rgb >> 8), uint8(rgb)}
+		if _, ok := impassable[c]; ok {
+			return nil, fmt.Errorf("\"generator.key_colors\" colour %s is also in \"generator.impassable_colors\"", k)
+		}
+		if c[0] == 0 && c[1] == 0 && c[2] == 0 {
+			return nil, fmt.Errorf("\"generator.key_colors\" colour %s is pure black, which is always the void", k)
+		}
+		features[c] = feature
+	}
+	return features, nil
+}
+
+// keyTerrain returns the terrain of a pixel of a key colour: water for ocean,
+// lake and river keys, plains for spawn markers. Inherit pixels are water until
+// resolveAmbiguousCoast replaces them.
+func keyTerrain(feature keyFeature) Terrain {
+	switch feature {
+	case keySpawn:
+		return Terrain{Type: Land, Key: feature}
+	case keyInherit:
+		return Terrain{Type: Water}
+	}
+	return Terrain{Type: Water, Key: feature}
+}
+
+// waterBodyKeys reports whether a water body holds ocean, lake or river key
+// tiles.
+func waterBodyKeys(terrain *terrainGrid, coords []Coord) (ocean, lake, river bool) {
+	for _, c := range coords {
+		switch terrain.at(c.X, c.Y).Key {
+		case KeyOcean:
+			ocean = true
+		case KeyLake:
+			lake = true
+		case keyRiver:
+			river = true
+		}
+	}
+	return ocean, lake, river
+}
+
+// spawnMarkersLayer lists the spawns marked with a "spawn" key colour, for
+// the server to prefer over its own spawn search.
+var spawnMarkersLayer = auxLayer{
+	Name:      "spawn_markers",
+	File:      "spawn_markers.json",
+	TileBytes: 0.01,
+	Summary:   "spawns marked with a key colour in image.png",
+	Build: func(ctx context.Context, in *layerInput) ([]byte, map[string]any, error) {
+		markers := findSpawnMarkers(in.Terrain)
+		data, err := json.MarshalIndent(struct {
+			Markers []spawnMarker `json:"markers"`
+		}{markers}, "", "  ")
+		if err != nil {
+			return nil, nil, err
+		}
+		LoggerFromContext(ctx).Debug(fmt.Sprintf("Spawn markers: %d", len(markers)))
+		return data, map[string]any{"markers": len(markers)}, nil
+	},
+}
+
+// spawnMarker is a spawn marked in image.png, in full-scale tile
+// coordinates.
+type spawnMarker struct {
+	X     int `json:"x"`
+	Y     int `json:"y"`
+	Tiles int `json:"tiles"`
+}
+
+// findSpawnMarkers returns one marker per 4-connected blob of spawn key
+// tiles still land after processing, at the blob's tile nearest to its
+// centroid, ordered top to bottom and left to right.
+func findSpawnMarkers(terrain *terrainGrid) []spawnMarker {
+	width := terrain.Width
+	height := terrain.Height
+	isMarker := func(x, y int) bool {
+		return terrain.at(x, y).Key == keySpawn && terrain.at(x, y).Type == Land
+	}
+	visited := make([]bool, width*height)
+	markers := []spawnMarker{}
+	var blob []Coord
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if visited[y*width+x] || !isMarker(x, y) {
+				continue
+			}
+			visited[y*width+x] = true
+			blob = append(blob[:0], Coord{X: x, Y: y})
+			sumX, sumY := 0, 0
+			for i := 0; i < len(blob); i++ {
+				c := blob[i]
+				sumX += c.X
+				sumY += c.Y
+				for _, d := range [4][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+					nx, ny := c.X+d[0], c.Y+d[1]
+					if nx < 0 || ny < 0 || nx >= width || ny >= height || visited[ny*width+nx] || !isMarker(nx, ny) {
+						continue
+					}
+					visited[ny*width+nx] = true
+					blob = append(blob, Coord{X: nx, Y: ny})
+				}
+			}
+			cx, cy := float64(sumX)/float64(len(blob)), float64(sumY)/float64(len(blob))
+			best, bestDist := blob[0], -1.0
+			for _, c := range blob {
+				dx, dy := float64(c.X)-cx, float64(c.Y)-cy
+				if d := dx*dx + dy*dy; bestDist < 0 || d < bestDist {
+					best, bestDist = c, d
+				}
+			}
+			markers = append(markers, spawnMarker{X: best.X, Y: best.Y, Tiles: len(blob)})
+		}
+	}
+	return markers
+}
@@ -0,0 +1,109 @@
+package mapgen
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapformat"
+)
+
+// BasisEncoder is the command that encodes the Basis Universal texture
+// layers: toktx, of the Khronos KTX-Software tools. The generator has no
+// encoder of its own, so the layers fail to build when it is not on PATH.
+const BasisEncoder = "toktx"
+
+// renderLightMipsLayer and renderDarkMipsLayer are the render layers as KTX2
+// textures for the WebGL renderer, GPU-compressed with Basis Universal
+// UASTC and supercompressed with zstd, with the mini maps as mip levels.
+// The client transcodes UASTC to the block format of the GPU, BC7 or ASTC,
+// which takes 1 byte per texel instead of the 4 of RGBA. The manifest
+// records the format, supercompression, number of levels, theme and
+// theme_version.
+var (
+	renderLightMipsLayer = renderMipsLayer("light")
+	renderDarkMipsLayer  = renderMipsLayer("dark")
+)
+
+// renderMipsLayer returns the KTX2 render layer of a theme of renderThemes.
+func renderMipsLayer(theme string) auxLayer {
+	return auxLayer{
+		Name:      "render_" + theme + "_mips",
+		File:      "render_" + theme + ".ktx2",
+		TileBytes: 1.5,
+		Summary:   "Basis Universal KTX2 texture of the terrain and mini maps in the in-game " + theme + " theme",
+		Build: func(ctx context.Context, in *layerInput) ([]byte, map[string]any, error) {
+			width := in.Terrain.Width
+			height := in.Terrain.Height
+			var levels []*image.RGBA
+			for _, terrain := range []*terrainGrid{in.Terrain, in.Terrain4x, in.Terrain16x} {
+				packed, _ := packTerrain(ctx, terrain, mapformat.LatestTileFormat)
+				levels = append(levels, &image.RGBA{
+					Pix:    renderPacked(packed, renderThemes[theme]),
+					Stride: 4 * terrain.Width,
+					Rect:   image.Rect(0, 0, terrain.Width, terrain.Height),
+				})
+			}
+			data, err := encodeBasisKTX2(ctx, levels)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to encode texture: %w", err)
+			}
+			LoggerFromContext(ctx).Debug(fmt.Sprintf("Encoded %d texture levels in the %s theme into %d bytes", len(levels), theme, len(data)))
+			return data, map[string]any{
+				"width":            width,
+				"height":           height,
+				"levels":           len(levels),
+				"format":           "UASTC",
+				"supercompression": "zstd",
+				"theme":            theme,
+				"theme_version":    renderThemeVersion,
+			}, nil
+		},
+	}
+}
+
+// encodeBasisKTX2 encodes a KTX2 texture in Basis Universal UASTC with the
+// given mip levels, each half the size of the previous one, by running
+// BasisEncoder on them as PNG files. The mini maps halve the dimensions of
+// the map exactly, so they make a partial mip chain that the renderer can
+// sample from directly. The sRGB transfer function is assigned, as the
+// levels hold display colours.
+func encodeBasisKTX2(ctx context.Context, levels []*image.RGBA) ([]byte, error) {
+	encoder, err := exec.LookPath(BasisEncoder)
+	if err != nil {
+		return nil, fmt.Errorf("%s, of KTX-Software (https://github.com/KhronosGroup/KTX-Software), must be on PATH to encode Basis Universal textures: %w", BasisEncoder, err)
+	}
+	dir, err := os.MkdirTemp("", "mapgen-ktx2-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "texture.ktx2")
+	args := []string{
+		"--t2", "--encode", "uastc", "--uastc_quality", "2", "--zcmp", "19",
+		"--assign_oetf", "srgb", "--target_type", "RGBA",
+		"--mipmap", "--levels", strconv.Itoa(len(levels)), out,
+	}
+	for i, level := range levels {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, level); err != nil {
+			return nil, err
+		}
+		path := filepath.Join(dir, fmt.Sprintf("level%d.png", i))
+		if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			return nil, err
+		}
+		args = append(args, path)
+	}
+	if output, err := exec.CommandContext(ctx, encoder, args...).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("%s failed: %w: %s", BasisEncoder, err, bytes.TrimSpace(output))
+	}
+	return os.ReadFile(out)
+}
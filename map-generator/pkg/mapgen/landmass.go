@@ -0,0 +1,199 @@
+package mapgen
+
+import (
+	"sort"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapformat"
+)
+
+// MapStats summarises the land of the full-scale terrain after water
+// processing. It feeds manifest fields derived from the geography.
+type MapStats struct {
+	LandTiles      int
+	WaterTiles     int
+	ShorelineTiles int   // land tiles adjacent to water
+	LandmassSizes  []int // tile count of each connected landmass, largest first
+	// RemovedIslands and RemovedLakes count the bodies smaller than
+	// "generator.min_island_size" and "generator.min_lake_size" removed
+	// before measuring.
+	RemovedIslands int
+	RemovedLakes   int
+	// AmbiguousCoastPixels counts the source pixels antialiasing left
+	// between water and land, see resolveAmbiguousCoast.
+	AmbiguousCoastPixels int
+}
+
+// LargestLandmassShare returns the fraction of land in the largest landmass.
+func (s MapStats) LargestLandmassShare() float64 {
+	if s.LandTiles == 0 || len(s.LandmassSizes) == 0 {
+		return 0
+	}
+	return float64(s.LandmassSizes[0]) / float64(s.LandTiles)
+}
+
+// LandInLandmassesOfAtLeast returns the number of land tiles in landmasses of
+// at least minSize tiles.
+func (s MapStats) LandInLandmassesOfAtLeast(minSize int) int {
+	total := 0
+	for _, size := range s.LandmassSizes {
+		if size < minSize {
+			break
+		}
+		total += size
+	}
+	return total
+}
+
+// computeMapStats measures the landmasses of a processed terrain grid.
+// Shoreline flags must already be set by processWater.
+func computeMapStats(terrain *terrainGrid, wrapX bool, scratch *floodScratch) MapStats {
+	width := terrain.Width
+	height := terrain.Height
+	visited := scratch.visitedFor(width * height)
+
+	var stats MapStats
+	scratch.area = scratch.area[:0]
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			tile := *terrain.at(x, y)
+			if tile.Type == Water {
+				stats.WaterTiles++
+			}
+			if tile.Type != Land {
+				continue
+			}
+			stats.LandTiles++
+			if tile.Shoreline {
+				stats.ShorelineTiles++
+			}
+			if visited.has(y*width + x) {
+				continue
+			}
+			start := len(scratch.area)
+			scratch.area = getArea(x, y, terrain, wrapX, visited, scratch.area)
+			stats.LandmassSizes = append(stats.LandmassSizes, len(scratch.area)-start)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(stats.LandmassSizes)))
+	return stats
+}
+
+// componentLabels assigns every tile of one terrain type to its connected
+// component (a landmass or a water body).
+type componentLabels struct {
+	// Labels holds the component index of each tile, indexed y*width+x, or
+	// -1 for tiles of other types.
+	Labels []int32
+	Sizes  []int // tile count of each component, by index
+}
+
+// SizeAt returns the size of the component containing tile i (indexed
+// y*width+x), or 0 if the tile is of another type.
+func (l *componentLabels) SizeAt(i int) int {
+	if l.Labels[i] < 0 {
+		return 0
+	}
+	return l.Sizes[l.Labels[i]]
+}
+
+// labelComponents labels the connected components of tiles of type t,
+// joined across the west/east seam if wrapX is true.
+func labelComponents(terrain *terrainGrid, t TerrainType, wrapX bool, scratch *floodScratch) *componentLabels {
+	width := terrain.Width
+	height := terrain.Height
+	visited := scratch.visitedFor(width * height)
+
+	l := &componentLabels{Labels: make([]int32, width*height)}
+	for i := range l.Labels {
+		l.Labels[i] = -1
+	}
+	scratch.area = scratch.area[:0]
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			if terrain.at(x, y).Type != t || visited.has(y*width+x) {
+				continue
+			}
+			scratch.area = getArea(x, y, terrain, wrapX, visited, scratch.area[:0])
+			label := int32(len(l.Sizes))
+			for _, c := range scratch.area {
+				l.Labels[c.Y*width+c.X] = label
+			}
+			l.Sizes = append(l.Sizes, len(scratch.area))
+		}
+	}
+	return l
+}
+
+// BodySizes measures the landmasses and lakes of a packed map with the
+// labelling the generator uses, joined across the west/east seam if wrapX
+// is true, and returns their sizes, largest first. Lakes are the water
+// bodies outside the ocean.
+func BodySizes(gm *mapformat.Map, wrapX bool) (landmasses, lakes []int) {
+	if gm.Width == 0 || gm.Height == 0 {
+		return nil, nil
+	}
+	terrain := newTerrainGrid(gm.Width, gm.Height)
+	for i, t := range gm.Tiles {
+		tile := &terrain.Tiles[i]
+		switch {
+		case t.IsImpassable():
+			tile.Type = Impassable
+		case t.IsLand():
+			tile.Type = Land
+		default:
+			tile.Type = Water
+			tile.Ocean = t.IsOcean()
+		}
+	}
+	scratch := newFloodScratch(gm.Width * gm.Height)
+	landmasses = labelComponents(terrain, Land, wrapX, scratch).Sizes
+	water := labelComponents(terrain, Water, wrapX, scratch)
+	ocean := make([]bool, len(water.Sizes))
+	for i, tile := range terrain.Tiles {
+		if label := water.Labels[i]; label >= 0 && tile.Ocean {
+			ocean[label] = true
+		}
+	}
+	for label, size := range water.Sizes {
+		if !ocean[label] {
+			lakes = append(lakes, size)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(landmasses)))
+	sort.Sort(sort.Reverse(sort.IntSlice(lakes)))
+	return landmasses, lakes
+}
+
+// landDistanceToCoast returns, for every tile indexed y*width+x, the number
+// of steps over land from the nearest shoreline land tile (0 on the coast),
+// or -1 for tiles that are not land or whose landmass has no coast. If
+// wrapX is true, steps continue across the west/east seam.
+func landDistanceToCoast(terrain *terrainGrid, wrapX bool) []int32 {
+	width := terrain.Width
+	height := terrain.Height
+	dist := make([]int32, width*height)
+	queue := make([]Coord, 0, width*height/8)
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			dist[y*width+x] = -1
+			if terrain.at(x, y).Type == Land && terrain.at(x, y).Shoreline {
+				dist[y*width+x] = 0
+				queue = append(queue, Coord{X: x, Y: y})
+			}
+		}
+	}
+	var buf [4]Coord
+	for head := 0; head < len(queue); head++ {
+		c := queue[head]
+		d := dist[c.Y*width+c.X]
+		n := neighborCoordsWrap(c.X, c.Y, width, height, wrapX, &buf)
+		for _, nc := range buf[:n] {
+			i := nc.Y*width + nc.X
+			if dist[i] < 0 && terrain.at(nc.X, nc.Y).Type == Land {
+				dist[i] = d + 1
+				queue = append(queue, nc)
+			}
+		}
+	}
+	return dist
+}
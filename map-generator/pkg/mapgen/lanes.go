@@ -0,0 +1,347 @@
+package mapgen
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// laneClusterSize is the side, in tiles, of the grid cells used to group
+// coastal water into port clusters.
+const laneClusterSize = 64
+
+// lanesFileVersion is written in the header of lanes.bin and bumped whenever
+// its layout changes.
+const lanesFileVersion = 1
+
+// lanesLayer bakes ocean shipping lanes between coastal clusters, so trade
+// ships can follow precomputed paths instead of searching the full-scale map.
+var lanesLayer = auxLayer{
+	Name:      "lanes",
+	File:      "lanes.bin",
+	TileBytes: 1,
+	Summary:   "shipping lane graph between coastal clusters",
+	Build:     buildLanes,
+}
+
+// Moves between 4-neighbour tiles, as stored in lane paths.
+const (
+	moveRight byte = iota // +x
+	moveLeft              // -x
+	moveDown              // +y
+	moveUp                // -y
+)
+
+// oceanVoronoi is the result of a multi-source BFS over water: every water
+// tile reachable from a seed records the owner of its nearest seed, the
+// distance to it, and the move that reached it, which together form a
+// shortest-path tree rooted at the seeds.
+type oceanVoronoi struct {
+	Owner []int32 // owner of the nearest seed, or -1; indexed y*width+x
+	Dist  []int32
+	Move  []byte // move from the previous tile on the path from the seed
+
+	width, height int
+	wrapX         bool // moves continue across the west/east seam
+}
+
+// computeOceanVoronoi runs a multi-source BFS over water tiles from seeds,
+// where owners[i] labels seeds[i]. Seeds may be of any terrain type; the
+// search only expands into water. If wrapX is true, it continues across the
+// west/east seam.
+func computeOceanVoronoi(terrain *terrainGrid, seeds []Coord, owners []int32, wrapX bool) *oceanVoronoi {
+	width := terrain.Width
+	height := terrain.Height
+	v := &oceanVoronoi{
+		Owner:  make([]int32, width*height),
+		Dist:   make([]int32, width*height),
+		Move:   make([]byte, width*height),
+		width:  width,
+		height: height,
+		wrapX:  wrapX,
+	}
+	for i := range v.Owner {
+		v.Owner[i] = -1
+	}
+	queue := make([]Coord, 0, len(seeds))
+	for i, c := range seeds {
+		v.Owner[c.Y*width+c.X] = owners[i]
+		queue = append(queue, c)
+	}
+	var buf [4]Coord
+	for head := 0; head < len(queue); head++ {
+		c := queue[head]
+		i := c.Y*width + c.X
+		n := neighborCoordsWrap(c.X, c.Y, width, height, wrapX, &buf)
+		for _, nb := range buf[:n] {
+			if terrain.at(nb.X, nb.Y).Type != Water {
+				continue
+			}
+			j := nb.Y*width + nb.X
+			if v.Owner[j] >= 0 {
+				continue
+			}
+			v.Owner[j] = v.Owner[i]
+			v.Dist[j] = v.Dist[i] + 1
+			v.Move[j] = moveBetween(c, nb)
+			queue = append(queue, nb)
+		}
+	}
+	return v
+}
+
+// moveBetween returns the move from a to its neighbour b. On maps that wrap,
+// stepping east from the last column to the first is a move right.
+func moveBetween(a, b Coord) byte {
+	switch dx := b.X - a.X; {
+	case b.Y > a.Y:
+		return moveDown
+	case b.Y < a.Y:
+		return moveUp
+	case dx == 1 || dx < -1:
+		return moveRight
+	default:
+		return moveLeft
+	}
+}
+
+// pathFromOwner returns the moves leading from the nearest seed of c to c.
+func (v *oceanVoronoi) pathFromOwner(c Coord) []byte {
+	moves := make([]byte, 0, v.Dist[c.Y*v.width+c.X])
+	for v.Dist[c.Y*v.width+c.X] > 0 {
+		moves = append(moves, v.Move[c.Y*v.width+c.X])
+		c = v.walkBack(c, 1)
+	}
+	for i, j := 0, len(moves)-1; i < j; i, j = i+1, j-1 {
+		moves[i], moves[j] = moves[j], moves[i]
+	}
+	return moves
+}
+
+// walkBack returns the tile reached by following the shortest-path tree
+// from c towards its nearest seed for up to steps moves.
+func (v *oceanVoronoi) walkBack(c Coord, steps int) Coord {
+	for ; steps > 0 && v.Dist[c.Y*v.width+c.X] > 0; steps-- {
+		switch v.Move[c.Y*v.width+c.X] {
+		case moveRight:
+			c.X--
+		case moveLeft:
+			c.X++
+		case moveDown:
+			c.Y--
+		case moveUp:
+			c.Y++
+		}
+		if v.wrapX {
+			c.X = (c.X + v.width) % v.width
+		}
+	}
+	return c
+}
+
+// reverseMoves returns the moves that walk path backwards.
+func reverseMoves(path []byte) []byte {
+	out := make([]byte, len(path))
+	for i, move := range path {
+		out[len(path)-1-i] = move ^ 1 // right<->left, down<->up
+	}
+	return out
+}
+
+// oceanEdge is an edge between two owners whose Voronoi regions touch.
+type oceanEdge struct {
+	A, B   int32
+	Length int32
+	// CrossA and CrossB are the adjacent tiles, owned by A and B, where the
+	// shortest path between the regions crosses from one to the other.
+	CrossA, CrossB Coord
+}
+
+// edges returns one edge, with the shortest crossing, for every pair of
+// owners whose regions share a border, sorted by owner. On maps that wrap,
+// regions also border across the west/east seam.
+func (v *oceanVoronoi) edges() []oceanEdge {
+	width, height := v.width, v.height
+	best := make(map[[2]int32]oceanEdge)
+	consider := func(a, b Coord) {
+		i, j := a.Y*width+a.X, b.Y*width+b.X
+		oa, ob := v.Owner[i], v.Owner[j]
+		if oa < 0 || ob < 0 || oa == ob {
+			return
+		}
+		if oa > ob {
+			oa, ob, a, b, i, j = ob, oa, b, a, j, i
+		}
+		length := v.Dist[i] + 1 + v.Dist[j]
+		key := [2]int32{oa, ob}
+		if e, ok := best[key]; !ok || length < e.Length {
+			best[key] = oceanEdge{A: oa, B: ob, Length: length, CrossA: a, CrossB: b}
+		}
+	}
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			if x+1 < width {
+				consider(Coord{x, y}, Coord{x + 1, y})
+			} else if v.wrapX && width > 2 {
+				consider(Coord{x, y}, Coord{0, y})
+			}
+			if y+1 < height {
+				consider(Coord{x, y}, Coord{x, y + 1})
+			}
+		}
+	}
+	edges := make([]oceanEdge, 0, len(best))
+	for _, e := range best {
+		edges = append(edges, e)
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].A != edges[j].A {
+			return edges[i].A < edges[j].A
+		}
+		return edges[i].B < edges[j].B
+	})
+	return edges
+}
+
+// path returns the moves of the shortest path along e from seed A to B.
+func (v *oceanVoronoi) path(e oceanEdge) []byte {
+	moves := append(v.pathFromOwner(e.CrossA), moveBetween(e.CrossA, e.CrossB))
+	return append(moves, reverseMoves(v.pathFromOwner(e.CrossB))...)
+}
+
+// coastalClusters groups the shoreline water tiles of each water body by
+// size×size grid cell and returns one anchor per group: the tile closest to
+// the group's centroid. Anchors are ordered by cell, row-major.
+func coastalClusters(terrain *terrainGrid, waterBodies *componentLabels, size int) []Coord {
+	width := terrain.Width
+	height := terrain.Height
+	type group struct {
+		cell, body int
+		sumX, sumY float64
+		tiles      []Coord
+	}
+	cellsX := (width + size - 1) / size
+	groups := make(map[[2]int]*group)
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			tile := *terrain.at(x, y)
+			if tile.Type != Water || !tile.Shoreline {
+				continue
+			}
+			cell := (y/size)*cellsX + x/size
+			body := int(waterBodies.Labels[y*width+x])
+			key := [2]int{cell, body}
+			g, ok := groups[key]
+			if !ok {
+				g = &group{cell: cell, body: body}
+				groups[key] = g
+			}
+			g.sumX += float64(x)
+			g.sumY += float64(y)
+			g.tiles = append(g.tiles, Coord{X: x, Y: y})
+		}
+	}
+	sorted := make([]*group, 0, len(groups))
+	for _, g := range groups {
+		sorted = append(sorted, g)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].cell != sorted[j].cell {
+			return sorted[i].cell < sorted[j].cell
+		}
+		return sorted[i].body < sorted[j].body
+	})
+	anchors := make([]Coord, len(sorted))
+	for i, g := range sorted {
+		cx, cy := g.sumX/float64(len(g.tiles)), g.sumY/float64(len(g.tiles))
+		bestDist := math.Inf(1)
+		for _, t := range g.tiles {
+			if d := math.Hypot(float64(t.X)-cx, float64(t.Y)-cy); d < bestDist {
+				bestDist = d
+				anchors[i] = t
+			}
+		}
+	}
+	return anchors
+}
+
+// encodeMoves run-length encodes a path: each byte holds a move in its top
+// two bits and the run length minus one (1-64) in the low six bits.
+func encodeMoves(moves []byte) []byte {
+	var out []byte
+	for i := 0; i < len(moves); {
+		run := 1
+		for i+run < len(moves) && moves[i+run] == moves[i] && run < 64 {
+			run++
+		}
+		out = append(out, moves[i]<<6|byte(run-1))
+		i += run
+	}
+	return out
+}
+
+// buildLanes writes the lane graph of a map. Nodes are port clusters: one
+// anchor water tile per water body per laneClusterSize cell of coast. Two
+// nodes are joined when their regions of nearest water touch, with the
+// shortest ocean path between them, so shortest routes between any ports
+// can be found with Dijkstra on this small graph and followed tile by tile.
+//
+// lanes.bin is little-endian:
+//
+//	"OFLN", u8 version
+//	u32 node count, then per node: u16 x, u16 y
+//	u32 edge count, then per edge: u32 node a, u32 node b, u32 length in
+//	    tiles, u32 encoded path size, encoded path (see encodeMoves) from a
+//	    to b
+//
+// On maps that wrap, paths may cross the west/east seam: a move right from
+// the last column leads to the first, and a move left from the first to the
+// last.
+func buildLanes(ctx context.Context, in *layerInput) ([]byte, map[string]any, error) {
+	terrain := in.Terrain
+	width := terrain.Width
+	height := terrain.Height
+	if width > math.MaxUint16+1 || height > math.MaxUint16+1 {
+		return nil, nil, fmt.Errorf("map is %dx%d, lanes support at most 65536 tiles per side", width, height)
+	}
+
+	anchors := coastalClusters(terrain, in.WaterBodies(), laneClusterSize)
+	owners := make([]int32, len(anchors))
+	for i := range owners {
+		owners[i] = int32(i)
+	}
+	voronoi := computeOceanVoronoi(terrain, anchors, owners, in.WrapX)
+	edges := voronoi.edges()
+
+	var buf bytes.Buffer
+	buf.WriteString("OFLN")
+	buf.WriteByte(lanesFileVersion)
+	le := binary.LittleEndian
+	buf.Write(le.AppendUint32(nil, uint32(len(anchors))))
+	for _, a := range anchors {
+		buf.Write(le.AppendUint16(nil, uint16(a.X)))
+		buf.Write(le.AppendUint16(nil, uint16(a.Y)))
+	}
+	buf.Write(le.AppendUint32(nil, uint32(len(edges))))
+	pathTiles := 0
+	for _, e := range edges {
+		encoded := encodeMoves(voronoi.path(e))
+		buf.Write(le.AppendUint32(nil, uint32(e.A)))
+		buf.Write(le.AppendUint32(nil, uint32(e.B)))
+		buf.Write(le.AppendUint32(nil, uint32(e.Length)))
+		buf.Write(le.AppendUint32(nil, uint32(len(encoded))))
+		buf.Write(encoded)
+		pathTiles += int(e.Length)
+	}
+
+	LoggerFromContext(ctx).Debug(fmt.Sprintf("Lanes: %d nodes, %d edges covering %d tiles in %d bytes", len(anchors), len(edges), pathTiles, buf.Len()))
+	return buf.Bytes(), map[string]any{
+		"version":      lanesFileVersion,
+		"cluster_size": laneClusterSize,
+		"nodes":        len(anchors),
+		"edges":        len(edges),
+	}, nil
+}
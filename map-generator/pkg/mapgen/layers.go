@@ -0,0 +1,198 @@
+package mapgen
+
+import (
+	"context"
+	"fmt"
+)
+
+// auxLayer is an optional per-map output derived from the processed
+// terrain, such as data used by the server's AI. Layers are opt-in
+// via --layers so that the default build only writes what the client loads.
+type auxLayer struct {
+	Name    string
+	File    string
+	Summary string
+	// TileBytes is a generous estimate of the size of File, in bytes per
+	// full-scale tile, for the disk space check before a run. Files of a
+	// fixed size per tile give it exactly; graphs and JSON files a bound
+	// real maps stay well within.
+	TileBytes float64
+	// Build returns the file contents and any extra fields for the layer's
+	// entry in the manifest "layers" section.
+	Build func(ctx context.Context, in *layerInput) (data []byte, meta map[string]any, err error)
+}
+
+// AuxLayers lists every layer the generator can build, in build order.
+var AuxLayers = []auxLayer{
+	spawnWeightsLayer,
+	fertilityLayer,
+	biomesLayer,
+	lanesLayer,
+	tradeMatrixLayer,
+	islandGraphLayer,
+	islandGraphDotLayer,
+	continentsLayer,
+	strategicLayer,
+	hpaLandLayer,
+	hpaWaterLayer,
+	navigationLayer,
+	currentsLayer,
+	currentsPreviewLayer,
+	depthBandsLayer,
+	salinityLayer,
+	isometricPreviewLayer,
+	territoriesLayer,
+	defensibilityLayer,
+	defensibilityPreviewLayer,
+	ridgesLayer,
+	spawnMarkersLayer,
+	movementCostLayer,
+	visibilityLayer,
+	renderLightLayer,
+	renderDarkLayer,
+	renderLightMipsLayer,
+	renderDarkMipsLayer,
+}
+
+// layerInput is the data shared by the layers of one map. Derived data that
+// several layers need is computed on first use and cached.
+type layerInput struct {
+	Name       string
+	Terrain    *terrainGrid // full scale, after water processing
+	Terrain4x  *terrainGrid
+	Terrain16x *terrainGrid
+	WrapX      bool // the map wraps horizontally, see GeneratorConfig.WrapX
+	Stats      MapStats
+	Scratch    *floodScratch
+	Info       []byte            // info.json as strict JSON
+	Inputs     map[string][]byte // auxiliary input files, see AuxInputFiles
+	Geo        *GeoReference     // the map's place on the globe, nil without "geo"
+	Config     GeneratorConfig   // the resolved "generator" section
+
+	landmasses    *componentLabels
+	waterBodies   *componentLabels
+	coastDistance []int32
+	islandGraph   *islandGraph
+	continents    *continentLabels
+	currents      [][2]float64
+	salinity      *WaterSalinity
+	defensibility *defensibilityScores
+	ridges        *ridgeNetwork
+}
+
+// Salinity returns the salt and fresh water bodies, see classifySalinity.
+func (in *layerInput) Salinity() *WaterSalinity {
+	if in.salinity == nil {
+		in.salinity = classifySalinity(in.Terrain, in.WaterBodies(), in.WrapX)
+	}
+	return in.salinity
+}
+
+// Currents returns the ocean current field, see buildCurrentField.
+func (in *layerInput) Currents() [][2]float64 {
+	if in.currents == nil {
+		in.currents = buildCurrentField(in.Terrain, in.Name, in.WrapX)
+	}
+	return in.currents
+}
+
+// Ridges returns the mountain ridges and passes of the full-scale map, see
+// detectRidges. With "generator.impassable_ridges" they are detected before
+// the ridges are made impassable.
+func (in *layerInput) Ridges() *ridgeNetwork {
+	if in.ridges == nil {
+		in.ridges = detectRidges(in.Terrain, in.WrapX)
+	}
+	return in.ridges
+}
+
+// Defensibility returns the defensibility scores of the full-scale map, see
+// computeDefensibility.
+func (in *layerInput) Defensibility() *defensibilityScores {
+	if in.defensibility == nil {
+		in.defensibility = computeDefensibility(in.Terrain, in.CoastDistance(), in.WrapX)
+	}
+	return in.defensibility
+}
+
+// Continents returns the continents of the map, see labelContinents.
+func (in *layerInput) Continents(ctx context.Context) (*continentLabels, error) {
+	if in.continents == nil {
+		continents, err := labelContinents(ctx, in)
+		if err != nil {
+			return nil, err
+		}
+		in.continents = continents
+	}
+	return in.continents, nil
+}
+
+// IslandGraph returns the landmass adjacency graph, see buildIslandGraph.
+func (in *layerInput) IslandGraph() *islandGraph {
+	if in.islandGraph == nil {
+		in.islandGraph = buildIslandGraph(in)
+	}
+	return in.islandGraph
+}
+
+// Landmasses returns the connected landmasses of the terrain.
+func (in *layerInput) Landmasses() *componentLabels {
+	if in.landmasses == nil {
+		in.landmasses = labelComponents(in.Terrain, Land, in.WrapX, in.Scratch)
+	}
+	return in.landmasses
+}
+
+// WaterBodies returns the connected water bodies of the terrain.
+func (in *layerInput) WaterBodies() *componentLabels {
+	if in.waterBodies == nil {
+		in.waterBodies = labelComponents(in.Terrain, Water, in.WrapX, in.Scratch)
+	}
+	return in.waterBodies
+}
+
+// CoastDistance returns the land distance of every tile to the coast, see
+// landDistanceToCoast.
+func (in *layerInput) CoastDistance() []int32 {
+	if in.coastDistance == nil {
+		in.coastDistance = landDistanceToCoast(in.Terrain, in.WrapX)
+	}
+	return in.coastDistance
+}
+
+// LayerOutput is a generated auxiliary layer.
+type LayerOutput struct {
+	Name string
+	File string
+	Data []byte
+	Meta map[string]any
+}
+
+// FindAuxLayer returns the layer with the given name, or nil.
+func FindAuxLayer(name string) *auxLayer {
+	for i := range AuxLayers {
+		if AuxLayers[i].Name == name {
+			return &AuxLayers[i]
+		}
+	}
+	return nil
+}
+
+// buildLayers builds the named layers for one map.
+func buildLayers(ctx context.Context, names []string, in *layerInput) ([]LayerOutput, error) {
+	logger := LoggerFromContext(ctx)
+	outputs := make([]LayerOutput, 0, len(names))
+	for _, name := range names {
+		layer := FindAuxLayer(name)
+		if layer == nil {
+			return nil, fmt.Errorf("unknown layer %q", name)
+		}
+		logger.Debug(fmt.Sprintf("Building layer %s", name))
+		data, meta, err := layer.Build(ctx, in)
+		if err != nil {
+			return nil, fmt.Errorf("layer %s: %w", name, err)
+		}
+		outputs = append(outputs, LayerOutput{Name: name, File: layer.File, Data: data, Meta: meta})
+	}
+	return outputs, nil
+}
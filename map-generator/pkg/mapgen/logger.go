@@ -0,0 +1,36 @@
+package mapgen
+
+// The generator logs through the slog.Logger carried by its context, which
+// the map-generator command sets up with its multi-level and flag-based
+// logging. The tags below let that logging filter the generator's messages.
+
+import (
+	"context"
+	"log/slog"
+)
+
+// PerformanceLogTag is a slog attribute used to tag performance-related log messages.
+var PerformanceLogTag = slog.String("tag", "performance")
+
+// RemovalLogTag is a slog attribute used to tag land/water removal-related log messages.
+var RemovalLogTag = slog.String("tag", "removal")
+
+// ResultLogTag is a slog attribute used to tag the one-line result of each map
+// and the run summary, which --quiet keeps.
+var ResultLogTag = slog.String("tag", "result")
+
+type loggerKey struct{}
+
+// LoggerFromContext retrieves the logger from the context.
+// If no logger is found, it returns the default logger.
+func LoggerFromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// ContextWithLogger returns a new context with the provided logger.
+func ContextWithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
@@ -0,0 +1,1421 @@
+// Package mapgen is the OpenFront map generator: it turns a map's image.png
+// and info.json into its packed map.bin, map4x.bin and map16x.bin, its WebP
+// thumbnail and the sections of its manifest computed from the terrain. The
+// map-generator command wraps it with the reading and writing of map folders,
+// and its wasm build runs it in the browser to preview custom maps.
+//
+// A map is generated with
+//
+//	config, err := mapgen.ParseGeneratorConfig(info)
+//	result, err := mapgen.GenerateMap(ctx, mapgen.GeneratorArgs{
+//		Name: "mymap", ImageBuffer: image, RemoveSmall: true, Info: info, Config: config,
+//	})
+//
+// Thumbnails are encoded with libwebp through cgo; builds without cgo, such
+// as GOOS=js GOARCH=wasm, encode them losslessly in pure Go instead.
+package mapgen
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"log/slog"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapformat"
+)
+
+const (
+	// GeneratorVersion identifies the generation algorithm. It is recorded in
+	// each manifest and must be bumped whenever a change alters generated
+	// output, so that unchanged maps built by an older generator are rebuilt.
+	GeneratorVersion = 24
+	// The smallest a body of land or lake can be by default, all smaller are
+	// removed; see "generator.min_island_size" and "generator.min_lake_size"
+	defaultMinIslandSize = 30
+	MinLakeSize          = 200
+	// the recommended max area pixel size for input images
+	MinRecommendedPixelSize = 2000000
+	MaxRecommendedPixelSize = 3000000
+	// the recommended max number of land tiles in the output bin at full size
+	maxRecommendedLandTileCount = 3000000
+)
+
+// Holds raw RGBA image data for the thumbnail
+type ThumbData struct {
+	Data   []byte
+	Width  int
+	Height int
+}
+
+// XY coord, origin top left, x extending right, y extends down
+type Coord struct {
+	X, Y int
+}
+
+// TerrainType represents the classification of a map tile (e.g., Land or Water).
+type TerrainType uint8
+
+// Enumeration of possible TerrainType values.
+const (
+	Land TerrainType = iota
+	Water
+	Impassable
+)
+
+// Terrain represents the properties of a single map tile.
+// Magnitude represents elevation for Land (0-30) or distance to land for Water.
+// Fields are ordered to minimise alignment padding: float64 first (8 bytes,
+// offset 0), then seven 1-byte fields, giving 16 bytes total vs 24 with the
+// original layout.
+type Terrain struct {
+	Magnitude float64
+	Type      TerrainType
+	Shoreline bool
+	Ocean     bool
+	Kind      ImpassableKind // what an Impassable tile shows
+	Key       keyFeature     // the feature its key colour marks, if any
+	Biome     Biome          // the biome of a Land tile, see classifyBiome
+	River     bool           // whether a Water tile is a river, see detectRivers
+}
+
+// MapResult is the output format from the GenerateMap workflow
+type MapResult struct {
+	Thumbnail  []byte
+	Map        MapInfo
+	Map4x      MapInfo
+	Map16x     MapInfo
+	Stats      MapStats // measured on the full-scale map
+	Continents []Continent
+	Cities     []City
+	Spawns     []SpawnPoint
+	Geo        *GeoReference // georeferencing of the generated map, nil without "geo"
+	Salinity   *WaterSalinity
+	Layers     []LayerOutput
+	TileFormat mapformat.TileFormat // layout of the packed maps, for the manifest "tile_format"
+}
+
+// MapInfo contains the serialized map data and metadata for a specific scale.
+type MapInfo struct {
+	Data         []byte // packed map data
+	Width        int
+	Height       int
+	NumLandTiles int
+}
+
+// GeneratorArgs defines the input parameters for the map generation process.
+type GeneratorArgs struct {
+	Name        string
+	ImageBuffer []byte
+	RemoveSmall bool
+	Layers      []string          // auxiliary layers to build, see AuxLayers
+	Info        []byte            // info.json as strict JSON, used by layers
+	Inputs      map[string][]byte // auxiliary input files, see AuxInputFiles
+	Config      GeneratorConfig
+	Strict      bool                 // log lints, such as antialiased coast pixels, as warnings, for --strict to fail the map on
+	TileFormat  mapformat.TileFormat // layout of the packed maps, mapformat.TileFormat1 if zero
+}
+
+// GenerateMap is the main map-generator workflow.
+//   - Maps each pixel to a Terrain type based on its blue value
+//   - Removes small islands and lakes
+//   - Creates a WebP thumbnail
+//   - Packs the map data into binary format for full scale, 1/4 tile count (half dimensions), and 1/16 tile count (quarter dimensions)
+//
+// Red/green pixel values have no impact on the terrain, only blue values are used;
+// they paint the biome of land tiles, see classifyBiome.
+// For Land tiles, "Magnitude" is determined by `(Blue - 140) / 2“.
+// "generator.water_blue" and "generator.elevation" change the water key and this curve, see elevationConfig;
+// "generator.min_island_size", "generator.min_lake_size" and "generator.remove_small" the removal of small bodies.
+// For Water tiles, "Magnitude" is calculated during generation as the distance to the nearest land.
+// With "generator.water_depth" set to "bathymetry", it comes from the map's bathymetry.png instead, see applyBathymetry.
+// With "generator.projection" set, georeferenced images are first reprojected, see ReprojectMapImages.
+// With "generator.impassable_ridges" set, mountain ridges become impassable after water processing, see detectRidges.
+// With "generator.archipelago" set, channels are carved through large landmasses before water processing, see carveArchipelago.
+// Maps with a palette.json map the colours of their pixels to terrain instead of this table, see ParsePalette.
+// Maps with a heightmap.png or heightmap.tif take land, water and magnitude from its elevations instead, see readHeightmap;
+// their image.png, which they may omit, then only marks impassable and key colours.
+//
+// Pixel -> Terrain & Magnitude mapping
+// | Input Condition    | Terrain Type     | Magnitude          | Notes                            |
+// | :----------------- | :--------------- | :----------------- | :------------------------------- |
+// | **Alpha < 20**     | Water            | Distance to Land\* | Transparent pixels become water. |
+// | **Blue = 106**     | Water            | Distance to Land\* | Specific key color for water.    |
+// | **#000 (black)**   | Impassable       | 31 (fixed)         | Solid void; cannot be owned/attacked/nuked. |
+// | **Blue < 140**     | Land (Plains)    | 0                  | Clamped to minimum magnitude.    |
+// | **Blue 140 - 158** | Land (Plains)    | 0 - 9              | 					 					 					 		|
+// | **Blue 159 - 178** | Land (Highland)  | 10 - 19            | 					 					 					 		|
+// | **Blue 179 - 200** | Land (Mountain)  | 20 - 30            | 				 					 					 			|
+// | **Blue > 200**     | Land (Mountain)  | 30                 | Clamped to maximum magnitude.    |
+//
+// Impassable terrain is encoded in the binary format as isLand=1 + magnitude=31.
+// It renders as the map background colour (making the map appear non-rectangular)
+// and cannot be owned, attacked, or nuked. Nuke trajectories cannot cross it.
+// Other impassable surfaces, such as ice sheets or lava fields, come from the
+// colours of "generator.impassable_colors" or the masks of impassableMaskFiles
+// and keep their ImpassableKind in the packed tiles of mapformat.TileFormat2.
+//
+// Misc Notes
+//   - It normalizes map width/height to multiples of 4 for the mini map downscaling.
+//   - It checks ctx between passes, and the long passes (pixel classification,
+//     the flood fills, the distance transform and packing) stop early once ctx
+//     is done, so a cancelled generation returns ctx.Err() within one pass.
+func GenerateMap(ctx context.Context, args GeneratorArgs) (MapResult, error) {
+	logger := LoggerFromContext(ctx)
+	tileFormat := args.TileFormat
+	if tileFormat == 0 {
+		tileFormat = mapformat.TileFormat1
+	}
+	if !tileFormat.Valid() {
+		return MapResult{}, fmt.Errorf("unknown tile format %d, the latest is %d", tileFormat, mapformat.LatestTileFormat)
+	}
+	heights, err := readHeightmap(args.Inputs)
+	if err != nil {
+		return MapResult{}, err
+	}
+	var img image.Image
+	if len(args.ImageBuffer) == 0 && heights != nil {
+		// A transparent image of the heightmap's size, so that every tile
+		// takes its terrain from the heightmap.
+		img = image.NewNRGBA(image.Rect(0, 0, heights.Width, heights.Height))
+	} else if img, err = png.Decode(bytes.NewReader(args.ImageBuffer)); err != nil {
+		return MapResult{}, fmt.Errorf("failed to decode PNG: %w", err)
+	}
+	riversSettings := defaultRiversConfig()
+	if args.Config.Rivers != nil {
+		riversSettings = *args.Config.Rivers
+	}
+	heightmapSettings := defaultHeightmapConfig()
+	if args.Config.Heightmap != nil {
+		heightmapSettings = *args.Config.Heightmap
+	}
+	geo, err := ParseGeoReference(args.Info)
+	if err != nil {
+		return MapResult{}, err
+	}
+	if projection := args.Config.Projection; projection != ProjectionSource {
+		if heights != nil {
+			return MapResult{}, fmt.Errorf("maps with a heightmap cannot be reprojected, export the heightmap in the %s projection instead", projection)
+		}
+		if geo == nil {
+			return MapResult{}, fmt.Errorf("\"generator.projection\" is %q but info.json has no \"geo\" section", projection)
+		}
+		if projection != geo.Projection {
+			target := &GeoReference{BBox: geo.BBox, Projection: projection}
+			if err := target.Validate(); err != nil {
+				return MapResult{}, fmt.Errorf("cannot reproject to %s: %w", projection, err)
+			}
+			img, args.Inputs, err = ReprojectMapImages(ctx, img, args.Inputs, geo, target)
+			if err != nil {
+				return MapResult{}, err
+			}
+			geo = target
+		}
+	}
+
+	problems := problemsFromContext(ctx)
+	if problems != nil {
+		problems.Image = img
+	}
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	wrapX := args.Config.WrapX
+	waterBlue := args.Config.WaterBlue
+	if wrapX && width%4 != 0 {
+		// Cropping columns would break the seam between the east and west
+		// edges, and the mini maps must halve the width exactly to wrap too.
+		return MapResult{}, fmt.Errorf("maps that wrap horizontally must be a multiple of 4 pixels wide, %s is %d", args.Name, width)
+	}
+
+	// Ensure width and height are multiples of 4 for the mini map downscaling
+	width = width - (width % 4)
+	height = height - (height % 4)
+
+	logger.Info(fmt.Sprintf("Processing Map: %s, dimensions: %dx%d", args.Name, width, height))
+	logger.Debug(fmt.Sprintf("Water blue %d, land magnitude %s, small body removal %v (islands under %d tiles, lakes under %d)",
+		waterBlue, args.Config.Elevation.formula(), args.RemoveSmall && args.Config.RemoveSmall, args.Config.MinIslandSize, args.Config.MinLakeSize))
+
+	area := width * height
+	if area < MinRecommendedPixelSize || area > MaxRecommendedPixelSize {
+		logger.Debug(fmt.Sprintf("Map area %d pixels is outside recommended range (%d - %d)", area, MinRecommendedPixelSize, MaxRecommendedPixelSize), PerformanceLogTag)
+	}
+
+	// Initialize terrain grid
+	terrain := newTerrainGrid(width, height)
+
+	impassableColors, err := ParseImpassableColors(args.Config.ImpassableColors)
+	if err != nil {
+		return MapResult{}, err
+	}
+	keyColors, err := ParseKeyColors(args.Config.KeyColors, impassableColors)
+	if err != nil {
+		return MapResult{}, err
+	}
+	palette, err := ParsePalette(args.Inputs)
+	if err != nil {
+		return MapResult{}, err
+	}
+	if heights != nil {
+		if palette != nil {
+			return MapResult{}, fmt.Errorf("maps with a heightmap cannot have a %s: land and water come from the heightmap", PaletteFile)
+		}
+		if heights.Width != bounds.Dx() || heights.Height != bounds.Dy() {
+			logger.Debug(fmt.Sprintf("Resampling the %dx%d heightmap to the %dx%d image", heights.Width, heights.Height, bounds.Dx(), bounds.Dy()))
+			heights = heights.resample(bounds.Dx(), bounds.Dy())
+		}
+	}
+	if cropped := croppedLandPixels(img, width, height, palette, waterBlue); cropped > 0 {
+		logger.Warn(fmt.Sprintf("Cropping the %dx%d image to %dx%d, a multiple of 4, removed %d land pixel(s) from its right and bottom edges", bounds.Dx(), bounds.Dy(), width, height, cropped))
+	}
+
+	// Process each pixel, recording the pixels antialiasing may have
+	// blended for resolveAmbiguousCoast
+	coastKinds := make([]uint8, width*height)
+	unlistedColors := 0
+	for y := 0; y < height && ctx.Err() == nil; y++ {
+		for x := 0; x < width; x++ {
+			tile := terrain.at(x, y)
+			r, g, b, a := img.At(x, y).RGBA()
+			// Convert from 16-bit to 8-bit values
+			red := uint8(r >> 8)
+			green := uint8(g >> 8)
+			blue := uint8(b >> 8)
+			alpha := uint8(a >> 8)
+
+			if kind, ok := impassableColors[[3]uint8{red, green, blue}]; ok && alpha >= 20 {
+				// Configured impassable colour, such as an ice sheet
+				*tile = Terrain{Type: Impassable, Kind: kind}
+				coastKinds[y*width+x] = classifyCoastPixel(blue, alpha, waterBlue)
+			} else if feature, ok := keyColors[[3]uint8{red, green, blue}]; ok && alpha >= 20 {
+				// Key colour of a special feature, such as a forced ocean
+				*tile = keyTerrain(feature)
+				if feature == keyInherit {
+					coastKinds[y*width+x] = pixelInherit
+				}
+			} else if heights != nil && (alpha < 20 || red != 0 || green != 0 || blue != 0) {
+				// Elevation from the heightmap, which replaces the blue
+				// channel; only black stays impassable.
+				*tile = heights.terrain(x, y, heightmapSettings)
+				if alpha >= 20 {
+					tile.Biome = classifyBiome(red, green)
+				}
+			} else if palette != nil {
+				// Colour listed in palette.json, or its nearest. Blue means
+				// nothing here, so only transparency makes a pixel ambiguous:
+				// the water blue itself is never near the water blue.
+				var match uint8
+				*tile, match = palette.terrain([4]uint8{red, green, blue, alpha})
+				if match == paletteNearest {
+					unlistedColors++
+				}
+				if tile.Type != Water {
+					coastKinds[y*width+x] = classifyCoastPixel(uint8(waterBlue), alpha, waterBlue)
+				}
+			} else if alpha < 20 || int(blue) == waterBlue {
+				// Transparent or specific blue value = water
+				*tile = Terrain{Type: Water}
+			} else if red == 0 && green == 0 && blue == 0 {
+				// Pure black (#000) = impassable terrain
+				*tile = Terrain{Type: Impassable}
+				coastKinds[y*width+x] = classifyCoastPixel(blue, alpha, waterBlue)
+			} else {
+				// Land
+				*tile = Terrain{Type: Land}
+				coastKinds[y*width+x] = classifyCoastPixel(blue, alpha, waterBlue)
+
+				// Calculate magnitude from blue channel (140-200 range by default)
+				tile.Magnitude = args.Config.Elevation.magnitude(blue)
+				tile.Biome = classifyBiome(red, green)
+			}
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return MapResult{}, err
+	}
+	explainer := explainerFromContext(ctx)
+	if unlistedColors > 0 {
+		logger.Debug(fmt.Sprintf("%d pixel(s) have colours not listed in %s and took the terrain of the nearest listed colour", unlistedColors, PaletteFile))
+	}
+	explainer.classify(img, width, height, impassableColors, keyColors, palette, heights, heightmapSettings, waterBlue, args.Config.Elevation, terrain)
+	// Image data is no longer needed; release it for GC.
+	img = nil
+	heights = nil
+	args.ImageBuffer = nil
+
+	ambiguousCoastPixels := resolveAmbiguousCoast(ctx, terrain, coastKinds, args.Config.CoastResolution, wrapX)
+	explainer.after("coast resolution", terrain)
+	if ambiguousCoastPixels > 0 && args.Config.CoastResolution == coastCutoff {
+		// A warning under --strict, which fails maps on any warning
+		level := slog.LevelDebug
+		if args.Strict {
+			level = slog.LevelWarn
+		}
+		logger.Log(ctx, level, fmt.Sprintf("%d pixel(s) look antialiased between water and land; set \"generator.coast_resolution\" to %q to resolve them by their neighbours", ambiguousCoastPixels, coastMajority))
+	}
+	coastKinds = nil
+	masked, err := applyImpassableMasks(terrain, args.Inputs)
+	if err != nil {
+		return MapResult{}, err
+	}
+	if masked > 0 {
+		logger.Debug(fmt.Sprintf("Made %d tile(s) impassable from the impassable masks", masked))
+	}
+	explainer.after("impassable masks", terrain)
+	if dithered := ditherPlains(terrain, args.Name, args.Config.PlainsDither); dithered > 0 {
+		logger.Debug(fmt.Sprintf("Dithered the magnitude of %d plains tile(s)", dithered))
+	}
+	explainer.after("plains dither", terrain)
+
+	if err := ctx.Err(); err != nil {
+		return MapResult{}, err
+	}
+
+	// Flood-fill buffers sized for the full-scale grid, reused by every pass
+	// at every scale below.
+	scratch := newFloodScratch(width * height)
+
+	if args.Config.Archipelago != nil {
+		spawns, err := nationSpawns(args.Info)
+		if err != nil {
+			return MapResult{}, err
+		}
+		carveArchipelago(ctx, terrain, args.Config.Archipelago, args.Name, spawns, wrapX, scratch)
+		explainer.after("archipelago channels", terrain)
+	}
+
+	var bathymetry image.Image
+	if args.Config.WaterDepth == waterDepthBathymetry {
+		bathymetry, err = auxGrayImage(args.Inputs, "bathymetry.png", width, height)
+		if err != nil {
+			return MapResult{}, err
+		}
+		if bathymetry == nil {
+			return MapResult{}, fmt.Errorf("\"generator.water_depth\" is %q but the map has no bathymetry.png", waterDepthBathymetry)
+		}
+	}
+
+	removeSmall := args.RemoveSmall && args.Config.RemoveSmall
+	if !removeSmall {
+		explainer.logf("small islands and lakes are kept: their removal is off for this map")
+	}
+	removedIslands := removeSmallIslands(ctx, terrain, args.Config.MinIslandSize, removeSmall, wrapX, scratch)
+	explainer.after("small island removal", terrain)
+	if removeSmall && riversSettings.Keep {
+		keepRivers(ctx, terrain, riversSettings, args.Config.MinLakeSize, wrapX, scratch)
+		explainer.after("river retention", terrain)
+	}
+	if err := ctx.Err(); err != nil {
+		return MapResult{}, err
+	}
+	removedLakes := processWater(ctx, terrain, removeSmall, args.Config.MinLakeSize, wrapX, scratch)
+	explainer.after("water processing (small lakes, shorelines, distance to land)", terrain)
+	if err := ctx.Err(); err != nil {
+		return MapResult{}, err
+	}
+	detectRivers(ctx, terrain, riversSettings, wrapX, scratch)
+	if bathymetry != nil {
+		applyBathymetry(ctx, terrain, bathymetry, 1)
+		explainer.after("bathymetry", terrain)
+	}
+	var ridges *ridgeNetwork
+	if args.Config.ImpassableRidges {
+		ridges = detectRidges(terrain, wrapX)
+		flagged := flagRidgesImpassable(terrain, ridges)
+		logger.Debug(fmt.Sprintf("Made %d tile(s) of %d ridge(s) impassable, leaving %d pass(es)", flagged, len(ridges.Ridges), len(ridges.Passes)))
+		explainer.after("impassable ridges", terrain)
+	}
+	// Water adjacent to impassable terrain should be deep (no depth gradient),
+	// just like water at the map edge.  Override the BFS-calculated magnitude
+	// so these tiles render as the deepest shade.
+	setImpassableNeighborWaterDepth(ctx, terrain, wrapX)
+	explainer.after("deep water next to impassable terrain", terrain)
+	stats := computeMapStats(terrain, wrapX, scratch)
+	stats.RemovedIslands, stats.RemovedLakes = removedIslands, removedLakes
+	stats.AmbiguousCoastPixels = ambiguousCoastPixels
+	recordUnreachableLand(problems, terrain, wrapX, scratch)
+	recordNationSpawns(problems, terrain, args.Info)
+	if err := ctx.Err(); err != nil {
+		return MapResult{}, err
+	}
+
+	// Problems are recorded and tiles explained in full-scale tiles only.
+	miniCtx := ContextWithExplainer(ContextWithProblems(ctx, nil), nil)
+	terrain4x := createMiniMap(terrain, args.Config.MinimapAggregation)
+	removeSmallIslands(miniCtx, terrain4x, args.Config.MinIslandSize/2, removeSmall, wrapX, scratch)
+	processWater(miniCtx, terrain4x, false, 0, wrapX, scratch)
+	if bathymetry != nil {
+		applyBathymetry(ctx, terrain4x, bathymetry, 2)
+	}
+	setImpassableNeighborWaterDepth(ctx, terrain4x, wrapX)
+
+	terrain16x := createMiniMap(terrain4x, args.Config.MinimapAggregation)
+	processWater(miniCtx, terrain16x, false, 0, wrapX, scratch)
+	if bathymetry != nil {
+		applyBathymetry(ctx, terrain16x, bathymetry, 4)
+	}
+	setImpassableNeighborWaterDepth(ctx, terrain16x, wrapX)
+	if err := ctx.Err(); err != nil {
+		return MapResult{}, err
+	}
+
+	analysis := &layerInput{
+		Name:       args.Name,
+		Terrain:    terrain,
+		Terrain4x:  terrain4x,
+		Terrain16x: terrain16x,
+		WrapX:      wrapX,
+		Stats:      stats,
+		Scratch:    scratch,
+		Info:       args.Info,
+		Inputs:     args.Inputs,
+		Geo:        geo,
+		Config:     args.Config,
+		ridges:     ridges,
+	}
+	continents, err := analysis.Continents(ctx)
+	if err != nil {
+		return MapResult{}, err
+	}
+	cities, err := placeCities(ctx, analysis)
+	if err != nil {
+		return MapResult{}, err
+	}
+	spawnPoints, err := placeSpawns(ctx, analysis)
+	if err != nil {
+		return MapResult{}, err
+	}
+	layers, err := buildLayers(ctx, args.Layers, analysis)
+	if err != nil {
+		return MapResult{}, err
+	}
+	if err := ctx.Err(); err != nil {
+		return MapResult{}, err
+	}
+
+	// The thumbnail and the three packed scales only read the finished
+	// grids, so they are built concurrently.
+	var (
+		wg                                               sync.WaitGroup
+		webp                                             []byte
+		thumbErr                                         error
+		mapData, mapData4x, mapData16x                   []byte
+		mapNumLandTiles, numLandTiles4x, numLandTiles16x int
+	)
+	wg.Add(4)
+	go func() {
+		defer wg.Done()
+		thumb := createMapThumbnail(ctx, terrain4x, 0.5)
+		webp, thumbErr = convertToWebP(ThumbData{
+			Data:   thumb.Pix,
+			Width:  thumb.Bounds().Dx(),
+			Height: thumb.Bounds().Dy(),
+		})
+	}()
+	go func() {
+		defer wg.Done()
+		mapData, mapNumLandTiles = packTerrain(ctx, terrain, tileFormat)
+	}()
+	go func() {
+		defer wg.Done()
+		mapData4x, numLandTiles4x = packTerrain(ctx, terrain4x, tileFormat)
+	}()
+	go func() {
+		defer wg.Done()
+		mapData16x, numLandTiles16x = packTerrain(ctx, terrain16x, tileFormat)
+	}()
+	wg.Wait()
+	terrain, terrain4x, terrain16x = nil, nil, nil
+	if err := ctx.Err(); err != nil {
+		return MapResult{}, err
+	}
+	if thumbErr != nil {
+		return MapResult{}, fmt.Errorf("failed to save thumbnail: %w", thumbErr)
+	}
+	explainer.packed(tileFormat,
+		MapInfo{Data: mapData, Width: width, Height: height},
+		MapInfo{Data: mapData4x, Width: width / 2, Height: height / 2},
+		MapInfo{Data: mapData16x, Width: width / 4, Height: height / 4},
+	)
+
+	logger.Debug(fmt.Sprintf("Land Tile Count (1x): %d", mapNumLandTiles))
+	logger.Debug(fmt.Sprintf("Land Tile Count (4x): %d", numLandTiles4x))
+	logger.Debug(fmt.Sprintf("Land Tile Count (16x): %d", numLandTiles16x))
+
+	if mapNumLandTiles == 0 {
+		return MapResult{}, fmt.Errorf("Map has 0 land tiles")
+	}
+	if mapNumLandTiles > maxRecommendedLandTileCount {
+		logger.Debug(fmt.Sprintf("Map has more land tiles (%d) than recommended maximum (%d)", mapNumLandTiles, maxRecommendedLandTileCount), PerformanceLogTag)
+	}
+
+	return MapResult{
+		Map: MapInfo{
+			Data:         mapData,
+			Width:        width,
+			Height:       height,
+			NumLandTiles: mapNumLandTiles,
+		},
+		Map4x: MapInfo{
+			Data:         mapData4x,
+			Width:        width / 2,
+			Height:       height / 2,
+			NumLandTiles: numLandTiles4x,
+		},
+		Map16x: MapInfo{
+			Data:         mapData16x,
+			Width:        width / 4,
+			Height:       height / 4,
+			NumLandTiles: numLandTiles16x,
+		},
+		Thumbnail:  webp,
+		Stats:      stats,
+		Continents: continents.Continents,
+		Cities:     cities,
+		Spawns:     spawnPoints,
+		Geo:        geo,
+		Salinity:   analysis.Salinity(),
+		Layers:     layers,
+		TileFormat: tileFormat,
+	}, nil
+}
+
+// convertToWebP encodes raw RGBA thumbnail data into WebP format.
+func convertToWebP(thumb ThumbData) ([]byte, error) {
+	// Create RGBA image from raw data
+	img := image.NewRGBA(image.Rect(0, 0, thumb.Width, thumb.Height))
+
+	// Copy the raw RGBA data
+	if len(thumb.Data) != thumb.Width*thumb.Height*4 {
+		return nil, fmt.Errorf("invalid thumb data length: expected %d, got %d",
+			thumb.Width*thumb.Height*4, len(thumb.Data))
+	}
+
+	copy(img.Pix, thumb.Data)
+
+	webpData, err := encodeWebP(img)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode WebP: %w", err)
+	}
+
+	return webpData, nil
+}
+
+// croppedLandPixels counts the pixels of img outside the width×height map,
+// cropped to a multiple of 4, that would have been land.
+func croppedLandPixels(img image.Image, width, height int, palette *colorPalette, waterBlue int) int {
+	b := img.Bounds()
+	count := 0
+	for x := 0; x < b.Dx(); x++ {
+		top := 0
+		if x < width {
+			top = height // only the bottom rows are cropped from this column
+		}
+		for y := top; y < b.Dy(); y++ {
+			r, g, bl, a := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+			red, green, blue, alpha := uint8(r>>8), uint8(g>>8), uint8(bl>>8), uint8(a>>8)
+			if palette != nil {
+				if t, _ := palette.terrain([4]uint8{red, green, blue, alpha}); t.Type == Land {
+					count++
+				}
+			} else if alpha >= 20 && int(blue) != waterBlue && (red != 0 || green != 0 || blue != 0) {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// terrainGrid is a width×height terrain grid stored row-major, tile (x, y)
+// at Tiles[y*Width+x]: the order of the source image and of the packed
+// outputs. The buffers that go with a grid, such as visited sets, labels
+// and distances, are indexed the same way, and the passes that touch each
+// tile independently split its rows between goroutines.
+type terrainGrid struct {
+	Width, Height int
+	Tiles         []Terrain
+}
+
+// newTerrainGrid returns a width×height grid of zero tiles.
+func newTerrainGrid(width, height int) *terrainGrid {
+	return &terrainGrid{Width: width, Height: height, Tiles: make([]Terrain, width*height)}
+}
+
+// at returns the tile at (x, y).
+func (g *terrainGrid) at(x, y int) *Terrain {
+	return &g.Tiles[y*g.Width+x]
+}
+
+// createMiniMap downscales the terrain grid by half.
+// It maps 2x2 blocks of input tiles to a single output tile.
+// Priority: Water > Impassable > Land. Water always wins so that narrow
+// rivers inside or bordering impassable terrain are preserved on the minimap
+// (the pathfinder runs on the minimap and needs accurate water bodies).
+// The magnitude of a Land output tile is aggregated from the Land tiles of
+// its block as selected by aggregation (see minimapAggregations).
+func createMiniMap(tm *terrainGrid, aggregation string) *terrainGrid {
+	miniMap := newTerrainGrid(tm.Width/2, tm.Height/2)
+	parallelSpans(miniMap.Height, tm.Width*tm.Height, func(y0, y1 int) {
+		for miniY := y0; miniY < y1; miniY++ {
+			for miniX := 0; miniX < miniMap.Width; miniX++ {
+				dst := miniMap.at(miniX, miniY)
+				// The block is read column by column, so that of two land
+				// tiles the later one, in that order, sets the output.
+				for _, d := range [4][2]int{{0, 0}, {0, 1}, {1, 0}, {1, 1}} {
+					src := *tm.at(2*miniX+d[0], 2*miniY+d[1])
+					// Water wins over everything — narrow rivers must be
+					// preserved for pathfinding accuracy.
+					if dst.Type == Water {
+						break
+					}
+					// Impassable wins over land; once set, keep it.
+					if dst.Type == Impassable && src.Type != Water {
+						continue
+					}
+					*dst = src
+				}
+			}
+		}
+	})
+
+	if aggregation != aggregateSample {
+		aggregateMiniMapMagnitudes(tm, miniMap, aggregation)
+	}
+	return miniMap
+}
+
+// aggregateMiniMapMagnitudes sets the magnitude of every Land tile of miniMap
+// to the average, max or median magnitude of the Land tiles of its 2x2
+// source block.
+func aggregateMiniMapMagnitudes(tm, miniMap *terrainGrid, aggregation string) {
+	var mags [4]float64
+	for miniY := 0; miniY < miniMap.Height; miniY++ {
+		for miniX := 0; miniX < miniMap.Width; miniX++ {
+			dst := miniMap.at(miniX, miniY)
+			if dst.Type != Land {
+				continue
+			}
+			n := 0
+			for _, src := range [4]Terrain{*tm.at(2*miniX, 2*miniY), *tm.at(2*miniX, 2*miniY+1), *tm.at(2*miniX+1, 2*miniY), *tm.at(2*miniX+1, 2*miniY+1)} {
+				if src.Type == Land {
+					mags[n] = src.Magnitude
+					n++
+				}
+			}
+			values := mags[:n]
+			sort.Float64s(values)
+			switch aggregation {
+			case aggregateAverage:
+				sum := 0.0
+				for _, v := range values {
+					sum += v
+				}
+				dst.Magnitude = sum / float64(n)
+			case aggregateMax:
+				dst.Magnitude = values[n-1]
+			case aggregateMedian:
+				dst.Magnitude = (values[(n-1)/2] + values[n/2]) / 2
+			}
+		}
+	}
+}
+
+// processShore identifies shoreline tiles by checking adjacency.
+// It marks Land tiles as shoreline if they neighbor Water, and Water tiles as
+// shoreline if they neighbor Land.
+// Returns a list of coordinates for all shoreline Water tiles found.
+func processShore(ctx context.Context, terrain *terrainGrid, wrapX bool, scratch *floodScratch) []Coord {
+	logger := LoggerFromContext(ctx)
+	logger.Info("Identifying shorelines")
+	width := terrain.Width
+	height := terrain.Height
+
+	// Every span of rows lists its own shoreline water, in row order.
+	spans := make(map[int][]Coord)
+	var mu sync.Mutex
+	parallelSpans(height, width*height, func(y0, y1 int) {
+		var shore []Coord
+		var buf [4]Coord
+		for y := y0; y < y1; y++ {
+			for x := 0; x < width; x++ {
+				tile := terrain.at(x, y)
+				tile.Shoreline = false
+				n := neighborCoordsWrap(x, y, width, height, wrapX, &buf)
+
+				if tile.Type == Land {
+					// Land tile adjacent to water is shoreline
+					for _, c := range buf[:n] {
+						if terrain.at(c.X, c.Y).Type == Water {
+							tile.Shoreline = true
+							break
+						}
+					}
+				} else if tile.Type == Water {
+					// Water tile adjacent to land is shoreline
+					for _, c := range buf[:n] {
+						if terrain.at(c.X, c.Y).Type == Land {
+							tile.Shoreline = true
+							shore = append(shore, Coord{X: x, Y: y})
+							break
+						}
+					}
+				}
+				// Impassable tiles: never shoreline (renders as background, no outline)
+			}
+		}
+		mu.Lock()
+		spans[y0] = shore
+		mu.Unlock()
+	})
+
+	shorelineWaters := scratch.shore[:0]
+	for y := 0; y < height; y++ {
+		shorelineWaters = append(shorelineWaters, spans[y]...)
+	}
+	scratch.shore = shorelineWaters
+	return shorelineWaters
+}
+
+// processDistToLand calculates the distance of water tiles from the nearest land.
+// The distance is the 3-4 chamfer distance to the nearest shoreline water
+// tile, measured through water and land but never through impassable
+// terrain, and is stored in the Magnitude field of the Water tiles.
+//
+// Rather than a BFS it runs a two-pass distance transform over the whole
+// grid: a forward sweep propagating distances from the row to the north and
+// the tile to the west, then a backward sweep from the row to the south and
+// the tile to the east. Orthogonal steps cost 3 and diagonal steps 4, so the
+// distance is within about 8% of the Euclidean one and is sub-tile: a tile
+// one diagonal step from the shore is 4/3 tiles away. With only land and
+// water on the map a single pair of sweeps is exact, because the shortest
+// path from a water tile to its nearest shoreline water tile never has to
+// cross land. Impassable tiles act as barriers that a shortest path may
+// have to bend around, so in that case the sweeps are repeated until the
+// field stops changing. Water tiles that cannot reach any shoreline keep
+// their existing magnitude. On maps that wrap horizontally (wrapX) the
+// sweeps also read across the west/east seam and are repeated until the
+// field stops changing, as paths may cross the seam.
+func processDistToLand(ctx context.Context, shorelineWaters []Coord, terrain *terrainGrid, wrapX bool, scratch *floodScratch) {
+	logger := LoggerFromContext(ctx)
+	logger.Info("Setting Water tiles magnitude = chamfer distance from nearest land")
+
+	width := terrain.Width
+	height := terrain.Height
+	tiles := terrain.Tiles
+
+	dist := scratch.distFor(width * height)
+	for i := range dist {
+		dist[i] = unreachedDist
+	}
+	for _, coord := range shorelineWaters {
+		dist[coord.Y*width+coord.X] = 0
+	}
+
+	hasBarriers := false
+	for i := range tiles {
+		if tiles[i].Type == Impassable {
+			hasBarriers = true
+			break
+		}
+	}
+
+	for {
+		changed := false
+		// Forward pass: the row to the north and the tile to the west.
+		for y := 0; y < height; y++ {
+			row := y * width
+			for x := 0; x < width; x++ {
+				i := row + x
+				if tiles[i].Type == Impassable {
+					continue
+				}
+				best := dist[i]
+				if y > 0 {
+					best = relaxChamfer(dist[row-width:row], x, wrapX, best)
+				}
+				if x > 0 {
+					best = min(best, dist[i-1]+chamferOrthogonal)
+				} else if wrapX {
+					best = min(best, dist[row+width-1]+chamferOrthogonal)
+				}
+				if best < dist[i] {
+					dist[i] = best
+					changed = true
+				}
+			}
+		}
+		// Backward pass: the row to the south and the tile to the east.
+		for y := height - 1; y >= 0; y-- {
+			row := y * width
+			for x := width - 1; x >= 0; x-- {
+				i := row + x
+				if tiles[i].Type == Impassable {
+					continue
+				}
+				best := dist[i]
+				if y < height-1 {
+					best = relaxChamfer(dist[row+width:row+2*width], x, wrapX, best)
+				}
+				if x < width-1 {
+					best = min(best, dist[i+1]+chamferOrthogonal)
+				} else if wrapX {
+					best = min(best, dist[row]+chamferOrthogonal)
+				}
+				if best < dist[i] {
+					dist[i] = best
+					changed = true
+				}
+			}
+		}
+		if !(hasBarriers || wrapX) || !changed || ctx.Err() != nil {
+			break
+		}
+	}
+
+	parallelSpans(height, width*height, func(y0, y1 int) {
+		for i := y0 * width; i < y1*width; i++ {
+			if tiles[i].Type == Water && dist[i] < unreachedDist {
+				tiles[i].Magnitude = float64(dist[i]) / chamferOrthogonal
+			}
+		}
+	})
+}
+
+// unreachedDist is the distance of the tiles processDistToLand has not
+// reached. It leaves room for a step cost to be added without overflowing.
+const unreachedDist = math.MaxInt32 / 2
+
+// Chamfer step costs of processDistToLand: 3 for an orthogonal step and 4,
+// close to 3√2, for a diagonal one.
+const (
+	chamferOrthogonal = 3
+	chamferDiagonal   = 4
+)
+
+// relaxChamfer returns the smaller of best and the distance through the
+// tiles of an adjacent row next to column x, joining the ends of the row if
+// wrapX is set. Impassable tiles keep unreachedDist, far above any real
+// distance, so they never win.
+func relaxChamfer(row []int32, x int, wrapX bool, best int32) int32 {
+	width := len(row)
+	best = min(best, row[x]+chamferOrthogonal)
+	if x > 0 {
+		best = min(best, row[x-1]+chamferDiagonal)
+	} else if wrapX {
+		best = min(best, row[width-1]+chamferDiagonal)
+	}
+	if x < width-1 {
+		best = min(best, row[x+1]+chamferDiagonal)
+	} else if wrapX {
+		best = min(best, row[0]+chamferDiagonal)
+	}
+	return best
+}
+
+// setImpassableNeighborWaterDepth forces water tiles adjacent to impassable
+// terrain to deep-water magnitude.  Without this, the processDistToLand BFS
+// assigns them a shallow magnitude (close to "land"), producing a visible
+// depth gradient next to impassable terrain.  Impassable terrain is void —
+// like the map edge — so the water beside it should be uniformly deep.
+func setImpassableNeighborWaterDepth(ctx context.Context, terrain *terrainGrid, wrapX bool) {
+	width := terrain.Width
+	height := terrain.Height
+	const deepMagnitude = 20 // packed as 10 (÷2), matches max render depth
+
+	parallelSpans(height, width*height, func(y0, y1 int) {
+		var buf [4]Coord
+		for y := y0; y < y1; y++ {
+			for x := 0; x < width; x++ {
+				tile := terrain.at(x, y)
+				if tile.Type != Water {
+					continue
+				}
+				n := neighborCoordsWrap(x, y, width, height, wrapX, &buf)
+				for _, c := range buf[:n] {
+					if terrain.at(c.X, c.Y).Type == Impassable {
+						tile.Magnitude = deepMagnitude
+						break
+					}
+				}
+			}
+		}
+	})
+}
+
+// neighborCoords fills out with the valid orthogonal neighbours of (x, y) and
+// returns the count. out must be a caller-allocated [4]Coord buffer; by
+// reusing the same buffer across calls the caller avoids any heap allocation.
+// Neighbours that would fall outside [0,width) × [0,height) are omitted, so
+// the count is 2 at corners, 3 on edges, and 4 in the interior.
+func neighborCoords(x, y, width, height int, out *[4]Coord) int {
+	n := 0
+	if x > 0 {
+		out[n] = Coord{X: x - 1, Y: y}
+		n++
+	}
+	if x < width-1 {
+		out[n] = Coord{X: x + 1, Y: y}
+		n++
+	}
+	if y > 0 {
+		out[n] = Coord{X: x, Y: y - 1}
+		n++
+	}
+	if y < height-1 {
+		out[n] = Coord{X: x, Y: y + 1}
+		n++
+	}
+	return n
+}
+
+// neighborCoordsWrap is neighborCoords for maps that may wrap horizontally:
+// when wrapX is set, tiles on the west and east edges are also neighbours of
+// each other.
+func neighborCoordsWrap(x, y, width, height int, wrapX bool, out *[4]Coord) int {
+	n := neighborCoords(x, y, width, height, out)
+	if wrapX && width > 2 {
+		if x == 0 {
+			out[n] = Coord{X: width - 1, Y: y}
+			n++
+		} else if x == width-1 {
+			out[n] = Coord{X: 0, Y: y}
+			n++
+		}
+	}
+	return n
+}
+
+// processWater identifies and processes bodies of water in the terrain.
+// It finds all connected water bodies and marks the largest one as Ocean.
+// If removeSmall is true, lakes smaller than minLakeSize are converted to Land.
+// Finally, it triggers shoreline identification and distance-to-land calculations.
+// If wrapX is true, the map wraps horizontally: the west and east edges are
+// adjacent for every step. It returns the number of lakes removed.
+func processWater(ctx context.Context, terrain *terrainGrid, removeSmall bool, minLakeSize int, wrapX bool, scratch *floodScratch) int {
+	logger := LoggerFromContext(ctx)
+	logger.Info("Processing water bodies")
+	width := terrain.Width
+	height := terrain.Height
+	visited := scratch.visitedFor(width * height)
+
+	// Clear any Ocean flags inherited from a previous scale's struct copy.
+	for i := range terrain.Tiles {
+		terrain.Tiles[i].Ocean = false
+	}
+
+	var waterBodies []areaSpan
+
+	// Find all distinct water bodies
+	scratch.area = scratch.area[:0]
+	for x := 0; x < width && ctx.Err() == nil; x++ {
+		for y := 0; y < height; y++ {
+			if terrain.at(x, y).Type == Water {
+				if visited.has(y*width + x) {
+					continue
+				}
+
+				start := len(scratch.area)
+				scratch.area = getArea(x, y, terrain, wrapX, visited, scratch.area)
+				waterBodies = append(waterBodies, areaSpan{start: start, size: len(scratch.area) - start})
+			}
+		}
+	}
+
+	// Sort by size (largest first)
+	sort.SliceStable(waterBodies, func(i, j int) bool {
+		return waterBodies[i].size > waterBodies[j].size
+	})
+
+	// The largest water body is the ocean, unless a lake key marks it a
+	// lake; ocean keys make their bodies ocean too. Bodies with any key,
+	// river keys included, are never removed.
+	ocean := make([]bool, len(waterBodies))
+	keyed := make([]bool, len(waterBodies))
+	oceanTiles := 0
+	for w, body := range waterBodies {
+		oceanKey, lakeKey, riverKey := waterBodyKeys(terrain, scratch.coords(body))
+		ocean[w] = oceanKey || (w == 0 && !lakeKey)
+		keyed[w] = oceanKey || lakeKey || riverKey
+		if ocean[w] {
+			oceanTiles += body.size
+		}
+		if oceanKey && w > 0 {
+			logger.Debug(fmt.Sprintf("An ocean key colour made a water body of %d tile(s) ocean", body.size))
+		} else if lakeKey && w == 0 {
+			logger.Debug(fmt.Sprintf("A lake key colour made the largest water body, %d tile(s), a lake", body.size))
+		}
+	}
+	explainerFromContext(ctx).waterBody(waterBodies, scratch, removeSmall, minLakeSize, ocean, keyed)
+
+	smallLakes := 0
+
+	if len(waterBodies) > 0 {
+		for w, body := range waterBodies {
+			if !ocean[w] {
+				continue
+			}
+			for _, coord := range scratch.coords(body) {
+				terrain.at(coord.X, coord.Y).Ocean = true
+			}
+		}
+		logger.Info(fmt.Sprintf("Identified ocean with %d water tiles", oceanTiles))
+
+		if removeSmall {
+			// Remove small water bodies
+			logger.Info("Searching for small water bodies for removal")
+			for w := 0; w < len(waterBodies); w++ {
+				if !ocean[w] && !keyed[w] && waterBodies[w].size < minLakeSize {
+					coords := scratch.coords(waterBodies[w])
+					logger.Debug(fmt.Sprintf("Removing small lake at %d,%d (size %d)", coords[0].X, coords[0].Y, waterBodies[w].size), RemovalLogTag)
+					problemsFromContext(ctx).add(ProblemSmallLake, coords, "lake of %d tile(s) filled with land, below the minimum of %d", waterBodies[w].size, minLakeSize)
+					smallLakes++
+					for _, coord := range coords {
+						terrain.at(coord.X, coord.Y).Type = Land
+						terrain.at(coord.X, coord.Y).Magnitude = 0
+					}
+				}
+			}
+			logger.Info(fmt.Sprintf("Identified and removed %d bodies of water smaller than %d tiles", smallLakes, minLakeSize))
+		}
+
+		// Process shorelines and distances
+		shorelineWaters := processShore(ctx, terrain, wrapX, scratch)
+		processDistToLand(ctx, shorelineWaters, terrain, wrapX, scratch)
+	} else {
+		logger.Info("No water bodies found in the map")
+	}
+	return smallLakes
+}
+
+// getArea finds the contiguous area of tiles sharing the TerrainType of the
+// tile at x,y, appends them to area and returns it. It is a scanline fill
+// along the rows, which are contiguous in the grid: every tile it reaches
+// brings in the whole run of matching tiles west and east of it at once, so
+// only the rows above and below a tile are left to look at, and the tiles
+// across the seam on the west and east edges when wrapX is true.
+// The appended tail of area doubles as the queue, so finding an area
+// allocates nothing once area has enough capacity; the first tile appended
+// is x,y.
+// visited holds the tiles already assigned to an area, indexed y*width+x
+// like the grid; it is updated to prevent reprocessing tiles across
+// multiple getArea calls.
+func getArea(x, y int, terrain *terrainGrid, wrapX bool, visited bitset, area []Coord) []Coord {
+	width := terrain.Width
+	height := terrain.Height
+	tiles := terrain.Tiles
+	targetType := terrain.at(x, y).Type
+
+	// visitRun queues the run of unvisited tiles of the target type in
+	// row ny around nx, if nx is one of them.
+	visitRun := func(nx, ny int) {
+		base := ny * width
+		if visited.has(base+nx) || tiles[base+nx].Type != targetType {
+			return
+		}
+		x0, x1 := nx, nx
+		for x0 > 0 && !visited.has(base+x0-1) && tiles[base+x0-1].Type == targetType {
+			x0--
+		}
+		for x1 < width-1 && !visited.has(base+x1+1) && tiles[base+x1+1].Type == targetType {
+			x1++
+		}
+		visited.set(base + nx)
+		area = append(area, Coord{X: nx, Y: ny})
+		for rx := x0; rx <= x1; rx++ {
+			if rx != nx {
+				visited.set(base + rx)
+				area = append(area, Coord{X: rx, Y: ny})
+			}
+		}
+	}
+	head := len(area)
+	visitRun(x, y)
+	wraps := wrapX && width > 2
+	for head < len(area) {
+		coord := area[head]
+		head++
+
+		cx, cy := coord.X, coord.Y
+		if cy > 0 {
+			visitRun(cx, cy-1)
+		}
+		if cy < height-1 {
+			visitRun(cx, cy+1)
+		}
+		if wraps && cx == 0 {
+			visitRun(width-1, cy)
+		} else if wraps && cx == width-1 {
+			visitRun(0, cy)
+		}
+	}
+
+	return area
+}
+
+// removeSmallIslands identifies and removes small land masses from the terrain.
+// If removeSmall is true, any removed bodies are converted to Water.
+// Land bodies smaller than minSize are removed. If wrapX is true, bodies
+// continue across the west/east seam. It returns the number of islands
+// removed.
+func removeSmallIslands(ctx context.Context, terrain *terrainGrid, minSize int, removeSmall, wrapX bool, scratch *floodScratch) int {
+	logger := LoggerFromContext(ctx)
+	if !removeSmall {
+		return 0
+	}
+
+	width := terrain.Width
+	height := terrain.Height
+	visited := scratch.visitedFor(width * height)
+
+	var landBodies []areaSpan
+
+	// Find all distinct land bodies
+	scratch.area = scratch.area[:0]
+	for x := 0; x < width && ctx.Err() == nil; x++ {
+		for y := 0; y < height; y++ {
+			if terrain.at(x, y).Type == Land {
+				if visited.has(y*width + x) {
+					continue
+				}
+
+				start := len(scratch.area)
+				scratch.area = getArea(x, y, terrain, wrapX, visited, scratch.area)
+				landBodies = append(landBodies, areaSpan{start: start, size: len(scratch.area) - start})
+			}
+		}
+	}
+
+	explainerFromContext(ctx).landBody(landBodies, scratch, minSize)
+	smallIslands := 0
+
+	for _, body := range landBodies {
+		if body.size < minSize {
+			coords := scratch.coords(body)
+			logger.Debug(fmt.Sprintf("Removing small island at %d,%d (size %d)", coords[0].X, coords[0].Y, body.size), RemovalLogTag)
+			problemsFromContext(ctx).add(ProblemSmallIsland, coords, "island of %d tile(s) removed, below the minimum of %d", body.size, minSize)
+			smallIslands++
+			for _, coord := range coords {
+				terrain.at(coord.X, coord.Y).Type = Water
+				terrain.at(coord.X, coord.Y).Magnitude = 0
+			}
+		}
+	}
+
+	logger.Info(fmt.Sprintf("Identified and removed %d islands smaller than %d tiles", smallIslands, minSize))
+	return smallIslands
+}
+
+// packTerrain serializes the terrain grid into a byte slice in the given
+// tile format. The output buffer is row-major (y*width+x), matching the
+// expected raster scan order of the binary map format.
+// Each byte represents a single tile with bit flags:
+//   - Bit 7: Land (1) / Water (0)
+//   - Bit 6: Shoreline
+//   - Bit 5: Ocean
+//   - Bits 0-4: Land magnitude (0-30).
+//   - Bit 4: River, for Water in mapformat.TileFormat2, see detectRivers.
+//   - Bits 0-3: Water magnitude (0-15), this is (Distance / 2).
+//
+// mapformat.TileFormat1 has no river bit and gives the water magnitude
+// bits 0-4 (0-31). The game renders water no deeper than magnitude 10, so
+// capping the water distance at 15 in TileFormat2 to free bit 4 changes
+// nothing it draws.
+//
+// Impassable tiles are encoded as 0b1kk11111 (isLand=1, magnitude=31) with
+// their ImpassableKind in bits 5-6, so the void is 0b10011111, and are NOT
+// counted in numLandTiles (they cannot be owned/attacked/nuked). Land never
+// reaches magnitude 31, see isImpassableTile. TileFormat1 packs every kind
+// as the void, which readers of it compare impassable tiles with; they would
+// take the bits of another kind for shoreline or ocean land.
+//
+// Returns the packed data and the count of land tiles.
+func packTerrain(ctx context.Context, terrain *terrainGrid, format mapformat.TileFormat) (data []byte, numLandTiles int) {
+	packedData := make([]byte, len(terrain.Tiles))
+	numLandTiles = 0
+
+	for i, tile := range terrain.Tiles {
+		if i%terrain.Width == 0 && ctx.Err() != nil {
+			break
+		}
+		if tile.Type == Impassable {
+			// Impassable: isLand=1, magnitude=31, kind in the shoreline
+			// and ocean bits. Not counted as a land tile (can't be
+			// owned/attacked/nuked).
+			kind := tile.Kind
+			if format < mapformat.TileFormat2 {
+				kind = ImpassableVoid
+			}
+			packedData[i] = byte(mapformat.ImpassableTile(kind))
+			continue
+		}
+
+		var packedByte byte = 0
+
+		if tile.Type == Land {
+			packedByte |= 0b10000000
+			numLandTiles++
+		}
+		if tile.Shoreline {
+			packedByte |= 0b01000000
+		}
+		if tile.Ocean {
+			packedByte |= 0b00100000
+		}
+
+		if tile.Type == Land {
+			packedByte |= byte(math.Min(math.Ceil(tile.Magnitude), 31))
+		} else if format < mapformat.TileFormat2 {
+			packedByte |= byte(math.Min(math.Ceil(tile.Magnitude/2), 31))
+		} else {
+			if tile.River {
+				packedByte |= byte(mapformat.RiverBit)
+			}
+			packedByte |= byte(math.Min(math.Ceil(tile.Magnitude/2), mapformat.MaxWaterMagnitude))
+		}
+
+		packedData[i] = packedByte
+	}
+
+	logBinaryAsBits(ctx, packedData, 8)
+	return packedData, numLandTiles
+}
+
+// createMapThumbnail generates an RGBA image representation of the terrain.
+// It scales the map dimensions based on the provided quality factor.
+// Each pixel's color is determined by the terrain type and magnitude via ThumbnailColor.
+func createMapThumbnail(ctx context.Context, terrain *terrainGrid, quality float64) *image.RGBA {
+	logger := LoggerFromContext(ctx)
+	logger.Info("Creating thumbnail")
+
+	srcWidth := terrain.Width
+	srcHeight := terrain.Height
+
+	targetWidth := int(math.Max(1, math.Floor(float64(srcWidth)*quality)))
+	targetHeight := int(math.Max(1, math.Floor(float64(srcHeight)*quality)))
+
+	img := image.NewRGBA(image.Rect(0, 0, targetWidth, targetHeight))
+
+	for y := 0; y < targetHeight; y++ {
+		for x := 0; x < targetWidth; x++ {
+			srcX := int(math.Floor(float64(x) / quality))
+			srcY := int(math.Floor(float64(y) / quality))
+
+			srcX = int(math.Min(float64(srcX), float64(srcWidth-1)))
+			srcY = int(math.Min(float64(srcY), float64(srcHeight-1)))
+
+			terrain := *terrain.at(srcX, srcY)
+			rgba := ThumbnailColor(terrain)
+			img.Set(x, y, color.RGBA{R: rgba.R, G: rgba.G, B: rgba.B, A: rgba.A})
+		}
+	}
+
+	return img
+}
+
+// RGBA represents a color with Red, Green, Blue, and Alpha channels.
+// It is used locally for thumbnail generation.
+type RGBA struct {
+	R, G, B, A uint8
+}
+
+// ThumbnailColor determines the RGBA color for a specific terrain tile for
+// the map preview thumbnail.
+//
+// It handles color generation for Water (shoreline vs deep water) and Land
+// (shoreline, plains, highlands, mountains) based on the tile's magnitude.
+//
+// The thumbnail renders its own set of colors separate from the in-game light/dark
+// color schemes.
+//
+// For thumbnail purposes, the terrain type -> color mapping:
+//   - Impassable void: (Transparent) — renders as the map background in-game, so
+//     the thumbnail matches by being transparent (the map picker background
+//     shows through).
+//   - Ice: `rgb(235, 242, 248)`
+//   - Lava: `rgb(150, 40, 25)`
+//   - Water Shoreline: (Transparent)
+//   - Deep Water: (Transparent)
+//   - Land Shoreline: `rgb(204, 203, 158)`
+//   - Plains (Mag < 10): `rgb(190, 220, 138)` - `rgb(190, 202, 138)`
+//   - Highlands (Mag 10-19): `rgb(220, 203, 158)` - `rgb(238, 221, 176)`
+//   - Mountains (Mag >= 20): `rgb(240, 240, 240)` - `rgb(245, 245, 245)`
+func ThumbnailColor(t Terrain) RGBA {
+	if t.Type == Impassable {
+		switch t.Kind {
+		case ImpassableIce:
+			return RGBA{R: 235, G: 242, B: 248, A: 255}
+		case ImpassableLava:
+			return RGBA{R: 150, G: 40, B: 25, A: 255}
+		}
+		return RGBA{R: 0, G: 0, B: 0, A: 0}
+	}
+	if t.Type == Water {
+		// Shoreline water
+		if t.Shoreline {
+			return RGBA{R: 100, G: 143, B: 255, A: 0}
+		}
+		// Other water: adjust based on magnitude
+		waterAdjRGB := 11 - math.Min(t.Magnitude/2, 10) - 10
+		return RGBA{
+			R: uint8(math.Max(70+waterAdjRGB, 0)),
+			G: uint8(math.Max(132+waterAdjRGB, 0)),
+			B: uint8(math.Max(180+waterAdjRGB, 0)),
+			A: 0,
+		}
+	}
+
+	// Shoreline land
+	if t.Shoreline {
+		return RGBA{R: 204, G: 203, B: 158, A: 255}
+	}
+
+	var adjRGB float64
+	if t.Magnitude < 10 {
+		// Plains
+		adjRGB = 220 - 2*t.Magnitude
+		return RGBA{
+			R: 190,
+			G: uint8(adjRGB),
+			B: 138,
+			A: 255,
+		}
+	} else if t.Magnitude < 20 {
+		// Highlands
+		adjRGB = 2 * t.Magnitude
+		return RGBA{
+			R: uint8(200 + adjRGB),
+			G: uint8(183 + adjRGB),
+			B: uint8(138 + adjRGB),
+			A: 255,
+		}
+	} else {
+		// Mountains
+		adjRGB = math.Floor(230 + t.Magnitude/2)
+		return RGBA{
+			R: uint8(adjRGB),
+			G: uint8(adjRGB),
+			B: uint8(adjRGB),
+			A: 255,
+		}
+	}
+}
+
+// logBinaryAsBits logs the binary representation of the first 'length' bytes of data.
+// It is a helper function for debugging packed terrain data.
+func logBinaryAsBits(ctx context.Context, data []byte, length int) {
+	logger := LoggerFromContext(ctx)
+	if length > len(data) {
+		length = len(data)
+	}
+
+	var bits string
+	for i := 0; i < length; i++ {
+		bits += fmt.Sprintf("%08b ", data[i])
+	}
+	logger.Info(fmt.Sprintf("Binary data (bits): %s", bits))
+}
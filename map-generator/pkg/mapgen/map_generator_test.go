@@ -0,0 +1,552 @@
+package mapgen
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"log/slog"
+	"math"
+	"math/rand"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapformat"
+)
+
+// testContext returns a context whose logger discards everything.
+func testContext() context.Context {
+	return ContextWithLogger(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+// parseTerrain returns the grid drawn by rows: '#' is land, '.' water and
+// 'X' impassable.
+func parseTerrain(rows ...string) *terrainGrid {
+	terrain := newTerrainGrid(len(rows[0]), len(rows))
+	for y, row := range rows {
+		for x, c := range row {
+			switch c {
+			case '#':
+				terrain.at(x, y).Type = Land
+			case '.':
+				terrain.at(x, y).Type = Water
+			case 'X':
+				terrain.at(x, y).Type = Impassable
+			}
+		}
+	}
+	return terrain
+}
+
+// randomTerrain returns a width×height grid of land, water and impassable
+// tiles drawn from seed, with land taking about landShare of it.
+func randomTerrain(width, height int, landShare float64, seed int64) *terrainGrid {
+	rng := rand.New(rand.NewSource(seed))
+	terrain := newTerrainGrid(width, height)
+	for i := range terrain.Tiles {
+		switch r := rng.Float64(); {
+		case r < landShare:
+			terrain.Tiles[i].Type = Land
+		case r < landShare+0.05:
+			terrain.Tiles[i].Type = Impassable
+		default:
+			terrain.Tiles[i].Type = Water
+		}
+	}
+	return terrain
+}
+
+// bfsLabels labels the connected components of tiles of type t the way the
+// generator did before the scanline fill: a breadth-first search over
+// neighborCoordsWrap from every unlabelled tile in column-major scan order.
+func bfsLabels(terrain *terrainGrid, t TerrainType, wrapX bool) []int32 {
+	width, height := terrain.Width, terrain.Height
+	labels := make([]int32, width*height)
+	for i := range labels {
+		labels[i] = -1
+	}
+	var next int32
+	var neighbors [4]Coord
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			if terrain.at(x, y).Type != t || labels[y*width+x] >= 0 {
+				continue
+			}
+			labels[y*width+x] = next
+			queue := []Coord{{X: x, Y: y}}
+			for len(queue) > 0 {
+				c := queue[0]
+				queue = queue[1:]
+				n := neighborCoordsWrap(c.X, c.Y, width, height, wrapX, &neighbors)
+				for _, nc := range neighbors[:n] {
+					i := nc.Y*width + nc.X
+					if terrain.at(nc.X, nc.Y).Type == t && labels[i] < 0 {
+						labels[i] = next
+						queue = append(queue, nc)
+					}
+				}
+			}
+			next++
+		}
+	}
+	return labels
+}
+
+// TestLabelComponentsMatchesBFS checks that the scanline fill of getArea,
+// through labelComponents, labels every tile the same as a breadth-first
+// search, with and without the west/east seam.
+func TestLabelComponentsMatchesBFS(t *testing.T) {
+	tests := []struct {
+		width, height int
+		landShare     float64
+	}{
+		{1, 1, 0.5},
+		{1, 17, 0.5},
+		{17, 1, 0.5},
+		{2, 9, 0.5},
+		{3, 3, 0.6},
+		{40, 30, 0.3},
+		{40, 30, 0.55},
+		{64, 64, 0.7},
+		{97, 31, 0.45},
+	}
+	for _, tt := range tests {
+		for seed := int64(1); seed <= 5; seed++ {
+			terrain := randomTerrain(tt.width, tt.height, tt.landShare, seed)
+			scratch := newFloodScratch(tt.width * tt.height)
+			for _, wrapX := range []bool{false, true} {
+				for _, typ := range []TerrainType{Land, Water, Impassable} {
+					want := bfsLabels(terrain, typ, wrapX)
+					got := labelComponents(terrain, typ, wrapX, scratch)
+					sizes := make([]int, len(got.Sizes))
+					for i, label := range got.Labels {
+						if label != want[i] {
+							t.Fatalf("%dx%d seed %d wrapX %v type %v: tile %d,%d has label %d, want %d",
+								tt.width, tt.height, seed, wrapX, typ, i%tt.width, i/tt.width, label, want[i])
+						}
+						if label >= 0 {
+							sizes[label]++
+						}
+					}
+					for label, size := range got.Sizes {
+						if size != sizes[label] {
+							t.Errorf("%dx%d seed %d wrapX %v type %v: component %d has size %d, want %d",
+								tt.width, tt.height, seed, wrapX, typ, label, size, sizes[label])
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// TestGenerateMapCancelled checks that GenerateMap stops with the context's
+// error once it is cancelled.
+func TestGenerateMapCancelled(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{0, 0, uint8(106 + 50*((x/8+y/8)%2)), 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(testContext())
+	cancel()
+	_, err := GenerateMap(ctx, GeneratorArgs{Name: "cancelled", ImageBuffer: buf.Bytes(), Config: DefaultGeneratorConfig()})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("GenerateMap with a cancelled context returned %v, want %v", err, context.Canceled)
+	}
+}
+
+// TestNeighborCoordsWrap checks the neighbours of tiles on the edges and
+// corners of a grid, with and without the west/east seam.
+func TestNeighborCoordsWrap(t *testing.T) {
+	tests := []struct {
+		name          string
+		x, y          int
+		width, height int
+		wrapX         bool
+		want          []Coord
+	}{
+		{"interior", 2, 2, 5, 4, false, []Coord{{1, 2}, {3, 2}, {2, 1}, {2, 3}}},
+		{"interior wrapping", 2, 2, 5, 4, true, []Coord{{1, 2}, {3, 2}, {2, 1}, {2, 3}}},
+		{"north-west corner", 0, 0, 5, 4, false, []Coord{{1, 0}, {0, 1}}},
+		{"north-west corner wrapping", 0, 0, 5, 4, true, []Coord{{1, 0}, {0, 1}, {4, 0}}},
+		{"east edge", 4, 2, 5, 4, false, []Coord{{3, 2}, {4, 1}, {4, 3}}},
+		{"east edge wrapping", 4, 2, 5, 4, true, []Coord{{3, 2}, {4, 1}, {4, 3}, {0, 2}}},
+		{"south-east corner wrapping", 4, 3, 5, 4, true, []Coord{{3, 3}, {4, 2}, {0, 3}}},
+		// Across a seam two tiles wide the neighbour is already the one
+		// inside the grid, and a single column has no seam.
+		{"two columns wrapping", 0, 1, 2, 3, true, []Coord{{1, 1}, {0, 0}, {0, 2}}},
+		{"one column wrapping", 0, 1, 1, 3, true, []Coord{{0, 0}, {0, 2}}},
+	}
+	for _, tt := range tests {
+		var buf [4]Coord
+		n := neighborCoordsWrap(tt.x, tt.y, tt.width, tt.height, tt.wrapX, &buf)
+		if !slices.Equal(buf[:n], tt.want) {
+			t.Errorf("%s: neighbours of %d,%d = %v, want %v", tt.name, tt.x, tt.y, buf[:n], tt.want)
+		}
+	}
+}
+
+// TestLabelComponents checks the scanline fill on shapes whose runs join
+// only through rows above or below them, or across the seam.
+func TestLabelComponents(t *testing.T) {
+	tests := []struct {
+		name  string
+		rows  []string
+		wrapX bool
+		want  []string // land labels from 'a' in scan order, '.' for other tiles
+	}{
+		{
+			name: "u-shape joined at the bottom",
+			rows: []string{"#.#", "#.#", "###"},
+			want: []string{"a.a", "a.a", "aaa"},
+		},
+		{
+			name: "spiral",
+			rows: []string{"#####", "....#", "###.#", "#...#", "#####"},
+			want: []string{"aaaaa", "....a", "aaa.a", "a...a", "aaaaa"},
+		},
+		{
+			name: "diagonal tiles are apart",
+			rows: []string{"#.", ".#"},
+			want: []string{"a.", ".b"},
+		},
+		{
+			name: "edges apart without the seam",
+			rows: []string{"#..#", "#..#"},
+			want: []string{"a..b", "a..b"},
+		},
+		{
+			name:  "edges joined across the seam",
+			rows:  []string{"#..#", "#..#"},
+			wrapX: true,
+			want:  []string{"a..a", "a..a"},
+		},
+		{
+			name:  "diagonal tiles are apart across the seam",
+			rows:  []string{"#...", "...#", "#..."},
+			wrapX: true,
+			want:  []string{"a...", "...c", "b..."},
+		},
+		{
+			name:  "seam and row together",
+			rows:  []string{"#...", "#..#", "...#"},
+			wrapX: true,
+			want:  []string{"a...", "a..a", "...a"},
+		},
+	}
+	for _, tt := range tests {
+		terrain := parseTerrain(tt.rows...)
+		l := labelComponents(terrain, Land, tt.wrapX, newFloodScratch(terrain.Width*terrain.Height))
+		for y, row := range tt.want {
+			for x, c := range row {
+				want := int32(-1)
+				if c != '.' {
+					want = int32(c - 'a')
+				}
+				if got := l.Labels[y*terrain.Width+x]; got != want {
+					t.Errorf("%s: tile %d,%d has label %d, want %d", tt.name, x, y, got, want)
+				}
+			}
+		}
+	}
+}
+
+// chamferDistances returns the 3-4 chamfer distance of every tile from the
+// shoreline water tiles, over 8-connected steps between passable tiles and
+// across the west/east seam if wrapX is set, found with Dijkstra's
+// algorithm over a bucket queue. Tiles that cannot reach the shoreline are
+// -1.
+func chamferDistances(terrain *terrainGrid, shore []Coord, wrapX bool) []int {
+	width, height := terrain.Width, terrain.Height
+	dist := make([]int, width*height)
+	for i := range dist {
+		dist[i] = -1
+	}
+	var buckets [][]Coord
+	push := func(c Coord, d int) {
+		i := c.Y*width + c.X
+		if dist[i] >= 0 && dist[i] <= d {
+			return
+		}
+		dist[i] = d
+		for len(buckets) <= d {
+			buckets = append(buckets, nil)
+		}
+		buckets[d] = append(buckets[d], c)
+	}
+	for _, c := range shore {
+		push(c, 0)
+	}
+	for d := 0; d < len(buckets); d++ {
+		for _, c := range buckets[d] {
+			if dist[c.Y*width+c.X] != d {
+				continue
+			}
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					nx, ny := c.X+dx, c.Y+dy
+					if wrapX {
+						nx = (nx + width) % width
+					}
+					if (dx == 0 && dy == 0) || nx < 0 || ny < 0 || nx >= width || ny >= height ||
+						terrain.at(nx, ny).Type == Impassable {
+						continue
+					}
+					step := 3
+					if dx != 0 && dy != 0 {
+						step = 4
+					}
+					push(Coord{X: nx, Y: ny}, d+step)
+				}
+			}
+		}
+	}
+	return dist
+}
+
+// TestProcessDistToLand checks the water magnitudes of the distance
+// transform, in thirds of a tile: orthogonal steps from the nearest
+// shoreline water count 3 and diagonal ones 4, around impassable tiles and
+// across the seam too.
+func TestProcessDistToLand(t *testing.T) {
+	tests := []struct {
+		name  string
+		rows  []string
+		wrapX bool
+		want  []string // water magnitudes ×3, '-' for other tiles
+	}{
+		{
+			name: "row",
+			rows: []string{"#....."},
+			want: []string{"- 0 3 6 9 12"},
+		},
+		{
+			name:  "row across the seam",
+			rows:  []string{"#....."},
+			wrapX: true,
+			want:  []string{"- 0 3 6 3 0"},
+		},
+		{
+			name: "diagonal",
+			rows: []string{"#...", "....", "...."},
+			want: []string{"- 0 3 6", "0 3 4 7", "3 4 7 8"},
+		},
+		{
+			name:  "diagonal across the seam",
+			rows:  []string{"#...", "...."},
+			wrapX: true,
+			want:  []string{"- 0 3 0", "0 3 4 3"},
+		},
+		{
+			name: "around a barrier",
+			rows: []string{"#.X..", "..X..", "....."},
+			want: []string{"- 0 - 14 15", "0 3 - 11 14", "3 4 7 10 13"},
+		},
+		{
+			name: "through land",
+			rows: []string{"#...#.."},
+			want: []string{"- 0 3 0 - 0 3"},
+		},
+		{
+			// Water walled off by impassable tiles keeps its magnitude,
+			// 9 (27 thirds) here.
+			name: "walled off",
+			rows: []string{"#.XXX", "..X.X", "..XXX"},
+			want: []string{"- 0 - - -", "0 3 - 27 -", "3 4 - - -"},
+		},
+	}
+	for _, tt := range tests {
+		terrain := parseTerrain(tt.rows...)
+		for i := range terrain.Tiles {
+			if terrain.Tiles[i].Type == Water {
+				terrain.Tiles[i].Magnitude = 9
+			}
+		}
+		ctx := testContext()
+		scratch := newFloodScratch(terrain.Width * terrain.Height)
+		processDistToLand(ctx, processShore(ctx, terrain, tt.wrapX, scratch), terrain, tt.wrapX, scratch)
+		for y, row := range tt.want {
+			for x, field := range strings.Fields(row) {
+				if field == "-" {
+					continue
+				}
+				want, _ := strconv.Atoi(field)
+				if got := math.Round(terrain.at(x, y).Magnitude * 3); got != float64(want) {
+					t.Errorf("%s: water at %d,%d has magnitude %g thirds, want %d", tt.name, x, y, got, want)
+				}
+			}
+		}
+	}
+}
+
+// TestProcessDistToLandMatchesDijkstra checks the distance transform against
+// Dijkstra's algorithm from the shoreline water over passable tiles, on
+// random grids with impassable barriers, with and without the west/east
+// seam.
+func TestProcessDistToLandMatchesDijkstra(t *testing.T) {
+	for seed := int64(1); seed <= 3; seed++ {
+		for _, wrapX := range []bool{false, true} {
+			terrain := randomTerrain(160, 120, 0.02, seed)
+			ctx := testContext()
+			scratch := newFloodScratch(terrain.Width * terrain.Height)
+			shore := processShore(ctx, terrain, wrapX, scratch)
+			want := chamferDistances(terrain, shore, wrapX)
+
+			processDistToLand(ctx, shore, terrain, wrapX, scratch)
+			for i, tile := range terrain.Tiles {
+				if tile.Type == Water && want[i] >= 0 && math.Round(tile.Magnitude*3) != float64(want[i]) {
+					t.Fatalf("seed %d wrapX %v: water at %d,%d has magnitude %g thirds, want %d", seed, wrapX, i%terrain.Width, i/terrain.Width, tile.Magnitude*3, want[i])
+				}
+			}
+		}
+	}
+}
+
+// TestPackTerrain checks the packed bytes of passable and impassable tiles in
+// either tile format, that the water distance of TileFormat2 leaves the
+// river bit alone, that only TileFormat2 keeps impassable kinds and that
+// impassable tiles don't count as land.
+func TestPackTerrain(t *testing.T) {
+	tests := []struct {
+		name         string
+		tile         Terrain
+		want1, want2 byte
+		land         bool
+	}{
+		{"deep water", Terrain{Type: Water, Magnitude: 7}, 0b00000100, 0b00000100, false},
+		{"far water", Terrain{Type: Water, Magnitude: 100}, 0b00011111, 0b00001111, false},
+		{"river", Terrain{Type: Water, Magnitude: 3, River: true}, 0b00000010, 0b00010010, false},
+		{"shoreline ocean river", Terrain{Type: Water, Shoreline: true, Ocean: true, River: true}, 0b01100000, 0b01110000, false},
+		{"far river", Terrain{Type: Water, Magnitude: 100, River: true}, 0b00011111, 0b00011111, false},
+		{"shoreline ocean", Terrain{Type: Water, Shoreline: true, Ocean: true}, 0b01100000, 0b01100000, false},
+		{"plains", Terrain{Type: Land, Magnitude: 4.2}, 0b10000101, 0b10000101, true},
+		{"mountain shore", Terrain{Type: Land, Magnitude: 30, Shoreline: true}, 0b11011110, 0b11011110, true},
+		{"void", Terrain{Type: Impassable}, 0b10011111, 0b10011111, false},
+		{"ice", Terrain{Type: Impassable, Kind: ImpassableIce}, 0b10011111, 0b10111111, false},
+		{"lava", Terrain{Type: Impassable, Kind: ImpassableLava}, 0b10011111, 0b11011111, false},
+		// Flags left over on an impassable tile don't leak into its kind.
+		{"void with flags", Terrain{Type: Impassable, Shoreline: true, Ocean: true, Magnitude: 3}, 0b10011111, 0b10011111, false},
+	}
+	for _, tt := range tests {
+		terrain := newTerrainGrid(1, 1)
+		terrain.Tiles[0] = tt.tile
+		for format, want := range map[mapformat.TileFormat]byte{mapformat.TileFormat1: tt.want1, mapformat.TileFormat2: tt.want2} {
+			data, numLandTiles := packTerrain(testContext(), terrain, format)
+			if data[0] != want {
+				t.Errorf("%s: packed in format %d as %08b, want %08b", tt.name, format, data[0], want)
+			}
+			if land := numLandTiles == 1; land != tt.land {
+				t.Errorf("%s: counted as land %v, want %v", tt.name, land, tt.land)
+			}
+		}
+	}
+}
+
+// TestBuildTradeMatrixWrap checks that ports on either side of the
+// west/east seam are joined across it on maps that wrap, and not otherwise.
+func TestBuildTradeMatrixWrap(t *testing.T) {
+	terrain := parseTerrain(
+		"############",
+		"...######...",
+		"############",
+	)
+	for i := range terrain.Tiles {
+		terrain.Tiles[i].Shoreline = terrain.Tiles[i].Type == Water
+	}
+	info := []byte(`{"nations": [{"name": "West", "coordinates": [2, 2]}, {"name": "East", "coordinates": [20, 2]}]}`)
+	for _, tt := range []struct {
+		wrapX bool
+		want  int
+	}{
+		{false, -1},
+		{true, 3},
+	} {
+		in := &layerInput{Terrain4x: terrain, Terrain16x: terrain, Info: info, WrapX: tt.wrapX}
+		data, _, err := buildTradeMatrix(testContext(), in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var matrix tradeMatrix
+		if err := json.Unmarshal(data, &matrix); err != nil {
+			t.Fatal(err)
+		}
+		if got := matrix.Scales["map4x"].Distances[0][1]; got != tt.want {
+			t.Errorf("wrapX %v: distance between the ports = %d, want %d", tt.wrapX, got, tt.want)
+		}
+	}
+}
+
+// TestBuildHPAWrap checks that the graph of a map that wraps has
+// transitions across the west/east seam, and that of a map that doesn't has
+// none.
+func TestBuildHPAWrap(t *testing.T) {
+	width := 2*hpaClusterSize + 6
+	rows := make([]string, 3)
+	for y := range rows {
+		rows[y] = strings.Repeat(".", width)
+	}
+	terrain := parseTerrain(rows...)
+	for _, wrapX := range []bool{false, true} {
+		data, _, err := buildHPA(testContext(), terrain, Water, wrapX)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Skip the header and cluster offsets to the nodes and edges.
+		le := binary.LittleEndian
+		clusters := int(le.Uint16(data[7:])) * int(le.Uint16(data[9:]))
+		r := data[11+4*(clusters+1):]
+		nodes := make([]Coord, le.Uint32(r))
+		for i := range nodes {
+			nodes[i] = Coord{X: int(le.Uint16(r[4+4*i:])), Y: int(le.Uint16(r[6+4*i:]))}
+		}
+		r = r[4+4*len(nodes):]
+		seam := 0
+		for i := range int(le.Uint32(r)) {
+			a, b := nodes[le.Uint32(r[4+12*i:])], nodes[le.Uint32(r[8+12*i:])]
+			if cost := le.Uint32(r[12+12*i:]); cost == 1 && a.Y == b.Y && min(a.X, b.X) == 0 && max(a.X, b.X) == width-1 {
+				seam++
+			}
+		}
+		if want := map[bool]int{false: 0, true: 1}[wrapX]; seam != want {
+			t.Errorf("wrapX %v: %d transition(s) across the seam, want %d", wrapX, seam, want)
+		}
+	}
+}
+
+// TestBuildMovementCost checks that land costs follow the tile's biome, with
+// the biomes info.json leaves out keeping their default cost.
+func TestBuildMovementCost(t *testing.T) {
+	var weights movementCostConfig
+	if err := json.Unmarshal([]byte(`{"biomes": {"forest": 1.5}}`), &weights); err != nil {
+		t.Fatal(err)
+	}
+	if err := weights.validate(); err != nil {
+		t.Fatal(err)
+	}
+	terrain := parseTerrain("####.")
+	for i, b := range []Biome{BiomeTemperate, BiomeForest, BiomeSwamp, BiomeDesert} {
+		terrain.Tiles[i].Biome = b
+	}
+	in := &layerInput{Terrain: terrain, Config: GeneratorConfig{MovementCost: &weights}}
+	data, _, err := buildMovementCost(testContext(), in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{32, 80, 96, 32, 0}
+	if !bytes.Equal(data, want) {
+		t.Errorf("movement costs = %v, want %v", data, want)
+	}
+}
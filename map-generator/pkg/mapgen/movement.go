@@ -0,0 +1,178 @@
+package mapgen
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+// MovementCostScale is the byte value of a movement cost of 1 in
+// movement_cost.bin, giving costs up to 255/32 in steps of 1/32.
+const MovementCostScale = 32
+
+// movementCostLayer rates how slow each land tile is to cross, for making
+// attacks terrain-aware on the server.
+var movementCostLayer = auxLayer{
+	Name:      "movement_cost",
+	File:      "movement_cost.bin",
+	TileBytes: 1,
+	Summary:   "per-tile movement cost from elevation and biome",
+	Build:     buildMovementCost,
+}
+
+// movementCostConfig is the "generator.movement_cost" section, the weights
+// of the movement cost formula, see buildMovementCost.
+type movementCostConfig struct {
+	// Base is the cost of flat land of no roughness.
+	Base float64 `json:"base"`
+	// Elevation is the cost added at magnitude 30.
+	Elevation float64 `json:"elevation"`
+	// Biomes is the cost added on each Biome, by name of BiomeNames.
+	Biomes map[string]float64 `json:"biomes"`
+	// Roughness is the cost added at full roughness of roughness.png, which
+	// replaces the biome costs when the map has one.
+	Roughness float64 `json:"roughness"`
+}
+
+// defaultMovementCost returns the weights used when info.json doesn't set
+// them: mountains and swamps each make land three times as slow to cross as
+// open plains, and forests twice as slow.
+func defaultMovementCost() movementCostConfig {
+	return movementCostConfig{
+		Base:      1,
+		Elevation: 2,
+		Biomes:    map[string]float64{"temperate": 0, "forest": 1, "swamp": 2, "desert": 0, "tundra": 0},
+		Roughness: 2,
+	}
+}
+
+// UnmarshalJSON fills in the defaults of the fields the section omits, and
+// of the biomes "biomes" omits.
+func (c *movementCostConfig) UnmarshalJSON(data []byte) error {
+	type plain movementCostConfig
+	cfg := plain(defaultMovementCost())
+	defaults := cfg.Biomes
+	cfg.Biomes = nil
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return err
+	}
+	for name, cost := range defaults {
+		if _, ok := cfg.Biomes[name]; !ok {
+			if cfg.Biomes == nil {
+				cfg.Biomes = make(map[string]float64, len(defaults))
+			}
+			cfg.Biomes[name] = cost
+		}
+	}
+	*c = movementCostConfig(cfg)
+	return nil
+}
+
+// biomeCosts returns the cost added on each Biome, indexed by biome.
+func (c *movementCostConfig) biomeCosts() []float64 {
+	costs := make([]float64, len(BiomeNames))
+	for b, name := range BiomeNames {
+		costs[b] = c.Biomes[name]
+	}
+	return costs
+}
+
+// validate checks that the weights are not negative, that "biomes" only
+// names biomes, and that every cost fits in a byte of movement_cost.bin.
+func (c *movementCostConfig) validate() error {
+	if c.Base <= 0 {
+		return fmt.Errorf("base (%g) must be positive", c.Base)
+	}
+	if c.Elevation < 0 || c.Roughness < 0 {
+		return fmt.Errorf("elevation (%g) and roughness (%g) must not be negative", c.Elevation, c.Roughness)
+	}
+	for name, cost := range c.Biomes {
+		if !slices.Contains(BiomeNames, name) {
+			return fmt.Errorf("\"biomes\" key %q must be one of: %s", name, strings.Join(BiomeNames, ", "))
+		}
+		if cost < 0 {
+			return fmt.Errorf("\"biomes\" cost (%g) of %s must not be negative", cost, name)
+		}
+	}
+	highest := c.Roughness
+	for _, cost := range c.biomeCosts() {
+		highest = max(highest, cost)
+	}
+	if highest += c.Base + c.Elevation; highest*MovementCostScale > 255 {
+		return fmt.Errorf("base + elevation + the highest of the biome and roughness costs (%g) must be at most %g", highest, 255.0/MovementCostScale)
+	}
+	return nil
+}
+
+// buildMovementCost writes one byte per tile, row-major (index y*width+x)
+// like map.bin, holding the cost of crossing the tile times
+// MovementCostScale. Water and impassable tiles are 0. For land tiles the
+// cost is
+//
+//	base + elevation·magnitude/30 + biomes[biome]
+//
+// with the weights of "generator.movement_cost", see movementCostConfig, and
+// the tile's Biome, see classifyBiome. roughness.png is an optional
+// grayscale image in the map folder, aligned with image.png, in which
+// authors paint rough ground bright and open ground dark; when the map has
+// one, it overrides the biome term with roughness·gray/255. The manifest
+// entry records the formula and weights, so that the layer can be
+// reproduced, and the mean cost of the land.
+func buildMovementCost(ctx context.Context, in *layerInput) ([]byte, map[string]any, error) {
+	terrain := in.Terrain
+	width := terrain.Width
+	height := terrain.Height
+	weights := defaultMovementCost()
+	if in.Config.MovementCost != nil {
+		weights = *in.Config.MovementCost
+	}
+
+	roughness, err := auxGrayImage(in.Inputs, "roughness.png", width, height)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	biomeCosts := weights.biomeCosts()
+	data := make([]byte, width*height)
+	total := 0.0
+	landTiles := 0
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			tile := *terrain.at(x, y)
+			if tile.Type != Land {
+				continue
+			}
+			cost := weights.Base + weights.Elevation*math.Min(tile.Magnitude, 30)/30
+			if roughness != nil {
+				cost += weights.Roughness * float64(grayAt(roughness, x, y)) / 255
+			} else {
+				cost += biomeCosts[tile.Biome]
+			}
+			data[y*width+x] = byte(math.Round(MovementCostScale * cost))
+			total += cost
+			landTiles++
+		}
+	}
+
+	mean := 0.0
+	if landTiles > 0 {
+		mean = total / float64(landTiles)
+	}
+	formula := "base + elevation*magnitude/30 + biomes[biome]"
+	if roughness != nil {
+		formula = "base + elevation*magnitude/30 + roughness*gray/255"
+	}
+	LoggerFromContext(ctx).Debug(fmt.Sprintf("Movement cost: mean %.2f over %d land tiles (roughness image: %t)", mean, landTiles, roughness != nil))
+	return data, map[string]any{
+		"width":            width,
+		"height":           height,
+		"scale":            MovementCostScale,
+		"formula":          formula,
+		"weights":          weights,
+		"mean":             math.Round(mean*1000) / 1000,
+		"roughness_source": roughness != nil,
+	}, nil
+}
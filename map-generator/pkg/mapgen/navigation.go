@@ -0,0 +1,167 @@
+package mapgen
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+)
+
+const (
+	// navigationFileVersion is written in the header of navigation.bin and
+	// bumped whenever its layout changes.
+	navigationFileVersion = 1
+	// navigationRegionSize is the side, in full-scale tiles, of the grid
+	// cells grouping shoreline water into regions, as for lanes.
+	navigationRegionSize = laneClusterSize
+	// navigationUnreachable is the region distance of regions with no water
+	// path between them on the 1/16 scale map.
+	navigationUnreachable = math.MaxUint16
+)
+
+// navigationLayer precomputes the reachability and coarse distances that
+// boat pathfinding otherwise derives in game, for trade and transport
+// routing on the server.
+var navigationLayer = auxLayer{
+	Name:      "navigation",
+	File:      "navigation.bin",
+	TileBytes: 2.5,
+	Summary:   "water component of every tile and distances between shoreline regions",
+	Build:     buildNavigation,
+}
+
+// buildNavigation writes the navigation data of a map. Every water tile is
+// labelled with its connected water body, so that whether a boat can reach
+// a tile is one comparison. Shoreline water is grouped into regions, one
+// per water body per navigationRegionSize cell of coast as for lanes, and
+// the distances between the regions of each water body are measured on the
+// 1/16 scale map from the shoreline water tile nearest each region's anchor
+// there, so that the server can pick routes and estimate travel times
+// without searching the full-scale map.
+//
+// navigation.bin is little-endian:
+//
+//	"OFNV", u16 version, u16 region size, u32 width, u32 height
+//	components: u16 per full-scale tile, row-major, 0 for land and
+//	            impassable tiles, otherwise the water body from 1, largest
+//	            first, so that the ocean is 1
+//	u32 component count, then per component: u32 tiles, u32 first region,
+//	    u32 region count
+//	u32 region count, then per region, ordered by component: u16 x, u16 y
+//	    of its anchor, u16 x, u16 y of its tile on the 1/16 scale map, or
+//	    0xffff, 0xffff when there is no water there
+//	distances: per component, a region count × region count matrix of u16,
+//	           row-major, of 4-neighbour steps over water on the 1/16 scale
+//	           map between its regions, or 0xffff where the regions do not
+//	           connect at that scale, e.g. through a strait too narrow to
+//	           survive downscaling
+func buildNavigation(ctx context.Context, in *layerInput) ([]byte, map[string]any, error) {
+	terrain := in.Terrain
+	width := terrain.Width
+	height := terrain.Height
+	if width > math.MaxUint16+1 || height > math.MaxUint16+1 {
+		return nil, nil, fmt.Errorf("map is %dx%d, navigation supports at most 65536 tiles per side", width, height)
+	}
+	bodies := in.WaterBodies()
+	if len(bodies.Sizes) > math.MaxUint16 {
+		return nil, nil, fmt.Errorf("map has %d water bodies, navigation supports at most %d", len(bodies.Sizes), math.MaxUint16)
+	}
+
+	// Number the bodies from 1 by descending size.
+	order := make([]int, len(bodies.Sizes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return bodies.Sizes[order[i]] > bodies.Sizes[order[j]] })
+	ids := make([]uint16, len(bodies.Sizes))
+	for rank, label := range order {
+		ids[label] = uint16(rank + 1)
+	}
+
+	le := binary.LittleEndian
+	out := []byte("OFNV")
+	out = le.AppendUint16(out, navigationFileVersion)
+	out = le.AppendUint16(out, navigationRegionSize)
+	out = le.AppendUint32(out, uint32(width))
+	out = le.AppendUint32(out, uint32(height))
+	components := len(out)
+	out = append(out, make([]byte, 2*width*height)...)
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			if label := bodies.Labels[y*width+x]; label >= 0 {
+				le.PutUint16(out[components+2*(y*width+x):], ids[label])
+			}
+		}
+	}
+
+	anchors := coastalClusters(terrain, bodies, navigationRegionSize)
+	regionID := func(a Coord) uint16 { return ids[bodies.Labels[a.Y*width+a.X]] }
+	sort.SliceStable(anchors, func(i, j int) bool { return regionID(anchors[i]) < regionID(anchors[j]) })
+	first := make([]int, len(order)+1)
+	for _, a := range anchors {
+		first[regionID(a)]++
+	}
+	for id := 1; id < len(first); id++ {
+		first[id] += first[id-1]
+	}
+
+	out = le.AppendUint32(out, uint32(len(order)))
+	for rank, label := range order {
+		out = le.AppendUint32(out, uint32(bodies.Sizes[label]))
+		out = le.AppendUint32(out, uint32(first[rank]))
+		out = le.AppendUint32(out, uint32(first[rank+1]-first[rank]))
+	}
+
+	// The tile of every region on the 1/16 scale map, of a quarter of the
+	// dimensions.
+	small := in.Terrain16x
+	smallWidth, smallHeight := small.Width, small.Height
+	ports := make([]*Coord, len(anchors))
+	out = le.AppendUint32(out, uint32(len(anchors)))
+	for i, a := range anchors {
+		out = le.AppendUint16(out, uint16(a.X))
+		out = le.AppendUint16(out, uint16(a.Y))
+		start := Coord{X: min(a.X/4, smallWidth-1), Y: min(a.Y/4, smallHeight-1)}
+		if port, ok := nearestShorelineWater(small, start, in.WrapX); ok {
+			ports[i] = &port
+			out = le.AppendUint16(out, uint16(port.X))
+			out = le.AppendUint16(out, uint16(port.Y))
+		} else {
+			out = le.AppendUint16(out, navigationUnreachable)
+			out = le.AppendUint16(out, navigationUnreachable)
+		}
+	}
+
+	dist := make([]int32, smallWidth*smallHeight)
+	pairs := 0
+	for rank := range order {
+		regions := ports[first[rank]:first[rank+1]]
+		for i, from := range regions {
+			if from != nil {
+				waterDistances(small, *from, in.WrapX, dist)
+			}
+			for j, to := range regions {
+				d := navigationUnreachable
+				switch {
+				case i == j:
+					d = 0
+				case from != nil && to != nil && dist[to.Y*smallWidth+to.X] >= 0:
+					d = min(int(dist[to.Y*smallWidth+to.X]), navigationUnreachable-1)
+					pairs++
+				}
+				out = le.AppendUint16(out, uint16(d))
+			}
+		}
+	}
+
+	LoggerFromContext(ctx).Debug(fmt.Sprintf("Navigation: %d water bodies, %d shoreline regions, %d connected region pairs in %d bytes", len(order), len(anchors), pairs, len(out)))
+	return out, map[string]any{
+		"version":     navigationFileVersion,
+		"region_size": navigationRegionSize,
+		"width":       width,
+		"height":      height,
+		"components":  len(order),
+		"regions":     len(anchors),
+	}, nil
+}
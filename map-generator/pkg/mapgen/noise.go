@@ -0,0 +1,72 @@
+package mapgen
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+// NoiseSeed derives a noise seed from a string, so that noise-based outputs
+// are deterministic per map and regenerate byte-for-byte.
+func NoiseSeed(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
+
+// HashLattice returns a pseudo-random 64-bit value for a lattice point.
+func HashLattice(ix, iy int64, seed uint64) uint64 {
+	h := seed ^ uint64(ix)*0x9E3779B97F4A7C15 ^ uint64(iy)*0xC2B2AE3D27D4EB4F
+	// splitmix64 finaliser
+	h ^= h >> 30
+	h *= 0xBF58476D1CE4E5B9
+	h ^= h >> 27
+	h *= 0x94D049BB133111EB
+	h ^= h >> 31
+	return h
+}
+
+// gradientNoise returns 2D gradient (Perlin-style) noise at (x, y) in about
+// [-1, 1]. Lattice gradients are derived from HashLattice, so no permutation
+// table is needed and any seed can be used.
+func gradientNoise(x, y float64, seed uint64) float64 {
+	x0, y0 := math.Floor(x), math.Floor(y)
+	fx, fy := x-x0, y-y0
+	ix, iy := int64(x0), int64(y0)
+
+	grad := func(dx, dy int64, px, py float64) float64 {
+		angle := float64(HashLattice(ix+dx, iy+dy, seed)>>11) / (1 << 53) * 2 * math.Pi
+		return math.Cos(angle)*px + math.Sin(angle)*py
+	}
+	fade := func(t float64) float64 { return t * t * t * (t*(t*6-15) + 10) }
+
+	n00 := grad(0, 0, fx, fy)
+	n10 := grad(1, 0, fx-1, fy)
+	n01 := grad(0, 1, fx, fy-1)
+	n11 := grad(1, 1, fx-1, fy-1)
+	u, v := fade(fx), fade(fy)
+	nx0 := n00 + u*(n10-n00)
+	nx1 := n01 + u*(n11-n01)
+	return math.Sqrt2 * (nx0 + v*(nx1-nx0))
+}
+
+// FractalNoise sums octaves of gradientNoise, each at twice the frequency
+// and half the amplitude of the previous one, normalised to about [-1, 1].
+func FractalNoise(x, y float64, seed uint64, octaves int) float64 {
+	sum, amplitude, total := 0.0, 1.0, 0.0
+	for i := 0; i < octaves; i++ {
+		sum += amplitude * gradientNoise(x, y, seed+uint64(i))
+		total += amplitude
+		x, y = x*2, y*2
+		amplitude /= 2
+	}
+	return sum / total
+}
+
+// PeriodicNoise is FractalNoise made periodic in x with the given period, for
+// maps that wrap horizontally: it blends towards the noise one period to the
+// west, so that values match across the seam.
+func PeriodicNoise(x, y, period float64, seed uint64, octaves int) float64 {
+	n := FractalNoise(x, y, seed, octaves)
+	west := FractalNoise(x-period, y, seed, octaves)
+	return n + x/period*(west-n)
+}
@@ -0,0 +1,182 @@
+package mapgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PaletteFile is the optional per-map palette mapping the colours of
+// image.png to terrain, replacing the blue channel scheme, so that maps
+// painted with the colour conventions of other tools need no repainting.
+const PaletteFile = "palette.json"
+
+// maxPaletteMagnitude is the highest land magnitude a palette may assign,
+// that of blue 200 in the blue channel scheme.
+const maxPaletteMagnitude = 30
+
+// How a palette matched a pixel, see colorPalette.terrain.
+const (
+	paletteExact       uint8 = iota // its colour is listed
+	paletteTransparent              // unlisted and transparent: water
+	paletteBlack                    // unlisted pure black: the void
+	paletteNearest                  // unlisted: the nearest listed colour
+)
+
+// colorPalette is a parsed palette file.
+type colorPalette struct {
+	colors map[[4]uint8]Terrain
+	// keys are the listed colours in a fixed order, so that ties between
+	// nearest colours resolve the same way on every run.
+	keys [][4]uint8
+	// nearest caches the nearest listed colour of each unlisted colour.
+	nearest map[[4]uint8][4]uint8
+}
+
+// paletteEntry is the terrain of a palette colour: a type name, or an object
+// with a type and, for land, a magnitude.
+type paletteEntry struct {
+	Type      string   `json:"type"`
+	Magnitude *float64 `json:"magnitude"`
+}
+
+// UnmarshalJSON accepts the type name alone as shorthand.
+func (e *paletteEntry) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &e.Type); err == nil {
+		return nil
+	}
+	type plain paletteEntry
+	return json.Unmarshal(data, (*plain)(e))
+}
+
+// parsePaletteColor parses a "#rrggbb" or "#rrggbbaa" colour, opaque unless
+// it has an alpha.
+func parsePaletteColor(s string) ([4]uint8, bool) {
+	if !strings.HasPrefix(s, "#") || (len(s) != 7 && len(s) != 9) {
+		return [4]uint8{}, false
+	}
+	v, err := strconv.ParseUint(s[1:], 16, 32)
+	if err != nil {
+		return [4]uint8{}, false
+	}
+	if len(s) == 7 {
+		v = v<<8 | 0xff
+	}
+	return [4]uint8{uint8(v >> 24), uint8(v >> 16), uint8(v >> 8), uint8(v)}, true
+}
+
+// ParsePalette parses the map's palette file, if it has one. It returns nil
+// for maps without one, which keep the blue channel scheme.
+//
+// The file maps "#rrggbb" or "#rrggbbaa" colours to "water", "land", or an
+// impassable kind ("void", "ice" or "lava"), or to an object such as
+// {"type": "land", "magnitude": 12} giving land its magnitude, 0 (default)
+// to 30.
+func ParsePalette(inputs map[string][]byte) (*colorPalette, error) {
+	buf, ok := inputs[PaletteFile]
+	if !ok {
+		return nil, nil
+	}
+	var entries map[string]paletteEntry
+	if err := json.Unmarshal(buf, &entries); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", PaletteFile, err)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%s must list at least one colour", PaletteFile)
+	}
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	p := &colorPalette{colors: make(map[[4]uint8]Terrain, len(entries)), nearest: make(map[[4]uint8][4]uint8)}
+	for _, name := range names {
+		c, ok := parsePaletteColor(name)
+		if !ok {
+			return nil, fmt.Errorf("%s key %q must be a #rrggbb or #rrggbbaa colour", PaletteFile, name)
+		}
+		if _, dup := p.colors[c]; dup {
+			return nil, fmt.Errorf("%s lists colour %s twice", PaletteFile, name)
+		}
+		e := entries[name]
+		var t Terrain
+		switch e.Type {
+		case "land":
+			t.Type = Land
+			if e.Magnitude != nil {
+				if *e.Magnitude < 0 || *e.Magnitude > maxPaletteMagnitude {
+					return nil, fmt.Errorf("%s magnitude (%g) of %s must be between 0 and %d", PaletteFile, *e.Magnitude, name, maxPaletteMagnitude)
+				}
+				t.Magnitude = *e.Magnitude
+			}
+		case "water":
+			t.Type = Water
+		default:
+			kind := -1
+			for i, k := range ImpassableKindNames {
+				if e.Type == k {
+					kind = i
+				}
+			}
+			if kind < 0 {
+				return nil, fmt.Errorf("%s type (%q) of %s must be one of: land, water, %s", PaletteFile, e.Type, name, strings.Join(ImpassableKindNames, ", "))
+			}
+			t = Terrain{Type: Impassable, Kind: ImpassableKind(kind)}
+		}
+		if e.Magnitude != nil && t.Type != Land {
+			return nil, fmt.Errorf("%s colour %s is %s, only land takes a magnitude", PaletteFile, name, e.Type)
+		}
+		p.colors[c] = t
+		p.keys = append(p.keys, c)
+	}
+	return p, nil
+}
+
+// terrain returns the terrain of a pixel and how it was matched: a listed
+// colour gives its terrain; otherwise transparent pixels (alpha under 20)
+// are water and pure black is the void, as in the blue channel scheme, and
+// any other colour takes the terrain of the nearest listed colour, so that
+// antialiased edges between two colours take one of them.
+func (p *colorPalette) terrain(c [4]uint8) (Terrain, uint8) {
+	if t, ok := p.colors[c]; ok {
+		return t, paletteExact
+	}
+	if c[3] < 20 {
+		return Terrain{Type: Water}, paletteTransparent
+	}
+	if c[0] == 0 && c[1] == 0 && c[2] == 0 {
+		return Terrain{Type: Impassable}, paletteBlack
+	}
+	return p.colors[p.nearestColor(c)], paletteNearest
+}
+
+// nearestColor returns the listed colour nearest to c, by squared distance
+// over the four channels.
+func (p *colorPalette) nearestColor(c [4]uint8) [4]uint8 {
+	if k, ok := p.nearest[c]; ok {
+		return k
+	}
+	best, bestDist := p.keys[0], -1
+	for _, k := range p.keys {
+		dist := 0
+		for i := range k {
+			d := int(k[i]) - int(c[i])
+			dist += d * d
+		}
+		if bestDist < 0 || dist < bestDist {
+			best, bestDist = k, dist
+		}
+	}
+	p.nearest[c] = best
+	return best
+}
+
+// formatPaletteColor formats a colour as it is written in palette files.
+func formatPaletteColor(c [4]uint8) string {
+	if c[3] == 0xff {
+		return fmt.Sprintf("#%02x%02x%02x", c[0], c[1], c[2])
+	}
+	return fmt.Sprintf("#%02x%02x%02x%02x", c[0], c[1], c[2], c[3])
+}
@@ -0,0 +1,33 @@
+package mapgen
+
+import (
+	"runtime"
+	"sync"
+)
+
+// minParallelTiles is the number of tiles under which parallelSpans runs a
+// pass on the calling goroutine: on smaller grids starting goroutines costs
+// more than it saves.
+const minParallelTiles = 1 << 16
+
+// parallelSpans splits [0, n) into consecutive spans, one per CPU, calls fn
+// for each on its own goroutine and waits for them to return. tiles is the
+// number of tiles the whole pass touches. The spans are usually the rows or
+// columns of a grid, and fn must only write to the tiles of its own span.
+func parallelSpans(n, tiles int, fn func(lo, hi int)) {
+	workers := min(runtime.GOMAXPROCS(0), n)
+	if tiles < minParallelTiles || workers < 2 {
+		fn(0, n)
+		return
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		lo, hi := n*w/workers, n*(w+1)/workers
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fn(lo, hi)
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,92 @@
+package mapgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+const (
+	// landTilesPerPlayer is the spawnable land a single player comfortably
+	// needs in a full lobby.
+	landTilesPerPlayer = 20000
+	// minSpawnLandmassSize is the smallest landmass counted as spawnable;
+	// players placed on smaller islands rarely survive the opening.
+	minSpawnLandmassSize = 500
+	// maxRecommendedPlayers caps the computed counts at the lobby limit.
+	maxRecommendedPlayers = 150
+	// fragmentationPenalty is the share of capacity lost on a map whose land
+	// is entirely split into small islands.
+	fragmentationPenalty = 0.3
+	// coastlinePenalty scales how much a long coastline relative to land
+	// area (narrow peninsulas, archipelagos) reduces capacity.
+	coastlinePenalty = 2.0
+)
+
+// PlayerCounts is the "players" manifest section shown by the lobby.
+type PlayerCounts struct {
+	Min         int `json:"min"`
+	Max         int `json:"max"`
+	Recommended int `json:"recommended"`
+}
+
+// RecommendPlayerCounts derives lobby player counts from the geography, so
+// that maps are sized consistently instead of by hand-guessed numbers:
+//
+//	capacity    = spawnable land / landTilesPerPlayer
+//	            × (1 - fragmentationPenalty × (1 - largest landmass share))
+//	            ÷ (1 + coastlinePenalty × shoreline tiles / land tiles)
+//	recommended = capacity, clamped to [2, maxRecommendedPlayers]
+//	max         = 1.5 × recommended
+//	min         = recommended / 4, at least 2
+//
+// Spawnable land only counts landmasses of at least minSpawnLandmassSize
+// tiles.
+func RecommendPlayerCounts(stats MapStats) PlayerCounts {
+	capacity := float64(stats.LandInLandmassesOfAtLeast(minSpawnLandmassSize)) / landTilesPerPlayer
+	capacity *= 1 - fragmentationPenalty*(1-stats.LargestLandmassShare())
+	if stats.LandTiles > 0 {
+		capacity /= 1 + coastlinePenalty*float64(stats.ShorelineTiles)/float64(stats.LandTiles)
+	}
+
+	clamp := func(v float64, lo, hi int) int {
+		return int(math.Max(float64(lo), math.Min(float64(hi), math.Round(v))))
+	}
+	recommended := clamp(capacity, 2, maxRecommendedPlayers)
+	return PlayerCounts{
+		Min:         clamp(float64(recommended)/4, 2, recommended),
+		Max:         clamp(float64(recommended)*1.5, recommended, maxRecommendedPlayers),
+		Recommended: recommended,
+	}
+}
+
+// ApplyPlayerCountOverrides replaces computed counts with any set in the
+// "players" section of info.json, e.g. {"players": {"max": 40}}, and checks
+// that the result is consistent.
+func ApplyPlayerCountOverrides(counts PlayerCounts, infoBuffer []byte) (PlayerCounts, error) {
+	var info struct {
+		Players *struct {
+			Min         *int `json:"min"`
+			Max         *int `json:"max"`
+			Recommended *int `json:"recommended"`
+		} `json:"players"`
+	}
+	if err := json.Unmarshal(infoBuffer, &info); err != nil {
+		return counts, err
+	}
+	if info.Players != nil {
+		if info.Players.Min != nil {
+			counts.Min = *info.Players.Min
+		}
+		if info.Players.Max != nil {
+			counts.Max = *info.Players.Max
+		}
+		if info.Players.Recommended != nil {
+			counts.Recommended = *info.Players.Recommended
+		}
+	}
+	if counts.Min < 1 || counts.Min > counts.Recommended || counts.Recommended > counts.Max {
+		return counts, fmt.Errorf("\"players\" must satisfy 1 <= min <= recommended <= max, got %d/%d/%d", counts.Min, counts.Recommended, counts.Max)
+	}
+	return counts, nil
+}
@@ -0,0 +1,134 @@
+package mapgen
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapformat"
+)
+
+// renderThemeVersion is the version of the terrain palettes of renderThemes.
+// Bump it whenever a palette changes, so that clients caching the render
+// layers invalidate them.
+const renderThemeVersion = 1
+
+// renderTheme is an in-game terrain palette, ported from the client's light
+// and dark themes (src/core/configuration/PastelTheme.ts and
+// PastelThemeDark.ts), which it must be kept in sync with.
+type renderTheme struct {
+	// Shore is the colour of land tiles touching water.
+	Shore RGBA
+	// ShorelineWater is the colour of water tiles touching land.
+	ShorelineWater RGBA
+	// Plains, Highland and Mountain return the colour of land tiles of
+	// packed magnitude below 10, below 20 and from 20.
+	Plains, Highland, Mountain func(mag float64) RGBA
+	// Water returns the colour of the other water tiles by packed
+	// magnitude, lighter near land.
+	Water func(mag float64) RGBA
+}
+
+// renderThemes are the palettes of the render layers.
+var renderThemes = map[string]renderTheme{
+	"light": {
+		Shore:          RGBA{R: 204, G: 203, B: 158, A: 255},
+		ShorelineWater: RGBA{R: 100, G: 143, B: 255, A: 255},
+		Plains:         func(mag float64) RGBA { return RGBA{R: 190, G: uint8(220 - 2*mag), B: 138, A: 255} },
+		Highland: func(mag float64) RGBA {
+			return RGBA{R: uint8(200 + 2*mag), G: uint8(183 + 2*mag), B: uint8(138 + 2*mag), A: 255}
+		},
+		Mountain: func(mag float64) RGBA {
+			v := uint8(math.Floor(230 + mag/2))
+			return RGBA{R: v, G: v, B: v, A: 255}
+		},
+		Water: func(mag float64) RGBA {
+			adj := 11 - math.Min(mag, 10) - 10
+			return RGBA{R: uint8(math.Max(70+adj, 0)), G: uint8(math.Max(132+adj, 0)), B: uint8(math.Max(180+adj, 0)), A: 255}
+		},
+	},
+	"dark": {
+		Shore:          RGBA{R: 134, G: 133, B: 88, A: 255},
+		ShorelineWater: RGBA{R: 50, G: 50, B: 50, A: 255},
+		Plains:         func(mag float64) RGBA { return RGBA{R: 140, G: uint8(170 - 2*mag), B: 88, A: 255} },
+		Highland: func(mag float64) RGBA {
+			return RGBA{R: uint8(150 + 2*mag), G: uint8(133 + 2*mag), B: uint8(88 + 2*mag), A: 255}
+		},
+		Mountain: func(mag float64) RGBA {
+			v := uint8(math.Floor(180 + mag/2))
+			return RGBA{R: v, G: v, B: v, A: 255}
+		},
+		Water: func(mag float64) RGBA {
+			if mag >= 10 {
+				return RGBA{R: 14, G: 11, B: 30, A: 255}
+			}
+			return RGBA{R: uint8(14 + 9 - mag), G: uint8(11 + 9 - mag), B: uint8(30 + 9 - mag), A: 255}
+		},
+	},
+}
+
+// renderLightLayer and renderDarkLayer are the base terrain layer of the
+// client, coloured with its palettes, so that it can be uploaded as is
+// instead of being computed from map.bin at load.
+var (
+	renderLightLayer = renderLayer("light")
+	renderDarkLayer  = renderLayer("dark")
+)
+
+// renderLayer returns the render layer of a theme of renderThemes.
+func renderLayer(theme string) auxLayer {
+	return auxLayer{
+		Name:      "render_" + theme,
+		File:      "render_" + theme + ".rgba",
+		TileBytes: 4,
+		Summary:   "per-tile RGBA of the terrain in the in-game " + theme + " theme",
+		Build: func(ctx context.Context, in *layerInput) ([]byte, map[string]any, error) {
+			width := in.Terrain.Width
+			height := in.Terrain.Height
+			packed, _ := packTerrain(ctx, in.Terrain, mapformat.LatestTileFormat)
+			data := renderPacked(packed, renderThemes[theme])
+			LoggerFromContext(ctx).Debug(fmt.Sprintf("Rendered %dx%d tiles in the %s theme", width, height, theme))
+			return data, map[string]any{
+				"width":         width,
+				"height":        height,
+				"theme":         theme,
+				"theme_version": renderThemeVersion,
+			}, nil
+		},
+	}
+}
+
+// renderPacked colours every tile of a packed map as the client does, four
+// bytes (R, G, B, A) per tile in the order of the packed map. Tiles are
+// classified from the packed bits alone, as by the client: packed magnitude
+// below 10 is plains, below 20 highland, then mountain. The void is
+// transparent, so that the map background shows through; ice and lava take
+// their thumbnail colours, which no theme defines yet.
+func renderPacked(packed []byte, theme renderTheme) []byte {
+	data := make([]byte, 4*len(packed))
+	for i, b := range packed {
+		var c RGBA
+		tile := mapformat.Tile(b)
+		mag := float64(tile.Magnitude())
+		land := tile.IsLand()
+		shoreline := tile.IsShoreline()
+		switch {
+		case tile.IsImpassable():
+			c = ThumbnailColor(Terrain{Type: Impassable, Kind: tile.ImpassableKind()})
+		case land && shoreline:
+			c = theme.Shore
+		case land && mag < 10:
+			c = theme.Plains(mag)
+		case land && mag < 20:
+			c = theme.Highland(mag)
+		case land:
+			c = theme.Mountain(mag)
+		case shoreline:
+			c = theme.ShorelineWater
+		default:
+			c = theme.Water(mag)
+		}
+		data[4*i], data[4*i+1], data[4*i+2], data[4*i+3] = c.R, c.G, c.B, c.A
+	}
+	return data
+}
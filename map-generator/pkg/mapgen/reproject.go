@@ -0,0 +1,78 @@
+package mapgen
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"path/filepath"
+)
+
+// ProjectionSource is the "generator.projection" default: maps are
+// generated in the projection of their source image.
+const ProjectionSource = "source"
+
+// reprojectImage resamples the srcWidth×srcHeight top left corner of img,
+// which covers src, into a width×height image of the same bounding box in
+// the projection of dst. Sampling is nearest neighbour so that the water key
+// and impassable black survive unblended. Pixels outside the globe or the
+// source image, such as the corners of a Mollweide map, are set to outside.
+func reprojectImage(img image.Image, srcWidth, srcHeight int, src, dst *GeoReference, width, height int, outside color.Color) *image.NRGBA {
+	b := img.Bounds()
+	out := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			lon, lat, ok := dst.Unproject(float64(x)+0.5, float64(y)+0.5, width, height)
+			if !ok {
+				out.Set(x, y, outside)
+				continue
+			}
+			sx, sy := src.Project(lon, lat, srcWidth, srcHeight)
+			ix, iy := int(math.Floor(sx)), int(math.Floor(sy))
+			if ix < 0 || ix >= min(srcWidth, b.Dx()) || iy < 0 || iy >= min(srcHeight, b.Dy()) {
+				out.Set(x, y, outside)
+				continue
+			}
+			out.Set(x, y, img.At(b.Min.X+ix, b.Min.Y+iy))
+		}
+	}
+	return out
+}
+
+// ReprojectMapImages reprojects a map's source image and its auxiliary PNG
+// inputs from src to dst, as set by "generator.projection". The output keeps
+// the source width, and its height follows from the change in aspect ratio
+// between the projections. Pixels outside the globe or the source image
+// become impassable. It returns the reprojected image and a copy of inputs
+// with the PNGs replaced.
+func ReprojectMapImages(ctx context.Context, img image.Image, inputs map[string][]byte, src, dst *GeoReference) (image.Image, map[string][]byte, error) {
+	b := img.Bounds()
+	width := b.Dx()
+	height := int(math.Round(float64(b.Dy()) * dst.Aspect() / src.Aspect()))
+	if height < 4 {
+		return nil, nil, fmt.Errorf("reprojecting to %s leaves a %dx%d image", dst.Projection, width, height)
+	}
+	LoggerFromContext(ctx).Info(fmt.Sprintf("Reprojecting %dx%d image from %s to %s, %dx%d", b.Dx(), b.Dy(), src.Projection, dst.Projection, width, height))
+	out := reprojectImage(img, b.Dx(), b.Dy(), src, dst, width, height, color.NRGBA{A: 255})
+
+	reprojected := make(map[string][]byte, len(inputs))
+	for name, data := range inputs {
+		if filepath.Ext(name) != ".png" {
+			reprojected[name] = data
+			continue
+		}
+		aux, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to decode %s: %w", name, err)
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, reprojectImage(aux, b.Dx(), b.Dy(), src, dst, width, height, color.Black)); err != nil {
+			return nil, nil, err
+		}
+		reprojected[name] = buf.Bytes()
+	}
+	return out, reprojected, nil
+}
@@ -0,0 +1,253 @@
+package mapgen
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+)
+
+const (
+	// ridgeMagnitude is the lowest magnitude of a ridge tile: mountains, see
+	// the pixel mapping of GenerateMap.
+	ridgeMagnitude = 20
+	// minRidgeLength is the smallest extent, in tiles, along x or y of a
+	// connected mountain range that counts as a ridge. Shorter ranges are
+	// cosmetic peaks attackers walk around.
+	minRidgeLength = 32
+	// maxPassWidth is the widest gap, in tiles, between ridge tiles that
+	// counts as a pass.
+	maxPassWidth = 12
+	// passDepth is how far, in tiles, a pass must stay open along its
+	// course.
+	passDepth = 2 * maxPassWidth
+)
+
+// ridgesLayer lists the mountain ridges and the passes through them, for
+// giving terrain strategic meaning beyond cosmetic shading.
+var ridgesLayer = auxLayer{
+	Name:      "ridges",
+	File:      "ridges.json",
+	TileBytes: 0.5,
+	Summary:   "mountain ridges and the passes through them",
+	Build: func(ctx context.Context, in *layerInput) ([]byte, map[string]any, error) {
+		r := in.Ridges()
+		data, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			return nil, nil, err
+		}
+		LoggerFromContext(ctx).Debug(fmt.Sprintf("Ridges: %d ridges, %d passes", len(r.Ridges), len(r.Passes)))
+		return data, map[string]any{"ridges": len(r.Ridges), "passes": len(r.Passes)}, nil
+	},
+}
+
+// ridgeNetwork is the contents of ridges.json, in full-scale tile
+// coordinates.
+type ridgeNetwork struct {
+	Ridges []ridge        `json:"ridges"`
+	Passes []mountainPass `json:"passes"`
+
+	// labels holds the ridge index of every tile, indexed y*width+x, or -1.
+	labels []int32
+	// pass marks the tiles of passes, indexed y*width+x.
+	pass []bool
+}
+
+// ridge is a connected range of mountain tiles at least minRidgeLength
+// tiles long.
+type ridge struct {
+	ID           int    `json:"id"`
+	Size         int    `json:"size"`
+	Centroid     [2]int `json:"centroid"`      // [x, y], may lie off the ridge
+	Bounds       [4]int `json:"bounds"`        // [min_x, min_y, max_x, max_y]
+	MaxMagnitude int    `json:"max_magnitude"` // highest tile magnitude
+}
+
+// mountainPass is a connected group of lower land tiles lying in a gap of
+// at most maxPassWidth tiles between ridge tiles that leads through them.
+type mountainPass struct {
+	ID          int    `json:"id"`
+	Coordinates [2]int `json:"coordinates"` // the pass tile closest to its centroid
+	Size        int    `json:"size"`
+	Width       int    `json:"width"` // narrowest gap between ridge tiles across the pass
+	Magnitude   int    `json:"magnitude"`
+	Ridges      []int  `json:"ridges"` // IDs of the ridges on either side
+}
+
+// detectRidges finds the ridges of a terrain grid, connected (4-neighbour)
+// ranges of land tiles of magnitude ridgeMagnitude or more extending at least
+// minRidgeLength tiles, and the passes through them. A pass tile is a land
+// tile below ridgeMagnitude from which ridge tiles are reached on both sides
+// within maxPassWidth tiles across, along a row, column or diagonal, over
+// land, while no ridge tile lies within passDepth tiles along the
+// perpendicular either way. Ridges and passes are numbered from 1 in scan
+// order.
+func detectRidges(terrain *terrainGrid, wrapX bool) *ridgeNetwork {
+	width := terrain.Width
+	height := terrain.Height
+	isMountain := func(x, y int) bool {
+		return terrain.at(x, y).Type == Land && terrain.at(x, y).Magnitude >= ridgeMagnitude
+	}
+	wrap := func(x int) (int, bool) {
+		if wrapX {
+			return (x%width + width) % width, true
+		}
+		return x, x >= 0 && x < width
+	}
+
+	n := &ridgeNetwork{Ridges: []ridge{}, Passes: []mountainPass{}, labels: make([]int32, width*height), pass: make([]bool, width*height)}
+	for i := range n.labels {
+		n.labels[i] = -1
+	}
+	visited := make([]bool, width*height)
+	var stack, members []Coord
+	// flood collects the 4-connected tiles from (x, y) satisfying keep.
+	flood := func(x, y int, keep func(x, y int) bool) []Coord {
+		members = members[:0]
+		stack = append(stack[:0], Coord{x, y})
+		visited[y*width+x] = true
+		for len(stack) > 0 {
+			c := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			members = append(members, c)
+			for _, d := range [][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+				nx, ok := wrap(c.X + d[0])
+				ny := c.Y + d[1]
+				if !ok || ny < 0 || ny >= height || visited[ny*width+nx] || !keep(nx, ny) {
+					continue
+				}
+				visited[ny*width+nx] = true
+				stack = append(stack, Coord{nx, ny})
+			}
+		}
+		return members
+	}
+
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			if visited[y*width+x] || !isMountain(x, y) {
+				continue
+			}
+			tiles := flood(x, y, isMountain)
+			r := ridge{Size: len(tiles), Bounds: [4]int{width, height, -1, -1}}
+			sumX, sumY := 0, 0
+			for _, c := range tiles {
+				r.Bounds[0], r.Bounds[1] = min(r.Bounds[0], c.X), min(r.Bounds[1], c.Y)
+				r.Bounds[2], r.Bounds[3] = max(r.Bounds[2], c.X), max(r.Bounds[3], c.Y)
+				r.MaxMagnitude = max(r.MaxMagnitude, int(math.Ceil(terrain.at(c.X, c.Y).Magnitude)))
+				sumX += c.X
+				sumY += c.Y
+			}
+			if r.Bounds[2]-r.Bounds[0]+1 < minRidgeLength && r.Bounds[3]-r.Bounds[1]+1 < minRidgeLength {
+				continue
+			}
+			r.ID = len(n.Ridges) + 1
+			r.Centroid = [2]int{sumX / r.Size, sumY / r.Size}
+			for _, c := range tiles {
+				n.labels[c.Y*width+c.X] = int32(len(n.Ridges))
+			}
+			n.Ridges = append(n.Ridges, r)
+		}
+	}
+
+	// walk returns the ridge reached from (x, y) stepping by (dx, dy) over
+	// land within limit tiles, and the number of steps.
+	walk := func(x, y, dx, dy, limit int) (int32, int) {
+		for step := 1; step <= limit; step++ {
+			nx, ok := wrap(x + dx*step)
+			ny := y + dy*step
+			if !ok || ny < 0 || ny >= height || terrain.at(nx, ny).Type != Land {
+				return -1, 0
+			}
+			if label := n.labels[ny*width+nx]; label >= 0 {
+				return label, step
+			}
+		}
+		return -1, 0
+	}
+	gap := make([]int, width*height)
+	sides := make([][2]int32, width*height)
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			if terrain.at(x, y).Type != Land || isMountain(x, y) {
+				continue
+			}
+			for _, d := range [][2]int{{1, 0}, {0, 1}, {1, 1}, {1, -1}} {
+				a, stepsA := walk(x, y, d[0], d[1], maxPassWidth)
+				if a < 0 {
+					continue
+				}
+				b, stepsB := walk(x, y, -d[0], -d[1], maxPassWidth)
+				if b < 0 || stepsA+stepsB-1 > maxPassWidth {
+					continue
+				}
+				// A pass leads through: across the gap, no ridge closes it
+				// off within passDepth tiles either way, which rules out
+				// notches in the edge of a ridge.
+				if c, _ := walk(x, y, -d[1], d[0], passDepth); c >= 0 {
+					continue
+				}
+				if c, _ := walk(x, y, d[1], -d[0], passDepth); c >= 0 {
+					continue
+				}
+				i := y*width + x
+				if w := stepsA + stepsB - 1; !n.pass[i] || w < gap[i] {
+					n.pass[i], gap[i], sides[i] = true, w, [2]int32{a, b}
+				}
+			}
+		}
+	}
+
+	for i := range visited {
+		visited[i] = false
+	}
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			if visited[y*width+x] || !n.pass[y*width+x] {
+				continue
+			}
+			tiles := flood(x, y, func(x, y int) bool { return n.pass[y*width+x] })
+			p := mountainPass{ID: len(n.Passes) + 1, Size: len(tiles), Width: maxPassWidth}
+			sumX, sumY, sumMagnitude := 0, 0, 0.0
+			ridges := make(map[int]bool)
+			for _, c := range tiles {
+				i := c.Y*width + c.X
+				sumX += c.X
+				sumY += c.Y
+				sumMagnitude += terrain.at(c.X, c.Y).Magnitude
+				p.Width = min(p.Width, gap[i])
+				ridges[int(sides[i][0])+1] = true
+				ridges[int(sides[i][1])+1] = true
+			}
+			cx, cy := float64(sumX)/float64(p.Size), float64(sumY)/float64(p.Size)
+			best := math.Inf(1)
+			for _, c := range tiles {
+				if d := math.Hypot(float64(c.X)-cx, float64(c.Y)-cy); d < best {
+					best, p.Coordinates = d, [2]int{c.X, c.Y}
+				}
+			}
+			p.Magnitude = int(math.Round(sumMagnitude / float64(p.Size)))
+			for id := range ridges {
+				p.Ridges = append(p.Ridges, id)
+			}
+			sort.Ints(p.Ridges)
+			n.Passes = append(n.Passes, p)
+		}
+	}
+	return n
+}
+
+// flagRidgesImpassable turns the ridge tiles of n into impassable terrain,
+// leaving the passes through them as the only ways across, and returns the
+// number of tiles changed. See GeneratorConfig.ImpassableRidges.
+func flagRidgesImpassable(terrain *terrainGrid, n *ridgeNetwork) int {
+	flagged := 0
+	for i := range terrain.Tiles {
+		if n.labels[i] >= 0 {
+			terrain.Tiles[i] = Terrain{Type: Impassable}
+			flagged++
+		}
+	}
+	return flagged
+}
@@ -0,0 +1,347 @@
+package mapgen
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// riversConfig is the optional "generator.rivers" section of info.json: the
+// shape of the narrow water detectRivers marks as rivers and, with Keep,
+// whether keepRivers keeps small river-shaped lakes.
+type riversConfig struct {
+	// MaxWidth is the widest channel, in tiles, that is a river.
+	MaxWidth int `json:"max_width"`
+	// MinLength is the shortest river, in tiles along the longer side of
+	// its bounding box.
+	MinLength int `json:"min_length"`
+	// Keep keeps chains of small narrow lakes that touch larger water only
+	// diagonally, instead of filling them, see keepRivers. On by default.
+	Keep bool `json:"keep"`
+}
+
+// defaultRiversConfig returns the settings used when info.json has no
+// "generator.rivers" section, or leaves a field of it unset.
+func defaultRiversConfig() riversConfig {
+	return riversConfig{MaxWidth: 4, MinLength: 16, Keep: true}
+}
+
+// UnmarshalJSON fills in the defaults of the fields the section omits.
+func (c *riversConfig) UnmarshalJSON(data []byte) error {
+	type plain riversConfig
+	cfg := plain(defaultRiversConfig())
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return err
+	}
+	*c = riversConfig(cfg)
+	return nil
+}
+
+func (c *riversConfig) validate() error {
+	if c.MaxWidth < 1 || c.MaxWidth > 32 {
+		return fmt.Errorf("\"max_width\" (%d) must be between 1 and 32", c.MaxWidth)
+	}
+	if c.MinLength < 2 {
+		return fmt.Errorf("\"min_length\" (%d) must be at least 2", c.MinLength)
+	}
+	return nil
+}
+
+// riverDepth returns the largest distance to land, as processDistToLand
+// measures it from 0 on shoreline water, of a channel cfg.MaxWidth tiles
+// wide.
+func (c riversConfig) riverDepth() int {
+	return (c.MaxWidth - 1) / 2
+}
+
+// keepRivers runs before processWater and keeps the rivers it would fill:
+// hand-painted rivers often step diagonally, which breaks them into small
+// lakes that only touch each other, and the sea, at their corners. Small
+// lakes, under minLakeSize and without a key colour, that are narrow are
+// chained through their diagonal contacts; a chain that touches a larger or
+// keyed body and spans at least cfg.MinLength tiles is kept as a river, its
+// corner contacts carved into water so that boats can sail through it. It
+// returns the number of rivers kept.
+func keepRivers(ctx context.Context, terrain *terrainGrid, cfg riversConfig, minLakeSize int, wrapX bool, scratch *floodScratch) int {
+	logger := LoggerFromContext(ctx)
+	width := terrain.Width
+	height := terrain.Height
+	visited := scratch.visitedFor(width * height)
+
+	// Label the water bodies, as processWater finds them.
+	body := make([]int32, width*height)
+	for i := range body {
+		body[i] = -1
+	}
+	var bodies []areaSpan
+	scratch.area = scratch.area[:0]
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			if terrain.at(x, y).Type != Water || visited.has(y*width+x) {
+				continue
+			}
+			start := len(scratch.area)
+			scratch.area = getArea(x, y, terrain, wrapX, visited, scratch.area)
+			span := areaSpan{start: start, size: len(scratch.area) - start}
+			for _, c := range scratch.coords(span) {
+				body[c.Y*width+c.X] = int32(len(bodies))
+			}
+			bodies = append(bodies, span)
+		}
+	}
+
+	// Small narrow lakes are candidates; bodies processWater keeps are the
+	// water they may connect to.
+	kept := make([]bool, len(bodies))
+	candidate := make([]bool, len(bodies))
+	var buf [4]Coord
+	depth := make(map[Coord]int)
+	for b, span := range bodies {
+		coords := scratch.coords(span)
+		oceanKey, lakeKey, riverKey := waterBodyKeys(terrain, coords)
+		if span.size >= minLakeSize || oceanKey || lakeKey || riverKey {
+			kept[b] = true
+			continue
+		}
+		// Measure the body's depth from its shoreline through the body.
+		clear(depth)
+		queue := make([]Coord, 0, len(coords))
+		for _, c := range coords {
+			n := neighborCoordsWrap(c.X, c.Y, width, height, wrapX, &buf)
+			for _, nb := range buf[:n] {
+				if terrain.at(nb.X, nb.Y).Type == Land {
+					depth[c] = 0
+					queue = append(queue, c)
+					break
+				}
+			}
+		}
+		narrow := len(queue) > 0
+		for head := 0; head < len(queue) && narrow; head++ {
+			c := queue[head]
+			n := neighborCoordsWrap(c.X, c.Y, width, height, wrapX, &buf)
+			for _, nb := range buf[:n] {
+				if _, seen := depth[nb]; seen || body[nb.Y*width+nb.X] != int32(b) {
+					continue
+				}
+				depth[nb] = depth[c] + 1
+				if depth[nb] > cfg.riverDepth() {
+					narrow = false
+				}
+				queue = append(queue, nb)
+			}
+		}
+		candidate[b] = narrow
+	}
+
+	// Chain candidates through their diagonal contacts.
+	parent := make([]int, len(bodies))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	diagonal := func(x, y, dx, dy int) (int, int, bool) {
+		nx, ny := x+dx, y+dy
+		if wrapX {
+			nx = (nx + width) % width
+		}
+		return nx, ny, nx >= 0 && nx < width && ny >= 0 && ny < height
+	}
+	touchesKept := make(map[int]bool)
+	for b, span := range bodies {
+		if !candidate[b] {
+			continue
+		}
+		for _, c := range scratch.coords(span) {
+			for _, d := range [4][2]int{{-1, -1}, {1, -1}, {-1, 1}, {1, 1}} {
+				nx, ny, ok := diagonal(c.X, c.Y, d[0], d[1])
+				if !ok {
+					continue
+				}
+				switch other := body[ny*width+nx]; {
+				case other < 0 || other == int32(b):
+				case candidate[other]:
+					parent[find(int(other))] = find(b)
+				case kept[other]:
+					touchesKept[b] = true
+				}
+			}
+		}
+	}
+
+	// Measure every chain and keep those that reach kept water and are
+	// long enough.
+	type chain struct {
+		tiles                  int
+		minX, minY, maxX, maxY int
+		touches                bool
+		first                  Coord
+	}
+	chains := make(map[int]*chain)
+	for b, span := range bodies {
+		if !candidate[b] {
+			continue
+		}
+		root := find(b)
+		ch := chains[root]
+		if ch == nil {
+			ch = &chain{minX: math.MaxInt, minY: math.MaxInt, maxX: -1, maxY: -1, first: scratch.coords(span)[0]}
+			chains[root] = ch
+		}
+		ch.tiles += span.size
+		ch.touches = ch.touches || touchesKept[b]
+		for _, c := range scratch.coords(span) {
+			ch.minX, ch.minY = min(ch.minX, c.X), min(ch.minY, c.Y)
+			ch.maxX, ch.maxY = max(ch.maxX, c.X), max(ch.maxY, c.Y)
+		}
+	}
+	keep := make(map[int]bool)
+	for root, ch := range chains {
+		if !ch.touches {
+			continue
+		}
+		length := max(ch.maxX-ch.minX, ch.maxY-ch.minY) + 1
+		if length < cfg.MinLength {
+			logger.Debug(fmt.Sprintf("Not keeping river-shaped lakes at %d,%d (size %d): %d tile(s) long, below the minimum of %d", ch.first.X, ch.first.Y, ch.tiles, length, cfg.MinLength), RemovalLogTag)
+			continue
+		}
+		keep[root] = true
+		logger.Debug(fmt.Sprintf("Keeping river at %d,%d (size %d, %d tile(s) long)", ch.first.X, ch.first.Y, ch.tiles, length), RemovalLogTag)
+	}
+
+	// Carve the corner contacts of kept chains, turning one of the two land
+	// tiles beside each contact into water, and mark their tiles.
+	carved := 0
+	for b, span := range bodies {
+		if !candidate[b] || !keep[find(b)] {
+			continue
+		}
+		for _, c := range scratch.coords(span) {
+			terrain.at(c.X, c.Y).River = true
+			for _, d := range [4][2]int{{-1, -1}, {1, -1}, {-1, 1}, {1, 1}} {
+				nx, ny, ok := diagonal(c.X, c.Y, d[0], d[1])
+				if !ok || body[ny*width+nx] < 0 || body[ny*width+nx] == int32(b) {
+					continue
+				}
+				ax, _, _ := diagonal(c.X, c.Y, d[0], 0)
+				if terrain.at(ax, c.Y).Type == Water || terrain.at(c.X, ny).Type == Water {
+					continue
+				}
+				switch {
+				case terrain.at(ax, c.Y).Type == Land:
+					*terrain.at(ax, c.Y) = Terrain{Type: Water, River: true}
+				case terrain.at(c.X, ny).Type == Land:
+					*terrain.at(c.X, ny) = Terrain{Type: Water, River: true}
+				default:
+					continue
+				}
+				carved++
+			}
+		}
+	}
+	if len(keep) > 0 {
+		logger.Debug(fmt.Sprintf("Kept %d river(s) of small lakes, carving %d corner contact(s) into water", len(keep), carved))
+	}
+	return len(keep)
+}
+
+// detectRivers runs after processWater and marks the rivers of the water
+// left: water tiles of channels at most cfg.MaxWidth tiles wide, found as
+// the water further than the channel half-width from any wider water, in
+// 4-connected runs spanning at least cfg.MinLength tiles, together with the
+// tiles of "river" key colours and those keepRivers kept. Straits between
+// landmasses are rivers too: to boats they are the same narrow water. It
+// returns the number of river tiles.
+func detectRivers(ctx context.Context, terrain *terrainGrid, cfg riversConfig, wrapX bool, scratch *floodScratch) int {
+	width := terrain.Width
+	height := terrain.Height
+
+	// Grow the water deeper than a river by the river depth plus one:
+	// whatever it covers belongs to wider water.
+	reach := cfg.riverDepth() + 1
+	wide := make([]int32, width*height)
+	var queue []Coord
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			wide[y*width+x] = -1
+			if t := *terrain.at(x, y); t.Type == Water && t.Magnitude > float64(cfg.riverDepth()) {
+				wide[y*width+x] = 0
+				queue = append(queue, Coord{X: x, Y: y})
+			}
+		}
+	}
+	var buf [4]Coord
+	for head := 0; head < len(queue); head++ {
+		c := queue[head]
+		d := wide[c.Y*width+c.X]
+		if int(d) >= reach {
+			continue
+		}
+		n := neighborCoordsWrap(c.X, c.Y, width, height, wrapX, &buf)
+		for _, nb := range buf[:n] {
+			if i := nb.Y*width + nb.X; wide[i] < 0 && terrain.at(nb.X, nb.Y).Type == Water {
+				wide[i] = d + 1
+				queue = append(queue, nb)
+			}
+		}
+	}
+
+	// Keep the runs of narrow water that are long enough and have a shore.
+	visited := scratch.visitedFor(width * height)
+	tiles := 0
+	rivers := 0
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			if visited.has(y*width+x) || terrain.at(x, y).Type != Water || wide[y*width+x] >= 0 {
+				continue
+			}
+			run := []Coord{{X: x, Y: y}}
+			visited.set(y*width + x)
+			minX, minY, maxX, maxY := x, y, x, y
+			shore := false
+			for head := 0; head < len(run); head++ {
+				c := run[head]
+				minX, minY, maxX, maxY = min(minX, c.X), min(minY, c.Y), max(maxX, c.X), max(maxY, c.Y)
+				shore = shore || terrain.at(c.X, c.Y).Shoreline
+				n := neighborCoordsWrap(c.X, c.Y, width, height, wrapX, &buf)
+				for _, nb := range buf[:n] {
+					i := nb.Y*width + nb.X
+					if !visited.has(i) && terrain.at(nb.X, nb.Y).Type == Water && wide[i] < 0 {
+						visited.set(i)
+						run = append(run, nb)
+					}
+				}
+			}
+			if !shore || max(maxX-minX, maxY-minY)+1 < cfg.MinLength {
+				continue
+			}
+			rivers++
+			for _, c := range run {
+				terrain.at(c.X, c.Y).River = true
+			}
+		}
+	}
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			t := terrain.at(x, y)
+			if t.Type == Water && t.Key == keyRiver {
+				t.River = true
+			}
+			if t.Type != Water {
+				t.River = false
+			}
+			if t.River {
+				tiles++
+			}
+		}
+	}
+	LoggerFromContext(ctx).Debug(fmt.Sprintf("Marked %d river tile(s), %d narrow channel(s) of up to %d tile(s) wide", tiles, rivers, cfg.MaxWidth))
+	return tiles
+}
@@ -0,0 +1,96 @@
+package mapgen
+
+import (
+	"context"
+	"fmt"
+)
+
+// Salinity of water tiles in salinity.bin. Non-water tiles are
+// salinityNone.
+const (
+	salinityNone byte = iota
+	salinityFresh
+	salinitySalt
+)
+
+// WaterSalinity tags every water body of a map as salt or fresh water.
+type WaterSalinity struct {
+	Salt        []bool // by water body index, see layerInput.WaterBodies
+	SaltTiles   int
+	FreshTiles  int
+	SaltBodies  int
+	FreshBodies int
+}
+
+// classifySalinity tags water bodies connected to the ocean as salt water
+// and isolated ones as fresh water. A body is connected to the ocean if it
+// is the ocean (the largest body, see processWater) or touches the map edge,
+// beyond which the sea continues; every other body is an inland lake, like
+// the Caspian, even when it is large. On maps that wrap horizontally only
+// the north and south edges count. Bodies marked with a lake key colour are
+// always fresh water.
+func classifySalinity(terrain *terrainGrid, bodies *componentLabels, wrapX bool) *WaterSalinity {
+	width := terrain.Width
+	height := terrain.Height
+	s := &WaterSalinity{Salt: make([]bool, len(bodies.Sizes))}
+	lake := make([]bool, len(bodies.Sizes))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			label := bodies.Labels[y*width+x]
+			if label < 0 {
+				continue
+			}
+			if terrain.at(x, y).Ocean || y == 0 || y == height-1 || !wrapX && (x == 0 || x == width-1) {
+				s.Salt[label] = true
+			}
+			if terrain.at(x, y).Key == KeyLake {
+				lake[label] = true
+			}
+		}
+	}
+	for i, salt := range s.Salt {
+		if salt && lake[i] {
+			s.Salt[i], salt = false, false
+		}
+		if salt {
+			s.SaltTiles += bodies.Sizes[i]
+			s.SaltBodies++
+		} else {
+			s.FreshTiles += bodies.Sizes[i]
+			s.FreshBodies++
+		}
+	}
+	return s
+}
+
+// salinityLayer exports whether each water tile is salt or fresh water,
+// for rules such as keeping warships off lakes: one byte per tile,
+// row-major like map.bin, holding salinitySalt, salinityFresh or
+// salinityNone.
+var salinityLayer = auxLayer{
+	Name:      "salinity",
+	File:      "salinity.bin",
+	TileBytes: 1,
+	Summary:   "salt (ocean-connected) or fresh (isolated) water of every tile",
+	Build: func(ctx context.Context, in *layerInput) ([]byte, map[string]any, error) {
+		bodies := in.WaterBodies()
+		salinity := in.Salinity()
+		width := in.Terrain.Width
+		height := in.Terrain.Height
+		data := make([]byte, width*height)
+		for x := 0; x < width; x++ {
+			for y := 0; y < height; y++ {
+				label := bodies.Labels[y*width+x]
+				switch {
+				case label < 0:
+				case salinity.Salt[label]:
+					data[y*width+x] = salinitySalt
+				default:
+					data[y*width+x] = salinityFresh
+				}
+			}
+		}
+		LoggerFromContext(ctx).Debug(fmt.Sprintf("Salinity: %d salt and %d fresh water bodies", salinity.SaltBodies, salinity.FreshBodies))
+		return data, map[string]any{"width": width, "height": height}, nil
+	},
+}
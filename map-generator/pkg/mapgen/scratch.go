@@ -0,0 +1,80 @@
+package mapgen
+
+// floodScratch holds the buffers shared by the flood-fill passes of a single
+// map build (removeSmallIslands, processWater, processShore and
+// processDistToLand). The passes run one after another, splitting rows
+// between goroutines only within a pass, and the grids only shrink from one
+// scale to the next, so each buffer is allocated once at full-scale size and
+// re-sliced for every later pass instead of being reallocated millions of
+// times over a full-registry run.
+//
+// A floodScratch must not be shared between concurrently running map builds.
+type floodScratch struct {
+	visited bitset
+	// area is an arena holding the tiles of every body found by a pass back
+	// to back; bodies refer to it by areaSpan instead of owning a slice.
+	area  []Coord
+	shore []Coord
+	dist  []int32
+}
+
+// areaSpan locates one contiguous body of tiles inside floodScratch.area.
+type areaSpan struct {
+	start, size int
+}
+
+// newFloodScratch returns a scratch arena sized for grids of up to numTiles
+// tiles.
+func newFloodScratch(numTiles int) *floodScratch {
+	return &floodScratch{
+		visited: newBitset(numTiles),
+		area:    make([]Coord, 0, numTiles),
+		dist:    make([]int32, numTiles),
+	}
+}
+
+// visitedFor returns a cleared visited bitset of n tiles.
+func (s *floodScratch) visitedFor(n int) bitset {
+	words := (n + 63) / 64
+	if cap(s.visited) < words {
+		s.visited = newBitset(n)
+	}
+	s.visited = s.visited[:words]
+	clear(s.visited)
+	return s.visited
+}
+
+// distFor returns a distance buffer of length n. Its contents are undefined;
+// callers initialise every entry they read.
+func (s *floodScratch) distFor(n int) []int32 {
+	if cap(s.dist) < n {
+		s.dist = make([]int32, n)
+	}
+	s.dist = s.dist[:n]
+	return s.dist
+}
+
+// coords returns the tiles of the body described by span.
+func (s *floodScratch) coords(span areaSpan) []Coord {
+	return s.area[span.start : span.start+span.size]
+}
+
+// bitset is a set of tile indices, one bit per tile, for the visited
+// buffers of the flood fills: an eighth of the memory of a []bool, which
+// matters on the largest maps.
+type bitset []uint64
+
+// newBitset returns an empty bitset of n tiles.
+func newBitset(n int) bitset {
+	return make(bitset, (n+63)/64)
+}
+
+// has reports whether tile i is in the set.
+func (b bitset) has(i int) bool {
+	return b[i>>6]&(1<<(uint(i)&63)) != 0
+}
+
+// set adds tile i to the set.
+func (b bitset) set(i int) {
+	b[i>>6] |= 1 << (uint(i) & 63)
+}
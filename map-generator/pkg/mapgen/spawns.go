@@ -0,0 +1,234 @@
+package mapgen
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// spawnConfig is the optional "generator.spawns" section of info.json: how
+// many start locations placeSpawns computes for the manifest "spawns"
+// section, and where they may be.
+type spawnConfig struct {
+	// Count is the number of spawns; 0 places one per recommended player,
+	// see RecommendPlayerCounts.
+	Count int `json:"count"`
+	// MinLandmass is the size, in tiles, of the smallest landmass a spawn
+	// may be on.
+	MinLandmass int `json:"min_landmass"`
+	// OceanAccess only places spawns on landmasses that touch the ocean,
+	// so that every start can build boats and trade.
+	OceanAccess bool `json:"ocean_access"`
+	// Radius is the half-width, in tiles, of the square around a spawn
+	// whose land share scores it; at least half of it must be land.
+	Radius int `json:"radius"`
+}
+
+// UnmarshalJSON fills in the defaults of the fields the section omits.
+func (c *spawnConfig) UnmarshalJSON(data []byte) error {
+	type plain spawnConfig
+	cfg := plain{MinLandmass: minSpawnLandmassSize, OceanAccess: true, Radius: 30}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return err
+	}
+	*c = spawnConfig(cfg)
+	return nil
+}
+
+func (c *spawnConfig) validate() error {
+	if c.Count < 0 || c.Count > maxRecommendedPlayers {
+		return fmt.Errorf("\"count\" (%d) must be between 0 and %d", c.Count, maxRecommendedPlayers)
+	}
+	if c.MinLandmass < 1 {
+		return fmt.Errorf("\"min_landmass\" (%d) must be positive", c.MinLandmass)
+	}
+	if c.Radius < 1 || c.Radius > 200 {
+		return fmt.Errorf("\"radius\" (%d) must be between 1 and 200", c.Radius)
+	}
+	return nil
+}
+
+// spawnMinLandShare is the share of the square of Radius around a spawn
+// that must be land.
+const spawnMinLandShare = 0.5
+
+// SpawnPoint is one entry of the manifest "spawns" section.
+type SpawnPoint struct {
+	Coordinates [2]int `json:"coordinates"`
+	// Score rates the start from 0 to 1: the land share around it,
+	// lowered on higher ground, times its distance to the nearest other
+	// spawn relative to an even spread over the eligible land, capped at 1.
+	Score float64 `json:"score"`
+	// Nearest is the distance in tiles to the nearest other spawn.
+	Nearest int `json:"nearest"`
+}
+
+// placeSpawns computes the start locations of the map's "generator.spawns"
+// section, for balanced free-for-all and nations games on maps without
+// hand-placed spawns. Candidates lie on a grid of a quarter of Radius over
+// the land of eligible landmasses, with at least spawnMinLandShare land
+// around them; each is rated by that land share, times 1 - magnitude/60 so
+// that plains beat mountains. The best rated comes first, then each next
+// spawn is the candidate maximizing its rating times its distance to the
+// spawns already placed, spreading the spawns as far apart as the land
+// allows. The result is nil for maps without the section.
+func placeSpawns(ctx context.Context, in *layerInput) ([]SpawnPoint, error) {
+	cfg := in.Config.Spawns
+	if cfg == nil {
+		return nil, nil
+	}
+	logger := LoggerFromContext(ctx)
+	count := cfg.Count
+	if count == 0 {
+		players, err := ApplyPlayerCountOverrides(RecommendPlayerCounts(in.Stats), in.Info)
+		if err != nil {
+			return nil, err
+		}
+		count = players.Recommended
+	}
+
+	terrain := in.Terrain
+	width := terrain.Width
+	height := terrain.Height
+	landmasses := in.Landmasses()
+	eligible := make([]bool, len(landmasses.Sizes))
+	for l, size := range landmasses.Sizes {
+		eligible[l] = size >= cfg.MinLandmass
+	}
+	if cfg.OceanAccess {
+		coastal := make([]bool, len(landmasses.Sizes))
+		var buf [4]Coord
+		for x := 0; x < width; x++ {
+			for y := 0; y < height; y++ {
+				if terrain.at(x, y).Type != Land || !terrain.at(x, y).Shoreline {
+					continue
+				}
+				n := neighborCoordsWrap(x, y, width, height, in.WrapX, &buf)
+				for _, nb := range buf[:n] {
+					if t := *terrain.at(nb.X, nb.Y); t.Type == Water && t.Ocean {
+						coastal[landmasses.Labels[y*width+x]] = true
+					}
+				}
+			}
+		}
+		for l := range eligible {
+			eligible[l] = eligible[l] && coastal[l]
+		}
+	}
+	eligibleLand := 0
+	for l, ok := range eligible {
+		if ok {
+			eligibleLand += landmasses.Sizes[l]
+		}
+	}
+
+	// Count the land around candidates with a summed-area table, indexed
+	// x*(height+1)+y, of the land tiles above and left of each corner.
+	sat := make([]int32, (width+1)*(height+1))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			land := int32(0)
+			if terrain.at(x, y).Type == Land {
+				land = 1
+			}
+			sat[(x+1)*(height+1)+y+1] = land + sat[x*(height+1)+y+1] + sat[(x+1)*(height+1)+y] - sat[x*(height+1)+y]
+		}
+	}
+	landShare := func(x, y int) float64 {
+		x0, y0 := max(x-cfg.Radius, 0), max(y-cfg.Radius, 0)
+		x1, y1 := min(x+cfg.Radius+1, width), min(y+cfg.Radius+1, height)
+		land := sat[x1*(height+1)+y1] - sat[x0*(height+1)+y1] - sat[x1*(height+1)+y0] + sat[x0*(height+1)+y0]
+		side := float64(2*cfg.Radius + 1)
+		return float64(land) / (side * side)
+	}
+
+	type candidate struct {
+		X, Y    int
+		Quality float64
+	}
+	var candidates []candidate
+	step := max(1, cfg.Radius/4)
+	for x := step / 2; x < width; x += step {
+		for y := step / 2; y < height; y += step {
+			t := *terrain.at(x, y)
+			if t.Type != Land || !eligible[landmasses.Labels[y*width+x]] {
+				continue
+			}
+			share := landShare(x, y)
+			if share < spawnMinLandShare {
+				continue
+			}
+			candidates = append(candidates, candidate{X: x, Y: y, Quality: share * (1 - t.Magnitude/60)})
+		}
+	}
+
+	distance := func(a, b candidate) float64 {
+		dx := math.Abs(float64(a.X - b.X))
+		if in.WrapX {
+			dx = math.Min(dx, float64(width)-dx)
+		}
+		return math.Hypot(dx, float64(a.Y-b.Y))
+	}
+	nearest := make([]float64, len(candidates))
+	for i := range nearest {
+		nearest[i] = math.Inf(1)
+	}
+	var chosen []candidate
+	for len(chosen) < count {
+		best, bestValue := -1, 0.0
+		for i, c := range candidates {
+			value := c.Quality
+			if len(chosen) > 0 {
+				value *= nearest[i]
+			}
+			if value > bestValue {
+				best, bestValue = i, value
+			}
+		}
+		if best < 0 {
+			break
+		}
+		c := candidates[best]
+		chosen = append(chosen, c)
+		for i := range candidates {
+			nearest[i] = math.Min(nearest[i], distance(candidates[i], c))
+		}
+	}
+	if len(chosen) < count {
+		where := fmt.Sprintf("landmasses of at least %d tiles", cfg.MinLandmass)
+		if cfg.OceanAccess {
+			where += " touching the ocean"
+		}
+		logger.Warn(fmt.Sprintf("Only %d of %d spawn(s) fit on %s with %.0f%% land around them", len(chosen), count, where, 100*spawnMinLandShare))
+	}
+	if len(chosen) == 0 {
+		return []SpawnPoint{}, nil
+	}
+
+	// An even spread gives every spawn a square of the eligible land.
+	spacing := math.Sqrt(float64(eligibleLand) / float64(len(chosen)))
+	spawns := make([]SpawnPoint, len(chosen))
+	closest, scoreSum := 0, 0.0
+	for i, c := range chosen {
+		d := math.Inf(1)
+		for j, other := range chosen {
+			if j != i {
+				d = math.Min(d, distance(c, other))
+			}
+		}
+		spread := 1.0
+		if !math.IsInf(d, 1) {
+			spread = math.Min(1, d/spacing)
+			spawns[i].Nearest = int(math.Round(d))
+		}
+		spawns[i].Coordinates = [2]int{c.X, c.Y}
+		spawns[i].Score = math.Round(100*c.Quality*spread) / 100
+		if i == 0 || spawns[i].Nearest < closest {
+			closest = spawns[i].Nearest
+		}
+		scoreSum += spawns[i].Score
+	}
+	logger.Debug(fmt.Sprintf("Placed %d spawn(s) among %d candidate(s), the closest %d tile(s) apart, mean score %.2f", len(spawns), len(candidates), closest, scoreSum/float64(len(spawns))))
+	return spawns, nil
+}
@@ -0,0 +1,73 @@
+package mapgen
+
+import (
+	"context"
+	"fmt"
+	"math"
+)
+
+// spawnRegionSize is the side, in tiles, of a spawn weight region.
+const spawnRegionSize = 16
+
+// spawnWeightsLayer rates how suitable each region of the map is for bots
+// and nations to spawn on and expand into. Bots pick spawn points uniformly
+// over land today, so on archipelago maps many of them start on tiny islands
+// and are eliminated immediately.
+var spawnWeightsLayer = auxLayer{
+	Name:      "spawn_weights",
+	File:      "spawn_weights.bin",
+	TileBytes: 0.01,
+	Summary:   "per-region spawn preference for bots and nations",
+	Build:     buildSpawnWeights,
+}
+
+// buildSpawnWeights divides the map into spawnRegionSize×spawnRegionSize
+// regions and writes one byte per region, row-major (index y*width+x over
+// the region grid), from 0 (never spawn) to 255 (ideal). A region's weight is
+// the mean over its tiles of:
+//
+//	landmass factor × elevation factor
+//
+// where the landmass factor is 0 for water and for landmasses smaller than
+// minSpawnLandmassSize, rising linearly to 1 for landmasses of at least
+// landTilesPerPlayer tiles, and the elevation factor falls from 1 on plains
+// to 0.6 on the highest mountains, which are slow to expand into.
+func buildSpawnWeights(ctx context.Context, in *layerInput) ([]byte, map[string]any, error) {
+	terrain := in.Terrain
+	width := terrain.Width
+	height := terrain.Height
+	landmasses := in.Landmasses()
+
+	regionsX := (width + spawnRegionSize - 1) / spawnRegionSize
+	regionsY := (height + spawnRegionSize - 1) / spawnRegionSize
+	sums := make([]float64, regionsX*regionsY)
+	counts := make([]int, regionsX*regionsY)
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			r := (y/spawnRegionSize)*regionsX + x/spawnRegionSize
+			counts[r]++
+			size := landmasses.SizeAt(y*width + x)
+			if size < minSpawnLandmassSize {
+				continue
+			}
+			landmass := math.Min(1, float64(size-minSpawnLandmassSize)/float64(landTilesPerPlayer-minSpawnLandmassSize))
+			elevation := 1 - 0.4*math.Min(terrain.at(x, y).Magnitude, 30)/30
+			sums[r] += landmass * elevation
+		}
+	}
+
+	data := make([]byte, len(sums))
+	spawnable := 0
+	for r := range sums {
+		data[r] = byte(math.Round(255 * sums[r] / float64(counts[r])))
+		if data[r] > 0 {
+			spawnable++
+		}
+	}
+	LoggerFromContext(ctx).Debug(fmt.Sprintf("Spawn weights: %d of %d regions spawnable", spawnable, len(data)))
+	return data, map[string]any{
+		"region_size": spawnRegionSize,
+		"width":       regionsX,
+		"height":      regionsY,
+	}, nil
+}
@@ -0,0 +1,87 @@
+package mapgen
+
+import (
+	"context"
+	"fmt"
+	"math"
+)
+
+// strategicCellSize is the side, in full-scale tiles, of a strategic layer
+// cell: 1/64 of the tile count.
+const strategicCellSize = 8
+
+// Flags in the third byte of a strategic layer cell.
+const (
+	strategicCoast      = 1 << iota // contains land touching water
+	strategicOcean                  // contains ocean water
+	strategicLake                   // contains non-ocean water
+	strategicImpassable             // contains impassable terrain
+)
+
+// strategicLayer is an ultra-coarse summary of the map for high-level
+// planning by the server AI, where even the 1/16 scale map is too fine on
+// giant maps.
+var strategicLayer = auxLayer{
+	Name:      "strategic",
+	File:      "map64x.bin",
+	TileBytes: 0.01,
+	Summary:   "1/64 scale land, elevation and coast summary for server AI",
+	Build:     buildStrategic,
+}
+
+// buildStrategic summarises each strategicCellSize×strategicCellSize block of
+// full-scale tiles as three bytes, cells row-major (index y*width+x):
+//
+//	0: land fraction of the block's tiles, 0-255
+//	1: average magnitude of its land tiles (0-30), times 8
+//	2: flags: 1 coast, 2 ocean, 4 lake, 8 impassable
+//
+// Blocks at the right and bottom edges may be partial.
+func buildStrategic(ctx context.Context, in *layerInput) ([]byte, map[string]any, error) {
+	terrain := in.Terrain
+	width := terrain.Width
+	height := terrain.Height
+	cellsX := (width + strategicCellSize - 1) / strategicCellSize
+	cellsY := (height + strategicCellSize - 1) / strategicCellSize
+
+	tiles := make([]int, cellsX*cellsY)
+	land := make([]int, cellsX*cellsY)
+	magnitude := make([]float64, cellsX*cellsY)
+	data := make([]byte, 3*cellsX*cellsY)
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			c := (y/strategicCellSize)*cellsX + x/strategicCellSize
+			tile := *terrain.at(x, y)
+			tiles[c]++
+			switch tile.Type {
+			case Land:
+				land[c]++
+				magnitude[c] += math.Min(tile.Magnitude, 30)
+				if tile.Shoreline {
+					data[3*c+2] |= strategicCoast
+				}
+			case Water:
+				if tile.Ocean {
+					data[3*c+2] |= strategicOcean
+				} else {
+					data[3*c+2] |= strategicLake
+				}
+			case Impassable:
+				data[3*c+2] |= strategicImpassable
+			}
+		}
+	}
+	for c := range tiles {
+		data[3*c] = byte(math.Round(255 * float64(land[c]) / float64(tiles[c])))
+		if land[c] > 0 {
+			data[3*c+1] = byte(math.Round(8 * magnitude[c] / float64(land[c])))
+		}
+	}
+	LoggerFromContext(ctx).Debug(fmt.Sprintf("Strategic layer: %dx%d cells", cellsX, cellsY))
+	return data, map[string]any{
+		"width":          cellsX,
+		"height":         cellsY,
+		"cell_size":      strategicCellSize,
+		"bytes_per_cell": 3,
+	}, nil
+}
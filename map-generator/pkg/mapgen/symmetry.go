@@ -0,0 +1,63 @@
+package mapgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Symmetry axes of "generator.symmetry", each the transform that must map
+// the map onto itself.
+var SymmetryAxes = map[string]MapTransform{
+	"mirror_h":   {Flip: "h"},             // left to right
+	"mirror_v":   {Flip: "v"},             // top to bottom
+	"rotate_180": {Rotate: 180},           // point symmetry about the centre
+	"rotate_90":  {Rotate: 90},            // four-fold, square maps only
+	"diagonal":   {Rotate: 90, Flip: "h"}, // about the main diagonal, square maps only
+}
+
+// SymmetryConfig is the "generator.symmetry" section, declaring the axes a
+// map is symmetric under.
+type SymmetryConfig struct {
+	// Axes are the names of SymmetryAxes the map is symmetric under.
+	Axes []string `json:"axes"`
+	// Competitive marks maps for ranked play, whose symmetry is enforced
+	// under --strict.
+	Competitive bool `json:"competitive"`
+	// MaxMismatch is the largest share of tiles, in percent, allowed to
+	// differ from their image under an axis.
+	MaxMismatch float64 `json:"max_mismatch"`
+}
+
+// UnmarshalJSON fills in the defaults of the fields the section omits.
+func (c *SymmetryConfig) UnmarshalJSON(data []byte) error {
+	type plain SymmetryConfig
+	cfg := plain{MaxMismatch: 1}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return err
+	}
+	*c = SymmetryConfig(cfg)
+	return nil
+}
+
+// validate checks the section's settings.
+func (c *SymmetryConfig) validate() error {
+	if len(c.Axes) == 0 {
+		return fmt.Errorf("axes must list at least one axis")
+	}
+	names := make([]string, 0, len(SymmetryAxes))
+	for name := range SymmetryAxes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, axis := range c.Axes {
+		if _, ok := SymmetryAxes[axis]; !ok {
+			return fmt.Errorf("axis %q must be one of: %s", axis, strings.Join(names, ", "))
+		}
+	}
+	if c.MaxMismatch < 0 || c.MaxMismatch > 100 {
+		return fmt.Errorf("max_mismatch (%g) must be between 0 and 100", c.MaxMismatch)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package mapgen
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// tradeMatrixLayer exports ocean travel distances between the nations of a
+// map, for trade income on the server and offline balance analysis.
+var tradeMatrixLayer = auxLayer{
+	Name:      "trade_matrix",
+	File:      "trade_matrix.json",
+	TileBytes: 0.01,
+	Summary:   "ocean distances between nation ports",
+	Build:     buildTradeMatrix,
+}
+
+// tradeMatrix is the contents of trade_matrix.json.
+type tradeMatrix struct {
+	Nations []string `json:"nations"`
+	// Scales holds one matrix per mini-map resolution, keyed by manifest
+	// section ("map4x", "map16x").
+	Scales map[string]tradeMatrixScale `json:"scales"`
+}
+
+// tradeMatrixScale holds the distances computed on one mini map.
+type tradeMatrixScale struct {
+	// Scale is the factor from this resolution's tiles to full-scale tiles.
+	Scale int `json:"scale"`
+	// Ports holds the [x, y] water tile used as each nation's port, in this
+	// resolution's coordinates, or null if the nation has no reachable coast.
+	Ports []*[2]int `json:"ports"`
+	// Distances[i][j] is the ocean distance from nation i's port to nation
+	// j's, in this resolution's tiles, or -1 if they don't share a water body.
+	Distances [][]int `json:"distances"`
+}
+
+// buildTradeMatrix gives every nation in info.json a port, the shoreline
+// water tile nearest to its spawn coordinates, and measures the shortest
+// 4-neighbour path over water between every pair of ports. It runs on the
+// 1/4 and 1/16 scale maps, which keeps the all-pairs search cheap on giant
+// maps; multiply by "scale" to approximate full-scale distances. On maps
+// that wrap horizontally, paths continue across the west/east seam.
+func buildTradeMatrix(ctx context.Context, in *layerInput) ([]byte, map[string]any, error) {
+	var info struct {
+		Nations []struct {
+			Name        string `json:"name"`
+			Coordinates [2]int `json:"coordinates"`
+		} `json:"nations"`
+	}
+	if err := json.Unmarshal(in.Info, &info); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse nations: %w", err)
+	}
+
+	matrix := tradeMatrix{
+		Nations: make([]string, len(info.Nations)),
+		Scales:  make(map[string]tradeMatrixScale),
+	}
+	for i, n := range info.Nations {
+		matrix.Nations[i] = n.Name
+	}
+	for _, s := range []struct {
+		section string
+		scale   int
+		terrain *terrainGrid
+	}{
+		{"map4x", 2, in.Terrain4x},
+		{"map16x", 4, in.Terrain16x},
+	} {
+		width := s.terrain.Width
+		height := s.terrain.Height
+		result := tradeMatrixScale{
+			Scale:     s.scale,
+			Ports:     make([]*[2]int, len(info.Nations)),
+			Distances: make([][]int, len(info.Nations)),
+		}
+		for i, n := range info.Nations {
+			x := min(max(n.Coordinates[0]/s.scale, 0), width-1)
+			y := min(max(n.Coordinates[1]/s.scale, 0), height-1)
+			if port, ok := nearestShorelineWater(s.terrain, Coord{X: x, Y: y}, in.WrapX); ok {
+				result.Ports[i] = &[2]int{port.X, port.Y}
+			}
+		}
+		dist := make([]int32, width*height)
+		for i := range info.Nations {
+			result.Distances[i] = make([]int, len(info.Nations))
+			if result.Ports[i] == nil {
+				for j := range result.Distances[i] {
+					result.Distances[i][j] = -1
+				}
+				continue
+			}
+			waterDistances(s.terrain, Coord{X: result.Ports[i][0], Y: result.Ports[i][1]}, in.WrapX, dist)
+			for j, port := range result.Ports {
+				result.Distances[i][j] = -1
+				if port != nil {
+					result.Distances[i][j] = int(dist[port[1]*width+port[0]])
+				}
+			}
+		}
+		matrix.Scales[s.section] = result
+	}
+
+	data, err := json.MarshalIndent(matrix, "", "  ")
+	if err != nil {
+		return nil, nil, err
+	}
+	LoggerFromContext(ctx).Debug(fmt.Sprintf("Trade matrix: %d nations", len(info.Nations)))
+	return data, map[string]any{"nations": len(info.Nations)}, nil
+}
+
+// nearestShorelineWater returns the shoreline water tile closest to start
+// by 4-neighbour steps over land and water. If wrapX is true, steps continue
+// across the west/east seam.
+func nearestShorelineWater(terrain *terrainGrid, start Coord, wrapX bool) (Coord, bool) {
+	width := terrain.Width
+	height := terrain.Height
+	visited := make([]bool, width*height)
+	visited[start.Y*width+start.X] = true
+	queue := []Coord{start}
+	var buf [4]Coord
+	for head := 0; head < len(queue); head++ {
+		c := queue[head]
+		if tile := terrain.at(c.X, c.Y); tile.Type == Water && tile.Shoreline {
+			return c, true
+		}
+		n := neighborCoordsWrap(c.X, c.Y, width, height, wrapX, &buf)
+		for _, nc := range buf[:n] {
+			i := nc.Y*width + nc.X
+			if !visited[i] && terrain.at(nc.X, nc.Y).Type != Impassable {
+				visited[i] = true
+				queue = append(queue, nc)
+			}
+		}
+	}
+	return Coord{}, false
+}
+
+// waterDistances fills dist, indexed y*width+x, with the number of
+// 4-neighbour steps over water from start to every tile, or -1 where
+// unreachable. If wrapX is true, steps continue across the west/east seam.
+func waterDistances(terrain *terrainGrid, start Coord, wrapX bool, dist []int32) {
+	width := terrain.Width
+	height := terrain.Height
+	for i := range dist {
+		dist[i] = -1
+	}
+	dist[start.Y*width+start.X] = 0
+	queue := []Coord{start}
+	var buf [4]Coord
+	for head := 0; head < len(queue); head++ {
+		c := queue[head]
+		d := dist[c.Y*width+c.X]
+		n := neighborCoordsWrap(c.X, c.Y, width, height, wrapX, &buf)
+		for _, nc := range buf[:n] {
+			i := nc.Y*width + nc.X
+			if dist[i] < 0 && terrain.at(nc.X, nc.Y).Type == Water {
+				dist[i] = d + 1
+				queue = append(queue, nc)
+			}
+		}
+	}
+}
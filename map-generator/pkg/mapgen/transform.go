@@ -0,0 +1,53 @@
+package mapgen
+
+import "image"
+
+// MapTransform rotates and mirrors a map's grid, for rematches and variant
+// rotations of existing maps. The rotation is applied first, then the flip.
+type MapTransform struct {
+	Rotate int    // clockwise rotation in degrees: 0, 90, 180 or 270
+	Flip   string // "" for none, "h" to mirror left to right, "v" top to bottom
+}
+
+// Size returns the dimensions of a transformed width×height grid.
+func (t MapTransform) Size(width, height int) (int, int) {
+	if t.Rotate == 90 || t.Rotate == 270 {
+		return height, width
+	}
+	return width, height
+}
+
+// Point returns where the tile (x, y) of a width×height grid lands once
+// transformed.
+func (t MapTransform) Point(x, y, width, height int) (int, int) {
+	switch t.Rotate {
+	case 90:
+		x, y = height-1-y, x
+	case 180:
+		x, y = width-1-x, height-1-y
+	case 270:
+		x, y = y, width-1-x
+	}
+	w, h := t.Size(width, height)
+	switch t.Flip {
+	case "h":
+		x = w - 1 - x
+	case "v":
+		y = h - 1 - y
+	}
+	return x, y
+}
+
+// Image returns the transformed width×height top left corner of img.
+func (t MapTransform) Image(img image.Image, width, height int) *image.NRGBA {
+	b := img.Bounds()
+	w, h := t.Size(width, height)
+	out := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			tx, ty := t.Point(x, y, width, height)
+			out.Set(tx, ty, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return out
+}
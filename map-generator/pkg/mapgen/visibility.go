@@ -0,0 +1,140 @@
+package mapgen
+
+import (
+	"context"
+	"fmt"
+	"math"
+)
+
+const (
+	// visibilityCellSize is the size, in tiles of the 1/16 scale map, of the
+	// square cells between which visibility is computed: 32 full-scale
+	// tiles.
+	visibilityCellSize = 8
+	// visibilityRadius is the farthest, in cells along x and y, that
+	// visibility is computed to.
+	visibilityRadius = 12
+	// visibilityEyeHeight is the height, in magnitude steps, of an observer
+	// or target above the highest land of its cell.
+	visibilityEyeHeight = 2
+	// visibilityWindow is the number of cells in the window around a cell.
+	visibilityWindow = (2*visibilityRadius + 1) * (2*visibilityRadius + 1)
+)
+
+// visibilityLayer precomputes which coarse cells of the map see each other
+// over the mountains between them, for a future vision or radar mechanic
+// and for placing SAMs and defenses, which is too expensive at runtime.
+var visibilityLayer = auxLayer{
+	Name:      "visibility",
+	File:      "visibility.bin",
+	TileBytes: 0.1,
+	Summary:   "line-of-sight between coarse cells of the 1/16 scale map",
+	Build:     buildVisibility,
+}
+
+// buildVisibility divides the 1/16 scale map into visibilityCellSize square
+// cells, row-major, the last row and column possibly narrower, and writes
+// for every cell, in order, a bitmask of the cells it sees in the
+// (2·visibilityRadius+1)² window around it. Bit i, least significant first
+// from the first byte, is the cell (dx, dy) away with
+// i = (dy+visibilityRadius)·(2·visibilityRadius+1) + dx+visibilityRadius.
+// Cells outside the map are never visible, except across the seam of maps
+// that wrap horizontally.
+//
+// Each cell is observed from its centre, visibilityEyeHeight above the
+// highest land of the cell; water is at height 0. Two cells see each other
+// when the straight line between them passes over every tile between them,
+// land standing as high as its magnitude. The manifest entry records the
+// geometry and the mean share of the window each cell sees.
+func buildVisibility(ctx context.Context, in *layerInput) ([]byte, map[string]any, error) {
+	terrain := in.Terrain16x
+	width := terrain.Width
+	height := terrain.Height
+	columns := (width + visibilityCellSize - 1) / visibilityCellSize
+	rows := (height + visibilityCellSize - 1) / visibilityCellSize
+
+	elevation := func(x, y int) float64 {
+		if terrain.at(x, y).Type != Land {
+			return 0
+		}
+		return terrain.at(x, y).Magnitude
+	}
+	// Observers stand at the centre of each cell above its highest land.
+	eye := make([]float64, columns*rows)
+	centre := make([][2]float64, columns*rows)
+	for cx := 0; cx < columns; cx++ {
+		for cy := 0; cy < rows; cy++ {
+			x0, y0 := cx*visibilityCellSize, cy*visibilityCellSize
+			x1, y1 := min(x0+visibilityCellSize, width), min(y0+visibilityCellSize, height)
+			highest := 0.0
+			for x := x0; x < x1; x++ {
+				for y := y0; y < y1; y++ {
+					highest = math.Max(highest, elevation(x, y))
+				}
+			}
+			eye[cy*columns+cx] = highest + visibilityEyeHeight
+			centre[cy*columns+cx] = [2]float64{float64(x0+x1) / 2, float64(y0+y1) / 2}
+		}
+	}
+
+	// unobstructed reports whether the line from (x0, y0, h0) to (x1, y1, h1)
+	// passes over the tiles between them, sampled every half tile.
+	unobstructed := func(x0, y0, h0, x1, y1, h1 float64) bool {
+		steps := int(math.Ceil(2 * math.Hypot(x1-x0, y1-y0)))
+		for s := 1; s < steps; s++ {
+			t := float64(s) / float64(steps)
+			x := int(math.Floor(x0 + t*(x1-x0)))
+			y := int(math.Floor(y0 + t*(y1-y0)))
+			if in.WrapX {
+				x = (x%width + width) % width
+			}
+			if elevation(x, y) > h0+t*(h1-h0) {
+				return false
+			}
+		}
+		return true
+	}
+
+	bytesPerCell := (visibilityWindow + 7) / 8
+	data := make([]byte, columns*rows*bytesPerCell)
+	total := 0
+	for cy := 0; cy < rows; cy++ {
+		for cx := 0; cx < columns; cx++ {
+			i := cy*columns + cx
+			for dy := -visibilityRadius; dy <= visibilityRadius; dy++ {
+				for dx := -visibilityRadius; dx <= visibilityRadius; dx++ {
+					tx, ty := cx+dx, cy+dy
+					if in.WrapX {
+						tx = (tx%columns + columns) % columns
+					}
+					if tx < 0 || tx >= columns || ty < 0 || ty >= rows {
+						continue
+					}
+					// The target is seen where it lies from the observer,
+					// which across the seam is beyond the map edge.
+					j := ty*columns + tx
+					x1 := centre[j][0] + float64((cx+dx-tx)*visibilityCellSize)
+					if !unobstructed(centre[i][0], centre[i][1], eye[i], x1, centre[j][1], eye[j]) {
+						continue
+					}
+					bit := (dy+visibilityRadius)*(2*visibilityRadius+1) + dx + visibilityRadius
+					data[i*bytesPerCell+bit/8] |= 1 << (bit % 8)
+					total++
+				}
+			}
+		}
+	}
+
+	mean := float64(total) / float64(columns*rows*visibilityWindow)
+	LoggerFromContext(ctx).Debug(fmt.Sprintf("Visibility: %dx%d cells see %.1f%% of their window on average", columns, rows, 100*mean))
+	return data, map[string]any{
+		"width":          width,
+		"height":         height,
+		"cell_size":      visibilityCellSize,
+		"columns":        columns,
+		"rows":           rows,
+		"radius":         visibilityRadius,
+		"bytes_per_cell": bytesPerCell,
+		"mean_visible":   math.Round(mean*1000) / 1000,
+	}, nil
+}
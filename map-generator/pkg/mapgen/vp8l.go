@@ -0,0 +1,404 @@
+package mapgen
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"math/bits"
+	"sort"
+)
+
+// Limits of the lossless WebP (VP8L) bitstream written by
+// encodeLosslessWebP.
+const (
+	vp8lMaxSide       = 1 << 14
+	vp8lMaxCopyLength = 4096
+	vp8lMaxCodeLength = 15
+	// vp8lMinCopyLength is the shortest run worth a backward reference over
+	// literal pixels.
+	vp8lMinCopyLength = 3
+	// Distance codes of the pixel above and of the pixel to the left, the
+	// first two entries of the format's table of nearby distances.
+	vp8lDistanceAbove = 1
+	vp8lDistanceLeft  = 2
+	// vp8lCacheBits sizes the colour cache of recently seen pixels, which
+	// codes a pixel found there as a single symbol.
+	vp8lCacheBits = 10
+)
+
+// vp8lCodeLengthOrder is the order the lengths of the code length code are
+// written in.
+var vp8lCodeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// vp8lToken is a literal pixel, with Cached set one found in the colour
+// cache at index Pixel, or with Length set a copy of Length pixels from the
+// distance code Distance.
+type vp8lToken struct {
+	Pixel    uint32
+	Cached   bool
+	Length   int
+	Distance int
+}
+
+// encodeLosslessWebP encodes img as a lossless WebP without any of the
+// format's transforms: every pixel is a literal, a colour cache hit or part
+// of a run repeating the pixel to its left or above, and a single group of
+// Huffman codes covers the whole image. Thumbnails are mostly flat water and
+// land in a few colours, which the runs and the cache capture.
+func encodeLosslessWebP(img *image.RGBA) ([]byte, error) {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width < 1 || height < 1 || width > vp8lMaxSide || height > vp8lMaxSide {
+		return nil, fmt.Errorf("cannot encode a %dx%d image as lossless WebP", width, height)
+	}
+	argb := make([]uint32, 0, width*height)
+	alphaUsed := 0
+	for y := 0; y < height; y++ {
+		row := img.Pix[y*img.Stride : y*img.Stride+4*width]
+		for x := 0; x < width; x++ {
+			p := row[4*x : 4*x+4]
+			if p[3] != 255 {
+				alphaUsed = 1
+			}
+			argb = append(argb, uint32(p[3])<<24|uint32(p[0])<<16|uint32(p[1])<<8|uint32(p[2]))
+		}
+	}
+
+	// Greedy backward references: the longest run repeating the left or
+	// the above neighbour, else a literal. Every pixel, copied or not,
+	// enters the colour cache, as decoders fill theirs.
+	var tokens []vp8lToken
+	var cache [1 << vp8lCacheBits]uint32
+	cacheIndex := func(p uint32) uint32 { return (p * 0x1e35a7bd) >> (32 - vp8lCacheBits) }
+	runOf := func(i, dist int) int {
+		n := 0
+		for i+n < len(argb) && n < vp8lMaxCopyLength && argb[i+n] == argb[i+n-dist] {
+			n++
+		}
+		return n
+	}
+	for i := 0; i < len(argb); {
+		length, distance := 0, 0
+		if i >= 1 {
+			length, distance = runOf(i, 1), vp8lDistanceLeft
+		}
+		if i >= width {
+			if n := runOf(i, width); n > length {
+				length, distance = n, vp8lDistanceAbove
+			}
+		}
+		if length >= vp8lMinCopyLength {
+			tokens = append(tokens, vp8lToken{Length: length, Distance: distance})
+			for _, p := range argb[i : i+length] {
+				cache[cacheIndex(p)] = p
+			}
+			i += length
+			continue
+		}
+		p := argb[i]
+		if k := cacheIndex(p); cache[k] == p {
+			tokens = append(tokens, vp8lToken{Pixel: k, Cached: true})
+		} else {
+			tokens = append(tokens, vp8lToken{Pixel: p})
+			cache[k] = p
+		}
+		i++
+	}
+
+	// The green code also holds the 24 length prefixes, see vp8lPrefix,
+	// then the colour cache indices.
+	green := make([]int, 256+24+1<<vp8lCacheBits)
+	red := make([]int, 256)
+	blue := make([]int, 256)
+	alpha := make([]int, 256)
+	distance := make([]int, 40)
+	for _, t := range tokens {
+		if t.Length > 0 {
+			lp, _, _ := vp8lPrefix(t.Length)
+			dp, _, _ := vp8lPrefix(t.Distance)
+			green[256+lp]++
+			distance[dp]++
+			continue
+		}
+		if t.Cached {
+			green[256+24+t.Pixel]++
+			continue
+		}
+		green[t.Pixel>>8&0xff]++
+		red[t.Pixel>>16&0xff]++
+		blue[t.Pixel&0xff]++
+		alpha[t.Pixel>>24]++
+	}
+	codes := [5]vp8lCode{}
+	for i, counts := range [][]int{green, red, blue, alpha, distance} {
+		codes[i] = newVP8LCode(counts, vp8lMaxCodeLength)
+	}
+
+	var w vp8lBitWriter
+	w.write(0x2f, 8) // signature
+	w.write(uint32(width-1), 14)
+	w.write(uint32(height-1), 14)
+	w.write(uint32(alphaUsed), 1)
+	w.write(0, 3) // version
+	w.write(0, 1) // no transform
+	w.write(1, 1) // a colour cache
+	w.write(vp8lCacheBits, 4)
+	w.write(0, 1) // a single group of codes, no meta codes
+	for _, c := range codes {
+		w.writeCode(c)
+	}
+	for _, t := range tokens {
+		if t.Length > 0 {
+			lp, lbits, lextra := vp8lPrefix(t.Length)
+			codes[0].writeSymbol(&w, 256+lp)
+			w.write(uint32(lextra), lbits)
+			dp, dbits, dextra := vp8lPrefix(t.Distance)
+			codes[4].writeSymbol(&w, dp)
+			w.write(uint32(dextra), dbits)
+			continue
+		}
+		if t.Cached {
+			codes[0].writeSymbol(&w, 256+24+int(t.Pixel))
+			continue
+		}
+		codes[0].writeSymbol(&w, int(t.Pixel>>8&0xff))
+		codes[1].writeSymbol(&w, int(t.Pixel>>16&0xff))
+		codes[2].writeSymbol(&w, int(t.Pixel&0xff))
+		codes[3].writeSymbol(&w, int(t.Pixel>>24))
+	}
+	data := w.flush()
+
+	pad := len(data) & 1
+	out := make([]byte, 0, 20+len(data)+pad)
+	out = append(out, "RIFF"...)
+	out = binary.LittleEndian.AppendUint32(out, uint32(12+len(data)+pad))
+	out = append(out, "WEBPVP8L"...)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(data)))
+	out = append(out, data...)
+	if pad == 1 {
+		out = append(out, 0)
+	}
+	return out, nil
+}
+
+// vp8lPrefix returns the prefix symbol of a backward reference length or
+// distance code v >= 1, with the number and value of its extra bits.
+func vp8lPrefix(v int) (symbol, extraBits, extra int) {
+	if v <= 4 {
+		return v - 1, 0, 0
+	}
+	v--
+	high := bits.Len(uint(v)) - 1
+	extraBits = high - 1
+	return 2*high + (v>>extraBits)&1, extraBits, v & (1<<extraBits - 1)
+}
+
+// vp8lCode is a canonical Huffman code. Codes of a single symbol take no
+// bits, as decoders read them.
+type vp8lCode struct {
+	Lengths []uint8
+	Codes   []uint16 // bit-reversed, for writing least significant bit first
+	Used    []int    // the symbols of non-zero length, in increasing order
+}
+
+// newVP8LCode returns a Huffman code of the symbol counts whose codes are at
+// most maxLength bits. Counts are halved until the code fits.
+func newVP8LCode(counts []int, maxLength int) vp8lCode {
+	c := vp8lCode{Lengths: make([]uint8, len(counts)), Codes: make([]uint16, len(counts))}
+	weights := append([]int(nil), counts...)
+	for {
+		if huffmanLengths(weights, c.Lengths) <= maxLength {
+			break
+		}
+		for i, w := range weights {
+			if w > 0 {
+				weights[i] = (w + 1) / 2
+			}
+		}
+	}
+	var perLength [vp8lMaxCodeLength + 1]int
+	for s, l := range c.Lengths {
+		if l > 0 {
+			perLength[l]++
+			c.Used = append(c.Used, s)
+		}
+	}
+	var next [vp8lMaxCodeLength + 1]int
+	code := 0
+	for l := 1; l <= vp8lMaxCodeLength; l++ {
+		code = (code + perLength[l-1]) << 1
+		next[l] = code
+	}
+	for _, s := range c.Used {
+		l := c.Lengths[s]
+		c.Codes[s] = uint16(bits.Reverse16(uint16(next[l])) >> (16 - l))
+		next[l]++
+	}
+	return c
+}
+
+// huffmanLengths sets the Huffman code length of every symbol of non-zero
+// weight, 1 for a lone symbol, and returns the longest.
+func huffmanLengths(weights []int, lengths []uint8) int {
+	type node struct{ weight, parent int }
+	var nodes []node
+	var leaves []int
+	for s, w := range weights {
+		lengths[s] = 0
+		if w > 0 {
+			leaves = append(leaves, s)
+			nodes = append(nodes, node{w, -1})
+		}
+	}
+	switch len(leaves) {
+	case 0:
+		return 0
+	case 1:
+		lengths[leaves[0]] = 1
+		return 1
+	}
+	// Merge the two lightest nodes until one is left; leaves sorted by
+	// weight and the merged nodes, created in increasing weight, form two
+	// queues.
+	order := make([]int, len(leaves))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return nodes[order[i]].weight < nodes[order[j]].weight })
+	var merged []int
+	pop := func() int {
+		if len(merged) == 0 || (len(order) > 0 && nodes[order[0]].weight <= nodes[merged[0]].weight) {
+			n := order[0]
+			order = order[1:]
+			return n
+		}
+		n := merged[0]
+		merged = merged[1:]
+		return n
+	}
+	for len(order)+len(merged) > 1 {
+		a, b := pop(), pop()
+		nodes = append(nodes, node{nodes[a].weight + nodes[b].weight, -1})
+		nodes[a].parent, nodes[b].parent = len(nodes)-1, len(nodes)-1
+		merged = append(merged, len(nodes)-1)
+	}
+	longest := 0
+	for i, s := range leaves {
+		depth := 0
+		for n := i; nodes[n].parent >= 0; n = nodes[n].parent {
+			depth++
+		}
+		lengths[s] = uint8(min(depth, 255))
+		longest = max(longest, depth)
+	}
+	return longest
+}
+
+// writeSymbol writes the code of symbol s.
+func (c *vp8lCode) writeSymbol(w *vp8lBitWriter, s int) {
+	if len(c.Used) > 1 {
+		w.write(uint32(c.Codes[s]), int(c.Lengths[s]))
+	}
+}
+
+// vp8lBitWriter packs bits least significant first.
+type vp8lBitWriter struct {
+	buf   []byte
+	acc   uint64
+	nbits int
+}
+
+func (w *vp8lBitWriter) write(v uint32, n int) {
+	w.acc |= uint64(v) << w.nbits
+	w.nbits += n
+	for w.nbits >= 8 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc >>= 8
+		w.nbits -= 8
+	}
+}
+
+func (w *vp8lBitWriter) flush() []byte {
+	if w.nbits > 0 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc, w.nbits = 0, 0
+	}
+	return w.buf
+}
+
+// writeCode writes the code lengths of c: as a simple code when it has at
+// most two symbols below 256, else as a normal code whose lengths are run
+// length coded with a code length code of their own.
+func (w *vp8lBitWriter) writeCode(c vp8lCode) {
+	if len(c.Used) <= 2 && (len(c.Used) == 0 || c.Used[len(c.Used)-1] < 256) {
+		symbols := c.Used
+		if len(symbols) == 0 {
+			// An unused code still needs a symbol.
+			symbols = []int{0}
+		}
+		w.write(1, 1)
+		w.write(uint32(len(symbols)-1), 1)
+		if symbols[0] < 2 {
+			w.write(0, 1)
+			w.write(uint32(symbols[0]), 1)
+		} else {
+			w.write(1, 1)
+			w.write(uint32(symbols[0]), 8)
+		}
+		if len(symbols) == 2 {
+			w.write(uint32(symbols[1]), 8)
+		}
+		return
+	}
+
+	// Run length code the lengths: 16 repeats the previous non-zero length
+	// 3 to 6 times, 17 and 18 write 3 to 10 and 11 to 138 zeros.
+	type lengthToken struct{ symbol, extraBits, extra int }
+	var tokens []lengthToken
+	previous := uint8(8)
+	for i := 0; i < len(c.Lengths); {
+		l := c.Lengths[i]
+		run := 1
+		for i+run < len(c.Lengths) && c.Lengths[i+run] == l {
+			run++
+		}
+		switch {
+		case l == 0 && run >= 11:
+			run = min(run, 138)
+			tokens = append(tokens, lengthToken{18, 7, run - 11})
+		case l == 0 && run >= 3:
+			tokens = append(tokens, lengthToken{17, 3, run - 3})
+		case l == previous && run >= 3:
+			run = min(run, 6)
+			tokens = append(tokens, lengthToken{16, 2, run - 3})
+		default:
+			run = 1
+			tokens = append(tokens, lengthToken{int(l), 0, 0})
+			if l != 0 {
+				previous = l
+			}
+		}
+		i += run
+	}
+	counts := make([]int, len(vp8lCodeLengthOrder))
+	for _, t := range tokens {
+		counts[t.symbol]++
+	}
+	lengthCode := newVP8LCode(counts, 7)
+	written := 4
+	for i, s := range vp8lCodeLengthOrder {
+		if lengthCode.Lengths[s] > 0 {
+			written = max(written, i+1)
+		}
+	}
+	w.write(0, 1)
+	w.write(uint32(written-4), 4)
+	for _, s := range vp8lCodeLengthOrder[:written] {
+		w.write(uint32(lengthCode.Lengths[s]), 3)
+	}
+	w.write(0, 1) // lengths for the whole alphabet
+	for _, t := range tokens {
+		lengthCode.writeSymbol(w, t.symbol)
+		w.write(uint32(t.extra), t.extraBits)
+	}
+}
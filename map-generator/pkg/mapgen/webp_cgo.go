@@ -0,0 +1,15 @@
+//go:build cgo
+
+package mapgen
+
+import (
+	"image"
+
+	"github.com/chai2010/webp"
+)
+
+// encodeWebP encodes a thumbnail with libwebp, lossy at quality 45 as the
+// JavaScript version did.
+func encodeWebP(img *image.RGBA) ([]byte, error) {
+	return webp.EncodeRGBA(img, 45)
+}
@@ -0,0 +1,12 @@
+//go:build !cgo
+
+package mapgen
+
+import "image"
+
+// encodeWebP encodes a thumbnail without libwebp, which needs cgo, for
+// builds such as GOOS=js GOARCH=wasm: losslessly, so thumbnails are larger
+// than those of the command, see encodeLosslessWebP.
+func encodeWebP(img *image.RGBA) ([]byte, error) {
+	return encodeLosslessWebP(img)
+}
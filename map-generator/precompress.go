@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/andybalholm/brotli"
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+// precompressFlag writes Brotli and gzip compressed copies of every map's
+// binaries and manifest next to them.
+var precompressFlag bool
+
+// precompressedExtensions are the extensions of the precompressed copies.
+var precompressedExtensions = []string{".gz", ".br"}
+
+// compressedSizes sums the sizes of a map's precompressed files.
+type compressedSizes struct {
+	Raw, Gzip, Brotli int64
+}
+
+// precompressMapOutputs precompresses the outputs of a processed map with
+// --precompress, and otherwise removes any precompressed copies left by an
+// earlier run. It returns the sizes, or nil without --precompress.
+func precompressMapOutputs(m mapEntry) (*compressedSizes, error) {
+	outDir, err := outputMapDir(m.IsTest)
+	if err != nil {
+		return nil, err
+	}
+	mapDir := filepath.Join(outDir, m.Name)
+	if !precompressFlag {
+		if err := removePrecompressed(mapDir); err != nil {
+			return nil, fmt.Errorf("failed to remove precompressed files for %s: %w", m.Name, err)
+		}
+		return nil, nil
+	}
+	sizes, err := precompressMap(mapDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to precompress outputs for %s: %w", m.Name, err)
+	}
+	return &sizes, nil
+}
+
+// precompressedFiles returns the files of a map directory that get
+// precompressed copies: the manifest and every file it lists, except the
+// thumbnail, which is already compressed.
+func precompressedFiles(mapDir string) ([]string, error) {
+	buf, err := os.ReadFile(filepath.Join(mapDir, "manifest.json"))
+	if err != nil {
+		return nil, err
+	}
+	var manifest struct {
+		Checksums map[string]string `json:"checksums"`
+	}
+	if err := json.Unmarshal(buf, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	files := []string{"manifest.json"}
+	for file := range manifest.Checksums {
+		if err := checkChecksumFile(file); err != nil {
+			return nil, err
+		}
+		if filepath.Ext(file) != ".webp" {
+			files = append(files, file)
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// precompressMap writes <file>.gz and <file>.br next to each of a map's
+// precompressedFiles, so that a static file server or CDN can answer with a
+// Content-Encoding without compressing on the fly, and returns their sizes.
+// Copies newer than their file are kept.
+func precompressMap(mapDir string) (compressedSizes, error) {
+	var sizes compressedSizes
+	files, err := precompressedFiles(mapDir)
+	if err != nil {
+		return sizes, err
+	}
+	for _, file := range files {
+		path := filepath.Join(mapDir, file)
+		gz, br, err := precompressFile(path)
+		if err != nil {
+			return sizes, fmt.Errorf("failed to precompress %s: %w", file, err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return sizes, err
+		}
+		sizes.Raw += info.Size()
+		sizes.Gzip += gz
+		sizes.Brotli += br
+	}
+	return sizes, nil
+}
+
+// precompressFile writes path.gz and path.br, at the best compression of
+// each format, unless both are already newer than path. It returns their
+// sizes. The gzip header carries no name or time, so the output only depends
+// on the input.
+func precompressFile(path string) (gzSize, brSize int64, err error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	gzInfo, gzErr := os.Stat(path + ".gz")
+	brInfo, brErr := os.Stat(path + ".br")
+	if gzErr == nil && brErr == nil && !gzInfo.ModTime().Before(info.ModTime()) && !brInfo.ModTime().Before(info.ModTime()) {
+		return gzInfo.Size(), brInfo.Size(), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	gz, err := mapgen.EncodeGzip(data)
+	if err != nil {
+		return 0, 0, err
+	}
+	br, err := encodeBrotli(data)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := os.WriteFile(path+".gz", gz, 0644); err != nil {
+		return 0, 0, err
+	}
+	if err := os.WriteFile(path+".br", br, 0644); err != nil {
+		return 0, 0, err
+	}
+	return int64(len(gz)), int64(len(br)), nil
+}
+
+// encodeBrotli compresses data with Brotli at the best compression.
+func encodeBrotli(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := brotli.NewWriterLevel(&buf, brotli.BestCompression)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// removePrecompressed deletes precompressed copies in mapDir, so that runs
+// without --precompress never leave copies of outdated files behind for a
+// server to serve.
+func removePrecompressed(mapDir string) error {
+	entries, err := os.ReadDir(mapDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		for _, ext := range precompressedExtensions {
+			if filepath.Ext(entry.Name()) == ext {
+				if err := os.Remove(filepath.Join(mapDir, entry.Name())); err != nil && !errors.Is(err, os.ErrNotExist) {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+const (
+	// manifestSizeEstimate is a generous upper bound for a manifest.json,
+	// and for each other JSON file of a map of a fixed size, such as its
+	// analytics.json, cdn.json entry or signed_files.json.
+	manifestSizeEstimate = 64 * 1024
+	// diskSpaceMargin is the extra fraction of the estimate required to be
+	// free, leaving room for other writers and filesystem overhead.
+	diskSpaceMargin = 0.1
+)
+
+// outputPlan is what a run writes for every map besides the packed maps,
+// their thumbnail and the manifest, from the command-line flags.
+type outputPlan struct {
+	Layers      []string // --layers
+	Precompress bool     // --precompress
+	Container   bool     // --container
+	Bundle      bool     // --bundle
+	Chunks      bool     // --chunk-size
+	Analytics   bool     // --analytics
+	Signed      bool     // --sign-key
+	CDNDir      string   // --cdn-dir
+	AnnotateDir string   // --annotate-dir
+}
+
+// currentOutputPlan returns the outputPlan of the command-line flags, with
+// the layers parseLayersFlag selected.
+func currentOutputPlan(layers []string) outputPlan {
+	return outputPlan{
+		Layers:      layers,
+		Precompress: precompressFlag,
+		Container:   containerFlag != "",
+		Bundle:      bundleFlag != "",
+		Chunks:      chunkSizeFlag != 0,
+		Analytics:   analyticsFlag,
+		Signed:      signKeyFlag != "",
+		CDNDir:      cdnDirFlag,
+		AnnotateDir: annotateDirFlag,
+	}
+}
+
+// estimateOutputSize returns an upper bound, in bytes, for the files
+// processMap writes to the output directory for a source image of the given
+// pixel area, and for the copies plan writes to its CDN directory:
+//   - one byte per tile at full, 1/4 and 1/16 scale, and as much again for
+//     the patches from their published versions, which are only kept when
+//     smaller;
+//   - a thumbnail no larger than its raw RGBA pixels (1/16 of the tile
+//     count) and the manifest;
+//   - every layer of plan, at its TileBytes;
+//   - with --precompress, a .br and a .gz copy of the manifest and of every
+//     file it lists but the thumbnail, each no larger than the file;
+//   - with --container, another copy of every output, and with --bundle, of
+//     the manifest, packed maps, thumbnail and navigation layer;
+//   - with --chunk-size, another copy of map.bin;
+//   - the analytics.json of --analytics and the signed_files.json of
+//     --sign-key;
+//   - with --cdn-dir, a copy of the manifest and of every file it lists.
+func estimateOutputSize(area int, plan outputPlan) (mapDir, cdnDir uint64) {
+	tiles := uint64(area)
+	packed := tiles + tiles/4 + tiles/16
+	thumbnail := tiles / 16 * 4
+	layers, navigation := uint64(0), uint64(0)
+	for _, name := range plan.Layers {
+		if layer := mapgen.FindAuxLayer(name); layer != nil {
+			size := uint64(layer.TileBytes*float64(tiles)) + manifestSizeEstimate
+			layers += size
+			if name == "navigation" {
+				navigation = size
+			}
+		}
+	}
+	listed := 2*packed + thumbnail + layers + manifestSizeEstimate
+	mapDir = listed
+	if plan.Precompress {
+		mapDir += 2 * (listed - thumbnail)
+	}
+	if plan.Container {
+		mapDir += listed
+	}
+	if plan.Bundle {
+		mapDir += packed + thumbnail + navigation + manifestSizeEstimate
+	}
+	if plan.Chunks {
+		mapDir += tiles + manifestSizeEstimate
+	}
+	if plan.Analytics {
+		mapDir += manifestSizeEstimate
+	}
+	if plan.Signed {
+		mapDir += manifestSizeEstimate
+	}
+	if plan.CDNDir != "" {
+		cdnDir = listed + manifestSizeEstimate
+	}
+	return mapDir, cdnDir
+}
+
+// checkWritableDir creates dir if needed and verifies that files can be
+// created in it by writing and removing a probe file.
+func checkWritableDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("output directory %s cannot be created: %w", dir, err)
+	}
+	probe, err := os.CreateTemp(dir, ".preflight-*")
+	if err != nil {
+		return fmt.Errorf("output directory %s is not writable: %w", dir, err)
+	}
+	probe.Close()
+	if err := os.Remove(probe.Name()); err != nil {
+		return fmt.Errorf("failed to remove preflight probe %s: %w", probe.Name(), err)
+	}
+	return nil
+}
+
+// preflight runs cheap checks before any map is generated, so that a
+// full-registry run fails in seconds with a clear message instead of on its
+// first write after minutes of generation:
+//   - every output directory the run will write to, including those of
+//     --cdn-dir and --annotate-dir, can be created and written;
+//   - the estimated size of all outputs of plan, see estimateOutputSize,
+//     fits in the free space of the filesystem holding each directory.
+func preflight(ctx context.Context, scheduled []mapEntry, plan outputPlan) error {
+	logger := mapgen.LoggerFromContext(ctx)
+
+	needed := make(map[string]uint64)
+	for _, m := range scheduled {
+		dir, err := outputMapDir(m.IsTest)
+		if err != nil {
+			return fmt.Errorf("failed to get map directory: %w", err)
+		}
+		area := sourceImageArea(m)
+		mapDir, cdnDir := estimateOutputSize(area, plan)
+		needed[dir] += mapDir
+		if plan.CDNDir != "" && !m.IsTest {
+			needed[plan.CDNDir] += cdnDir
+		}
+		if plan.AnnotateDir != "" {
+			// An annotated copy of the source image, no larger than its
+			// raw RGBA pixels.
+			needed[plan.AnnotateDir] += uint64(area) * 4
+		}
+	}
+
+	dirs := make([]string, 0, len(needed))
+	for dir := range needed {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	for _, dir := range dirs {
+		if err := checkWritableDir(dir); err != nil {
+			return err
+		}
+		required := needed[dir] + uint64(float64(needed[dir])*diskSpaceMargin)
+		available, ok := availableDiskSpace(dir)
+		if !ok {
+			logger.Debug(fmt.Sprintf("Unable to determine free disk space for %s, skipping check", dir))
+			continue
+		}
+		logger.Debug(fmt.Sprintf("Preflight: %s needs ~%s, %s available", dir, formatBytes(required), formatBytes(available)))
+		if available < required {
+			return fmt.Errorf("not enough disk space in %s: outputs need ~%s but only %s is available", dir, formatBytes(required), formatBytes(available))
+		}
+	}
+	return nil
+}
+
+// formatBytes renders a byte count using binary units, e.g. "12.3 MiB".
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+// TestEstimateOutputSize checks that every layer and output flag adds to the
+// estimate, so that the disk space check covers what a run writes.
+func TestEstimateOutputSize(t *testing.T) {
+	const area = 4096 * 2048
+	base, _ := estimateOutputSize(area, outputPlan{})
+	var all []string
+	for _, l := range mapgen.AuxLayers {
+		if l.TileBytes <= 0 {
+			t.Errorf("layer %s has no TileBytes", l.Name)
+		}
+		all = append(all, l.Name)
+	}
+	render, _ := estimateOutputSize(area, outputPlan{Layers: []string{"render_light", "render_dark"}})
+	if render-base < 8*area {
+		t.Errorf("render_light and render_dark add %d bytes, want at least 8 per tile (%d)", render-base, 8*area)
+	}
+	withLayers, _ := estimateOutputSize(area, outputPlan{Layers: all})
+	for _, plan := range []outputPlan{
+		{Layers: all, Precompress: true},
+		{Layers: all, Container: true},
+		{Layers: all, Bundle: true},
+		{Layers: all, Chunks: true},
+		{Layers: all, Analytics: true},
+		{Layers: all, Signed: true},
+	} {
+		if got, _ := estimateOutputSize(area, plan); got <= withLayers {
+			t.Errorf("%+v: estimate %d, want more than the %d of the layers alone", plan, got, withLayers)
+		}
+	}
+	if _, cdn := estimateOutputSize(area, outputPlan{Layers: all, CDNDir: "cdn"}); cdn < withLayers {
+		t.Errorf("CDN copies estimated at %d, want at least the %d of the outputs", cdn, withLayers)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+// proceduralParams are the parameters of a procedural map. They are recorded
+// in its info.json as "procedural", so that the map can be drawn again.
+type proceduralParams struct {
+	Seed      string  `json:"seed"`
+	Width     int     `json:"width"`
+	Height    int     `json:"height"`
+	Land      float64 `json:"land"`      // target share of land tiles
+	Mountains float64 `json:"mountains"` // 0 for no mountain ranges, 1 for ranges across most landmasses
+	Islands   float64 `json:"islands"`   // 0 for a few large continents, 1 for many small islands
+}
+
+// proceduralMapImage draws the source image of a procedural map: a height
+// field of fractal noise whose feature size shrinks as Islands grows, sunk
+// towards the edges so that the ocean surrounds the land, less so and only
+// near the edges as Islands grows, cut at the level
+// that leaves the target share of land. Land rises inland from its coasts,
+// and ridged noise raises mountain ranges, weighted by Mountains, away from
+// them. The generator then cleans up small islands and lakes and computes
+// the shorelines and water distances as for any other map.
+func proceduralMapImage(p proceduralParams) *image.NRGBA {
+	seed := mapgen.NoiseSeed("procedural:" + p.Seed)
+	ridgeSeed := mapgen.NoiseSeed("procedural-ridges:" + p.Seed)
+	w, h := float64(p.Width), float64(p.Height)
+	scale := max(w, h) * (0.4 - 0.32*p.Islands)
+	ridgeScale := max(w, h) / 6
+
+	field := make([]float64, p.Width*p.Height)
+	for y := 0; y < p.Height; y++ {
+		for x := 0; x < p.Width; x++ {
+			fx, fy := float64(x)+0.5, float64(y)+0.5
+			edge := max(math.Abs(2*fx/w-1), math.Abs(2*fy/h-1))
+			field[y*p.Width+x] = mapgen.FractalNoise(fx/scale, fy/scale, seed, 6) - 0.8*math.Pow(edge, 3+9*p.Islands)
+		}
+	}
+	return heightFieldImage(field, p.Width, p.Height, p.Land, func(x, y int, inland float64) float64 {
+		ridge := 1 - math.Abs(mapgen.FractalNoise(float64(x)/ridgeScale, float64(y)/ridgeScale, ridgeSeed, 5))
+		return 0.5*math.Sqrt(inland) + p.Mountains*math.Pow(ridge, 6)*min(1, 6*inland)
+	})
+}
+
+// runGenerate implements the generate command: it draws a procedural map
+// from a seed, without a source image, writes it as a new map folder and
+// generates its outputs like those of any other map, for randomized maps and
+// quick prototypes of new layouts. The map starts out of the playlist.
+func runGenerate(args []string) error {
+	fset, logFlags := newCommandFlagSet("generate")
+	id := fset.String("id", "", "UpperCamelCase id of the new map; its folder is the id lowercased")
+	mapName := fset.String("name", "", "canonical name of the new map (default: the id)")
+	var p proceduralParams
+	fset.StringVar(&p.Seed, "seed", "", "seed of the map; the same seed and parameters always give the same map (default: the id)")
+	fset.IntVar(&p.Width, "width", 1000, "width of the map in tiles, rounded to a multiple of 4")
+	fset.IntVar(&p.Height, "height", 600, "height of the map in tiles, rounded to a multiple of 4")
+	fset.Float64Var(&p.Land, "land", 0.4, "target share of land tiles, between 0 and 1")
+	fset.Float64Var(&p.Mountains, "mountains", 0.3, "frequency of mountain ranges, between 0 (none) and 1")
+	fset.Float64Var(&p.Islands, "islands", 0.3, "island-iness, between 0 (a few large continents) and 1 (many small islands)")
+	force := fset.Bool("force", false, "overwrite the files of an existing map folder")
+	wait := fset.Bool("wait", false, "wait for another running generator to release the output directory lock instead of failing")
+	fset.Parse(args)
+	setupLogging(*logFlags)
+	ctx := context.Background()
+	logger := mapgen.LoggerFromContext(ctx)
+
+	if *id == "" {
+		return fmt.Errorf("-id is required")
+	}
+	if *mapName == "" {
+		*mapName = *id
+	}
+	if p.Seed == "" {
+		p.Seed = *id
+	}
+	// The generator crops maps to multiples of 4.
+	p.Width, p.Height = int(math.Round(float64(p.Width)/4))*4, int(math.Round(float64(p.Height)/4))*4
+	switch {
+	case p.Width < 16 || p.Width > 8192 || p.Height < 16 || p.Height > 8192:
+		return fmt.Errorf("-width and -height must be between 16 and 8192")
+	case p.Land <= 0 || p.Land > 1:
+		return fmt.Errorf("-land (%g) must be above 0 and at most 1", p.Land)
+	case p.Mountains < 0 || p.Mountains > 1:
+		return fmt.Errorf("-mountains (%g) must be between 0 and 1", p.Mountains)
+	case p.Islands < 0 || p.Islands > 1:
+		return fmt.Errorf("-islands (%g) must be between 0 and 1", p.Islands)
+	}
+
+	name := strings.ToLower(*id)
+	inDir, err := inputMapDir(false)
+	if err != nil {
+		return err
+	}
+	outDir := filepath.Join(inDir, name)
+	if _, err := os.Stat(outDir); err == nil && !*force {
+		return fmt.Errorf("%s already exists, use -force to overwrite it", outDir)
+	}
+
+	release, err := lockGeneratorOutputs(ctx, *wait)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	img := proceduralMapImage(p)
+	var imageBuffer bytes.Buffer
+	if err := png.Encode(&imageBuffer, img); err != nil {
+		return err
+	}
+	info, err := json.MarshalIndent(struct {
+		ID                   string           `json:"id"`
+		Name                 string           `json:"name"`
+		TranslationKey       string           `json:"translation_key"`
+		Categories           []string         `json:"categories"`
+		MultiplayerFrequency int              `json:"multiplayer_frequency"`
+		Nations              []any            `json:"nations"`
+		Procedural           proceduralParams `json:"procedural"`
+		SchemaVersion        int              `json:"schema_version"`
+	}{*id, *mapName, "map." + name, []string{"fictional"}, 0, []any{}, p, schemaVersion}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(outDir, "image.png"), imageBuffer.Bytes(), 0644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(outDir, "info.json"), append(info, '\n'), 0644); err != nil {
+		return err
+	}
+	logger.Info(fmt.Sprintf("Wrote %s, %dx%d, seed %q: land covers %.1f%% of the map", outDir, p.Width, p.Height, p.Seed, 100*landShare(img, p.Width, p.Height)))
+
+	// A map folder that already existed may have outputs of the same image.
+	forceFlag = forceFlag || *force
+	if _, err := processMap(mapgen.ContextWithLogger(ctx, logger.With(slog.String("map", name))), name, false, nil); err != nil {
+		return err
+	}
+	logger.Info(fmt.Sprintf("Generated the outputs of %s; run `go run .` to add it to the registry", name))
+	return nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/containerpb"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// containerTypeName is the name of the container module the codegen
+// command writes.
+const containerTypeName = "MapContainer"
+
+// protoReaderTS is the wire reader of the generated container module. It
+// reads varints up to 2^53 exactly, which covers every field of the schema.
+const protoReaderTS = `
+const textDecoder = new TextDecoder();
+
+class ProtoReader {
+  pos = 0;
+
+  constructor(private readonly buf: Uint8Array) {}
+
+  done(): boolean {
+    return this.pos >= this.buf.length;
+  }
+
+  varint(): number {
+    let v = 0;
+    for (let shift = 0; ; shift += 7) {
+      if (this.pos >= this.buf.length) throw new Error("truncated varint");
+      const b = this.buf[this.pos++];
+      v += (b & 0x7f) * 2 ** shift;
+      if (b < 0x80) return v;
+    }
+  }
+
+  bytes(): Uint8Array {
+    const n = this.varint();
+    if (this.pos + n > this.buf.length) throw new Error("truncated field");
+    const b = this.buf.subarray(this.pos, this.pos + n);
+    this.pos += n;
+    return b;
+  }
+
+  string(): string {
+    return textDecoder.decode(this.bytes());
+  }
+
+  skip(wireType: number): void {
+    switch (wireType) {
+      case 0:
+        this.varint();
+        break;
+      case 1:
+        this.pos += 8;
+        break;
+      case 2:
+        this.bytes();
+        break;
+      case 5:
+        this.pos += 4;
+        break;
+      default:
+        throw new Error(` + "`unsupported wire type ${wireType}`" + `);
+    }
+    if (this.pos > this.buf.length) throw new Error("truncated field");
+  }
+}
+`
+
+// generateContainerBindings returns the TypeScript module that reads
+// map.pb containers: an interface and a decode function per message of
+// map_container.proto, taken from the descriptor compiled into
+// pkg/containerpb. Data fields share the decoded buffer.
+func generateContainerBindings() []byte {
+	var b strings.Builder
+	b.WriteString("// Code generated by map-generator; DO NOT EDIT.\n// The container schema lives in map-generator/map_container.proto.\n// Regenerate with `go run . codegen` in map-generator.\n")
+	b.WriteString(protoReaderTS)
+	messages := containerpb.File_map_container_proto.Messages()
+	for i := 0; i < messages.Len(); i++ {
+		declareProtoMessage(&b, messages.Get(i))
+	}
+	return []byte(b.String())
+}
+
+// declareProtoMessage emits the interface and the decode function of md.
+func declareProtoMessage(b *strings.Builder, md protoreflect.MessageDescriptor) {
+	name := string(md.Name())
+	fields := md.Fields()
+	fmt.Fprintf(b, "\nexport interface %s {\n", name)
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		tsType, _, _ := protoFieldTS(fd)
+		switch {
+		case fd.IsList():
+			tsType += "[]"
+		case fd.Kind() == protoreflect.MessageKind:
+			tsType += " | undefined"
+		}
+		fmt.Fprintf(b, "  %s: %s;\n", fd.JSONName(), tsType)
+	}
+	b.WriteString("}\n")
+
+	fmt.Fprintf(b, "\nexport function decode%s(data: Uint8Array): %s {\n", name, name)
+	b.WriteString("  const r = new ProtoReader(data);\n")
+	fmt.Fprintf(b, "  const m: %s = {\n", name)
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		_, zero, _ := protoFieldTS(fd)
+		if fd.IsList() {
+			zero = "[]"
+		}
+		fmt.Fprintf(b, "    %s: %s,\n", fd.JSONName(), zero)
+	}
+	b.WriteString("  };\n  while (!r.done()) {\n    const key = r.varint();\n    switch (key) {\n")
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		_, _, read := protoFieldTS(fd)
+		wireType := protowire.BytesType
+		if fd.Kind() == protoreflect.Uint32Kind {
+			wireType = protowire.VarintType
+		}
+		fmt.Fprintf(b, "      case %d:\n", protowire.EncodeTag(fd.Number(), wireType))
+		if fd.IsList() {
+			fmt.Fprintf(b, "        m.%s.push(%s);\n", fd.JSONName(), read)
+		} else {
+			fmt.Fprintf(b, "        m.%s = %s;\n", fd.JSONName(), read)
+		}
+		b.WriteString("        break;\n")
+	}
+	b.WriteString("      default:\n        r.skip(key & 7);\n    }\n  }\n  return m;\n}\n")
+}
+
+// protoFieldTS returns the TypeScript type of a field, its proto3 default
+// and the expression reading it. The schema only uses these kinds; add
+// others here as it grows.
+func protoFieldTS(fd protoreflect.FieldDescriptor) (tsType, zero, read string) {
+	switch fd.Kind() {
+	case protoreflect.Uint32Kind:
+		return "number", "0", "r.varint() >>> 0"
+	case protoreflect.StringKind:
+		return "string", `""`, "r.string()"
+	case protoreflect.BytesKind:
+		return "Uint8Array", "new Uint8Array(0)", "r.bytes()"
+	case protoreflect.MessageKind:
+		name := string(fd.Message().Name())
+		return name, "undefined", "decode" + name + "(r.bytes())"
+	}
+	panic(fmt.Sprintf("codegen: unsupported container field kind %s of %s", fd.Kind(), fd.FullName()))
+}
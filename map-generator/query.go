@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapformat"
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+// queryMap is a generated map loaded by the query command.
+type queryMap struct {
+	Name       string
+	Manifest   *mapformat.Manifest
+	Scales     []*mapformat.Map // by mapformat.Scales
+	Continents []mapgen.Continent
+	Layers     []queryLayer // sorted by name
+}
+
+// queryLayer is a layer of a map loaded by the query command.
+type queryLayer struct {
+	Name string
+	Data []byte
+	Meta map[string]any
+}
+
+// metaInt returns an integer field of a layer's manifest entry, 0 if absent.
+func (l queryLayer) metaInt(key string) int {
+	v, _ := l.Meta[key].(float64)
+	return int(v)
+}
+
+// queryTileLayers describe the value of a full-scale tile (x, y), at index i
+// of the row-major order of map.bin, in the layers that have one, by name.
+var queryTileLayers = map[string]func(q *queryMap, l queryLayer, x, y, i int) string{
+	"fertility":     func(q *queryMap, l queryLayer, x, y, i int) string { return fmt.Sprint(l.Data[i]) },
+	"defensibility": func(q *queryMap, l queryLayer, x, y, i int) string { return fmt.Sprint(l.Data[i]) },
+	"continents": func(q *queryMap, l queryLayer, x, y, i int) string {
+		id := int(l.Data[i])
+		for _, c := range q.Continents {
+			if c.ID == id && c.Name != "" {
+				return fmt.Sprintf("%d (%s)", id, c.Name)
+			}
+		}
+		return fmt.Sprint(id)
+	},
+	"currents": func(q *queryMap, l queryLayer, x, y, i int) string {
+		return fmt.Sprintf("(%d, %d)", int8(l.Data[2*i]), int8(l.Data[2*i+1]))
+	},
+	"biomes": func(q *queryMap, l queryLayer, x, y, i int) string {
+		return queryEnum(l.Data[i], append([]string{"none"}, mapgen.BiomeNames...)...)
+	},
+	"depth_bands": func(q *queryMap, l queryLayer, x, y, i int) string {
+		return queryEnum(l.Data[i], "none", "shallow", "open", "deep")
+	},
+	"salinity": func(q *queryMap, l queryLayer, x, y, i int) string {
+		return queryEnum(l.Data[i], "none", "fresh", "salt")
+	},
+	"territories": func(q *queryMap, l queryLayer, x, y, i int) string {
+		id := int(binary.LittleEndian.Uint16(l.Data[2*i:]))
+		territories, _ := l.Meta["territories"].([]any)
+		for _, t := range territories {
+			if t, ok := t.(map[string]any); ok && t["id"] == float64(id) {
+				return fmt.Sprintf("%d (%v)", id, t["name"])
+			}
+		}
+		return fmt.Sprint(id)
+	},
+	"navigation": func(q *queryMap, l queryLayer, x, y, i int) string {
+		// The water body of every tile follows the 16-byte header.
+		id := binary.LittleEndian.Uint16(l.Data[16+2*i:])
+		if id == 0 {
+			return "0 (no water)"
+		}
+		return fmt.Sprintf("%d (water body)", id)
+	},
+	"movement_cost": func(q *queryMap, l queryLayer, x, y, i int) string {
+		if l.Data[i] == 0 {
+			return "0 (impassable)"
+		}
+		return fmt.Sprintf("%d (cost %.2f)", l.Data[i], float64(l.Data[i])/mapgen.MovementCostScale)
+	},
+	"render_light": queryRGBA,
+	"render_dark":  queryRGBA,
+	"spawn_weights": func(q *queryMap, l queryLayer, x, y, i int) string {
+		size := l.metaInt("region_size")
+		rx, ry := x/size, y/size
+		return fmt.Sprintf("%d (region %d,%d)", l.Data[ry*l.metaInt("width")+rx], rx, ry)
+	},
+	"strategic": func(q *queryMap, l queryLayer, x, y, i int) string {
+		size := l.metaInt("cell_size")
+		cx, cy := x/size, y/size
+		cell := l.Data[3*(cy*l.metaInt("width")+cx):]
+		var flags []string
+		for bit, name := range []string{"coast", "ocean", "lake", "impassable"} {
+			if cell[2]&(1<<bit) != 0 {
+				flags = append(flags, name)
+			}
+		}
+		return fmt.Sprintf("land %.0f%%, magnitude %.1f, %s (cell %d,%d)", 100*float64(cell[0])/255, float64(cell[1])/8, strings.Join(flags, "+"), cx, cy)
+	},
+	"visibility": func(q *queryMap, l queryLayer, x, y, i int) string {
+		// The cells divide the 1/16 scale map, of a quarter of the dimensions.
+		size := l.metaInt("cell_size")
+		cx, cy := x/4/size, y/4/size
+		n := l.metaInt("bytes_per_cell")
+		visible := 0
+		for _, b := range l.Data[(cy*l.metaInt("columns")+cx)*n:][:n] {
+			visible += bits.OnesCount8(b)
+		}
+		side := 2*l.metaInt("radius") + 1
+		return fmt.Sprintf("sees %d of %d cells around it (cell %d,%d)", visible, side*side, cx, cy)
+	},
+}
+
+// queryEnum names an enumerated layer value.
+func queryEnum(v byte, names ...string) string {
+	if int(v) < len(names) {
+		return fmt.Sprintf("%d (%s)", v, names[v])
+	}
+	return fmt.Sprint(v)
+}
+
+// queryRGBA describes a tile of a render layer.
+func queryRGBA(q *queryMap, l queryLayer, x, y, i int) string {
+	c := l.Data[4*i : 4*i+4]
+	return fmt.Sprintf("#%02x%02x%02x, alpha %d", c[0], c[1], c[2], c[3])
+}
+
+// runQuery implements the query command: it prints everything the outputs of
+// a map record about a tile, for investigating bug reports about specific
+// coordinates. Without -at it reads coordinates from standard input.
+func runQuery(args []string) error {
+	fs, logFlags := newCommandFlagSet("query")
+	mapName := fs.String("map", "", "name of the generated map, e.g. europe")
+	at := fs.String("at", "", "full-scale tile to describe, as x,y; without it, coordinates are read from standard input")
+	radius := fs.Int("radius", 2, "radius of the neighbourhood printed around the tile, 0 for none")
+	fs.Parse(args)
+	setupLogging(*logFlags)
+	if *mapName == "" {
+		return errors.New("-map is required")
+	}
+
+	q, err := loadQueryMap(*mapName)
+	if err != nil {
+		return err
+	}
+	if *at != "" {
+		x, y, err := parseQueryCoordinates(*at)
+		if err != nil {
+			return err
+		}
+		return q.describe(os.Stdout, x, y, *radius)
+	}
+
+	full := q.Scales[0]
+	fmt.Printf("%s is %dx%d tiles. Enter x,y coordinates, or q to quit.\n", q.Name, full.Width, full.Height)
+	scanner := bufio.NewScanner(os.Stdin)
+	for fmt.Print("> "); scanner.Scan(); fmt.Print("> ") {
+		line := strings.TrimSpace(scanner.Text())
+		switch line {
+		case "":
+			continue
+		case "q", "quit", "exit":
+			return nil
+		}
+		x, y, err := parseQueryCoordinates(line)
+		if err == nil {
+			err = q.describe(os.Stdout, x, y, *radius)
+		}
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+	fmt.Println()
+	return scanner.Err()
+}
+
+// parseQueryCoordinates parses "x,y" or "x y".
+func parseQueryCoordinates(s string) (x, y int, err error) {
+	if _, err := fmt.Sscanf(strings.ReplaceAll(s, ",", " "), "%d %d", &x, &y); err != nil {
+		return 0, 0, fmt.Errorf("coordinates must be x,y, got %q", s)
+	}
+	return x, y, nil
+}
+
+// loadQueryMap reads the manifest, packed scales and layers of a generated
+// map, looking among the test maps if there is no such map.
+func loadQueryMap(name string) (*queryMap, error) {
+	var mapDir string
+	for _, isTest := range []bool{false, true} {
+		outDir, err := outputMapDir(isTest)
+		if err != nil {
+			return nil, err
+		}
+		mapDir = filepath.Join(outDir, name)
+		if _, err := os.Stat(filepath.Join(mapDir, "manifest.json")); err == nil {
+			break
+		}
+	}
+	manifest, err := mapformat.ReadManifest(mapDir)
+	if err != nil {
+		return nil, fmt.Errorf("map %s: %w (generate the map first)", name, err)
+	}
+	q := &queryMap{Name: name, Manifest: manifest}
+	for _, s := range mapformat.Scales {
+		gm, err := mapformat.ReadMap(mapDir, manifest, s)
+		if err != nil {
+			return nil, fmt.Errorf("map %s: %w", name, err)
+		}
+		q.Scales = append(q.Scales, gm)
+	}
+	if raw, ok := manifest.Fields["continents"]; ok {
+		if err := json.Unmarshal(raw, &q.Continents); err != nil {
+			return nil, fmt.Errorf("map %s: invalid continents: %w", name, err)
+		}
+	}
+	for layerName, raw := range manifest.Layers {
+		l := queryLayer{Name: layerName}
+		if err := json.Unmarshal(raw, &l.Meta); err != nil {
+			return nil, fmt.Errorf("map %s: invalid manifest entry for layer %s: %w", name, layerName, err)
+		}
+		if _, ok := queryTileLayers[layerName]; ok {
+			file, _ := l.Meta["file"].(string)
+			if l.Data, err = os.ReadFile(filepath.Join(mapDir, file)); err != nil {
+				return nil, fmt.Errorf("map %s: %w", name, err)
+			}
+		}
+		q.Layers = append(q.Layers, l)
+	}
+	sort.Slice(q.Layers, func(i, j int) bool { return q.Layers[i].Name < q.Layers[j].Name })
+	return q, nil
+}
+
+// describe writes the state of full-scale tile (x, y) in every scale and
+// layer of the map, then the packed tiles within radius of it.
+func (q *queryMap) describe(w io.Writer, x, y, radius int) error {
+	full := q.Scales[0]
+	if !full.In(x, y) {
+		return fmt.Errorf("(%d, %d) is outside the %dx%d map", x, y, full.Width, full.Height)
+	}
+	fmt.Fprintf(w, "%s (%d, %d)\n", q.Name, x, y)
+	for i, s := range mapformat.Scales {
+		sx, sy := x>>i, y>>i
+		fmt.Fprintf(w, "  %-22s %s\n", fmt.Sprintf("%s (%d, %d)", s.Section(), sx, sy), mapgen.DescribeTile(q.Scales[i].At(sx, sy)))
+	}
+	i := y*full.Width + x
+	for _, l := range q.Layers {
+		file, _ := l.Meta["file"].(string)
+		value := "no per-tile value, see " + file
+		if describe, ok := queryTileLayers[l.Name]; ok {
+			value = describe(q, l, x, y, i)
+		}
+		fmt.Fprintf(w, "  %-22s %s\n", l.Name, value)
+	}
+
+	if radius <= 0 {
+		return nil
+	}
+	fmt.Fprintf(w, "  Packed tiles within %d of it:\n", radius)
+	for ny := y - radius; ny <= y+radius; ny++ {
+		var line strings.Builder
+		line.WriteString("   ")
+		for nx := x - radius; nx <= x+radius; nx++ {
+			switch {
+			case !full.In(nx, ny):
+				line.WriteString("  .. ")
+			case nx == x && ny == y:
+				fmt.Fprintf(&line, " [%02x]", uint8(full.At(nx, ny)))
+			default:
+				fmt.Fprintf(&line, "  %02x ", uint8(full.At(nx, ny)))
+			}
+		}
+		fmt.Fprintln(w, line.String())
+	}
+	return nil
+}
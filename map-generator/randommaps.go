@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapformat"
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+// randomMapNoiseScale is the feature size, in tiles, of the noise roughening
+// the coastlines and relief of random maps.
+const randomMapNoiseScale = 24.0
+
+// randomMapParams are the drawn parameters of one random map.
+type randomMapParams struct {
+	Seed         string  `json:"seed"`
+	Width        int     `json:"width"`
+	Height       int     `json:"height"`
+	LandFraction float64 `json:"land_fraction"` // target share of land tiles
+	Islands      int     `json:"islands"`       // island seeds placed
+}
+
+// valueRange is an inclusive range of a random-maps flag, parsed from "a-b"
+// or a single value.
+type valueRange struct{ Min, Max float64 }
+
+// parseValueRange parses a range flag value.
+func parseValueRange(name, s string) (valueRange, error) {
+	var r valueRange
+	if n, _ := fmt.Sscanf(s, "%g-%g", &r.Min, &r.Max); n == 2 {
+		if r.Min > r.Max {
+			return r, fmt.Errorf("-%s (%q) must be MIN-MAX with MIN <= MAX", name, s)
+		}
+		return r, nil
+	}
+	if _, err := fmt.Sscanf(s, "%g", &r.Min); err != nil {
+		return r, fmt.Errorf("-%s (%q) must be a number or a MIN-MAX range", name, s)
+	}
+	r.Max = r.Min
+	return r, nil
+}
+
+// at maps a uniform value u in [0, 1) into the range.
+func (r valueRange) at(u float64) float64 {
+	return r.Min + u*(r.Max-r.Min)
+}
+
+// randomUnit returns a uniform pseudo-random value in [0, 1) for draw k of
+// map i, derived from mapgen.HashLattice so that every map only depends on the seed
+// and its index.
+func randomUnit(seed uint64, i, k int) float64 {
+	return float64(mapgen.HashLattice(int64(i), int64(k), seed)>>11) / (1 << 53)
+}
+
+// drawRandomMapParams draws the parameters of map i of a batch.
+func drawRandomMapParams(seed string, i int, size, land, islands valueRange) randomMapParams {
+	s := mapgen.NoiseSeed("random-maps:" + seed)
+	side := func(k int) int {
+		// The generator crops maps to multiples of 4.
+		return max(16, int(math.Round(size.at(randomUnit(s, i, k))/4))*4)
+	}
+	return randomMapParams{
+		Seed:         fmt.Sprintf("%s:%d", seed, i),
+		Width:        side(0),
+		Height:       side(1),
+		LandFraction: math.Round(land.at(randomUnit(s, i, 2))*1000) / 1000,
+		Islands:      int(math.Round(islands.at(randomUnit(s, i, 3)))),
+	}
+}
+
+// randomMapImage draws the source image of a random map: a height field of
+// one cone per island seed, roughened with noise, cut at the level that
+// leaves the target share of land and shaded into the land magnitudes of
+// image.png. Seeds far apart become separate islands, seeds close together
+// merge, so the landmasses of the result are recorded rather than assumed.
+func randomMapImage(p randomMapParams) *image.NRGBA {
+	seed := mapgen.NoiseSeed("random-map:" + p.Seed)
+	w, h := float64(p.Width), float64(p.Height)
+	type cone struct{ X, Y, Radius float64 }
+	cones := make([]cone, p.Islands)
+	radius := math.Sqrt(p.LandFraction*w*h/float64(max(p.Islands, 1))/math.Pi) * 1.5
+	for i := range cones {
+		cones[i] = cone{
+			X:      w * (0.1 + 0.8*randomUnit(seed, i, 0)),
+			Y:      h * (0.1 + 0.8*randomUnit(seed, i, 1)),
+			Radius: radius * (0.6 + 0.8*randomUnit(seed, i, 2)),
+		}
+	}
+
+	field := make([]float64, p.Width*p.Height)
+	for y := 0; y < p.Height; y++ {
+		for x := 0; x < p.Width; x++ {
+			v := -1.0
+			for _, c := range cones {
+				v = max(v, 1-math.Hypot(float64(x)+0.5-c.X, float64(y)+0.5-c.Y)/c.Radius)
+			}
+			field[y*p.Width+x] = v + 0.35*mapgen.FractalNoise(float64(x)/randomMapNoiseScale, float64(y)/randomMapNoiseScale, seed, 4)
+		}
+	}
+	landShare := p.LandFraction
+	if p.Islands == 0 {
+		landShare = 0
+	}
+	return heightFieldImage(field, p.Width, p.Height, landShare, func(x, y int, inland float64) float64 {
+		return inland
+	})
+}
+
+// heightFieldImage draws a height field, width×height and row-major, as
+// the source image of a generated map: it is cut at the level that leaves
+// landShare of the tiles as land, water below it. Land is shaded by
+// elevation, from 0 to 1 for blue 140 to 200 (land magnitudes 0 to 30),
+// given the tile and how far inland it is, from 0 at the level to 1 at the
+// highest point of the field. Land is gray, red and green equal, so that it
+// is all of the temperate biome.
+func heightFieldImage(field []float64, width, height int, landShare float64, elevation func(x, y int, inland float64) float64) *image.NRGBA {
+	sorted := append([]float64(nil), field...)
+	sort.Float64s(sorted)
+	landTiles := int(math.Round(landShare * float64(len(field))))
+	level, peak := math.Inf(1), sorted[len(sorted)-1]
+	if landTiles > 0 {
+		level = sorted[len(sorted)-landTiles]
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := field[y*width+x]
+			if v < level {
+				img.SetNRGBA(x, y, color.NRGBA{B: 106, A: 255})
+				continue
+			}
+			inland := 0.0
+			if peak > level {
+				inland = (v - level) / (peak - level)
+			}
+			e := min(max(elevation(x, y, inland), 0), 1)
+			img.SetNRGBA(x, y, color.NRGBA{R: 120, G: 120, B: uint8(140 + math.Round(60*e)), A: 255})
+		}
+	}
+	return img
+}
+
+// randomMapManifest is the manifest.json of a random map.
+type randomMapManifest struct {
+	ID               string               `json:"id"`
+	Random           randomMapParams      `json:"random"`
+	Map              manifestScale        `json:"map"`
+	Map4x            manifestScale        `json:"map4x"`
+	Map16x           manifestScale        `json:"map16x"`
+	Players          mapgen.PlayerCounts  `json:"players"`
+	Stats            mapMetrics           `json:"stats"`
+	Tensor           tensorManifest       `json:"tensor"`
+	GeneratorVersion int                  `json:"generator_version"`
+	SchemaVersion    int                  `json:"schema_version"`
+	TileFormat       mapformat.TileFormat `json:"tile_format"`
+	Checksums        map[string]string    `json:"checksums"`
+}
+
+// tensorManifest describes the terrain tensor of a dataset map.
+type tensorManifest struct {
+	File     string   `json:"file"`
+	Dtype    string   `json:"dtype"`
+	Shape    []int    `json:"shape"`
+	Channels []string `json:"channels"`
+}
+
+// newTensorManifest describes the terrain tensor of a width×height map.
+func newTensorManifest(width, height int) tensorManifest {
+	return tensorManifest{
+		File:     terrainTensorFile,
+		Dtype:    "uint8",
+		Shape:    []int{len(terrainTensorChannels), height, width},
+		Channels: terrainTensorChannels,
+	}
+}
+
+// runRandomMaps implements the random-maps command: it generates a batch of
+// seeded small maps for reinforcement learning curricula, which need
+// thousands of varied maps rather than the handmade registry.
+func runRandomMaps(args []string) error {
+	fs, logFlags := newCommandFlagSet("random-maps")
+	count := fs.Int("count", 100, "number of maps to generate")
+	outDir := fs.String("out", "training", "directory to write the maps and maps.jsonl to")
+	seed := fs.String("seed", "curriculum", "seed of the batch; the same seed and parameters always give the same maps")
+	sizeFlag := fs.String("size", "64-256", "width and height of each map in tiles, as MIN-MAX or a single value, rounded to multiples of 4")
+	landFlag := fs.String("land", "0.2-0.5", "target share of land tiles of each map, as MIN-MAX or a single value")
+	islandsFlag := fs.String("islands", "1-6", "number of island seeds of each map, as MIN-MAX or a single value; seeds close together merge")
+	fs.Parse(args)
+	setupLogging(*logFlags)
+	logger := slog.Default()
+
+	size, err := parseValueRange("size", *sizeFlag)
+	if err != nil {
+		return err
+	}
+	land, err := parseValueRange("land", *landFlag)
+	if err != nil {
+		return err
+	}
+	islands, err := parseValueRange("islands", *islandsFlag)
+	if err != nil {
+		return err
+	}
+	switch {
+	case *count < 1:
+		return fmt.Errorf("-count (%d) must be at least 1", *count)
+	case size.Min < 16 || size.Max > 4096:
+		return fmt.Errorf("-size (%q) must be between 16 and 4096", *sizeFlag)
+	case land.Min < 0 || land.Max > 1:
+		return fmt.Errorf("-land (%q) must be between 0 and 1", *landFlag)
+	case islands.Min < 0 || islands.Max > 64:
+		return fmt.Errorf("-islands (%q) must be between 0 and 64", *islandsFlag)
+	}
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		return err
+	}
+
+	// The generator's progress is only logged with -v or -log-level.
+	genLogger := logger
+	if level := DetermineLogLevel(*logFlags); level == slog.LevelInfo {
+		genLogger = slog.New(NewGeneratorLogger(os.Stdout, &slog.HandlerOptions{Level: slog.LevelWarn}, *logFlags))
+	}
+	index, err := os.Create(filepath.Join(*outDir, "maps.jsonl"))
+	if err != nil {
+		return err
+	}
+	defer index.Close()
+	indexWriter := bufio.NewWriter(index)
+	for i := 0; i < *count; i++ {
+		p := drawRandomMapParams(*seed, i, size, land, islands)
+		id := fmt.Sprintf("random-%05d", i)
+		ctx := mapgen.ContextWithLogger(context.Background(), genLogger.With(slog.String("map", id)))
+		manifest, err := writeRandomMap(ctx, filepath.Join(*outDir, id), id, p)
+		if err != nil {
+			return fmt.Errorf("map %s: %w", id, err)
+		}
+		line, err := json.Marshal(struct {
+			ID         string          `json:"id"`
+			Random     randomMapParams `json:"random"`
+			LandShare  float64         `json:"land_share"`
+			Landmasses int             `json:"landmasses"`
+		}{id, p, math.Round((1-manifest.Stats.WaterShare)*1000) / 1000, manifest.Stats.Landmasses})
+		if err != nil {
+			return err
+		}
+		indexWriter.Write(append(line, '\n'))
+		if (i+1)%100 == 0 || i+1 == *count {
+			logger.Info(fmt.Sprintf("Generated %d of %d random maps", i+1, *count))
+		}
+	}
+	if err := indexWriter.Flush(); err != nil {
+		return err
+	}
+	return index.Close()
+}
+
+// writeRandomMap generates a random map and writes its packed scales,
+// terrain tensor and manifest to mapDir.
+func writeRandomMap(ctx context.Context, mapDir, id string, p randomMapParams) (*randomMapManifest, error) {
+	var imageBuffer bytes.Buffer
+	if err := png.Encode(&imageBuffer, randomMapImage(p)); err != nil {
+		return nil, err
+	}
+	result, err := mapgen.GenerateMap(ctx, mapgen.GeneratorArgs{
+		Name:        id,
+		ImageBuffer: imageBuffer.Bytes(),
+		Config:      mapgen.DefaultGeneratorConfig(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(mapDir, 0755); err != nil {
+		return nil, err
+	}
+	manifest := &randomMapManifest{
+		ID:               id,
+		Random:           p,
+		Map:              newManifestScale(result.Map),
+		Map4x:            newManifestScale(result.Map4x),
+		Map16x:           newManifestScale(result.Map16x),
+		Players:          mapgen.RecommendPlayerCounts(result.Stats),
+		Stats:            newMapMetrics(result.Stats, result.Salinity),
+		Tensor:           newTensorManifest(result.Map.Width, result.Map.Height),
+		GeneratorVersion: mapgen.GeneratorVersion,
+		SchemaVersion:    schemaVersion,
+		TileFormat:       result.TileFormat,
+		Checksums:        make(map[string]string),
+	}
+	tensor := encodeNpy(terrainTensor(result.Map.Data, result.Map.Width, result.Map.Height, result.TileFormat), manifest.Tensor.Shape...)
+	for _, f := range []struct {
+		File string
+		Data []byte
+	}{
+		{"map.bin", result.Map.Data},
+		{"map4x.bin", result.Map4x.Data},
+		{"map16x.bin", result.Map16x.Data},
+		{terrainTensorFile, tensor},
+	} {
+		if err := os.WriteFile(filepath.Join(mapDir, f.File), f.Data, 0644); err != nil {
+			return nil, err
+		}
+		manifest.Checksums[f.File] = sha256Hex(f.Data)
+	}
+	buf, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return manifest, os.WriteFile(filepath.Join(mapDir, "manifest.json"), append(buf, '\n'), 0644)
+}
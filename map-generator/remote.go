@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+// errRemoteNotFound is returned by fetchRemote when the server answers 404.
+var errRemoteNotFound = errors.New("not found")
+
+// fetchRemote streams the object at url into w and returns the number of
+// bytes read, failing on objects larger than limit.
+func fetchRemote(ctx context.Context, url string, w io.Writer, limit int64, timeout time.Duration) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request for %s: %w", url, err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return 0, errRemoteNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("failed to download %s: %s", url, resp.Status)
+	}
+	n, err := io.Copy(w, io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return n, fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	if n > limit {
+		return n, fmt.Errorf("%s is larger than %s", url, formatBytes(uint64(limit)))
+	}
+	return n, nil
+}
+
+// remoteMapDrift compares one deployed map with the local outputs in mapDir
+// and returns a description of every difference. The deployed manifest's
+// checksums are compared with the local ones and, unless manifestsOnly is
+// set, every deployed file is downloaded and hashed, which tells a stale
+// deployment (files match the deployed manifest but not the local one) from
+// a mismatched one (files don't match their own manifest).
+func remoteMapDrift(ctx context.Context, baseURL, mapDir string, manifestsOnly bool, timeout time.Duration) ([]string, error) {
+	localBuffer, err := os.ReadFile(filepath.Join(mapDir, "manifest.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read local manifest: %w", err)
+	}
+	var local struct {
+		Checksums map[string]string `json:"checksums"`
+	}
+	if err := json.Unmarshal(localBuffer, &local); err != nil {
+		return nil, fmt.Errorf("local manifest is not valid JSON: %w", err)
+	}
+
+	var remoteBuffer bytes.Buffer
+	_, err = fetchRemote(ctx, baseURL+"/manifest.json", &remoteBuffer, maxSourceDownloadSize, timeout)
+	if errors.Is(err, errRemoteNotFound) {
+		return []string{"manifest.json is not deployed"}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var remote struct {
+		Checksums map[string]string `json:"checksums"`
+	}
+	if err := json.Unmarshal(remoteBuffer.Bytes(), &remote); err != nil {
+		return []string{fmt.Sprintf("deployed manifest.json is not valid JSON: %v", err)}, nil
+	}
+
+	var drift []string
+	files := make([]string, 0, len(local.Checksums))
+	for file := range local.Checksums {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		want := local.Checksums[file]
+		deployed, ok := remote.Checksums[file]
+		switch {
+		case !ok:
+			drift = append(drift, fmt.Sprintf("%s is missing from the deployed manifest", file))
+		case deployed != want:
+			drift = append(drift, fmt.Sprintf("%s is stale in the deployed manifest: %s, local %s", file, shortDigest(deployed), shortDigest(want)))
+		}
+		if manifestsOnly {
+			continue
+		}
+		hash := sha256.New()
+		_, err := fetchRemote(ctx, baseURL+"/"+file, hash, maxSourceDownloadSize, timeout)
+		if errors.Is(err, errRemoteNotFound) {
+			drift = append(drift, fmt.Sprintf("%s is not deployed", file))
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		got := hex.EncodeToString(hash.Sum(nil))
+		switch {
+		case got == want:
+		case ok && got == deployed:
+			drift = append(drift, fmt.Sprintf("%s is stale: deployed %s, local %s", file, shortDigest(got), shortDigest(want)))
+		default:
+			drift = append(drift, fmt.Sprintf("%s does not match any manifest: deployed %s, deployed manifest %s, local %s", file, shortDigest(got), shortDigest(deployed), shortDigest(want)))
+		}
+	}
+	var extra []string
+	for file := range remote.Checksums {
+		if _, ok := local.Checksums[file]; !ok {
+			extra = append(extra, file)
+		}
+	}
+	sort.Strings(extra)
+	for _, file := range extra {
+		drift = append(drift, fmt.Sprintf("%s is deployed but no longer generated", file))
+	}
+	if len(drift) == 0 && !bytes.Equal(bytes.TrimSpace(remoteBuffer.Bytes()), bytes.TrimSpace(localBuffer)) {
+		drift = append(drift, "manifest.json differs from the local one outside its checksums")
+	}
+	return drift, nil
+}
+
+// shortDigest abbreviates a hex digest for reports.
+func shortDigest(digest string) string {
+	if digest == "" {
+		return "none"
+	}
+	if len(digest) > 12 {
+		return digest[:12]
+	}
+	return digest
+}
+
+// runVerifyRemote checks a deployment of the maps against the local
+// outputs. Each map is expected at <base-url>/<map>/, laid out like the
+// output directory. It exits with an error if any map has drifted.
+func runVerifyRemote(args []string) error {
+	fset, logFlags := newCommandFlagSet("verify-remote")
+	baseURL := fset.String("base-url", "", "URL the map folders are deployed under, http(s) or s3://bucket/prefix; for Cloudflare R2, use the bucket's public https URL")
+	fset.StringVar(&mapsFlag, "maps", "", "optional comma-separated list of maps to check")
+	manifestsOnly := fset.Bool("manifests-only", false, "only compare the deployed manifests' checksums, without downloading the files")
+	timeout := fset.Duration("timeout", 2*time.Minute, "timeout of each download")
+	fset.Parse(args)
+	setupLogging(*logFlags)
+	logger := mapgen.LoggerFromContext(context.Background())
+	if *baseURL == "" {
+		return fmt.Errorf("-base-url is required")
+	}
+	base, err := objectHTTPURL(strings.TrimSuffix(*baseURL, "/"))
+	if err != nil {
+		return err
+	}
+
+	discovered, err := discoverMaps()
+	if err != nil {
+		return err
+	}
+	maps = discovered
+	selected, err := parseMapsFlag()
+	if err != nil {
+		return err
+	}
+
+	checked, drifted := 0, 0
+	for _, m := range maps {
+		if selected != nil && !selected[m.Name] || m.IsTest {
+			continue
+		}
+		outDir, err := outputMapDir(m.IsTest)
+		if err != nil {
+			return err
+		}
+		drift, err := remoteMapDrift(context.Background(), base+"/"+m.Name, filepath.Join(outDir, m.Name), *manifestsOnly, *timeout)
+		if err != nil {
+			return fmt.Errorf("map %s: %w", m.Name, err)
+		}
+		checked++
+		if len(drift) == 0 {
+			logger.Debug(fmt.Sprintf("%s: in sync", m.Name))
+			continue
+		}
+		drifted++
+		for _, d := range drift {
+			logger.Warn(fmt.Sprintf("%s: %s", m.Name, d))
+		}
+	}
+	if drifted > 0 {
+		return fmt.Errorf("%d of %d map(s) differ from %s", drifted, checked, base)
+	}
+	logger.Info(fmt.Sprintf("All %d map(s) match %s", checked, base))
+	return nil
+}
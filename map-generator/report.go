@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+// reportMap is one map's entry in the run report.
+type reportMap struct {
+	Name       string
+	IsTest     bool
+	Status     mapStatus
+	Duration   time.Duration
+	Err        error
+	Warnings   []string
+	Thumbnail  template.URL     // data URI, empty if the map has no thumbnail
+	Compressed *compressedSizes // nil without --precompress
+	// Manifest fields, nil or zero if the map has no manifest.
+	Map     *manifestScale
+	Stats   *mapMetrics
+	Players *mapgen.PlayerCounts
+}
+
+// runReport is the data of the run report template.
+type runReport struct {
+	Generated time.Time
+	Total     time.Duration
+	Counts    map[string]int // maps by status
+	Warnings  int
+	Maps      []reportMap
+}
+
+// reportWriters are the writers of the reports of --report, by the
+// extension of their path: the HTML run report, and the analytics of every
+// map as JSON or as a table.
+var reportWriters = map[string]func(path string, outcomes []mapOutcome) error{
+	".html": writeRunReport,
+	".htm":  writeRunReport,
+	".json": writeAnalyticsJSON,
+	".csv":  writeAnalyticsCSV,
+}
+
+// checkReportPaths checks that the comma-separated paths of --report all
+// have the extension of a report, so that a typo fails before the run
+// rather than after it.
+func checkReportPaths(paths string) error {
+	for _, path := range strings.Split(paths, ",") {
+		if _, ok := reportWriters[strings.ToLower(filepath.Ext(path))]; !ok {
+			return fmt.Errorf("--report path %q must end in .html, .htm, .json or .csv", path)
+		}
+	}
+	return nil
+}
+
+// writeReports writes the reports of a run to the comma-separated paths of
+// --report, each in the format of its extension, see reportWriters. A
+// report that fails doesn't stop the others from being written; the
+// failures are returned together.
+func writeReports(paths string, outcomes []mapOutcome) error {
+	var errs []error
+	for _, path := range strings.Split(paths, ",") {
+		write, ok := reportWriters[strings.ToLower(filepath.Ext(path))]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: unknown report format", path))
+			continue
+		}
+		if err := write(path, outcomes); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+			continue
+		}
+		slog.Info(fmt.Sprintf("Wrote report to %s", path))
+	}
+	return errors.Join(errs...)
+}
+
+// writeRunReport writes a self-contained HTML page summarising a run: every
+// processed map's thumbnail, dimensions, land stats, removal counts, logged
+// warnings and processing time, for maintainers approving a regeneration.
+// Details come from the map's manifest, so maps skipped as unchanged are
+// shown as last generated.
+func writeRunReport(path string, outcomes []mapOutcome) error {
+	report := runReport{
+		Generated: time.Now().UTC(),
+		Counts:    make(map[string]int),
+	}
+	for _, o := range outcomes {
+		entry := reportMap{
+			Name:       o.Entry.Name,
+			IsTest:     o.Entry.IsTest,
+			Status:     o.Status,
+			Duration:   o.Duration.Round(time.Millisecond),
+			Err:        o.Err,
+			Warnings:   o.Warnings,
+			Compressed: o.Compressed,
+		}
+		dir, err := outputMapDir(o.Entry.IsTest)
+		if err != nil {
+			return err
+		}
+		if err := readReportDetails(filepath.Join(dir, o.Entry.Name), &entry); err != nil {
+			return fmt.Errorf("map %s: %w", o.Entry.Name, err)
+		}
+		report.Maps = append(report.Maps, entry)
+		report.Counts[string(o.Status)]++
+		report.Warnings += len(o.Warnings)
+		report.Total += o.Duration
+	}
+	report.Total = report.Total.Round(time.Millisecond)
+	sort.Slice(report.Maps, func(i, j int) bool {
+		if report.Maps[i].IsTest != report.Maps[j].IsTest {
+			return !report.Maps[i].IsTest
+		}
+		return report.Maps[i].Name < report.Maps[j].Name
+	})
+
+	var buf bytes.Buffer
+	if err := reportTemplate.Execute(&buf, report); err != nil {
+		return fmt.Errorf("failed to render report: %w", err)
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// readReportDetails fills entry from the manifest and thumbnail of a
+// generated map directory. Missing files are left out of the report.
+func readReportDetails(mapDir string, entry *reportMap) error {
+	manifestBuffer, err := os.ReadFile(filepath.Join(mapDir, "manifest.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var manifest struct {
+		Map     *manifestScale       `json:"map"`
+		Stats   *mapMetrics          `json:"stats"`
+		Players *mapgen.PlayerCounts `json:"players"`
+	}
+	if err := json.Unmarshal(manifestBuffer, &manifest); err != nil {
+		return fmt.Errorf("invalid manifest: %w", err)
+	}
+	entry.Map, entry.Stats, entry.Players = manifest.Map, manifest.Stats, manifest.Players
+
+	thumbnail, err := os.ReadFile(filepath.Join(mapDir, "thumbnail.webp"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	entry.Thumbnail = template.URL("data:image/webp;base64," + base64.StdEncoding.EncodeToString(thumbnail))
+	return nil
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"percent": func(v float64) string { return fmt.Sprintf("%.1f%%", 100*v) },
+	"bytes":   func(n int64) string { return formatBytes(uint64(n)) },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Map generator report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; background: #f4f4f4; color: #222; }
+.map { display: flex; gap: 1.5em; background: #fff; border-radius: 6px; padding: 1em; margin-bottom: 1em; }
+.map img { max-width: 320px; max-height: 240px; background: #4684b4; align-self: flex-start; }
+.failed { border-left: 6px solid #c0392b; }
+.warned { border-left: 6px solid #e67e22; }
+table { border-collapse: collapse; }
+td { padding: 0.1em 1em 0.1em 0; vertical-align: top; }
+td:first-child { color: #666; }
+.status { font-weight: bold; text-transform: uppercase; font-size: 0.8em; }
+.error { color: #c0392b; }
+.warnings { color: #a04000; margin: 0.5em 0 0; padding-left: 1.2em; }
+</style>
+</head>
+<body>
+<h1>Map generator report</h1>
+<p>{{.Generated.Format "2006-01-02 15:04:05 UTC"}} &middot; {{len .Maps}} map(s) in {{.Total}} of processing time &middot;
+generated {{index .Counts "generated"}}, skipped {{index .Counts "skipped"}}, archived {{index .Counts "archived"}}, failed {{index .Counts "failed"}} &middot; {{.Warnings}} warning(s)</p>
+{{range .Maps}}
+<div class="map{{if .Err}} failed{{else if .Warnings}} warned{{end}}">
+{{if .Thumbnail}}<img src="{{.Thumbnail}}" alt="{{.Name}} thumbnail">{{end}}
+<div>
+<h2>{{.Name}}{{if .IsTest}} (test map){{end}}</h2>
+<p><span class="status">{{.Status}}</span> in {{.Duration}}</p>
+{{if .Err}}<p class="error">{{.Err}}</p>{{end}}
+<table>
+{{with .Map}}<tr><td>Dimensions</td><td>{{.Width}} &times; {{.Height}}</td></tr>
+<tr><td>Land tiles</td><td>{{.NumLandTiles}}</td></tr>{{end}}
+{{with .Stats}}<tr><td>Water</td><td>{{percent .WaterShare}} ({{.SaltWaterBodies}} salt, {{.FreshWaterBodies}} fresh bodies)</td></tr>
+<tr><td>Landmasses</td><td>{{.Landmasses}}, largest {{percent .LargestLandmassShare}} of land</td></tr>
+<tr><td>Coastline</td><td>{{percent .CoastlineRatio}} of land, roughness {{.CoastlineRoughness}}</td></tr>
+<tr><td>Style</td><td>{{.Style}}</td></tr>
+<tr><td>Removed</td><td>{{.RemovedIslands}} island(s), {{.RemovedLakes}} lake(s)</td></tr>{{end}}
+{{with .Compressed}}<tr><td>Download</td><td>{{bytes .Raw}}, {{bytes .Gzip}} gzip, {{bytes .Brotli}} brotli</td></tr>{{end}}
+{{with .Players}}<tr><td>Players</td><td>{{.Min}}&ndash;{{.Max}}, recommended {{.Recommended}}</td></tr>{{end}}
+</table>
+{{if .Warnings}}<ul class="warnings">{{range .Warnings}}<li>{{.}}</li>{{end}}</ul>{{end}}
+</div>
+</div>
+{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+// uploadWorkerCommand is the hidden subcommand the serve command runs each
+// upload's generation in, see generateSandboxed.
+const uploadWorkerCommand = "upload-worker"
+
+// uploadJob is what the serve command sends an upload worker on its
+// standard input.
+type uploadJob struct {
+	Name   string
+	Image  []byte
+	Info   []byte // migrated to the current schema
+	Inputs map[string][]byte
+}
+
+// uploadJobResult is what an upload worker answers on its standard output.
+// Annotated and Legend hold the image with the problems generation found
+// circled, and their list, whenever it found any, failed or not.
+type uploadJobResult struct {
+	Result    mapgen.MapResult
+	Err       string
+	Warnings  []byte // generator warnings, one per line
+	Annotated []byte
+	Legend    string
+}
+
+// sandboxLimits bounds the process an upload is generated in.
+type sandboxLimits struct {
+	Timeout     time.Duration
+	MemoryBytes uint64
+}
+
+// errSandboxCrashed is returned by generateSandboxed when the worker dies
+// without answering: it ran out of memory or CPU time, or crashed.
+var errSandboxCrashed = errors.New("the generator ran out of memory or crashed on this map")
+
+// generateSandboxed generates an upload in a child process of this binary,
+// so that a malformed or oversized upload can at most take down the child:
+// the child's data size and CPU time are capped by rlimits where the
+// platform has them, see limitWorkerResources, and it is killed once
+// limits.Timeout passes or ctx is done, which then returns ctx's error or
+// context.DeadlineExceeded.
+func generateSandboxed(ctx context.Context, job uploadJob, limits sandboxLimits) (*uploadJobResult, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	var stdin bytes.Buffer
+	if err := gob.NewEncoder(&stdin).Encode(job); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, limits.Timeout)
+	defer cancel()
+	cpuSeconds := uint64(limits.Timeout.Seconds()*float64(runtime.NumCPU())) + 1
+	cmd := exec.CommandContext(ctx, exe, uploadWorkerCommand,
+		"-memory-bytes", strconv.FormatUint(limits.MemoryBytes, 10),
+		"-cpu-seconds", strconv.FormatUint(cpuSeconds, 10))
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = &stdin, &stdout, &stderr
+	cmd.WaitDelay = time.Second
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		slog.Error(fmt.Sprintf("The upload worker for %q failed: %v\n%s", job.Name, err, firstLines(stderr.String(), 20)))
+		return nil, errSandboxCrashed
+	}
+	var result uploadJobResult
+	if err := gob.NewDecoder(&stdout).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to read the upload worker's answer: %w", err)
+	}
+	return &result, nil
+}
+
+// firstLines returns at most the first n lines of s: the error of a
+// crashed worker, before the stacks of its goroutines.
+func firstLines(s string, n int) string {
+	lines := strings.SplitAfterN(s, "\n", n+1)
+	return strings.Join(lines[:min(n, len(lines))], "")
+}
+
+// runUploadWorker implements uploadWorkerCommand: it limits its own
+// resources, reads an uploadJob from standard input, generates it and
+// writes an uploadJobResult to standard output.
+func runUploadWorker(args []string) error {
+	fset := flag.NewFlagSet(uploadWorkerCommand, flag.ExitOnError)
+	memoryBytes := fset.Uint64("memory-bytes", 0, "largest data size of the worker, 0 for no limit")
+	cpuSeconds := fset.Uint64("cpu-seconds", 0, "most CPU time of the worker, 0 for no limit")
+	fset.Parse(args)
+	if *memoryBytes > 0 {
+		// Collect harder as the heap nears the hard limit rather than
+		// fail on an allocation the collector could have made room for.
+		debug.SetMemoryLimit(int64(*memoryBytes / 4 * 3))
+	}
+	if err := limitWorkerResources(*memoryBytes, *cpuSeconds); err != nil {
+		return err
+	}
+
+	var job uploadJob
+	if err := gob.NewDecoder(os.Stdin).Decode(&job); err != nil {
+		return fmt.Errorf("failed to read the upload job: %w", err)
+	}
+	result := generateUploadJob(job)
+	return gob.NewEncoder(os.Stdout).Encode(result)
+}
+
+// generateUploadJob generates an upload the way validateUpload checks it:
+// with small islands and lakes removed, generator warnings returned rather
+// than logged, and its problems annotated. A panic of the generator is
+// returned as an error.
+func generateUploadJob(job uploadJob) (result *uploadJobResult) {
+	result = &uploadJobResult{}
+	config, err := mapgen.ParseGeneratorConfig(job.Info)
+	if err != nil {
+		result.Err = err.Error()
+		return result
+	}
+	var warnings bytes.Buffer
+	logger := slog.New(NewGeneratorLogger(&warnings, &slog.HandlerOptions{Level: slog.LevelWarn}, LogFlags{}))
+	problems := &mapgen.ProblemRecorder{}
+	ctx := mapgen.ContextWithProblems(mapgen.ContextWithLogger(context.Background(), logger.With(slog.String("map", job.Name))), problems)
+	defer func() {
+		if p := recover(); p != nil {
+			fmt.Fprintf(os.Stderr, "panic: %v\n%s", p, debug.Stack())
+			result = &uploadJobResult{Err: "the generator crashed on this map"}
+			return
+		}
+		result.Warnings = warnings.Bytes()
+		if problems.Image == nil || len(problems.Problems) == 0 {
+			return
+		}
+		annotated, legend, err := encodeProblemAnnotations(job.Name, problems)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to annotate upload %q: %v\n", job.Name, err)
+			return
+		}
+		result.Annotated, result.Legend = annotated, legend
+	}()
+	result.Result, err = mapgen.GenerateMap(ctx, mapgen.GeneratorArgs{
+		Name:        job.Name,
+		ImageBuffer: job.Image,
+		RemoveSmall: true,
+		Info:        job.Info,
+		Inputs:      job.Inputs,
+		Config:      config,
+	})
+	if err != nil {
+		result.Err = err.Error()
+	}
+	return result
+}
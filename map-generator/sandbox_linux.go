@@ -0,0 +1,23 @@
+//go:build linux
+
+package main
+
+import "syscall"
+
+// limitWorkerResources caps the data size and CPU time of the current
+// process, 0 leaving a limit as it is. The data size counts the heap and
+// every private writable mapping, but not the address space the Go runtime
+// only reserves, so it tracks the memory the worker actually uses.
+func limitWorkerResources(memoryBytes, cpuSeconds uint64) error {
+	if memoryBytes > 0 {
+		if err := syscall.Setrlimit(syscall.RLIMIT_DATA, &syscall.Rlimit{Cur: memoryBytes, Max: memoryBytes}); err != nil {
+			return err
+		}
+	}
+	if cpuSeconds > 0 {
+		if err := syscall.Setrlimit(syscall.RLIMIT_CPU, &syscall.Rlimit{Cur: cpuSeconds, Max: cpuSeconds}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapformat"
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+// schemaVersion is the current version of the info.json and manifest.json
+// schema. Every generated manifest records it as "schema_version". Bump it
+// together with a new entry in schemaMigrations whenever fields are renamed
+// or become required, so that `go run . migrate` can upgrade existing files.
+const schemaVersion = 3
+
+// schemaMigration upgrades a document from schema version From to From+1.
+// Info and Manifest are applied to info.json and manifest.json documents
+// respectively; either may be nil when the step only bumps the version.
+type schemaMigration struct {
+	From        int
+	Description string
+	Info        func(doc *jsonObject) error
+	Manifest    func(doc *jsonObject) error
+}
+
+// schemaMigrations lists every migration step, in order.
+var schemaMigrations = []schemaMigration{
+	{
+		From:        0,
+		Description: "record schema_version",
+	},
+	{
+		// Version 2 adds ice and lava impassable terrain, which nothing of
+		// version 1 uses, so the step only bumps the version.
+		From:        1,
+		Description: "add ice and lava impassable terrain",
+	},
+	{
+		// Maps of version 2 and earlier are packed in the original tile
+		// layout, which is what the recorded tile_format says.
+		From:        2,
+		Description: "record tile_format",
+		Manifest: func(doc *jsonObject) error {
+			doc.Set("tile_format", json.Number(strconv.Itoa(int(mapformat.TileFormat1))))
+			return nil
+		},
+	},
+}
+
+// documentKind distinguishes the two schema-versioned file types.
+type documentKind int
+
+const (
+	infoDocument documentKind = iota
+	manifestDocument
+)
+
+// documentSchemaVersion returns the schema_version of doc; documents written
+// before versioning was introduced have none and are version 0.
+func documentSchemaVersion(doc *jsonObject) (int, error) {
+	raw, ok := doc.Get("schema_version")
+	if !ok {
+		return 0, nil
+	}
+	n, ok := raw.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("schema_version must be a number")
+	}
+	v, err := strconv.Atoi(n.String())
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("schema_version must be a non-negative integer, got %s", n)
+	}
+	return v, nil
+}
+
+// migrateDocument upgrades doc in place to schemaVersion and returns the
+// version it started from. Documents from a newer generator are rejected.
+func migrateDocument(doc *jsonObject, kind documentKind) (from int, err error) {
+	from, err = documentSchemaVersion(doc)
+	if err != nil {
+		return 0, err
+	}
+	if from > schemaVersion {
+		return from, fmt.Errorf("schema_version %d is newer than this generator supports (%d); update the map-generator", from, schemaVersion)
+	}
+	for _, m := range schemaMigrations {
+		if m.From < from {
+			continue
+		}
+		step := m.Info
+		if kind == manifestDocument {
+			step = m.Manifest
+		}
+		if step != nil {
+			if err := step(doc); err != nil {
+				return from, fmt.Errorf("migration from schema_version %d (%s) failed: %w", m.From, m.Description, err)
+			}
+		}
+	}
+	doc.Set("schema_version", json.Number(strconv.Itoa(schemaVersion)))
+	return from, nil
+}
+
+// migrateInfoBuffer upgrades a strict-JSON info.json buffer to the current
+// schema in memory, so that maps whose info.json predates a schema change
+// still generate. It returns the upgraded buffer and the original version.
+func migrateInfoBuffer(buf []byte) ([]byte, int, error) {
+	doc, err := decodeJSONObject(buf)
+	if err != nil {
+		return nil, 0, err
+	}
+	from, err := migrateDocument(doc, infoDocument)
+	if err != nil {
+		return nil, from, err
+	}
+	if from == schemaVersion {
+		return buf, from, nil
+	}
+	out, err := json.Marshal(doc)
+	return out, from, err
+}
+
+// runMigrate upgrades the committed info.json files and generated
+// manifest.json files of every map (or those selected with -maps) to the
+// current schema version, rewriting only files that change.
+func runMigrate(args []string) error {
+	fset, logFlags := newCommandFlagSet("migrate")
+	dryRun := fset.Bool("dry-run", false, "report what would be migrated without writing any file")
+	fset.StringVar(&mapsFlag, "maps", "", "optional comma-separated list of maps to migrate")
+	wait := fset.Bool("wait", false, "wait for another running generator to release the output directory lock instead of failing")
+	fset.Parse(args)
+	setupLogging(*logFlags)
+	logger := mapgen.LoggerFromContext(context.Background())
+
+	if !*dryRun {
+		release, err := lockGeneratorOutputs(context.Background(), *wait)
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+
+	discovered, err := discoverMaps()
+	if err != nil {
+		return err
+	}
+	maps = discovered
+	selected, err := parseMapsFlag()
+	if err != nil {
+		return err
+	}
+
+	migrated := 0
+	var manual []string
+	for _, m := range maps {
+		if selected != nil && !selected[m.Name] {
+			continue
+		}
+		inDir, err := inputMapDir(m.IsTest)
+		if err != nil {
+			return err
+		}
+		outDir, err := outputMapDir(m.IsTest)
+		if err != nil {
+			return err
+		}
+		files := []struct {
+			path string
+			kind documentKind
+		}{
+			{filepath.Join(inDir, m.Name, "info.json"), infoDocument},
+			{filepath.Join(outDir, m.Name, "manifest.json"), manifestDocument},
+		}
+		for _, f := range files {
+			changed, err := migrateFile(f.path, f.kind, *dryRun)
+			if errors.Is(err, errJSON5Rewrite) {
+				logger.Warn(fmt.Sprintf("%s: schema_version is outdated, but the file uses JSON5 syntax that rewriting it would drop; migrate it by hand", f.path))
+				manual = append(manual, f.path)
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %w", f.path, err)
+			}
+			if changed {
+				migrated++
+			}
+		}
+	}
+
+	if *dryRun {
+		logger.Info(fmt.Sprintf("%d file(s) need migrating to schema_version %d", migrated, schemaVersion))
+	} else {
+		logger.Info(fmt.Sprintf("Migrated %d file(s) to schema_version %d", migrated, schemaVersion))
+	}
+	if len(manual) > 0 {
+		return fmt.Errorf("%d file(s) use JSON5 syntax and need migrating by hand: %s", len(manual), strings.Join(manual, ", "))
+	}
+	return nil
+}
+
+// errJSON5Rewrite is returned by the commands that rewrite info.json files
+// for files written in JSON5, whose comments and trailing commas a rewrite
+// would drop.
+var errJSON5Rewrite = errors.New("info.json uses JSON5 syntax")
+
+// migrateFile upgrades one file and reports whether it changed. Missing
+// manifests (maps that were never generated) are skipped, and outdated
+// files in JSON5 are left alone with errJSON5Rewrite.
+func migrateFile(path string, kind documentKind, dryRun bool) (bool, error) {
+	logger := mapgen.LoggerFromContext(context.Background())
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) && kind == manifestDocument {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	buf, err := normalizeJSON5(raw)
+	if err != nil {
+		return false, err
+	}
+	doc, err := decodeJSONObject(buf)
+	if err != nil {
+		return false, err
+	}
+	from, err := migrateDocument(doc, kind)
+	if err != nil {
+		return false, err
+	}
+	if from == schemaVersion {
+		logger.Debug(fmt.Sprintf("%s is up to date", path))
+		return false, nil
+	}
+	if !json.Valid(raw) {
+		return false, errJSON5Rewrite
+	}
+	logger.Info(fmt.Sprintf("%s: schema_version %d -> %d", path, from, schemaVersion))
+	if dryRun {
+		return true, nil
+	}
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return false, err
+	}
+	if err := os.WriteFile(path, append(out, '\n'), 0644); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+// selfTestFixtures holds small synthetic maps (islands and lakes around the
+// removal thresholds, impassable terrain, rivers) together with the outputs
+// they are expected to generate. They are embedded so that the self-test
+// runs from any directory and in isolated build environments, without
+// depending on the assets/test_maps folders being resolvable from the CWD.
+//
+//go:embed testdata/selftest
+var selfTestFixtures embed.FS
+
+// selfTestDir is the fixture root, both inside selfTestFixtures and relative
+// to the map-generator directory (used by -update).
+const selfTestDir = "testdata/selftest"
+
+// selfTestScale is the recorded output of one scale of a fixture.
+type selfTestScale struct {
+	manifestScale
+	SHA256 string `json:"sha256"`
+}
+
+// selfTestExpectation is the content of a fixture's expected.json.
+type selfTestExpectation struct {
+	Map    selfTestScale `json:"map"`
+	Map4x  selfTestScale `json:"map4x"`
+	Map16x selfTestScale `json:"map16x"`
+}
+
+// newSelfTestExpectation records the outputs of a generated fixture.
+func newSelfTestExpectation(result mapgen.MapResult) selfTestExpectation {
+	scale := func(info mapgen.MapInfo) selfTestScale {
+		return selfTestScale{manifestScale: newManifestScale(info), SHA256: sha256Hex(info.Data)}
+	}
+	return selfTestExpectation{
+		Map:    scale(result.Map),
+		Map4x:  scale(result.Map4x),
+		Map16x: scale(result.Map16x),
+	}
+}
+
+// selfTestFixtureNames returns the names of the embedded fixtures.
+func selfTestFixtureNames() ([]string, error) {
+	entries, err := fs.ReadDir(selfTestFixtures, selfTestDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embedded fixtures: %w", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// generateSelfTestFixture generates an embedded fixture, checks that it
+// bundles and reads back, and returns its outputs.
+func generateSelfTestFixture(ctx context.Context, name string) (selfTestExpectation, error) {
+	imageBuffer, err := selfTestFixtures.ReadFile(path.Join(selfTestDir, name, "image.png"))
+	if err != nil {
+		return selfTestExpectation{}, fmt.Errorf("failed to read fixture %s: %w", name, err)
+	}
+	result, err := mapgen.GenerateMap(ctx, mapgen.GeneratorArgs{
+		Name:        name,
+		ImageBuffer: imageBuffer,
+		RemoveSmall: true,
+		Config:      mapgen.DefaultGeneratorConfig(),
+	})
+	if err != nil {
+		return selfTestExpectation{}, err
+	}
+	actual := newSelfTestExpectation(result)
+	manifest, err := json.Marshal(actual)
+	if err != nil {
+		return selfTestExpectation{}, fmt.Errorf("failed to serialize expectation for %s: %w", name, err)
+	}
+	if err := checkBundleRoundTrip(result, manifest); err != nil {
+		return selfTestExpectation{}, err
+	}
+	return actual, nil
+}
+
+// readSelfTestExpectation returns the expected.json of an embedded fixture.
+func readSelfTestExpectation(name string) (selfTestExpectation, error) {
+	var expected selfTestExpectation
+	expectedBuffer, err := selfTestFixtures.ReadFile(path.Join(selfTestDir, name, "expected.json"))
+	if err != nil {
+		return expected, fmt.Errorf("fixture %s has no expected.json, run selftest -update: %w", name, err)
+	}
+	if err := json.Unmarshal(expectedBuffer, &expected); err != nil {
+		return expected, fmt.Errorf("failed to parse expected.json for %s: %w", name, err)
+	}
+	return expected, nil
+}
+
+// runSelfTest generates every embedded fixture, checks that it bundles and
+// reads back, and compares the result with its expected.json. With -update it rewrites the expected.json files in
+// ./testdata/selftest instead, which must be run from the map-generator
+// directory after an intentional output change. go test runs the same
+// checks, see TestSelfTest.
+func runSelfTest(args []string) error {
+	fset, logFlags := newCommandFlagSet("selftest")
+	update := fset.Bool("update", false, "rewrite the expected outputs in ./"+selfTestDir+" from the current generator")
+	wait := fset.Bool("wait", false, "wait for another running generator to release the output directory lock instead of failing")
+	fset.Parse(args)
+	setupLogging(*logFlags)
+	logger := slog.Default()
+
+	if *update {
+		release, err := lockGeneratorOutputs(context.Background(), *wait)
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+
+	names, err := selfTestFixtureNames()
+	if err != nil {
+		return err
+	}
+
+	failures := 0
+	for _, name := range names {
+		ctx := mapgen.ContextWithLogger(context.Background(), logger.With(slog.String("map", name)))
+		actual, err := generateSelfTestFixture(ctx, name)
+		if err != nil {
+			logger.Error(fmt.Sprintf("FAIL %s: %v", name, err))
+			failures++
+			continue
+		}
+
+		if *update {
+			buf, err := json.MarshalIndent(actual, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to serialize expectation for %s: %w", name, err)
+			}
+			outPath := filepath.Join(selfTestDir, name, "expected.json")
+			if err := os.WriteFile(outPath, append(buf, '\n'), 0644); err != nil {
+				return fmt.Errorf("failed to write %s: %w", outPath, err)
+			}
+			logger.Info(fmt.Sprintf("Updated %s", outPath))
+			continue
+		}
+
+		expected, err := readSelfTestExpectation(name)
+		if err != nil {
+			return err
+		}
+		if actual != expected {
+			got, _ := json.Marshal(actual)
+			want, _ := json.Marshal(expected)
+			logger.Error(fmt.Sprintf("FAIL %s:\n  got  %s\n  want %s", name, got, want))
+			failures++
+			continue
+		}
+		logger.Info(fmt.Sprintf("PASS %s", name))
+	}
+
+	if failures > 0 {
+		return fmt.Errorf("%d fixture(s) failed", failures)
+	}
+	return nil
+}
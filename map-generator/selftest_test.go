@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+// TestSelfTest runs the checks of the selftest command on every embedded
+// fixture.
+func TestSelfTest(t *testing.T) {
+	names, err := selfTestFixtureNames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) == 0 {
+		t.Fatal("no embedded fixtures")
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			ctx := mapgen.ContextWithLogger(context.Background(), logger.With(slog.String("map", name)))
+			actual, err := generateSelfTestFixture(ctx, name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected, err := readSelfTestExpectation(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual != expected {
+				t.Errorf("got %+v, want %+v; run selftest -update after an intentional output change", actual, expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,506 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapformat"
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+// Endpoints of the serve command: uploadPath validates map uploads, and
+// bundlePath also returns the generated files of accepted ones.
+const (
+	uploadPath = "/upload"
+	bundlePath = "/bundle"
+)
+
+// uploadRejection is one reason an uploaded map is rejected. Code is stable
+// for clients to switch on; Field names the form file or info.json field at
+// fault, if any.
+type uploadRejection struct {
+	Code    string `json:"code"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// uploadResponse is the body of every upload response. An accepted map
+// comes with its preview and statistics, a rejected one with every reason
+// found.
+type uploadResponse struct {
+	Accepted  bool                 `json:"accepted"`
+	Reasons   []uploadRejection    `json:"reasons,omitempty"`
+	Warnings  []string             `json:"warnings,omitempty"` // generator warnings of an accepted map
+	Map       *manifestScale       `json:"map,omitempty"`
+	Map4x     *manifestScale       `json:"map4x,omitempty"`
+	Map16x    *manifestScale       `json:"map16x,omitempty"`
+	Players   *mapgen.PlayerCounts `json:"players,omitempty"`
+	Stats     *mapMetrics          `json:"stats,omitempty"`
+	Thumbnail string               `json:"thumbnail,omitempty"` // data: URL of the WebP thumbnail
+	// Annotated is a data: URL of the image with its problem areas circled
+	// and numbered, and Legend lists them by number, whenever generation
+	// found any.
+	Annotated string `json:"annotated,omitempty"`
+	Legend    string `json:"legend,omitempty"`
+}
+
+// uploadBusy is the rejection code of uploads the server has no room for,
+// answered 503 rather than 422 as they may succeed later.
+const uploadBusy = "server_busy"
+
+// reject records a rejection reason.
+func (r *uploadResponse) reject(code, field, format string, args ...any) {
+	r.Reasons = append(r.Reasons, uploadRejection{Code: code, Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// uploadServer validates uploaded maps for a community submission portal,
+// and generates the custom maps players upload in game.
+type uploadServer struct {
+	token          []byte
+	maxUploadBytes int64
+	maxPixels      int
+	// generating holds a token per map being generated: generation takes
+	// seconds and hundreds of MiB, so only as many uploads as it holds are
+	// generated at a time.
+	generating chan struct{}
+	// queued holds a token per upload being received, waiting for
+	// generation or generated; uploads beyond it are turned away, so that
+	// a burst of them cannot pile up.
+	queued chan struct{}
+	// timeout bounds the generation of an upload, and memoryBytes the
+	// memory of the process it runs in, see generateSandboxed.
+	timeout     time.Duration
+	memoryBytes uint64
+}
+
+// generatedUpload is an accepted upload with what its bundle is built from.
+type generatedUpload struct {
+	Name    string
+	Info    []byte
+	Config  mapgen.GeneratorConfig
+	Result  mapgen.MapResult
+	Players mapgen.PlayerCounts
+	Metrics mapMetrics
+	Hash    string
+}
+
+// handleUpload accepts a multipart form with the map's "image" (image.png)
+// and "info" (info.json) files, and optionally any of mapgen.AuxInputFiles under
+// their file names. It requires the server's bearer token, and answers 200
+// with an accepted uploadResponse or 422 with a rejected one, or 503 when
+// the queue of uploads is full.
+func (s *uploadServer) handleUpload(w http.ResponseWriter, r *http.Request) {
+	s.serveUpload(w, r, false)
+}
+
+// handleBundle accepts the same uploads as handleUpload, and answers an
+// accepted one with a zip of its manifest.json, packed maps and thumbnail,
+// ready to load in game, see writeUploadBundle. Rejections are answered as
+// by handleUpload.
+func (s *uploadServer) handleBundle(w http.ResponseWriter, r *http.Request) {
+	s.serveUpload(w, r, true)
+}
+
+// serveUpload handles an upload, answering an accepted one with its bundle
+// if bundle is set.
+func (s *uploadServer) serveUpload(w http.ResponseWriter, r *http.Request, bundle bool) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), s.token) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var resp uploadResponse
+	select {
+	case s.queued <- struct{}{}:
+		defer func() { <-s.queued }()
+	default:
+		resp.reject(uploadBusy, "", "too many maps are being generated, try again later")
+		writeUploadResponse(w, http.StatusServiceUnavailable, resp)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxUploadBytes)
+	if err := r.ParseMultipartForm(s.maxUploadBytes); err != nil {
+		status := http.StatusBadRequest
+		if errors.As(err, new(*http.MaxBytesError)) {
+			status = http.StatusRequestEntityTooLarge
+			resp.reject("upload_too_large", "", "the upload exceeds %s", formatBytes(uint64(s.maxUploadBytes)))
+		} else {
+			resp.reject("invalid_form", "", "the upload is not a multipart form: %v", err)
+		}
+		writeUploadResponse(w, status, resp)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	files := make(map[string][]byte)
+	for field, headers := range r.MultipartForm.File {
+		if field != "image" && field != "info" && !slices.Contains(mapgen.AuxInputFiles, field) {
+			resp.reject("unexpected_file", field, "unexpected file %q; expected image, info or one of %s", field, strings.Join(mapgen.AuxInputFiles, ", "))
+			continue
+		}
+		data, err := readUploadFile(headers[0])
+		if err != nil {
+			resp.reject("invalid_form", field, "failed to read %s: %v", field, err)
+			continue
+		}
+		files[field] = data
+	}
+	var upload *generatedUpload
+	if len(resp.Reasons) == 0 {
+		resp, upload = s.validateUpload(r.Context(), files)
+	}
+	if bundle && upload != nil {
+		if err := writeUploadBundle(w, upload); err != nil {
+			slog.Warn(fmt.Sprintf("Failed to send the bundle of upload %q: %v", upload.Name, err))
+		}
+		return
+	}
+	status := http.StatusOK
+	if !resp.Accepted {
+		status = http.StatusUnprocessableEntity
+	}
+	if len(resp.Reasons) == 1 && resp.Reasons[0].Code == uploadBusy {
+		status = http.StatusServiceUnavailable
+	}
+	writeUploadResponse(w, status, resp)
+}
+
+// readUploadFile reads a file of a multipart form.
+func readUploadFile(header *multipart.FileHeader) ([]byte, error) {
+	f, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// writeUploadResponse writes resp as the JSON body of a response. Busy
+// answers tell clients when to retry.
+func writeUploadResponse(w http.ResponseWriter, status int, resp uploadResponse) {
+	if status == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", "30")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// validateUpload runs an uploaded map through the checks of the generator
+// pipeline: the image and info.json are checked before generation, so that
+// every problem with them is reported at once, then the map is generated
+// and its player counts and nation spawns are checked against the terrain.
+// Generation runs in a child process, see generateSandboxed: one that
+// outlasts the server's timeout is killed and rejected, and one that runs
+// out of memory or crashes on a malformed upload rejects the upload
+// instead of taking the server down. It returns the generated map of an
+// accepted upload.
+func (s *uploadServer) validateUpload(ctx context.Context, files map[string][]byte) (resp uploadResponse, upload *generatedUpload) {
+	imageBuffer, info := files["image"], files["info"]
+	var imageSize image.Point
+	if imageBuffer == nil {
+		resp.reject("missing_file", "image", "the map image is missing")
+	} else if cfg, err := png.DecodeConfig(bytes.NewReader(imageBuffer)); err != nil {
+		resp.reject("invalid_image", "image", "the map image is not a PNG: %v", err)
+	} else if cfg.Width*cfg.Height > s.maxPixels {
+		resp.reject("image_too_large", "image", "the map image is %dx%d, over the limit of %d pixels", cfg.Width, cfg.Height, s.maxPixels)
+	} else if cfg.Width < 4 || cfg.Height < 4 {
+		resp.reject("image_too_small", "image", "the map image is %dx%d, it must be at least 4x4", cfg.Width, cfg.Height)
+	} else {
+		imageSize = image.Pt(cfg.Width, cfg.Height)
+	}
+	// Auxiliary images are decoded in full during generation, so their
+	// sizes are checked from their headers first, as the image's is.
+	for _, name := range mapgen.AuxInputFiles {
+		data, ok := files[name]
+		if ext := filepath.Ext(name); !ok || (ext != ".png" && ext != ".tif") {
+			continue
+		}
+		width, height, err := mapgen.AuxInputSize(name, data)
+		switch {
+		case err != nil:
+			resp.reject("invalid_input", name, "%s is not a supported image: %v", name, err)
+		case width*height > s.maxPixels:
+			resp.reject("input_too_large", name, "%s is %dx%d, over the limit of %d pixels", name, width, height, s.maxPixels)
+		case slices.Contains(mapgen.HeightmapFiles, name):
+			// Heightmaps are resampled to the map.
+		case imageSize != image.Point{} && image.Pt(width, height) != imageSize:
+			resp.reject("input_size_mismatch", name, "%s is %dx%d, it must be %dx%d like the map image", name, width, height, imageSize.X, imageSize.Y)
+		}
+	}
+
+	var config mapgen.GeneratorConfig
+	var doc struct {
+		Name    string          `json:"name"`
+		Source  json.RawMessage `json:"source"`
+		Nations []struct {
+			Name        string `json:"name"`
+			Coordinates []int  `json:"coordinates"`
+		} `json:"nations"`
+	}
+	if info == nil {
+		resp.reject("missing_file", "info", "info.json is missing")
+	} else if normalized, err := normalizeJSON5(info); err != nil {
+		resp.reject("invalid_info", "info", "info.json is not valid JSON5: %v", err)
+	} else if info, _, err = migrateInfoBuffer(normalized); err != nil {
+		resp.reject("invalid_info", "info", "info.json cannot be migrated to schema version %d: %v", schemaVersion, err)
+	} else if err := json.Unmarshal(info, &doc); err != nil {
+		resp.reject("invalid_info", "info", "info.json does not match the schema: %v", err)
+	} else {
+		if config, err = mapgen.ParseGeneratorConfig(info); err != nil {
+			resp.reject("invalid_config", "generator", "%v", err)
+		}
+		if strings.TrimSpace(doc.Name) == "" {
+			resp.reject("missing_name", "name", "info.json has no \"name\"")
+		}
+		if doc.Source != nil {
+			// Uploads are self-contained: the server never fetches URLs
+			// supplied by its users.
+			resp.reject("remote_source", "source", "\"source\" is not supported for uploads, upload the image instead")
+		}
+	}
+	if len(resp.Reasons) > 0 {
+		return resp, nil
+	}
+
+	select {
+	case s.generating <- struct{}{}:
+	case <-time.After(s.timeout):
+		resp.reject(uploadBusy, "", "waited over %s for the maps ahead of this one to generate, try again later", s.timeout)
+		return resp, nil
+	case <-ctx.Done():
+		resp.reject("cancelled", "", "the upload was cancelled while waiting for generation")
+		return resp, nil
+	}
+	inputs := make(map[string][]byte)
+	for _, name := range mapgen.AuxInputFiles {
+		if data, ok := files[name]; ok {
+			inputs[name] = data
+		}
+	}
+	start := time.Now()
+	job := uploadJob{Name: doc.Name, Image: imageBuffer, Info: info, Inputs: inputs}
+	generated, err := generateSandboxed(ctx, job, sandboxLimits{Timeout: s.timeout, MemoryBytes: s.memoryBytes})
+	<-s.generating
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		slog.Warn(fmt.Sprintf("Generating upload %q timed out after %s", doc.Name, s.timeout))
+		resp.reject("generation_timeout", "", "generating the map took over %s; make the image smaller or simpler", s.timeout)
+		return resp, nil
+	case errors.Is(err, context.Canceled):
+		resp.reject("cancelled", "", "the upload was cancelled during generation")
+		return resp, nil
+	case err != nil:
+		resp.reject("generation_failed", "", "%v", err)
+		return resp, nil
+	}
+	if generated.Annotated != nil {
+		resp.Annotated = "data:image/png;base64," + base64.StdEncoding.EncodeToString(generated.Annotated)
+		resp.Legend = generated.Legend
+	}
+	if generated.Err != "" {
+		resp.reject("generation_failed", "", "%s", generated.Err)
+		return resp, nil
+	}
+	result := generated.Result
+	slog.Info(fmt.Sprintf("Validated upload %q (%dx%d) in %s", doc.Name, result.Map.Width, result.Map.Height, time.Since(start).Round(time.Millisecond)))
+
+	players, err := mapgen.ApplyPlayerCountOverrides(mapgen.RecommendPlayerCounts(result.Stats), info)
+	if err != nil {
+		resp.reject("invalid_players", "players", "%v", err)
+	}
+	if err := checkQualityGates(ctx, config.QualityGates, "", result); err != nil {
+		resp.reject("quality_gates", "generator.quality_gates", "%v", err)
+	}
+	for i, n := range doc.Nations {
+		field := fmt.Sprintf("nations[%d]", i)
+		if len(n.Coordinates) != 2 {
+			resp.reject("invalid_nation", field, "nation %q must have [x, y] coordinates", n.Name)
+			continue
+		}
+		x, y := n.Coordinates[0], n.Coordinates[1]
+		if x < 0 || y < 0 || x >= result.Map.Width || y >= result.Map.Height {
+			resp.reject("nation_off_map", field, "nation %q at %d,%d is outside the %dx%d map", n.Name, x, y, result.Map.Width, result.Map.Height)
+		} else if !mapformat.Tile(result.Map.Data[y*result.Map.Width+x]).IsLand() {
+			resp.reject("nation_not_on_land", field, "nation %q at %d,%d is not on land", n.Name, x, y)
+		}
+	}
+	if len(resp.Reasons) > 0 {
+		return resp, nil
+	}
+
+	map1x, map4x, map16x := newManifestScale(result.Map), newManifestScale(result.Map4x), newManifestScale(result.Map16x)
+	metrics := newMapMetrics(result.Stats, result.Salinity)
+	resp.Accepted = true
+	resp.Map, resp.Map4x, resp.Map16x = &map1x, &map4x, &map16x
+	resp.Players, resp.Stats = &players, &metrics
+	resp.Thumbnail = "data:image/webp;base64," + base64.StdEncoding.EncodeToString(result.Thumbnail)
+	for _, line := range strings.Split(string(generated.Warnings), "\n") {
+		if line != "" {
+			resp.Warnings = append(resp.Warnings, line)
+		}
+	}
+	hash := sourceHash(append([][]byte{imageBuffer, info}, auxInputHashParts(inputs)...)...)
+	return resp, &generatedUpload{Name: doc.Name, Info: info, Config: config, Result: result, Players: players, Metrics: metrics, Hash: hash}
+}
+
+// writeUploadBundle answers an accepted upload with a zip of the files the
+// generator writes for a map: manifest.json, with its sections and
+// checksums as processMap writes them, map.bin, map4x.bin, map16x.bin and
+// thumbnail.webp.
+func writeUploadBundle(w http.ResponseWriter, upload *generatedUpload) error {
+	var manifest map[string]any
+	if err := json.Unmarshal(upload.Info, &manifest); err != nil {
+		return err
+	}
+	addGeneratedSections(manifest, upload.Config, upload.Result, upload.Players, upload.Metrics)
+	manifest["source_hash"] = upload.Hash
+	manifest["generator_version"] = mapgen.GeneratorVersion
+	manifest["schema_version"] = schemaVersion
+	type bundleFile struct {
+		Name string
+		Data []byte
+	}
+	files := []bundleFile{
+		{"map.bin", upload.Result.Map.Data},
+		{"map4x.bin", upload.Result.Map4x.Data},
+		{"map16x.bin", upload.Result.Map16x.Data},
+		{"thumbnail.webp", upload.Result.Thumbnail},
+	}
+	checksums := make(map[string]string, len(files))
+	for _, f := range files {
+		checksums[f.Name] = sha256Hex(f.Data)
+	}
+	manifest["checksums"] = checksums
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range append(files, bundleFile{"manifest.json", manifestData}) {
+		method := zip.Deflate
+		if f.Name == "thumbnail.webp" {
+			method = zip.Store // already compressed
+		}
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: f.Name, Method: method})
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(f.Data); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="map.zip"`)
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// runServe implements the serve command: an HTTP server whose upload
+// endpoint validates maps submitted by the community before a maintainer
+// looks at them, and which can also serve generated maps, see
+// staticServer.
+func runServe(args []string) error {
+	fset, logFlags := newCommandFlagSet("serve")
+	addr := fset.String("addr", "localhost:8080", "address to listen on")
+	tokenFile := fset.String("token-file", "", "file holding the bearer token uploads must present")
+	maxUploadMiB := fset.Int("max-upload-mib", 32, "largest upload accepted, in MiB")
+	maxPixels := fset.Int("max-pixels", mapgen.MaxRecommendedPixelSize, "largest map image accepted, in pixels")
+	maxConcurrent := fset.Int("max-concurrent", 1, "uploads generated at the same time")
+	maxQueue := fset.Int("max-queue", 4, "uploads waiting for generation, beyond which uploads are answered 503")
+	timeout := fset.Duration("generate-timeout", time.Minute, "longest generation of an upload before it is killed and rejected")
+	memoryMiB := fset.Int("generate-memory-mib", 2048, "largest memory, in MiB, of the process generating an upload, beyond which it is rejected")
+	mapsDir := fset.String("maps-dir", "", "optional directory of generated maps to serve under /maps/. ex: -maps-dir=../resources/maps")
+	maxAge := fset.Int("max-age", 0, "seconds clients may cache the served map files without revalidating them, 0 to always revalidate")
+	fset.Parse(args)
+	setupLogging(*logFlags)
+
+	if *tokenFile == "" && *mapsDir == "" {
+		return fmt.Errorf("-token-file or -maps-dir is required")
+	}
+	if *maxUploadMiB < 1 || *maxPixels < 1 || *maxConcurrent < 1 || *timeout <= 0 || *memoryMiB < 1 {
+		return fmt.Errorf("-max-upload-mib, -max-pixels, -max-concurrent, -generate-timeout and -generate-memory-mib must be positive")
+	}
+	if *maxQueue < 0 {
+		return fmt.Errorf("-max-queue must not be negative")
+	}
+	if *maxAge < 0 {
+		return fmt.Errorf("-max-age must not be negative")
+	}
+	mux := http.NewServeMux()
+	// without a token, the server only serves maps
+	if *tokenFile != "" {
+		token, err := os.ReadFile(*tokenFile)
+		if err != nil {
+			return err
+		}
+		token = bytes.TrimSpace(token)
+		if len(token) == 0 {
+			return fmt.Errorf("%s is empty", *tokenFile)
+		}
+		s := &uploadServer{
+			token:          token,
+			maxUploadBytes: int64(*maxUploadMiB) << 20,
+			maxPixels:      *maxPixels,
+			generating:     make(chan struct{}, *maxConcurrent),
+			queued:         make(chan struct{}, *maxConcurrent+*maxQueue),
+			timeout:        *timeout,
+			memoryBytes:    uint64(*memoryMiB) << 20,
+		}
+		mux.HandleFunc(uploadPath, s.handleUpload)
+		mux.HandleFunc(bundlePath, s.handleBundle)
+		slog.Info(fmt.Sprintf("Serving uploads on http://%s%s and http://%s%s", *addr, uploadPath, *addr, bundlePath))
+	}
+	if *mapsDir != "" {
+		root, err := os.OpenRoot(*mapsDir)
+		if err != nil {
+			return err
+		}
+		defer root.Close()
+		s := &staticServer{root: root, maxAge: *maxAge}
+		mux.HandleFunc(staticPath, s.handleStatic)
+		slog.Info(fmt.Sprintf("Serving the maps of %s on http://%s%s", *mapsDir, *addr, staticPath))
+	}
+	// Uploads must arrive within a minute; answers leave after waiting for
+	// and running a generation, each bounded by the timeout.
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       time.Minute,
+		WriteTimeout:      *timeout*2 + 2*time.Minute,
+		IdleTimeout:       2 * time.Minute,
+	}
+	return server.ListenAndServe()
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+// signKeyFlag is the path of an Ed25519 private key to sign manifests with,
+// if set.
+var signKeyFlag string
+
+// manifestSignature is the manifest "signature" section.
+type manifestSignature struct {
+	Algorithm string `json:"algorithm"`
+	KeyID     string `json:"key_id"`
+	Value     string `json:"value"` // base64
+}
+
+// ed25519KeyID identifies a public key: the first 8 bytes of its SHA-256,
+// in hex.
+func ed25519KeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// readPrivateKey reads a private key written by the keygen command: the
+// base64-encoded 32-byte Ed25519 seed.
+func readPrivateKey(path string) (ed25519.PrivateKey, error) {
+	seed, err := readBase64File(path, ed25519.SeedSize)
+	if err != nil {
+		return nil, err
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// readPublicKey reads a public key written by the keygen command: the
+// base64-encoded 32-byte Ed25519 public key.
+func readPublicKey(path string) (ed25519.PublicKey, error) {
+	key, err := readBase64File(path, ed25519.PublicKeySize)
+	if err != nil {
+		return nil, err
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+func readBase64File(path string, size int) ([]byte, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(raw)))
+	if err != nil {
+		return nil, fmt.Errorf("%s is not base64: %w", path, err)
+	}
+	if len(data) != size {
+		return nil, fmt.Errorf("%s holds %d bytes, expected %d", path, len(data), size)
+	}
+	return data, nil
+}
+
+// signedFilesName is the signed list of every file in a map directory,
+// written with --sign-key once all of the map's outputs are written.
+const signedFilesName = "signed_files.json"
+
+// canonicalManifest parses a signed JSON document, a manifest or a
+// signed_files.json, and returns it with its signature removed, and the bytes
+// that are signed: the document in the JSON Canonicalization Scheme (RFC
+// 8785), see canonicalJSON, so that verifiers in other languages can
+// reproduce them with any JCS implementation.
+//
+// The manifest checksums cover the binaries, thumbnail, layers and patches,
+// but not the files derived from them after the manifest is written, such as
+// containers, bundles, chunks, analytics and precompressed copies, some of
+// which embed the manifest. Those are covered by signed_files.json instead.
+func canonicalManifest(data []byte) (map[string]any, []byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var manifest map[string]any
+	if err := dec.Decode(&manifest); err != nil {
+		return nil, nil, fmt.Errorf("not valid JSON: %w", err)
+	}
+	delete(manifest, "signature")
+	signed, err := canonicalJSON(manifest)
+	if err != nil {
+		return nil, nil, err
+	}
+	return manifest, signed, nil
+}
+
+// signJSON returns the JSON document data, indented, with an Ed25519
+// signature embedded as its "signature" section, replacing any previous one.
+func signJSON(data []byte, key ed25519.PrivateKey) ([]byte, error) {
+	doc, signed, err := canonicalManifest(data)
+	if err != nil {
+		return nil, err
+	}
+	doc["signature"] = manifestSignature{
+		Algorithm: "ed25519",
+		KeyID:     ed25519KeyID(key.Public().(ed25519.PublicKey)),
+		Value:     base64.StdEncoding.EncodeToString(ed25519.Sign(key, signed)),
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// writeIfChanged writes data to path unless the file already holds it.
+func writeIfChanged(path string, data []byte) error {
+	if old, err := os.ReadFile(path); err == nil && bytes.Equal(old, data) {
+		return nil
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// signManifest embeds an Ed25519 signature of the manifest in mapDir as its
+// "signature" section, replacing any previous one. Ed25519 signatures are
+// deterministic, so re-signing an unchanged manifest leaves it unchanged.
+func signManifest(mapDir string, key ed25519.PrivateKey) error {
+	path := filepath.Join(mapDir, "manifest.json")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	out, err := signJSON(data, key)
+	if err != nil {
+		return fmt.Errorf("manifest is %w", err)
+	}
+	return writeIfChanged(path, out)
+}
+
+// signMapOutputs signs the manifest of a processed map.
+func signMapOutputs(m mapEntry, key ed25519.PrivateKey) error {
+	outDir, err := outputMapDir(m.IsTest)
+	if err != nil {
+		return err
+	}
+	if err := signManifest(filepath.Join(outDir, m.Name), key); err != nil {
+		return fmt.Errorf("failed to sign manifest for %s: %w", m.Name, err)
+	}
+	return nil
+}
+
+// mapDirFiles returns the SHA-256 of every file in mapDir but
+// signed_files.json.
+func mapDirFiles(mapDir string) (map[string]string, error) {
+	entries, err := os.ReadDir(mapDir)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]string, len(entries))
+	for _, e := range entries {
+		if !e.Type().IsRegular() || e.Name() == signedFilesName {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(mapDir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		files[e.Name()] = sha256Hex(data)
+	}
+	return files, nil
+}
+
+// writeSignedFiles writes the signed_files.json of a processed map with
+// --sign-key, once all of its outputs are written, and otherwise removes any
+// left by an earlier run. It lists the SHA-256 of every file in the map
+// directory, so that its signature covers the files derived after the
+// manifest was signed too.
+func writeSignedFiles(m mapEntry, key ed25519.PrivateKey) error {
+	outDir, err := outputMapDir(m.IsTest)
+	if err != nil {
+		return err
+	}
+	mapDir := filepath.Join(outDir, m.Name)
+	path := filepath.Join(mapDir, signedFilesName)
+	if key == nil {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove stale %s for %s: %w", signedFilesName, m.Name, err)
+		}
+		return nil
+	}
+	files, err := mapDirFiles(mapDir)
+	if err != nil {
+		return fmt.Errorf("failed to list the files of %s: %w", m.Name, err)
+	}
+	data, err := json.Marshal(map[string]any{"files": files})
+	if err != nil {
+		return err
+	}
+	out, err := signJSON(data, key)
+	if err != nil {
+		return err
+	}
+	if err := writeIfChanged(path, out); err != nil {
+		return fmt.Errorf("failed to write %s for %s: %w", signedFilesName, m.Name, err)
+	}
+	return nil
+}
+
+// verifySignedFiles checks that the signed_files.json in mapDir carries a
+// valid signature by one of keys and lists exactly the files of mapDir, with
+// their digests.
+func verifySignedFiles(mapDir string, keys []ed25519.PublicKey) error {
+	data, err := os.ReadFile(filepath.Join(mapDir, signedFilesName))
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", signedFilesName, err)
+	}
+	if err := verifyDocumentSignature(signedFilesName, data, keys); err != nil {
+		return err
+	}
+	var doc struct {
+		Files map[string]string `json:"files"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("%s is not valid JSON: %w", signedFilesName, err)
+	}
+	files, err := mapDirFiles(mapDir)
+	if err != nil {
+		return err
+	}
+	for name, sum := range files {
+		want, ok := doc.Files[name]
+		if !ok {
+			return fmt.Errorf("%s is not listed in %s", name, signedFilesName)
+		}
+		if sum != want {
+			return fmt.Errorf("%s checksum mismatch: %s has %s, file has %s", name, signedFilesName, want, sum)
+		}
+	}
+	for name := range doc.Files {
+		if _, ok := files[name]; !ok {
+			return fmt.Errorf("%s lists %s, which is missing", signedFilesName, name)
+		}
+	}
+	return nil
+}
+
+// verifyManifestSignature checks that the manifest in mapDir carries a valid
+// signature by one of keys.
+func verifyManifestSignature(mapDir string, keys []ed25519.PublicKey) error {
+	data, err := os.ReadFile(filepath.Join(mapDir, "manifest.json"))
+	if err != nil {
+		return fmt.Errorf("failed to read manifest: %w", err)
+	}
+	return verifyDocumentSignature("manifest", data, keys)
+}
+
+// verifyDocumentSignature checks that the JSON document data, named name in
+// errors, carries a valid signature by one of keys.
+func verifyDocumentSignature(name string, data []byte, keys []ed25519.PublicKey) error {
+	var doc struct {
+		Signature *manifestSignature `json:"signature"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("%s is not valid JSON: %w", name, err)
+	}
+	sig := doc.Signature
+	if sig == nil {
+		return fmt.Errorf("%s is not signed", name)
+	}
+	if sig.Algorithm != "ed25519" {
+		return fmt.Errorf("unsupported signature algorithm %q", sig.Algorithm)
+	}
+	value, err := base64.StdEncoding.DecodeString(sig.Value)
+	if err != nil {
+		return fmt.Errorf("signature is not base64: %w", err)
+	}
+	_, signed, err := canonicalManifest(data)
+	if err != nil {
+		return fmt.Errorf("%s is %w", name, err)
+	}
+	for _, key := range keys {
+		if ed25519KeyID(key) != sig.KeyID {
+			continue
+		}
+		if !ed25519.Verify(key, signed, value) {
+			return fmt.Errorf("invalid signature of %s by key %s", name, sig.KeyID)
+		}
+		return nil
+	}
+	return fmt.Errorf("%s signed by unknown key %s", name, sig.KeyID)
+}
+
+// runKeygen writes a new Ed25519 key pair for signing manifests: the
+// private key to <out>.key, readable only by its owner, and the public key to
+// <out>.pub.
+func runKeygen(args []string) error {
+	fset, logFlags := newCommandFlagSet("keygen")
+	out := fset.String("out", "map-signing", "path of the key pair to write, without extension")
+	fset.Parse(args)
+	setupLogging(*logFlags)
+	logger := mapgen.LoggerFromContext(context.Background())
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	privPath, pubPath := *out+".key", *out+".pub"
+	for _, path := range []string{privPath, pubPath} {
+		if _, err := os.Stat(path); err == nil {
+			return fmt.Errorf("%s already exists", path)
+		}
+	}
+	if err := os.WriteFile(privPath, []byte(base64.StdEncoding.EncodeToString(priv.Seed())+"\n"), 0600); err != nil {
+		return err
+	}
+	if err := os.WriteFile(pubPath, []byte(base64.StdEncoding.EncodeToString(pub)+"\n"), 0644); err != nil {
+		return err
+	}
+	logger.Info(fmt.Sprintf("Wrote key %s to %s and %s; keep %s secret", ed25519KeyID(pub), privPath, pubPath, privPath))
+	return nil
+}
+
+// runVerify checks the generated outputs of every map (or those selected
+// with -maps) with verifyMapDir and, when public keys are given with -keys,
+// that each manifest is signed by one of them. It exits with an error if any
+// map fails.
+func runVerify(args []string) error {
+	fset, logFlags := newCommandFlagSet("verify")
+	fset.StringVar(&mapsFlag, "maps", "", "optional comma-separated list of maps to verify")
+	keysFlag := fset.String("keys", "", "optional comma-separated list of public key files; manifests must be signed by one of them")
+	fset.Parse(args)
+	setupLogging(*logFlags)
+	logger := mapgen.LoggerFromContext(context.Background())
+
+	var keys []ed25519.PublicKey
+	if *keysFlag != "" {
+		for _, path := range strings.Split(*keysFlag, ",") {
+			key, err := readPublicKey(path)
+			if err != nil {
+				return err
+			}
+			keys = append(keys, key)
+		}
+	}
+
+	discovered, err := discoverMaps()
+	if err != nil {
+		return err
+	}
+	maps = discovered
+	selected, err := parseMapsFlag()
+	if err != nil {
+		return err
+	}
+
+	checked, failed := 0, 0
+	for _, m := range maps {
+		if selected != nil && !selected[m.Name] {
+			continue
+		}
+		outDir, err := outputMapDir(m.IsTest)
+		if err != nil {
+			return err
+		}
+		mapDir := filepath.Join(outDir, m.Name)
+		checked++
+		err = verifyMapDir(mapDir)
+		if err == nil && keys != nil {
+			err = verifyManifestSignature(mapDir, keys)
+		}
+		if err == nil && keys != nil {
+			err = verifySignedFiles(mapDir, keys)
+		}
+		if err != nil {
+			failed++
+			logger.Error(fmt.Sprintf("%s: %v", m.Name, err))
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d map(s) failed verification", failed, checked)
+	}
+	if keys != nil {
+		logger.Info(fmt.Sprintf("Verified %d map(s) and their signatures", checked))
+	} else {
+		logger.Info(fmt.Sprintf("Verified %d map(s)", checked))
+	}
+	return nil
+}
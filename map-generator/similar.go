@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"log/slog"
+	"math"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/chai2010/webp"
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapformat"
+)
+
+// terrainSignatureSize is the side of the grid a map's land mask is
+// resampled to for terrain similarity.
+const terrainSignatureSize = 32
+
+// mapFingerprint identifies the geography of a generated map.
+type mapFingerprint struct {
+	Name string
+	// ThumbnailHash is a 64-bit difference hash of the thumbnail.
+	ThumbnailHash uint64
+	// Terrain is the land fraction of each cell of a
+	// terrainSignatureSize×terrainSignatureSize grid over the 1/16 scale map.
+	Terrain []float64
+}
+
+// similarPair is a pair of maps reported as near-duplicates.
+type similarPair struct {
+	A, B         string
+	HashDistance int     // differing thumbnail hash bits, 0-64
+	Similarity   float64 // terrain similarity, 0-1
+}
+
+// runSimilar compares every pair of generated maps and reports those that
+// look like near-duplicates, so that resubmissions of existing geography are
+// caught in review. Two measures are used: the Hamming distance between
+// difference hashes of the thumbnails, which catches recoloured or slightly
+// edited copies, and the similarity of the land masks resampled to a common
+// grid, which catches copies re-exported at another resolution. It exits
+// with an error if any pair is reported.
+func runSimilar(args []string) error {
+	fset, logFlags := newCommandFlagSet("similar")
+	defaultDir, err := outputMapDir(false)
+	if err != nil {
+		return err
+	}
+	dir := fset.String("dir", defaultDir, "directory holding the generated maps")
+	maxHashDistance := fset.Int("max-hash-distance", 6, "report pairs whose thumbnail hashes differ in at most this many of 64 bits")
+	minSimilarity := fset.Float64("min-similarity", 0.95, "report pairs whose terrain similarity (0-1) is at least this")
+	fset.Parse(args)
+	setupLogging(*logFlags)
+	logger := slog.Default()
+
+	entries, err := os.ReadDir(*dir)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", *dir, err)
+	}
+	var fingerprints []mapFingerprint
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		fp, err := fingerprintMap(filepath.Join(*dir, entry.Name()))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("map %s: %w", entry.Name(), err)
+		}
+		fp.Name = entry.Name()
+		fingerprints = append(fingerprints, fp)
+	}
+
+	var pairs []similarPair
+	for i := range fingerprints {
+		for j := i + 1; j < len(fingerprints); j++ {
+			a, b := fingerprints[i], fingerprints[j]
+			pair := similarPair{
+				A:            a.Name,
+				B:            b.Name,
+				HashDistance: bits.OnesCount64(a.ThumbnailHash ^ b.ThumbnailHash),
+				Similarity:   terrainSimilarity(a.Terrain, b.Terrain),
+			}
+			if pair.HashDistance <= *maxHashDistance || pair.Similarity >= *minSimilarity {
+				pairs = append(pairs, pair)
+			}
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].Similarity > pairs[j].Similarity
+	})
+
+	logger.Info(fmt.Sprintf("Compared %d maps", len(fingerprints)))
+	for _, p := range pairs {
+		logger.Warn(fmt.Sprintf("%s and %s look alike: terrain similarity %.3f, thumbnail hash distance %d/64", p.A, p.B, p.Similarity, p.HashDistance))
+	}
+	if len(pairs) > 0 {
+		return fmt.Errorf("found %d near-duplicate pair(s)", len(pairs))
+	}
+	logger.Info("No near-duplicates found")
+	return nil
+}
+
+// fingerprintMap reads the thumbnail and 1/16 scale map of a generated map
+// directory.
+func fingerprintMap(mapDir string) (mapFingerprint, error) {
+	manifestBuffer, err := os.ReadFile(filepath.Join(mapDir, "manifest.json"))
+	if err != nil {
+		return mapFingerprint{}, err
+	}
+	var manifest struct {
+		Map16x manifestScale `json:"map16x"`
+	}
+	if err := json.Unmarshal(manifestBuffer, &manifest); err != nil {
+		return mapFingerprint{}, fmt.Errorf("invalid manifest: %w", err)
+	}
+	thumbnail, err := os.ReadFile(filepath.Join(mapDir, "thumbnail.webp"))
+	if err != nil {
+		return mapFingerprint{}, err
+	}
+	img, err := webp.Decode(bytes.NewReader(thumbnail))
+	if err != nil {
+		return mapFingerprint{}, fmt.Errorf("failed to decode thumbnail: %w", err)
+	}
+	packed, err := os.ReadFile(filepath.Join(mapDir, "map16x.bin"))
+	if err != nil {
+		return mapFingerprint{}, err
+	}
+	width, height := manifest.Map16x.Width, manifest.Map16x.Height
+	if width <= 0 || height <= 0 || len(packed) != width*height {
+		return mapFingerprint{}, fmt.Errorf("map16x.bin does not match the manifest dimensions")
+	}
+	return mapFingerprint{
+		ThumbnailHash: differenceHash(img),
+		Terrain:       terrainSignature(packed, width, height),
+	}, nil
+}
+
+// differenceHash returns the 64-bit dHash of img: the image is reduced to a
+// 9×8 grayscale grid by box averaging, and each bit records whether a cell
+// is brighter than its right neighbour.
+func differenceHash(img image.Image) uint64 {
+	const w, h = 9, 8
+	b := img.Bounds()
+	var sums [w * h]float64
+	var counts [w * h]int
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, _ := img.At(x, y).RGBA()
+			cell := ((y-b.Min.Y)*h/b.Dy())*w + (x-b.Min.X)*w/b.Dx()
+			sums[cell] += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(bl)
+			counts[cell]++
+		}
+	}
+	var hash uint64
+	for y := 0; y < h; y++ {
+		for x := 0; x < w-1; x++ {
+			left := sums[y*w+x] / math.Max(1, float64(counts[y*w+x]))
+			right := sums[y*w+x+1] / math.Max(1, float64(counts[y*w+x+1]))
+			hash <<= 1
+			if left > right {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// terrainSignature resamples the land mask of a packed map (row-major, as
+// written to the .bin files) to a terrainSignatureSize square grid of land
+// fractions. Impassable tiles count as neither land nor water.
+func terrainSignature(packed []byte, width, height int) []float64 {
+	const n = terrainSignatureSize
+	land := make([]float64, n*n)
+	counts := make([]int, n*n)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			tile := mapformat.Tile(packed[y*width+x])
+			if tile.IsImpassable() {
+				continue
+			}
+			cell := (y*n/height)*n + x*n/width
+			counts[cell]++
+			if tile.IsLand() {
+				land[cell]++
+			}
+		}
+	}
+	for i := range land {
+		if counts[i] > 0 {
+			land[i] /= float64(counts[i])
+		}
+	}
+	return land
+}
+
+// terrainSimilarity returns 1 minus the mean absolute difference of two
+// terrain signatures: 1 for identical land masks, 0 for inverse ones.
+func terrainSimilarity(a, b []float64) float64 {
+	diff := 0.0
+	for i := range a {
+		diff += math.Abs(a[i] - b[i])
+	}
+	return 1 - diff/float64(len(a))
+}
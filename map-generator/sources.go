@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+const (
+	// maxSourceDownloadSize bounds remote source downloads.
+	maxSourceDownloadSize = 1 << 30
+	// sourceDownloadTimeout bounds the duration of a single download.
+	sourceDownloadTimeout = 10 * time.Minute
+)
+
+// sourceCacheFlag is the directory where downloaded source images are cached.
+var sourceCacheFlag string
+
+// remoteSource is the optional "source" section of info.json, pointing at a
+// source image kept in object storage instead of the repository:
+//
+//	"source": {
+//	  "url": "https://maps.example.com/world/image.png",
+//	  "sha256": "<hex digest of the PNG>"
+//	}
+//
+// url may be http(s) or s3://bucket/key (a public S3 bucket). For Cloudflare
+// R2, use the bucket's public https URL. sha256 is required so that builds
+// stay reproducible.
+type remoteSource struct {
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256"`
+}
+
+// defaultSourceCacheDir returns the default --source-cache directory.
+func defaultSourceCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "openfront-map-generator", "sources")
+}
+
+// parseRemoteSource extracts the "source" section from an info.json buffer.
+// It returns nil if the map has no remote source.
+func parseRemoteSource(infoBuffer []byte) (*remoteSource, error) {
+	var info struct {
+		Source *remoteSource `json:"source"`
+	}
+	if err := json.Unmarshal(infoBuffer, &info); err != nil {
+		return nil, err
+	}
+	if info.Source == nil {
+		return nil, nil
+	}
+	if info.Source.URL == "" {
+		return nil, fmt.Errorf("\"source\" is missing \"url\"")
+	}
+	if _, err := hex.DecodeString(info.Source.SHA256); err != nil || len(info.Source.SHA256) != sha256.Size*2 {
+		return nil, fmt.Errorf("\"source\" must have a hex \"sha256\" digest")
+	}
+	info.Source.SHA256 = strings.ToLower(info.Source.SHA256)
+	return info.Source, nil
+}
+
+// cachePath returns where the source is stored once downloaded and verified.
+func (s *remoteSource) cachePath() string {
+	return filepath.Join(sourceCacheFlag, s.SHA256+".png")
+}
+
+// httpURL resolves the source URL to the http(s) URL to download.
+func (s *remoteSource) httpURL() (string, error) {
+	return objectHTTPURL(s.URL)
+}
+
+// objectHTTPURL resolves an http(s) or s3://bucket/key URL (a public S3
+// bucket) to the http(s) URL to download.
+func objectHTTPURL(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid url %q: %w", rawURL, err)
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return u.String(), nil
+	case "s3":
+		return fmt.Sprintf("https://%s.s3.amazonaws.com/%s", u.Host, strings.TrimPrefix(u.Path, "/")), nil
+	default:
+		return "", fmt.Errorf("unsupported url scheme %q in %q", u.Scheme, rawURL)
+	}
+}
+
+// readSourceImage returns the source image of a map. A local image.png always
+// wins, so authors can iterate on a map whose published source lives
+// remotely; otherwise the remote source from info.json is fetched through the
+// cache. Maps with neither but a heightmap get no source image.
+func readSourceImage(ctx context.Context, mapInputDir string, infoBuffer []byte) ([]byte, error) {
+	logger := mapgen.LoggerFromContext(ctx)
+	localPath := filepath.Join(mapInputDir, "image.png")
+	imageBuffer, err := os.ReadFile(localPath)
+	if err == nil || !errors.Is(err, os.ErrNotExist) {
+		if err != nil {
+			return nil, fmt.Errorf("failed to read map file %s: %w", localPath, err)
+		}
+		return imageBuffer, nil
+	}
+
+	source, err := parseRemoteSource(infoBuffer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid remote source in info.json: %w", err)
+	}
+	if source == nil {
+		if hasHeightmap(mapInputDir) {
+			// The terrain comes from the heightmap alone, see GenerateMap.
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read map file %s: %w", localPath, os.ErrNotExist)
+	}
+	if err := fetchRemoteSource(ctx, source); err != nil {
+		return nil, err
+	}
+	logger.Debug(fmt.Sprintf("Using remote source %s from cache %s", source.URL, source.cachePath()))
+	return os.ReadFile(source.cachePath())
+}
+
+// fetchRemoteSource downloads a remote source into the cache unless a copy is
+// already there. The download is streamed to a temporary file and hashed on
+// the way; it is only moved into place if the digest matches.
+func fetchRemoteSource(ctx context.Context, source *remoteSource) error {
+	logger := mapgen.LoggerFromContext(ctx)
+	if _, err := os.Stat(source.cachePath()); err == nil {
+		return nil
+	}
+	downloadURL, err := source.httpURL()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(sourceCacheFlag, 0755); err != nil {
+		return fmt.Errorf("failed to create source cache %s: %w", sourceCacheFlag, err)
+	}
+
+	logger.Info(fmt.Sprintf("Downloading source image %s", downloadURL))
+	ctx, cancel := context.WithTimeout(ctx, sourceDownloadTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, downloadURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request for %s: %w", downloadURL, err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", downloadURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download %s: %s", downloadURL, resp.Status)
+	}
+
+	tmp, err := os.CreateTemp(sourceCacheFlag, ".download-*")
+	if err != nil {
+		return fmt.Errorf("failed to create download file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(resp.Body, maxSourceDownloadSize+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", downloadURL, err)
+	}
+	if n > maxSourceDownloadSize {
+		return fmt.Errorf("source %s is larger than %s", downloadURL, formatBytes(maxSourceDownloadSize))
+	}
+	if got := hex.EncodeToString(hash.Sum(nil)); got != source.SHA256 {
+		return fmt.Errorf("checksum mismatch for %s: info.json has %s, downloaded file has %s", downloadURL, source.SHA256, got)
+	}
+	if err := os.Rename(tmp.Name(), source.cachePath()); err != nil {
+		return fmt.Errorf("failed to store %s in the source cache: %w", downloadURL, err)
+	}
+	logger.Info(fmt.Sprintf("Cached %s (%s)", downloadURL, formatBytes(uint64(n))))
+	return nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapformat"
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+// staticPath is the prefix under which the serve command serves generated
+// maps, as /maps/<map>/<file>.
+const staticPath = "/maps/"
+
+// staticContentTypes are the content types of the generated files, by
+// extension. Files of other extensions are not served.
+var staticContentTypes = map[string]string{
+	".bin":    "application/octet-stream",
+	".chunks": "application/octet-stream",
+	".json":   "application/json",
+	".pb":     "application/octet-stream",
+	".fb":     "application/octet-stream",
+	".webp":   "image/webp",
+	".png":    "image/png",
+}
+
+// staticEncodings are the precompressed copies the server prefers, with the
+// extension --precompress gives them, best first.
+var staticEncodings = []struct {
+	Name, Ext string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// staticServer serves the output directory of the generator to game clients
+// in development and on small private servers, without a separate web
+// server.
+type staticServer struct {
+	root *os.Root
+	// maxAge is how long, in seconds, clients may use a map file without
+	// revalidating it, 0 to revalidate it on every use.
+	maxAge int
+}
+
+// handleStatic serves a generated file. Its ETag is its checksum in the map's
+// manifest, or for files the manifest doesn't list, such as the manifest
+// itself, the hash of its content, so that clients revalidating a file they
+// hold get a 304 until it is regenerated. Precompressed copies written by
+// --precompress are served to clients accepting their encoding. The manifest
+// is always revalidated, since it names the current version of every other
+// file.
+func (s *staticServer) handleStatic(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimPrefix(path.Clean(r.URL.Path), staticPath)
+	mapName, file := path.Split(name)
+	mapName = strings.TrimSuffix(mapName, "/")
+	contentType, ok := staticContentTypes[path.Ext(file)]
+	if !ok || mapName == "" || strings.Contains(mapName, "/") || strings.HasPrefix(mapName, ".") {
+		http.NotFound(w, r)
+		return
+	}
+
+	etag, err := s.etag(mapName, file)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	served, encoding := name, ""
+	accepted := r.Header.Get("Accept-Encoding")
+	for _, e := range staticEncodings {
+		if !acceptsEncoding(accepted, e.Name) {
+			continue
+		}
+		if _, err := s.root.Stat(name + e.Ext); err == nil {
+			served, encoding = name+e.Ext, e.Name
+			break
+		}
+	}
+	f, err := s.root.Open(served)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", contentType)
+	h.Set("Vary", "Accept-Encoding")
+	h.Set("Access-Control-Allow-Origin", "*")
+	h.Set("Access-Control-Expose-Headers", "ETag")
+	if encoding != "" {
+		h.Set("Content-Encoding", encoding)
+		etag += "-" + encoding
+	}
+	h.Set("ETag", `"`+etag+`"`)
+	if file == "manifest.json" || s.maxAge == 0 {
+		h.Set("Cache-Control", "no-cache")
+	} else {
+		h.Set("Cache-Control", fmt.Sprintf("public, max-age=%d", s.maxAge))
+	}
+	// ServeContent answers If-None-Match, If-Modified-Since and ranges
+	http.ServeContent(w, r, "", info.ModTime(), f)
+}
+
+// etag returns the entity tag of a generated file, without quotes.
+func (s *staticServer) etag(mapName, file string) (string, error) {
+	if manifest, err := fs.ReadFile(s.root.FS(), path.Join(mapName, "manifest.json")); err == nil && file != "manifest.json" {
+		if m, err := mapformat.ParseManifest(manifest); err == nil {
+			if sum, ok := m.Checksums[file]; ok {
+				return sum, nil
+			}
+		}
+	}
+	data, err := fs.ReadFile(s.root.FS(), path.Join(mapName, file))
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// fail answers a request whose file could not be read.
+func (s *staticServer) fail(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrInvalid) {
+		http.NotFound(w, r)
+		return
+	}
+	mapgen.LoggerFromContext(r.Context()).Error(fmt.Sprintf("Failed to serve %s: %v", r.URL.Path, err))
+	http.Error(w, "internal server error", http.StatusInternalServerError)
+}
+
+// acceptsEncoding reports whether an Accept-Encoding header accepts an
+// encoding, that is lists it with a non-zero quality.
+func acceptsEncoding(header, encoding string) bool {
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		if !strings.EqualFold(strings.TrimSpace(name), encoding) {
+			continue
+		}
+		q, ok := strings.CutPrefix(strings.TrimSpace(params), "q=")
+		if !ok {
+			return true
+		}
+		v, err := strconv.ParseFloat(q, 64)
+		return err == nil && v > 0
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+// mapStatus describes what happened to a map during a run.
+type mapStatus string
+
+const (
+	mapGenerated mapStatus = "generated"
+	mapSkipped   mapStatus = "skipped"
+	mapArchived  mapStatus = "archived"
+	mapFailed    mapStatus = "failed"
+)
+
+// mapOutcome records the result of processing a single map.
+type mapOutcome struct {
+	Entry    mapEntry
+	Status   mapStatus
+	Duration time.Duration
+	Err      error
+	Warnings []string // warnings and errors logged while processing the map
+	// Compressed holds the sizes of the map's precompressed files, nil
+	// without --precompress.
+	Compressed *compressedSizes
+	// Size and PreviousSize are what a player downloads for the map, see
+	// clientDownloadFiles, after and before processing, 0 if not written.
+	Size, PreviousSize int64
+}
+
+// logMapResult logs the one-line result of a map as soon as it is
+// processed, tagged with ResultLogTag, so --quiet keeps it.
+func logMapResult(ctx context.Context, o mapOutcome) {
+	msg := fmt.Sprintf("%s: %s in %s", o.Entry.Name, o.Status, o.Duration.Round(time.Millisecond))
+	if len(o.Warnings) > 0 {
+		msg += fmt.Sprintf(", %d warning(s)", len(o.Warnings))
+	}
+	if o.Err != nil {
+		msg += fmt.Sprintf(": %v", o.Err)
+	}
+	mapgen.LoggerFromContext(ctx).Info(msg, mapgen.ResultLogTag)
+}
+
+// logRunSummary logs which maps were generated, skipped or failed in a run.
+// The summary is tagged with ResultLogTag, so --quiet keeps it.
+func logRunSummary(ctx context.Context, outcomes []mapOutcome) {
+	logger := mapgen.LoggerFromContext(ctx)
+	byStatus := make(map[mapStatus][]string)
+	for _, o := range outcomes {
+		byStatus[o.Status] = append(byStatus[o.Status], o.Entry.Name)
+	}
+	for _, names := range byStatus {
+		sort.Strings(names)
+	}
+	logger.Info(fmt.Sprintf("Generated %d map(s)", len(byStatus[mapGenerated])), mapgen.ResultLogTag)
+	if skipped := byStatus[mapSkipped]; len(skipped) > 0 {
+		logger.Info(fmt.Sprintf("Skipped %d unchanged map(s) (use --force to regenerate): %s", len(skipped), strings.Join(skipped, ", ")), mapgen.ResultLogTag)
+	}
+	if archived := byStatus[mapArchived]; len(archived) > 0 {
+		logger.Info(fmt.Sprintf("Verified %d archived map(s): %s", len(archived), strings.Join(archived, ", ")), mapgen.ResultLogTag)
+	}
+	var total compressedSizes
+	precompressed := 0
+	for _, o := range outcomes {
+		if c := o.Compressed; c != nil {
+			logger.Debug(fmt.Sprintf("%s: %s, %s gzip, %s brotli", o.Entry.Name, formatBytes(uint64(c.Raw)), formatBytes(uint64(c.Gzip)), formatBytes(uint64(c.Brotli))))
+			total.Raw += c.Raw
+			total.Gzip += c.Gzip
+			total.Brotli += c.Brotli
+			precompressed++
+		}
+	}
+	if precompressed > 0 {
+		logger.Info(fmt.Sprintf("Precompressed %d map(s): %s, %s gzip, %s brotli", precompressed, formatBytes(uint64(total.Raw)), formatBytes(uint64(total.Gzip)), formatBytes(uint64(total.Brotli))), mapgen.ResultLogTag)
+	}
+	if failed := byStatus[mapFailed]; len(failed) > 0 {
+		logger.Error(fmt.Sprintf("Failed %d map(s): %s", len(failed), strings.Join(failed, ", ")))
+	}
+}
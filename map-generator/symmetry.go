@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapformat"
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+// symmetryRegions is how many rows and columns of regions the mismatch of a
+// symmetric map is broken down into.
+const symmetryRegions = 4
+
+// maxSymmetryRegionsShown is how many of the most mismatched regions are
+// listed when a map exceeds its threshold.
+const maxSymmetryRegionsShown = 3
+
+// symmetryMismatch is how far a map is from symmetric under an axis.
+type symmetryMismatch struct {
+	Axis    string
+	Percent float64 // of all tiles
+	// Regions is the mismatch of each region, in percent of its tiles,
+	// row-major over a symmetryRegions×symmetryRegions grid.
+	Regions []float64
+}
+
+// measureSymmetry compares every tile of a packed map with its image under
+// the transform, counting a mismatch when their inspect classes differ:
+// land against water, plains against mountains, ocean against lake or one
+// impassable kind against another. Magnitudes within a class may differ.
+func measureSymmetry(m *mapformat.Map, axis string, t mapgen.MapTransform) symmetryMismatch {
+	result := symmetryMismatch{Axis: axis, Regions: make([]float64, symmetryRegions*symmetryRegions)}
+	counts := make([]int, len(result.Regions))
+	mismatches := 0
+	for y := 0; y < m.Height; y++ {
+		for x := 0; x < m.Width; x++ {
+			tx, ty := t.Point(x, y, m.Width, m.Height)
+			region := (y*symmetryRegions/m.Height)*symmetryRegions + x*symmetryRegions/m.Width
+			counts[region]++
+			if mapgen.TileClass(m.At(x, y)) != mapgen.TileClass(m.At(tx, ty)) {
+				mismatches++
+				result.Regions[region]++
+			}
+		}
+	}
+	result.Percent = 100 * float64(mismatches) / float64(m.Width*m.Height)
+	for i := range result.Regions {
+		if counts[i] > 0 {
+			result.Regions[i] = 100 * result.Regions[i] / float64(counts[i])
+		}
+	}
+	return result
+}
+
+// worstRegions describes the most mismatched regions of a measurement.
+func (s symmetryMismatch) worstRegions() string {
+	order := make([]int, len(s.Regions))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return s.Regions[order[i]] > s.Regions[order[j]] })
+	var parts []string
+	for _, i := range order[:maxSymmetryRegionsShown] {
+		if s.Regions[i] == 0 {
+			break
+		}
+		parts = append(parts, fmt.Sprintf("row %d column %d %.2f%%", i/symmetryRegions+1, i%symmetryRegions+1, s.Regions[i]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// checkSymmetry measures a processed map's symmetry under the axes of its
+// "generator.symmetry" section, logging the mismatch of each axis. Maps
+// beyond their max_mismatch get a warning, or an error under --strict if
+// they are marked competitive, since ranked duel maps need provable
+// fairness.
+func checkSymmetry(ctx context.Context, m mapEntry) error {
+	outDir, err := outputMapDir(m.IsTest)
+	if err != nil {
+		return err
+	}
+	mapDir := filepath.Join(outDir, m.Name)
+	manifest, err := mapformat.ReadManifest(mapDir)
+	if err != nil {
+		return fmt.Errorf("failed to read manifest of %s: %w", m.Name, err)
+	}
+	var generator struct {
+		Symmetry *mapgen.SymmetryConfig `json:"symmetry"`
+	}
+	if raw, ok := manifest.Fields["generator"]; ok {
+		if err := json.Unmarshal(raw, &generator); err != nil {
+			return fmt.Errorf("invalid generator section in manifest of %s: %w", m.Name, err)
+		}
+	}
+	cfg := generator.Symmetry
+	if cfg == nil {
+		return nil
+	}
+	gm, err := mapformat.ReadMap(mapDir, manifest, mapformat.Scale1x)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", m.Name, err)
+	}
+
+	logger := mapgen.LoggerFromContext(ctx)
+	var failed []string
+	for _, axis := range cfg.Axes {
+		t := mapgen.SymmetryAxes[axis]
+		if t.Rotate == 90 && gm.Width != gm.Height {
+			return fmt.Errorf("%s: symmetry axis %s needs a square map, it is %dx%d", m.Name, axis, gm.Width, gm.Height)
+		}
+		s := measureSymmetry(gm, axis, t)
+		if s.Percent <= cfg.MaxMismatch {
+			logger.Info(fmt.Sprintf("Symmetry under %s: %.2f%% of tiles mismatch, within %g%%", axis, s.Percent, cfg.MaxMismatch))
+			continue
+		}
+		failed = append(failed, fmt.Sprintf("%s: %.2f%% of tiles mismatch, over %g%%, worst in %s", axis, s.Percent, cfg.MaxMismatch, s.worstRegions()))
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	msg := "map is not symmetric under " + strings.Join(failed, "; ")
+	if cfg.Competitive && strictFlag {
+		return fmt.Errorf("%s: competitive %s", m.Name, msg)
+	}
+	logger.Warn(strings.ToUpper(msg[:1]) + msg[1:])
+	return nil
+}
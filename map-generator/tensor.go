@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapformat"
+)
+
+// terrainTensorFile is the tensor written for each map by the dataset
+// commands.
+const terrainTensorFile = "terrain.npy"
+
+// terrainTensorChannels name the channels of a terrain tensor, in order.
+// Every channel is 0 or 1 except the magnitude, 0 to 31. Water tiles are
+// those with neither land nor impassable set, and lakes the water tiles
+// without ocean.
+var terrainTensorChannels = []string{"land", "ocean", "shoreline", "impassable", "magnitude"}
+
+// terrainTensor decodes a packed map into a channels×height×width uint8
+// tensor, one plane per terrainTensorChannels entry, each row-major as
+// map.bin, for training bots without a decoder of the packed bits. packed
+// is in the given tile format.
+func terrainTensor(packed []byte, width, height int, format mapformat.TileFormat) []byte {
+	n := width * height
+	data := make([]byte, len(terrainTensorChannels)*n)
+	bit := func(b bool) byte {
+		if b {
+			return 1
+		}
+		return 0
+	}
+	for i, b := range packed {
+		t := format.Tile(b)
+		data[i] = bit(t.IsLand())
+		data[n+i] = bit(t.IsWater() && t.IsOcean())
+		data[2*n+i] = bit(t.IsShoreline())
+		data[3*n+i] = bit(t.IsImpassable())
+		data[4*n+i] = t.Magnitude()
+	}
+	return data
+}
+
+// encodeNpy wraps uint8 data of the given shape in the NumPy .npy format
+// (version 1.0), which numpy.load and most ML tooling read directly.
+func encodeNpy(data []byte, shape ...int) []byte {
+	dims := make([]string, len(shape))
+	for i, d := range shape {
+		dims[i] = fmt.Sprint(d)
+	}
+	shapeText := strings.Join(dims, ", ")
+	if len(shape) == 1 {
+		shapeText += ","
+	}
+	header := fmt.Sprintf("{'descr': '|u1', 'fortran_order': False, 'shape': (%s), }", shapeText)
+	// The magic, version and header length take 10 bytes; the header is
+	// padded with spaces and ends in a newline so that the data is 64-byte
+	// aligned.
+	padding := 63 - (10+len(header))%64
+	header += strings.Repeat(" ", padding) + "\n"
+	out := make([]byte, 0, 10+len(header)+len(data))
+	out = append(out, "\x93NUMPY\x01\x00"...)
+	out = append(out, byte(len(header)), byte(len(header)>>8))
+	out = append(out, header...)
+	return append(out, data...)
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/chai2010/webp"
+)
+
+// thumbDiffGap is the width, in pixels, of the gap between the panels of a
+// thumbnail diff image.
+const thumbDiffGap = 4
+
+// runThumbDiff compares the thumbnails of two directories of generated maps,
+// such as ../resources/maps before and after a regeneration, and writes one
+// image per changed map for reviewers: the old thumbnail, the new one, and
+// the new one dimmed to grayscale with every changed pixel highlighted in
+// red. Added and removed maps get an empty panel on the missing side.
+// Thumbnails are lossy, so a pixel only counts as changed when a channel
+// differs by more than -threshold.
+func runThumbDiff(args []string) error {
+	fset, logFlags := newCommandFlagSet("thumbdiff")
+	oldDir := fset.String("old", "", "directory holding the previously generated maps")
+	newDir := fset.String("new", "", "directory holding the newly generated maps")
+	outDir := fset.String("out", "thumbdiff", "directory to write the diff images to")
+	threshold := fset.Int("threshold", 24, "smallest difference in a color channel (0-255) that marks a pixel as changed")
+	fset.Parse(args)
+	setupLogging(*logFlags)
+	logger := slog.Default()
+	if *oldDir == "" || *newDir == "" {
+		return fmt.Errorf("both -old and -new are required")
+	}
+
+	names := make(map[string]bool)
+	for _, dir := range []string{*oldDir, *newDir} {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", dir, err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				names[entry.Name()] = true
+			}
+		}
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", *outDir, err)
+	}
+	changed := 0
+	for _, name := range sorted {
+		oldData, err := readThumbnail(filepath.Join(*oldDir, name))
+		if err != nil {
+			return fmt.Errorf("map %s: %w", name, err)
+		}
+		newData, err := readThumbnail(filepath.Join(*newDir, name))
+		if err != nil {
+			return fmt.Errorf("map %s: %w", name, err)
+		}
+		if bytes.Equal(oldData, newData) {
+			continue
+		}
+		oldImg, err := decodeThumbnail(oldData)
+		if err != nil {
+			return fmt.Errorf("map %s: old %w", name, err)
+		}
+		newImg, err := decodeThumbnail(newData)
+		if err != nil {
+			return fmt.Errorf("map %s: new %w", name, err)
+		}
+		img, changedPixels := thumbnailDiff(oldImg, newImg, *threshold)
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			return fmt.Errorf("map %s: failed to encode diff: %w", name, err)
+		}
+		path := filepath.Join(*outDir, name+".png")
+		if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		switch {
+		case oldData == nil:
+			logger.Info(fmt.Sprintf("%s: added", name))
+		case newData == nil:
+			logger.Info(fmt.Sprintf("%s: removed", name))
+		default:
+			logger.Info(fmt.Sprintf("%s: %d pixel(s) changed", name, changedPixels))
+		}
+		changed++
+	}
+	logger.Info(fmt.Sprintf("Wrote %d diff image(s) of %d map(s) to %s", changed, len(sorted), *outDir))
+	return nil
+}
+
+// readThumbnail returns the thumbnail.webp of a generated map directory, or
+// nil if the map or its thumbnail doesn't exist.
+func readThumbnail(mapDir string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(mapDir, "thumbnail.webp"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// decodeThumbnail decodes a thumbnail, returning nil for a missing one.
+func decodeThumbnail(data []byte) (image.Image, error) {
+	if data == nil {
+		return nil, nil
+	}
+	img, err := webp.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode thumbnail: %w", err)
+	}
+	return img, nil
+}
+
+// thumbnailDiff lays out the old thumbnail, the new one and their
+// difference side by side, and returns the image with the number of changed
+// pixels, those with a channel differing by more than threshold. Either
+// thumbnail may be nil; thumbnails of different sizes are compared over the
+// larger size, with the area outside the smaller one counting as changed.
+func thumbnailDiff(oldImg, newImg image.Image, threshold int) (*image.RGBA, int) {
+	w, h := 0, 0
+	for _, img := range []image.Image{oldImg, newImg} {
+		if img != nil {
+			w = max(w, img.Bounds().Dx())
+			h = max(h, img.Bounds().Dy())
+		}
+	}
+	out := image.NewRGBA(image.Rect(0, 0, 3*w+2*thumbDiffGap, h))
+	draw.Draw(out, out.Bounds(), image.NewUniform(color.RGBA{32, 32, 32, 255}), image.Point{}, draw.Src)
+	panel := func(i int) image.Rectangle {
+		x := i * (w + thumbDiffGap)
+		return image.Rect(x, 0, x+w, h)
+	}
+	for i, img := range []image.Image{oldImg, newImg} {
+		if img != nil {
+			draw.Draw(out, panel(i), img, img.Bounds().Min, draw.Over)
+		}
+	}
+
+	pixel := func(img image.Image, x, y int) (color.RGBA, bool) {
+		if img == nil || x >= img.Bounds().Dx() || y >= img.Bounds().Dy() {
+			return color.RGBA{}, false
+		}
+		return color.RGBAModel.Convert(img.At(img.Bounds().Min.X+x, img.Bounds().Min.Y+y)).(color.RGBA), true
+	}
+	changed := 0
+	diff := panel(2)
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			a, okA := pixel(oldImg, x, y)
+			b, okB := pixel(newImg, x, y)
+			if okA != okB || channelDiff(a, b) > threshold {
+				out.SetRGBA(diff.Min.X+x, y, color.RGBA{255, 0, 0, 255})
+				changed++
+				continue
+			}
+			gray := uint8((299*int(b.R) + 587*int(b.G) + 114*int(b.B)) / 1000 / 2)
+			out.SetRGBA(diff.Min.X+x, y, color.RGBA{gray, gray, gray, 255})
+		}
+	}
+	return out, changed
+}
+
+// channelDiff returns the largest difference between a color channel of a
+// and b.
+func channelDiff(a, b color.RGBA) int {
+	d := 0
+	for _, pair := range [][2]uint8{{a.R, b.R}, {a.G, b.G}, {a.B, b.B}, {a.A, b.A}} {
+		d = max(d, int(pair[0])-int(pair[1]), int(pair[1])-int(pair[0]))
+	}
+	return d
+}
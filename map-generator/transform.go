@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+// moveInfoCoordinates rewrites the info.json document of a map for its
+// transformed copy: the spawn coordinates of nations and custom tribes and
+// the coordinates naming continents are moved to point(x, y).
+func moveInfoCoordinates(doc *jsonObject, point func(x, y int) (int, int)) error {
+	move := func(field string, value any) error {
+		obj, ok := value.(*jsonObject)
+		if !ok {
+			return nil
+		}
+		raw, ok := obj.Get("coordinates")
+		if !ok {
+			return nil
+		}
+		coords, ok := raw.([]any)
+		if !ok || len(coords) != 2 {
+			return fmt.Errorf("%s: coordinates must be [x, y]", field)
+		}
+		var xy [2]int
+		for i, c := range coords {
+			n, ok := c.(json.Number)
+			if !ok {
+				return fmt.Errorf("%s: coordinates must be [x, y]", field)
+			}
+			v, err := n.Int64()
+			if err != nil {
+				return fmt.Errorf("%s: coordinates must be integers: %w", field, err)
+			}
+			xy[i] = int(v)
+		}
+		x, y := point(xy[0], xy[1])
+		obj.Set("coordinates", []any{json.Number(fmt.Sprint(x)), json.Number(fmt.Sprint(y))})
+		return nil
+	}
+	moveAll := func(field string, list any) error {
+		entries, _ := list.([]any)
+		for i, entry := range entries {
+			if err := move(fmt.Sprintf("%s[%d]", field, i), entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if nations, ok := doc.Get("nations"); ok {
+		if err := moveAll("nations", nations); err != nil {
+			return err
+		}
+	}
+	if tribes, ok := doc.Get("custom_tribes"); ok {
+		if err := moveAll("custom_tribes", tribes); err != nil {
+			return err
+		}
+	}
+	if continents, ok := doc.Get("continents"); ok {
+		if obj, ok := continents.(*jsonObject); ok {
+			if names, ok := obj.Get("names"); ok {
+				if err := moveAll("continents.names", names); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// runTransform writes a rotated, mirrored and/or jittered copy of a map as a
+// new map folder next to it, with its image, auxiliary images and info.json
+// coordinates transformed. The copy starts out of the playlist.
+func runTransform(args []string) error {
+	fset, logFlags := newCommandFlagSet("transform")
+	name := fset.String("map", "", "map folder to transform")
+	id := fset.String("id", "", "UpperCamelCase id of the new map; its folder is the id lowercased")
+	mapName := fset.String("name", "", "canonical name of the new map (default: the id)")
+	rotate := fset.Int("rotate", 0, "clockwise rotation in degrees: 90, 180 or 270")
+	flip := fset.String("flip", "", "mirror the map after rotating it: h (left to right) or v (top to bottom)")
+	jitterSeed := fset.String("jitter-seed", "", "seed of a coastline jitter remixing the map before it is rotated or mirrored; each seed gives a different variant")
+	jitterAmplitude := fset.Int("jitter-amplitude", 4, fmt.Sprintf("largest distance in pixels, up to %d, the jitter moves coastlines and islands", maxJitterAmplitude))
+	archipelagoSeed := fset.String("archipelago-seed", "", "set the \"generator.archipelago\" stage of the copy with this seed, fragmenting its large landmasses into island chains")
+	force := fset.Bool("force", false, "overwrite the files of an existing map folder")
+	fset.StringVar(&sourceCacheFlag, "source-cache", defaultSourceCacheDir(), "directory where source images referenced by a \"source\" url in info.json are cached.")
+	fset.Parse(args)
+	setupLogging(*logFlags)
+	ctx := context.Background()
+	logger := mapgen.LoggerFromContext(ctx)
+
+	if *name == "" || *id == "" {
+		return fmt.Errorf("-map and -id are required")
+	}
+	t := mapgen.MapTransform{Rotate: *rotate, Flip: *flip}
+	switch t.Rotate {
+	case 0, 90, 180, 270:
+	default:
+		return fmt.Errorf("-rotate (%d) must be one of: 90, 180, 270", t.Rotate)
+	}
+	if !slices.Contains([]string{"", "h", "v"}, t.Flip) {
+		return fmt.Errorf("-flip (%q) must be h or v", t.Flip)
+	}
+	if *jitterAmplitude < 1 || *jitterAmplitude > maxJitterAmplitude {
+		return fmt.Errorf("-jitter-amplitude (%d) must be between 1 and %d", *jitterAmplitude, maxJitterAmplitude)
+	}
+	if t.Rotate == 0 && t.Flip == "" && *jitterSeed == "" && *archipelagoSeed == "" {
+		return fmt.Errorf("set -rotate, -flip, -jitter-seed or -archipelago-seed")
+	}
+	if *mapName == "" {
+		*mapName = *id
+	}
+
+	mapDir, err := findMapInputDir(*name)
+	if err != nil {
+		return err
+	}
+	outDir := filepath.Join(filepath.Dir(mapDir), strings.ToLower(*id))
+	if outDir == mapDir {
+		return fmt.Errorf("-id must differ from the id of %s", *name)
+	}
+	if _, err := os.Stat(outDir); err == nil && !*force {
+		return fmt.Errorf("%s already exists, use -force to overwrite it", outDir)
+	}
+	if hasHeightmap(mapDir) {
+		return fmt.Errorf("%s takes its terrain from a heightmap, which cannot be transformed", *name)
+	}
+
+	raw, err := os.ReadFile(filepath.Join(mapDir, "info.json"))
+	if err != nil {
+		return err
+	}
+	info, err := normalizeJSON5(raw)
+	if err != nil {
+		return fmt.Errorf("invalid info.json: %w", err)
+	}
+	info, _, err = migrateInfoBuffer(info)
+	if err != nil {
+		return fmt.Errorf("failed to migrate info.json: %w", err)
+	}
+	config, err := mapgen.ParseGeneratorConfig(info)
+	if err != nil {
+		return fmt.Errorf("invalid info.json: %w", err)
+	}
+	if config.WrapX && (t.Rotate == 90 || t.Rotate == 270) {
+		return fmt.Errorf("%s wraps horizontally and cannot be rotated by %d°", *name, t.Rotate)
+	}
+	geo, err := mapgen.ParseGeoReference(info)
+	if err != nil {
+		return err
+	}
+	imageBuffer, err := readSourceImage(ctx, mapDir, info)
+	if err != nil {
+		return err
+	}
+	img, err := png.Decode(bytes.NewReader(imageBuffer))
+	if err != nil {
+		return fmt.Errorf("failed to decode PNG: %w", err)
+	}
+	inputs, err := readAuxInputs(mapDir)
+	if err != nil {
+		return err
+	}
+	if config.Projection != mapgen.ProjectionSource && geo != nil && config.Projection != geo.Projection {
+		// The copy is no longer georeferenced, so reproject it now.
+		target := &mapgen.GeoReference{BBox: geo.BBox, Projection: config.Projection}
+		if err := target.Validate(); err != nil {
+			return fmt.Errorf("cannot reproject to %s: %w", config.Projection, err)
+		}
+		if img, inputs, err = mapgen.ReprojectMapImages(ctx, img, inputs, geo, target); err != nil {
+			return err
+		}
+	}
+
+	// Transform the area the generator keeps, so that the copy has exactly
+	// the same tiles.
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	width, height = width-width%4, height-height%4
+
+	doc, err := decodeJSONObject(info)
+	if err != nil {
+		return err
+	}
+	var jitter *coastJitter
+	if *jitterSeed != "" {
+		jitter = &coastJitter{Seed: mapgen.NoiseSeed("jitter:" + *jitterSeed), Amplitude: float64(*jitterAmplitude), WrapX: config.WrapX}
+		jittered := jitter.Image(img, width, height)
+		point := func(x, y int) (int, int) { return jitter.Point(x, y, img, jittered, width, height) }
+		if err := moveInfoCoordinates(doc, point); err != nil {
+			return fmt.Errorf("invalid info.json: %w", err)
+		}
+		logger.Info(fmt.Sprintf("Jittered coastlines with seed %q: land covers %.1f%% of the map, from %.1f%%", *jitterSeed, 100*landShare(jittered, width, height), 100*landShare(img, width, height)))
+		img = jittered
+	}
+	point := func(x, y int) (int, int) { return t.Point(x, y, width, height) }
+	if err := moveInfoCoordinates(doc, point); err != nil {
+		return fmt.Errorf("invalid info.json: %w", err)
+	}
+	doc.Set("id", *id)
+	doc.Set("name", *mapName)
+	doc.Set("translation_key", "map."+strings.ToLower(*id))
+	doc.Set("multiplayer_frequency", json.Number("0"))
+	if categories, ok := doc.Get("categories"); ok {
+		kept := []any{}
+		for _, c := range categories.([]any) {
+			if c != "featured" {
+				kept = append(kept, c)
+			}
+		}
+		doc.Set("categories", kept)
+	}
+	// The image is written locally and is no longer georeferenced.
+	for _, key := range []string{"display_name", "featured_rank", "archived", "source", "geo"} {
+		doc.Delete(key)
+	}
+	if generator, ok := doc.Get("generator"); ok {
+		if obj, ok := generator.(*jsonObject); ok {
+			obj.Delete("projection")
+		}
+	}
+	if *archipelagoSeed != "" {
+		generator, ok := doc.Get("generator")
+		obj, isObject := generator.(*jsonObject)
+		if !ok || !isObject {
+			obj = newJSONObject()
+			doc.Set("generator", obj)
+		}
+		archipelago := newJSONObject()
+		archipelago.Set("seed", *archipelagoSeed)
+		obj.Set("archipelago", archipelago)
+	}
+	if strings.Contains(string(raw), "//") || strings.Contains(string(raw), "/*") {
+		logger.Warn(fmt.Sprintf("%s/info.json may contain JSON5 comments, which are not copied", *name))
+	}
+
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return err
+	}
+	writePNG := func(file string, img image.Image) error {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, t.Image(img, width, height)); err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(outDir, file), buf.Bytes(), 0644)
+	}
+	if err := writePNG("image.png", img); err != nil {
+		return err
+	}
+	for _, file := range mapgen.AuxInputFiles {
+		data, ok := inputs[file]
+		if !ok {
+			continue
+		}
+		if file == mapgen.PaletteFile {
+			// Colours don't move with the pixels they paint
+			if err := os.WriteFile(filepath.Join(outDir, file), data, 0644); err != nil {
+				return err
+			}
+			continue
+		}
+		if filepath.Ext(file) != ".png" {
+			logger.Warn(fmt.Sprintf("%s is not copied: it needs the \"geo\" section, which the transformed map no longer has", file))
+			continue
+		}
+		aux, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("failed to decode %s: %w", file, err)
+		}
+		if b := aux.Bounds(); b.Dx() < width || b.Dy() < height {
+			return fmt.Errorf("%s is %dx%d, smaller than the %dx%d map", file, b.Dx(), b.Dy(), width, height)
+		}
+		if jitter != nil {
+			aux = jitter.Image(aux, width, height)
+		}
+		if err := writePNG(file, aux); err != nil {
+			return err
+		}
+	}
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(outDir, "info.json"), append(out, '\n'), 0644); err != nil {
+		return err
+	}
+	w, h := t.Size(width, height)
+	logger.Info(fmt.Sprintf("Wrote %s, %dx%d, from %s", outDir, w, h, *name))
+	return nil
+}
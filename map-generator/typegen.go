@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapformat"
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+// manifestSections lists the sections the generator adds to the info.json
+// fields of a manifest, with the Go types it writes them from, for the
+// TypeScript types and Zod schemas of the codegen command. Keep it in step
+// with processMap and signMapOutputs.
+type manifestSections struct {
+	Map              manifestScale             `json:"map"`
+	Map4x            manifestScale             `json:"map4x"`
+	Map16x           manifestScale             `json:"map16x"`
+	Generator        mapgen.GeneratorConfig    `json:"generator"`
+	Geo              *mapgen.ManifestGeo       `json:"geo,omitempty"`
+	Players          mapgen.PlayerCounts       `json:"players"`
+	Continents       []mapgen.Continent        `json:"continents"`
+	Cities           []mapgen.City             `json:"cities,omitempty"`
+	Spawns           []mapgen.SpawnPoint       `json:"spawns,omitempty"`
+	Stats            mapMetrics                `json:"stats"`
+	Layers           map[string]map[string]any `json:"layers,omitempty"`
+	SourceHash       string                    `json:"source_hash"`
+	GeneratorVersion int                       `json:"generator_version"`
+	SchemaVersion    int                       `json:"schema_version"`
+	TileFormat       mapformat.TileFormat      `json:"tile_format"`
+	Patches          map[string]manifestPatch  `json:"patches,omitempty"`
+	Checksums        map[string]string         `json:"checksums"`
+	Signature        *manifestSignature        `json:"signature,omitempty"`
+}
+
+// manifestTypeName is the name of the manifest type in the generated code.
+const manifestTypeName = "MapManifest"
+
+// runCodegen implements the codegen command.
+func runCodegen(args []string) error {
+	fs, logFlags := newCommandFlagSet("codegen")
+	outDir := fs.String("out-dir", filepath.Join("..", "src", "core", "game"), "directory to write MapManifest.gen.d.ts, MapManifestSchema.gen.ts and MapContainer.gen.ts to.")
+	check := fs.Bool("check", false, "fail if the files are not up to date instead of writing them.")
+	fs.Parse(args)
+	setupLogging(*logFlags)
+
+	types, schemas := generateManifestTypes()
+	files := []struct {
+		Name string
+		Data []byte
+	}{
+		{manifestTypeName + ".gen.d.ts", types},
+		{manifestTypeName + "Schema.gen.ts", schemas},
+		{containerTypeName + ".gen.ts", generateContainerBindings()},
+	}
+	var stale []string
+	for _, f := range files {
+		path := filepath.Join(*outDir, f.Name)
+		if *check {
+			if existing, err := os.ReadFile(path); err != nil || !bytes.Equal(existing, f.Data) {
+				stale = append(stale, path)
+			}
+			continue
+		}
+		if err := os.MkdirAll(*outDir, 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, f.Data, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		fmt.Printf("Wrote %s\n", path)
+	}
+	if len(stale) > 0 {
+		return fmt.Errorf("out of date, run `go run . codegen`: %s", strings.Join(stale, ", "))
+	}
+	return nil
+}
+
+// manifestTypegen renders Go types as TypeScript types and Zod schemas,
+// declaring every named struct type once, before its first use.
+type manifestTypegen struct {
+	types, schemas strings.Builder
+	declared       map[reflect.Type]bool
+}
+
+// generateManifestTypes returns the contents of the .d.ts file declaring
+// the manifest types and of the module exporting their Zod schemas. The
+// manifest keeps every info.json field as well, so it allows other keys.
+func generateManifestTypes() (types, schemas []byte) {
+	g := &manifestTypegen{declared: make(map[reflect.Type]bool)}
+	header := "// Code generated by map-generator; DO NOT EDIT.\n// Manifest types live in map-generator/typegen.go.\n// Regenerate with `go run . codegen` in map-generator.\n"
+	g.types.WriteString(header)
+	g.schemas.WriteString(header)
+	g.schemas.WriteString("\nimport { z } from \"zod\";\n")
+	g.declare(reflect.TypeOf(manifestSections{}), manifestTypeName, true)
+	return []byte(g.types.String()), []byte(g.schemas.String())
+}
+
+// typeName returns the generated name of a named struct type: its Go name
+// with the first letter capitalised.
+func typeName(t reflect.Type) string {
+	return strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+}
+
+// declare emits an interface and a schema for struct type t, after those
+// of the struct types it uses.
+func (g *manifestTypegen) declare(t reflect.Type, name string, open bool) {
+	g.declared[t] = true
+	type field struct {
+		Name           string
+		Type, Schema   string
+		Optional, Null bool
+	}
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if !f.IsExported() || tag == "-" {
+			continue
+		}
+		jsonName, opts, _ := strings.Cut(tag, ",")
+		if jsonName == "" {
+			jsonName = f.Name
+		}
+		ft := f.Type
+		null := false
+		if ft.Kind() == reflect.Pointer {
+			ft, null = ft.Elem(), true
+		}
+		optional := strings.Contains(opts, "omitempty")
+		tsType, schema := g.render(ft)
+		fields = append(fields, field{Name: jsonName, Type: tsType, Schema: schema, Optional: optional, Null: null && !optional})
+	}
+
+	fmt.Fprintf(&g.types, "\nexport interface %s {\n", name)
+	fmt.Fprintf(&g.schemas, "\nexport const %sSchema = z.object({\n", name)
+	for _, f := range fields {
+		optional, tsType, schema := "", f.Type, f.Schema
+		if f.Optional {
+			optional, schema = "?", schema+".optional()"
+		}
+		if f.Null {
+			tsType, schema = tsType+" | null", schema+".nullable()"
+		}
+		fmt.Fprintf(&g.types, "  %s%s: %s;\n", f.Name, optional, tsType)
+		fmt.Fprintf(&g.schemas, "  %s: %s,\n", f.Name, schema)
+	}
+	if open {
+		g.types.WriteString("  [key: string]: unknown;\n")
+		g.schemas.WriteString("}).passthrough();\n")
+	} else {
+		g.schemas.WriteString("});\n")
+	}
+	g.types.WriteString("}\n")
+	fmt.Fprintf(&g.schemas, "export type %s = z.infer<typeof %sSchema>;\n", name, name)
+}
+
+// render returns the TypeScript type and the Zod schema of a Go type,
+// declaring the named struct types it uses first.
+func (g *manifestTypegen) render(t reflect.Type) (string, string) {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean", "z.boolean()"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "number", "z.number().int()"
+	case reflect.Float32, reflect.Float64:
+		return "number", "z.number()"
+	case reflect.String:
+		return "string", "z.string()"
+	case reflect.Interface:
+		return "unknown", "z.unknown()"
+	case reflect.Pointer:
+		tsType, schema := g.render(t.Elem())
+		return tsType + " | null", schema + ".nullable()"
+	case reflect.Array:
+		tsType, schema := g.render(t.Elem())
+		types := make([]string, t.Len())
+		schemas := make([]string, t.Len())
+		for i := range types {
+			types[i], schemas[i] = tsType, schema
+		}
+		return "[" + strings.Join(types, ", ") + "]", "z.tuple([" + strings.Join(schemas, ", ") + "])"
+	case reflect.Slice:
+		tsType, schema := g.render(t.Elem())
+		if strings.Contains(tsType, " ") {
+			tsType = "(" + tsType + ")"
+		}
+		return tsType + "[]", "z.array(" + schema + ")"
+	case reflect.Map:
+		tsType, schema := g.render(t.Elem())
+		return "Record<string, " + tsType + ">", "z.record(z.string(), " + schema + ")"
+	case reflect.Struct:
+		name := typeName(t)
+		if !g.declared[t] {
+			g.declare(t, name, false)
+		}
+		return name, name + "Schema"
+	}
+	panic(fmt.Sprintf("codegen: unsupported manifest type %s", t))
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"log/slog"
+	"path/filepath"
+	"strings"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapformat"
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+// validateOptions are the thresholds of the validate command.
+type validateOptions struct {
+	MinLand, MaxLand    float64 // percent of the tiles
+	MinUnreachableTiles int
+	NearColor           int // per-channel distance of a stray near-key colour
+	OceanEdge           bool
+}
+
+// lintFinding is a problem found by the validate command, with what to do
+// about it.
+type lintFinding struct {
+	Message string
+	Fix     string
+}
+
+// mapLint is the validate report of one map.
+type mapLint struct {
+	Errors    []lintFinding
+	Warnings  []string // generator warnings, reported without failing
+	LandShare float64  // percent of the tiles, 0 if the map wasn't generated
+	Skipped   string   // why the map wasn't validated, if it wasn't
+}
+
+func (l *mapLint) fail(fix, format string, args ...any) {
+	l.Errors = append(l.Errors, lintFinding{Message: fmt.Sprintf(format, args...), Fix: fix})
+}
+
+// runValidate implements the validate command: it generates every selected
+// map in memory, without writing anything, and checks the terrain for
+// common authoring mistakes, printing a report per map. It fails if any map
+// has a problem, so that map PRs can be gated on it.
+func runValidate(args []string) error {
+	fset, logFlags := newCommandFlagSet("validate")
+	fset.StringVar(&mapsFlag, "maps", "", "optional comma-separated list of maps to validate")
+	var opts validateOptions
+	fset.Float64Var(&opts.MinLand, "min-land", 5, "smallest share of the tiles, in percent, land may cover")
+	fset.Float64Var(&opts.MaxLand, "max-land", 95, "largest share of the tiles, in percent, land may cover")
+	fset.IntVar(&opts.MinUnreachableTiles, "min-unreachable-tiles", 100, "smallest landmass, in tiles, reported when it borders no water and so cannot be reached")
+	fset.IntVar(&opts.NearColor, "near-color", 2, "largest per-channel difference of a pixel from the water blue or a key or impassable colour reported as a stray, 0 to skip the check")
+	fset.BoolVar(&opts.OceanEdge, "ocean-edge", true, "require the ocean of maps with water to reach an edge of the map")
+	fset.Parse(args)
+	setupLogging(*logFlags)
+
+	if opts.MinLand < 0 || opts.MaxLand > 100 || opts.MinLand > opts.MaxLand {
+		return fmt.Errorf("-min-land and -max-land must satisfy 0 <= min <= max <= 100")
+	}
+	if opts.NearColor < 0 {
+		return fmt.Errorf("-near-color must not be negative")
+	}
+	discovered, err := discoverMaps()
+	if err != nil {
+		return err
+	}
+	maps = discovered
+	selected, err := parseMapsFlag()
+	if err != nil {
+		return err
+	}
+
+	checked, failed := 0, 0
+	for _, m := range maps {
+		if selected != nil && !selected[m.Name] {
+			continue
+		}
+		dir, err := inputMapDir(m.IsTest)
+		if err != nil {
+			return err
+		}
+		lint := validateMap(context.Background(), m.Name, filepath.Join(dir, m.Name), opts)
+		checked++
+		switch {
+		case lint.Skipped != "":
+			fmt.Printf("%s: skipped, %s\n", m.Name, lint.Skipped)
+			continue
+		case len(lint.Errors) > 0:
+			failed++
+			fmt.Printf("%s: %d problem(s), %d warning(s), %.1f%% land\n", m.Name, len(lint.Errors), len(lint.Warnings), lint.LandShare)
+		default:
+			fmt.Printf("%s: ok, %d warning(s), %.1f%% land\n", m.Name, len(lint.Warnings), lint.LandShare)
+		}
+		for _, e := range lint.Errors {
+			fmt.Printf("  error: %s\n", e.Message)
+			if e.Fix != "" {
+				fmt.Printf("    fix: %s\n", e.Fix)
+			}
+		}
+		for _, w := range lint.Warnings {
+			fmt.Printf("  warning: %s\n", w)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d map(s) failed validation", failed, checked)
+	}
+	return nil
+}
+
+// validateMap reads, generates and checks one map.
+func validateMap(ctx context.Context, name, mapInputDir string, opts validateOptions) *mapLint {
+	lint := &mapLint{}
+	info, err := readInfoJSON(filepath.Join(mapInputDir, "info.json"))
+	if err != nil {
+		lint.fail("fix the syntax of info.json at the position given", "info.json: %v", err)
+		return lint
+	}
+	var doc struct {
+		Name     string `json:"name"`
+		Archived bool   `json:"archived"`
+	}
+	if err := json.Unmarshal(info, &doc); err != nil {
+		lint.fail("fix info.json to match the schema", "info.json: %v", err)
+		return lint
+	}
+	if doc.Archived {
+		lint.Skipped = "archived"
+		return lint
+	}
+	info, _, err = migrateInfoBuffer(info)
+	if err != nil {
+		lint.fail("run `go run . migrate` or fix the schema_version of info.json", "info.json: %v", err)
+		return lint
+	}
+	if strings.TrimSpace(doc.Name) == "" {
+		lint.fail("add the map's \"name\" to info.json", "info.json has no \"name\"")
+	}
+	config, err := mapgen.ParseGeneratorConfig(info)
+	if err != nil {
+		lint.fail("fix the \"generator\" section of info.json, see the README for its settings", "info.json: %v", err)
+		return lint
+	}
+	inputs, err := readAuxInputs(mapInputDir)
+	if err != nil {
+		lint.fail("", "%v", err)
+		return lint
+	}
+	imageBuffer, err := readSourceImage(ctx, mapInputDir, info)
+	if err != nil {
+		lint.fail("add the map's image.png, or a \"source\" to fetch it from", "%v", err)
+		return lint
+	}
+
+	// Generator warnings are reported instead of logged.
+	var warnings bytes.Buffer
+	logger := slog.New(NewGeneratorLogger(&warnings, &slog.HandlerOptions{Level: slog.LevelWarn}, LogFlags{}))
+	problems := &mapgen.ProblemRecorder{}
+	genCtx := mapgen.ContextWithProblems(mapgen.ContextWithLogger(ctx, logger.With(slog.String("map", name))), problems)
+	result, err := mapgen.GenerateMap(genCtx, mapgen.GeneratorArgs{
+		Name:        name,
+		ImageBuffer: imageBuffer,
+		RemoveSmall: true,
+		Info:        info,
+		Inputs:      inputs,
+		Config:      config,
+	})
+	for _, line := range strings.Split(warnings.String(), "\n") {
+		if line != "" {
+			lint.Warnings = append(lint.Warnings, line)
+		}
+	}
+	if err != nil {
+		lint.fail("", "generation failed: %v", err)
+		return lint
+	}
+
+	m := result.Map
+	lint.LandShare = 100 * float64(m.NumLandTiles) / float64(m.Width*m.Height)
+	if lint.LandShare < opts.MinLand || lint.LandShare > opts.MaxLand {
+		lint.fail(fmt.Sprintf("check that land and water are painted as intended, e.g. water with a blue of %d; or pass -min-land/-max-land if the share is deliberate", config.WaterBlue),
+			"land covers %.1f%% of the tiles, outside %g%%-%g%%", lint.LandShare, opts.MinLand, opts.MaxLand)
+	}
+	if opts.OceanEdge {
+		lintOceanEdge(lint, m, config.WaterBlue)
+	}
+	for _, p := range problems.Problems {
+		switch {
+		case p.Kind == mapgen.ProblemUnreachableLand && p.Tiles >= opts.MinUnreachableTiles:
+			lint.fail("connect it to water, or paint the impassable terrain around it as land or water",
+				"landmass of %d tile(s) around %d,%d borders no water, so it cannot be reached from the rest of the map", p.Tiles, (p.Box.Min.X+p.Box.Max.X)/2, (p.Box.Min.Y+p.Box.Max.Y)/2)
+		case p.Kind == mapgen.ProblemNationSpawn:
+			lint.fail("move the nation's coordinates in info.json onto land", "%s", p.Message)
+		}
+	}
+	if opts.NearColor > 0 && problems.Image != nil {
+		if err := lintStrayColors(lint, problems.Image, config, inputs, opts.NearColor); err != nil {
+			lint.fail("", "%v", err)
+		}
+	}
+	return lint
+}
+
+// lintOceanEdge fails maps with water whose ocean touches no edge of the
+// map, which usually means the water painted along the edges is not water.
+func lintOceanEdge(lint *mapLint, m mapgen.MapInfo, waterBlue int) {
+	water := false
+	for _, b := range m.Data {
+		if mapformat.Tile(b).IsWater() {
+			water = true
+			break
+		}
+	}
+	if !water {
+		return
+	}
+	isOcean := func(x, y int) bool {
+		t := mapformat.Tile(m.Data[y*m.Width+x])
+		return t.IsWater() && t.IsOcean()
+	}
+	for x := 0; x < m.Width; x++ {
+		if isOcean(x, 0) || isOcean(x, m.Height-1) {
+			return
+		}
+	}
+	for y := 0; y < m.Height; y++ {
+		if isOcean(0, y) || isOcean(m.Width-1, y) {
+			return
+		}
+	}
+	lint.fail(fmt.Sprintf("paint the sea along the edges with a blue of %d, or mark it with an \"ocean\" key colour", waterBlue),
+		"the ocean reaches no edge of the map")
+}
+
+// lintStrayColors fails maps with pixels close to, but not exactly, the
+// water blue or a key or impassable colour, which usually come from
+// resampling or antialiasing and are then classified as something else.
+// Near-blue pixels next to water are left to coast resolution.
+func lintStrayColors(lint *mapLint, img image.Image, config mapgen.GeneratorConfig, inputs map[string][]byte, near int) error {
+	impassable, err := mapgen.ParseImpassableColors(config.ImpassableColors)
+	if err != nil {
+		return err
+	}
+	keys, err := mapgen.ParseKeyColors(config.KeyColors, impassable)
+	if err != nil {
+		return err
+	}
+	palette, err := mapgen.ParsePalette(inputs)
+	if err != nil {
+		return err
+	}
+	special := make([][3]uint8, 0, len(impassable)+len(keys))
+	for c := range impassable {
+		special = append(special, c)
+	}
+	for c := range keys {
+		special = append(special, c)
+	}
+	abs := func(v int) int {
+		if v < 0 {
+			return -v
+		}
+		return v
+	}
+
+	isWater := func(x, y int) bool {
+		if !image.Pt(x, y).In(img.Bounds()) {
+			return false
+		}
+		_, _, b, a := img.At(x, y).RGBA()
+		return a>>8 < 20 || int(b>>8) == config.WaterBlue
+	}
+
+	nearBlue, nearKey := 0, 0
+	var firstBlue, firstKey image.Point
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			if a>>8 < 20 {
+				continue
+			}
+			c := [3]uint8{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8)}
+			_, isImpassable := impassable[c]
+			_, isKey := keys[c]
+			if isImpassable || isKey {
+				continue
+			}
+			for _, s := range special {
+				if abs(int(c[0])-int(s[0])) <= near && abs(int(c[1])-int(s[1])) <= near && abs(int(c[2])-int(s[2])) <= near {
+					if nearKey == 0 {
+						firstKey = image.Pt(x, y)
+					}
+					nearKey++
+					break
+				}
+			}
+			// Blue only means water under the blue channel scheme. Pixels
+			// next to water are blended coast, see resolveAmbiguousCoast.
+			if d := abs(int(c[2]) - config.WaterBlue); palette == nil && d > 0 && d <= near &&
+				!isWater(x-1, y) && !isWater(x+1, y) && !isWater(x, y-1) && !isWater(x, y+1) {
+				if nearBlue == 0 {
+					firstBlue = image.Pt(x, y)
+				}
+				nearBlue++
+			}
+		}
+	}
+	if nearBlue > 0 {
+		lint.fail(fmt.Sprintf("paint them with a blue of exactly %d if they are water, or further from it if they are land", config.WaterBlue),
+			"%d pixel(s) away from water have a blue within %d of %d, the water blue, and are land, the first at %d,%d", nearBlue, near, config.WaterBlue, firstBlue.X, firstBlue.Y)
+	}
+	if nearKey > 0 {
+		lint.fail("paint them with the exact key or impassable colour, or avoid resampling the image with smoothing",
+			"%d pixel(s) are within %d of a \"generator.key_colors\" or \"generator.impassable_colors\" colour without matching it, the first at %d,%d", nearKey, near, firstKey.X, firstKey.Y)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/chai2010/webp"
+)
+
+// mapScaleFiles pairs each packed binary with its manifest section.
+var mapScaleFiles = []struct {
+	File    string
+	Section string
+}{
+	{"map.bin", "map"},
+	{"map4x.bin", "map4x"},
+	{"map16x.bin", "map16x"},
+}
+
+// sha256Hex returns the hex-encoded SHA-256 digest of data.
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// checkChecksumFile returns an error unless name, a key of a manifest's
+// "checksums", is a plain file name inside the map directory.
+func checkChecksumFile(name string) error {
+	if !filepath.IsLocal(name) || filepath.Base(name) != name {
+		return fmt.Errorf("manifest checksum names %q, which is not a file in the map directory", name)
+	}
+	return nil
+}
+
+// verifyMapDir re-reads a generated map directory from disk and checks that
+// it is internally consistent:
+//   - manifest.json parses and has dimensions for every scale;
+//   - every file listed in the manifest "checksums" exists and matches its
+//     SHA-256 digest;
+//   - each packed binary holds exactly width*height bytes for its scale;
+//   - thumbnail.webp decodes in full and has the dimensions of the 1/16 scale map.
+//
+// This catches truncated writes and encoder bugs at build time instead of in
+// players' browsers.
+func verifyMapDir(mapDir string) error {
+	manifestBuffer, err := os.ReadFile(filepath.Join(mapDir, "manifest.json"))
+	if err != nil {
+		return fmt.Errorf("failed to read manifest: %w", err)
+	}
+	var manifest struct {
+		Checksums map[string]string `json:"checksums"`
+		Map       *manifestScale    `json:"map"`
+		Map4x     *manifestScale    `json:"map4x"`
+		Map16x    *manifestScale    `json:"map16x"`
+	}
+	if err := json.Unmarshal(manifestBuffer, &manifest); err != nil {
+		return fmt.Errorf("manifest is not valid JSON: %w", err)
+	}
+	scales := map[string]*manifestScale{
+		"map":    manifest.Map,
+		"map4x":  manifest.Map4x,
+		"map16x": manifest.Map16x,
+	}
+	for section, scale := range scales {
+		if scale == nil || scale.Width <= 0 || scale.Height <= 0 {
+			return fmt.Errorf("manifest has no valid %q dimensions", section)
+		}
+	}
+	if len(manifest.Checksums) == 0 {
+		return fmt.Errorf("manifest has no checksums")
+	}
+
+	files := make(map[string][]byte, len(manifest.Checksums))
+	for name, want := range manifest.Checksums {
+		if err := checkChecksumFile(name); err != nil {
+			return err
+		}
+		data, err := os.ReadFile(filepath.Join(mapDir, name))
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		if got := sha256Hex(data); got != want {
+			return fmt.Errorf("%s checksum mismatch: manifest has %s, file has %s", name, want, got)
+		}
+		files[name] = data
+	}
+
+	for _, f := range mapScaleFiles {
+		data, ok := files[f.File]
+		if !ok {
+			return fmt.Errorf("manifest has no checksum for %s", f.File)
+		}
+		scale := scales[f.Section]
+		if want := scale.Width * scale.Height; len(data) != want {
+			return fmt.Errorf("%s has %d bytes, expected %d (%dx%d)", f.File, len(data), want, scale.Width, scale.Height)
+		}
+	}
+
+	thumbnail, ok := files["thumbnail.webp"]
+	if !ok {
+		return fmt.Errorf("manifest has no checksum for thumbnail.webp")
+	}
+	img, err := webp.Decode(bytes.NewReader(thumbnail))
+	if err != nil {
+		return fmt.Errorf("thumbnail.webp does not decode: %w", err)
+	}
+	if b := img.Bounds(); b.Dx() != manifest.Map16x.Width || b.Dy() != manifest.Map16x.Height {
+		return fmt.Errorf("thumbnail.webp is %dx%d, expected %dx%d", b.Dx(), b.Dy(), manifest.Map16x.Width, manifest.Map16x.Height)
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+//go:build js && wasm
+
+// Command wasm is the map generator built for the browser, so that the
+// client can preview a custom map before it is uploaded. Build it with
+//
+//	GOOS=js GOARCH=wasm go build -o mapgen.wasm ./wasm
+//
+// and load it with the wasm_exec.js of the same Go version. It defines
+//
+//	generateOpenFrontMap(image: Uint8Array, info: string,
+//		inputs?: Record<string, Uint8Array>,
+//		options?: {tileFormat?: number}): Promise<GeneratedMap>
+//
+// which generates a map from its image.png, its info.json as strict JSON and
+// any auxiliary inputs keyed by file name, such as "heightmap.png", packed in
+// the newest tile format the client decodes, options.tileFormat, or the
+// original format 1 without it (see mapformat.TileFormat). The promise
+// resolves to the packed map, map4x and map16x, the thumbnail, a
+// lossless WebP here, and a manifest with the map's dimensions, players,
+// continents, cities, spawns and the warnings generation logged. Generation
+// blocks the page's thread, so run it in a Web Worker.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"syscall/js"
+
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapformat"
+	"github.com/openfrontio/OpenFrontIO/map-generator/pkg/mapgen"
+)
+
+func main() {
+	js.Global().Set("generateOpenFrontMap", js.FuncOf(func(this js.Value, args []js.Value) any {
+		return js.Global().Get("Promise").New(js.FuncOf(func(this js.Value, p []js.Value) any {
+			resolve, reject := p[0], p[1]
+			go func() {
+				result, err := generate(args)
+				if err != nil {
+					reject.Invoke(js.Global().Get("Error").New(err.Error()))
+					return
+				}
+				resolve.Invoke(result)
+			}()
+			return nil
+		}))
+	}))
+	select {}
+}
+
+// previewScale is the manifest section of one packed map scale.
+type previewScale struct {
+	Width        int `json:"width"`
+	Height       int `json:"height"`
+	NumLandTiles int `json:"num_land_tiles"`
+}
+
+// previewManifest is the manifest returned with a generated map: the
+// sections of the generator's manifest.json a preview shows, and the
+// warnings the map would be uploaded with.
+type previewManifest struct {
+	Map        previewScale         `json:"map"`
+	Map4x      previewScale         `json:"map4x"`
+	Map16x     previewScale         `json:"map16x"`
+	Players    mapgen.PlayerCounts  `json:"players"`
+	Continents []mapgen.Continent   `json:"continents"`
+	Cities     []mapgen.City        `json:"cities,omitempty"`
+	Spawns     []mapgen.SpawnPoint  `json:"spawns,omitempty"`
+	Warnings   []string             `json:"warnings"`
+	TileFormat mapformat.TileFormat `json:"tile_format"`
+}
+
+// generate runs GenerateMap on the arguments of generateOpenFrontMap and
+// returns its GeneratedMap.
+func generate(args []js.Value) (js.Value, error) {
+	if len(args) < 2 || args[0].Type() != js.TypeObject || args[1].Type() != js.TypeString {
+		return js.Value{}, fmt.Errorf("generateOpenFrontMap takes the image as a Uint8Array and info.json as a string")
+	}
+	image := bytesFromJS(args[0])
+	info := []byte(args[1].String())
+	inputs := make(map[string][]byte)
+	if len(args) > 2 && args[2].Type() == js.TypeObject {
+		for _, name := range mapgen.AuxInputFiles {
+			if v := args[2].Get(name); v.Type() == js.TypeObject {
+				inputs[name] = bytesFromJS(v)
+			}
+		}
+	}
+	var tileFormat mapformat.TileFormat
+	if len(args) > 3 && args[3].Type() == js.TypeObject {
+		if v := args[3].Get("tileFormat"); v.Type() == js.TypeNumber {
+			tileFormat = mapformat.TileFormat(v.Int())
+		}
+	}
+	config, err := mapgen.ParseGeneratorConfig(info)
+	if err != nil {
+		return js.Value{}, fmt.Errorf("invalid info.json: %w", err)
+	}
+
+	warnings := &warningCollector{}
+	ctx := mapgen.ContextWithLogger(context.Background(), slog.New(warnings))
+	result, err := mapgen.GenerateMap(ctx, mapgen.GeneratorArgs{
+		Name:        "preview",
+		ImageBuffer: image,
+		RemoveSmall: true,
+		Info:        info,
+		Inputs:      inputs,
+		Config:      config,
+		TileFormat:  tileFormat,
+	})
+	if err != nil {
+		return js.Value{}, err
+	}
+	players, err := mapgen.ApplyPlayerCountOverrides(mapgen.RecommendPlayerCounts(result.Stats), info)
+	if err != nil {
+		return js.Value{}, fmt.Errorf("invalid player counts: %w", err)
+	}
+	manifest, err := json.Marshal(previewManifest{
+		Map:        previewScale{result.Map.Width, result.Map.Height, result.Map.NumLandTiles},
+		Map4x:      previewScale{result.Map4x.Width, result.Map4x.Height, result.Map4x.NumLandTiles},
+		Map16x:     previewScale{result.Map16x.Width, result.Map16x.Height, result.Map16x.NumLandTiles},
+		Players:    players,
+		Continents: result.Continents,
+		Cities:     result.Cities,
+		Spawns:     result.Spawns,
+		Warnings:   warnings.Messages(),
+		TileFormat: result.TileFormat,
+	})
+	if err != nil {
+		return js.Value{}, err
+	}
+
+	out := js.Global().Get("Object").New()
+	out.Set("map", bytesToJS(result.Map.Data))
+	out.Set("map4x", bytesToJS(result.Map4x.Data))
+	out.Set("map16x", bytesToJS(result.Map16x.Data))
+	out.Set("thumbnail", bytesToJS(result.Thumbnail))
+	out.Set("manifest", js.Global().Get("JSON").Call("parse", string(manifest)))
+	return out, nil
+}
+
+func bytesFromJS(v js.Value) []byte {
+	b := make([]byte, v.Get("length").Int())
+	js.CopyBytesToGo(b, v)
+	return b
+}
+
+func bytesToJS(b []byte) js.Value {
+	v := js.Global().Get("Uint8Array").New(len(b))
+	js.CopyBytesToJS(v, b)
+	return v
+}
+
+// warningCollector is a slog.Handler keeping the messages of warnings and
+// errors, the only logs a preview shows.
+type warningCollector struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (h *warningCollector) Messages() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string{}, h.messages...)
+}
+
+func (h *warningCollector) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= slog.LevelWarn
+}
+
+func (h *warningCollector) Handle(_ context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.messages = append(h.messages, r.Message)
+	return nil
+}
+
+func (h *warningCollector) WithAttrs([]slog.Attr) slog.Handler { return h }
+
+func (h *warningCollector) WithGroup(string) slog.Handler { return h }